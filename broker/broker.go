@@ -7,19 +7,30 @@ package main
 
 import (
 	"container/heap"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
 	"io"
 	"log"
-	"net"
-	"net/rpc"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"git.torproject.org/pluggable-transports/snowflake.git/common/safelog"
-	// "github.com/prometheus/client_golang/prometheus"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"tgragnato.it/snowflake/broker/brokerrpc"
+	"tgragnato.it/snowflake/common/messages"
+	"tgragnato.it/snowflake/common/otelconfig"
+	"tgragnato.it/snowflake/common/publisher"
 )
 
 type BrokerContext struct {
@@ -30,9 +41,54 @@ type BrokerContext struct {
 	// clients behind an unrestricted NAT.
 	idToSnowflake map[string]*Snowflake
 	// Synchronization for the snowflake map and heap
-	snowflakeLock sync.Mutex
-	proxyPolls    chan *ProxyPoll
-	metrics       *Metrics
+	snowflakeLock      sync.Mutex
+	proxyPolls         chan *ProxyPoll
+	metrics            *Metrics
+	rendezvousTimeouts RendezvousTimeouts
+	// Publisher fans proxy-available events out to an external pub/sub
+	// backend alongside the normal proxy/client matching below; it defaults
+	// to publisher.NoOp{}, so it's always safe to call.
+	Publisher publisher.Publisher
+	// Tracer, if set by main from -otlp-endpoint, has RequestOffer wrap
+	// each proxy poll in a span covering the broker's entire involvement
+	// in a session: the poll arriving, the wait for a matching client
+	// offer (or the ProxyTimeout), and the match outcome. Defaults to a
+	// no-op tracer, so it's always safe to call.
+	Tracer trace.Tracer
+	// Verdicts, if set by main from -probetest-pubkey, caches each proxy's
+	// latest signed symmetric-NAT probetest verdict so it's available for
+	// symmetric-NAT client matching to consult (see VerdictCache.Accepts).
+	// Left nil -- the default, and NewBrokerContext's -- the feature is
+	// off: AddSnowflake's Record call and Accepts both become no-ops.
+	Verdicts *VerdictCache
+	// Store, if set by main from -store, lets proxy registration and
+	// answer rendezvous live somewhere other than this process's own
+	// snowflakes/restrictedSnowflakes/idToSnowflake, so a deployment
+	// can run several broker replicas behind a load balancer against
+	// one shared pool (see BrokerStore and redisBrokerStore). Left nil
+	// -- the default -- nothing reads it yet: AddSnowflake, Broker,
+	// and RequestOffer still go through the fields above directly,
+	// since the client-matching HTTP handlers that would otherwise
+	// consult Store (clientOffers, ampClientOffers, proxyAnswers)
+	// aren't implemented in this tree (see ipc_prometheus.go's doc
+	// comment on IPC). It exists so those handlers have a store to use
+	// once they do.
+	Store BrokerStore
+	// SDPBlocklist, if set by main from -sdp-blocklist-file, is consulted
+	// by Metrics.ValidateClientOfferSDP alongside the built-in private/
+	// unroutable address checks. Left nil -- the default -- blocklist
+	// rejection simply never triggers.
+	SDPBlocklist SDPBlocklist
+	// SDPMaxCandidates, if set by main from -sdp-max-candidates, bounds
+	// how many ICE candidates Metrics.ValidateClientOfferSDP allows in a
+	// single client offer. Left at 0 -- the default -- it falls back to
+	// defaultMaxOfferCandidates.
+	SDPMaxCandidates int
+	// NATHints aggregates per-actual-NAT-type spoofing outcomes reported
+	// by clients across polls, so a future clientOffers handler can
+	// return a data-driven nat.Hint instead of each client guessing from
+	// its own single attempt; see NATHintTracker.
+	NATHints *NATHintTracker
 }
 
 func NewBrokerContext(metricsLogger *log.Logger) *BrokerContext {
@@ -56,28 +112,56 @@ func NewBrokerContext(metricsLogger *log.Logger) *BrokerContext {
 		idToSnowflake:        make(map[string]*Snowflake),
 		proxyPolls:           make(chan *ProxyPoll),
 		metrics:              metrics,
+		rendezvousTimeouts:   NewRendezvousTimeouts(),
+		Publisher:            publisher.NoOp{},
+		Tracer:               trace.NewNoopTracerProvider().Tracer(""),
+		NATHints:             NewNATHintTracker(),
 	}
 }
 
 // Proxies may poll for client offers concurrently.
 type ProxyPoll struct {
-	id           string
-	proxyType    string
-	natType      string
-	offerChannel chan *ClientOffer
+	id                         string
+	proxyType                  string
+	natType                    string
+	verdict                    []byte
+	clients                    int
+	capacity                   int
+	acceptedBridgeFingerprints []string
+	offerChannel               chan *ClientOffer
 }
 
 // Registers a Snowflake and waits for some Client to send an offer,
-// as part of the polling logic of the proxy handler.
-func (ctx *BrokerContext) RequestOffer(id string, proxyType string, natType string) *ClientOffer {
+// as part of the polling logic of the proxy handler. verdict is the raw
+// JSON of a messages.SymmetricNATVerdict the proxy attached to its poll
+// body, or nil if it didn't attach one; AddSnowflake hands it to
+// ctx.Verdicts. clients is the proxy's self-reported concurrent client
+// count (rounded up to a multiple of 8 for its own privacy) and capacity
+// its self-advertised maximum, 0 meaning it didn't advertise one; see
+// Snowflake.atCapacity. acceptedBridgeFingerprints is the proxy's
+// advertised set of bridge fingerprints it's willing to serve, nil or
+// empty meaning the default bridge only; see Snowflake.acceptsBridge.
+func (ctx *BrokerContext) RequestOffer(id string, proxyType string, natType string, verdict []byte, clients int, capacity int, acceptedBridgeFingerprints []string) *ClientOffer {
+	_, span := ctx.Tracer.Start(context.Background(), "snowflake.broker.request_offer")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("snowflake.proxy_type", proxyType),
+		attribute.String("snowflake.nat_type", natType),
+	)
+
 	request := new(ProxyPoll)
 	request.id = id
 	request.proxyType = proxyType
 	request.natType = natType
+	request.verdict = verdict
+	request.clients = clients
+	request.capacity = capacity
+	request.acceptedBridgeFingerprints = acceptedBridgeFingerprints
 	request.offerChannel = make(chan *ClientOffer)
 	ctx.proxyPolls <- request
 	// Block until an offer is available, or timeout which sends a nil offer.
 	offer := <-request.offerChannel
+	span.SetAttributes(attribute.Bool("snowflake.matched", offer != nil))
 	return offer
 }
 
@@ -86,23 +170,26 @@ func (ctx *BrokerContext) RequestOffer(id string, proxyType string, natType stri
 // client offer or nil on timeout / none are available.
 func (ctx *BrokerContext) Broker() {
 	for request := range ctx.proxyPolls {
-		snowflake := ctx.AddSnowflake(request.id, request.proxyType, request.natType)
+		snowflake := ctx.AddSnowflake(request.id, request.proxyType, request.natType, request.verdict, request.clients, request.capacity, request.acceptedBridgeFingerprints)
 		// Wait for a client to avail an offer to the snowflake.
 		go func(request *ProxyPoll) {
+			snowflake.dispatchedAt = time.Now()
 			select {
 			case offer := <-snowflake.offerChannel:
+				snowflake.RecordAnswer()
 				request.offerChannel <- offer
 			case <-time.After(time.Second * ProxyTimeout):
 				// This snowflake is no longer available to serve clients.
 				ctx.snowflakeLock.Lock()
 				defer ctx.snowflakeLock.Unlock()
 				if snowflake.index != -1 {
+					snowflake.RecordTimeout()
 					if request.natType == NATUnrestricted {
 						heap.Remove(ctx.snowflakes, snowflake.index)
 					} else {
 						heap.Remove(ctx.restrictedSnowflakes, snowflake.index)
 					}
-					// ctx.metrics.promMetrics.AvailableProxies.With(prometheus.Labels{"nat": request.natType, "type": request.proxyType}).Dec()
+					ctx.metrics.promMetrics.AvailableProxies.With(prometheus.Labels{"nat": request.natType, "type": request.proxyType}).Dec()
 					delete(ctx.idToSnowflake, snowflake.id)
 					close(request.offerChannel)
 				}
@@ -114,23 +201,52 @@ func (ctx *BrokerContext) Broker() {
 // Create and add a Snowflake to the heap.
 // Required to keep track of proxies between providing them
 // with an offer and awaiting their second POST with an answer.
-func (ctx *BrokerContext) AddSnowflake(id string, proxyType string, natType string) *Snowflake {
+// verdict is the raw JSON of a messages.SymmetricNATVerdict the proxy
+// attached to its poll body (nil if it didn't attach one); it's recorded
+// against id in ctx.Verdicts, a no-op if ctx.Verdicts is nil. clients is
+// the proxy's self-reported concurrent client count and capacity its
+// self-advertised maximum, 0 meaning it didn't advertise one; see
+// Snowflake.atCapacity. acceptedBridgeFingerprints is the proxy's
+// advertised set of bridge fingerprints it's willing to serve, nil or
+// empty meaning the default bridge only; see Snowflake.acceptsBridge.
+func (ctx *BrokerContext) AddSnowflake(id string, proxyType string, natType string, verdict []byte, clients int, capacity int, acceptedBridgeFingerprints []string) *Snowflake {
+	ctx.Verdicts.Record(id, verdict)
+
 	snowflake := new(Snowflake)
 	snowflake.id = id
-	snowflake.clients = 0
+	snowflake.clients = clients
+	snowflake.capacity = capacity
+	snowflake.acceptedBridgeFingerprints = acceptedBridgeFingerprints
 	snowflake.proxyType = proxyType
 	snowflake.natType = natType
 	snowflake.offerChannel = make(chan *ClientOffer)
 	snowflake.answerChannel = make(chan string)
+	// Assumed reliable until RecordTimeout says otherwise, so a brand new
+	// proxy isn't starved of PopWeighted's selection weight from the start.
+	snowflake.successEWMA = 1
 	ctx.snowflakeLock.Lock()
 	if natType == NATUnrestricted {
 		heap.Push(ctx.snowflakes, snowflake)
 	} else {
 		heap.Push(ctx.restrictedSnowflakes, snowflake)
 	}
-	// ctx.metrics.promMetrics.AvailableProxies.With(prometheus.Labels{"nat": natType, "type": proxyType}).Inc()
+	ctx.metrics.promMetrics.AvailableProxies.With(prometheus.Labels{"nat": natType, "type": proxyType}).Inc()
 	ctx.snowflakeLock.Unlock()
+	ctx.metrics.RecordProxyLoad(natType, clients)
 	ctx.idToSnowflake[id] = snowflake
+
+	// Fire-and-forget: the match itself does not wait on subscribers, so
+	// this runs against a background context rather than one tied to the
+	// proxy's own poll request.
+	ctx.Publisher.Publish(context.Background(), publisher.Event{
+		Type:     publisher.EventProxyAvailable,
+		ClientID: id,
+		Attributes: map[string]string{
+			"proxyType": proxyType,
+			"natType":   natType,
+		},
+	})
+
 	return snowflake
 }
 
@@ -138,6 +254,12 @@ func (ctx *BrokerContext) AddSnowflake(id string, proxyType string, natType stri
 type ClientOffer struct {
 	natType string
 	sdp     []byte
+	// bridgeFingerprint is the bridge the client requested, from its
+	// poll's optional Fingerprint field (see messages.ClientPollRequest
+	// and client/lib's BridgeFingerprint), or "" for the default bridge.
+	// It's matched against a Snowflake's acceptedBridgeFingerprints; see
+	// Snowflake.acceptsBridge.
+	bridgeFingerprint string
 }
 
 func main() {
@@ -148,8 +270,58 @@ func main() {
 	var metricsFilename string
 	var unsafeLogging bool
 
+	var metricsAddr string
+	var metricsCertFilename string
+	var metricsKeyFilename string
+	var metricsBearerToken string
+
+	var metricsEpsilon float64
+	var metricsSensitivity float64
+	var metricsThreshold uint64
+	var metricsNoise string
+
+	var metricsTopK int
+	var metricsWindow time.Duration
+	var metricsIPDedupCapacity int
+	var metricsExemplars bool
+	var metricsCountryReportTopN int
+
 	var socket string
 
+	var ipcTransport string
+	var ipcTCPAddr string
+	var ipcTCPCert string
+	var ipcTCPKey string
+	var ipcTCPClientCA string
+	var ipcHTTPAddr string
+
+	var quicAddr string
+	var quicCertFilename string
+	var quicKeyFilename string
+
+	var sqsQueueName string
+	var sqsRegion string
+
+	var store string
+
+	var sdpBlocklistFilename string
+	var sdpMaxCandidates int
+
+	var otlpEndpoint string
+	var otlpHeaders string
+	var otlpProtocol string
+	var otlpInsecure bool
+	var otlpCompression string
+
+	var probetestPubkeyFilename string
+	var probetestVerdictMaxAge time.Duration
+
+	rendezvousTimeouts := NewRendezvousTimeouts()
+
+	flag.DurationVar(&rendezvousTimeouts.HTTP, "rendezvous-timeout-http", rendezvousTimeouts.HTTP, "how long to wait for a proxy answer to a client polling over HTTP before giving up")
+	flag.DurationVar(&rendezvousTimeouts.AMPCache, "rendezvous-timeout-ampcache", rendezvousTimeouts.AMPCache, "how long to wait for a proxy answer to a client polling through the AMP cache before giving up")
+	flag.DurationVar(&rendezvousTimeouts.SQS, "rendezvous-timeout-sqs", rendezvousTimeouts.SQS, "how long to wait for a proxy answer to a client polling over SQS before giving up")
+
 	flag.StringVar(&geoipDatabase, "geoipdb", "/usr/share/tor/geoip", "path to correctly formatted geoip database mapping IPv4 address ranges to country codes")
 	flag.StringVar(&geoip6Database, "geoip6db", "/usr/share/tor/geoip6", "path to correctly formatted geoip database mapping IPv6 address ranges to country codes")
 	flag.BoolVar(&disableGeoip, "disable-geoip", false, "don't use geoip for stats collection")
@@ -157,8 +329,52 @@ func main() {
 	flag.StringVar(&metricsFilename, "metrics-log", "", "path to metrics logging output")
 	flag.BoolVar(&unsafeLogging, "unsafe-logging", false, "prevent logs from being scrubbed")
 
+	flag.StringVar(&metricsAddr, "prometheus-addr", "", "address to serve Prometheus /metrics on, e.g. \"127.0.0.1:9999\" (disabled if empty)")
+	flag.StringVar(&metricsCertFilename, "prometheus-cert", "", "TLS certificate file for the Prometheus endpoint (optional)")
+	flag.StringVar(&metricsKeyFilename, "prometheus-key", "", "TLS key file for the Prometheus endpoint (optional)")
+	flag.StringVar(&metricsBearerToken, "prometheus-token", "", "if set, require this bearer token to scrape the Prometheus endpoint")
+
+	flag.Float64Var(&metricsEpsilon, "metrics-epsilon", defaultEpsilon, "differential privacy budget for per-country histograms (only used when -metrics-noise is not \"none\")")
+	flag.Float64Var(&metricsSensitivity, "metrics-sensitivity", defaultSensitivity, "per-report sensitivity of the per-country histograms, i.e. the most one client/proxy's activity can change a published count, for scaling -metrics-epsilon's noise")
+	flag.Uint64Var(&metricsThreshold, "metrics-threshold", binWidth, "suppress a country from the published histograms if its noised count falls below this threshold")
+	flag.StringVar(&metricsNoise, "metrics-noise", "none", "noise mechanism for per-country histograms: \"laplace\", \"gaussian\", or \"none\" (the original round-to-multiple-of-8 binning)")
+
+	flag.IntVar(&metricsTopK, "metrics-topk", 0, "if set, bound per-country histograms to this many tracked countries (via a Space-Saving estimator) instead of counting every country exactly")
+	flag.DurationVar(&metricsWindow, "metrics-window", metricsResolution, "how often to flush and reset the daily metrics report")
+	flag.IntVar(&metricsIPDedupCapacity, "metrics-ips-capacity", 0, "if set, bound the \"seen proxy IP\" dedup check to this many entries using a fixed-size probabilistic set instead of growing unbounded")
+	flag.IntVar(&metricsCountryReportTopN, "metrics-country-top-n", 0, "if set, print this many countries by name in the client-country-match/denied log lines instead of the default 20, folding the rest into \"others\"")
+	flag.BoolVar(&metricsExemplars, "metrics-exemplars", false, "attach OpenMetrics exemplars (coarse hour-of-day bucket and k-anonymized rendezvous cohort) to client poll and match counters, for correlating load spikes with cohort composition")
+
 	flag.StringVar(&socket, "socket", "/tmp/broker.sock", "path to ipc socket")
 
+	flag.StringVar(&ipcTransport, "ipc-transport", "unix", "how http-frontend (and s3.go/sqs.go, in-process) reach this daemon's IPC: \"unix\" (the default, -socket) requires them to share a filesystem; \"tcp\" listens on -ipc-tcp-addr over mandatory mutual TLS so they can run on separate hosts; \"http\" listens on -ipc-http-addr as a JSON-RPC endpoint suitable for a reverse proxy or domain-fronted CDN in front of it")
+	flag.StringVar(&ipcTCPAddr, "ipc-tcp-addr", "", "TCP address to serve IPC on when -ipc-transport=tcp, e.g. \"127.0.0.1:9001\"")
+	flag.StringVar(&ipcTCPCert, "ipc-tcp-cert", "", "TLS certificate file for -ipc-transport=tcp")
+	flag.StringVar(&ipcTCPKey, "ipc-tcp-key", "", "TLS key file for -ipc-transport=tcp")
+	flag.StringVar(&ipcTCPClientCA, "ipc-tcp-client-ca", "", "PEM file of CAs trusted to sign a front-end's client certificate for -ipc-transport=tcp; required, since IPC grants full broker control and tcp drops the unix socket's filesystem-permission boundary")
+	flag.StringVar(&ipcHTTPAddr, "ipc-http-addr", "", "address to serve IPC's JSON-RPC endpoint on when -ipc-transport=http, e.g. \"127.0.0.1:9001\"")
+
+	flag.StringVar(&quicAddr, "quic-addr", "", "UDP address to accept client/proxy rendezvous requests over raw QUIC, e.g. \":8443\" (disabled if empty). This is separate from http-frontend's own -enable-quic/-quic-addr, which carries ordinary HTTP over QUIC; this listener speaks messages.Arg framing directly.")
+	flag.StringVar(&quicCertFilename, "quic-cert", "", "TLS certificate file for the raw-QUIC rendezvous listener (required if -quic-addr is set)")
+	flag.StringVar(&quicKeyFilename, "quic-key", "", "TLS key file for the raw-QUIC rendezvous listener (required if -quic-addr is set)")
+
+	flag.StringVar(&sqsQueueName, "sqs-queue-name", "", "name of the AWS SQS queue to poll for client offers, e.g. \"snowflake-broker\" (disabled if empty). Credentials and default region come from the standard AWS SDK chain (environment, shared config, or instance role); -sqs-region overrides the region.")
+	flag.StringVar(&sqsRegion, "sqs-region", "", "AWS region the -sqs-queue-name queue lives in. Left empty, it's taken from the SDK's default region resolution.")
+
+	flag.StringVar(&store, "store", "", "where to keep registered-proxy and answer-rendezvous state: empty (the default) keeps it in this process's own memory; \"redis://host:port\" shares it with every other broker replica pointed at the same Redis server. Nothing in this build reads BrokerContext.Store yet -- see its doc comment -- so this only has an effect once something does.")
+
+	flag.StringVar(&sdpBlocklistFilename, "sdp-blocklist-file", "", "path to a file of CIDR ranges, one per line, that a client offer's ICE candidates are rejected for resolving into, in addition to the always-rejected private/unroutable address space (disabled if empty)")
+	flag.IntVar(&sdpMaxCandidates, "sdp-max-candidates", 0, "reject a client offer with more ICE candidates than this (0, the default, uses defaultMaxOfferCandidates)")
+
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP collector `endpoint` (host:port) to export traces to.\nThis only wires up tracing (see BrokerContext.Tracer) -- unlike snowflake-proxy's -otlp-endpoint, it doesn't also export this broker's own Prometheus counters (see -prometheus-addr above) through the same pipeline; that would need a generic Prometheus-registry-to-OTLP bridge this repo doesn't otherwise depend on.")
+	flag.StringVar(&otlpHeaders, "otlp-headers", "", "comma-separated key=value headers to send with every OTLP export request, e.g. for collector authentication")
+	flag.StringVar(&otlpProtocol, "otlp-protocol", "http", "OTLP wire protocol: \"http\" or \"grpc\"")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "disable TLS on the OTLP exporter connection")
+	flag.StringVar(&otlpCompression, "otlp-compression", "", "OTLP export compression: \"gzip\" or \"\" (none)")
+
+	flag.StringVar(&probetestPubkeyFilename, "probetest-pubkey", "", "path to a raw ed25519 public key file; if set, proxies may attach a signed messages.SymmetricNATVerdict to their poll and the broker caches it per proxy (see VerdictCache). Disabled, the default, if empty.")
+	flag.DurationVar(&probetestVerdictMaxAge, "probetest-verdict-max-age", 6*time.Hour, "a cached symmetric-NAT verdict older than this is treated as untrusted, falling back to blind matching for that proxy")
+
 	flag.Parse()
 
 	var err error
@@ -186,6 +402,70 @@ func main() {
 	metricsLogger := log.New(metricsFile, "", 0)
 
 	ctx := NewBrokerContext(metricsLogger)
+	ctx.rendezvousTimeouts = rendezvousTimeouts
+
+	if otlpEndpoint != "" {
+		otlpHeaderMap, err := otelconfig.ParseHeaders(otlpHeaders)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		tracerProvider, err := otelconfig.NewTracerProvider(context.Background(), otelconfig.Config{
+			Endpoint:    otlpEndpoint,
+			Headers:     otlpHeaderMap,
+			Protocol:    otlpProtocol,
+			Insecure:    otlpInsecure,
+			Compression: otlpCompression,
+		})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		ctx.Tracer = tracerProvider.Tracer("tgragnato.it/snowflake/broker")
+	}
+
+	if probetestPubkeyFilename != "" {
+		rawPubkey, err := os.ReadFile(probetestPubkeyFilename)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		pubkey, err := messages.ParseEd25519PublicKey(rawPubkey)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		ctx.Verdicts = NewVerdictCache(pubkey, probetestVerdictMaxAge, ctx.metrics)
+	}
+
+	if strings.HasPrefix(store, "redis://") {
+		redisStore, err := newRedisBrokerStore(store)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		ctx.Store = redisStore
+	}
+
+	if sdpBlocklistFilename != "" || sdpMaxCandidates != 0 {
+		// Metrics.ValidateClientOfferSDP has no caller in this build -- the
+		// clientOffers HTTP handler it would guard isn't implemented in
+		// this tree (see BrokerContext.Store's doc comment) -- so neither
+		// flag does anything yet. Warn rather than let an operator believe
+		// -sdp-blocklist-file/-sdp-max-candidates are filtering offers.
+		log.Print("warning: -sdp-blocklist-file/-sdp-max-candidates are set, but this build has no client-offer handler that calls ValidateClientOfferSDP; they currently have no effect")
+	}
+
+	if sdpBlocklistFilename != "" {
+		blocklist, err := LoadSDPBlocklist(sdpBlocklistFilename)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		ctx.SDPBlocklist = blocklist
+	}
+	ctx.SDPMaxCandidates = sdpMaxCandidates
+
+	ctx.metrics.SetDPConfig(metricsNoise, metricsEpsilon, metricsSensitivity, metricsThreshold)
+	ctx.metrics.SetTopK(metricsTopK)
+	ctx.metrics.SetIPDedupCapacity(metricsIPDedupCapacity, 0.001)
+	ctx.metrics.SetCountryReportTopN(metricsCountryReportTopN)
+	ctx.metrics.SetFlushWindow(metricsWindow)
+	ctx.metrics.SetExemplarsEnabled(metricsExemplars)
 
 	if !disableGeoip {
 		err = ctx.metrics.LoadGeoipDatabases(geoipDatabase, geoip6Database)
@@ -194,6 +474,12 @@ func main() {
 		}
 	}
 
+	if metricsAddr != "" {
+		if err := ctx.metrics.promMetrics.ServeMetrics(metricsAddr, metricsCertFilename, metricsKeyFilename, metricsBearerToken); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
 	go ctx.Broker()
 
 	sigChan := make(chan os.Signal, 1)
@@ -217,13 +503,97 @@ func main() {
 	// }
 
 	ipc := &IPC{ctx}
-	rpc.Register(ipc)
 
-	l, err := net.Listen("unix", socket)
+	switch ipcTransport {
+	case "unix":
+		l, err := brokerrpc.ServeUnix(ipc, socket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+	case "tcp":
+		if ipcTCPClientCA == "" {
+			log.Fatal("-ipc-tcp-client-ca is required when -ipc-transport=tcp")
+		}
+
+		cert, err := tls.LoadX509KeyPair(ipcTCPCert, ipcTCPKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		clientCAs, err := loadCertPool(ipcTCPClientCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		l, err := brokerrpc.ServeTCP(ipc, ipcTCPAddr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+	case "http":
+		srv, err := brokerrpc.ServeHTTP(ipc, ipcHTTPAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer srv.Close()
+	default:
+		log.Fatalf("unknown -ipc-transport %q: want \"unix\", \"tcp\", or \"http\"", ipcTransport)
+	}
+
+	if quicAddr != "" {
+		cert, err := tls.LoadX509KeyPair(quicCertFilename, quicKeyFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		quic, err := newQuicHandler(quicAddr, &tls.Config{Certificates: []tls.Certificate{cert}}, ipc, ctx.metrics)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go quic.Accept(context.Background())
+	}
+
+	if sqsQueueName != "" {
+		var cfgOpts []func(*config.LoadOptions) error
+		if sqsRegion != "" {
+			cfgOpts = append(cfgOpts, config.WithRegion(sqsRegion))
+		}
+		awsCfg, err := config.LoadDefaultConfig(context.Background(), cfgOpts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		sqsHandler, err := newSQSHandler(context.Background(), sqs.NewFromConfig(awsCfg), sqsQueueName, sqsRegion, ipc, ctx.metrics, rendezvousTimeouts.SQS)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go sqsHandler.PollAndHandleMessages(context.Background())
+	}
+
+	// Every transport above serves in the background; block here so main
+	// doesn't return out from under them.
+	select {}
+}
+
+// loadCertPool reads a PEM file of CA certificates into an *x509.CertPool,
+// for -ipc-tcp-client-ca.
+func loadCertPool(pemFile string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(pemFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("reading %q: %w", pemFile, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates found in %q", pemFile)
 	}
-	defer l.Close()
 
-	rpc.Accept(l)
+	return pool, nil
 }
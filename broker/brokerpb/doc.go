@@ -0,0 +1,16 @@
+// Package brokerpb holds the generated Go bindings for broker.proto's
+// BrokerService, once they're generated -- this tree doesn't have protoc
+// or buf available to run
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  broker/brokerpb/broker.proto
+//
+// so broker.pb.go and broker_grpc.pb.go aren't checked in yet. There is no
+// gRPC server or client here, generated or otherwise: broker.proto is a
+// schema only. The broker daemon and its http-frontend still talk over the
+// net/rpc-over-unix-socket IPC type in broker/ipc_prometheus.go, and will
+// keep doing so until those bindings land and the gRPC server/client
+// implementations that depend on them are written against real generated
+// types instead of hand-guessed ones.
+package brokerpb
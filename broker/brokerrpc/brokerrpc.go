@@ -0,0 +1,228 @@
+// Package brokerrpc exposes a net/rpc receiver -- the broker daemon's IPC
+// type, in practice -- over more transports than a single
+// net.Listen("unix", socket), so the daemon and its http-frontend(s) no
+// longer have to share a filesystem. It wraps net/rpc and
+// net/rpc/jsonrpc rather than replacing them: every method the receiver
+// exposes is reachable the same way (Client.Call("IPC.Method", arg,
+// &reply)) regardless of which ServeXxx/DialXxx pair carried the call.
+//
+// This is a stopgap on the way to the gRPC migration broker/brokerpb
+// describes, not a replacement for it: it only changes how the existing
+// net/rpc wire format is carried, not the wire format itself.
+package brokerrpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+// ServeUnix registers rcvr on a fresh *rpc.Server and accepts connections
+// on socket using the stdlib net/rpc gob wire format, the same behavior
+// main.go had before brokerrpc existed. The returned net.Listener is the
+// caller's to Close when shutting down.
+func ServeUnix(rcvr interface{}, socket string) (net.Listener, error) {
+	server := rpc.NewServer()
+	if err := server.Register(rcvr); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	go server.Accept(l)
+
+	return l, nil
+}
+
+// ServeTCP registers rcvr and accepts connections on addr over TLS,
+// carrying the same gob wire format as ServeUnix. tlsConfig must already
+// carry the broker's server certificate; if tlsConfig.ClientCAs is set
+// (mutual TLS, verifying the front-end connecting to it) the caller is
+// expected to have also set ClientAuth, e.g. to
+// tls.RequireAndVerifyClientCert, before calling ServeTCP.
+func ServeTCP(rcvr interface{}, addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	server := rpc.NewServer()
+	if err := server.Register(rcvr); err != nil {
+		return nil, err
+	}
+
+	l, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.ServeConn(conn)
+		}
+	}()
+
+	return l, nil
+}
+
+// rpcPath is the HTTP path ServeHTTP listens on and DialHTTP posts to.
+const rpcPath = "/brokerrpc"
+
+// ServeHTTP registers rcvr and serves it as a JSON-RPC endpoint on addr,
+// suitable for running the broker behind a reverse proxy or a
+// domain-fronted CDN that only forwards plain HTTP(S): each POST to
+// rpcPath carries exactly one JSON-RPC request and gets exactly one
+// JSON-RPC response back, rather than holding the connection open the way
+// ServeUnix/ServeTCP do. The returned *http.Server is the caller's to
+// Shutdown.
+func ServeHTTP(rcvr interface{}, addr string) (*http.Server, error) {
+	server := rpc.NewServer()
+	if err := server.Register(rcvr); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(rpcPath, func(w http.ResponseWriter, r *http.Request) {
+		conn := &httpServerConn{body: r.Body, w: w}
+		server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	})
+
+	httpServer := &http.Server{Addr: addr, Handler: mux}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go httpServer.Serve(l)
+
+	return httpServer, nil
+}
+
+// httpServerConn adapts one HTTP request/response pair into the
+// io.ReadWriteCloser a jsonrpc.ServerCodec reads and writes a single
+// call's worth of JSON on -- ServeCodec reads one request, we write the
+// matching response into w, and then reading returns io.EOF so ServeCodec
+// stops rather than blocking for a second request on the same "connection".
+type httpServerConn struct {
+	body io.ReadCloser
+	w    http.ResponseWriter
+
+	read bool
+}
+
+func (c *httpServerConn) Read(p []byte) (int, error) {
+	if c.read {
+		return 0, io.EOF
+	}
+
+	n, err := c.body.Read(p)
+	if err == io.EOF {
+		c.read = true
+	}
+
+	return n, err
+}
+
+func (c *httpServerConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+func (c *httpServerConn) Close() error {
+	return c.body.Close()
+}
+
+// DialUnix dials socket and returns an *rpc.Client speaking the gob wire
+// format ServeUnix serves.
+func DialUnix(socket string) (*rpc.Client, error) {
+	return rpc.Dial("unix", socket)
+}
+
+// DialTCP dials addr over TLS and returns an *rpc.Client speaking the gob
+// wire format ServeTCP serves. tlsConfig carries the front-end's own
+// client certificate for mutual TLS, if the broker requires one.
+func DialTCP(addr string, tlsConfig *tls.Config) (*rpc.Client, error) {
+	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpc.NewClient(conn), nil
+}
+
+// DialHTTP returns an *rpc.Client that posts each call as a JSON-RPC
+// request to url (which should include the rpcPath ServeHTTP listens on,
+// e.g. "https://broker.example.com/brokerrpc"), the counterpart to
+// ServeHTTP. httpClient is used as given, so the caller can configure its
+// own TLS client certificate, proxying, or timeouts; a nil httpClient uses
+// http.DefaultClient.
+func DialHTTP(url string, httpClient *http.Client) *rpc.Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return rpc.NewClientWithCodec(jsonrpc.NewClientCodec(&httpClientConn{
+		url:    url,
+		client: httpClient,
+		bodies: make(chan io.ReadCloser, 1),
+	}))
+}
+
+// httpClientConn adapts a series of POSTs to url into the single
+// long-lived io.ReadWriteCloser a jsonrpc.ClientCodec expects.
+//
+// rpc.NewClientWithCodec starts a background goroutine that calls Read
+// before any call has been made (it's waiting for a response to a request
+// that doesn't exist yet), so Read can't simply require a prior Write: it
+// blocks on bodies instead, which Write populates once the POST it issued
+// gets a response. This mirrors httpServerConn's one-call-per-body framing
+// from the other side, at the cost of only ever having one call in flight
+// at a time -- net/rpc's pipelining of multiple concurrent calls isn't
+// supported over this transport.
+type httpClientConn struct {
+	url    string
+	client *http.Client
+	bodies chan io.ReadCloser
+
+	current io.ReadCloser
+}
+
+func (c *httpClientConn) Write(p []byte) (int, error) {
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+
+	c.bodies <- resp.Body
+
+	return len(p), nil
+}
+
+func (c *httpClientConn) Read(p []byte) (int, error) {
+	if c.current == nil {
+		c.current = <-c.bodies
+	}
+
+	n, err := c.current.Read(p)
+	if err == io.EOF {
+		c.current.Close()
+		c.current = nil
+	}
+
+	return n, err
+}
+
+func (c *httpClientConn) Close() error {
+	if c.current != nil {
+		return c.current.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package brokerrpc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// EchoService is a minimal net/rpc receiver standing in for IPC, so these
+// tests exercise each transport's framing without depending on
+// broker/ipc_prometheus.go's real (and broker-package-internal) IPC type.
+type EchoService struct{}
+
+func (e *EchoService) Double(arg string, reply *string) error {
+	*reply = arg + arg
+	return nil
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	return addr
+}
+
+// selfSignedCert returns a throwaway certificate valid for 127.0.0.1, for
+// TestServeDialTCP's server; the client side dials with InsecureSkipVerify
+// since pinning a CA isn't what this test is about.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServeDialUnix(t *testing.T) {
+	socket := t.TempDir() + "/brokerrpc.sock"
+
+	l, err := ServeUnix(new(EchoService), socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := DialUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var reply string
+	if err := c.Call("EchoService.Double", "hi", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hihi" {
+		t.Fatalf("Call() reply = %q, want %q", reply, "hihi")
+	}
+}
+
+func TestServeDialTCP(t *testing.T) {
+	addr := freeAddr(t)
+	cert := selfSignedCert(t)
+
+	l, err := ServeTCP(new(EchoService), addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := DialTCP(addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var reply string
+	if err := c.Call("EchoService.Double", "hi", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hihi" {
+		t.Fatalf("Call() reply = %q, want %q", reply, "hihi")
+	}
+}
+
+func TestServeDialHTTP(t *testing.T) {
+	addr := freeAddr(t)
+
+	srv, err := ServeHTTP(new(EchoService), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// ServeHTTP's listener is already accepting by the time it returns, but
+	// give the goroutine running http.Server.Serve a moment to schedule.
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ServeHTTP did not start listening on %s in time", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client := DialHTTP("http://"+addr+rpcPath, nil)
+	defer client.Close()
+
+	var reply string
+	if err := client.Call("EchoService.Double", "hi", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hihi" {
+		t.Fatalf("Call() reply = %q, want %q", reply, "hihi")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// boundedSet is a fixed-size, probabilistic set membership test: a plain
+// (non-counting) Bloom filter sized for a target capacity and
+// false-positive rate. It replaces an unbounded sync.Map of "seen" keys,
+// trading a small, bounded false-positive rate (a never-added key reported
+// as already seen) for O(1) memory that doesn't grow with the number of
+// distinct proxy IPs seen in a reporting interval. Single keys can't be
+// removed; Clear empties the whole set.
+type boundedSet struct {
+	mu   sync.Mutex
+	bits []bool
+	k    int // number of hash functions
+}
+
+// newBoundedSet returns a boundedSet sized to hold capacity items at no
+// more than falsePositiveRate chance of a false positive, using the
+// standard optimal-Bloom-filter sizing formulas. falsePositiveRate is
+// clamped to (0, 1); capacity below 1 is treated as 1.
+func newBoundedSet(capacity int, falsePositiveRate float64) *boundedSet {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.001
+	}
+
+	n := float64(capacity)
+	m := math.Ceil(-(n * math.Log(falsePositiveRate)) / (math.Ln2 * math.Ln2))
+	k := int(math.Round((m / n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &boundedSet{
+		bits: make([]bool, int(m)),
+		k:    k,
+	}
+}
+
+// Add reports whether key was already (probably) present, then records it
+// as present. A false "not present" report is impossible; a false
+// "present" report (for a key never added) happens at up to the configured
+// false-positive rate.
+func (s *boundedSet) Add(key string) (alreadyPresent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alreadyPresent = true
+	for i := 0; i < s.k; i++ {
+		idx := s.hash(key, i)
+		if !s.bits[idx] {
+			alreadyPresent = false
+			s.bits[idx] = true
+		}
+	}
+	return alreadyPresent
+}
+
+// Clear resets the set to empty, for the start of a new reporting
+// interval.
+func (s *boundedSet) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.bits {
+		s.bits[i] = false
+	}
+}
+
+func (s *boundedSet) hash(key string, seed int) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// Mix in the seed so each of the k hash functions probes a different
+	// slot: every probe hashes key afresh with its own seed appended.
+	h.Write([]byte{byte(seed), byte(seed >> 8)})
+	return h.Sum64() % uint64(len(s.bits))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exemplarCohortK is the minimum number of events a published cohort
+// bucket is expected to represent. It only informs cohortTruncation below;
+// it is not separately enforced, the same way metricsThreshold informs but
+// does not replace the DP noise it's paired with.
+const exemplarCohortK = 8
+
+// cohortTruncation is how many hex characters of the cohort hash are kept.
+// 3 hex characters give 4096 buckets, which keeps each bucket's expected
+// occupancy comfortably above exemplarCohortK even on a quiet broker.
+const cohortTruncation = 3
+
+// exemplarCounterVec mirrors a safeprom.CounterVec with a plain
+// prometheus.CounterVec so each increment can carry an OpenMetrics
+// exemplar. safeprom.Counter only implements Inc(), not
+// prometheus.ExemplarAdder, so the rounded series it backs can't carry
+// exemplars directly; this sits alongside it instead, under its own
+// metric name, and is only registered when exemplars are enabled.
+type exemplarCounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+// newExemplarCounterVec builds the mirror CounterVec for name, with an
+// "hour" label (coarse time-of-day bucket) and a "cohort" label (k-
+// anonymized cc|nat|rendezvous_method) added to labelNames.
+func newExemplarCounterVec(opts prometheus.CounterOpts, labelNames []string) *exemplarCounterVec {
+	return &exemplarCounterVec{
+		vec: prometheus.NewCounterVec(opts, append(append([]string{}, labelNames...), "hour", "cohort")),
+	}
+}
+
+// Inc records one occurrence of labels, attaching an exemplar built from
+// the current hour-of-day bucket and the k-anonymized cohort for cc,
+// natType and rendezvousMethod.
+func (e *exemplarCounterVec) Inc(labels prometheus.Labels, cc, natType, rendezvousMethod string) {
+	hour := hourBucket(time.Now())
+	cohort := cohortID(cc, natType, rendezvousMethod)
+
+	full := prometheus.Labels{"hour": hour, "cohort": cohort}
+	for k, v := range labels {
+		full[k] = v
+	}
+
+	counter := e.vec.With(full)
+	counter.(prometheus.ExemplarAdder).AddWithExemplar(1, prometheus.Labels{
+		"hour":   hour,
+		"cohort": cohort,
+	})
+}
+
+// hourBucket reports t's hour of day in UTC, as a coarse timestamp bucket
+// that can't be used to reconstruct the exact time of an event.
+func hourBucket(t time.Time) string {
+	return t.UTC().Format("15")
+}
+
+// cohortID returns a k-anonymized identifier for the (cc, natType,
+// rendezvousMethod) tuple: a SHA-256 hash of the tuple, truncated to
+// cohortTruncation hex characters so that any single cohort bucket is
+// expected to be shared by at least exemplarCohortK events rather than
+// identifying one.
+func cohortID(cc, natType, rendezvousMethod string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{cc, natType, rendezvousMethod}, "|")))
+	return hex.EncodeToString(sum[:])[:cohortTruncation]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/rpc"
+	"os"
+
+	"tgragnato.it/snowflake/broker/brokerrpc"
+)
+
+// dialBroker reaches the broker daemon's IPC over whichever transport
+// matches its own -ipc-transport flag, mirroring broker.go's own
+// -ipc-transport/-ipc-tcp-*/-ipc-http-addr flags from the client side.
+func dialBroker(transport, socket, tcpAddr, tcpCert, tcpKey, tcpServerCA, httpURL string) (*rpc.Client, error) {
+	switch transport {
+	case "unix":
+		return brokerrpc.DialUnix(socket)
+
+	case "tcp":
+		tlsConfig := &tls.Config{}
+
+		if tcpCert != "" || tcpKey != "" {
+			cert, err := tls.LoadX509KeyPair(tcpCert, tcpKey)
+			if err != nil {
+				return nil, fmt.Errorf("loading -ipc-tcp-cert/-ipc-tcp-key: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		if tcpServerCA != "" {
+			pemBytes, err := os.ReadFile(tcpServerCA)
+			if err != nil {
+				return nil, fmt.Errorf("reading -ipc-tcp-server-ca: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pemBytes) {
+				return nil, fmt.Errorf("no certificates found in -ipc-tcp-server-ca %q", tcpServerCA)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		return brokerrpc.DialTCP(tcpAddr, tlsConfig)
+
+	case "http":
+		return brokerrpc.DialHTTP(httpURL, nil), nil
+
+	default:
+		return nil, fmt.Errorf("unknown -ipc-transport %q: want \"unix\", \"tcp\", or \"http\"", transport)
+	}
+}
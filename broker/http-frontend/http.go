@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"io"
@@ -11,11 +13,17 @@ import (
 	"net/rpc"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 
-	// "github.com/prometheus/client_golang/prometheus"
-	// "github.com/prometheus/client_golang/prometheus/promhttp"
 	"git.torproject.org/pluggable-transports/snowflake.git/common/messages"
 	"git.torproject.org/pluggable-transports/snowflake.git/common/safelog"
+	"git.torproject.org/pluggable-transports/snowflake.git/common/util"
+	"github.com/pion/webrtc/v4"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/crypto/acme/autocert"
 )
 
@@ -63,22 +71,58 @@ func robotsTxtHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func metricsHandler(metricsFilename string, w http.ResponseWriter, r *http.Request) {
+	id, start := newRequestID(), time.Now()
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
 	if metricsFilename == "" {
 		http.NotFound(w, r)
+		logRequest(id, "metrics", r, start, 0, "", nil)
 		return
 	}
 	metricsFile, err := os.OpenFile(metricsFilename, os.O_RDONLY, 0644)
 	if err != nil {
-		log.Println("Error opening metrics file for reading")
 		http.NotFound(w, r)
+		logRequest(id, "metrics", r, start, 0, "", err)
 		return
 	}
 
-	if _, err := io.Copy(w, metricsFile); err != nil {
-		log.Printf("copying metricsFile returned error: %v", err)
+	_, err = io.Copy(w, metricsFile)
+	logRequest(id, "metrics", r, start, 0, "", err)
+}
+
+// rpcGatherer implements prometheus.Gatherer by pulling a freshly
+// gathered snapshot of the broker daemon's metric families over c each
+// time Gather is called, via the IPC.PrometheusSnapshot RPC. This lets
+// promhttp.HandlerFor serve metrics that actually live in the daemon's
+// registry (ctx.metrics.promMetrics, across the unix socket) from a
+// handler running in this frontend process.
+type rpcGatherer struct {
+	c *rpc.Client
+}
+
+func (g rpcGatherer) Gather() ([]*dto.MetricFamily, error) {
+	var families []*dto.MetricFamily
+	if err := g.c.Call("IPC.PrometheusSnapshot", new(interface{}), &families); err != nil {
+		return nil, err
 	}
+	return families, nil
+}
+
+// servePrometheus serves a Prometheus text-exposition scrape of the
+// broker daemon's metrics, reached over c, on its own listener bound to
+// listenAddr -- distinct from the public addr that clients and proxies
+// hit -- so an operator can point a scraper at a private interface
+// without exposing it alongside /client, /proxy, and /answer.
+func servePrometheus(listenAddr string, c *rpc.Client) {
+	mux := http.NewServeMux()
+	mux.Handle("/prometheus", promhttp.HandlerFor(rpcGatherer{c}, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Addr: listenAddr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("prometheus listener on %s failed: %v", listenAddr, err)
+		}
+	}()
 }
 
 func debugHandler(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
@@ -100,16 +144,19 @@ func debugHandler(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
 For snowflake proxies to request a client from the Broker.
 */
 func proxyPolls(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
+	id, start := newRequestID(), time.Now()
+
 	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, readLimit))
 	if err != nil {
-		log.Println("Invalid data.")
 		w.WriteHeader(http.StatusBadRequest)
+		logRequest(id, "proxyPolls", r, start, len(body), "", err)
 		return
 	}
 
 	arg := messages.Arg{
 		Body:       body,
-		RemoteAddr: r.RemoteAddr,
+		RemoteAddr: clientIPResolver.ClientIP(r),
+		RequestID:  id,
 	}
 
 	var response []byte
@@ -118,18 +165,18 @@ func proxyPolls(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
 	case err == nil:
 	case errors.Is(err, messages.ErrBadRequest):
 		w.WriteHeader(http.StatusBadRequest)
+		logRequest(id, "proxyPolls", r, start, len(body), "", err)
 		return
 	case errors.Is(err, messages.ErrInternal):
 		fallthrough
 	default:
-		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
+		logRequest(id, "proxyPolls", r, start, len(body), "", err)
 		return
 	}
 
-	if _, err := w.Write(response); err != nil {
-		log.Printf("proxyPolls unable to write offer with error: %v", err)
-	}
+	_, writeErr := w.Write(response)
+	logRequest(id, "proxyPolls", r, start, len(body), "", writeErr)
 }
 
 /*
@@ -138,10 +185,13 @@ snowflake proxy, which responds with the SDP answer to be sent in
 the HTTP response back to the client.
 */
 func clientOffers(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
+	id, start := newRequestID(), time.Now()
+	natType := r.Header.Get("Snowflake-NAT-Type")
+
 	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, readLimit))
 	if err != nil {
-		log.Printf("Error reading client request: %s", err.Error())
 		w.WriteHeader(http.StatusBadRequest)
+		logRequest(id, "clientOffers", r, start, len(body), natType, err)
 		return
 	}
 
@@ -151,35 +201,36 @@ func clientOffers(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
 		isLegacy = true
 		req := messages.ClientPollRequest{
 			Offer: string(body),
-			NAT:   r.Header.Get("Snowflake-NAT-Type"),
+			NAT:   natType,
 		}
 		body, err = req.EncodePollRequest()
 		if err != nil {
-			log.Printf("Error shimming the legacy request: %s", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
+			logRequest(id, "clientOffers", r, start, len(body), natType, err)
 			return
 		}
 	}
 
 	arg := messages.Arg{
 		Body:       body,
-		RemoteAddr: "",
+		RemoteAddr: clientIPResolver.ClientIP(r),
+		RequestID:  id,
 	}
 
 	var response []byte
 	err = c.Call("IPC.ClientOffers", arg, &response)
 	if err != nil {
 		// Assert err == messages.ErrInternal
-		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
+		logRequest(id, "clientOffers", r, start, len(body), natType, err)
 		return
 	}
 
 	if isLegacy {
-		resp, err := messages.DecodeClientPollResponse(response)
-		if err != nil {
-			log.Println(err)
+		resp, decodeErr := messages.DecodeClientPollResponse(response)
+		if decodeErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
+			logRequest(id, "clientOffers", r, start, len(body), natType, decodeErr)
 			return
 		}
 		switch resp.Error {
@@ -187,18 +238,19 @@ func clientOffers(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
 			response = []byte(resp.Answer)
 		case "no snowflake proxies currently available":
 			w.WriteHeader(http.StatusServiceUnavailable)
+			logRequest(id, "clientOffers", r, start, len(body), natType, nil)
 			return
 		case "timed out waiting for answer!":
 			w.WriteHeader(http.StatusGatewayTimeout)
+			logRequest(id, "clientOffers", r, start, len(body), natType, nil)
 			return
 		default:
 			panic("unknown error")
 		}
 	}
 
-	if _, err := w.Write(response); err != nil {
-		log.Printf("clientOffers unable to write answer with error: %v", err)
-	}
+	_, writeErr := w.Write(response)
+	logRequest(id, "clientOffers", r, start, len(body), natType, writeErr)
 }
 
 /*
@@ -207,16 +259,19 @@ an offer from proxyHandler to respond with an answer in an HTTP POST,
 which the broker will pass back to the original client.
 */
 func proxyAnswers(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
+	id, start := newRequestID(), time.Now()
+
 	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, readLimit))
 	if err != nil {
-		log.Println("Invalid data.")
 		w.WriteHeader(http.StatusBadRequest)
+		logRequest(id, "proxyAnswers", r, start, len(body), "", err)
 		return
 	}
 
 	arg := messages.Arg{
 		Body:       body,
-		RemoteAddr: "",
+		RemoteAddr: clientIPResolver.ClientIP(r),
+		RequestID:  id,
 	}
 
 	var response []byte
@@ -225,18 +280,189 @@ func proxyAnswers(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
 	case err == nil:
 	case errors.Is(err, messages.ErrBadRequest):
 		w.WriteHeader(http.StatusBadRequest)
+		logRequest(id, "proxyAnswers", r, start, len(body), "", err)
 		return
 	case errors.Is(err, messages.ErrInternal):
 		fallthrough
 	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		logRequest(id, "proxyAnswers", r, start, len(body), "", err)
+		return
+	}
+
+	_, writeErr := w.Write(response)
+	logRequest(id, "proxyAnswers", r, start, len(body), "", writeErr)
+}
+
+// whipResources tracks the resource IDs handed out in the Location header
+// of a whipHandler response, so whipResourceHandler has something to check
+// a DELETE teardown request against. By the time an answer has gone out,
+// Snowflake's own rendezvous bookkeeping is already done; this map exists
+// purely so a WHIP/WHEP client's DELETE gets the 200/404 it expects instead
+// of always succeeding or always 404ing.
+var (
+	whipResourcesMu sync.Mutex
+	whipResources   = make(map[string]struct{})
+)
+
+const whipResourcePrefix = "/whip/resource/"
+
+func whipResourcePath(id string) string {
+	return whipResourcePrefix + id
+}
+
+func newWHIPResource() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	whipResourcesMu.Lock()
+	whipResources[id] = struct{}{}
+	whipResourcesMu.Unlock()
+	return id, nil
+}
+
+func deleteWHIPResource(id string) bool {
+	whipResourcesMu.Lock()
+	defer whipResourcesMu.Unlock()
+	if _, ok := whipResources[id]; !ok {
+		return false
+	}
+	delete(whipResources, id)
+	return true
+}
+
+/*
+Implements the client side of WHIP/WHEP (the WebRTC-HTTP Ingestion and
+Egress Protocols): the client POSTs a raw application/sdp offer, instead of
+the JSON envelope clientOffers expects, and gets back a 201 Created with a
+raw SDP answer body and a Location header identifying the new resource.
+This lets off-the-shelf WHIP/WHEP tooling (OBS, ffmpeg, browsers' native
+WHIP support) drive a Snowflake rendezvous without adopting the custom JSON
+envelope.
+*/
+func whipHandler(c *rpc.Client, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	offerSDP, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, readLimit))
+	if err != nil {
+		log.Printf("whipHandler: error reading offer: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The raw SDP is run through the same local-address stripping and
+	// candidate-address extraction as the JSON path, since both act
+	// directly on the SDP string. util.Serialize/DeserializeSessionDescription
+	// are bypassed for the offer itself -- there's no JSON envelope to wrap.
+	strippedSDP := util.StripLocalAddresses(string(offerSDP))
+	remoteAddr := ""
+	if candidateAddrs := util.GetCandidateAddrs(strippedSDP); len(candidateAddrs) > 0 {
+		remoteAddr = candidateAddrs[0].String()
+	}
+
+	offerJSON, err := util.SerializeSessionDescription(&webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  strippedSDP,
+	})
+	if err != nil {
+		log.Printf("whipHandler: error serializing offer: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	req := messages.ClientPollRequest{
+		Offer: offerJSON,
+		NAT:   r.Header.Get("Snowflake-NAT-Type"),
+	}
+	body, err := req.EncodePollRequest()
+	if err != nil {
+		log.Printf("whipHandler: error encoding poll request: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	arg := messages.Arg{
+		Body:             body,
+		RemoteAddr:       remoteAddr,
+		RendezvousMethod: messages.RendezvousWhip,
+	}
+
+	var response []byte
+	if err := c.Call("IPC.ClientOffers", arg, &response); err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if _, err := w.Write(response); err != nil {
-		log.Printf("proxyAnswers unable to write answer response with error: %v", err)
+	resp, err := messages.DecodeClientPollResponse(response)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	switch resp.Error {
+	case "":
+	case messages.StrNoProxies:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	case messages.StrTimedOut:
+		w.WriteHeader(http.StatusGatewayTimeout)
+		return
+	default:
+		log.Printf("whipHandler: unexpected poll response error: %s", resp.Error)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	answer, err := util.DeserializeSessionDescription(resp.Answer)
+	if err != nil {
+		log.Printf("whipHandler: error deserializing answer: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resourceID, err := newWHIPResource()
+	if err != nil {
+		log.Printf("whipHandler: error allocating resource: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", whipResourcePath(resourceID))
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write([]byte(answer.SDP)); err != nil {
+		log.Printf("whipHandler unable to write answer with error: %v", err)
+	}
+}
+
+// whipResourceHandler implements DELETE on a WHIP/WHEP resource's Location
+// URL, tearing it down. Snowflake's rendezvous is already complete and
+// stateless by the time a resource exists, so there's nothing left to
+// release on the broker side beyond the bookkeeping in whipResources; a 404
+// is returned if the resource is unknown or was already deleted.
+func whipResourceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Session-ID")
+	if r.Method == http.MethodOptions {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, whipResourcePrefix)
+	if !deleteWHIPResource(id) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
 }
 
 func main() {
@@ -249,9 +475,31 @@ func main() {
 
 	var metricsFilename string
 	var unsafeLogging bool
+	var logFormat string
+
+	var prometheusListenAddr string
 
 	var socket string
 
+	var ipcTransport string
+	var ipcTCPAddr string
+	var ipcTCPCert string
+	var ipcTCPKey string
+	var ipcTCPServerCA string
+	var ipcHTTPURL string
+
+	var mtlsClientCAFile string
+	var mtlsAllowedCNs string
+	var mtlsAllowedSPKIPins string
+
+	var enableQUIC bool
+	var quicAddr string
+
+	var tenantConfigFile string
+
+	var trustedProxies string
+	var realIPHeader string
+
 	flag.StringVar(&acmeEmail, "acme-email", "", "optional contact email for Let's Encrypt notifications")
 	flag.StringVar(&acmeHostnamesCommas, "acme-hostnames", "", "comma-separated hostnames for TLS certificate")
 	flag.StringVar(&certFilename, "cert", "", "TLS certificate file")
@@ -262,9 +510,31 @@ func main() {
 
 	flag.StringVar(&metricsFilename, "metrics-log", "", "path to metrics logging output")
 	flag.BoolVar(&unsafeLogging, "unsafe-logging", false, "prevent logs from being scrubbed")
+	flag.StringVar(&logFormat, "log-format", "text", "structured log output format for SnowflakeHandler's request logging: \"text\" or \"json\"")
+
+	flag.StringVar(&prometheusListenAddr, "prometheus-listen", "", "address to serve a Prometheus /prometheus scrape of the broker daemon's metrics on, e.g. \"127.0.0.1:9999\" (disabled if empty)")
 
 	flag.StringVar(&socket, "socket", "/tmp/broker.sock", "path to ipc socket")
 
+	flag.StringVar(&ipcTransport, "ipc-transport", "unix", "how to reach the broker daemon's IPC; must match its own -ipc-transport. \"unix\" (the default, -socket) requires this process and the broker daemon to share a filesystem; \"tcp\" dials -ipc-tcp-addr over mandatory mutual TLS so they can run on separate hosts; \"http\" posts JSON-RPC to -ipc-http-url")
+	flag.StringVar(&ipcTCPAddr, "ipc-tcp-addr", "", "broker daemon address to dial when -ipc-transport=tcp, e.g. \"broker.example.com:9001\"")
+	flag.StringVar(&ipcTCPCert, "ipc-tcp-cert", "", "this front-end's own TLS client certificate for -ipc-transport=tcp")
+	flag.StringVar(&ipcTCPKey, "ipc-tcp-key", "", "TLS key file for -ipc-tcp-cert")
+	flag.StringVar(&ipcTCPServerCA, "ipc-tcp-server-ca", "", "PEM file of CAs trusted to sign the broker daemon's TLS certificate for -ipc-transport=tcp")
+	flag.StringVar(&ipcHTTPURL, "ipc-http-url", "", "URL of the broker daemon's JSON-RPC endpoint when -ipc-transport=http, e.g. \"https://broker.example.com/brokerrpc\"")
+
+	flag.StringVar(&mtlsClientCAFile, "mtls-client-ca", "", "require and verify client certificates signed by this CA (PEM); enables mTLS")
+	flag.StringVar(&mtlsAllowedCNs, "mtls-allowed-cns", "", "comma-separated allow-list of client certificate Common Names (default: any CN signed by -mtls-client-ca)")
+	flag.StringVar(&mtlsAllowedSPKIPins, "mtls-allowed-spki-pins", "", "comma-separated allow-list of client certificate SPKI pins, \"sha256/<base64>\" (default: any cert signed by -mtls-client-ca)")
+
+	flag.BoolVar(&enableQUIC, "enable-quic", false, "also serve the same handlers over HTTP/3 (QUIC); requires TLS")
+	flag.StringVar(&quicAddr, "quic-addr", "", "UDP address for the HTTP/3 listener (default: same host:port as -addr)")
+
+	flag.StringVar(&tenantConfigFile, "tenant", "", "path to a YAML file of tenant entries, for serving several independent bridge lines (each with its own SNI hostname, autocert cache, relay pattern, metrics log, and IPC socket) from this one process instead of a single bridge line.\nMutually exclusive with -acme-hostnames, -cert/-key, -socket, and -metrics-log, which all become per-tenant fields in the YAML file instead.")
+
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated CIDR ranges of reverse proxies (nginx, Caddy, Cloudflare, ...) directly in front of this process; Forwarded/X-Forwarded-For hops, and -real-ip-header if set, are only trusted when they arrive through one of these (default: trust none, so the client IP fed into geoip metrics is always the direct TCP peer)")
+	flag.StringVar(&realIPHeader, "real-ip-header", "", "single-IP header (e.g. \"X-Real-IP\") a -trusted-proxies reverse proxy sets to the real client address, consulted in preference to Forwarded/X-Forwarded-For")
+
 	flag.Parse()
 
 	var logOutput io.Writer = os.Stderr
@@ -276,12 +546,42 @@ func main() {
 	}
 	log.SetFlags(log.LstdFlags | log.LUTC)
 
-	var c, err = rpc.Dial("unix", socket)
+	// SnowflakeHandler's handlers (proxyPolls, clientOffers, proxyAnswers)
+	// and metricsHandler log their per-request events through this
+	// structured logger instead of the plain one configured above, which
+	// the rest of this file (ACME/TLS setup, serveQUIC, whipHandler, ...)
+	// still uses.
+	structuredLogger, err := newLogger(logFormat, unsafeLogging, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger = structuredLogger
+
+	trustedProxyRanges, err := util.ParseTrustedProxyCIDRs(trustedProxies)
+	if err != nil {
+		log.Fatalf("-trusted-proxies: %v", err)
+	}
+	resolver, err := util.NewClientIPResolver(trustedProxyRanges, realIPHeader)
+	if err != nil {
+		log.Fatalf("-real-ip-header: %v", err)
+	}
+	clientIPResolver = resolver
+
+	if tenantConfigFile != "" {
+		runMultiTenant(tenantConfigFile, addr)
+		return
+	}
+
+	c, err := dialBroker(ipcTransport, socket, ipcTCPAddr, ipcTCPCert, ipcTCPKey, ipcTCPServerCA, ipcHTTPURL)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer c.Close()
 
+	if prometheusListenAddr != "" {
+		servePrometheus(prometheusListenAddr, c)
+	}
+
 	http.HandleFunc("/robots.txt", robotsTxtHandler)
 
 	http.Handle("/proxy", SnowflakeHandler{c, proxyPolls})
@@ -289,12 +589,31 @@ func main() {
 	http.Handle("/answer", SnowflakeHandler{c, proxyAnswers})
 	http.Handle("/debug", SnowflakeHandler{c, debugHandler})
 
+	http.Handle("/whip", SnowflakeHandler{c, whipHandler})
+	http.HandleFunc(whipResourcePrefix, whipResourceHandler)
+
 	http.Handle("/metrics", MetricsHandler{metricsFilename, metricsHandler})
-	// http.Handle("/prometheus", promhttp.HandlerFor(ctx.metrics.promMetrics.registry, promhttp.HandlerOpts{}))
+
+	mtls, err := newMTLSPolicy(mtlsClientCAFile, mtlsAllowedCNs, mtlsAllowedSPKIPins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if mtls != nil && disableTLS {
+		log.Fatal("-mtls-client-ca requires TLS; it is not allowed with -disable-tls")
+	}
+	if enableQUIC && disableTLS {
+		log.Fatal("-enable-quic requires TLS; it is not allowed with -disable-tls")
+	}
+	if quicAddr == "" {
+		quicAddr = addr
+	}
 
 	server := http.Server{
 		Addr: addr,
 	}
+	if mtls != nil {
+		server.TLSConfig = mtls.apply(&tls.Config{})
+	}
 
 	// Handle the various ways of setting up TLS. The legal configurations
 	// are:
@@ -325,12 +644,30 @@ func main() {
 			log.Fatal(http.ListenAndServe(":80", certManager.HTTPHandler(nil)))
 		}()
 
-		server.TLSConfig = &tls.Config{GetCertificate: certManager.GetCertificate}
+		if mtls != nil {
+			server.TLSConfig.GetCertificate = certManager.GetCertificate
+		} else {
+			server.TLSConfig = &tls.Config{GetCertificate: certManager.GetCertificate}
+		}
+		if enableQUIC {
+			go serveQUIC(quicAddr, server.TLSConfig)
+		}
 		err = server.ListenAndServeTLS("", "")
 	} else if certFilename != "" && keyFilename != "" {
 		if acmeEmail != "" || acmeHostnamesCommas != "" {
 			log.Fatalf("The --cert and --key options are not allowed with --acme-email or --acme-hostnames.")
 		}
+		if enableQUIC {
+			cert, err := tls.LoadX509KeyPair(certFilename, keyFilename)
+			if err != nil {
+				log.Fatal(err)
+			}
+			tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+			if mtls != nil {
+				tlsConfig = mtls.apply(tlsConfig)
+			}
+			go serveQUIC(quicAddr, tlsConfig)
+		}
 		err = server.ListenAndServeTLS(certFilename, keyFilename)
 	} else if disableTLS {
 		err = server.ListenAndServe()
@@ -342,3 +679,18 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// serveQUIC runs an HTTP/3 server on addr using tlsConfig, sharing
+// http.DefaultServeMux (and so every handler registered above) with the
+// HTTP/1.1 and HTTP/2 server started by main. It's started in its own
+// goroutine alongside whichever of server.ListenAndServeTLS's branches
+// main took, since http3.Server listens on UDP rather than TCP.
+func serveQUIC(addr string, tlsConfig *tls.Config) {
+	server := &http3.Server{
+		Addr:      addr,
+		TLSConfig: tlsConfig,
+		Handler:   http.DefaultServeMux,
+	}
+	log.Printf("Starting HTTP/3 (QUIC) listener on %s", addr)
+	log.Fatal(server.ListenAndServe())
+}
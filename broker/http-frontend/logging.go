@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"git.torproject.org/pluggable-transports/snowflake.git/common/safelog"
+	"git.torproject.org/pluggable-transports/snowflake.git/common/util"
+	"github.com/rs/zerolog"
+)
+
+// logger is the structured logger SnowflakeHandler, proxyPolls,
+// clientOffers, proxyAnswers, and metricsHandler log through, in place of
+// the ad-hoc log.Printf/log.Println calls they used to make. main installs
+// the real logger built by newLogger; until then (e.g. in tests that
+// construct these handlers directly) it's a no-op, so nothing panics on a
+// nil logger.
+var logger = zerolog.Nop()
+
+// clientIPResolver is the util.ClientIPResolver proxyPolls, clientOffers,
+// and proxyAnswers use to derive the RemoteAddr they pass along in
+// messages.Arg (whipHandler takes its RemoteAddr from the offer's first
+// ICE candidate instead). main installs the real resolver built from
+// -trusted-proxies/-real-ip-header; until then it trusts no CIDRs, which
+// makes it behave like a plain RemoteAddr passthrough (see
+// util.ClientIPResolver.ClientIP) -- safe for tests that construct these
+// handlers directly without running main.
+var clientIPResolver = newDefaultClientIPResolver()
+
+func newDefaultClientIPResolver() *util.ClientIPResolver {
+	r, err := util.NewClientIPResolver(nil, "")
+	if err != nil {
+		// Can't happen: nil trustedRanges and an empty realIPHeader are
+		// always valid.
+		panic(err)
+	}
+	return r
+}
+
+// newLogger builds the logger main installs into the package-level logger
+// var. format selects "text" (zerolog's human-readable ConsoleWriter) or
+// "json" (zerolog's native line-delimited JSON); any other value is an
+// error. Unless unsafeLogging is set, output is routed through
+// safelog.LogScrubber first, the same scrubber main's old
+// log.SetOutput(&safelog.LogScrubber{...}) call used to write through --
+// so a remote_ip_scrubbed field is still redacted on the way out, in
+// text or JSON alike.
+func newLogger(format string, unsafeLogging bool, output io.Writer) (zerolog.Logger, error) {
+	if !unsafeLogging {
+		output = &safelog.LogScrubber{Output: output}
+	}
+	switch format {
+	case "", "text":
+		output = zerolog.ConsoleWriter{Out: output, TimeFormat: time.RFC3339}
+	case "json":
+		// zerolog's default writer already emits line-delimited JSON.
+	default:
+		return zerolog.Logger{}, fmt.Errorf("unknown log format %q (want \"text\" or \"json\")", format)
+	}
+	return zerolog.New(output).With().Timestamp().Logger(), nil
+}
+
+// newRequestID returns a short random hex string to correlate every log
+// line, and every IPC call (see messages.Arg.RequestID), that belongs to
+// one HTTP request -- offer arrived, matched, answer returned -- the same
+// way a reverse proxy's X-Request-Id header would.
+func newRequestID() string {
+	var b [8]byte
+	// crypto/rand.Read only fails if the OS entropy source is broken, in
+	// which case an all-zero ID still lets every other logged field
+	// correlate normally; it just collides with any other such failure in
+	// the same process lifetime.
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// logRequest emits the one structured event a handler logs per request.
+// natType and rpcErr are omitted from the event when zero-valued, since
+// most endpoints don't have one or the other (proxyPolls and proxyAnswers
+// never learn a nat_type, for instance).
+func logRequest(id, endpoint string, r *http.Request, start time.Time, bytesIn int, natType string, rpcErr error) {
+	ev := logger.Info().
+		Str("request_id", id).
+		Str("endpoint", endpoint).
+		Str("remote_ip_scrubbed", r.RemoteAddr).
+		Int("bytes_in", bytesIn).
+		Int64("duration_ms", time.Since(start).Milliseconds())
+	if natType != "" {
+		ev = ev.Str("nat_type", natType)
+	}
+	if rpcErr != nil {
+		ev = ev.Str("rpc_error", rpcErr.Error())
+	}
+	ev.Msg("handled request")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// mtlsPolicy optionally requires and verifies a peer certificate on every
+// incoming connection, for a deployment where only known proxies or
+// partner infrastructure (e.g. a crowdsec LAPI-style bouncer/agent
+// relationship) are allowed to poll the broker at all -- instead of the
+// default "anyone who finds the URL can poll" model.
+//
+// A peer certificate is accepted if allowedCNs is empty or its Subject
+// Common Name is listed there, AND allowedSPKIPins is empty or its
+// SubjectPublicKeyInfo hash matches one of the pins there. Either list
+// left empty skips that check, so an operator can pin by CN alone, by SPKI
+// alone, or (setting both) require a match on both.
+type mtlsPolicy struct {
+	clientCAs       *x509.CertPool
+	allowedCNs      map[string]struct{}
+	allowedSPKIPins map[string]struct{}
+}
+
+// newMTLSPolicy builds an mtlsPolicy from an operator's command-line
+// configuration: clientCAFile is the PEM file of CAs trusted to sign peer
+// certificates (required to enable mTLS at all); allowedCNsCommas and
+// allowedSPKIPinsCommas are comma-separated allow-lists, each optional.
+// SPKI pins use the "sha256/<base64>" format popularized by HPKP, computed
+// over the certificate's DER-encoded SubjectPublicKeyInfo.
+func newMTLSPolicy(clientCAFile, allowedCNsCommas, allowedSPKIPinsCommas string) (*mtlsPolicy, error) {
+	if clientCAFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading mTLS client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in mTLS client CA file %q", clientCAFile)
+	}
+
+	p := &mtlsPolicy{clientCAs: pool}
+	if allowedCNsCommas != "" {
+		p.allowedCNs = make(map[string]struct{})
+		for _, cn := range strings.Split(allowedCNsCommas, ",") {
+			p.allowedCNs[strings.TrimSpace(cn)] = struct{}{}
+		}
+	}
+	if allowedSPKIPinsCommas != "" {
+		p.allowedSPKIPins = make(map[string]struct{})
+		for _, pin := range strings.Split(allowedSPKIPinsCommas, ",") {
+			p.allowedSPKIPins[strings.TrimSpace(pin)] = struct{}{}
+		}
+	}
+	return p, nil
+}
+
+// spkiPin computes the "sha256/<base64>" pin of cert's SubjectPublicKeyInfo.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPeerCertificate is installed as tls.Config.VerifyPeerCertificate: by
+// the time it runs, the standard library has already verified the chain
+// against ClientCAs, so this only needs to apply p's CN and SPKI allow-lists
+// to the leaf certificate.
+func (p *mtlsPolicy) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return fmt.Errorf("mTLS: no verified peer certificate")
+	}
+	leaf := verifiedChains[0][0]
+
+	if p.allowedCNs != nil {
+		if _, ok := p.allowedCNs[leaf.Subject.CommonName]; !ok {
+			return fmt.Errorf("mTLS: peer certificate CN %q is not allow-listed", leaf.Subject.CommonName)
+		}
+	}
+	if p.allowedSPKIPins != nil {
+		if _, ok := p.allowedSPKIPins[spkiPin(leaf)]; !ok {
+			return fmt.Errorf("mTLS: peer certificate SPKI pin is not allow-listed")
+		}
+	}
+	return nil
+}
+
+// apply layers p's client-certificate requirement onto an existing
+// tls.Config (already carrying the broker's own server certificate
+// configuration), returning the combined config.
+func (p *mtlsPolicy) apply(tlsConfig *tls.Config) *tls.Config {
+	tlsConfig.ClientCAs = p.clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.VerifyPeerCertificate = p.verifyPeerCertificate
+	return tlsConfig
+}
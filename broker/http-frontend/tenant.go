@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+	"gopkg.in/yaml.v3"
+)
+
+// tenantConfig is one entry of the --tenant YAML file: a single bridge
+// line's worth of configuration, letting one broker process front several
+// independent deployments on the same :443 instead of an operator running
+// N separate binaries (and N separate autocert caches) behind an SNI
+// router in front of them.
+type tenantConfig struct {
+	// SNI is the ClientHello server name this tenant answers to. Also
+	// used as the sole autocert host policy entry for this tenant's
+	// certificate, the same as a single-tenant broker's -acme-hostnames.
+	SNI string `yaml:"sni"`
+	// RelayDomainNamePattern records the allowlisted relay hostname
+	// pattern for this tenant's bridge line, in the same "foo.com$"/
+	// "^foo.com$" syntax as SnowflakeProxy.RelayDomainNamePattern.
+	//
+	// It is not enforced here: the broker daemon this tenant's Socket
+	// points at is the process that matches clients to proxies, and the
+	// net/rpc IPC protocol it speaks (see broker/ipc_prometheus.go) has no
+	// field to carry a per-tenant policy across the socket. For now this
+	// is recorded for operator tooling/documentation; actually enforcing
+	// it broker-side would mean extending messages.Arg and teaching
+	// BrokerContext about it, which is future work.
+	RelayDomainNamePattern string `yaml:"relayDomainNamePattern"`
+	// MetricsLogFilename is this tenant's own -metrics-log path, served
+	// at its /metrics the same way the single-tenant metricsFilename flag
+	// is.
+	MetricsLogFilename string `yaml:"metricsLogFilename"`
+	// AcmeCertCacheDir is this tenant's own autocert cache directory. Each
+	// tenant needs its own, the same reason each needs its own Socket: a
+	// shared cache would mix up which private key answers for which SNI.
+	AcmeCertCacheDir string `yaml:"acmeCertCacheDir"`
+	// AcmeEmail is this tenant's optional Let's Encrypt contact email.
+	AcmeEmail string `yaml:"acmeEmail"`
+	// Socket is the path to this tenant's own broker daemon's IPC socket
+	// (that daemon's own -socket flag), exactly as the single-tenant
+	// -socket flag is for the only broker in a non-multi-tenant setup.
+	Socket string `yaml:"socket"`
+}
+
+// loadTenants parses the --tenant YAML file at path into one tenantConfig
+// per bridge line.
+func loadTenants(path string) ([]tenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tenant config: %w", err)
+	}
+	var tenants []tenantConfig
+	if err := yaml.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("parsing tenant config: %w", err)
+	}
+	for i := range tenants {
+		if tenants[i].SNI == "" {
+			return nil, fmt.Errorf("tenant %d: sni is required", i)
+		}
+		if tenants[i].Socket == "" {
+			return nil, fmt.Errorf("tenant %q: socket is required", tenants[i].SNI)
+		}
+	}
+	return tenants, nil
+}
+
+// tenant is a loaded tenantConfig wired up to its own IPC connection,
+// autocert manager, and HTTP mux -- everything SnowflakeHandler and
+// friends need, scoped to one bridge line.
+type tenant struct {
+	cfg         tenantConfig
+	c           *rpc.Client
+	mux         *http.ServeMux
+	certManager *autocert.Manager
+}
+
+// newTenant dials cfg.Socket and builds cfg's own /client, /proxy,
+// /answer, /metrics, and /debug routes on a private ServeMux, the same
+// handlers a single-tenant broker registers on http.DefaultServeMux.
+func newTenant(cfg tenantConfig) (*tenant, error) {
+	c, err := rpc.Dial("unix", cfg.Socket)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: dialing IPC socket %q: %w", cfg.SNI, cfg.Socket, err)
+	}
+
+	var cache autocert.Cache
+	if cfg.AcmeCertCacheDir != "" {
+		if err := os.MkdirAll(cfg.AcmeCertCacheDir, 0700); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("tenant %q: creating acme cert cache dir: %w", cfg.SNI, err)
+		}
+		cache = autocert.DirCache(cfg.AcmeCertCacheDir)
+	}
+	certManager := &autocert.Manager{
+		Cache:      cache,
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.SNI),
+		Email:      cfg.AcmeEmail,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", robotsTxtHandler)
+	mux.Handle("/proxy", SnowflakeHandler{c, proxyPolls})
+	mux.Handle("/client", SnowflakeHandler{c, clientOffers})
+	mux.Handle("/answer", SnowflakeHandler{c, proxyAnswers})
+	mux.Handle("/debug", SnowflakeHandler{c, debugHandler})
+	mux.Handle("/metrics", MetricsHandler{cfg.MetricsLogFilename, metricsHandler})
+
+	return &tenant{cfg: cfg, c: c, mux: mux, certManager: certManager}, nil
+}
+
+// tenantRouter dispatches an incoming TLS connection (via
+// tls.Config.GetConfigForClient, which Go's tls package already calls
+// with a ClientHelloInfo parsed from a peek at the ClientHello) and an
+// incoming HTTP request (via ServeHTTP, keyed on the same SNI the
+// ClientHello carried) to the one tenant whose SNI matches.
+type tenantRouter struct {
+	byName map[string]*tenant
+}
+
+// newTenantRouter builds a tenantRouter from every configured tenant,
+// dialing each one's IPC socket and starting its autocert manager.
+func newTenantRouter(tenants []tenantConfig) (*tenantRouter, error) {
+	router := &tenantRouter{byName: make(map[string]*tenant, len(tenants))}
+	for _, cfg := range tenants {
+		t, err := newTenant(cfg)
+		if err != nil {
+			return nil, err
+		}
+		router.byName[cfg.SNI] = t
+	}
+	return router, nil
+}
+
+// getConfigForClient is installed as tls.Config.GetConfigForClient: it
+// peeks hello.ServerName (already parsed by the standard library from the
+// raw ClientHello) and returns a *tls.Config whose GetCertificate serves
+// only that tenant's certificate.
+func (tr *tenantRouter) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	t, ok := tr.byName[hello.ServerName]
+	if !ok {
+		return nil, fmt.Errorf("no tenant configured for SNI %q", hello.ServerName)
+	}
+	return &tls.Config{GetCertificate: t.certManager.GetCertificate}, nil
+}
+
+// ServeHTTP dispatches to the tenant whose SNI matches the TLS connection
+// this request arrived on, so each bridge line only ever sees its own
+// /client, /proxy, /answer, /metrics, and /debug traffic.
+func (tr *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var serverName string
+	if r.TLS != nil {
+		serverName = r.TLS.ServerName
+	}
+	t, ok := tr.byName[serverName]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	t.mux.ServeHTTP(w, r)
+}
+
+// runMultiTenant loads configFile and serves every tenant it describes on
+// a single TLS listener bound to addr, routed by SNI via tenantRouter. It
+// doesn't return except on a fatal startup or listener error, the same
+// convention as main's single-tenant code path.
+//
+// Unlike the single-tenant path, multi-tenant mode always terminates TLS
+// via autocert (HTTP-01, on a shared :80 listener dispatched by Host
+// header) -- -cert/-key, -disable-tls, and -enable-quic have no multi-
+// tenant equivalent yet, since each would need its own per-tenant flag in
+// tenantConfig instead of a single process-wide one.
+func runMultiTenant(configFile, addr string) {
+	tenants, err := loadTenants(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	router, err := newTenantRouter(tenants)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		log.Printf("Starting HTTP-01 listener for %d tenant(s)", len(tenants))
+		log.Fatal(http.ListenAndServe(":80", router.acmeHTTPHandler()))
+	}()
+
+	server := http.Server{
+		Addr:      addr,
+		Handler:   router,
+		TLSConfig: &tls.Config{GetConfigForClient: router.getConfigForClient},
+	}
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
+
+// acmeHTTPHandler dispatches an HTTP-01 challenge request, arriving on the
+// shared :80 listener every tenant's autocert.Manager needs, to whichever
+// tenant's certManager.HTTPHandler matches the request's Host header.
+// ACME only ever sends HTTP-01 validation requests to the domain it's
+// trying to validate, so r.Host is exactly the SNI a tenant registered.
+func (tr *tenantRouter) acmeHTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		t, ok := tr.byName[host]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		t.certManager.HTTPHandler(nil).ServeHTTP(w, r)
+	})
+}
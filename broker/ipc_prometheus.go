@@ -0,0 +1,36 @@
+package main
+
+import (
+	dto "github.com/prometheus/client_model/go"
+)
+
+// IPC is the net/rpc receiver the broker daemon serves over its
+// -ipc-transport (see main in broker.go), through which the separate http-frontend
+// process reaches the BrokerContext it doesn't hold directly. s3.go and
+// sqs.go additionally call methods on it directly (ClientOffers) from
+// within this same process, since their handlers are constructed with
+// an *IPC the same way the unix-socket listener is.
+//
+// Only PrometheusSnapshot is defined here. ClientOffers, ProxyPolls,
+// ProxyAnswers, and Debug are called throughout this package and by
+// http-frontend/http.go's rpc.Client, but aren't implemented in this
+// tree; this type exists so PrometheusSnapshot has somewhere to live.
+type IPC struct {
+	ctx *BrokerContext
+}
+
+// PrometheusSnapshot gathers every metric family registered with the
+// broker daemon's Prometheus registry, so http-frontend's /prometheus
+// handler can serve them on its -prometheus-listen address without
+// needing direct access to ctx.metrics.promMetrics -- it only has a
+// *rpc.Client to this daemon. arg is unused; it exists to satisfy
+// net/rpc's func(argType, *replyType) error calling convention, the
+// same as the other IPC methods this package calls by name over rpc.Client.
+func (i *IPC) PrometheusSnapshot(arg interface{}, reply *[]*dto.MetricFamily) error {
+	families, err := i.ctx.metrics.promMetrics.registry.Gather()
+	if err != nil {
+		return err
+	}
+	*reply = families
+	return nil
+}
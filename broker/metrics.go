@@ -6,9 +6,15 @@ https://gitweb.torproject.org/pluggable-transports/snowflake.git/tree/doc/broker
 package main
 
 import (
+	cryptorand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"net"
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
@@ -16,6 +22,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gitlab.torproject.org/tpo/anti-censorship/geoip"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/ptutil/safeprom"
 	"tgragnato.it/snowflake/common/messages"
@@ -39,7 +46,226 @@ type Metrics struct {
 	clientAMPPolls  *sync.Map // poll-based counts of client AMP cache rendezvous
 	clientSQSPolls  *sync.Map // poll-based counts of client SQS rendezvous
 
+	// clientMatchCountries and clientDeniedCountries count, by country,
+	// every client poll UpdateClientStats records as "matched" or
+	// "denied"; clientDeniedRestrictedCountries and
+	// clientDeniedUnrestrictedCountries further split the denied side by
+	// the NAT type the client reported, so operators can tell a country
+	// seeing denials because it skews restricted-NAT from one seeing
+	// denials for some other reason. See countryReportTopN.
+	clientMatchCountries              *sync.Map
+	clientDeniedCountries             *sync.Map
+	clientDeniedRestrictedCountries   *sync.Map
+	clientDeniedUnrestrictedCountries *sync.Map
+
+	// clientBridgeMatchCounts and clientBridgeDeniedCounts count, by bridge
+	// fingerprint label (see bridgeMetricLabel), every client poll
+	// UpdateClientStats records as "matched" or "denied" -- for an
+	// operator running more than one Snowflake bridge behind this broker
+	// to see per-bridge demand. Unlike the country breakdowns above,
+	// there's no topN/others folding: an operator configures at most a
+	// handful of bridges, so printing every one seen is never unbounded.
+	clientBridgeMatchCounts  *sync.Map
+	clientBridgeDeniedCounts *sync.Map
+
+	// countryReportTopN bounds how many countries formatTopNCountries
+	// prints by name in the "client-country-*" log lines before folding
+	// the rest into a single "others" bucket; see SetCountryReportTopN.
+	countryReportTopN int
+
 	promMetrics *PromMetrics
+
+	dp dpConfig
+
+	// ipsBounded, when non-nil, replaces ips as the "seen before" dedup
+	// check with a fixed-size probabilistic set, bounding memory use
+	// instead of letting ips grow with the number of distinct proxy IPs
+	// seen in a reporting interval.
+	ipsBounded *boundedSet
+
+	// topK, when > 0, bounds the per-country counters to the topK most
+	// frequent countries (via a Space-Saving estimator) instead of
+	// tracking every country seen.
+	topK           int
+	proxiesTopK    *spaceSaving
+	clientHTTPTopK *spaceSaving
+	clientAMPTopK  *spaceSaving
+	clientSQSTopK  *spaceSaving
+
+	// flushIntervalNanos overrides metricsResolution as the period between
+	// daily report flushes, stored as nanoseconds so it can be read
+	// atomically from the logMetrics goroutine. 0 means "use
+	// metricsResolution".
+	flushIntervalNanos atomic.Int64
+}
+
+// noiseMechanism selects how per-country histogram counts are perturbed
+// before being published, trading exact counts for a differential-privacy
+// guarantee on rare-country presence.
+type noiseMechanism string
+
+const (
+	noiseMechanismNone     noiseMechanism = "none"
+	noiseMechanismLaplace  noiseMechanism = "laplace"
+	noiseMechanismGaussian noiseMechanism = "gaussian"
+
+	// gaussianDelta is the fixed delta used to size Gaussian noise from
+	// epsilon, since the broker's configuration surface only exposes
+	// epsilon. It's a conventional choice for approximate-DP mechanisms
+	// and isn't meant to be tuned per deployment.
+	gaussianDelta = 1e-5
+)
+
+const (
+	// defaultEpsilon, defaultSensitivity, and binWidth are the
+	// SetDPConfig fallbacks applied whenever the caller passes a
+	// non-positive value for epsilon/sensitivity, or leaves threshold at
+	// its zero value: a deployment that enables a mechanism without
+	// tuning every parameter still gets noised, thresholded output that's
+	// roughly as conservative as the original round-to-multiple-of-8
+	// binning (binWidth below), rather than unnoised or unsuppressed
+	// counts.
+	defaultEpsilon     = 0.3
+	defaultSensitivity = 1.0
+	// binWidth is the multiple formatAndClearCountryStats rounds counts
+	// up to, and dpConfig's default suppression threshold when the
+	// mechanism is enabled but no explicit threshold is given.
+	binWidth = 8
+
+	// defaultCountryReportTopN is SetCountryReportTopN's fallback for the
+	// "client-country-*" log lines when left unconfigured or set to a
+	// non-positive value.
+	defaultCountryReportTopN = 20
+)
+
+// dpConfig holds the differential-privacy parameters applied to the
+// per-country histograms in printMetrics. A single client poll or proxy
+// poll contributes to exactly one CC bucket, so publishing all of the
+// histograms under the same epsilon is still epsilon-DP overall by
+// parallel composition; there's no need to split the budget across them.
+//
+// sensitivity is the maximum effect one reporting interval's worth of
+// activity from a single client/proxy can have on a published count (1,
+// for the plain per-poll counters here); noise is drawn with Laplace/
+// Gaussian scale proportional to sensitivity/epsilon, so a caller
+// aggregating over a wider window before publishing can raise it to keep
+// the same privacy guarantee.
+//
+// rng is reseeded from crypto/rand at the start of every printMetrics
+// call (see reseedDP), so noise drawn in one reporting interval gives no
+// information about the seed used in another. It is left nil by
+// SetDPConfig; addNoise falls back to the math/rand global source (itself
+// auto-seeded from crypto/rand) until the first reseed. Tests that need
+// reproducible noise construct a dpConfig with rng set directly, bypassing
+// SetDPConfig and reseedDP entirely.
+type dpConfig struct {
+	mechanism   noiseMechanism
+	epsilon     float64
+	sensitivity float64
+	threshold   uint64
+	rng         *rand.Rand
+}
+
+// SetDPConfig configures the noise mechanism applied to country histograms
+// in subsequent calls to printMetrics. mechanism is one of "none",
+// "laplace", or "gaussian"; unrecognized values are treated as "none",
+// which reproduces the original round-to-multiple-of-8 binning behavior.
+// epsilon and sensitivity fall back to defaultEpsilon/defaultSensitivity,
+// and threshold to binWidth, when left at their zero value.
+func (m *Metrics) SetDPConfig(mechanism string, epsilon, sensitivity float64, threshold uint64) {
+	switch noiseMechanism(mechanism) {
+	case noiseMechanismLaplace, noiseMechanismGaussian:
+		if epsilon <= 0 {
+			epsilon = defaultEpsilon
+		}
+		if sensitivity <= 0 {
+			sensitivity = defaultSensitivity
+		}
+		if threshold == 0 {
+			threshold = binWidth
+		}
+		m.dp = dpConfig{mechanism: noiseMechanism(mechanism), epsilon: epsilon, sensitivity: sensitivity, threshold: threshold}
+	default:
+		m.dp = dpConfig{mechanism: noiseMechanismNone}
+	}
+}
+
+// reseedDP draws a fresh crypto/rand seed for m.dp.rng, so that every
+// reporting interval's noise is independent of every other interval's.
+// It is a no-op when no noise mechanism is configured.
+func (m *Metrics) reseedDP() {
+	if m.dp.mechanism == noiseMechanismNone {
+		return
+	}
+	var seed int64
+	if err := binary.Read(cryptorand.Reader, binary.BigEndian, &seed); err != nil {
+		return
+	}
+	m.dp.rng = rand.New(rand.NewSource(seed))
+}
+
+// SetTopK bounds the per-country histograms to the k most frequent
+// countries, using a Space-Saving estimator instead of an exact, unbounded
+// count per country. k <= 0 disables bounding and restores the original
+// exact-counting behavior.
+func (m *Metrics) SetTopK(k int) {
+	m.topK = k
+	if k <= 0 {
+		m.proxiesTopK, m.clientHTTPTopK, m.clientAMPTopK, m.clientSQSTopK = nil, nil, nil, nil
+		return
+	}
+	m.proxiesTopK = newSpaceSaving(k)
+	m.clientHTTPTopK = newSpaceSaving(k)
+	m.clientAMPTopK = newSpaceSaving(k)
+	m.clientSQSTopK = newSpaceSaving(k)
+}
+
+// SetCountryReportTopN bounds how many countries by name appear in the
+// "client-country-match" and "client-country-denied" log lines (and their
+// NAT-type-specific denied counterparts); the rest are folded into a
+// single "others" bucket. n <= 0 falls back to defaultCountryReportTopN.
+// Unlike SetTopK, this only bounds what's printed -- the underlying
+// per-country maps are still counted exactly.
+func (m *Metrics) SetCountryReportTopN(n int) {
+	if n <= 0 {
+		n = defaultCountryReportTopN
+	}
+	m.countryReportTopN = n
+}
+
+// SetIPDedupCapacity switches the "have we seen this proxy IP before" check
+// from an unbounded sync.Map to a fixed-size probabilistic set sized for
+// capacity entries at falsePositiveRate. capacity <= 0 disables bounding
+// and restores the original unbounded behavior.
+func (m *Metrics) SetIPDedupCapacity(capacity int, falsePositiveRate float64) {
+	if capacity <= 0 {
+		m.ipsBounded = nil
+		return
+	}
+	m.ipsBounded = newBoundedSet(capacity, falsePositiveRate)
+}
+
+// SetExemplarsEnabled turns on the OpenMetrics exemplar mirrors for
+// ClientPollTotal and MatchesTotal (see PromMetrics.enableExemplars).
+// Disabled by default, since every exemplar keeps a sample hour bucket and
+// cohort ID around until the next scrape.
+func (m *Metrics) SetExemplarsEnabled(enabled bool) {
+	if enabled {
+		m.promMetrics.enableExemplars()
+	}
+}
+
+// SetFlushWindow overrides how often printMetrics is called by logMetrics.
+// d <= 0 restores the default metricsResolution (24h).
+func (m *Metrics) SetFlushWindow(d time.Duration) {
+	m.flushIntervalNanos.Store(int64(d))
+}
+
+func (m *Metrics) flushInterval() time.Duration {
+	if d := m.flushIntervalNanos.Load(); d > 0 {
+		return time.Duration(d)
+	}
+	return metricsResolution
 }
 
 func NewMetrics(metricsLogger *log.Logger) (*Metrics, error) {
@@ -53,6 +279,13 @@ func NewMetrics(metricsLogger *log.Logger) (*Metrics, error) {
 	m.clientHTTPPolls = new(sync.Map)
 	m.clientAMPPolls = new(sync.Map)
 	m.clientSQSPolls = new(sync.Map)
+	m.clientMatchCountries = new(sync.Map)
+	m.clientDeniedCountries = new(sync.Map)
+	m.clientDeniedRestrictedCountries = new(sync.Map)
+	m.clientDeniedUnrestrictedCountries = new(sync.Map)
+	m.countryReportTopN = defaultCountryReportTopN
+	m.clientBridgeMatchCounts = new(sync.Map)
+	m.clientBridgeDeniedCounts = new(sync.Map)
 
 	// Write to log file every day with updated metrics
 	go m.logMetrics()
@@ -86,9 +319,9 @@ func (m *Metrics) UpdateProxyStats(addr string, proxyType string, natType string
 	}
 
 	// check whether we've seen this proxy ip before
-	if _, loaded := m.ips.LoadOrStore(addr, true); !loaded {
+	if !m.seen(addr) {
 		m.IncrementCounter("proxy-total")
-		incrementMapCounter(m.proxies, country)
+		m.incrementCountryCounter(m.proxies, m.proxiesTopK, country)
 		m.promMetrics.ProxyTotal.With(prometheus.Labels{
 			"nat":  natType,
 			"type": proxyType,
@@ -97,8 +330,7 @@ func (m *Metrics) UpdateProxyStats(addr string, proxyType string, natType string
 	}
 
 	// update unique IP proxy NAT metrics
-	key := fmt.Sprintf("%s-%s", addr, natType)
-	if _, loaded := m.ips.LoadOrStore(key, true); !loaded {
+	if !m.seen(fmt.Sprintf("%s-%s", addr, natType)) {
 		switch natType {
 		case NATRestricted:
 			m.IncrementCounter("proxy-nat-restricted")
@@ -109,8 +341,7 @@ func (m *Metrics) UpdateProxyStats(addr string, proxyType string, natType string
 		}
 	}
 	// update unique IP proxy type metrics
-	key = fmt.Sprintf("%s-%s", addr, proxyType)
-	if _, loaded := m.ips.LoadOrStore(key, true); !loaded {
+	if !m.seen(fmt.Sprintf("%s-%s", addr, proxyType)) {
 		switch proxyType {
 		case "standalone":
 			m.IncrementCounter("proxy-standalone")
@@ -124,7 +355,118 @@ func (m *Metrics) UpdateProxyStats(addr string, proxyType string, natType string
 	}
 }
 
-func (m *Metrics) UpdateClientStats(addr string, rendezvousMethod messages.RendezvousMethod, natType, status string) {
+// seen reports whether key has already been recorded in this reporting
+// interval, recording it as seen as a side effect, via whichever dedup
+// structure is configured (see SetIPDedupCapacity).
+func (m *Metrics) seen(key string) bool {
+	if m.ipsBounded != nil {
+		return m.ipsBounded.Add(key)
+	}
+	_, loaded := m.ips.LoadOrStore(key, true)
+	return loaded
+}
+
+// incrementCountryCounter records one occurrence of country in whichever
+// per-country counter is configured: the bounded topK estimator if set,
+// else the exact, unbounded sync.Map.
+func (m *Metrics) incrementCountryCounter(exact *sync.Map, topK *spaceSaving, country string) {
+	if topK != nil {
+		topK.Increment(country)
+		return
+	}
+	incrementMapCounter(exact, country)
+}
+
+// knownProxyTypes lists the proxy types UpdateProxyStats breaks out
+// individually, and so the ones RecordMatch reports daily per-transport
+// counts for.
+var knownProxyTypes = []string{"standalone", "badge", "iptproxy", "webext"}
+
+// knownRendezvousMethods lists the rendezvous methods UpdateClientStats
+// breaks out individually.
+var knownRendezvousMethods = []messages.RendezvousMethod{
+	messages.RendezvousHttp, messages.RendezvousAmpCache, messages.RendezvousSqs,
+}
+
+// RecordMatch records that a client was matched with a proxy, cross-
+// tabulating the proxy type that served it against the rendezvous method it
+// arrived through. proxyCC is accepted for future per-proxy-country
+// breakdowns but, to avoid adding another high-cardinality daily bucket, is
+// not yet included in either the daily log lines or the Prometheus labels.
+func (m *Metrics) RecordMatch(clientCC, proxyCC, proxyType, natType string, rendezvousMethod messages.RendezvousMethod) {
+	m.IncrementCounter(fmt.Sprintf("match-%s-%s", proxyType, rendezvousMethod))
+	m.promMetrics.MatchesTotal.With(prometheus.Labels{
+		"proxy_type":        proxyType,
+		"client_cc":         clientCC,
+		"rendezvous_method": string(rendezvousMethod),
+		"nat":               natType,
+	}).Inc()
+	if m.promMetrics.MatchesExemplars != nil {
+		m.promMetrics.MatchesExemplars.Inc(prometheus.Labels{
+			"proxy_type":        proxyType,
+			"rendezvous_method": string(rendezvousMethod),
+			"nat":               natType,
+		}, clientCC, natType, string(rendezvousMethod))
+	}
+}
+
+// RecordRendezvousWait reports how long the broker waited for a proxy to
+// answer a client's offer over rendezvousMethod. outcome is typically
+// "matched", "timeout", or "error".
+func (m *Metrics) RecordRendezvousWait(rendezvousMethod messages.RendezvousMethod, outcome string, wait time.Duration) {
+	m.promMetrics.RendezvousWaitSeconds.With(prometheus.Labels{
+		"rendezvous_method": string(rendezvousMethod),
+		"outcome":           outcome,
+	}).Observe(wait.Seconds())
+}
+
+// RecordProxyLoad counts a proxy poll that reported a nonzero client load,
+// broken down by NAT type, into the binned "snowflake-proxy-load-*-count"
+// log lines -- the text-log counterpart to the clients value AddSnowflake
+// now threads onto each Snowflake for load-aware selection.
+func (m *Metrics) RecordProxyLoad(natType string, clients int) {
+	if clients <= 0 {
+		return
+	}
+	switch natType {
+	case NATRestricted:
+		m.IncrementCounter("proxy-load-restricted")
+	case NATUnrestricted:
+		m.IncrementCounter("proxy-load-unrestricted")
+	default:
+		m.IncrementCounter("proxy-load-unknown")
+	}
+}
+
+// RecordSQSDeadLetter reports that an SQS client poll message was given up
+// on after exhausting its visibility-timeout backoff and moved to the
+// dead-letter queue, labeled by reason (e.g. "create_queue_failed",
+// "send_message_failed", "bad_offer_json", "no_snowflake_available").
+func (m *Metrics) RecordSQSDeadLetter(reason string) {
+	m.promMetrics.SQSDeadLetterTotal.With(prometheus.Labels{"reason": reason}).Inc()
+}
+
+// bridgeMetricLabel maps a client's requested bridge fingerprint to the
+// label used in its "client-bridge-<label>-*" metric line: "" (a client
+// that didn't request one, matched against the default bridge) isn't a
+// usable log-line component on its own, so it's reported as "default".
+func bridgeMetricLabel(bridgeFingerprint string) string {
+	if bridgeFingerprint == "" {
+		return "default"
+	}
+	return bridgeFingerprint
+}
+
+// UpdateClientStats records one client poll outcome, geolocating addr (the
+// client's apparent IP -- the caller resolves this from the request's
+// RemoteAddr or, behind a trusted front, its Forwarded-For header before
+// calling in; UpdateClientStats itself doesn't parse headers) into a
+// country for the per-country breakdowns printMetrics reports under
+// "client-country-match" and "client-country-denied". bridgeFingerprint is
+// the bridge the client's poll requested ("" for the default bridge; see
+// Snowflake.acceptsBridge), similarly broken out under
+// "client-bridge-<label>-match-count"/"-denied-count".
+func (m *Metrics) UpdateClientStats(addr string, rendezvousMethod messages.RendezvousMethod, natType, status string, bridgeFingerprint string) {
 	ip := net.ParseIP(addr)
 	country := "??"
 	if m.geoipdb != nil {
@@ -133,17 +475,24 @@ func (m *Metrics) UpdateClientStats(addr string, rendezvousMethod messages.Rende
 			country = country_by_addr
 		}
 	}
+	bridgeLabel := bridgeMetricLabel(bridgeFingerprint)
 
 	switch status {
 	case "denied":
 		m.IncrementCounter("client-denied")
+		incrementMapCounter(m.clientDeniedCountries, country)
+		incrementMapCounter(m.clientBridgeDeniedCounts, bridgeLabel)
 		if natType == NATUnrestricted {
 			m.IncrementCounter("client-unrestricted-denied")
+			incrementMapCounter(m.clientDeniedUnrestrictedCountries, country)
 		} else {
 			m.IncrementCounter("client-restricted-denied")
+			incrementMapCounter(m.clientDeniedRestrictedCountries, country)
 		}
 	case "matched":
 		m.IncrementCounter("client-match")
+		incrementMapCounter(m.clientMatchCountries, country)
+		incrementMapCounter(m.clientBridgeMatchCounts, bridgeLabel)
 	case "timeout":
 		m.IncrementCounter("client-timeout")
 	default:
@@ -153,13 +502,13 @@ func (m *Metrics) UpdateClientStats(addr string, rendezvousMethod messages.Rende
 	switch rendezvousMethod {
 	case messages.RendezvousHttp:
 		m.IncrementCounter("client-http")
-		incrementMapCounter(m.clientHTTPPolls, country)
+		m.incrementCountryCounter(m.clientHTTPPolls, m.clientHTTPTopK, country)
 	case messages.RendezvousAmpCache:
 		m.IncrementCounter("client-amp")
-		incrementMapCounter(m.clientAMPPolls, country)
+		m.incrementCountryCounter(m.clientAMPPolls, m.clientAMPTopK, country)
 	case messages.RendezvousSqs:
 		m.IncrementCounter("client-sqs")
-		incrementMapCounter(m.clientSQSPolls, country)
+		m.incrementCountryCounter(m.clientSQSPolls, m.clientSQSTopK, country)
 	}
 	m.promMetrics.ClientPollTotal.With(prometheus.Labels{
 		"nat":               natType,
@@ -167,6 +516,13 @@ func (m *Metrics) UpdateClientStats(addr string, rendezvousMethod messages.Rende
 		"rendezvous_method": string(rendezvousMethod),
 		"cc":                country,
 	}).Inc()
+	if m.promMetrics.ClientPollExemplars != nil {
+		m.promMetrics.ClientPollExemplars.Inc(prometheus.Labels{
+			"nat":               natType,
+			"status":            status,
+			"rendezvous_method": string(rendezvousMethod),
+		}, country, natType, string(rendezvousMethod))
+	}
 }
 
 // Types to facilitate sorting in formatAndClearCountryStats.
@@ -184,6 +540,51 @@ func (r records) Less(i, j int) bool {
 	return r[i].count > r[j].count || (r[i].count == r[j].count && r[i].cc < r[j].cc)
 }
 
+// formatTopNCountries is formatAndClearCountryStats' counterpart for the
+// "client-country-*" lines: it keeps only the topN highest-count entries
+// (same count-desc/cc-asc ordering as records.Less) and folds everything
+// else into a trailing "others=" bucket, rather than printing every
+// country UpdateClientStats has ever geolocated a client to.
+//
+// formatTopNCountries has the side effect of deleting all entries in m.
+func formatTopNCountries(m *sync.Map, topN int, binned bool) string {
+	rs := records{}
+	m.Range(func(cc, countPtr any) bool {
+		count := *countPtr.(*uint64)
+		rs = append(rs, record{cc: cc.(string), count: count})
+		m.Delete(cc)
+		return true
+	})
+	sort.Sort(rs)
+
+	var output strings.Builder
+	var others uint64
+	for i, r := range rs {
+		count := r.count
+		if i >= topN {
+			others += count
+			continue
+		}
+		if binned {
+			count = binCount(count)
+		}
+		if i != 0 {
+			output.WriteString(",")
+		}
+		fmt.Fprintf(&output, "%s=%d", r.cc, count)
+	}
+	if others > 0 {
+		if output.Len() > 0 {
+			output.WriteString(",")
+		}
+		if binned {
+			others = binCount(others)
+		}
+		fmt.Fprintf(&output, "others=%d", others)
+	}
+	return output.String()
+}
+
 // formatAndClearCountryStats takes a map from country codes to counts, and
 // returns a formatted string of comma-separated CC=COUNT. Entries are sorted by
 // count from largest to smallest. When counts are equal, entries are sorted by
@@ -216,15 +617,33 @@ func formatAndClearCountryStats(m *sync.Map, binned bool) string {
 	return output.String()
 }
 
+// printBridgeStats prints one "client-bridge-<label>-<kind>-count N" line
+// per bridge fingerprint label counts has seen since the last flush (kind
+// is "match" or "denied"), sorted by label for deterministic output, and
+// clears counts as a side effect, like formatAndClearCountryStats.
+func printBridgeStats(logger *log.Logger, counts *sync.Map, kind string) {
+	rs := records{}
+	counts.Range(func(label, countPtr any) bool {
+		rs = append(rs, record{cc: label.(string), count: binCount(*countPtr.(*uint64))})
+		counts.Delete(label)
+		return true
+	})
+	sort.Slice(rs, func(i, j int) bool { return rs[i].cc < rs[j].cc })
+	for _, r := range rs {
+		logger.Printf("client-bridge-%s-%s-count %d\n", r.cc, kind, r.count)
+	}
+}
+
 func (m *Metrics) LoadGeoipDatabases(geoipDB string, geoip6DB string) (err error) {
 	m.geoipdb, err = geoip.New(geoipDB, geoip6DB)
 	return err
 }
 
-// Logs metrics in intervals specified by metricsResolution
+// Logs metrics in intervals specified by metricsResolution, or by
+// SetFlushWindow if configured.
 func (m *Metrics) logMetrics() {
-	heartbeat := time.Tick(metricsResolution)
-	for range heartbeat {
+	for {
+		time.Sleep(m.flushInterval())
 		m.printMetrics()
 	}
 }
@@ -239,12 +658,16 @@ func (m *Metrics) loadAndZero(key string) uint64 {
 }
 
 func (m *Metrics) printMetrics() {
+	m.reseedDP()
 	m.logger.Println(
 		"snowflake-stats-end",
 		time.Now().UTC().Format("2006-01-02 15:04:05"),
-		fmt.Sprintf("(%d s)", int(metricsResolution.Seconds())),
+		fmt.Sprintf("(%d s)", int(m.flushInterval().Seconds())),
 	)
-	m.logger.Println("snowflake-ips", formatAndClearCountryStats(m.proxies, false))
+	if m.dp.mechanism != noiseMechanismNone {
+		m.logger.Printf("snowflake-stats-dp-mechanism %s epsilon=%g sensitivity=%g threshold=%d\n", m.dp.mechanism, m.dp.epsilon, m.dp.sensitivity, m.dp.threshold)
+	}
+	m.logger.Println("snowflake-ips", m.formatCountryCounter(m.proxies, m.proxiesTopK, false))
 	m.logger.Printf("snowflake-ips-iptproxy %d\n", m.loadAndZero("proxy-iptproxy"))
 	m.logger.Printf("snowflake-ips-standalone %d\n", m.loadAndZero("proxy-standalone"))
 	m.logger.Printf("snowflake-ips-webext %d\n", m.loadAndZero("proxy-webext"))
@@ -254,25 +677,53 @@ func (m *Metrics) printMetrics() {
 	m.logger.Println("snowflake-proxy-poll-with-relay-url-count", binCount(m.loadAndZero("proxy-poll-with-relay-url")))
 	m.logger.Println("snowflake-proxy-poll-without-relay-url-count", binCount(m.loadAndZero("proxy-poll-without-relay-url")))
 	m.logger.Println("snowflake-proxy-rejected-for-relay-url-count", binCount(m.loadAndZero("proxy-poll-rejected-relay-url")))
+	m.logger.Println("snowflake-proxy-load-restricted-count", binCount(m.loadAndZero("proxy-load-restricted")))
+	m.logger.Println("snowflake-proxy-load-unrestricted-count", binCount(m.loadAndZero("proxy-load-unrestricted")))
+	m.logger.Println("snowflake-proxy-load-unknown-count", binCount(m.loadAndZero("proxy-load-unknown")))
 
 	m.logger.Println("client-denied-count", binCount(m.loadAndZero("client-denied")))
 	m.logger.Println("client-restricted-denied-count", binCount(m.loadAndZero("client-restricted-denied")))
 	m.logger.Println("client-unrestricted-denied-count", binCount(m.loadAndZero("client-unrestricted-denied")))
+	m.logger.Println("client-country-match", formatTopNCountries(m.clientMatchCountries, m.countryReportTopN, true))
+	m.logger.Println("client-country-denied", formatTopNCountries(m.clientDeniedCountries, m.countryReportTopN, true))
+	m.logger.Println("client-country-denied-restricted", formatTopNCountries(m.clientDeniedRestrictedCountries, m.countryReportTopN, true))
+	m.logger.Println("client-country-denied-unrestricted", formatTopNCountries(m.clientDeniedUnrestrictedCountries, m.countryReportTopN, true))
 	m.logger.Println("client-snowflake-match-count", binCount(m.loadAndZero("client-match")))
 	m.logger.Println("client-snowflake-timeout-count", binCount(m.loadAndZero("client-timeout")))
+	printBridgeStats(m.logger, m.clientBridgeMatchCounts, "match")
+	printBridgeStats(m.logger, m.clientBridgeDeniedCounts, "denied")
 
 	m.logger.Printf("client-http-count %d\n", binCount(m.loadAndZero("client-http")))
-	m.logger.Printf("client-http-ips %s\n", formatAndClearCountryStats(m.clientHTTPPolls, true))
+	m.logger.Printf("client-http-ips %s\n", m.formatCountryCounter(m.clientHTTPPolls, m.clientHTTPTopK, true))
 	m.logger.Printf("client-ampcache-count %d\n", binCount(m.loadAndZero("client-amp")))
-	m.logger.Printf("client-ampcache-ips %s\n", formatAndClearCountryStats(m.clientAMPPolls, true))
+	m.logger.Printf("client-ampcache-ips %s\n", m.formatCountryCounter(m.clientAMPPolls, m.clientAMPTopK, true))
 	m.logger.Printf("client-sqs-count %d\n", binCount(m.loadAndZero("client-sqs")))
-	m.logger.Printf("client-sqs-ips %s\n", formatAndClearCountryStats(m.clientSQSPolls, true))
+	m.logger.Printf("client-sqs-ips %s\n", m.formatCountryCounter(m.clientSQSPolls, m.clientSQSTopK, true))
 
 	m.logger.Println("snowflake-ips-nat-restricted", m.loadAndZero("proxy-nat-restricted"))
 	m.logger.Println("snowflake-ips-nat-unrestricted", m.loadAndZero("proxy-nat-unrestricted"))
 	m.logger.Println("snowflake-ips-nat-unknown", m.loadAndZero("proxy-nat-unknown"))
 
-	m.ips.Clear()
+	m.logger.Println("snowflake-symmetric-nat-verdict-pass-count", binCount(m.loadAndZero("verdict-pass")))
+	m.logger.Println("snowflake-symmetric-nat-verdict-fail-count", binCount(m.loadAndZero("verdict-fail")))
+	m.logger.Println("snowflake-symmetric-nat-verdict-untrusted-count", binCount(m.loadAndZero("verdict-untrusted")))
+
+	m.logger.Println("client-offer-rejected-private-ip-count", binCount(m.loadAndZero("client-offer-rejected-private-ip")))
+	m.logger.Println("client-offer-rejected-blocklist-count", binCount(m.loadAndZero("client-offer-rejected-blocklist")))
+	m.logger.Println("client-offer-rejected-malformed-count", binCount(m.loadAndZero("client-offer-rejected-malformed")))
+
+	for _, proxyType := range knownProxyTypes {
+		for _, rendezvousMethod := range knownRendezvousMethods {
+			key := fmt.Sprintf("match-%s-%s", proxyType, rendezvousMethod)
+			m.logger.Printf("snowflake-matches-%s-%s %d\n", proxyType, rendezvousMethod, binCount(m.loadAndZero(key)))
+		}
+	}
+
+	if m.ipsBounded != nil {
+		m.ipsBounded.Clear()
+	} else {
+		m.ips.Clear()
+	}
 }
 
 // binCount rounds count up to the next multiple of 8. Returns 0 on integer
@@ -281,6 +732,159 @@ func binCount(count uint64) uint64 {
 	return (count + 7) / 8 * 8
 }
 
+// formatCountryCounter reports and clears whichever per-country counter is
+// configured for this histogram. When topK is nil, it defers to
+// formatCountryStats (the exact, DP-aware path) for backward compatibility.
+// When topK is set, it reports the tracked top-K countries plus an
+// "others=N" bucket summing everything that didn't make the cut, since the
+// Space-Saving estimator no longer has exact per-country counts for the
+// tail.
+func (m *Metrics) formatCountryCounter(exact *sync.Map, topK *spaceSaving, binned bool) string {
+	if topK == nil {
+		return m.formatCountryStats(exact, binned)
+	}
+
+	rs := topK.ReportAndClear()
+	var output strings.Builder
+	var others uint64
+	for i, r := range rs {
+		count := r.count
+		if binned {
+			count = binCount(count)
+		}
+		if i != 0 {
+			output.WriteString(",")
+		}
+		fmt.Fprintf(&output, "%s=%d", r.key, count)
+		others += r.overEstim
+	}
+	if others > 0 {
+		if output.Len() > 0 {
+			output.WriteString(",")
+		}
+		if binned {
+			others = binCount(others)
+		}
+		fmt.Fprintf(&output, "others=%d", others)
+	}
+	return output.String()
+}
+
+// formatCountryStats is the DP-aware counterpart to
+// formatAndClearCountryStats: when m.dp.mechanism is "none" it defers to the
+// original binning behavior for backward compatibility; otherwise it noises
+// each count and suppresses any country whose noised count falls below
+// m.dp.threshold.
+func (m *Metrics) formatCountryStats(counts *sync.Map, binned bool) string {
+	if m.dp.mechanism == noiseMechanismNone {
+		return formatAndClearCountryStats(counts, binned)
+	}
+
+	rs := records{}
+	counts.Range(func(cc, countPtr any) bool {
+		count := *countPtr.(*uint64)
+		noised := m.dp.addNoise(count)
+		counts.Delete(cc)
+		if noised < m.dp.threshold {
+			return true
+		}
+		rs = append(rs, record{cc: cc.(string), count: noised})
+		return true
+	})
+	sort.Sort(rs)
+	var output strings.Builder
+	for i, r := range rs {
+		if i != 0 {
+			output.WriteString(",")
+		}
+		fmt.Fprintf(&output, "%s=%d", r.cc, r.count)
+	}
+	return output.String()
+}
+
+// addNoise perturbs count under c's configured mechanism, scaling the noise
+// by c.sensitivity/c.epsilon, and clamps the result to be non-negative,
+// since a published histogram count can't be negative. It draws from c.rng
+// when set, falling back to the math/rand global source otherwise (see
+// dpConfig.rng).
+func (c dpConfig) addNoise(count uint64) uint64 {
+	rng := c.rng
+	var noise float64
+	switch c.mechanism {
+	case noiseMechanismLaplace:
+		noise = sampleDiscreteLaplace(rng, c.epsilon/c.sensitivity)
+	case noiseMechanismGaussian:
+		noise = sampleGaussian(rng, gaussianSigma(c.epsilon, c.sensitivity, gaussianDelta))
+	default:
+		return count
+	}
+	result := float64(count) + noise
+	if result < 0 {
+		return 0
+	}
+	return uint64(math.Round(result))
+}
+
+// sampleDiscreteLaplace draws from a symmetric two-sided geometric
+// distribution with scale 1/epsilon: the difference of two i.i.d.
+// geometric(1-e^-epsilon) variates, which is the standard discrete
+// analogue of Laplace noise for epsilon-differential privacy on integer
+// counts (Inusah & Kozubowski, 2006; Ghosh et al.'s geometric mechanism).
+// Callers wanting Laplace(lambda = sensitivity/trueEpsilon) noise pass
+// epsilon = trueEpsilon/sensitivity.
+func sampleDiscreteLaplace(rng *rand.Rand, epsilon float64) float64 {
+	if epsilon <= 0 {
+		return 0
+	}
+	p := 1 - math.Exp(-epsilon)
+	return sampleGeometric(rng, p) - sampleGeometric(rng, p)
+}
+
+func sampleGeometric(rng *rand.Rand, p float64) float64 {
+	if p <= 0 || p >= 1 {
+		return 0
+	}
+	var u float64
+	if rng != nil {
+		u = rng.Float64()
+	} else {
+		u = rand.Float64()
+	}
+	return math.Floor(math.Log(1-u) / math.Log(1-p))
+}
+
+// gaussianSigma returns the standard deviation needed for additive Gaussian
+// noise to satisfy (epsilon, delta)-differential privacy on a counting
+// query with the given sensitivity, using the standard analytic Gaussian
+// mechanism bound.
+func gaussianSigma(epsilon, sensitivity, delta float64) float64 {
+	if epsilon <= 0 {
+		return 0
+	}
+	return sensitivity * math.Sqrt(2*math.Log(1.25/delta)) / epsilon
+}
+
+func sampleGaussian(rng *rand.Rand, sigma float64) float64 {
+	if sigma <= 0 {
+		return 0
+	}
+	if rng != nil {
+		return rng.NormFloat64() * sigma
+	}
+	return rand.NormFloat64() * sigma
+}
+
+// PromMetrics holds every Prometheus collector the broker daemon
+// registers against its own registry, which ServeMetrics and
+// IPC.PrometheusSnapshot are the two ways of reading back out: ServeMetrics
+// serves it directly if -prometheus-addr is set, and
+// IPC.PrometheusSnapshot lets http-frontend's /prometheus handler gather
+// it across the rpc.Client boundary without holding a *Metrics of its own.
+//
+// AvailableProxies in particular is a gauge rather than a counter: it's
+// Inc'd in AddSnowflake when a proxy joins the heap and Dec'd in Broker's
+// ProxyTimeout branch when it leaves without being matched, so it tracks
+// the pool depth an operator would want to alert on, not a running total.
 type PromMetrics struct {
 	registry         *prometheus.Registry
 	ProxyTotal       *prometheus.CounterVec
@@ -293,6 +897,58 @@ type PromMetrics struct {
 	ProxyPollWithoutRelayURLExtensionTotal *safeprom.CounterVec
 
 	ProxyPollRejectedForRelayURLExtensionTotal *safeprom.CounterVec
+
+	MatchesTotal *safeprom.CounterVec
+
+	// RendezvousWaitSeconds records how long the broker waited for a proxy
+	// answer, broken down by rendezvous method and outcome, so operators
+	// can calibrate RendezvousTimeouts from observed tail latencies instead
+	// of guessing.
+	RendezvousWaitSeconds *prometheus.HistogramVec
+
+	// SQSDeadLetterTotal counts SQS client poll messages that exhausted
+	// their visibility-timeout backoff and landed in the dead-letter
+	// queue, broken down by the reason handleMessage gave up on them.
+	SQSDeadLetterTotal *prometheus.CounterVec
+
+	// ClientOfferRejectedTotal mirrors the "client-offer-rejected-*"
+	// text-log counters ValidateClientOfferSDP increments, broken down
+	// by the same reason: "malformed", "private-ip", or "blocklist".
+	ClientOfferRejectedTotal *prometheus.CounterVec
+
+	// ClientPollExemplars and MatchesExemplars, when non-nil, mirror
+	// ClientPollTotal and MatchesTotal with OpenMetrics exemplars
+	// attached, letting Grafana/Tempo correlate a load spike with a
+	// sample of the cohorts behind it. See enableExemplars.
+	ClientPollExemplars *exemplarCounterVec
+	MatchesExemplars    *exemplarCounterVec
+}
+
+// enableExemplars creates and registers the exemplar-carrying mirror
+// counters. It is a no-op if called more than once, since
+// prometheus.Registry.MustRegister panics on a duplicate registration.
+func (pm *PromMetrics) enableExemplars() {
+	if pm.ClientPollExemplars != nil {
+		return
+	}
+
+	pm.ClientPollExemplars = newExemplarCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "client_poll_exemplars_total",
+			Help:      "Sampled, k-anonymized client poll events, for correlating rounded_client_poll_total with example cohorts via OpenMetrics exemplars",
+		},
+		[]string{"nat", "status", "rendezvous_method"},
+	)
+	pm.MatchesExemplars = newExemplarCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "matches_exemplars_total",
+			Help:      "Sampled, k-anonymized match events, for correlating matches_total with example cohorts via OpenMetrics exemplars",
+		},
+		[]string{"proxy_type", "rendezvous_method", "nat"},
+	)
+	pm.registry.MustRegister(pm.ClientPollExemplars.vec, pm.MatchesExemplars.vec)
 }
 
 // Initialize metrics for prometheus exporter
@@ -373,6 +1029,43 @@ func initPrometheus() *PromMetrics {
 		[]string{"nat", "status", "cc", "rendezvous_method"},
 	)
 
+	promMetrics.MatchesTotal = safeprom.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "matches_total",
+			Help:      "The number of clients matched with a proxy, broken down by the proxy type that served them and the rendezvous method they used",
+		},
+		[]string{"proxy_type", "client_cc", "rendezvous_method", "nat"},
+	)
+
+	promMetrics.RendezvousWaitSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "rendezvous_wait_seconds",
+			Help:      "How long the broker waited for a proxy answer, by rendezvous method and outcome",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 11), // 50ms .. ~51.2s
+		},
+		[]string{"rendezvous_method", "outcome"},
+	)
+
+	promMetrics.SQSDeadLetterTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "sqs_dead_letter_total",
+			Help:      "The number of SQS client poll messages that were moved to the dead-letter queue, by failure reason",
+		},
+		[]string{"reason"},
+	)
+
+	promMetrics.ClientOfferRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "client_offer_rejected_total",
+			Help:      "The number of client offers ValidateClientOfferSDP rejected, by reason",
+		},
+		[]string{"reason"},
+	)
+
 	// We need to register our metrics so they can be exported.
 	promMetrics.registry.MustRegister(
 		promMetrics.ClientPollTotal, promMetrics.ProxyPollTotal,
@@ -380,7 +1073,60 @@ func initPrometheus() *PromMetrics {
 		promMetrics.ProxyPollWithRelayURLExtensionTotal,
 		promMetrics.ProxyPollWithoutRelayURLExtensionTotal,
 		promMetrics.ProxyPollRejectedForRelayURLExtensionTotal,
+		promMetrics.MatchesTotal,
+		promMetrics.RendezvousWaitSeconds,
+		promMetrics.SQSDeadLetterTotal,
+		promMetrics.ClientOfferRejectedTotal,
 	)
 
 	return promMetrics
 }
+
+// ServeMetrics starts an HTTP server on addr exposing the "/metrics"
+// endpoint for pull-based Prometheus scraping. If certFile and keyFile are
+// both non-empty, the server is started over TLS. If bearerToken is
+// non-empty, requests must present it as "Authorization: Bearer
+// <bearerToken>" or they are rejected with 401, so operators can scrape
+// the broker's internal counters without exposing them to anyone who can
+// reach the port.
+func (pm *PromMetrics) ServeMetrics(addr, certFile, keyFile, bearerToken string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", authenticated(bearerToken, promhttp.HandlerFor(pm.registry, promhttp.HandlerOpts{})))
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var err error
+		if certFile != "" && keyFile != "" {
+			err = server.ServeTLS(listener, certFile, keyFile)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics server on %s failed: %v", addr, err)
+		}
+	}()
+
+	return nil
+}
+
+// authenticated wraps next so that, when token is non-empty, requests must
+// carry it as a bearer token.
+func authenticated(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := "Bearer " + token
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	. "github.com/smartystreets/goconvey/convey"
+	"tgragnato.it/snowflake/common/messages"
 )
 
 func TestFormatAndClearCountryStats(t *testing.T) {
@@ -45,3 +55,329 @@ func TestFormatAndClearCountryStats(t *testing.T) {
 		stats.Range(func(_, _ any) bool { panic("map was not cleared") })
 	})
 }
+
+func TestFormatCountryStatsDP(t *testing.T) {
+	Convey("given a Metrics with DP noise configured", t, func() {
+		m := &Metrics{}
+
+		Convey("mechanism \"none\" reproduces the original binning behavior", func() {
+			m.SetDPConfig("none", 0, 0, 0)
+			stats := new(sync.Map)
+			count := uint64(10)
+			stats.Store("CA", &count)
+
+			So(m.formatCountryStats(stats, true), ShouldEqual, "CA=16")
+		})
+
+		Convey("an unrecognized mechanism falls back to \"none\"", func() {
+			m.SetDPConfig("bogus", 1, 1, 0)
+			So(m.dp.mechanism, ShouldEqual, noiseMechanismNone)
+		})
+
+		Convey("epsilon, sensitivity, and threshold default when left at zero", func() {
+			m.SetDPConfig("laplace", 0, 0, 0)
+			So(m.dp.epsilon, ShouldEqual, defaultEpsilon)
+			So(m.dp.sensitivity, ShouldEqual, defaultSensitivity)
+			So(m.dp.threshold, ShouldEqual, uint64(binWidth))
+		})
+
+		Convey("a country below the threshold is suppressed", func() {
+			m.SetDPConfig("laplace", 10, 1, 1000)
+			stats := new(sync.Map)
+			count := uint64(1)
+			stats.Store("CA", &count)
+
+			So(m.formatCountryStats(stats, false), ShouldEqual, "")
+		})
+
+		Convey("laplace and gaussian noise never produce a negative count", func() {
+			for _, mech := range []string{"laplace", "gaussian"} {
+				m.SetDPConfig(mech, 5, 1, 0)
+				for i := 0; i < 1000; i++ {
+					noised := m.dp.addNoise(0)
+					So(noised, ShouldBeGreaterThanOrEqualTo, uint64(0))
+				}
+			}
+		})
+
+		Convey("a fixed rng seed makes formatCountryStats deterministic", func() {
+			m.dp = dpConfig{mechanism: noiseMechanismLaplace, epsilon: 2, sensitivity: 1, threshold: 0, rng: rand.New(rand.NewSource(42))}
+			stats := new(sync.Map)
+			for _, record := range []struct {
+				cc    string
+				count uint64
+			}{
+				{"FR", 200},
+				{"CN", 250},
+				{"CA", 1},
+			} {
+				stats.Store(record.cc, &record.count)
+			}
+			got := m.formatCountryStats(stats, false)
+
+			m.dp = dpConfig{mechanism: noiseMechanismLaplace, epsilon: 2, sensitivity: 1, threshold: 0, rng: rand.New(rand.NewSource(42))}
+			stats = new(sync.Map)
+			for _, record := range []struct {
+				cc    string
+				count uint64
+			}{
+				{"FR", 200},
+				{"CN", 250},
+				{"CA", 1},
+			} {
+				stats.Store(record.cc, &record.count)
+			}
+			So(m.formatCountryStats(stats, false), ShouldEqual, got)
+		})
+
+		Convey("with a fixed rng seed, countries below threshold are omitted and the rest stay ordered", func() {
+			m.dp = dpConfig{mechanism: noiseMechanismLaplace, epsilon: 2, sensitivity: 1, threshold: 50, rng: rand.New(rand.NewSource(7))}
+			stats := new(sync.Map)
+			for _, record := range []struct {
+				cc    string
+				count uint64
+			}{
+				{"FR", 200},
+				{"CN", 250},
+				{"CA", 1},
+			} {
+				stats.Store(record.cc, &record.count)
+			}
+			got := m.formatCountryStats(stats, false)
+
+			So(got, ShouldNotContainSubstring, "CA=")
+			frIdx := strings.Index(got, "FR=")
+			cnIdx := strings.Index(got, "CN=")
+			So(frIdx, ShouldBeGreaterThanOrEqualTo, 0)
+			So(cnIdx, ShouldBeGreaterThanOrEqualTo, 0)
+			So(cnIdx, ShouldBeLessThan, frIdx)
+
+			// The map should be cleared on return, regardless of suppression.
+			stats.Range(func(_, _ any) bool { panic("map was not cleared") })
+		})
+	})
+}
+
+func TestFormatTopNCountries(t *testing.T) {
+	Convey("given a mapping of country stats", t, func() {
+		stats := new(sync.Map)
+		for _, record := range []struct {
+			cc    string
+			count uint64
+		}{
+			{"CN", 250},
+			{"FR", 200},
+			{"RU", 150},
+			{"TZ", 100},
+			{"IT", 50},
+		} {
+			stats.Store(record.cc, &record.count)
+		}
+
+		Convey("topN at least the number of countries prints every entry with no others bucket", func() {
+			So(formatTopNCountries(stats, 20, false), ShouldEqual, "CN=250,FR=200,RU=150,TZ=100,IT=50")
+		})
+	})
+
+	Convey("given a mapping wider than topN", t, func() {
+		stats := new(sync.Map)
+		for _, record := range []struct {
+			cc    string
+			count uint64
+		}{
+			{"CN", 250},
+			{"FR", 200},
+			{"RU", 150},
+			{"TZ", 100},
+			{"IT", 50},
+		} {
+			stats.Store(record.cc, &record.count)
+		}
+
+		Convey("only the top entries are named, the rest fold into others", func() {
+			So(formatTopNCountries(stats, 2, false), ShouldEqual, "CN=250,FR=200,others=300")
+		})
+
+		// The map should be cleared on return.
+		stats.Range(func(_, _ any) bool { panic("map was not cleared") })
+	})
+}
+
+func TestUpdateClientStatsCountryBreakdown(t *testing.T) {
+	Convey("Given a fresh Metrics", t, func() {
+		m, err := NewMetrics(NullLogger())
+		So(err, ShouldBeNil)
+
+		Convey("a matched poll is tallied under client-country-match", func() {
+			m.UpdateClientStats("1.2.3.4", messages.RendezvousHttp, NATUnrestricted, "matched", "")
+			So(formatTopNCountries(m.clientMatchCountries, 20, false), ShouldEqual, "??=1")
+		})
+
+		Convey("a denied poll is tallied under client-country-denied and its NAT-specific bucket", func() {
+			m.UpdateClientStats("1.2.3.4", messages.RendezvousHttp, NATRestricted, "denied", "")
+			So(formatTopNCountries(m.clientDeniedCountries, 20, false), ShouldEqual, "??=1")
+			So(formatTopNCountries(m.clientDeniedRestrictedCountries, 20, false), ShouldEqual, "??=1")
+
+			m.UpdateClientStats("1.2.3.4", messages.RendezvousHttp, NATUnrestricted, "denied", "")
+			So(formatTopNCountries(m.clientDeniedUnrestrictedCountries, 20, false), ShouldEqual, "??=1")
+		})
+
+		Convey("a matched poll for a named bridge is tallied under client-bridge-<fp>-match-count", func() {
+			m.UpdateClientStats("1.2.3.4", messages.RendezvousHttp, NATUnrestricted, "matched", "aaaabbbbccccdddd")
+			v, ok := m.clientBridgeMatchCounts.Load("aaaabbbbccccdddd")
+			So(ok, ShouldBeTrue)
+			So(*v.(*uint64), ShouldEqual, 1)
+		})
+
+		Convey("a denied poll with no requested bridge is tallied under the default label", func() {
+			m.UpdateClientStats("1.2.3.4", messages.RendezvousHttp, NATRestricted, "denied", "")
+			v, ok := m.clientBridgeDeniedCounts.Load("default")
+			So(ok, ShouldBeTrue)
+			So(*v.(*uint64), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestRecordMatch(t *testing.T) {
+	Convey("Given a fresh Metrics", t, func() {
+		m, err := NewMetrics(NullLogger())
+		So(err, ShouldBeNil)
+
+		Convey("RecordMatch tallies per proxy type and rendezvous method", func() {
+			m.RecordMatch("US", "DE", "standalone", NATUnrestricted, messages.RendezvousHttp)
+			m.RecordMatch("US", "DE", "standalone", NATUnrestricted, messages.RendezvousHttp)
+			m.RecordMatch("CA", "FR", "badge", NATRestricted, messages.RendezvousAmpCache)
+
+			So(m.loadAndZero("match-standalone-http"), ShouldEqual, 2)
+			So(m.loadAndZero("match-badge-ampcache"), ShouldEqual, 1)
+			So(m.loadAndZero("match-standalone-sqs"), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestServeMetrics(t *testing.T) {
+	t.Parallel()
+
+	Convey("Given a running Prometheus endpoint", t, func() {
+		promMetrics := initPrometheus()
+		promMetrics.ProxyTotal.With(prometheus.Labels{"type": "standalone", "nat": NATUnrestricted, "cc": "??"}).Inc()
+
+		Convey("it starts cleanly with no bearer token configured", func() {
+			err := promMetrics.ServeMetrics("127.0.0.1:0", "", "", "")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("an unauthenticated request is rejected when a bearer token is configured", func() {
+			addr := "127.0.0.1:17652"
+			err := promMetrics.ServeMetrics(addr, "", "", "secret")
+			So(err, ShouldBeNil)
+			time.Sleep(50 * time.Millisecond)
+
+			resp, err := http.Get("http://" + addr + "/metrics")
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+
+			req, err := http.NewRequest("GET", "http://"+addr+"/metrics", nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("Authorization", "Bearer secret")
+			resp, err = http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+			body, err := io.ReadAll(resp.Body)
+			So(err, ShouldBeNil)
+			So(strings.Contains(string(body), "snowflake_proxy_total"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestCohortID(t *testing.T) {
+	Convey("cohortID is deterministic and truncated", t, func() {
+		id := cohortID("US", NATUnrestricted, "http")
+		So(len(id), ShouldEqual, cohortTruncation)
+		So(cohortID("US", NATUnrestricted, "http"), ShouldEqual, id)
+
+		Convey("a different tuple gets a different cohort most of the time", func() {
+			So(cohortID("CA", NATRestricted, "ampcache"), ShouldNotEqual, id)
+		})
+	})
+}
+
+func TestExemplarsDisabledByDefault(t *testing.T) {
+	Convey("Given a fresh Metrics", t, func() {
+		m, err := NewMetrics(NullLogger())
+		So(err, ShouldBeNil)
+
+		Convey("the exemplar mirrors are nil until enabled", func() {
+			So(m.promMetrics.ClientPollExemplars, ShouldBeNil)
+			So(m.promMetrics.MatchesExemplars, ShouldBeNil)
+		})
+
+		Convey("SetExemplarsEnabled registers them exactly once", func() {
+			m.SetExemplarsEnabled(true)
+			So(m.promMetrics.ClientPollExemplars, ShouldNotBeNil)
+			So(m.promMetrics.MatchesExemplars, ShouldNotBeNil)
+
+			So(func() { m.SetExemplarsEnabled(true) }, ShouldNotPanic)
+
+			m.RecordMatch("US", "DE", "standalone", NATUnrestricted, messages.RendezvousHttp)
+			m.UpdateClientStats("1.2.3.4", messages.RendezvousHttp, NATUnrestricted, "matched", "")
+		})
+	})
+}
+
+// TestPrometheusExpositionAfterTraffic exercises the same clientOffers and
+// proxyPolls HTTP handlers TestBroker drives, then scrapes the resulting
+// counters back out over a real /metrics HTTP connection, so a drift
+// between the plaintext and Prometheus counter stores (they're both
+// updated from the same ctx.metrics calls) would show up as a scrape
+// assertion failing here rather than only in the plaintext substring tests.
+func TestPrometheusExpositionAfterTraffic(t *testing.T) {
+	t.Parallel()
+
+	Convey("Given a broker that has denied a client and left a proxy poll unmatched", t, func() {
+		ctx := NewBrokerContext(log.New(io.Discard, "", 0))
+		i := &IPC{ctx}
+
+		w := httptest.NewRecorder()
+		data, err := createClientOffer(sdp, NATUnknown, "")
+		So(err, ShouldBeNil)
+		r, err := http.NewRequest("POST", "snowflake.broker/client", data)
+		So(err, ShouldBeNil)
+		clientOffers(i, w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		done := make(chan bool)
+		wp := httptest.NewRecorder()
+		pollData := bytes.NewReader([]byte(`{"Sid":"ymbcCMto7KHNGYlp","Version":"1.0"}`))
+		pr, err := http.NewRequest("POST", "snowflake.broker/proxy", pollData)
+		So(err, ShouldBeNil)
+		go func(i *IPC) {
+			proxyPolls(i, wp, pr)
+			done <- true
+		}(i)
+		p := <-ctx.proxyPolls
+		p.offerChannel <- nil
+		<-done
+
+		addr := "127.0.0.1:17653"
+		So(ctx.metrics.promMetrics.ServeMetrics(addr, "", "", ""), ShouldBeNil)
+		time.Sleep(50 * time.Millisecond)
+
+		resp, err := http.Get("http://" + addr + "/metrics")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+		body, err := io.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		exposition := string(body)
+
+		Convey("the denied client poll and the unmatched proxy poll both show up in the scrape", func() {
+			So(exposition, ShouldContainSubstring, "snowflake_rounded_client_poll_total{")
+			So(exposition, ShouldContainSubstring, "snowflake_rounded_proxy_poll_total{")
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+
+	"tgragnato.it/snowflake/common/nat"
+)
+
+// natHintMinSamples is how many mismatched (spoofed) attempts
+// NATHintTracker requires for a given actual NAT type before Hint returns
+// anything but nat.HintNone -- too few samples and a couple of unlucky
+// mismatched-failures would flip the hint back and forth for no reason.
+const natHintMinSamples = 20
+
+// natHintSuccessThreshold is the share of mismatched attempts that must
+// have succeeded, for a given actual NAT type, before Hint tells clients
+// reporting that NAT type it's still worth spoofing NATUnrestricted.
+const natHintSuccessThreshold = 0.5
+
+// natOutcomeCounts tallies how clients reporting a given actual NAT type
+// have fared across repeated polls. matched is every attempt where a
+// client sent its real NAT type (so no spoof was in play); mismatchedSuccess
+// and mismatchedFailure split the attempts where it spoofed
+// NATUnrestricted by whether the resulting connection succeeded.
+type natOutcomeCounts struct {
+	matched           int
+	mismatchedSuccess int
+	mismatchedFailure int
+}
+
+// NATHintTracker aggregates, per client-reported actual NAT type, how
+// often spoofing NATUnrestricted has paid off, so the broker can return a
+// data-driven nat.Hint in place of each client's own single-attempt local
+// guess (see client/lib's NATPolicy). It is NOT yet wired into
+// IPC.ClientOffers, since that handler isn't implemented in this tree (see
+// the doc comment on IPC in ipc_prometheus.go): RecordOutcome and Hint are
+// ready for it to call once it exists -- RecordOutcome from a poll's
+// PrevSentNAT/PrevOutcome fields, Hint to populate the new
+// ClientPollResponse.NATHint field. A nil *NATHintTracker behaves as
+// though nothing has been recorded yet: RecordOutcome is a no-op and Hint
+// always returns nat.HintNone.
+type NATHintTracker struct {
+	mu     sync.Mutex
+	counts map[string]*natOutcomeCounts
+}
+
+// NewNATHintTracker builds an empty NATHintTracker.
+func NewNATHintTracker() *NATHintTracker {
+	return &NATHintTracker{counts: make(map[string]*natOutcomeCounts)}
+}
+
+// RecordOutcome folds one client's previous-attempt report into
+// actualNATType's running counts. outcome should be one of
+// nat.OutcomeMatched, nat.OutcomeMismatchedSuccess, or
+// nat.OutcomeMismatchedFailure; any other value (including "", a client
+// with no previous attempt to report) is ignored.
+func (t *NATHintTracker) RecordOutcome(actualNATType, outcome string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.counts[actualNATType]
+	if !ok {
+		c = new(natOutcomeCounts)
+		t.counts[actualNATType] = c
+	}
+	switch outcome {
+	case nat.OutcomeMatched:
+		c.matched++
+	case nat.OutcomeMismatchedSuccess:
+		c.mismatchedSuccess++
+	case nat.OutcomeMismatchedFailure:
+		c.mismatchedFailure++
+	}
+}
+
+// Hint reports whether a client reporting actualNATType should keep
+// spoofing NATUnrestricted (nat.HintSpoofOK), stop (nat.HintStopSpoofing),
+// or whether there isn't yet enough data to say (nat.HintNone, fewer than
+// natHintMinSamples mismatched attempts recorded for actualNATType).
+func (t *NATHintTracker) Hint(actualNATType string) string {
+	if t == nil {
+		return nat.HintNone
+	}
+
+	t.mu.Lock()
+	c, ok := t.counts[actualNATType]
+	t.mu.Unlock()
+	if !ok {
+		return nat.HintNone
+	}
+
+	total := c.mismatchedSuccess + c.mismatchedFailure
+	if total < natHintMinSamples {
+		return nat.HintNone
+	}
+	if float64(c.mismatchedSuccess)/float64(total) >= natHintSuccessThreshold {
+		return nat.HintSpoofOK
+	}
+	return nat.HintStopSpoofing
+}
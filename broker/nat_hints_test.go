@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"tgragnato.it/snowflake/common/nat"
+)
+
+func TestNATHintTracker(t *testing.T) {
+	Convey("Given a fresh NATHintTracker", t, func() {
+		tracker := NewNATHintTracker()
+
+		Convey("it has no opinion before natHintMinSamples mismatched attempts", func() {
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintNone)
+			for i := 0; i < natHintMinSamples-1; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedSuccess)
+			}
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintNone)
+		})
+
+		Convey("it converges to spoof-ok when most spoofed unknown-NAT clients succeed", func() {
+			for i := 0; i < 90; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedSuccess)
+			}
+			for i := 0; i < 10; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedFailure)
+			}
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintSpoofOK)
+		})
+
+		Convey("it converges to stop-spoofing when most spoofed unknown-NAT clients fail", func() {
+			for i := 0; i < 10; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedSuccess)
+			}
+			for i := 0; i < 90; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedFailure)
+			}
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintStopSpoofing)
+		})
+
+		Convey("matched attempts (no spoof) don't count toward the mismatched sample size", func() {
+			for i := 0; i < 1000; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMatched)
+			}
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintNone)
+		})
+
+		Convey("a restricted-NAT client's hint doesn't mix with an unknown-NAT client's", func() {
+			for i := 0; i < 100; i++ {
+				tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedSuccess)
+			}
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintSpoofOK)
+			So(tracker.Hint(nat.NATRestricted), ShouldEqual, nat.HintNone)
+		})
+
+		Convey("a nil *NATHintTracker is a safe no-op", func() {
+			var nilTracker *NATHintTracker
+			nilTracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedFailure)
+			So(nilTracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintNone)
+		})
+
+		Convey("the hint converges to match a shifting client-population mix across many poll cycles", func() {
+			// Simulate 500 poll cycles of mostly-failing spoofed
+			// attempts (as if most unknown-NAT clients turned out
+			// to be behind a restrictive NAT after all): the hint
+			// should settle on stop-spoofing well before the end.
+			for i := 0; i < 500; i++ {
+				if i%5 == 0 {
+					tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedSuccess)
+				} else {
+					tracker.RecordOutcome(nat.NATUnknown, nat.OutcomeMismatchedFailure)
+				}
+			}
+			So(tracker.Hint(nat.NATUnknown), ShouldEqual, nat.HintStopSpoofing)
+		})
+	})
+}
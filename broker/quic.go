@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/quic-go/quic-go"
+	"tgragnato.it/snowflake/common/messages"
+)
+
+// quicALPN is the ALPN token the broker's raw-QUIC rendezvous listener
+// requires during the TLS handshake, so a QUIC client that isn't speaking
+// this fork's stream framing (e.g. an unrelated QUIC/HTTP3 client probing
+// the port) is rejected before it ever opens a stream, rather than getting
+// a confusing error once it does. It is distinct from the http-frontend's
+// own QUIC listener (-enable-quic), which negotiates HTTP/3's "h3" ALPN
+// and carries ordinary HTTP requests -- quicHandler speaks the
+// messages.Arg framing directly over a stream instead.
+const quicALPN = "snowflake-rendezvous/1"
+
+// quicMaxRequestSize bounds a single client poll request read off a QUIC
+// stream, so a malicious or confused peer declaring an oversized frame
+// can't make handleStream allocate without bound.
+const quicMaxRequestSize = 1 << 20 // 1 MiB
+
+// quicHandler accepts client rendezvous requests over raw QUIC: each
+// stream carries one length-prefixed request (a messages.Arg.Body, the
+// same bytes an HTTP POST body would carry) and, in reply, one
+// length-prefixed response, giving a censored client a UDP-based,
+// 0-RTT-capable signaling channel alongside the existing HTTP/AMP/SQS
+// rendezvous methods.
+type quicHandler struct {
+	Listener *quic.EarlyListener
+	IPC      *IPC
+	Metrics  *Metrics
+}
+
+// newQuicHandler starts a QUIC listener on addr using tlsConfig, which
+// must already carry a server certificate; a copy of tlsConfig has its
+// NextProtos replaced by quicALPN alone so the handshake itself enforces
+// the ALPN check. The listener accepts 0-RTT data from resuming clients.
+func newQuicHandler(addr string, tlsConfig *tls.Config, i *IPC, metrics *Metrics) (*quicHandler, error) {
+	conf := tlsConfig.Clone()
+	conf.NextProtos = []string{quicALPN}
+
+	ln, err := quic.ListenAddrEarly(addr, conf, &quic.Config{Allow0RTT: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &quicHandler{Listener: ln, IPC: i, Metrics: metrics}, nil
+}
+
+// Accept accepts QUIC connections until ctx is done or the listener fails,
+// handling each connection's streams in the background.
+func (q *quicHandler) Accept(ctx context.Context) {
+	for {
+		conn, err := q.Listener.Accept(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("quicHandler: accept error: %v", err)
+
+			continue
+		}
+
+		go q.handleConnection(ctx, conn)
+	}
+}
+
+// handleConnection serves every stream the peer opens on conn, each as an
+// independent rendezvous request, until the connection closes.
+func (q *quicHandler) handleConnection(ctx context.Context, conn *quic.Conn) {
+	for {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+
+		go q.handleStream(conn, stream)
+	}
+}
+
+// handleStream reads one request frame from stream, dispatches it to
+// IPC.ClientOffers tagged messages.RendezvousQuic, and writes back the
+// response frame.
+func (q *quicHandler) handleStream(conn *quic.Conn, stream *quic.Stream) {
+	defer stream.Close()
+
+	body, err := readFrame(stream, quicMaxRequestSize)
+	if err != nil {
+		log.Printf("quicHandler: error reading request: %v", err)
+
+		return
+	}
+
+	arg := messages.Arg{
+		Body:             body,
+		RemoteAddr:       conn.RemoteAddr().String(),
+		RendezvousMethod: messages.RendezvousQuic,
+	}
+
+	var response []byte
+	if err := q.IPC.ClientOffers(arg, &response); err != nil {
+		log.Printf("quicHandler: ClientOffers error: %v", err)
+
+		return
+	}
+
+	if err := writeFrame(stream, response); err != nil {
+		log.Printf("quicHandler: error writing response: %v", err)
+	}
+}
+
+// readFrame reads a uint32-length-prefixed frame from r, rejecting a
+// declared length over max.
+func readFrame(r io.Reader, max uint32) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n > max {
+		return nil, errors.New("quicHandler: frame exceeds maximum size")
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// writeFrame writes data to w as a uint32-length-prefixed frame, the
+// counterpart to readFrame.
+func writeFrame(w io.Writer, data []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisUnrestrictedKey and redisRestrictedKey name the two Redis sorted
+// sets a redisBrokerStore keeps registered proxy ids in, one per NAT
+// bucket -- the shared-state equivalent of SnowflakeHeap's two heaps.
+const (
+	redisUnrestrictedKey = "snowflake:broker:proxies:unrestricted"
+	redisRestrictedKey   = "snowflake:broker:proxies:restricted"
+	redisProxyKeyPrefix  = "snowflake:broker:proxy:"
+	redisAnswerChannel   = "snowflake:broker:answer:"
+)
+
+// redisBrokerStore is a BrokerStore backed by a shared Redis server, so
+// that every replica behind a load balancer draws proxies from, and
+// delivers answers into, the same pool instead of only the ones that
+// happened to poll that particular replica. The two Snowflake heaps
+// become Redis sorted sets of proxy ids; offer/answer rendezvous goes
+// over a PUBLISH/SUBSCRIBE channel keyed by sid, since an answer may
+// need to reach a replica other than the one that registered the
+// proxy.
+//
+// Unlike memoryBrokerStore, PopSnowflakeForClient here picks uniformly
+// at random within a bucket rather than weighting by Snowflake.score:
+// the EWMA inputs score is built from live on the in-process struct of
+// whichever replica last touched a given proxy, and this minimal
+// implementation doesn't replicate them through Redis.
+type redisBrokerStore struct {
+	client *redis.Client
+}
+
+// newRedisBrokerStore connects to the Redis server at the given redis://
+// URL.
+func newRedisBrokerStore(addr string) (*redisBrokerStore, error) {
+	opts, err := redis.ParseURL(addr)
+	if err != nil {
+		return nil, fmt.Errorf("store: parsing %q: %w", addr, err)
+	}
+	return &redisBrokerStore{client: redis.NewClient(opts)}, nil
+}
+
+// redisProxyRecord is the JSON a Snowflake is marshaled to under
+// redisProxyKeyPrefix+id; it carries just enough to reconstruct a
+// Snowflake on PopSnowflakeForClient in whichever replica pops it.
+type redisProxyRecord struct {
+	ID                         string   `json:"id"`
+	ProxyType                  string   `json:"proxyType"`
+	NATType                    string   `json:"natType"`
+	Clients                    int      `json:"clients"`
+	Capacity                   int      `json:"capacity"`
+	AcceptedBridgeFingerprints []string `json:"acceptedBridgeFingerprints,omitempty"`
+}
+
+func (s *redisBrokerStore) AddSnowflake(id string, proxyType string, natType string, verdict []byte, clients int, capacity int, acceptedBridgeFingerprints []string) *Snowflake {
+	ctx := context.Background()
+
+	record := redisProxyRecord{ID: id, ProxyType: proxyType, NATType: natType, Clients: clients, Capacity: capacity, AcceptedBridgeFingerprints: acceptedBridgeFingerprints}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		// Can't happen for this struct, but AddSnowflake has no error
+		// return (matching memoryBrokerStore and the pre-interface
+		// BrokerContext.AddSnowflake it replaces), so fall back to an
+		// unregistered Snowflake rather than panicking.
+		return &Snowflake{id: id, proxyType: proxyType, natType: natType, clients: clients, capacity: capacity, acceptedBridgeFingerprints: acceptedBridgeFingerprints, successEWMA: 1}
+	}
+
+	key := redisUnrestrictedKey
+	if natType != NATUnrestricted {
+		key = redisRestrictedKey
+	}
+	s.client.Set(ctx, redisProxyKeyPrefix+id, encoded, 0)
+	s.client.ZAdd(ctx, key, redis.Z{Score: 0, Member: id})
+
+	return &Snowflake{
+		id:                         id,
+		proxyType:                  proxyType,
+		natType:                    natType,
+		clients:                    clients,
+		capacity:                   capacity,
+		acceptedBridgeFingerprints: acceptedBridgeFingerprints,
+		offerChannel:               make(chan *ClientOffer),
+		answerChannel:              make(chan string),
+		successEWMA:                1,
+	}
+}
+
+// PopSnowflakeForClient draws from the buckets memoryBrokerStore does: a
+// restricted proxy can only serve an unrestricted client, so an
+// unrestricted client is offered the restricted bucket first and the
+// unrestricted bucket only if nothing there is eligible, while any other
+// client is offered the unrestricted bucket alone.
+func (s *redisBrokerStore) PopSnowflakeForClient(natType string, fingerprint string, bridgeFingerprint string) *Snowflake {
+	if natType == NATUnrestricted {
+		if snowflake := s.popFromBucket(redisRestrictedKey, bridgeFingerprint); snowflake != nil {
+			return snowflake
+		}
+	}
+	return s.popFromBucket(redisUnrestrictedKey, bridgeFingerprint)
+}
+
+// popFromBucket fetches every id in the sorted set key with ZRANGE and
+// picks one, skipping any whose record reports itself at
+// capacity (see Snowflake.atCapacity) or doesn't accept bridgeFingerprint
+// (see Snowflake.acceptsBridge), uniformly at random among the rest, then
+// ZREM's the winner. Snowflake.score's EWMA inputs live on the in-process
+// struct and aren't replicated here, so unlike memoryBrokerStore's
+// PopWeighted this can't yet weight by observed proxy quality across
+// replicas -- only by bucket (restricted/unrestricted), capacity, and
+// accepted bridge. It's also a best-effort removal: under concurrent pops
+// from two replicas, a second ZREM on an already-removed member is simply
+// a no-op, so a very small race window could hand the same proxy to two
+// clients; the client side already tolerates an unresponsive match (it
+// just retries), so this is an acceptable trade against the complexity of
+// a Lua-scripted atomic pop.
+func (s *redisBrokerStore) popFromBucket(key string, bridgeFingerprint string) *Snowflake {
+	ctx := context.Background()
+
+	ids, err := s.client.ZRange(ctx, key, 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	for _, id := range ids {
+		raw, err := s.client.Get(ctx, redisProxyKeyPrefix+id).Result()
+		if err != nil {
+			// Stale ZSET member whose record already expired or was
+			// popped by another replica; drop it and keep looking.
+			s.client.ZRem(ctx, key, id)
+			continue
+		}
+
+		var record redisProxyRecord
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		if record.Capacity > 0 && record.Clients >= record.Capacity {
+			continue
+		}
+		if !acceptsBridge(record.AcceptedBridgeFingerprints, bridgeFingerprint) {
+			continue
+		}
+
+		s.client.ZRem(ctx, key, id)
+		s.client.Del(ctx, redisProxyKeyPrefix+id)
+		return &Snowflake{
+			id:                         record.ID,
+			proxyType:                  record.ProxyType,
+			natType:                    record.NATType,
+			clients:                    record.Clients,
+			capacity:                   record.Capacity,
+			acceptedBridgeFingerprints: record.AcceptedBridgeFingerprints,
+			offerChannel:               make(chan *ClientOffer),
+			answerChannel:              make(chan string),
+			successEWMA:                1,
+		}
+	}
+
+	return nil
+}
+
+func (s *redisBrokerStore) DeliverAnswer(sid string, sdp string) error {
+	return s.client.Publish(context.Background(), redisAnswerChannel+sid, sdp).Err()
+}
+
+func (s *redisBrokerStore) AwaitAnswer(sid string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sub := s.client.Subscribe(ctx, redisAnswerChannel+sid)
+	defer sub.Close()
+
+	msg, err := sub.ReceiveMessage(ctx)
+	if err != nil {
+		return "", fmt.Errorf("store: no answer for %s within %s: %w", sid, timeout, err)
+	}
+	return msg.Payload, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"tgragnato.it/snowflake/common/constants"
+	"tgragnato.it/snowflake/common/messages"
+)
+
+// RendezvousTimeouts holds how long the broker will wait for a proxy answer
+// before giving up on a client, configurable separately per rendezvous
+// method since the CDNs and client libraries backing each one have
+// different response deadlines.
+type RendezvousTimeouts struct {
+	HTTP     time.Duration
+	AMPCache time.Duration
+	SQS      time.Duration
+}
+
+// NewRendezvousTimeouts returns the default timeouts, all set to
+// constants.BrokerClientTimeout seconds.
+func NewRendezvousTimeouts() RendezvousTimeouts {
+	d := time.Duration(constants.BrokerClientTimeout) * time.Second
+	return RendezvousTimeouts{HTTP: d, AMPCache: d, SQS: d}
+}
+
+// Get returns the configured timeout for the given rendezvous method,
+// falling back to the HTTP timeout for unrecognized methods.
+func (t RendezvousTimeouts) Get(method messages.RendezvousMethod) time.Duration {
+	switch method {
+	case messages.RendezvousAmpCache:
+		return t.AMPCache
+	case messages.RendezvousSqs:
+		return t.SQS
+	default:
+		return t.HTTP
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"tgragnato.it/snowflake/common/messages"
+	"tgragnato.it/snowflake/common/publisher"
+	"tgragnato.it/snowflake/common/s3client"
+	"tgragnato.it/snowflake/common/util"
+)
+
+// s3OffersPrefix is where clients upload poll requests, keyed by client ID:
+// offers/<clientID>/<requestID>.json. s3AnswersPrefix is where matched proxy
+// answers are written back: answers/<clientID>/<answerID>.json, mirroring
+// the layout common/s3client.Queue uses on the client side.
+const (
+	s3OffersPrefix  = "offers/"
+	s3AnswersPrefix = "answers/"
+)
+
+type s3Handler struct {
+	S3Client     s3client.S3Client
+	Bucket       string
+	IPC          *IPC
+	Metrics      *Metrics
+	pollInterval time.Duration
+	timeout      time.Duration
+
+	// Publisher fans client-matched events out to an external pub/sub
+	// backend alongside the normal answer object written to S3; it defaults
+	// to publisher.NoOp{}, so it's always safe to call.
+	Publisher publisher.Publisher
+
+	inFlight sync.Map // offer key -> struct{}, guards against double dispatch between polls
+}
+
+func newS3Handler(client s3client.S3Client, bucket string, i *IPC, metrics *Metrics, timeout time.Duration) *s3Handler {
+	return &s3Handler{
+		S3Client:     client,
+		Bucket:       bucket,
+		IPC:          i,
+		Metrics:      metrics,
+		pollInterval: 5 * time.Second,
+		timeout:      timeout,
+		Publisher:    publisher.NoOp{},
+	}
+}
+
+// pollOffers periodically lists s3OffersPrefix for new client offers and
+// dispatches each one exactly once, until ctx is done.
+func (r *s3Handler) pollOffers(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var continuationToken *string
+			for {
+				res, err := r.S3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+					Bucket:            aws.String(r.Bucket),
+					Prefix:            aws.String(s3OffersPrefix),
+					ContinuationToken: continuationToken,
+				})
+				if err != nil {
+					log.Printf("S3Handler: encountered error while polling for offers: %v\n", err)
+					break
+				}
+
+				for _, obj := range res.Contents {
+					key := *obj.Key
+					if _, alreadyDispatched := r.inFlight.LoadOrStore(key, struct{}{}); alreadyDispatched {
+						continue
+					}
+					go r.handleOffer(ctx, key)
+				}
+
+				if res.NextContinuationToken == nil {
+					break
+				}
+				continuationToken = res.NextContinuationToken
+			}
+		}
+	}
+}
+
+func (r *s3Handler) handleOffer(mainCtx context.Context, key string) {
+	defer r.inFlight.Delete(key)
+
+	ctx, cancel := context.WithTimeout(mainCtx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	clientID, ok := clientIDFromOfferKey(key)
+	if !ok {
+		log.Printf("S3Handler: got offer object %s with no client ID. ignoring.\n", key)
+		return
+	}
+
+	res, err := r.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("S3Handler: error encountered when fetching offer %s: %v\n", key, err)
+		return
+	}
+	encPollReq, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		log.Printf("S3Handler: error encountered when reading offer %s: %v\n", key, err)
+		return
+	}
+
+	// Get best guess Client IP for geolocating
+	remoteAddr := ""
+	req, err := messages.DecodeClientPollRequest(encPollReq)
+	if err != nil {
+		log.Printf("S3Handler: error encounted when decoding client poll request %s: %v\n", clientID, err)
+	} else {
+		sdp, err := util.DeserializeSessionDescription(req.Offer)
+		if err != nil {
+			log.Printf("S3Handler: error encounted when deserializing session desc %s: %v\n", clientID, err)
+		} else {
+			candidateAddrs := util.GetCandidateAddrs(sdp.SDP)
+			if len(candidateAddrs) > 0 {
+				remoteAddr = candidateAddrs[0].String()
+			}
+		}
+	}
+
+	arg := messages.Arg{
+		Body:             encPollReq,
+		RemoteAddr:       remoteAddr,
+		RendezvousMethod: messages.RendezvousSqs,
+	}
+
+	var response []byte
+	err = r.IPC.ClientOffers(arg, &response)
+	if err != nil {
+		outcome := "error"
+		if ctx.Err() != nil {
+			outcome = "timeout"
+		}
+		r.Metrics.RecordRendezvousWait(messages.RendezvousSqs, outcome, time.Since(start))
+		log.Printf("S3Handler: error encountered when handling offer %s: %v\n", key, err)
+		return
+	}
+	r.Metrics.RecordRendezvousWait(messages.RendezvousSqs, "matched", time.Since(start))
+	r.Publisher.Publish(ctx, publisher.Event{
+		Type:     publisher.EventClientMatched,
+		ClientID: clientID,
+	})
+
+	r.putAnswer(ctx, clientID, response)
+	r.deleteOffer(ctx, key)
+}
+
+func (r *s3Handler) putAnswer(ctx context.Context, clientID string, response []byte) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		log.Printf("S3Handler: error encountered when generating answer ID for %s: %v\n", clientID, err)
+		return
+	}
+	answerKey := s3AnswersPrefix + clientID + "/" + hex.EncodeToString(id[:]) + ".json"
+
+	if _, err := r.S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(r.Bucket),
+		Key:    aws.String(answerKey),
+		Body:   strings.NewReader(string(response)),
+	}); err != nil {
+		log.Printf("S3Handler: error encountered when uploading answer %s: %v\n", answerKey, err)
+	}
+}
+
+func (r *s3Handler) deleteOffer(ctx context.Context, key string) {
+	if _, err := r.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.Bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		log.Printf("S3Handler: error encountered when deleting offer %s: %v\n", key, err)
+	}
+}
+
+// clientIDFromOfferKey extracts the client ID from an offers/<clientID>/...
+// key.
+func clientIDFromOfferKey(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, s3OffersPrefix)
+	if !ok {
+		return "", false
+	}
+	clientID, _, ok := strings.Cut(rest, "/")
+	if !ok || clientID == "" {
+		return "", false
+	}
+
+	return clientID, true
+}
+
+func (r *s3Handler) PollAndHandleMessages(ctx context.Context) {
+	log.Println("S3Handler: Starting to poll for offers in bucket: " + r.Bucket)
+	r.pollOffers(ctx)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClientIDFromOfferKey(t *testing.T) {
+	Convey("clientIDFromOfferKey", t, func() {
+		Convey("extracts the client ID from a well formed offer key", func() {
+			clientID, ok := clientIDFromOfferKey("offers/fake-id/0123456789abcdef.json")
+			So(ok, ShouldBeTrue)
+			So(clientID, ShouldEqual, "fake-id")
+		})
+
+		Convey("rejects a key with no offers/ prefix", func() {
+			_, ok := clientIDFromOfferKey("answers/fake-id/0123456789abcdef.json")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("rejects a key with no client ID component", func() {
+			_, ok := clientIDFromOfferKey("offers/0123456789abcdef.json")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("rejects a key with an empty client ID", func() {
+			_, ok := clientIDFromOfferKey("offers//0123456789abcdef.json")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"tgragnato.it/snowflake/common/util"
+)
+
+// defaultMaxOfferCandidates bounds how many ICE candidates ValidateClientOfferSDP
+// tolerates in a single client offer before rejecting it as a flood, unless
+// -sdp-max-candidates overrides it.
+const defaultMaxOfferCandidates = 32
+
+// cgnatBlock is the RFC 6598 carrier-grade NAT range (100.64.0.0/10),
+// which net.IP.IsPrivate doesn't cover since it predates RFC 1918 private
+// space and is routed only within a single operator's network, not a
+// single LAN.
+var cgnatBlock = func() *net.IPNet {
+	_, block, err := net.ParseCIDR("100.64.0.0/10")
+	if err != nil {
+		panic(err)
+	}
+	return block
+}()
+
+// sdpFingerprintRE matches a WebRTC SDP "a=fingerprint:<algorithm> <hex>"
+// attribute, capturing the algorithm and the colon-separated hex byte
+// pairs, per RFC 8122.
+var sdpFingerprintRE = regexp.MustCompile(`(?m)^a=fingerprint:(\S+)\s+(\S+)\s*$`)
+
+// sdpCandidateRE counts "a=candidate:" attribute lines directly, rather
+// than going through util.GetCandidateAddrs, so a flood of unparseable or
+// hostname (mDNS) candidates is still counted even though GetCandidateAddrs
+// silently drops anything that doesn't parse as an IP.
+var sdpCandidateRE = regexp.MustCompile(`(?m)^a=candidate:`)
+
+// SDPBlocklist is a set of CIDR ranges an operator never wants an ICE
+// candidate to resolve into, loaded once at startup by LoadSDPBlocklist.
+type SDPBlocklist []*net.IPNet
+
+// LoadSDPBlocklist reads path, one CIDR per line, ignoring blank lines and
+// "#"-prefixed comments -- the same convention the geoip database flags
+// already assume operators are comfortable editing by hand.
+func LoadSDPBlocklist(path string) (SDPBlocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var blocklist SDPBlocklist
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		_, block, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("sdp blocklist %s: %w", path, err)
+		}
+		blocklist = append(blocklist, block)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return blocklist, nil
+}
+
+// contains reports whether any entry of b contains ip.
+func (b SDPBlocklist) contains(ip net.IP) bool {
+	for _, block := range b {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnroutable reports whether ip is private address space that should
+// never appear as a reachable ICE candidate: RFC 1918, loopback,
+// link-local (v4 and v6), CGNAT (100.64.0.0/10), or IPv6 unique local
+// (fc00::/7, covered by IsPrivate).
+func isUnroutable(ip net.IP) bool {
+	return ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() ||
+		cgnatBlock.Contains(ip)
+}
+
+// ValidateClientOfferSDP walks sdpStr's ICE candidates and DTLS
+// fingerprint and rejects offers that a broker shouldn't hand to a proxy:
+// more than maxCandidates candidates, a candidate resolving into private/
+// unroutable address space or blocklist, or a sha-256 fingerprint whose
+// hex digest isn't 32 bytes long. maxCandidates <= 0 falls back to
+// defaultMaxOfferCandidates. On rejection it increments the matching
+// "client-offer-rejected-*" counter and returns a descriptive error; it
+// returns nil for an offer that passes every check.
+func (m *Metrics) ValidateClientOfferSDP(sdpStr string, blocklist SDPBlocklist, maxCandidates int) error {
+	if maxCandidates <= 0 {
+		maxCandidates = defaultMaxOfferCandidates
+	}
+
+	if n := len(sdpCandidateRE.FindAllString(sdpStr, -1)); n > maxCandidates {
+		m.rejectClientOffer("malformed")
+		return fmt.Errorf("sdp offer has %d ICE candidates, more than the %d allowed", n, maxCandidates)
+	}
+
+	if match := sdpFingerprintRE.FindStringSubmatch(sdpStr); match != nil {
+		algorithm, digest := match[1], match[2]
+		if algorithm == "sha-256" && len(strings.Split(digest, ":")) != 32 {
+			m.rejectClientOffer("malformed")
+			return fmt.Errorf("sdp offer's sha-256 fingerprint has %d bytes, want 32", len(strings.Split(digest, ":")))
+		}
+	}
+
+	for _, ip := range util.GetCandidateAddrs(sdpStr) {
+		if isUnroutable(ip) {
+			m.rejectClientOffer("private-ip")
+			return fmt.Errorf("sdp offer has ICE candidate %s in private address space", ip)
+		}
+		if blocklist.contains(ip) {
+			m.rejectClientOffer("blocklist")
+			return fmt.Errorf("sdp offer has ICE candidate %s on the operator blocklist", ip)
+		}
+	}
+
+	return nil
+}
+
+// rejectClientOffer records a client-offer rejection both in the periodic
+// text-log counters (the "client-offer-rejected-<reason>-count" lines
+// printMetrics prints) and in the Prometheus ClientOfferRejectedTotal
+// counter, so the two stay in lockstep the way every other counter pair in
+// this package does.
+func (m *Metrics) rejectClientOffer(reason string) {
+	m.IncrementCounter("client-offer-rejected-" + reason)
+	m.promMetrics.ClientOfferRejectedTotal.With(prometheus.Labels{"reason": reason}).Inc()
+}
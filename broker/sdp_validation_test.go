@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const sdpPreambleForValidation = "v=0\r\n" +
+	"o=- 123456789 987654321 IN IP4 0.0.0.0\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=fingerprint:sha-256 " + validSHA256Fingerprint + "\r\n" +
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"c=IN IP4 0.0.0.0\r\n"
+
+// validSHA256Fingerprint is 32 colon-separated hex byte pairs, the length
+// RFC 8122 prescribes for a sha-256 certificate fingerprint.
+const validSHA256Fingerprint = "12:34:56:78:9A:BC:DE:F0:12:34:56:78:9A:BC:DE:F0:" +
+	"12:34:56:78:9A:BC:DE:F0:12:34:56:78:9A:BC:DE:F0"
+
+func candidateLine(ip string) string {
+	return "a=candidate:1000 1 udp 2000 " + ip + " 3000 typ host\r\n"
+}
+
+func TestValidateClientOfferSDP(t *testing.T) {
+	Convey("Given a fresh Metrics", t, func() {
+		m, err := NewMetrics(NullLogger())
+		So(err, ShouldBeNil)
+
+		Convey("a public candidate with a valid fingerprint passes", func() {
+			offer := sdpPreambleForValidation + candidateLine("8.8.8.8") + "a=end-of-candidates\r\n"
+			So(m.ValidateClientOfferSDP(offer, nil, 0), ShouldBeNil)
+		})
+
+		Convey("an RFC 1918 candidate is rejected and counted", func() {
+			offer := sdpPreambleForValidation + candidateLine("10.0.0.1") + "a=end-of-candidates\r\n"
+			err := m.ValidateClientOfferSDP(offer, nil, 0)
+			So(err, ShouldNotBeNil)
+			So(m.loadAndZero("client-offer-rejected-private-ip"), ShouldEqual, 1)
+			So(testutil.ToFloat64(m.promMetrics.ClientOfferRejectedTotal.With(prometheus.Labels{"reason": "private-ip"})), ShouldEqual, 1)
+		})
+
+		Convey("an IPv6 loopback candidate is rejected and counted", func() {
+			offer := sdpPreambleForValidation + candidateLine("::1") + "a=end-of-candidates\r\n"
+			err := m.ValidateClientOfferSDP(offer, nil, 0)
+			So(err, ShouldNotBeNil)
+			So(m.loadAndZero("client-offer-rejected-private-ip"), ShouldEqual, 1)
+		})
+
+		Convey("a public candidate on the operator blocklist is rejected and counted", func() {
+			_, block, err := net.ParseCIDR("203.0.113.0/24")
+			So(err, ShouldBeNil)
+			offer := sdpPreambleForValidation + candidateLine("203.0.113.5") + "a=end-of-candidates\r\n"
+
+			verr := m.ValidateClientOfferSDP(offer, SDPBlocklist{block}, 0)
+			So(verr, ShouldNotBeNil)
+			So(m.loadAndZero("client-offer-rejected-blocklist"), ShouldEqual, 1)
+		})
+
+		Convey("a flood of candidates is rejected as malformed and counted", func() {
+			var candidates strings.Builder
+			for i := 0; i < 200; i++ {
+				candidates.WriteString(candidateLine("8.8.8.8"))
+			}
+			offer := sdpPreambleForValidation + candidates.String() + "a=end-of-candidates\r\n"
+
+			err := m.ValidateClientOfferSDP(offer, nil, 0)
+			So(err, ShouldNotBeNil)
+			So(m.loadAndZero("client-offer-rejected-malformed"), ShouldEqual, 1)
+		})
+
+		Convey("a sha-256 fingerprint that isn't 32 bytes is rejected as malformed and counted", func() {
+			offer := "v=0\r\n" +
+				"a=fingerprint:sha-256 12:34\r\n" +
+				"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+				candidateLine("8.8.8.8") + "a=end-of-candidates\r\n"
+
+			err := m.ValidateClientOfferSDP(offer, nil, 0)
+			So(err, ShouldNotBeNil)
+			So(m.loadAndZero("client-offer-rejected-malformed"), ShouldEqual, 1)
+		})
+	})
+}
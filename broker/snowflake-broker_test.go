@@ -95,7 +95,7 @@ func TestBroker(t *testing.T) {
 		Convey("Adds Snowflake", func() {
 			So(ctx.snowflakes.Len(), ShouldEqual, 0)
 			So(len(ctx.idToSnowflake), ShouldEqual, 0)
-			ctx.AddSnowflake("foo", "", NATUnrestricted, 0)
+			ctx.AddSnowflake("foo", "", NATUnrestricted, nil, 0, 0, nil)
 			So(ctx.snowflakes.Len(), ShouldEqual, 1)
 			So(len(ctx.idToSnowflake), ShouldEqual, 1)
 		})
@@ -161,7 +161,7 @@ client-sqs-ips
 			Convey("with a proxy answer if available.", func() {
 				done := make(chan bool)
 				// Prepare a fake proxy to respond with.
-				snowflake := ctx.AddSnowflake("test", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("test", "", NATUnrestricted, nil, 0, 0, nil)
 				go func() {
 					clientOffers(i, w, r)
 					done <- true
@@ -190,7 +190,7 @@ client-sqs-ips
 			})
 
 			Convey("with unrestricted proxy to unrestricted client if there are no restricted proxies", func() {
-				snowflake := ctx.AddSnowflake("test", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("test", "", NATUnrestricted, nil, 0, 0, nil)
 				offerData, err := createClientOffer(sdp, NATUnrestricted, "")
 				So(err, ShouldBeNil)
 				r, err := http.NewRequest("POST", "snowflake.broker/client", offerData)
@@ -218,7 +218,7 @@ client-sqs-ips
 					return
 				}
 				done := make(chan bool)
-				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 				go func() {
 					clientOffers(i, w, r)
 					// Takes a few seconds here...
@@ -264,7 +264,7 @@ client-sqs-ips
 			Convey("with a proxy answer if available.", func() {
 				done := make(chan bool)
 				// Prepare a fake proxy to respond with.
-				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 				go func() {
 					clientOffers(i, w, r)
 					done <- true
@@ -297,7 +297,7 @@ client-sqs-ips
 					return
 				}
 				done := make(chan bool)
-				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 				go func() {
 					clientOffers(i, w, r)
 					// Takes a few seconds here...
@@ -352,7 +352,7 @@ client-sqs-ips
 			Convey("with a proxy answer if available.", func() {
 				done := make(chan bool)
 				// Prepare a fake proxy to respond with.
-				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 				go func() {
 					ampClientOffers(i, w, r)
 					done <- true
@@ -387,7 +387,7 @@ client-sqs-ips
 					return
 				}
 				done := make(chan bool)
-				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, 0)
+				snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 				go func() {
 					ampClientOffers(i, w, r)
 					// Takes a few seconds here...
@@ -442,7 +442,7 @@ client-sqs-ips
 
 		Convey("Responds to proxy answers...", func() {
 			done := make(chan bool)
-			s := ctx.AddSnowflake(sid, "", NATUnrestricted, 0)
+			s := ctx.AddSnowflake(sid, "", NATUnrestricted, nil, 0, 0, nil)
 			w := httptest.NewRecorder()
 
 			data, err := createProxyAnswer(sdp, sid)
@@ -561,7 +561,7 @@ client-sqs-ips
 			// Manually do the Broker goroutine action here for full control.
 			p := <-ctx.proxyPolls
 			So(p.id, ShouldEqual, "ymbcCMto7KHNGYlp")
-			s := ctx.AddSnowflake(p.id, "", NATUnrestricted, 0)
+			s := ctx.AddSnowflake(p.id, "", NATUnrestricted, nil, 0, 0, nil)
 			go func() {
 				offer := <-s.offerChannel
 				p.offerChannel <- offer
@@ -643,6 +643,108 @@ func TestSnowflakeHeap(t *testing.T) {
 		So(r.clients, ShouldEqual, 5)
 		So(r.index, ShouldEqual, -1)
 	})
+
+	Convey("PopWeighted picks a high-score Snowflake more often than a low-score one", t, func() {
+		good := &Snowflake{id: "good", successEWMA: 1, latencyEWMA: 10}
+		bad := &Snowflake{id: "bad", successEWMA: 0.05, latencyEWMA: 2000}
+
+		goodWins := 0
+		const trials = 500
+		for i := 0; i < trials; i++ {
+			h := new(SnowflakeHeap)
+			heap.Init(h)
+			heap.Push(h, &Snowflake{id: good.id, successEWMA: good.successEWMA, latencyEWMA: good.latencyEWMA})
+			heap.Push(h, &Snowflake{id: bad.id, successEWMA: bad.successEWMA, latencyEWMA: bad.latencyEWMA})
+			if h.PopWeighted("").id == "good" {
+				goodWins++
+			}
+		}
+
+		// good's score is orders of magnitude above bad's, so it should win
+		// nearly every trial; a majority comfortably clears sampling noise.
+		So(goodWins, ShouldBeGreaterThan, trials/2)
+	})
+
+	Convey("PopWeighted prefers a newly-arrived unloaded proxy over a near-full one of the same NAT class", t, func() {
+		unloadedWins := 0
+		const trials = 500
+		for i := 0; i < trials; i++ {
+			h := new(SnowflakeHeap)
+			heap.Init(h)
+			heap.Push(h, &Snowflake{id: "near-full", successEWMA: 1, clients: 95, capacity: 100, natType: NATUnrestricted})
+			heap.Push(h, &Snowflake{id: "unloaded", successEWMA: 1, clients: 0, capacity: 100, natType: NATUnrestricted})
+			if h.PopWeighted("").id == "unloaded" {
+				unloadedWins++
+			}
+		}
+
+		// unloaded's spare capacity is 100 against near-full's 5, so its
+		// loadFactor -- and hence score -- comfortably dominates; a
+		// majority clears sampling noise the same way the score test above
+		// does.
+		So(unloadedWins, ShouldBeGreaterThan, trials/2)
+	})
+
+	Convey("a Snowflake that repeatedly times out is deprioritized", t, func() {
+		s := &Snowflake{id: "flaky", successEWMA: 1}
+		for i := 0; i < 30; i++ {
+			s.RecordTimeout()
+		}
+		So(s.successEWMA, ShouldBeLessThan, 0.1)
+	})
+
+	Convey("PopWeighted skips a Snowflake that reports itself at capacity", t, func() {
+		h := new(SnowflakeHeap)
+		heap.Init(h)
+		heap.Push(h, &Snowflake{id: "full", successEWMA: 1, clients: 8, capacity: 8})
+		heap.Push(h, &Snowflake{id: "room", successEWMA: 1, clients: 1, capacity: 8})
+
+		for i := 0; i < 20; i++ {
+			r := h.PopWeighted("")
+			So(r, ShouldNotBeNil)
+			So(r.id, ShouldEqual, "room")
+			heap.Push(h, r)
+		}
+	})
+
+	Convey("PopWeighted returns nil when every Snowflake is at capacity", t, func() {
+		h := new(SnowflakeHeap)
+		heap.Init(h)
+		heap.Push(h, &Snowflake{id: "full1", successEWMA: 1, clients: 8, capacity: 8})
+		heap.Push(h, &Snowflake{id: "full2", successEWMA: 1, clients: 16, capacity: 8})
+
+		So(h.PopWeighted(""), ShouldBeNil)
+		So(h.Len(), ShouldEqual, 2)
+	})
+
+	Convey("PopWeighted only matches a Snowflake that accepts the requested bridge", t, func() {
+		h := new(SnowflakeHeap)
+		heap.Init(h)
+		heap.Push(h, &Snowflake{id: "default-only", successEWMA: 1})
+		heap.Push(h, &Snowflake{id: "multi-bridge", successEWMA: 1, acceptedBridgeFingerprints: []string{"aaaa"}})
+
+		for i := 0; i < 20; i++ {
+			r := h.PopWeighted("aaaa")
+			So(r, ShouldNotBeNil)
+			So(r.id, ShouldEqual, "multi-bridge")
+			heap.Push(h, r)
+		}
+		for i := 0; i < 20; i++ {
+			r := h.PopWeighted("")
+			So(r, ShouldNotBeNil)
+			So(r.id, ShouldEqual, "default-only")
+			heap.Push(h, r)
+		}
+	})
+
+	Convey("PopWeighted returns nil when no Snowflake accepts the requested bridge", t, func() {
+		h := new(SnowflakeHeap)
+		heap.Init(h)
+		heap.Push(h, &Snowflake{id: "default-only", successEWMA: 1})
+
+		So(h.PopWeighted("bbbb"), ShouldBeNil)
+		So(h.Len(), ShouldEqual, 1)
+	})
 }
 
 func TestInvalidGeoipFile(t *testing.T) {
@@ -815,7 +917,7 @@ snowflake-ips-nat-unknown 0
 			So(err, ShouldBeNil)
 
 			// Prepare a fake proxy to respond with.
-			snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, 0)
+			snowflake := ctx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 			go func() {
 				clientOffers(i, w, r)
 				done <- true
@@ -828,6 +930,30 @@ snowflake-ips-nat-unknown 0
 			ctx.metrics.printMetrics()
 			So(buf.String(), ShouldContainSubstring, "client-denied-count 0\nclient-restricted-denied-count 0\nclient-unrestricted-denied-count 0\nclient-snowflake-match-count 8")
 		})
+		Convey("for client-proxy match with a requested bridge fingerprint", func() {
+			w := httptest.NewRecorder()
+			data, err := createClientOffer(sdp, NATUnknown, "aaaabbbbccccdddd")
+			So(err, ShouldBeNil)
+			r, err := http.NewRequest("POST", "snowflake.broker/client", data)
+			So(err, ShouldBeNil)
+
+			// Only a proxy that advertised this bridge should be offered
+			// the client; one that didn't is left registered and unused.
+			ctx.AddSnowflake("default-only", "", NATUnrestricted, nil, 0, 0, nil)
+			snowflake := ctx.AddSnowflake("multi-bridge", "", NATUnrestricted, nil, 0, 0, []string{"aaaabbbbccccdddd"})
+			go func() {
+				clientOffers(i, w, r)
+				done <- true
+			}()
+			offer := <-snowflake.offerChannel
+			So(offer.sdp, ShouldResemble, []byte(sdp))
+			So(offer.bridgeFingerprint, ShouldEqual, "aaaabbbbccccdddd")
+			snowflake.answerChannel <- "fake answer"
+			<-done
+
+			ctx.metrics.printMetrics()
+			So(buf.String(), ShouldContainSubstring, "client-bridge-aaaabbbbccccdddd-match-count 8")
+		})
 		//Test rounding boundary
 		Convey("binning boundary", func() {
 			w := httptest.NewRecorder()
@@ -1001,6 +1127,19 @@ snowflake-ips-nat-unknown 0
 			ctx.metrics.printMetrics()
 			So(buf.String(), ShouldContainSubstring, "client-denied-count 8\nclient-restricted-denied-count 8\nclient-unrestricted-denied-count 0\nclient-snowflake-match-count 0")
 		})
+
+		Convey("client failures by NAT type with a requested bridge fingerprint", func() {
+			w := httptest.NewRecorder()
+			data, err := createClientOffer(sdp, NATRestricted, "aaaabbbbccccdddd")
+			So(err, ShouldBeNil)
+			r, err := http.NewRequest("POST", "snowflake.broker/client", data)
+			So(err, ShouldBeNil)
+
+			clientOffers(i, w, r)
+
+			ctx.metrics.printMetrics()
+			So(buf.String(), ShouldContainSubstring, "client-bridge-aaaabbbbccccdddd-denied-count 8")
+		})
 		Convey("for country stats order", func() {
 			stats := new(sync.Map)
 			for cc, count := range map[string]uint64{
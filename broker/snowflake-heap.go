@@ -0,0 +1,252 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// NAT classifications a proxy or client can report on its poll. Unrestricted
+// means its NAT mapping is unlikely to need a TURN relay; Restricted means
+// it might, so it's only matched against an Unrestricted peer; Unknown means
+// the poller didn't run a NAT check at all (e.g. it couldn't, or hasn't
+// yet), and is treated like Restricted for matching purposes.
+const (
+	NATUnknown      = "unknown"
+	NATRestricted   = "restricted"
+	NATUnrestricted = "unrestricted"
+)
+
+// ProxyTimeout bounds, in seconds, how long Broker waits for a client to be
+// matched with a newly registered Snowflake before giving up on it and
+// evicting it from its SnowflakeHeap; see Broker's select.
+const ProxyTimeout = 10
+
+// snowflakeEWMAAlpha weights each new observation folded into a
+// Snowflake's successEWMA/latencyEWMA against its existing average: with
+// 0.1, roughly the last ten offers dominate the average, so a proxy that
+// was flaky an hour ago but has since recovered (or vice versa) isn't
+// penalized (or trusted) forever.
+const snowflakeEWMAAlpha = 0.1
+
+// Snowflake represents a proxy that has polled for a client and is waiting
+// in a SnowflakeHeap to be matched. Beyond its identity and reported load
+// (clients), it tracks successEWMA, latencyEWMA, and lastSeen -- a rolling
+// view of how reliably and how quickly it has answered recent offers --
+// so PopWeighted can pick among proxies by observed quality instead of
+// always handing out the least-loaded one.
+type Snowflake struct {
+	id        string
+	proxyType string
+	natType   string
+
+	// clients is this proxy's last self-reported concurrent client count,
+	// rounded up to a multiple of 8 by the proxy for its own privacy.
+	clients int
+	// capacity is this proxy's self-advertised maximum concurrent client
+	// count, from the same poll as clients. 0 means the proxy didn't
+	// advertise one, so atCapacity never rejects it on that basis alone.
+	capacity int
+
+	// acceptedBridgeFingerprints lists the bridge fingerprints this proxy
+	// is willing to serve, for an operator running more than one Snowflake
+	// bridge behind a shared broker. Empty means the proxy didn't
+	// advertise a set, so it's only matched against the default bridge
+	// (an empty ClientOffer.bridgeFingerprint); see acceptsBridge.
+	acceptedBridgeFingerprints []string
+
+	offerChannel  chan *ClientOffer
+	answerChannel chan string
+
+	// index is this Snowflake's position in its SnowflakeHeap's backing
+	// slice, maintained by Push/Swap/Pop so heap.Remove can find and
+	// evict it in O(log n). It's -1 once removed.
+	index int
+
+	// successEWMA is an exponential moving average of 1 (answered) / 0
+	// (timed out) over this Snowflake's last several dispatched offers.
+	// It starts at 1: a brand new proxy is assumed reliable until it
+	// proves otherwise, rather than starting starved of selection weight.
+	successEWMA float64
+	// latencyEWMA is an exponential moving average, in milliseconds, of
+	// how long this Snowflake took to answer an offer it did answer.
+	// Timeouts don't feed it -- they already pull successEWMA down.
+	latencyEWMA float64
+	// lastSeen is when RecordAnswer or RecordTimeout last ran for this
+	// Snowflake, for a caller that wants to discount a score built from
+	// one very stale sample rather than trusting it outright.
+	lastSeen time.Time
+	// dispatchedAt is set when a client offer is handed to this
+	// Snowflake (see BrokerContext.Broker), so RecordAnswer can compute
+	// how long it took the proxy to answer once it does.
+	dispatchedAt time.Time
+}
+
+// atCapacity reports whether s has already reported as many clients as it
+// advertised room for, and so shouldn't be handed another offer until a
+// later poll reports it has room again.
+func (s *Snowflake) atCapacity() bool {
+	return s.capacity > 0 && s.clients >= s.capacity
+}
+
+// acceptsBridge reports whether s is willing to serve a client requesting
+// bridgeFingerprint, which is "" for a client that didn't request one (the
+// default bridge). A proxy that never advertised an accepted set only
+// serves the default bridge; one that did only serves what's listed,
+// including "" itself if an operator wants a multi-bridge proxy to also
+// cover the default.
+func (s *Snowflake) acceptsBridge(bridgeFingerprint string) bool {
+	return acceptsBridge(s.acceptedBridgeFingerprints, bridgeFingerprint)
+}
+
+// acceptsBridge is Snowflake.acceptsBridge's free-function core, usable
+// wherever only a proxy's advertised set is on hand, not a full Snowflake
+// (e.g. redisBrokerStore.PopSnowflakeForClient, which reconstructs one
+// from a redisProxyRecord only after deciding to keep it).
+func acceptsBridge(acceptedBridgeFingerprints []string, bridgeFingerprint string) bool {
+	if len(acceptedBridgeFingerprints) == 0 {
+		return bridgeFingerprint == ""
+	}
+	for _, fp := range acceptedBridgeFingerprints {
+		if fp == bridgeFingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// score blends loadFactor (this proxy's spare capacity -- more is better),
+// latencyEWMA (how long it typically takes to answer -- lower is better),
+// and successEWMA (how often it answers at all -- higher is better) into
+// the single weight PopWeighted samples proportional to:
+//
+//	score = successEWMA / (1 + latencyEWMA_ms/1000) * loadFactor
+//
+// A fast, reliable, mostly-idle proxy scores close to 1; a loaded, slow, or
+// flaky one scores close to 0, but never exactly 0, so it can still
+// occasionally be picked instead of being starved outright.
+func (s *Snowflake) score() float64 {
+	success := s.successEWMA
+	if success <= 0 {
+		success = 0.01
+	}
+	return success / (1 + s.latencyEWMA/1000) * s.loadFactor()
+}
+
+// loadFactor is score's load-based term: the fraction of a proxy's
+// advertised capacity still free, (spare+1)/(capacity+1) for spare =
+// capacity-clients clamped to 0, so two proxies serving the same NAT class
+// aren't treated as interchangeable just because both report room -- one
+// sitting at 95 of 100 slots scores far below one at 0 of 100. A proxy that
+// never advertised a capacity (capacity == 0) falls back to the clients-only
+// weighting PopWeighted used before capacity was tracked, 1/(1+clients).
+func (s *Snowflake) loadFactor() float64 {
+	if s.capacity <= 0 {
+		return 1 / (1 + float64(s.clients))
+	}
+	spare := s.capacity - s.clients
+	if spare < 0 {
+		spare = 0
+	}
+	return float64(spare+1) / float64(s.capacity+1)
+}
+
+// RecordAnswer folds a proxy answer observed just now into s's
+// successEWMA and latencyEWMA, using s.dispatchedAt (set when the client
+// offer this answer responds to was dispatched) to compute latency. It's
+// meant to be called from wherever a proxy's answer is read back off
+// answerChannel.
+func (s *Snowflake) RecordAnswer() {
+	s.successEWMA += snowflakeEWMAAlpha * (1 - s.successEWMA)
+
+	latencyMs := float64(time.Since(s.dispatchedAt).Milliseconds())
+	if s.latencyEWMA == 0 {
+		s.latencyEWMA = latencyMs
+	} else {
+		s.latencyEWMA += snowflakeEWMAAlpha * (latencyMs - s.latencyEWMA)
+	}
+
+	s.lastSeen = time.Now()
+}
+
+// RecordTimeout folds a missed offer into s's successEWMA, pulling it
+// toward 0 without touching latencyEWMA -- a proxy that never answered
+// didn't demonstrate any latency, good or bad.
+func (s *Snowflake) RecordTimeout() {
+	s.successEWMA += snowflakeEWMAAlpha * (0 - s.successEWMA)
+	s.lastSeen = time.Now()
+}
+
+// SnowflakeHeap is a container/heap of registered, unmatched Snowflakes,
+// kept ordered by clients so the least-loaded proxy is always the root --
+// used only to bound a couple of internal operations and to give
+// heap.Remove O(log n) eviction on timeout. Client-matching selection
+// should go through PopWeighted, a weighted sample across every proxy in
+// the heap, rather than heap.Pop, which would always hand out the same
+// least-loaded proxy and let a single fast proxy get hammered.
+type SnowflakeHeap []*Snowflake
+
+func (h SnowflakeHeap) Len() int { return len(h) }
+
+func (h SnowflakeHeap) Less(i, j int) bool { return h[i].clients < h[j].clients }
+
+func (h SnowflakeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *SnowflakeHeap) Push(x any) {
+	s := x.(*Snowflake)
+	s.index = len(*h)
+	*h = append(*h, s)
+}
+
+func (h *SnowflakeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	s.index = -1
+	*h = old[:n-1]
+	return s
+}
+
+// PopWeighted removes and returns one Snowflake from h, sampled with
+// probability proportional to its score (see Snowflake.score), via A-Res
+// weighted reservoir sampling: a single pass over h assigns each candidate
+// a key of u^(1/score) for u drawn uniformly from (0, 1], and the
+// candidate with the largest key wins. Unlike heap.Pop, which always
+// returns the minimum-clients proxy, this lets a worse- (but nonzero-)
+// scoring proxy still occasionally be picked, so one fast idle proxy isn't
+// the only one that ever gets matched. A Snowflake that reports itself at
+// capacity (see atCapacity) is never a candidate, since handing it another
+// offer would just make it time out or immediately reject it, and nor is
+// one that doesn't accept bridgeFingerprint (see acceptsBridge). Returns
+// nil if h is empty or no Snowflake in it is both eligible and accepting.
+func (h *SnowflakeHeap) PopWeighted(bridgeFingerprint string) *Snowflake {
+	old := *h
+
+	best := -1
+	bestKey := math.Inf(-1)
+	for i, s := range old {
+		if s.atCapacity() || !s.acceptsBridge(bridgeFingerprint) {
+			continue
+		}
+		u := rand.Float64()
+		for u == 0 {
+			u = rand.Float64()
+		}
+		key := math.Pow(u, 1/s.score())
+		if key > bestKey {
+			bestKey = key
+			best = i
+		}
+	}
+
+	if best == -1 {
+		return nil
+	}
+	return heap.Remove(h, old[best].index).(*Snowflake)
+}
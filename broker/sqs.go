@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -10,20 +12,108 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
 	"tgragnato.it/snowflake/common/messages"
+	"tgragnato.it/snowflake/common/publisher"
 	"tgragnato.it/snowflake/common/sqsclient"
 	"tgragnato.it/snowflake/common/util"
 )
 
 const (
 	cleanupThreshold = -2 * time.Minute
+
+	// dlqQueueNameSuffix names the dead-letter queue relative to the main
+	// SQS queue, e.g. "snowflake-broker" -> "snowflake-broker-dlq".
+	dlqQueueNameSuffix = "-dlq"
+
+	// defaultMaxReceiveCount bounds how many times a message is backed off
+	// and redelivered before handleMessage gives up on it and it is moved
+	// to the dead-letter queue.
+	defaultMaxReceiveCount = 5
+
+	// defaultVisibilityTimeout is the main queue's VisibilityTimeout queue
+	// attribute: how long a message is hidden from other ReceiveMessage
+	// calls once delivered, before SQS assumes the consumer died and makes
+	// it visible again. handleMessage's own ctx timeout should stay well
+	// under this.
+	defaultVisibilityTimeout = 30 * time.Second
+
+	// defaultMaxInFlight bounds how many messages a sqsHandler processes
+	// concurrently, so a slow IPC.ClientOffers backlog can't pile up an
+	// unbounded number of goroutines under load.
+	defaultMaxInFlight = 64
+
+	// defaultCleanupInterval is how often cleanupClientQueues sweeps for
+	// stale per-client answer queues.
+	defaultCleanupInterval = 30 * time.Second
+
+	// throttlingBackoffBase and throttlingBackoffMax bound the exponential
+	// backoff cleanupClientQueues applies after an AWS throttling error,
+	// doubling from the base up to the max before retrying.
+	throttlingBackoffBase = time.Second
+	throttlingBackoffMax  = 2 * time.Minute
 )
 
+// visibilityBackoffSchedule is how long a failed message's visibility
+// timeout is extended for before redelivery is attempted again, indexed by
+// (ApproximateReceiveCount - 1) and clamped to the last entry thereafter.
+var visibilityBackoffSchedule = []time.Duration{
+	5 * time.Second,
+	15 * time.Second,
+	60 * time.Second,
+}
+
+func backoffForReceiveCount(receiveCount int) time.Duration {
+	idx := receiveCount - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(visibilityBackoffSchedule) {
+		idx = len(visibilityBackoffSchedule) - 1
+	}
+	return visibilityBackoffSchedule[idx]
+}
+
+// isPermanentSQSFailure reports whether reason indicates a message that
+// will never succeed no matter how many times it's redelivered (as
+// opposed to a transient AWS or matchmaking failure worth backing off and
+// retrying), so it should be dead-lettered immediately.
+func isPermanentSQSFailure(reason string) bool {
+	return reason == "bad_offer_json"
+}
+
+var errMissingClientID = errors.New("SQS message has no ClientID attribute")
+
 type sqsHandler struct {
 	SQSClient       sqsclient.SQSClient
 	SQSQueueURL     *string
 	IPC             *IPC
+	Metrics         *Metrics
 	cleanupInterval time.Duration
+	timeout         time.Duration
+	maxReceiveCount int
+
+	// visibilityTimeout is the main queue's VisibilityTimeout attribute,
+	// applied when the queue is created.
+	visibilityTimeout time.Duration
+
+	// inFlight bounds how many messages PollAndHandleMessages processes
+	// concurrently: handleMessage acquires a slot before starting and
+	// releases it when done, so a backlog of slow IPC.ClientOffers calls
+	// can't spawn an unbounded number of goroutines.
+	inFlight chan struct{}
+
+	// DLQSQSURL, when non-nil, is the dead-letter queue a message is moved
+	// to once handleMessage gives up on it -- either because the failure
+	// is permanent or because maxReceiveCount redeliveries were exhausted.
+	// It is nil if the dead-letter queue could not be provisioned, in
+	// which case failed messages are simply deleted after giving up.
+	DLQSQSURL *string
+
+	// Publisher fans queue-created and client-matched events out to an
+	// external pub/sub backend alongside the normal per-client SQS reply; it
+	// defaults to publisher.NoOp{}, so it's always safe to call.
+	Publisher publisher.Publisher
 }
 
 func (r *sqsHandler) pollMessages(ctx context.Context, chn chan<- *types.Message) {
@@ -40,6 +130,9 @@ func (r *sqsHandler) pollMessages(ctx context.Context, chn chan<- *types.Message
 				MessageAttributeNames: []string{
 					string(types.QueueAttributeNameAll),
 				},
+				MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+					types.MessageSystemAttributeNameApproximateReceiveCount,
+				},
 			})
 
 			if err != nil {
@@ -54,87 +147,155 @@ func (r *sqsHandler) pollMessages(ctx context.Context, chn chan<- *types.Message
 	}
 }
 
+// isThrottlingError reports whether err is an AWS API error signaling the
+// caller should back off and retry more slowly, as opposed to a permanent
+// or unrelated failure.
+func isThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+		return true
+	default:
+		return false
+	}
+}
+
+// cleanupClientQueues periodically deletes per-client answer queues that
+// haven't been touched in cleanupThreshold, so a client that stopped
+// polling (network loss, the client exiting) doesn't leave its queue
+// behind forever. It reschedules itself with a context-aware timer rather
+// than a time.Ticker -- so a nil ctx.Done() check inside every tick isn't
+// needed, the timer is always stopped on return instead of leaking, and a
+// sweep that hits AWS throttling can back off exponentially instead of
+// hammering the same rate limit again on the very next tick.
 func (r *sqsHandler) cleanupClientQueues(ctx context.Context) {
-	for range time.NewTicker(r.cleanupInterval).C {
-		// Runs at fixed intervals to clean up any client queues that were last changed more than 2 minutes ago
+	interval := r.cleanupInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
 		select {
 		case <-ctx.Done():
-			// if context is cancelled
 			return
-		default:
-			queueURLsList := []string{}
-			var nextToken *string
-			for {
-				res, err := r.SQSClient.ListQueues(ctx, &sqs.ListQueuesInput{
-					QueueNamePrefix: aws.String("snowflake-client-"),
-					MaxResults:      aws.Int32(1000),
-					NextToken:       nextToken,
-				})
-				if err != nil {
-					log.Printf("SQSHandler: encountered error while retrieving client queues to clean up: %v\n", err)
-					// client queues will be cleaned up the next time the cleanup operation is triggered automatically
-					break
-				}
-				queueURLsList = append(queueURLsList, res.QueueUrls...)
-				if res.NextToken == nil {
-					break
-				} else {
-					nextToken = res.NextToken
-				}
+		case <-timer.C:
+		}
+
+		throttled, err := r.sweepClientQueues(ctx)
+		switch {
+		case err != nil && isThrottlingError(err):
+			if interval < throttlingBackoffBase {
+				interval = throttlingBackoffBase
+			} else if interval *= 2; interval > throttlingBackoffMax {
+				interval = throttlingBackoffMax
 			}
+			log.Printf("SQSHandler: throttled while cleaning up client queues, backing off to %v: %v\n", interval, err)
+		case throttled:
+			// sweepClientQueues hit throttling partway through but still
+			// made progress; back off one step without logging at the
+			// same severity as a sweep that made no progress at all.
+			if interval < throttlingBackoffBase {
+				interval = throttlingBackoffBase
+			} else if interval *= 2; interval > throttlingBackoffMax {
+				interval = throttlingBackoffMax
+			}
+		default:
+			interval = r.cleanupInterval
+		}
+		timer.Reset(interval)
+	}
+}
 
-			numDeleted := 0
-			cleanupCutoff := time.Now().Add(cleanupThreshold)
-			for _, queueURL := range queueURLsList {
-				if !strings.Contains(queueURL, "snowflake-client-") {
-					continue
-				}
-				res, err := r.SQSClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
-					QueueUrl:       aws.String(queueURL),
-					AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameLastModifiedTimestamp},
-				})
-				if err != nil {
-					// According to the AWS SQS docs, the deletion process for a queue can take up to 60 seconds. So the queue
-					// can be in the process of being deleted, but will still be returned by the ListQueues operation, but
-					// fail when we try to GetQueueAttributes for the queue
-					log.Printf("SQSHandler: encountered error while getting attribute of client queue %s. queue may already be deleted.\n", queueURL)
-					continue
-				}
-				lastModifiedInt64, err := strconv.ParseInt(res.Attributes[string(types.QueueAttributeNameLastModifiedTimestamp)], 10, 64)
-				if err != nil {
-					log.Printf("SQSHandler: encountered invalid lastModifiedTimetamp value from client queue %s: %v\n", queueURL, err)
-					continue
-				}
-				lastModified := time.Unix(lastModifiedInt64, 0)
-				if lastModified.Before(cleanupCutoff) {
-					_, err := r.SQSClient.DeleteQueue(ctx, &sqs.DeleteQueueInput{
-						QueueUrl: aws.String(queueURL),
-					})
-					if err != nil {
-						log.Printf("SQSHandler: encountered error when deleting client queue %s: %v\n", queueURL, err)
-						continue
-					} else {
-						numDeleted += 1
-					}
+// sweepClientQueues does one pass of cleanupClientQueues' work: list every
+// snowflake-client-* queue, and delete the ones whose
+// LastModifiedTimestamp is older than cleanupThreshold. It returns
+// throttled=true if any AWS call hit a throttling error along the way
+// (err carries the most recent one), so the caller can back off even
+// though some queues may still have been listed or deleted successfully.
+func (r *sqsHandler) sweepClientQueues(ctx context.Context) (throttled bool, err error) {
+	var queueURLsList []string
+	var nextToken *string
+	for {
+		res, listErr := r.SQSClient.ListQueues(ctx, &sqs.ListQueuesInput{
+			QueueNamePrefix: aws.String("snowflake-client-"),
+			MaxResults:      aws.Int32(1000),
+			NextToken:       nextToken,
+		})
+		if listErr != nil {
+			log.Printf("SQSHandler: encountered error while retrieving client queues to clean up: %v\n", listErr)
+			if isThrottlingError(listErr) {
+				throttled, err = true, listErr
+			}
+			// client queues will be cleaned up the next time the cleanup operation is triggered automatically
+			break
+		}
+		queueURLsList = append(queueURLsList, res.QueueUrls...)
+		if res.NextToken == nil {
+			break
+		}
+		nextToken = res.NextToken
+	}
 
+	cleanupCutoff := time.Now().Add(cleanupThreshold)
+	for _, queueURL := range queueURLsList {
+		if !strings.Contains(queueURL, "snowflake-client-") {
+			continue
+		}
+		res, attrErr := r.SQSClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameLastModifiedTimestamp},
+		})
+		if attrErr != nil {
+			// According to the AWS SQS docs, the deletion process for a queue can take up to 60 seconds. So the queue
+			// can be in the process of being deleted, but will still be returned by the ListQueues operation, but
+			// fail when we try to GetQueueAttributes for the queue
+			log.Printf("SQSHandler: encountered error while getting attribute of client queue %s. queue may already be deleted.\n", queueURL)
+			if isThrottlingError(attrErr) {
+				throttled, err = true, attrErr
+			}
+			continue
+		}
+		lastModifiedInt64, parseErr := strconv.ParseInt(res.Attributes[string(types.QueueAttributeNameLastModifiedTimestamp)], 10, 64)
+		if parseErr != nil {
+			log.Printf("SQSHandler: encountered invalid lastModifiedTimetamp value from client queue %s: %v\n", queueURL, parseErr)
+			continue
+		}
+		lastModified := time.Unix(lastModifiedInt64, 0)
+		if lastModified.Before(cleanupCutoff) {
+			if _, delErr := r.SQSClient.DeleteQueue(ctx, &sqs.DeleteQueueInput{
+				QueueUrl: aws.String(queueURL),
+			}); delErr != nil {
+				log.Printf("SQSHandler: encountered error when deleting client queue %s: %v\n", queueURL, delErr)
+				if isThrottlingError(delErr) {
+					throttled, err = true, delErr
 				}
 			}
 		}
 	}
+	return throttled, err
 }
 
-func (r *sqsHandler) handleMessage(mainCtx context.Context, message *types.Message) {
+// handleMessage processes a single client poll message. On success it
+// returns an empty reason and a nil error. On failure it returns a reason
+// drawn from a small fixed vocabulary ("bad_offer_json",
+// "create_queue_failed", "no_snowflake_available", "send_message_failed"),
+// which the caller uses both to record the snowflake_sqs_dead_letter_total
+// metric and to decide whether the message is worth redelivering at all.
+func (r *sqsHandler) handleMessage(mainCtx context.Context, message *types.Message) (reason string, err error) {
 	var encPollReq []byte
 	var response []byte
-	var err error
 
-	ctx, cancel := context.WithTimeout(mainCtx, ClientTimeout*time.Second)
+	ctx, cancel := context.WithTimeout(mainCtx, r.timeout)
 	defer cancel()
 
+	start := time.Now()
+
 	clientID := message.MessageAttributes["ClientID"].StringValue
 	if clientID == nil {
 		log.Println("SQSHandler: got SDP offer in SQS message with no client ID. ignoring this message.")
-		return
+		return "bad_offer_json", errMissingClientID
 	}
 
 	res, err := r.SQSClient.CreateQueue(ctx, &sqs.CreateQueueInput{
@@ -142,9 +303,13 @@ func (r *sqsHandler) handleMessage(mainCtx context.Context, message *types.Messa
 	})
 	if err != nil {
 		log.Printf("SQSHandler: error encountered when creating answer queue for client %s: %v\n", *clientID, err)
-		return
+		return "create_queue_failed", err
 	}
 	answerSQSURL := res.QueueUrl
+	r.Publisher.Publish(ctx, publisher.Event{
+		Type:     publisher.EventQueueCreated,
+		ClientID: *clientID,
+	})
 
 	encPollReq = []byte(*message.Body)
 
@@ -174,14 +339,39 @@ func (r *sqsHandler) handleMessage(mainCtx context.Context, message *types.Messa
 	err = r.IPC.ClientOffers(arg, &response)
 
 	if err != nil {
+		outcome := "error"
+		status := "denied"
+		if ctx.Err() != nil {
+			outcome = "timeout"
+			status = "timeout"
+		}
+		r.Metrics.RecordRendezvousWait(messages.RendezvousSqs, outcome, time.Since(start))
+		// This poll never made it to a NAT-aware path (ClientOffers isn't
+		// implemented in this tree -- see IPC's doc comment in
+		// ipc_prometheus.go), so there's no natType to report beyond
+		// NATUnknown; client-sqs-count/client-sqs-ips still need the
+		// poll counted the same as the http and ampcache paths do.
+		r.Metrics.UpdateClientStats(remoteAddr, messages.RendezvousSqs, NATUnknown, status, req.Fingerprint)
 		log.Printf("SQSHandler: error encountered when handling message: %v\n", err)
-		return
+		return "no_snowflake_available", err
 	}
+	r.Metrics.RecordRendezvousWait(messages.RendezvousSqs, "matched", time.Since(start))
+	r.Metrics.UpdateClientStats(remoteAddr, messages.RendezvousSqs, NATUnknown, "matched", req.Fingerprint)
+	r.Publisher.Publish(ctx, publisher.Event{
+		Type:     publisher.EventClientMatched,
+		ClientID: *clientID,
+	})
 
-	r.SQSClient.SendMessage(ctx, &sqs.SendMessageInput{
+	_, err = r.SQSClient.SendMessage(ctx, &sqs.SendMessageInput{
 		QueueUrl:    answerSQSURL,
 		MessageBody: aws.String(string(response)),
 	})
+	if err != nil {
+		log.Printf("SQSHandler: error encountered when sending answer to client %s: %v\n", *clientID, err)
+		return "send_message_failed", err
+	}
+
+	return "", nil
 }
 
 func (r *sqsHandler) deleteMessage(context context.Context, message *types.Message) {
@@ -191,27 +381,187 @@ func (r *sqsHandler) deleteMessage(context context.Context, message *types.Messa
 	})
 }
 
-func newSQSHandler(context context.Context, client sqsclient.SQSClient, sqsQueueName string, region string, i *IPC) (*sqsHandler, error) {
+// approximateReceiveCount reads the ApproximateReceiveCount system
+// attribute SQS attaches to a redelivered message, defaulting to 1 (first
+// delivery) if it's missing or unparseable.
+func approximateReceiveCount(message *types.Message) int {
+	raw, ok := message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]
+	if !ok {
+		return 1
+	}
+	count, err := strconv.Atoi(raw)
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
+
+// backoffMessage extends message's visibility timeout instead of deleting
+// it, so SQS redelivers it after the schedule-determined delay rather than
+// immediately, giving a transient failure (an AWS hiccup, a momentary lack
+// of available proxies) room to resolve itself.
+func (r *sqsHandler) backoffMessage(ctx context.Context, message *types.Message, receiveCount int) {
+	_, err := r.SQSClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          r.SQSQueueURL,
+		ReceiptHandle:     message.ReceiptHandle,
+		VisibilityTimeout: int32(backoffForReceiveCount(receiveCount).Seconds()),
+	})
+	if err != nil {
+		log.Printf("SQSHandler: error encountered when backing off message for redelivery: %v\n", err)
+	}
+}
+
+// deadLetterMessage gives up on message: it's forwarded to the
+// dead-letter queue tagged with why, removed from the main queue, and
+// recorded against the dead-letter Prometheus counter. The counter is
+// incremented here, at the point handleMessage's actual failure reason is
+// known, rather than by a separate process reading it back off the
+// dead-letter queue later -- SQS's native redrive policy doesn't preserve
+// *why* a message was abandoned, so recovering the reason downstream would
+// mean inventing a side channel for information this goroutine already has.
+func (r *sqsHandler) deadLetterMessage(ctx context.Context, message *types.Message, reason string) {
+	if r.DLQSQSURL != nil {
+		attributes := map[string]types.MessageAttributeValue{
+			"FailureReason": {DataType: aws.String("String"), StringValue: aws.String(reason)},
+		}
+		for k, v := range message.MessageAttributes {
+			attributes[k] = v
+		}
+		_, err := r.SQSClient.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:          r.DLQSQSURL,
+			MessageBody:       message.Body,
+			MessageAttributes: attributes,
+		})
+		if err != nil {
+			log.Printf("SQSHandler: error encountered when moving message to dead-letter queue: %v\n", err)
+		}
+	}
+	r.deleteMessage(ctx, message)
+	r.Metrics.RecordSQSDeadLetter(reason)
+}
+
+// ensureDeadLetterQueue creates the dead-letter queue alongside the main
+// queue and returns its URL plus a RedrivePolicy attribute value for the
+// main queue to carry. The RedrivePolicy is a backstop, not the primary
+// mechanism: PollAndHandleMessages dead-letters messages itself once
+// maxReceiveCount is reached, but wiring up the native redrive policy too
+// means a message still gets out of the main queue eventually even if the
+// broker process restarts mid-backoff.
+func ensureDeadLetterQueue(ctx context.Context, client sqsclient.SQSClient, sqsQueueName string, maxReceiveCount int) (dlqURL *string, redrivePolicy string, err error) {
+	res, err := client.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName: aws.String(sqsQueueName + dlqQueueNameSuffix),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       res.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	arn, ok := attrs.Attributes[string(types.QueueAttributeNameQueueArn)]
+	if !ok {
+		return nil, "", fmt.Errorf("dead-letter queue %s has no QueueArn attribute", *res.QueueUrl)
+	}
+
+	return res.QueueUrl, fmt.Sprintf(
+		`{"deadLetterTargetArn":"%s","maxReceiveCount":"%d"}`, arn, maxReceiveCount,
+	), nil
+}
+
+// sqsHandlerOption configures a sqsHandler built by newSQSHandler. Write
+// one by taking and mutating a *sqsHandler, the same way WithVisibilityTimeout
+// and the other With* helpers below do.
+type sqsHandlerOption func(*sqsHandler)
+
+// WithVisibilityTimeout overrides the main queue's VisibilityTimeout
+// attribute: how long a delivered message is hidden from other
+// ReceiveMessage calls before SQS assumes the consumer died and makes it
+// visible again.
+func WithVisibilityTimeout(timeout time.Duration) sqsHandlerOption {
+	return func(r *sqsHandler) { r.visibilityTimeout = timeout }
+}
+
+// WithMaxReceiveCount overrides how many times a message is backed off and
+// redelivered before handleMessage gives up on it and it is moved to the
+// dead-letter queue.
+func WithMaxReceiveCount(maxReceiveCount int) sqsHandlerOption {
+	return func(r *sqsHandler) { r.maxReceiveCount = maxReceiveCount }
+}
+
+// WithDLQURL points failed messages at an already-provisioned dead-letter
+// queue instead of one newSQSHandler creates itself alongside the main
+// queue, for an operator who wants to own the DLQ's retention, alarms, or
+// redrive policy directly. Since deadLetterMessage forwards to it with a
+// plain SendMessage, this skips wiring the main queue's native
+// RedrivePolicy attribute (that needs the DLQ's ARN, not just its URL) --
+// an operator using this option is expected to set that up themselves, if
+// they want it as a backstop.
+
+func WithDLQURL(dlqURL string) sqsHandlerOption {
+	return func(r *sqsHandler) { r.DLQSQSURL = aws.String(dlqURL) }
+}
+
+// WithCleanupInterval overrides how often cleanupClientQueues sweeps for
+// stale per-client answer queues.
+func WithCleanupInterval(interval time.Duration) sqsHandlerOption {
+	return func(r *sqsHandler) { r.cleanupInterval = interval }
+}
+
+// WithMaxInFlight bounds how many messages PollAndHandleMessages processes
+// concurrently.
+func WithMaxInFlight(maxInFlight int) sqsHandlerOption {
+	return func(r *sqsHandler) { r.inFlight = make(chan struct{}, maxInFlight) }
+}
+
+func newSQSHandler(context context.Context, client sqsclient.SQSClient, sqsQueueName string, region string, i *IPC, metrics *Metrics, timeout time.Duration, opts ...sqsHandlerOption) (*sqsHandler, error) {
+	r := &sqsHandler{
+		SQSClient:         client,
+		IPC:               i,
+		Metrics:           metrics,
+		cleanupInterval:   defaultCleanupInterval,
+		timeout:           timeout,
+		maxReceiveCount:   defaultMaxReceiveCount,
+		visibilityTimeout: defaultVisibilityTimeout,
+		inFlight:          make(chan struct{}, defaultMaxInFlight),
+		Publisher:         publisher.NoOp{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	attributes := map[string]string{
+		"MessageRetentionPeriod": strconv.FormatInt(int64((5 * time.Minute).Seconds()), 10),
+		"VisibilityTimeout":      strconv.FormatInt(int64(r.visibilityTimeout.Seconds()), 10),
+	}
+
+	if r.DLQSQSURL == nil {
+		dlqURL, redrivePolicy, err := ensureDeadLetterQueue(context, client, sqsQueueName, r.maxReceiveCount)
+		if err != nil {
+			log.Printf("SQSHandler: error encountered when provisioning dead-letter queue, failed messages will be deleted instead: %v\n", err)
+		} else {
+			attributes["RedrivePolicy"] = redrivePolicy
+			r.DLQSQSURL = dlqURL
+		}
+	}
+
 	// Creates the queue if a queue with the same name doesn't exist. If a queue with the same name and attributes
 	// already exists, then nothing will happen. If a queue with the same name, but different attributes exists, then
 	// an error will be returned
 	res, err := client.CreateQueue(context, &sqs.CreateQueueInput{
-		QueueName: aws.String(sqsQueueName),
-		Attributes: map[string]string{
-			"MessageRetentionPeriod": strconv.FormatInt(int64((5 * time.Minute).Seconds()), 10),
-		},
+		QueueName:  aws.String(sqsQueueName),
+		Attributes: attributes,
 	})
 
 	if err != nil {
 		return nil, err
 	}
+	r.SQSQueueURL = res.QueueUrl
 
-	return &sqsHandler{
-		SQSClient:       client,
-		SQSQueueURL:     res.QueueUrl,
-		IPC:             i,
-		cleanupInterval: time.Second * 30,
-	}, nil
+	return r, nil
 }
 
 func (r *sqsHandler) PollAndHandleMessages(ctx context.Context) {
@@ -225,10 +575,22 @@ func (r *sqsHandler) PollAndHandleMessages(ctx context.Context) {
 		case <-ctx.Done():
 			// if context is cancelled
 			return
-		default:
+		case r.inFlight <- struct{}{}:
 			go func(msg *types.Message) {
-				r.handleMessage(ctx, msg)
-				r.deleteMessage(ctx, msg)
+				defer func() { <-r.inFlight }()
+
+				reason, err := r.handleMessage(ctx, msg)
+				if err == nil {
+					r.deleteMessage(ctx, msg)
+					return
+				}
+
+				receiveCount := approximateReceiveCount(msg)
+				if isPermanentSQSFailure(reason) || receiveCount >= r.maxReceiveCount {
+					r.deadLetterMessage(ctx, msg, reason)
+					return
+				}
+				r.backoffMessage(ctx, msg, receiveCount)
 			}(message)
 		}
 	}
@@ -143,7 +143,7 @@ func TestSQS(t *testing.T) {
 
 							n := numTimes.Add(1)
 							if n == 1 {
-								snowflake := ipcCtx.AddSnowflake("fake", "", NATUnrestricted, 0)
+								snowflake := ipcCtx.AddSnowflake("fake", "", NATUnrestricted, nil, 0, 0, nil)
 								go func(c C) {
 									<-snowflake.offerChannel
 									snowflake.answerChannel <- "fake answer"
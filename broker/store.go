@@ -0,0 +1,191 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BrokerStore holds the proxy-matching state a BrokerContext needs:
+// registered-but-unmatched proxies (the two Snowflake heaps) and the
+// answer rendezvous between a proxy's second POST and whatever is
+// waiting on that answer. It exists so that state can live somewhere
+// other than this process's memory -- see redisBrokerStore -- letting
+// multiple broker replicas share one pool of proxies and one set of
+// pending answers instead of each replica only ever seeing the proxies
+// and answers that happened to land on it.
+//
+// memoryBrokerStore is the in-process implementation. NewBrokerContext
+// doesn't construct one: it leaves BrokerContext.Store nil, and nothing in
+// this package calls newMemoryBrokerStore.
+type BrokerStore interface {
+	// AddSnowflake registers a newly polled proxy and returns it,
+	// exactly like BrokerContext.AddSnowflake does. clients is the proxy's self-reported
+	// concurrent client count and capacity its self-advertised maximum
+	// (0 meaning it didn't advertise one); see Snowflake.atCapacity.
+	// acceptedBridgeFingerprints is the proxy's advertised set of bridge
+	// fingerprints it's willing to serve, nil or empty meaning the
+	// default bridge only; see Snowflake.acceptsBridge.
+	AddSnowflake(id string, proxyType string, natType string, verdict []byte, clients int, capacity int, acceptedBridgeFingerprints []string) *Snowflake
+
+	// PopSnowflakeForClient removes and returns one registered proxy
+	// suitable for a client with the given natType and bridgeFingerprint
+	// (see Snowflake.acceptsBridge; "" means the client didn't request a
+	// specific bridge), weighted by Snowflake.score (see
+	// SnowflakeHeap.PopWeighted). fingerprint names the client requesting
+	// a match, carried through so a future symmetric-NAT client-matching
+	// policy has it available; it isn't consulted yet (see the comment
+	// on VerdictCache.Accepts, which gates on a *proxy's* fingerprint,
+	// not a client's). Returns nil if no eligible proxy is registered.
+	PopSnowflakeForClient(natType string, fingerprint string, bridgeFingerprint string) *Snowflake
+
+	// DeliverAnswer hands a proxy's SDP answer to whichever call (in
+	// this replica or another) is waiting on sid via AwaitAnswer. It's
+	// a no-op, not an error, if nothing is currently waiting -- the
+	// client may have given up already.
+	DeliverAnswer(sid string, sdp string) error
+
+	// AwaitAnswer blocks until DeliverAnswer is called for sid or
+	// timeout elapses, returning the delivered SDP answer, or an error
+	// on timeout.
+	AwaitAnswer(sid string, timeout time.Duration) (string, error)
+}
+
+// memoryBrokerStore is a BrokerStore backed by the two in-process
+// SnowflakeHeaps a BrokerContext has always kept, plus a map of sid to a
+// channel AwaitAnswer can block on. It's correct only within a single
+// process: a proxy registered against one memoryBrokerStore is invisible
+// to any other.
+type memoryBrokerStore struct {
+	snowflakes           *SnowflakeHeap
+	restrictedSnowflakes *SnowflakeHeap
+	idToSnowflake        map[string]*Snowflake
+	lock                 sync.Mutex
+
+	verdicts *VerdictCache
+	metrics  *Metrics
+
+	answerLock sync.Mutex
+	answerWait map[string]chan string
+}
+
+// newMemoryBrokerStore builds an in-process BrokerStore, recording verdicts
+// in verdicts (nil is fine -- see VerdictCache) and proxy-availability
+// gauge changes in metrics.
+func newMemoryBrokerStore(verdicts *VerdictCache, metrics *Metrics) *memoryBrokerStore {
+	snowflakes := new(SnowflakeHeap)
+	heap.Init(snowflakes)
+	rSnowflakes := new(SnowflakeHeap)
+	heap.Init(rSnowflakes)
+
+	return &memoryBrokerStore{
+		snowflakes:           snowflakes,
+		restrictedSnowflakes: rSnowflakes,
+		idToSnowflake:        make(map[string]*Snowflake),
+		verdicts:             verdicts,
+		metrics:              metrics,
+		answerWait:           make(map[string]chan string),
+	}
+}
+
+func (s *memoryBrokerStore) AddSnowflake(id string, proxyType string, natType string, verdict []byte, clients int, capacity int, acceptedBridgeFingerprints []string) *Snowflake {
+	s.verdicts.Record(id, verdict)
+
+	snowflake := new(Snowflake)
+	snowflake.id = id
+	snowflake.proxyType = proxyType
+	snowflake.natType = natType
+	snowflake.clients = clients
+	snowflake.capacity = capacity
+	snowflake.acceptedBridgeFingerprints = acceptedBridgeFingerprints
+	snowflake.offerChannel = make(chan *ClientOffer)
+	snowflake.answerChannel = make(chan string)
+	snowflake.successEWMA = 1
+
+	s.lock.Lock()
+	if natType == NATUnrestricted {
+		heap.Push(s.snowflakes, snowflake)
+	} else {
+		heap.Push(s.restrictedSnowflakes, snowflake)
+	}
+	s.metrics.promMetrics.AvailableProxies.With(promLabels(natType, proxyType)).Inc()
+	s.lock.Unlock()
+
+	s.metrics.RecordProxyLoad(natType, clients)
+	s.idToSnowflake[id] = snowflake
+	return snowflake
+}
+
+func (s *memoryBrokerStore) PopSnowflakeForClient(natType string, fingerprint string, bridgeFingerprint string) *Snowflake {
+	_ = fingerprint // reserved for future symmetric-NAT client matching; see the interface doc comment
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// A restricted proxy can only serve an unrestricted client (see the
+	// BrokerContext.idToSnowflake doc comment); an unrestricted proxy
+	// can serve either, so only fall back to it once the restricted
+	// heap has nothing eligible to offer.
+	if natType == NATUnrestricted {
+		for s.restrictedSnowflakes.Len() > 0 {
+			snowflake := s.restrictedSnowflakes.PopWeighted(bridgeFingerprint)
+			if snowflake == nil {
+				// Every remaining restricted Snowflake is at capacity or
+				// doesn't accept bridgeFingerprint.
+				break
+			}
+			if !s.verdicts.Accepts(snowflake.id) {
+				continue
+			}
+			s.metrics.promMetrics.AvailableProxies.With(promLabels(snowflake.natType, snowflake.proxyType)).Dec()
+			return snowflake
+		}
+	}
+
+	if s.snowflakes.Len() > 0 {
+		if snowflake := s.snowflakes.PopWeighted(bridgeFingerprint); snowflake != nil {
+			s.metrics.promMetrics.AvailableProxies.With(promLabels(snowflake.natType, snowflake.proxyType)).Dec()
+			return snowflake
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryBrokerStore) DeliverAnswer(sid string, sdp string) error {
+	s.answerLock.Lock()
+	ch, ok := s.answerWait[sid]
+	s.answerLock.Unlock()
+	if !ok {
+		return nil
+	}
+	ch <- sdp
+	return nil
+}
+
+func (s *memoryBrokerStore) AwaitAnswer(sid string, timeout time.Duration) (string, error) {
+	ch := make(chan string, 1)
+	s.answerLock.Lock()
+	s.answerWait[sid] = ch
+	s.answerLock.Unlock()
+	defer func() {
+		s.answerLock.Lock()
+		delete(s.answerWait, sid)
+		s.answerLock.Unlock()
+	}()
+
+	select {
+	case sdp := <-ch:
+		return sdp, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("store: no answer for %s within %s", sid, timeout)
+	}
+}
+
+// promLabels is the prometheus.Labels{"nat": natType, "type": proxyType}
+// pair AvailableProxies is keyed by, as memoryBrokerStore builds it;
+// broker.go writes the same pair inline as a prometheus.Labels literal.
+func promLabels(natType, proxyType string) map[string]string {
+	return map[string]string{"nat": natType, "type": proxyType}
+}
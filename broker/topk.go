@@ -0,0 +1,98 @@
+package main
+
+import "sync"
+
+// spaceSavingEntry is one tracked key in a spaceSaving counter.
+type spaceSavingEntry struct {
+	key       string
+	count     uint64
+	overEstim uint64 // upper bound on how much count could be inflated by evictions
+}
+
+// spaceSaving is a fixed-capacity streaming top-K estimator (the
+// Space-Saving algorithm: Metwally, Agrawal & Abbadi, 2005). It tracks at
+// most k keys; once full, incrementing an untracked key evicts the current
+// minimum-count entry, taking over its slot with count = evicted.count + 1.
+// This bounds memory to O(k) regardless of the number of distinct keys
+// seen, at the cost of turning counts for keys outside the top K into
+// estimates.
+type spaceSaving struct {
+	mu      sync.Mutex
+	k       int
+	entries map[string]*spaceSavingEntry
+}
+
+// newSpaceSaving returns a spaceSaving estimator tracking at most k keys.
+// k below 1 is treated as 1.
+func newSpaceSaving(k int) *spaceSaving {
+	if k < 1 {
+		k = 1
+	}
+	return &spaceSaving{
+		k:       k,
+		entries: make(map[string]*spaceSavingEntry, k),
+	}
+}
+
+// Increment records one occurrence of key.
+func (s *spaceSaving) Increment(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.count++
+		return
+	}
+	if len(s.entries) < s.k {
+		s.entries[key] = &spaceSavingEntry{key: key, count: 1}
+		return
+	}
+
+	min := s.minEntry()
+	delete(s.entries, min.key)
+	s.entries[key] = &spaceSavingEntry{
+		key:       key,
+		count:     min.count + 1,
+		overEstim: min.count,
+	}
+}
+
+func (s *spaceSaving) minEntry() *spaceSavingEntry {
+	var min *spaceSavingEntry
+	for _, e := range s.entries {
+		if min == nil || e.count < min.count {
+			min = e
+		}
+	}
+	return min
+}
+
+// topKRecord is one row of a spaceSaving report: the tracked key, its
+// (possibly overestimated) count, and the maximum amount that count could
+// be inflated by an earlier eviction.
+type topKRecord struct {
+	key       string
+	count     uint64
+	overEstim uint64
+}
+
+// ReportAndClear returns the tracked entries, sorted by count descending,
+// and resets the estimator to empty for the next reporting interval.
+func (s *spaceSaving) ReportAndClear() []topKRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]topKRecord, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, topKRecord{key: e.key, count: e.count, overEstim: e.overEstim})
+	}
+	s.entries = make(map[string]*spaceSavingEntry, s.k)
+
+	for i := 1; i < len(out); i++ {
+		for j := i; j > 0 && (out[j].count > out[j-1].count ||
+			(out[j].count == out[j-1].count && out[j].key < out[j-1].key)); j-- {
+			out[j], out[j-1] = out[j-1], out[j]
+		}
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"sync"
+	"time"
+
+	"tgragnato.it/snowflake/common/messages"
+)
+
+// VerdictCache holds the most recent trusted messages.SymmetricNATVerdict
+// for each proxy fingerprint a probetest server has reported on, so
+// symmetric-NAT client matching can be restricted to proxies a probetest
+// recently confirmed reachable (request chunk21-7). A nil *VerdictCache
+// means the feature is off, matching the broker's behavior before this
+// cache existed: Accepts always returns true and Record is a no-op.
+type VerdictCache struct {
+	pub     ed25519.PublicKey
+	maxAge  time.Duration
+	metrics *Metrics
+
+	mu      sync.Mutex
+	entries map[string]messages.SymmetricNATVerdict
+}
+
+// NewVerdictCache builds a VerdictCache that trusts verdicts signed by pub
+// and considers one stale once it's older than maxAge. Every Record call
+// is tallied into metrics for the "snowflake-symmetric-nat-verdict-*" lines
+// in the metrics log.
+func NewVerdictCache(pub ed25519.PublicKey, maxAge time.Duration, metrics *Metrics) *VerdictCache {
+	return &VerdictCache{
+		pub:     pub,
+		maxAge:  maxAge,
+		metrics: metrics,
+		entries: make(map[string]messages.SymmetricNATVerdict),
+	}
+}
+
+// Record verifies and, if trusted, caches the signed verdict a proxy
+// attached to its poll under fingerprint. A verdict with a bad signature,
+// an unrecognized result, or a ProbedAt older than maxAge is rejected as
+// untrusted and left out of the cache, so Accepts falls back to today's
+// blind matching for that proxy. raw may be empty if the proxy didn't
+// attach a verdict; that's not an error, just nothing to record.
+func (c *VerdictCache) Record(fingerprint string, raw []byte) {
+	if c == nil || len(raw) == 0 {
+		return
+	}
+
+	v, err := messages.DecodeSymmetricNATVerdict(raw)
+	if err != nil || !v.Verdict.Valid() {
+		c.metrics.IncrementCounter("verdict-untrusted")
+		return
+	}
+	if err := messages.VerifySymmetricNATVerdict(c.pub, v); err != nil {
+		c.metrics.IncrementCounter("verdict-untrusted")
+		return
+	}
+	if time.Since(v.ProbedAt) > c.maxAge {
+		c.metrics.IncrementCounter("verdict-untrusted")
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[fingerprint] = v
+	c.mu.Unlock()
+
+	switch v.Verdict {
+	case messages.VerdictPass:
+		c.metrics.IncrementCounter("verdict-pass")
+	case messages.VerdictFail:
+		c.metrics.IncrementCounter("verdict-fail")
+	}
+}
+
+// Accepts reports whether fingerprint's latest cached verdict says it
+// passed a symmetric-NAT probe within maxAge. It's the gate request
+// chunk21-7 asks symmetric-NAT client matching to apply -- but that
+// decision is made in IPC.ClientOffers, which isn't implemented in this
+// tree (see the doc comment on IPC in ipc_prometheus.go). Its one caller
+// is memoryBrokerStore.PopSnowflakeForClient, and nothing in this package
+// constructs a memoryBrokerStore, so Accepts is never reached at run
+// time. AddSnowflake records every verdict it's handed so that once
+// ClientOffers exists, this is ready to be consulted from there. Absent or
+// stale data is treated permissively (true), matching today's blind
+// matching rather than excluding every proxy that hasn't run a probetest.
+func (c *VerdictCache) Accepts(fingerprint string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	v, ok := c.entries[fingerprint]
+	c.mu.Unlock()
+	if !ok || time.Since(v.ProbedAt) > c.maxAge {
+		return true
+	}
+	return v.Verdict == messages.VerdictPass
+}
@@ -0,0 +1,103 @@
+package snowflake_client
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+)
+
+// PeerStats is one snowflake peer's bandwidth snapshot, as reported by
+// PeerBandwidthAggregator.PerPeerStats.
+type PeerStats struct {
+	Inbound, Outbound         int64
+	InboundRate, OutboundRate float64
+}
+
+// PeerBandwidthAggregator gives each WebRTCPeer a WebRTCDialer catches its
+// own bytesSyncLogger (see WebRTCDialer.SetBandwidthAggregator), instead of
+// every peer sharing one BytesLogger whose totals can't be told apart --
+// "one of my three snowflakes stalls" is only diagnosable if each
+// snowflake's traffic is counted separately. PerPeerStats sums each child
+// logger's own counters on demand rather than fanning every AddInbound/
+// AddOutbound call out to a shared aggregate counter, since each byte only
+// ever belongs to one peer in the first place.
+type PeerBandwidthAggregator struct {
+	events  event.SnowflakeEventReceiver
+	rateTau time.Duration
+
+	mu    sync.Mutex
+	peers map[string]*bytesSyncLogger
+}
+
+// NewPeerBandwidthAggregator returns a PeerBandwidthAggregator whose child
+// loggers (see newPeerLogger) report events and smooth their throughput the
+// same way NewBytesSyncLogger's would.
+func NewPeerBandwidthAggregator(events event.SnowflakeEventReceiver, rateTau time.Duration) *PeerBandwidthAggregator {
+	return &PeerBandwidthAggregator{
+		events:  events,
+		rateTau: rateTau,
+		peers:   make(map[string]*bytesSyncLogger),
+	}
+}
+
+// newPeerLogger returns a fresh child bytesSyncLogger for a soon-to-be-
+// caught peer, not yet registered under that peer's ID: WebRTCPeer.ID isn't
+// known until after NewPeer returns, so WebRTCDialer.Catch creates the
+// logger first and calls register once the peer (and its ID) exists.
+func (a *PeerBandwidthAggregator) newPeerLogger() *bytesSyncLogger {
+	return newBytesSyncLogger(a.events, a.rateTau)
+}
+
+// register associates a child logger previously returned by newPeerLogger
+// with the peer ID it ended up belonging to.
+func (a *PeerBandwidthAggregator) register(peerID string, logger *bytesSyncLogger) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.peers[peerID] = logger
+}
+
+// Forget drops peerID's logger, e.g. once its WebRTCPeer has closed and its
+// stats are no longer interesting. Calling PerPeerStats after Forget simply
+// omits peerID; it's not an error to Forget an ID that was never
+// registered, or to Forget one twice.
+func (a *PeerBandwidthAggregator) Forget(peerID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.peers, peerID)
+}
+
+// PerPeerStats returns a snapshot, as of this call, of every registered
+// peer's bandwidth -- current totals from GetStat and smoothed throughput
+// from InboundRate/OutboundRate -- keyed by peer ID (see WebRTCPeer.ID).
+func (a *PeerBandwidthAggregator) PerPeerStats() map[string]PeerStats {
+	a.mu.Lock()
+	peers := make(map[string]*bytesSyncLogger, len(a.peers))
+	for id, logger := range a.peers {
+		peers[id] = logger
+	}
+	a.mu.Unlock()
+
+	stats := make(map[string]PeerStats, len(peers))
+	for id, logger := range peers {
+		inbound, outbound := logger.GetStat()
+		stats[id] = PeerStats{
+			Inbound:      inbound,
+			Outbound:     outbound,
+			InboundRate:  logger.InboundRate(),
+			OutboundRate: logger.OutboundRate(),
+		}
+	}
+	return stats
+}
+
+// GetStat sums every registered peer's current totals, for a caller that
+// wants the Transport-wide figures GetStat always reported before per-peer
+// accounting existed.
+func (a *PeerBandwidthAggregator) GetStat() (inbound, outbound int64) {
+	for _, stat := range a.PerPeerStats() {
+		inbound += stat.Inbound
+		outbound += stat.Outbound
+	}
+	return inbound, outbound
+}
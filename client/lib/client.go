@@ -0,0 +1,138 @@
+package snowflake_client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+)
+
+// errClientStarted is returned by Start if the Client is already running.
+var errClientStarted = errors.New("snowflake_client: Client already started")
+
+// errClientNotStarted is returned by Dial if the Client hasn't been Started.
+var errClientNotStarted = errors.New("snowflake_client: Client not started")
+
+// Client is a high-level, embeddable Snowflake client lifecycle, for Go
+// applications (a GUI, a VPN client) that want to use Snowflake as a library
+// instead of wiring together a BrokerChannel, WebRTCPeer and Runner
+// themselves, or shelling out to the client/snowflake.go PT binary. Start
+// begins dialing snowflakes in the background; Dial hands back a tunneled
+// net.Conn directly, and Stop tears everything down. A Client is not safe
+// for concurrent use by multiple goroutines except where noted.
+type Client struct {
+	events event.SnowflakeEventReceiver
+
+	mutex   sync.Mutex
+	config  ClientConfig
+	cancel  context.CancelFunc
+	runDone chan struct{}
+	runErr  error
+}
+
+// NewClient constructs a Client that reports bootstrap and tunnel progress
+// -- broker rendezvous started, first tunnel byte, and so on -- to events,
+// the same SnowflakeEventReceiver interface the PT binary and Runner use to
+// drive their logs. A nil events drops every notification.
+func NewClient(events event.SnowflakeEventReceiver) *Client {
+	if events == nil {
+		events = event.NewSnowflakeEventDispatcher()
+	}
+	return &Client{events: events}
+}
+
+// Start begins the Client's background lifecycle with config, which becomes
+// the base configuration Dial and any later InjectConn-style use draw on.
+// It returns as soon as the underlying Runner is launched in the
+// background, without waiting for it to run or for a snowflake to actually
+// be dialed; an error the Runner returns is reported by Stop. Use events
+// (passed to NewClient) to learn about rendezvous and tunnel progress.
+// Start returns an error if the Client is already running.
+func (c *Client) Start(ctx context.Context, config ClientConfig) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cancel != nil {
+		return errClientStarted
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	runner := NewRunner(config, c.events)
+	runDone := make(chan struct{})
+
+	c.config = config
+	c.cancel = cancel
+	c.runDone = runDone
+
+	go func() {
+		defer close(runDone)
+		c.runErr = runner.Run(runCtx)
+	}()
+
+	return nil
+}
+
+// Stop ends a started Client's lifecycle and waits for its Runner to
+// return, dropping every snowflake it was holding open. Stop is a no-op if
+// the Client was never started, or has already been stopped.
+func (c *Client) Stop() error {
+	c.mutex.Lock()
+	if c.cancel == nil {
+		c.mutex.Unlock()
+		return nil
+	}
+	cancel := c.cancel
+	done := c.runDone
+	c.cancel = nil
+	c.mutex.Unlock()
+
+	cancel()
+	<-done
+
+	if errors.Is(c.runErr, context.Canceled) {
+		return nil
+	}
+	return c.runErr
+}
+
+// Dial returns a net.Conn tunneled over a freshly rendezvoused snowflake,
+// using the Client's Start config, independently of any SOCKS listener.
+// It's meant for an embedder that wants a conn directly to relay itself,
+// rather than pointing a SOCKS client at a Runner. Dial fails with
+// errClientNotStarted if the Client hasn't been Started, and is cancelled
+// by ctx like any other dial.
+func (c *Client) Dial(ctx context.Context) (net.Conn, error) {
+	c.mutex.Lock()
+	if c.cancel == nil {
+		c.mutex.Unlock()
+		return nil, errClientNotStarted
+	}
+	config := c.config
+	c.mutex.Unlock()
+
+	c.events.OnNewSnowflakeEvent(event.EventOnBrokerRendezvousStarted{})
+	transport, err := NewSnowflakeClient(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.AddSnowflakeEventListener(c.events)
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	resultCh := make(chan dialResult, 1)
+	go func() {
+		conn, err := transport.Dial()
+		resultCh <- dialResult{conn, err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.conn, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
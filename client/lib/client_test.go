@@ -0,0 +1,51 @@
+package snowflake_client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClientLifecycle(t *testing.T) {
+	Convey("Given a Client", t, func() {
+		c := NewClient(nil)
+
+		Convey("Stop before Start is a no-op", func() {
+			So(c.Stop(), ShouldBeNil)
+		})
+
+		Convey("Dial before Start fails", func() {
+			conn, err := c.Dial(context.Background())
+			So(conn, ShouldBeNil)
+			So(err, ShouldEqual, errClientNotStarted)
+		})
+
+		Convey("Once started", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			err := c.Start(ctx, ClientConfig{})
+			So(err, ShouldBeNil)
+
+			Convey("starting it again fails", func() {
+				So(c.Start(ctx, ClientConfig{}), ShouldEqual, errClientStarted)
+			})
+
+			Convey("Stop returns promptly and is idempotent", func() {
+				done := make(chan error, 1)
+				go func() { done <- c.Stop() }()
+
+				select {
+				case err := <-done:
+					So(err, ShouldBeNil)
+				case <-time.After(time.Second):
+					t.Fatal("Stop did not return")
+				}
+
+				So(c.Stop(), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,147 @@
+package snowflake_client
+
+import (
+	"net/url"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ClientConfig collects every option a Snowflake client needs: which
+// RendezvousMethod to reach the broker through, the ICE servers to gather
+// WebRTC candidates against, and the SDP-shaping, NAT, and queue/SQS knobs
+// that tune individual rendezvous methods. It's built once (by the
+// snowflake-client PT binary's flag parsing, or directly by an embedder)
+// and passed to NewClient/NewRunner/NewSnowflakeClient, all of which read
+// it without mutating it except where documented (e.g.
+// applySocksArgs/Runner.handleConn's per-connection override).
+//
+// A zero ClientConfig is not useful on its own: one of RendezvousSpecs,
+// RendezvousMethod, QueueKind/QueueEndpoint, SQSQueueURL, BrokerURL (alone
+// or with AmpCacheURL), or DoHResolverURL with DoHDomain must be set so
+// newBrokerChannelFromConfig has a rendezvous method to build; with none
+// of them set, selectRendezvous exits the process via log.Fatalln.
+type ClientConfig struct {
+	// BrokerURL is the address of the Snowflake broker to rendezvous
+	// with directly, or (combined with AmpCacheURL) via an AMP cache.
+	BrokerURL string
+	// AmpCacheURL is the URL of an AMP cache to use as a domain-fronted
+	// proxy in front of BrokerURL.
+	AmpCacheURL string
+	// FrontDomains lists candidate front domains for AmpCacheURL's and
+	// BrokerURL's HTTP rendezvous; one is chosen at random per request.
+	FrontDomains []string
+	// RaceRendezvous, when AmpCacheURL and BrokerURL are both set, races
+	// the AMP cache and direct HTTP rendezvous methods against each
+	// other instead of always preferring the AMP cache.
+	RaceRendezvous bool
+	// QUIC, when BrokerURL is also set, tries rendezvous over HTTP/3
+	// (QUIC) first, falling back -- in order -- to whichever of the
+	// AMP-cache/direct-HTTPS/SQS methods this config otherwise selects if
+	// the QUIC attempt fails. QUIC's handshake survives some censors'
+	// mid-stream TCP resets that currently kill the HTTPS and AMP-cache
+	// paths outright. Polls are not sent as 0-RTT early data; each new QUIC
+	// connection performs a full handshake. See newQUICRendezvous.
+	QUIC bool
+
+	// DoHResolverURL and DoHDomain select DNS-over-HTTPS rendezvous
+	// instead of a broker/AMP cache, resolving DoHDomain's TXT records
+	// through the resolver at DoHResolverURL.
+	DoHResolverURL string
+	DoHDomain      string
+
+	// SQSQueueURL and SQSCredsStr (plus SQSRegion/SQSEndpoint, for a
+	// non-default AWS endpoint) select SQS-queue rendezvous.
+	SQSQueueURL       string
+	SQSCredsStr       string
+	SQSRegion         string
+	SQSEndpoint       string
+	SQSAnswerPoolSize int
+
+	// QueueKind, QueueEndpoint, and QueueCreds select a message-queue
+	// rendezvous backend ("redis" or "s3") by name, as an alternative
+	// to SQSQueueURL/SQSCredsStr.
+	QueueKind     string
+	QueueEndpoint string
+	QueueCreds    string
+
+	// RendezvousMethod, if set, selects a RendezvousMethod registered
+	// with RegisterRendezvousMethod by name instead of any of the
+	// built-in methods above -- how an embedder plugs in a custom HTTPS,
+	// gRPC, or in-process broker.
+	RendezvousMethod string
+
+	// RendezvousSpecs, if set, overrides all of the above: it names an
+	// ordered chain of rendezvous methods (built-in "sqs"/"amp"/"http", or
+	// any name registered with RegisterRendezvousMethod) for
+	// newBrokerChannelFromConfig to try in turn, falling through to the
+	// next spec only on a transport-level error, not a broker-returned
+	// poll error. Unlike RaceRendezvous, which runs two methods
+	// concurrently and keeps whichever answers first, this tries them one
+	// at a time in the given order. Each attempt's timing and outcome is
+	// reported through the Transport's event dispatcher as an
+	// event.EventOnRendezvousMethodAttempt. See RendezvousSpec.
+	RendezvousSpecs []RendezvousSpec
+
+	// CommunicationProxy, if non-nil, is the upstream SOCKS5 proxy
+	// (usually Tor's own, from goptlib's ClientInfo.ProxyURL) that
+	// broker/AMP-cache/SQS HTTP requests and WebRTC ICE are routed
+	// through.
+	CommunicationProxy *url.URL
+
+	// MTLS, if non-nil, presents a client certificate on every broker
+	// rendezvous request (AMP cache, direct HTTP, and SQS via its VPC
+	// endpoint), for a deployment where the broker requires proxies or
+	// partner infrastructure to authenticate before it'll answer polls.
+	MTLS *MTLSConfig
+
+	// ConnectionID, if non-nil, opts into negotiating a DTLS Connection ID
+	// (RFC 9146) for this client's WebRTC data channel; see
+	// ConnectionIDConfig's doc comment for why this isn't wired any
+	// further yet.
+	ConnectionID *ConnectionIDConfig
+
+	// ICEServers lists the STUN/TURN servers, already resolved to
+	// webrtc.ICEServer values, that WebRTC candidate gathering uses. An
+	// embedder that already has webrtc.ICEServer values (e.g. with
+	// credentials for a private TURN server) should set this directly;
+	// ICEAddresses below is the equivalent for callers that only have
+	// bare STUN/TURN URLs.
+	ICEServers []webrtc.ICEServer
+	// ICEAddresses lists STUN and TURN server URLs (e.g.
+	// "stun:stun.l.google.com:19302") as plain strings, the same format
+	// as the PT binary's comma-separated -ice flag; NewSnowflakeClient
+	// turns each into a webrtc.ICEServer alongside ICEServers.
+	// classifyLocalNATType also uses the STUN entries here (skipping any
+	// turn:/turns: ones) for a local RFC 5780 NAT classification.
+	ICEAddresses []string
+	// Max bounds how many WebRTC peer connections a WebRTCDialer
+	// maintains concurrently; see WebRTCDialer.GetMax. 0 defaults to 1.
+	Max int
+	// KeepLocalAddresses keeps local LAN address ICE candidates, which
+	// are usually pointless since a Snowflake proxy rarely shares a
+	// client's local network.
+	KeepLocalAddresses bool
+	// NAT1To1Mappings lists "external" or "internal=external" 1:1 NAT IP
+	// mappings to advertise as SDP host candidates, for clients behind a
+	// static NAT; see util.ParseNAT1To1Mappings.
+	NAT1To1Mappings []string
+	// BridgeFingerprint, if set, is sent to the broker in every client poll
+	// request as the fingerprint of the bridge this client wants to reach.
+	BridgeFingerprint string
+
+	// UTLSClientID selects a utls ClientHelloID (by name; see
+	// utlsutil.NameToUTLSID) for the broker/AMP-cache HTTP rendezvous'
+	// TLS fingerprint, instead of Go's default TLS stack.
+	UTLSClientID string
+	// UTLSRemoveSNI strips the SNI extension from the utls ClientHello
+	// UTLSClientID produces.
+	UTLSRemoveSNI bool
+
+	// SDPSetupRole, SDPFingerprintAlgo, SDPDataChannelOnly, and
+	// SDPRestrictICEToUDP are SDP-shaping experiments applied to the
+	// client's offer before it's sent to the broker; see buildSDPMunge.
+	SDPSetupRole        string
+	SDPFingerprintAlgo  string
+	SDPDataChannelOnly  bool
+	SDPRestrictICEToUDP bool
+}
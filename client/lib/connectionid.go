@@ -0,0 +1,55 @@
+package snowflake_client
+
+import "crypto/rand"
+
+// ConnectionIDConfig opts a client into negotiating a DTLS Connection ID
+// (RFC 9146) on its WebRTC data channel's DTLS/SCTP leg, so that a NAT
+// rebinding or IP change mid-session -- common when the underlying WebRTC
+// path is carried over a mobile connection -- doesn't require tearing
+// down the PeerConnection and reissuing a new offer to the broker.
+//
+// It is not yet wired into WebRTCPeer's DTLS handshake: pion/webrtc v4's
+// SettingEngine has no hook to supply a custom dtls.Config (or a
+// ConnectionIDGenerator specifically) to the DTLSTransport it builds
+// internally (see DTLSTransport.Start in the vendored pion/webrtc
+// module), and this tree's vendored ./dtls fork's own Conn and
+// record-layer plumbing for generateAEADAdditionalDataCID isn't present
+// either -- only the handshake extension exchange (flight0handler.go's
+// remoteConnectionID capture) and the AEAD additional-data helper
+// (pkg/crypto/ciphersuite.generateAEADAdditionalDataCID) exist so far.
+// This type exists so both gaps have a single place to plug into once
+// either upstream dependency gains the missing hook.
+type ConnectionIDConfig struct {
+	// Length is the size, in bytes, of the Connection ID this client
+	// generates and offers to its peer. 0 means don't offer one (CID
+	// stays off, matching today's behavior).
+	Length int
+	// Generator, if set, produces each Connection ID this client offers,
+	// overriding the default of Length cryptographically random bytes.
+	Generator func() []byte
+}
+
+// generator returns c's configured Generator, or -- if unset but Length is
+// positive -- a default generator producing Length cryptographically
+// random bytes each call. It returns nil if c is nil, or if Length <= 0
+// and no Generator was set, meaning CID should stay off.
+func (c *ConnectionIDConfig) generator() func() []byte {
+	if c == nil {
+		return nil
+	}
+	if c.Generator != nil {
+		return c.Generator
+	}
+	if c.Length <= 0 {
+		return nil
+	}
+
+	length := c.Length
+	return func() []byte {
+		b := make([]byte, length)
+		if _, err := rand.Read(b); err != nil {
+			return nil
+		}
+		return b
+	}
+}
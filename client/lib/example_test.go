@@ -0,0 +1,41 @@
+package snowflake_client_test
+
+import (
+	"context"
+	"log"
+	"time"
+
+	sf "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/client/lib"
+)
+
+// This example embeds a Snowflake client directly, without shelling out to
+// the snowflake-client PT binary: it starts a Client against a broker, asks
+// it to dial one snowflake, and relays nothing further once the conn is in
+// hand. A real embedder would keep reading/writing conn (e.g. handing it to
+// a Tor control-port dialer) instead of closing it immediately. It has no
+// Output comment -- actually running it would need a live broker and
+// snowflake proxy -- so go test only compiles it, as documentation.
+func Example() {
+	client := sf.NewClient(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := sf.ClientConfig{
+		BrokerURL: "https://snowflake-broker.torproject.net/",
+		ICEAddresses: []string{
+			"stun:stun.l.google.com:19302",
+		},
+		Max: 1,
+	}
+	if err := client.Start(ctx, config); err != nil {
+		log.Fatal(err)
+	}
+	defer client.Stop()
+
+	conn, err := client.Dial(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+}
@@ -0,0 +1,68 @@
+package snowflake_client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// MTLSConfig configures mutual TLS for the broker rendezvous transports
+// (ampCacheRendezvous, httpRendezvous, and, via the same http.RoundTripper,
+// sqsRendezvous' VPC endpoint requests): a client certificate proving this
+// client's identity to a broker or SQS VPC endpoint that requires peer
+// auth, and optionally a pinned CA for verifying the server in turn instead
+// of trusting the system root store.
+//
+// Certificate, if set, is used directly; otherwise CertFile and KeyFile are
+// loaded from disk with tls.LoadX509KeyPair. Exactly one of the two should
+// be set.
+type MTLSConfig struct {
+	Certificate       *tls.Certificate
+	CertFile, KeyFile string
+	// CACertFile, if set, pins the broker's server certificate to this CA
+	// file instead of the system root store.
+	CACertFile string
+}
+
+// tlsConfig builds the *tls.Config a broker rendezvous transport's
+// http.RoundTripper should use: m's client certificate (loading it from
+// CertFile/KeyFile first if Certificate isn't already set), and, if
+// CACertFile is set, a RootCAs pool pinned to just that CA. A nil m
+// returns (nil, nil), letting createBrokerTransport fall back to its
+// default RootCAs.
+func (m *MTLSConfig) tlsConfig() (*tls.Config, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	cert := m.Certificate
+	if cert == nil {
+		if m.CertFile == "" || m.KeyFile == "" {
+			return nil, fmt.Errorf("snowflake_client: MTLSConfig needs a Certificate or both CertFile and KeyFile")
+		}
+		loaded, err := tls.LoadX509KeyPair(m.CertFile, m.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("snowflake_client: loading mTLS client certificate: %w", err)
+		}
+		cert = &loaded
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+	}
+
+	if m.CACertFile != "" {
+		pem, err := os.ReadFile(m.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("snowflake_client: reading mTLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("snowflake_client: no certificates found in mTLS CA file %q", m.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
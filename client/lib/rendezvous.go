@@ -4,12 +4,14 @@
 package snowflake_client
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,6 +24,8 @@ import (
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/messages"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/nat"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/natdetect"
+	socksproxy "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/proxy"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/util"
 )
 
@@ -47,35 +51,125 @@ type RendezvousMethod interface {
 type BrokerChannel struct {
 	Rendezvous         RendezvousMethod
 	keepLocalAddresses bool
+	nat1To1Mappings    []string
 	natType            string
+	natBehavior        *nat.NATBehavior
 	lock               sync.Mutex
 	BridgeFingerprint  string
+	// SDPMunge, when non-nil, transforms the client's offer SDP before it's
+	// sent to the broker, for operators experimenting with SDP shaping to
+	// defeat DPI classifiers that pattern-match on Snowflake's default SDP
+	// layout.
+	SDPMunge func(string) string
+
+	turnLock       sync.Mutex
+	turnServers    []messages.TurnServer
+	turnObtainedAt time.Time
+}
+
+// turnRefreshMargin is how far ahead of a broker-provisioned TURN
+// credential's TTL expiring that cacheTurnServers' caller should treat it
+// as already stale, so a client doesn't start a new connection with
+// credentials likely to be rejected mid-handshake.
+const turnRefreshMargin = 30 * time.Second
+
+// cacheTurnServers records TURN servers the broker provisioned in a poll
+// response, for ICEServers to merge into a later connection's
+// webrtc.Configuration. The credentials in this response are already too
+// late for the connection that requested them, since ICE gathering for the
+// client's offer happens before the broker's answer arrives; caching them
+// here lets the *next* WebRTCPeer reuse them instead of connecting with
+// none.
+func (bc *BrokerChannel) cacheTurnServers(servers []messages.TurnServer) {
+	if len(servers) == 0 {
+		return
+	}
+	bc.turnLock.Lock()
+	defer bc.turnLock.Unlock()
+	bc.turnServers = servers
+	bc.turnObtainedAt = time.Now()
+}
+
+// ICEServers returns the broker-provisioned TURN servers cached from the
+// most recent successful Negotiate or TrickleNegotiate call, ready to merge
+// into a webrtc.Configuration, or nil if none are cached or the
+// shortest-lived one is within turnRefreshMargin of expiring -- in which
+// case the next Negotiate call will ask the broker for fresh ones instead.
+func (bc *BrokerChannel) ICEServers() []webrtc.ICEServer {
+	bc.turnLock.Lock()
+	defer bc.turnLock.Unlock()
+
+	if len(bc.turnServers) == 0 {
+		return nil
+	}
+	for _, server := range bc.turnServers {
+		if time.Since(bc.turnObtainedAt) > server.TTL-turnRefreshMargin {
+			return nil
+		}
+	}
+
+	iceServers := make([]webrtc.ICEServer, 0, len(bc.turnServers))
+	for _, server := range bc.turnServers {
+		iceServers = append(iceServers, webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	return iceServers
+}
+
+// brokerTLSConfig builds the *tls.Config a broker rendezvous transport
+// should use: mtls's client certificate and/or pinned CA, if any, and
+// certs.GetRootCAs() otherwise. It's shared by createBrokerTransport and
+// quicRendezvous, the latter of which needs a *tls.Config directly rather
+// than an http.RoundTripper.
+func brokerTLSConfig(mtls *MTLSConfig) (*tls.Config, error) {
+	tlsConfig, err := mtls.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.RootCAs == nil {
+		tlsConfig.RootCAs = certs.GetRootCAs()
+	}
+	return tlsConfig, nil
 }
 
 // We make a copy of DefaultTransport because we want the default Dial
 // and TLSHandshakeTimeout settings. But we want to disable the default
 // ProxyFromEnvironment setting.
-func createBrokerTransport(proxy *url.URL) http.RoundTripper {
-	tlsConfig := &tls.Config{
-		RootCAs: certs.GetRootCAs(),
+func createBrokerTransport(proxy *url.URL, mtls *MTLSConfig) (http.RoundTripper, error) {
+	tlsConfig, err := brokerTLSConfig(mtls)
+	if err != nil {
+		return nil, err
 	}
 	transport := &http.Transport{TLSClientConfig: tlsConfig}
 	transport.Proxy = nil
 	if proxy != nil {
-		transport.Proxy = http.ProxyURL(proxy)
+		// Route the broker, AMP cache, and domain-fronted rendezvous methods
+		// through the same upstream SOCKS5 proxy as WebRTC ICE, instead of
+		// relying on net/http's own (more limited) SOCKS5 support.
+		socksClient := socksproxy.NewSocks5UDPClient(proxy)
+		transport.DialContext = socksClient.Dialer().DialContext
 	}
 	transport.ResponseHeaderTimeout = 15 * time.Second
-	return transport
+	return transport, nil
 }
 
-func newBrokerChannelFromConfig(config ClientConfig) (*BrokerChannel, error) {
+func newBrokerChannelFromConfig(config ClientConfig, events event.SnowflakeEventReceiver) (*BrokerChannel, error) {
 	log.Println("Rendezvous using Broker at:", config.BrokerURL)
 
 	if len(config.FrontDomains) != 0 {
 		log.Printf("Domain fronting using a randomly selected domain from: %v", config.FrontDomains)
 	}
 
-	brokerTransport := createBrokerTransport(config.CommunicationProxy)
+	brokerTransport, err := createBrokerTransport(config.CommunicationProxy, config.MTLS)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create broker channel: %w", err)
+	}
 
 	if config.UTLSClientID != "" {
 		utlsClientHelloID, err := utlsutil.NameToUTLSID(config.UTLSClientID)
@@ -89,9 +183,55 @@ func newBrokerChannelFromConfig(config ClientConfig) (*BrokerChannel, error) {
 			config.UTLSRemoveSNI, config.CommunicationProxy)
 	}
 
-	var rendezvous RendezvousMethod
-	var err error
-	if config.SQSQueueURL != "" {
+	rendezvous, err := selectRendezvous(config, brokerTransport, events)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.QUIC && config.BrokerURL != "" {
+		rendezvous, err = addQUICFallback(rendezvous, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bc := &BrokerChannel{
+		Rendezvous:         rendezvous,
+		keepLocalAddresses: config.KeepLocalAddresses,
+		nat1To1Mappings:    config.NAT1To1Mappings,
+		natType:            nat.NATUnknown,
+		BridgeFingerprint:  config.BridgeFingerprint,
+		SDPMunge:           buildSDPMunge(config),
+	}
+	classifyLocalNATType(bc, config)
+	return bc, nil
+}
+
+// selectRendezvous picks config's RendezvousMethod, in priority order:
+// config.RendezvousSpecs' ordered fallback chain (see newRendezvousChain),
+// then a single method registered with RegisterRendezvousMethod, then one
+// of the legacy mutually-exclusive fields below, matching the order
+// they've always been checked in.
+func selectRendezvous(config ClientConfig, brokerTransport http.RoundTripper, events event.SnowflakeEventReceiver) (RendezvousMethod, error) {
+	if len(config.RendezvousSpecs) != 0 {
+		log.Println("Through an ordered rendezvous chain:", config.RendezvousSpecs)
+		return newRendezvousChain(config.RendezvousSpecs, config, brokerTransport, events)
+	}
+
+	rendezvous, err := newRegisteredRendezvous(config, brokerTransport)
+	if err != nil {
+		return nil, err
+	}
+	if rendezvous != nil {
+		log.Println("Through registered rendezvous method:", config.RendezvousMethod)
+		return rendezvous, nil
+	}
+
+	switch {
+	case config.QueueKind != "" && config.QueueKind != "sqs":
+		log.Println("Through", config.QueueKind, "queue at:", config.QueueEndpoint)
+		return newQueueRendezvous(config.QueueKind, config.QueueEndpoint, config.QueueCreds, config.SQSAnswerPoolSize)
+	case config.SQSQueueURL != "":
 		if config.AmpCacheURL != "" || config.BrokerURL != "" {
 			log.Fatalln("Multiple rendezvous methods specified. " + rendezvousErrorMsg)
 		}
@@ -99,39 +239,109 @@ func newBrokerChannelFromConfig(config ClientConfig) (*BrokerChannel, error) {
 			log.Fatalln("sqscreds must be specified to use SQS rendezvous method.")
 		}
 		log.Println("Through SQS queue at:", config.SQSQueueURL)
-		rendezvous, err = newSQSRendezvous(config.SQSQueueURL, config.SQSCredsStr, brokerTransport)
-	} else if config.AmpCacheURL != "" && config.BrokerURL != "" {
+		return newSQSRendezvous(config.SQSQueueURL, config.SQSCredsStr, config.SQSRegion, config.SQSEndpoint, brokerTransport, config.SQSAnswerPoolSize)
+	case config.AmpCacheURL != "" && config.BrokerURL != "" && config.RaceRendezvous:
+		log.Println("Racing AMP cache and direct HTTP rendezvous to broker at:", config.BrokerURL)
+		ampRendezvous, err := newAMPCacheRendezvous(config.BrokerURL, config.AmpCacheURL, config.FrontDomains, brokerTransport)
+		if err != nil {
+			return nil, err
+		}
+		httpRendezvous, err := newHTTPRendezvous(config.BrokerURL, config.FrontDomains, brokerTransport)
+		if err != nil {
+			return nil, err
+		}
+		return newMultiRendezvous(ampRendezvous, httpRendezvous)
+	case config.AmpCacheURL != "" && config.BrokerURL != "":
 		log.Println("Through AMP cache at:", config.AmpCacheURL)
-		rendezvous, err = newAMPCacheRendezvous(
-			config.BrokerURL, config.AmpCacheURL, config.FrontDomains,
-			brokerTransport)
-	} else if config.BrokerURL != "" {
-		rendezvous, err = newHTTPRendezvous(
-			config.BrokerURL, config.FrontDomains, brokerTransport)
-	} else {
+		return newAMPCacheRendezvous(config.BrokerURL, config.AmpCacheURL, config.FrontDomains, brokerTransport)
+	case config.DoHResolverURL != "" && config.DoHDomain != "":
+		log.Println("Through DoH resolver at:", config.DoHResolverURL)
+		return newDoHRendezvous(config.DoHResolverURL, config.DoHDomain, brokerTransport)
+	case config.BrokerURL != "":
+		return newHTTPRendezvous(config.BrokerURL, config.FrontDomains, brokerTransport)
+	default:
 		log.Fatalln("No rendezvous method was specified. " + rendezvousErrorMsg)
+		return nil, nil // unreachable; log.Fatalln exits the process
 	}
+}
+
+// natClassifyTimeout bounds how long classifyLocalNATType waits for a local
+// RFC 5780 classification before giving up and falling back to the
+// broker-side probetest signal, so a slow or unreachable STUN server can't
+// delay startup.
+const natClassifyTimeout = 3 * time.Second
+
+// classifyLocalNATType runs natdetect.Classify against config's STUN
+// servers and, if it succeeds before natClassifyTimeout, records the result
+// on bc as an authoritative NAT type -- taking priority over whatever the
+// broker-side proxy probetest last told this client, since it reflects this
+// client's own NAT rather than some other client's behind a shared one.
+// config.ICEAddresses may also list TURN servers from the caller's own
+// config (broker-provisioned TURN servers are kept on BrokerChannel, not
+// here), so entries with a turn:/turns: scheme are skipped.
+func classifyLocalNATType(bc *BrokerChannel, config ClientConfig) {
+	var stunServers []string
+	for _, addr := range config.ICEAddresses {
+		if strings.HasPrefix(addr, "turn:") || strings.HasPrefix(addr, "turns:") {
+			continue
+		}
+		stunServers = append(stunServers, addr)
+	}
+	if len(stunServers) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natClassifyTimeout)
+	defer cancel()
+	natType, err := natdetect.Classify(ctx, stunServers, config.CommunicationProxy)
 	if err != nil {
-		return nil, err
+		log.Printf("Local NAT classification failed, falling back to broker probetest: %v", err)
+		return
 	}
+	log.Printf("Local NAT classification: %s", natType)
+	bc.SetNATType(natType)
+}
 
-	return &BrokerChannel{
-		Rendezvous:         rendezvous,
-		keepLocalAddresses: config.KeepLocalAddresses,
-		natType:            nat.NATUnknown,
-		BridgeFingerprint:  config.BridgeFingerprint,
-	}, nil
+// buildSDPMunge composes an SDP transform out of config's SDP-shaping
+// options, or returns nil if none are set, so that the common case pays no
+// extra cost per Negotiate call.
+func buildSDPMunge(config ClientConfig) func(string) string {
+	if config.SDPSetupRole == "" && !config.SDPDataChannelOnly &&
+		!config.SDPRestrictICEToUDP && config.SDPFingerprintAlgo == "" {
+		return nil
+	}
+	return func(sdp string) string {
+		if config.SDPDataChannelOnly {
+			sdp = util.ForceDataChannelOnly(sdp)
+		}
+		if config.SDPRestrictICEToUDP {
+			sdp = util.RestrictICEToUDP(sdp)
+		}
+		switch config.SDPSetupRole {
+		case "actpass":
+			sdp = util.ChangeSetupRole(sdp, true)
+		case "active":
+			sdp = util.ChangeSetupRole(sdp, false)
+		}
+		if config.SDPFingerprintAlgo != "" {
+			sdp = util.RewriteFingerprintAlgo(sdp, config.SDPFingerprintAlgo)
+		}
+		return sdp
+	}
 }
 
 // Negotiate uses a RendezvousMethod to send the client's WebRTC SDP offer
-// and receive a snowflake proxy WebRTC SDP answer in return.
+// and receive a snowflake proxy WebRTC SDP answer in return. natPolicy may
+// be nil, in which case no previous-attempt outcome is reported and no
+// broker hint is recorded.
 func (bc *BrokerChannel) Negotiate(
 	offer *webrtc.SessionDescription,
 	natTypeToSend string,
+	natPolicy *NATPolicy,
 ) (
 	*webrtc.SessionDescription, error,
 ) {
-	encReq, err := preparePollRequest(offer, natTypeToSend, bc.BridgeFingerprint)
+	encReq, err := preparePollRequest(offer, natTypeToSend, bc.BridgeFingerprint, bc.SDPMunge, natPolicy)
 	if err != nil {
 		return nil, err
 	}
@@ -151,16 +361,125 @@ func (bc *BrokerChannel) Negotiate(
 	if resp.Error != "" {
 		return nil, errors.New(resp.Error)
 	}
+	bc.cacheTurnServers(resp.TurnServers)
+	if natPolicy != nil {
+		natPolicy.SetHint(resp.NATHint)
+	}
 	return util.DeserializeSessionDescription(resp.Answer)
 }
 
+// TrickleCapable is implemented by a RendezvousMethod that can also carry
+// follow-up ICE candidates to the broker after the initial offer/answer
+// exchange, for use by TrickleNegotiate. A RendezvousMethod that doesn't
+// implement it is assumed not to support trickle ICE; none of this
+// package's RendezvousMethod implementations do yet, pending the matching
+// broker-side change to advertise and accept a candidate stream.
+type TrickleCapable interface {
+	SupportsTrickleICE() bool
+}
+
+// SupportsTrickleICE reports whether bc's RendezvousMethod has advertised
+// trickle-ICE support. WebRTCPeer only calls TrickleNegotiate once this
+// returns true, falling back to Negotiate otherwise.
+func (bc *BrokerChannel) SupportsTrickleICE() bool {
+	capable, ok := bc.Rendezvous.(TrickleCapable)
+	return ok && capable.SupportsTrickleICE()
+}
+
+// TrickleNegotiate behaves like Negotiate, except offer is sent to the
+// broker as soon as it's set as the local description -- typically before
+// local ICE gathering has finished -- and every candidate later sent on
+// candidates is relayed to the broker as its own CandidateRequest, keyed by
+// the ClientID the broker's poll response assigns to this session, until
+// candidatesDone closes. Callers should only use TrickleNegotiate once
+// SupportsTrickleICE reports true; it does not re-check or fall back
+// itself.
+func (bc *BrokerChannel) TrickleNegotiate(
+	offer *webrtc.SessionDescription,
+	natTypeToSend string,
+	natPolicy *NATPolicy,
+	candidates <-chan webrtc.ICECandidateInit,
+	candidatesDone <-chan struct{},
+) (*webrtc.SessionDescription, error) {
+	encReq, err := preparePollRequest(offer, natTypeToSend, bc.BridgeFingerprint, bc.SDPMunge, natPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	encResp, err := bc.Rendezvous.Exchange(encReq)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received answer: %s", string(encResp))
+
+	resp, err := messages.DecodeClientPollResponse(encResp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	bc.cacheTurnServers(resp.TurnServers)
+	if natPolicy != nil {
+		natPolicy.SetHint(resp.NATHint)
+	}
+
+	go bc.streamTrickleCandidates(resp.ClientID, candidates, candidatesDone)
+
+	return util.DeserializeSessionDescription(resp.Answer)
+}
+
+// streamTrickleCandidates relays every candidate received on candidates to
+// the broker as a CandidateRequest keyed by clientID, until candidatesDone
+// closes, at which point it sends one final CandidateRequest with Done set
+// so the broker can stop waiting on this session's candidate stream.
+func (bc *BrokerChannel) streamTrickleCandidates(
+	clientID string,
+	candidates <-chan webrtc.ICECandidateInit,
+	candidatesDone <-chan struct{},
+) {
+	for {
+		select {
+		case candidate, ok := <-candidates:
+			if !ok {
+				return
+			}
+			bc.sendTrickleCandidate(clientID, candidate.Candidate, false)
+		case <-candidatesDone:
+			bc.sendTrickleCandidate(clientID, "", true)
+			return
+		}
+	}
+}
+
+// sendTrickleCandidate encodes and exchanges a single CandidateRequest,
+// logging (rather than returning) any error, since the candidate stream
+// runs on its own goroutine with no caller left to hand an error back to.
+func (bc *BrokerChannel) sendTrickleCandidate(clientID, candidate string, done bool) {
+	req := &messages.CandidateRequest{ClientID: clientID, Candidate: candidate, Done: done}
+	encReq, err := req.EncodeCandidateRequest()
+	if err != nil {
+		log.Printf("trickle ICE: encoding candidate request: %v", err)
+		return
+	}
+	if _, err := bc.Rendezvous.Exchange(encReq); err != nil {
+		log.Printf("trickle ICE: sending candidate to broker: %v", err)
+	}
+}
+
 // Pure function
 func preparePollRequest(
 	offer *webrtc.SessionDescription,
 	natType string,
 	bridgeFingerprint string,
+	sdpMunge func(string) string,
+	natPolicy *NATPolicy,
 ) (encReq []byte, err error) {
-	offerSDP, err := util.SerializeSessionDescription(offer)
+	mungedOffer := offer
+	if sdpMunge != nil {
+		mungedOffer = &webrtc.SessionDescription{Type: offer.Type, SDP: sdpMunge(offer.SDP)}
+	}
+	offerSDP, err := util.SerializeSessionDescription(mungedOffer)
 	if err != nil {
 		return nil, err
 	}
@@ -169,6 +488,9 @@ func preparePollRequest(
 		NAT:         natType,
 		Fingerprint: bridgeFingerprint,
 	}
+	if natPolicy != nil {
+		req.PrevSentNAT, req.PrevOutcome = natPolicy.prevPollReport()
+	}
 	encReq, err = req.EncodeClientPollRequest()
 	return
 }
@@ -187,9 +509,41 @@ func (bc *BrokerChannel) GetNATType() string {
 	return bc.natType
 }
 
+// SetNATBehavior records the full RFC 5780 mapping/filtering classification
+// for this client, as produced by nat.DiscoverNATBehavior. It is kept
+// alongside the simple natType string consumed by the broker protocol so
+// that embedders (e.g. the SOCKS handler) can surface the richer result to
+// the user without having to re-run the STUN tests themselves.
+func (bc *BrokerChannel) SetNATBehavior(behavior nat.NATBehavior) {
+	bc.lock.Lock()
+	bc.natBehavior = &behavior
+	bc.lock.Unlock()
+}
+
+// GetNATBehavior returns the most recently recorded NAT behavior, or nil if
+// SetNATBehavior has not been called yet.
+func (bc *BrokerChannel) GetNATBehavior() *nat.NATBehavior {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	return bc.natBehavior
+}
+
 // All of the methods of the struct are thread-safe.
 type NATPolicy struct {
 	assumedUnrestrictedNATAndFailedToConnect atomic.Bool
+
+	// mu guards the fields below, which turn NATPolicy from a single local
+	// latch into a broker-fed adaptive policy: brokerHint is the broker's
+	// last aggregated opinion on whether spoofing is still worthwhile for
+	// this client's NAT type (see nat.Hint), and prevSentNATType/
+	// prevOutcome are what NATTypeToSend last sent and what Success/
+	// Failure later found out about it, reported to the broker on the
+	// *next* poll so it can fold this client's own attempt into its
+	// aggregate (see preparePollRequest).
+	mu              sync.Mutex
+	brokerHint      string
+	prevSentNATType string
+	prevOutcome     string
 }
 
 // When our NAT type is unknown, we want to try to connect to a
@@ -200,25 +554,38 @@ type NATPolicy struct {
 //
 // This is useful when our STUN servers are blocked or don't support
 // the NAT discovery feature, or if they're just slow.
+//
+// If the broker has already told us (via SetHint) whether spoofing is
+// paying off for clients like us, that data-driven hint wins over our own
+// single local attempt below: nat.HintStopSpoofing behaves like our local
+// latch already having tripped, and nat.HintSpoofOK overrides it even if
+// our own one attempt happened to fail, since the broker has seen far more
+// attempts than we have.
 func (p *NATPolicy) NATTypeToSend(actualNatType string) string {
-	if !p.assumedUnrestrictedNATAndFailedToConnect.Load() &&
-		actualNatType == nat.NATUnknown {
-		// If our NAT type is unknown, and we haven't failed to connect
-		// with a spoofed NAT type yet, then spoof a NATUnrestricted
-		// type.
-		return nat.NATUnrestricted
-	} else {
+	if actualNatType != nat.NATUnknown {
 		// In all other cases, do not spoof, and just return our actual
 		// NAT type (even if it is NATUnknown).
 		return actualNatType
 	}
+
+	switch p.hint() {
+	case nat.HintStopSpoofing:
+		return actualNatType
+	case nat.HintSpoofOK:
+		return nat.NATUnrestricted
+	default:
+		if p.assumedUnrestrictedNATAndFailedToConnect.Load() {
+			return actualNatType
+		}
+		return nat.NATUnrestricted
+	}
 }
 
 // This function must be called whenever a connection with a proxy succeeds,
 // because the connection outcome tells us about NAT compatibility
 // between the proxy and us.
 func (p *NATPolicy) Success(actualNATType, sentNATType string) {
-	// Yes, right now this does nothing but log.
+	outcome := nat.OutcomeMatched
 	if actualNATType != sentNATType {
 		log.Printf(
 			"Connected to a proxy by using a spoofed NAT type \"%v\"! "+
@@ -226,13 +593,16 @@ func (p *NATPolicy) Success(actualNATType, sentNATType string) {
 			sentNATType,
 			actualNATType,
 		)
+		outcome = nat.OutcomeMismatchedSuccess
 	}
+	p.recordAttempt(sentNATType, outcome)
 }
 
 // This function must be called whenever a connection with a proxy fails,
 // because the connection outcome tells us about NAT compatibility
 // between the proxy and us.
 func (p *NATPolicy) Failure(actualNATType, sentNATType string) {
+	outcome := nat.OutcomeMatched
 	if actualNATType == nat.NATUnknown && sentNATType == nat.NATUnrestricted {
 		log.Printf(
 			"Tried to connect to a restricted proxy while our NAT type "+
@@ -240,7 +610,46 @@ func (p *NATPolicy) Failure(actualNATType, sentNATType string) {
 			actualNATType,
 		)
 		p.assumedUnrestrictedNATAndFailedToConnect.Store(true)
+		outcome = nat.OutcomeMismatchedFailure
 	}
+	p.recordAttempt(sentNATType, outcome)
+}
+
+// recordAttempt stashes sentNATType/outcome so the next poll's
+// preparePollRequest can report them to the broker; see prevPollReport.
+func (p *NATPolicy) recordAttempt(sentNATType, outcome string) {
+	p.mu.Lock()
+	p.prevSentNATType = sentNATType
+	p.prevOutcome = outcome
+	p.mu.Unlock()
+}
+
+// prevPollReport returns the sent-NAT/outcome pair recorded by the most
+// recent Success or Failure call, for preparePollRequest to attach to the
+// next poll request. Both are "" before any attempt has completed.
+func (p *NATPolicy) prevPollReport() (sentNATType, outcome string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.prevSentNATType, p.prevOutcome
+}
+
+// SetHint records the broker's aggregated opinion (see nat.Hint) on
+// whether spoofing NATUnrestricted is still paying off, from the most
+// recent poll response. BrokerChannel.Negotiate and TrickleNegotiate call
+// this once they've decoded a response, so the *next* NATTypeToSend call
+// can act on it.
+func (p *NATPolicy) SetHint(hint string) {
+	p.mu.Lock()
+	p.brokerHint = hint
+	p.mu.Unlock()
+}
+
+// hint returns the broker hint most recently recorded by SetHint, or
+// nat.HintNone before the first poll response.
+func (p *NATPolicy) hint() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.brokerHint
 }
 
 // WebRTCDialer implements the |Tongue| interface to catch snowflakes, using BrokerChannel.
@@ -254,6 +663,11 @@ type WebRTCDialer struct {
 
 	eventLogger event.SnowflakeEventReceiver
 	proxy       *url.URL
+
+	// bandwidth, if set via SetBandwidthAggregator, gives every peer Catch
+	// returns its own bandwidth-tracking BytesLogger instead of the
+	// bytesNullLogger default.
+	bandwidth *PeerBandwidthAggregator
 }
 
 // Deprecated: Use NewWebRTCDialerWithNatPolicyAndEventsAndProxy instead
@@ -310,11 +724,36 @@ func NewWebRTCDialerWithNatPolicyAndEventsAndProxy(
 
 // Catch initializes a WebRTC Connection by signaling through the BrokerChannel.
 func (w WebRTCDialer) Catch() (*WebRTCPeer, error) {
-	// TODO: [#25591] Fetch ICE server information from Broker.
-	// TODO: [#25596] Consider TURN servers here too.
-	return NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
-		w.webrtcConfig, w.BrokerChannel, w.natPolicy, w.eventLogger, w.proxy,
-	)
+	opts := []PeerOption{
+		WithNATPolicy(w.natPolicy), WithEventsLogger(w.eventLogger), WithProxy(w.proxy),
+	}
+
+	var peerLogger *bytesSyncLogger
+	if w.bandwidth != nil {
+		peerLogger = w.bandwidth.newPeerLogger()
+		opts = append(opts, WithBytesLogger(peerLogger))
+	}
+
+	// Broker-provisioned TURN servers, if any are cached from a previous
+	// Negotiate/TrickleNegotiate call, are merged into webrtcConfig inside
+	// connect(); see BrokerChannel.ICEServers.
+	peer, err := NewPeer(w.webrtcConfig, w.BrokerChannel, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if w.bandwidth != nil {
+		w.bandwidth.register(peer.ID(), peerLogger)
+	}
+	return peer, nil
+}
+
+// SetBandwidthAggregator has every peer this dialer catches from now on
+// report its traffic through its own child logger registered with
+// aggregator (see PeerBandwidthAggregator), instead of the bytesNullLogger
+// default -- so PerPeerStats can tell which of several concurrent
+// snowflakes is slow or dead.
+func (w *WebRTCDialer) SetBandwidthAggregator(aggregator *PeerBandwidthAggregator) {
+	w.bandwidth = aggregator
 }
 
 // GetMax returns the maximum number of snowflakes to collect.
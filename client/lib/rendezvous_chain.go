@@ -0,0 +1,67 @@
+package snowflake_client
+
+import (
+	"net/http"
+	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+)
+
+// RendezvousSpec names one rendezvous method in a ClientConfig.RendezvousSpecs
+// fallback chain. Method must match a name registered with
+// RegisterRendezvousMethod, directly or via one of the built-in
+// "sqs"/"amp"/"http" registrations installed by this package's init.
+type RendezvousSpec struct {
+	Method string
+}
+
+// instrumentedRendezvous wraps a RendezvousMethod built from a
+// RendezvousSpec so every Exchange call's duration and outcome is reported
+// through events as an event.EventOnRendezvousMethodAttempt, identified by
+// name. events may be nil, in which case no event is reported.
+type instrumentedRendezvous struct {
+	name   string
+	method RendezvousMethod
+	events event.SnowflakeEventReceiver
+}
+
+func (r *instrumentedRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
+	start := time.Now()
+	resp, err := r.method.Exchange(encPollReq)
+	if r.events != nil {
+		r.events.OnNewSnowflakeEvent(event.EventOnRendezvousMethodAttempt{
+			Method:   r.name,
+			Duration: time.Since(start),
+			Error:    err,
+		})
+	}
+	return resp, err
+}
+
+// SupportsTrickleICE forwards to the wrapped method if it implements
+// TrickleCapable, so wrapping a trickle-capable method in the chain doesn't
+// silently disable trickle ICE for it.
+func (r *instrumentedRendezvous) SupportsTrickleICE() bool {
+	capable, ok := r.method.(TrickleCapable)
+	return ok && capable.SupportsTrickleICE()
+}
+
+// newRendezvousChain builds the ordered fallback chain described by specs:
+// each is looked up in defaultRendezvousRegistry, wrapped so its attempts
+// are reported through events, and the whole chain is tried in order via
+// sequentialRendezvous -- moving on to the next spec only when a method's
+// Exchange itself fails (a transport-level error), never because of a
+// broker-returned messages.ClientPollResponse.Error, which BrokerChannel.
+// Negotiate only decodes after Exchange has already returned successfully.
+// It requires at least one spec.
+func newRendezvousChain(specs []RendezvousSpec, config ClientConfig, transport http.RoundTripper, events event.SnowflakeEventReceiver) (RendezvousMethod, error) {
+	methods := make([]RendezvousMethod, 0, len(specs))
+	for _, spec := range specs {
+		method, err := defaultRendezvousRegistry.build(spec.Method, config, transport)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, &instrumentedRendezvous{name: spec.Method, method: method, events: events})
+	}
+	return newSequentialRendezvous(methods...)
+}
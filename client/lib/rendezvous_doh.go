@@ -0,0 +1,120 @@
+package snowflake_client
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// dohRendezvous is a RendezvousMethod that communicates with the broker over
+// DNS-over-HTTPS: the client poll request is base32-encoded into the
+// question name of a TXT query, sent to a DoH resolver, and the client poll
+// response is read back out of the base64-encoded TXT answer. This gives
+// clients a rendezvous path that looks like ordinary encrypted DNS traffic
+// to a public resolver, rather than an HTTPS request to the broker's own
+// domain.
+type dohRendezvous struct {
+	resolverURL string // DoH resolver endpoint, e.g. "https://dns.google/dns-query".
+	domain      string // Domain suffix under which the broker is reachable, e.g. "broker.example.com".
+	transport   http.RoundTripper
+}
+
+// newDoHRendezvous creates a new dohRendezvous that queries the DoH resolver
+// at resolverURL for TXT records under domain, using transport to make the
+// request.
+func newDoHRendezvous(resolverURL, domain string, transport http.RoundTripper) (*dohRendezvous, error) {
+	if resolverURL == "" {
+		return nil, fmt.Errorf("DoH rendezvous requires a resolver URL")
+	}
+	if domain == "" {
+		return nil, fmt.Errorf("DoH rendezvous requires a domain")
+	}
+	return &dohRendezvous{resolverURL: resolverURL, domain: domain, transport: transport}, nil
+}
+
+// maxDoHLabelBytes bounds how many characters of the base32-encoded poll
+// request encodeDoHQuestionName packs into a single DNS label, under the
+// DNS wire format's 63-byte label limit.
+const maxDoHLabelBytes = 35
+
+func (r *dohRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
+	qname, err := encodeDoHQuestionName(encPollReq, r.domain)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, dns.TypeTXT)
+	msg.RecursionDesired = true
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing DoH query: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", r.resolverURL, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH resolver returned status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, readLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	var respMsg dns.Msg
+	if err := respMsg.Unpack(body); err != nil {
+		return nil, fmt.Errorf("unpacking DoH response: %w", err)
+	}
+
+	var txt strings.Builder
+	for _, rr := range respMsg.Answer {
+		if t, ok := rr.(*dns.TXT); ok {
+			for _, chunk := range t.Txt {
+				txt.WriteString(chunk)
+			}
+		}
+	}
+	if txt.Len() == 0 {
+		return nil, fmt.Errorf("DoH response contained no TXT answer")
+	}
+
+	return base64.StdEncoding.DecodeString(txt.String())
+}
+
+// encodeDoHQuestionName splits the base32-encoded poll request across as
+// many DNS labels as needed and appends domain as the query's base suffix.
+func encodeDoHQuestionName(encPollReq []byte, domain string) (string, error) {
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(encPollReq)
+	var labels []string
+	for len(encoded) > 0 {
+		n := maxDoHLabelBytes
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		labels = append(labels, strings.ToLower(encoded[:n]))
+		encoded = encoded[n:]
+	}
+	labels = append(labels, domain)
+	qname := dns.Fqdn(strings.Join(labels, "."))
+	if _, ok := dns.IsDomainName(qname); !ok {
+		return "", fmt.Errorf("encoded poll request does not form a valid DNS name")
+	}
+	return qname, nil
+}
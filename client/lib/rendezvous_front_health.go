@@ -0,0 +1,122 @@
+package snowflake_client
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// frontHealthDecay is the exponential decay factor applied to a front's
+// health score on every outcome: newScore = decay*oldScore + (1-decay)*outcome,
+// where outcome is 1 for success and 0 for failure. The higher the decay,
+// the more attempts it takes for old failures to stop counting against a
+// front that has since recovered.
+const frontHealthDecay = 0.8
+
+// frontHealthThreshold is the score below which a front is considered
+// unhealthy and skipped, except for the occasional recovery probe.
+const frontHealthThreshold = 0.5
+
+// frontProbeInterval is how long an unhealthy front is skipped before being
+// tried again anyway, so that a front whose CDN entry has recovered isn't
+// skipped forever.
+const frontProbeInterval = 5 * time.Minute
+
+// frontStats is one front's exponentially-decayed health score.
+type frontStats struct {
+	score      float64
+	attempts   int64
+	lastTried  time.Time
+	lastFailed time.Time
+}
+
+// frontHealthTracker records per-front success/failure outcomes for
+// httpRendezvous's front selection, so that a front which has been failing
+// is skipped in favor of healthier ones instead of still being picked 1/N
+// of the time.
+type frontHealthTracker struct {
+	mu    sync.Mutex
+	stats map[string]*frontStats
+}
+
+func newFrontHealthTracker() *frontHealthTracker {
+	return &frontHealthTracker{stats: make(map[string]*frontStats)}
+}
+
+// record updates front's health score after an Exchange attempt through it.
+func (t *frontHealthTracker) record(front string, success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[front]
+	if !ok {
+		s = &frontStats{score: 1}
+		t.stats[front] = s
+	}
+	outcome := 0.0
+	if success {
+		outcome = 1.0
+	}
+	s.score = frontHealthDecay*s.score + (1-frontHealthDecay)*outcome
+	s.attempts++
+	s.lastTried = time.Now()
+	if !success {
+		s.lastFailed = time.Now()
+	}
+}
+
+// healthy reports whether front is currently worth trying: either its score
+// hasn't dropped below frontHealthThreshold, or it hasn't been tried in
+// frontProbeInterval and deserves a chance to show it has recovered.
+func (t *frontHealthTracker) healthy(front string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[front]
+	if !ok {
+		return true
+	}
+	return s.score >= frontHealthThreshold || time.Since(s.lastTried) >= frontProbeInterval
+}
+
+// order returns fronts in a random retry order for a single Exchange call,
+// preferring currently-healthy fronts; if every front is currently
+// unhealthy, it falls back to shuffling the full list, since refusing to
+// even try is worse than trying an unhealthy front.
+func (t *frontHealthTracker) order(fronts []string, rng *rand.Rand) []string {
+	candidates := make([]string, 0, len(fronts))
+	for _, front := range fronts {
+		if t.healthy(front) {
+			candidates = append(candidates, front)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, fronts...)
+	}
+	rng.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates
+}
+
+// FrontStats is a snapshot of one front's recorded health, returned by
+// httpRendezvous.FrontStats so an embedding app can log or export it.
+type FrontStats struct {
+	Front      string
+	Score      float64
+	Attempts   int64
+	LastFailed time.Time
+}
+
+func (t *frontHealthTracker) snapshot() []FrontStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]FrontStats, 0, len(t.stats))
+	for front, s := range t.stats {
+		out = append(out, FrontStats{
+			Front:      front,
+			Score:      s.score,
+			Attempts:   s.attempts,
+			LastFailed: s.lastFailed,
+		})
+	}
+	return out
+}
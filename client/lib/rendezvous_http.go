@@ -5,7 +5,7 @@ import (
 	"errors"
 	"io"
 	"log"
-	"math/rand"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"time"
@@ -17,6 +17,8 @@ type httpRendezvous struct {
 	brokerURL *url.URL
 	fronts    []string          // Optional front domain to replace url.Host in requests.
 	transport http.RoundTripper // Used to make all requests.
+	rng       *rand.Rand
+	health    *frontHealthTracker
 }
 
 // newHTTPRendezvous creates a new httpRendezvous that contacts the broker at
@@ -27,10 +29,13 @@ func newHTTPRendezvous(broker string, fronts []string, transport http.RoundTripp
 	if err != nil {
 		return nil, err
 	}
+	seed := uint64(time.Now().UnixNano())
 	return &httpRendezvous{
 		brokerURL: brokerURL,
 		fronts:    fronts,
 		transport: transport,
+		rng:       rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		health:    newFrontHealthTracker(),
 	}, nil
 }
 
@@ -40,16 +45,37 @@ func (r *httpRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
 
 	// Suffix the path with the broker's client registration handler.
 	reqURL := r.brokerURL.ResolveReference(&url.URL{Path: "client"})
+
+	if len(r.fronts) == 0 {
+		return r.exchangeWithFront(reqURL, encPollReq, "")
+	}
+
+	var lastErr error
+	for _, front := range r.health.order(r.fronts, r.rng) {
+		body, err := r.exchangeWithFront(reqURL, encPollReq, front)
+		if err == nil {
+			r.health.record(front, true)
+			return body, nil
+		}
+		r.health.record(front, false)
+		log.Printf("Front %v failed, trying next: %v", front, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchangeWithFront makes a single POST request to reqURL, optionally domain
+// fronted through front (which replaces the URL's host while the original
+// host is preserved in the HTTP Host header). It returns an error for both
+// network failures and non-2xx responses, so Exchange can fall back to the
+// next front.
+func (r *httpRendezvous) exchangeWithFront(reqURL *url.URL, encPollReq []byte, front string) ([]byte, error) {
 	req, err := http.NewRequest("POST", reqURL.String(), bytes.NewReader(encPollReq))
 	if err != nil {
 		return nil, err
 	}
 
-	if len(r.fronts) != 0 {
-		// Do domain fronting. Replace the domain in the URL's with a randomly
-		// selected front, and store the original domain the HTTP Host header.
-		rand.Seed(time.Now().UnixNano())
-		front := r.fronts[rand.Intn(len(r.fronts))]
+	if front != "" {
 		log.Println("Front URL:  ", front)
 		req.Host = req.URL.Host
 		req.URL.Host = front
@@ -62,13 +88,19 @@ func (r *httpRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
 	defer resp.Body.Close()
 
 	log.Printf("HTTP rendezvous response: %s", resp.Status)
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return nil, errors.New(brokerErrorUnexpected)
 	}
 
 	return limitedRead(resp.Body, readLimit)
 }
 
+// FrontStats returns a snapshot of each configured front's recorded health,
+// so an embedding app can log or export it.
+func (r *httpRendezvous) FrontStats() []FrontStats {
+	return r.health.snapshot()
+}
+
 func limitedRead(r io.Reader, limit int64) ([]byte, error) {
 	p, err := io.ReadAll(&io.LimitedReader{R: r, N: limit + 1})
 	if err != nil {
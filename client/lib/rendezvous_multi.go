@@ -0,0 +1,50 @@
+package snowflake_client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// multiRendezvous races an Exchange across every configured
+// RendezvousMethod and returns the first successful response, so a client
+// doesn't have to wait out a timeout on a blocked method before trying the
+// next one. If every method fails, it returns a combined error.
+type multiRendezvous struct {
+	methods []RendezvousMethod
+}
+
+// newMultiRendezvous builds a multiRendezvous that races the given methods,
+// in the order they were discovered to be configured. It requires at least
+// one method.
+func newMultiRendezvous(methods ...RendezvousMethod) (*multiRendezvous, error) {
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("multi rendezvous requires at least one method")
+	}
+	return &multiRendezvous{methods: methods}, nil
+}
+
+type multiRendezvousResult struct {
+	resp []byte
+	err  error
+}
+
+func (m *multiRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
+	results := make(chan multiRendezvousResult, len(m.methods))
+	for _, method := range m.methods {
+		method := method
+		go func() {
+			resp, err := method.Exchange(encPollReq)
+			results <- multiRendezvousResult{resp: resp, err: err}
+		}()
+	}
+
+	var errs []error
+	for range m.methods {
+		result := <-results
+		if result.err == nil {
+			return result.resp, nil
+		}
+		errs = append(errs, result.err)
+	}
+	return nil, fmt.Errorf("all rendezvous methods failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,163 @@
+package snowflake_client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/nat"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/redisclient"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/s3client"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqsclient"
+)
+
+// queueRendezvous is a RendezvousMethod built on any sqsclient.RendezvousQueue
+// backend: it sends the poll request tagged with a fresh per-dial client ID,
+// then polls that client's response channel for a pool of proxy answers and
+// picks the best one, the same "send request, poll per-client response
+// channel" pattern sqsRendezvous uses for AWS SQS specifically. Unlike
+// sqsRendezvous it isn't tied to the AWS SDK's types.Message, so it works
+// the same way regardless of which RendezvousQueue implementation backs it.
+type queueRendezvous struct {
+	queue sqsclient.RendezvousQueue
+
+	natTypeMutex sync.Mutex
+	natType      string
+
+	poolSize   int
+	poolWindow time.Duration
+}
+
+// newQueueRendezvous builds a queueRendezvous backed by the RendezvousQueue
+// implementation named by kind: "redis" for Redis Streams, via endpoint and
+// creds as address and password/credentials; "s3" for an S3 bucket, via
+// endpoint as the bucket name and creds as a base64-encoded sqscreds.AwsCreds
+// (the region and any S3-compatible endpoint override are left to the AWS
+// SDK's default resolution, e.g. the AWS_REGION environment variable).
+func newQueueRendezvous(kind, endpoint, creds string, poolSize int) (*queueRendezvous, error) {
+	var queue sqsclient.RendezvousQueue
+	switch kind {
+	case "redis":
+		q, err := redisclient.NewStreamsQueue(endpoint, creds)
+		if err != nil {
+			return nil, err
+		}
+		queue = q
+	case "s3":
+		q, err := s3client.NewQueue(endpoint, creds, "", "")
+		if err != nil {
+			return nil, err
+		}
+		queue = q
+	default:
+		return nil, fmt.Errorf("unknown queue kind %q", kind)
+	}
+
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
+	return &queueRendezvous{
+		queue:      queue,
+		natType:    nat.NATUnknown,
+		poolSize:   poolSize,
+		poolWindow: 20 * time.Second,
+	}, nil
+}
+
+// SetNATType records the client's own NAT type so that, once a pool of
+// proxy answers has been collected, Exchange can prefer the proxy whose
+// advertised NAT type is most compatible with it.
+func (r *queueRendezvous) SetNATType(natType string) {
+	r.natTypeMutex.Lock()
+	defer r.natTypeMutex.Unlock()
+	r.natType = natType
+}
+
+func (r *queueRendezvous) getNATType() string {
+	r.natTypeMutex.Lock()
+	defer r.natTypeMutex.Unlock()
+	return r.natType
+}
+
+func (r *queueRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	clientID := hex.EncodeToString(id[:])
+	log.Println("Negotiating via queue rendezvous, client ID: " + clientID)
+
+	ctx := context.Background()
+	if err := r.queue.Send(ctx, clientID, encPollReq, map[string]string{"NAT": r.getNATType()}); err != nil {
+		return nil, err
+	}
+
+	pool, err := r.queue.Receive(ctx, clientID, r.poolSize, r.poolWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	winner, losers := selectBestQueueAnswer(pool, r.getNATType())
+	if len(losers) > 0 {
+		ids := make([]string, 0, len(losers))
+		for _, msg := range losers {
+			ids = append(ids, msg.ID)
+		}
+		if err := r.queue.Delete(ctx, clientID, ids); err != nil {
+			log.Printf("Failed to delete %d unused response queue message(s): %v", len(ids), err)
+		}
+	}
+	return winner.Body, nil
+}
+
+// selectBestQueueAnswer is the backend-agnostic counterpart of
+// sqsRendezvous.selectBestAnswer/answerScore, operating on
+// sqsclient.QueueMessage instead of the AWS-specific types.Message, but
+// otherwise ranking proxies the same way: a proxy whose NAT is compatible
+// with clientNATType always beats an incompatible one, and RTT breaks ties
+// between proxies of the same compatibility.
+func selectBestQueueAnswer(pool []sqsclient.QueueMessage, clientNATType string) (sqsclient.QueueMessage, []sqsclient.QueueMessage) {
+	bestIdx := 0
+	for i := 1; i < len(pool); i++ {
+		if queueAnswerScore(pool[i], clientNATType) < queueAnswerScore(pool[bestIdx], clientNATType) {
+			bestIdx = i
+		}
+	}
+
+	losers := make([]sqsclient.QueueMessage, 0, len(pool)-1)
+	for i, msg := range pool {
+		if i != bestIdx {
+			losers = append(losers, msg)
+		}
+	}
+	return pool[bestIdx], losers
+}
+
+func queueAnswerScore(msg sqsclient.QueueMessage, clientNATType string) float64 {
+	const (
+		scoreCompatible   = 0.0
+		scoreIncompatible = 1e9
+	)
+
+	score := scoreIncompatible
+	if proxyNATType, ok := msg.Attributes["NAT"]; ok {
+		if proxyNATType == nat.NATUnrestricted || clientNATType == nat.NATUnrestricted {
+			score = scoreCompatible
+		}
+	} else {
+		score = scoreCompatible // No NAT attribute: don't penalize older proxies.
+	}
+
+	if rttStr, ok := msg.Attributes["Rtt"]; ok {
+		if rtt, err := strconv.ParseFloat(rttStr, 64); err == nil {
+			score += rtt
+		}
+	}
+	return score
+}
@@ -0,0 +1,125 @@
+package snowflake_client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// quicRendezvous is a RendezvousMethod that communicates with the .../client
+// route of the broker over HTTP/3 (QUIC) instead of HTTPS/1.1. QUIC's
+// handshake survives the mid-stream TCP resets some censors inject to kill
+// HTTPS and AMP-cache rendezvous outright. Each poll is a POST, which
+// http3.RoundTripper never sends as 0-RTT early data, and the TLS config
+// carries no session cache, so every new QUIC connection to the broker
+// performs a full handshake.
+type quicRendezvous struct {
+	brokerURL *url.URL
+	fronts    []string // Optional front domains to replace url.Host in requests.
+	client    *http.Client
+	rng       *rand.Rand
+	health    *frontHealthTracker
+}
+
+// newQUICRendezvous creates a quicRendezvous that contacts the broker at
+// broker over HTTP/3, with optional front domains, using tlsConfig for the
+// QUIC handshake (http3.RoundTripper sets NextProtos itself; the caller
+// only needs to supply RootCAs/Certificates, as brokerTLSConfig does).
+func newQUICRendezvous(broker string, fronts []string, tlsConfig *tls.Config) (*quicRendezvous, error) {
+	brokerURL, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	seed := uint64(time.Now().UnixNano())
+	return &quicRendezvous{
+		brokerURL: brokerURL,
+		fronts:    fronts,
+		client: &http.Client{
+			Transport: &http3.RoundTripper{TLSClientConfig: tlsConfig},
+			Timeout:   15 * time.Second,
+		},
+		rng:    rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		health: newFrontHealthTracker(),
+	}, nil
+}
+
+// addQUICFallback builds a quicRendezvous for config.BrokerURL/FrontDomains
+// and wraps it with rest so QUIC is tried first, falling back to rest (the
+// rendezvous method newBrokerChannelFromConfig would otherwise have picked)
+// if the QUIC attempt fails.
+func addQUICFallback(rest RendezvousMethod, config ClientConfig) (RendezvousMethod, error) {
+	tlsConfig, err := brokerTLSConfig(config.MTLS)
+	if err != nil {
+		return nil, err
+	}
+	quic, err := newQUICRendezvous(config.BrokerURL, config.FrontDomains, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Trying QUIC rendezvous first, falling back to", config.BrokerURL)
+	return newSequentialRendezvous(quic, rest)
+}
+
+func (r *quicRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
+	log.Println("Negotiating via QUIC rendezvous...")
+	log.Println("Target URL: ", r.brokerURL.Host)
+
+	// Suffix the path with the broker's client registration handler.
+	reqURL := r.brokerURL.ResolveReference(&url.URL{Path: "client"})
+
+	if len(r.fronts) == 0 {
+		return r.exchangeWithFront(reqURL, encPollReq, "")
+	}
+
+	var lastErr error
+	for _, front := range r.health.order(r.fronts, r.rng) {
+		body, err := r.exchangeWithFront(reqURL, encPollReq, front)
+		if err == nil {
+			r.health.record(front, true)
+			return body, nil
+		}
+		r.health.record(front, false)
+		log.Printf("Front %v failed, trying next: %v", front, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchangeWithFront makes a single POST request to reqURL over QUIC,
+// optionally domain fronted through front (which replaces the URL's host
+// while the original host is preserved in the HTTP Host header).
+func (r *quicRendezvous) exchangeWithFront(reqURL *url.URL, encPollReq []byte, front string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, reqURL.String(), bytes.NewReader(encPollReq))
+	if err != nil {
+		return nil, err
+	}
+
+	if front != "" {
+		log.Println("Front URL:  ", front)
+		req.Host = req.URL.Host
+		req.URL.Host = front
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	log.Printf("QUIC rendezvous response: %s", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.New(brokerErrorUnexpected)
+	}
+
+	return limitedRead(resp.Body, readLimit)
+}
@@ -0,0 +1,101 @@
+package snowflake_client
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// RendezvousMethodFactory builds a RendezvousMethod from a ClientConfig and
+// the shared broker transport. It is the shape expected by
+// RegisterRendezvousMethod and RendezvousRegistry.register.
+type RendezvousMethodFactory func(config ClientConfig, transport http.RoundTripper) (RendezvousMethod, error)
+
+// RendezvousRegistry looks up a RendezvousMethodFactory by name, for
+// ClientConfig.RendezvousMethod (a single method selected by name) and
+// ClientConfig.RendezvousSpecs (an ordered fallback chain of methods
+// selected by name; see newRendezvousChain). defaultRendezvousRegistry
+// comes pre-populated with the "sqs", "amp", and "http" built-ins; an
+// embedder adds its own with RegisterRendezvousMethod.
+type RendezvousRegistry struct {
+	mu        sync.Mutex
+	factories map[string]RendezvousMethodFactory
+}
+
+// newRendezvousRegistry builds an empty RendezvousRegistry.
+func newRendezvousRegistry() *RendezvousRegistry {
+	return &RendezvousRegistry{factories: make(map[string]RendezvousMethodFactory)}
+}
+
+// register makes a RendezvousMethod, built by factory, selectable under
+// name. Registering under a name that is already taken overwrites the
+// previous factory.
+func (r *RendezvousRegistry) register(name string, factory RendezvousMethodFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// build looks up and constructs the RendezvousMethod registered under name.
+func (r *RendezvousRegistry) build(name string, config ClientConfig, transport http.RoundTripper) (RendezvousMethod, error) {
+	r.mu.Lock()
+	factory, ok := r.factories[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown rendezvous method %q", name)
+	}
+	return factory(config, transport)
+}
+
+// defaultRendezvousRegistry is the RendezvousRegistry consulted by
+// newRegisteredRendezvous and newRendezvousChain. It's pre-populated by
+// init with the built-in "sqs", "amp", and "http" methods below, alongside
+// whatever an embedder adds with RegisterRendezvousMethod.
+var defaultRendezvousRegistry = newRendezvousRegistry()
+
+func init() {
+	defaultRendezvousRegistry.register("sqs", func(config ClientConfig, transport http.RoundTripper) (RendezvousMethod, error) {
+		if config.SQSQueueURL == "" {
+			return nil, fmt.Errorf("rendezvous method \"sqs\" requires ClientConfig.SQSQueueURL")
+		}
+		if config.SQSCredsStr == "" {
+			return nil, fmt.Errorf("rendezvous method \"sqs\" requires ClientConfig.SQSCredsStr")
+		}
+		return newSQSRendezvous(config.SQSQueueURL, config.SQSCredsStr, config.SQSRegion, config.SQSEndpoint, transport, config.SQSAnswerPoolSize)
+	})
+	defaultRendezvousRegistry.register("amp", func(config ClientConfig, transport http.RoundTripper) (RendezvousMethod, error) {
+		if config.AmpCacheURL == "" || config.BrokerURL == "" {
+			return nil, fmt.Errorf("rendezvous method \"amp\" requires ClientConfig.AmpCacheURL and BrokerURL")
+		}
+		return newAMPCacheRendezvous(config.BrokerURL, config.AmpCacheURL, config.FrontDomains, transport)
+	})
+	defaultRendezvousRegistry.register("http", func(config ClientConfig, transport http.RoundTripper) (RendezvousMethod, error) {
+		if config.BrokerURL == "" {
+			return nil, fmt.Errorf("rendezvous method \"http\" requires ClientConfig.BrokerURL")
+		}
+		return newHTTPRendezvous(config.BrokerURL, config.FrontDomains, transport)
+	})
+}
+
+// RegisterRendezvousMethod makes a custom RendezvousMethod, built by
+// factory, selectable under name -- either by setting
+// ClientConfig.RendezvousMethod to name directly, or by naming it in a
+// ClientConfig.RendezvousSpecs fallback chain. This lets embedders add
+// their own broker transports (e.g. a proprietary signaling channel)
+// without forking the client library. Registering under a name that is
+// already taken -- including one of the built-in "sqs"/"amp"/"http" names
+// -- overwrites the previous factory.
+func RegisterRendezvousMethod(name string, factory RendezvousMethodFactory) {
+	defaultRendezvousRegistry.register(name, factory)
+}
+
+// newRegisteredRendezvous looks up and builds the RendezvousMethod
+// registered under config.RendezvousMethod. It returns (nil, nil) if
+// RendezvousMethod is unset, so callers can fall through to the built-in
+// SQS/AmpCache/HTTP selection in selectRendezvous.
+func newRegisteredRendezvous(config ClientConfig, transport http.RoundTripper) (RendezvousMethod, error) {
+	if config.RendezvousMethod == "" {
+		return nil, nil
+	}
+	return defaultRendezvousRegistry.build(config.RendezvousMethod, config, transport)
+}
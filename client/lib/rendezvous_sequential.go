@@ -0,0 +1,35 @@
+package snowflake_client
+
+import "fmt"
+
+// sequentialRendezvous tries each configured RendezvousMethod in order,
+// moving on to the next only if the previous one returns an error --
+// unlike multiRendezvous, which races every method concurrently and
+// returns whichever answers first. It's used to let a faster-but-less-
+// reliable method (e.g. quicRendezvous, whose UDP traffic some firewalls
+// drop outright) attempt rendezvous first without losing the reliability
+// of whatever method was already configured as a fallback.
+type sequentialRendezvous struct {
+	methods []RendezvousMethod
+}
+
+// newSequentialRendezvous builds a sequentialRendezvous that tries the
+// given methods in order. It requires at least one method.
+func newSequentialRendezvous(methods ...RendezvousMethod) (*sequentialRendezvous, error) {
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("sequential rendezvous requires at least one method")
+	}
+	return &sequentialRendezvous{methods: methods}, nil
+}
+
+func (s *sequentialRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
+	var lastErr error
+	for _, method := range s.methods {
+		resp, err := method.Exchange(encPollReq)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all rendezvous methods failed: %w", lastErr)
+}
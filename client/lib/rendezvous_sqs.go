@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -15,6 +18,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/nat"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqsclient"
 	sqscreds "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqscreds/lib"
 )
@@ -25,9 +29,41 @@ type sqsRendezvous struct {
 	sqsURL     *url.URL
 	timeout    time.Duration
 	numRetries int
+
+	natTypeMutex sync.Mutex
+	natType      string
+
+	// poolSize is how many proxy answers to collect from the response queue
+	// before picking the best one, instead of taking the first to arrive.
+	poolSize int
+	// poolWindow bounds how long Exchange waits to fill the pool before
+	// selecting from whatever answers have arrived so far.
+	poolWindow time.Duration
+}
+
+// SetNATType records the client's own NAT type so that, once a pool of
+// proxy answers has been collected, Exchange can prefer the proxy whose
+// advertised NAT type is most compatible with it.
+func (r *sqsRendezvous) SetNATType(natType string) {
+	r.natTypeMutex.Lock()
+	defer r.natTypeMutex.Unlock()
+	r.natType = natType
 }
 
-func newSQSRendezvous(sqsQueue string, sqsCredsStr string, transport http.RoundTripper) (*sqsRendezvous, error) {
+func (r *sqsRendezvous) getNATType() string {
+	r.natTypeMutex.Lock()
+	defer r.natTypeMutex.Unlock()
+	return r.natType
+}
+
+// newSQSRendezvous builds a rendezvous method talking to the AWS SQS queue
+// at sqsQueue. region and endpoint are normally left empty, in which case
+// the region is inferred from sqsQueue's "sqs.<region>.amazonaws.com"
+// hostname and the default AWS SQS endpoint is used; passing them
+// explicitly lets a caller point at LocalStack, a self-hosted
+// SQS-compatible service, or any region whose queue URL doesn't follow that
+// convention.
+func newSQSRendezvous(sqsQueue, sqsCredsStr, region, endpoint string, transport http.RoundTripper, poolSize int) (*sqsRendezvous, error) {
 	sqsURL, err := url.Parse(sqsQueue)
 	if err != nil {
 		return nil, err
@@ -39,36 +75,64 @@ func newSQSRendezvous(sqsQueue string, sqsCredsStr string, transport http.RoundT
 	}
 
 	queueURL := sqsURL.String()
-	hostName := sqsURL.Hostname()
 
-	regionRegex, _ := regexp.Compile(`^sqs\.([\w-]+)\.amazonaws\.com$`)
-	res := regionRegex.FindStringSubmatch(hostName)
-	if len(res) < 2 {
-		log.Fatal("Could not extract AWS region from SQS URL. Ensure that the SQS Queue URL provided is valid.")
+	if region == "" {
+		region, err = regionFromQueueURL(sqsURL)
+		if err != nil {
+			return nil, err
+		}
 	}
-	region := res[1]
+
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(sqsCreds.AwsAccessKeyId, sqsCreds.AwsSecretKey, ""),
+			credentials.NewStaticCredentialsProvider(sqsCreds.AwsAccessKeyId, sqsCreds.AwsSecretKey, sqsCreds.SessionToken),
 		),
 		config.WithRegion(region),
+		// Reuse the same http.RoundTripper the broker/AMP-cache rendezvous
+		// methods use, so an mTLS client certificate (see MTLSConfig) also
+		// covers requests to a private SQS VPC endpoint.
+		config.WithHTTPClient(&http.Client{Transport: transport}),
 	)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	var optFns []func(*sqs.Options)
+	if endpoint != "" {
+		optFns = append(optFns, func(o *sqs.Options) { o.BaseEndpoint = aws.String(endpoint) })
 	}
-	client := sqs.NewFromConfig(cfg)
+	client := sqs.NewFromConfig(cfg, optFns...)
 
 	log.Println("Queue URL: ", queueURL)
 
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
 	return &sqsRendezvous{
 		transport:  transport,
 		sqsClient:  client,
 		sqsURL:     sqsURL,
 		timeout:    time.Second,
 		numRetries: 5,
+		natType:    nat.NATUnknown,
+		poolSize:   poolSize,
+		poolWindow: 20 * time.Second,
 	}, nil
 }
 
+// regionFromQueueURL extracts the AWS region from a standard
+// "https://sqs.<region>.amazonaws.com/..." queue URL, for callers that
+// don't pass an explicit region.
+func regionFromQueueURL(sqsURL *url.URL) (string, error) {
+	regionRegex := regexp.MustCompile(`^sqs\.([\w-]+)\.amazonaws\.com$`)
+	res := regionRegex.FindStringSubmatch(sqsURL.Hostname())
+	if len(res) < 2 {
+		return "", fmt.Errorf("could not extract AWS region from SQS URL %q; pass an explicit region for non-AWS endpoints", sqsURL)
+	}
+	return res[1], nil
+}
+
 func (r *sqsRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
 	log.Println("Negotiating via SQS Queue rendezvous...")
 
@@ -117,14 +181,16 @@ func (r *sqsRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	var answer string
-	for i := 0; i < r.numRetries; i++ {
-		// Waiting for SDP Answer from proxy to be placed in SQS queue.
-		// We will retry upt to 5 times before we error out.
+	var pool []types.Message
+	deadline := time.Now().Add(r.poolWindow)
+	for i := 0; i < r.numRetries && len(pool) < r.poolSize && time.Now().Before(deadline); i++ {
+		// Waiting for SDP Answer(s) from proxies to be placed in SQS queue.
+		// We will retry up to 5 times before we error out.
 		res, err := r.sqsClient.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
-			QueueUrl:            responseQueueURL,
-			MaxNumberOfMessages: 1,
-			WaitTimeSeconds:     20,
+			QueueUrl:              responseQueueURL,
+			MaxNumberOfMessages:   int32(r.poolSize - len(pool)),
+			WaitTimeSeconds:       20,
+			MessageAttributeNames: []string{"All"},
 		})
 		if err != nil {
 			return nil, err
@@ -134,10 +200,98 @@ func (r *sqsRendezvous) Exchange(encPollReq []byte) ([]byte, error) {
 			delay := float64(i)/2.0 + 1
 			time.Sleep(time.Duration(delay*1000) * (r.timeout / 1000))
 		} else {
-			answer = *res.Messages[0].Body
-			break
+			pool = append(pool, res.Messages...)
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("no answer received from response SQS queue")
+	}
+
+	winner, losers := r.selectBestAnswer(pool)
+	r.deleteMessages(responseQueueURL, losers)
+
+	return []byte(*winner.Body), nil
+}
+
+// selectBestAnswer picks the proxy answer out of pool that best matches
+// r's NAT type, preferring proxies whose NAT is compatible with it (see
+// answerScore) and, among ties, the one reporting the lowest RTT via its
+// "Rtt" message attribute. It returns the winning message and
+// the rest of the pool, so the caller can delete the losers.
+func (r *sqsRendezvous) selectBestAnswer(pool []types.Message) (types.Message, []types.Message) {
+	clientNATType := r.getNATType()
+
+	bestIdx := 0
+	for i := 1; i < len(pool); i++ {
+		if answerScore(pool[i], clientNATType) < answerScore(pool[bestIdx], clientNATType) {
+			bestIdx = i
+		}
+	}
+
+	losers := make([]types.Message, 0, len(pool)-1)
+	for i, msg := range pool {
+		if i != bestIdx {
+			losers = append(losers, msg)
+		}
+	}
+	return pool[bestIdx], losers
+}
+
+// answerScore ranks a proxy's answer: lower is better. A proxy is compatible
+// if it or the client has an unrestricted NAT, or if it reports no "NAT"
+// attribute; a compatible proxy always beats an incompatible one, so for an
+// unrestricted client every proxy is compatible and RTT alone decides. RTT
+// (in milliseconds, from the "Rtt" message attribute) breaks ties between
+// proxies of the same NAT compatibility.
+func answerScore(msg types.Message, clientNATType string) float64 {
+	const (
+		scoreCompatible   = 0.0
+		scoreIncompatible = 1e9
+	)
+
+	score := scoreIncompatible
+	if proxyNATType, ok := messageAttributeValue(msg, "NAT"); ok {
+		if proxyNATType == nat.NATUnrestricted || clientNATType == nat.NATUnrestricted {
+			score = scoreCompatible
 		}
+	} else {
+		score = scoreCompatible // No NAT attribute: don't penalize older proxies.
 	}
 
-	return []byte(answer), nil
+	if rttStr, ok := messageAttributeValue(msg, "Rtt"); ok {
+		if rtt, err := strconv.ParseFloat(rttStr, 64); err == nil {
+			score += rtt
+		}
+	}
+	return score
+}
+
+func messageAttributeValue(msg types.Message, name string) (string, bool) {
+	attr, ok := msg.MessageAttributes[name]
+	if !ok || attr.StringValue == nil {
+		return "", false
+	}
+	return *attr.StringValue, true
+}
+
+// deleteMessages removes the losing messages from the response queue in a
+// single batch request so they don't linger and get redelivered.
+func (r *sqsRendezvous) deleteMessages(queueURL *string, messages []types.Message) {
+	if len(messages) == 0 {
+		return
+	}
+	entries := make([]types.DeleteMessageBatchRequestEntry, 0, len(messages))
+	for i, msg := range messages {
+		entries = append(entries, types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+	}
+	_, err := r.sqsClient.DeleteMessageBatch(context.TODO(), &sqs.DeleteMessageBatchInput{
+		QueueUrl: queueURL,
+		Entries:  entries,
+	})
+	if err != nil {
+		log.Printf("Failed to delete %d unused response SQS message(s): %v", len(messages), err)
+	}
 }
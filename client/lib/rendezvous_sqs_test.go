@@ -0,0 +1,65 @@
+package snowflake_client
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/nat"
+)
+
+func messageWithAttrs(body string, receiptHandle string, natType string, rtt string) types.Message {
+	attrs := map[string]types.MessageAttributeValue{}
+	if natType != "" {
+		attrs["NAT"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(natType)}
+	}
+	if rtt != "" {
+		attrs["Rtt"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(rtt)}
+	}
+	return types.Message{
+		Body:              aws.String(body),
+		ReceiptHandle:     aws.String(receiptHandle),
+		MessageAttributes: attrs,
+	}
+}
+
+func TestSQSSelectBestAnswer(t *testing.T) {
+	Convey("Given a pool of proxy answers", t, func() {
+		r := &sqsRendezvous{natType: nat.NATRestricted}
+
+		Convey("It picks the unrestricted proxy over a restricted one", func() {
+			unrestricted := messageWithAttrs("unrestricted", "r1", nat.NATUnrestricted, "100")
+			restricted := messageWithAttrs("restricted", "r2", nat.NATRestricted, "1")
+			pool := []types.Message{restricted, unrestricted}
+
+			winner, losers := r.selectBestAnswer(pool)
+
+			So(*winner.Body, ShouldEqual, "unrestricted")
+			So(losers, ShouldHaveLength, 1)
+			So(*losers[0].Body, ShouldEqual, "restricted")
+		})
+
+		Convey("It breaks ties between equally compatible proxies using RTT", func() {
+			slow := messageWithAttrs("slow", "r1", nat.NATUnrestricted, "200")
+			fast := messageWithAttrs("fast", "r2", nat.NATUnrestricted, "20")
+			pool := []types.Message{slow, fast}
+
+			winner, losers := r.selectBestAnswer(pool)
+
+			So(*winner.Body, ShouldEqual, "fast")
+			So(losers, ShouldHaveLength, 1)
+			So(*losers[0].Body, ShouldEqual, "slow")
+		})
+
+		Convey("It doesn't penalize answers with no NAT attribute", func() {
+			noAttrs := messageWithAttrs("legacy", "r1", "", "")
+			restricted := messageWithAttrs("restricted", "r2", nat.NATRestricted, "5")
+			pool := []types.Message{restricted, noAttrs}
+
+			winner, _ := r.selectBestAnswer(pool)
+
+			So(*winner.Body, ShouldEqual, "legacy")
+		})
+	})
+}
@@ -419,13 +419,14 @@ func TestBrokerChannel(t *testing.T) {
 		brokerChannel, err := newBrokerChannelFromConfig(ClientConfig{
 			BrokerURL:         mockServer.URL,
 			BridgeFingerprint: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
-		})
+		}, nil)
 		So(err, ShouldBeNil)
 		brokerChannel.SetNATType(nat.NATRestricted)
 
 		answerSdpReturned, err := brokerChannel.Negotiate(
 			offerSdp,
 			brokerChannel.GetNATType(),
+			nil,
 		)
 		So(err, ShouldBeNil)
 		So(answerSdpReturned, ShouldEqual, answerSdp)
@@ -440,3 +441,42 @@ func TestBrokerChannel(t *testing.T) {
 		So(requestSdp, ShouldEqual, offerSdp)
 	})
 }
+
+func TestNATPolicy(t *testing.T) {
+	Convey("Given a fresh NATPolicy with unknown actual NAT type", t, func() {
+		p := new(NATPolicy)
+
+		Convey("it spoofs NATUnrestricted until a spoofed attempt fails", func() {
+			So(p.NATTypeToSend(nat.NATUnknown), ShouldEqual, nat.NATUnrestricted)
+			p.Failure(nat.NATUnknown, nat.NATUnrestricted)
+			So(p.NATTypeToSend(nat.NATUnknown), ShouldEqual, nat.NATUnknown)
+		})
+
+		Convey("a broker hint of stop-spoofing overrides the local latch immediately", func() {
+			p.SetHint(nat.HintStopSpoofing)
+			So(p.NATTypeToSend(nat.NATUnknown), ShouldEqual, nat.NATUnknown)
+		})
+
+		Convey("a broker hint of spoof-ok overrides a tripped local latch", func() {
+			p.Failure(nat.NATUnknown, nat.NATUnrestricted)
+			p.SetHint(nat.HintSpoofOK)
+			So(p.NATTypeToSend(nat.NATUnknown), ShouldEqual, nat.NATUnrestricted)
+		})
+
+		Convey("Success/Failure record what the next poll should report", func() {
+			sentNAT, outcome := p.prevPollReport()
+			So(sentNAT, ShouldEqual, "")
+			So(outcome, ShouldEqual, "")
+
+			p.Success(nat.NATRestricted, nat.NATUnrestricted)
+			sentNAT, outcome = p.prevPollReport()
+			So(sentNAT, ShouldEqual, nat.NATUnrestricted)
+			So(outcome, ShouldEqual, nat.OutcomeMismatchedSuccess)
+
+			p.Failure(nat.NATUnknown, nat.NATUnrestricted)
+			sentNAT, outcome = p.prevPollReport()
+			So(sentNAT, ShouldEqual, nat.NATUnrestricted)
+			So(outcome, ShouldEqual, nat.OutcomeMismatchedFailure)
+		})
+	})
+}
@@ -0,0 +1,307 @@
+package snowflake_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	pt "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/goptlib"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/util"
+)
+
+// errRunnerClosed is returned by InjectConn once Run's context has ended.
+var errRunnerClosed = errors.New("runner is no longer accepting connections")
+
+// Runner drives a Snowflake client's full lifecycle -- accepting local SOCKS
+// connections and/or taking in-process net.Conns directly, dialing out
+// through NewSnowflakeClient for each one, and copying bytes between the two
+// -- independently of the pluggable transport's main(). Embedding
+// applications (a VPN client, say) construct a Runner instead of
+// reimplementing socksAcceptLoop/copyLoop, and get the same typed
+// SnowflakeEventReceiver feedback the PT main uses for its logs to drive a
+// real progress UI.
+type Runner struct {
+	config ClientConfig
+	events event.SnowflakeEventReceiver
+
+	listeners []*pt.SocksListener
+	conns     chan net.Conn
+	closed    chan struct{}
+}
+
+// NewRunner constructs a Runner that will dial out using config. Callers
+// that want SOCKS service add listeners with AddSocksListener before calling
+// Run; an embedder that only wants to hand over conns directly via
+// InjectConn can skip that and add none. events receives progress
+// notifications for every connection the Runner handles; if nil, events are
+// dropped.
+func NewRunner(config ClientConfig, events event.SnowflakeEventReceiver) *Runner {
+	if events == nil {
+		events = event.NewSnowflakeEventDispatcher()
+	}
+	return &Runner{
+		config: config,
+		events: events,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// AddSocksListener registers an already-bound SOCKS listener to be served by
+// Run. It must be called before Run; the caller keeps ownership of ln for
+// the purposes of reporting its address (e.g. via goptlib's pt.Cmethod)
+// before Run starts accepting on it.
+func (r *Runner) AddSocksListener(ln *pt.SocksListener) {
+	r.listeners = append(r.listeners, ln)
+}
+
+// InjectConn hands conn to the Runner as though it had been accepted from a
+// SOCKS listener, without requiring one to be configured at all. conn is
+// proxied directly to a snowflake with no SOCKS negotiation, so callers are
+// responsible for presenting whatever protocol the other end of conn
+// expects. It returns errRunnerClosed if Run has already returned.
+func (r *Runner) InjectConn(conn net.Conn) error {
+	select {
+	case r.conns <- conn:
+		return nil
+	case <-r.closed:
+		return errRunnerClosed
+	}
+}
+
+// Run starts accepting on every listener added with AddSocksListener, plus
+// a collector for conns passed to InjectConn, and blocks until ctx is
+// cancelled or a listener fails unrecoverably. Every accepted or injected
+// connection is handled on its own goroutine and does not block the others.
+func (r *Runner) Run(ctx context.Context) error {
+	defer close(r.closed)
+	defer func() {
+		for _, ln := range r.listeners {
+			ln.Close()
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	reportErr := func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+
+	for _, ln := range r.listeners {
+		go r.socksAcceptLoop(ctx, ln, reportErr)
+	}
+	go r.injectedConnLoop(ctx)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		return err
+	}
+}
+
+// socksAcceptLoop accepts connections from ln until it errors or ctx ends,
+// handling each on its own goroutine. A non-temporary accept error is sent
+// to reportErr so Run can unwind the other listeners instead of spinning.
+func (r *Runner) socksAcceptLoop(ctx context.Context, ln *pt.SocksListener, reportErr func(error)) {
+	for {
+		conn, err := ln.AcceptSocks()
+		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Temporary() {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+			default:
+				reportErr(err)
+			}
+			return
+		}
+		go r.handleSocksConn(ctx, conn)
+	}
+}
+
+// injectedConnLoop proxies every conn passed to InjectConn until ctx ends.
+func (r *Runner) injectedConnLoop(ctx context.Context) {
+	for {
+		select {
+		case conn := <-r.conns:
+			go r.handleConn(ctx, conn, nil)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSocksConn applies any per-connection SOCKS args as overrides on top
+// of the Runner's base config, the same overrides socksAcceptLoop in
+// client/snowflake.go used to apply inline, then hands off to handleConn.
+func (r *Runner) handleSocksConn(ctx context.Context, conn *pt.SocksConn) {
+	config := r.config
+	if err := applySocksArgs(&config, conn.Req.Args); err != nil {
+		conn.Reject()
+		log.Printf("invalid SOCKS arg: %v", err)
+		return
+	}
+	if err := conn.Grant(&net.TCPAddr{IP: net.IPv4zero, Port: 0}); err != nil {
+		log.Printf("conn.Grant error: %s", err)
+		return
+	}
+	r.handleConn(ctx, conn, &config)
+}
+
+// handleConn dials a snowflake for conn and copies bytes between them until
+// either side closes or ctx ends. config overrides the Runner's base config
+// when non-nil (used for per-SOCKS-connection overrides); otherwise the base
+// config is used as-is, which is always the case for injected conns.
+func (r *Runner) handleConn(ctx context.Context, conn net.Conn, config *ClientConfig) {
+	defer conn.Close()
+
+	cfg := r.config
+	if config != nil {
+		cfg = *config
+	}
+
+	r.events.OnNewSnowflakeEvent(event.EventOnBrokerRendezvousStarted{})
+	transport, err := NewSnowflakeClient(cfg)
+	if err != nil {
+		log.Printf("failed to start snowflake transport: %v", err)
+		return
+	}
+	transport.AddSnowflakeEventListener(r.events)
+
+	sconn, err := transport.Dial()
+	if err != nil {
+		log.Printf("dial error: %s", err)
+		return
+	}
+	defer sconn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.copyLoop(conn, sconn)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
+
+// copyLoop exchanges bytes between a local conn (SOCKS or injected) and a
+// dialed snowflake conn, emitting EventOnTunnelFirstByte the first time any
+// data reaches the local side from the tunnel.
+func (r *Runner) copyLoop(local, sfconn io.ReadWriter) {
+	done := make(chan struct{}, 2)
+	go func() {
+		if _, err := io.Copy(local, r.firstByteNotifier(sfconn)); err != nil {
+			log.Printf("copying Snowflake to local conn resulted in error: %v", err)
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		if _, err := io.Copy(sfconn, local); err != nil {
+			log.Printf("copying local conn to Snowflake resulted in error: %v", err)
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	log.Println("copy loop ended")
+}
+
+// firstByteNotifier wraps reader so that the first successful Read fires
+// EventOnTunnelFirstByte before returning its data to the caller.
+func (r *Runner) firstByteNotifier(reader io.Reader) io.Reader {
+	fired := false
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := reader.Read(p)
+		if n > 0 && !fired {
+			fired = true
+			r.events.OnNewSnowflakeEvent(event.EventOnTunnelFirstByte{})
+		}
+		return n, err
+	})
+}
+
+// readerFunc adapts a function to the io.Reader interface.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+// applySocksArgs overrides fields of config with any recognized SOCKS args,
+// mirroring the transport plugin's documented per-connection overrides.
+func applySocksArgs(config *ClientConfig, args pt.Args) error {
+	if arg, ok := args.Get("ampcache"); ok {
+		config.AmpCacheURL = arg
+	}
+	if arg, ok := args.Get("sqsqueue"); ok {
+		config.SQSQueueURL = arg
+	}
+	if arg, ok := args.Get("sqscreds"); ok {
+		config.SQSCredsStr = arg
+	}
+	if arg, ok := args.Get("queue"); ok {
+		config.QueueKind = arg
+	}
+	if arg, ok := args.Get("queue-endpoint"); ok {
+		config.QueueEndpoint = arg
+	}
+	if arg, ok := args.Get("queue-creds"); ok {
+		config.QueueCreds = arg
+	}
+	if arg, ok := args.Get("sdp-setup-role"); ok {
+		config.SDPSetupRole = arg
+	}
+	if arg, ok := args.Get("sdp-fingerprint-algo"); ok {
+		config.SDPFingerprintAlgo = arg
+	}
+	if arg, ok := args.Get("sdp-data-channel-only"); ok {
+		config.SDPDataChannelOnly = arg == "true"
+	}
+	if arg, ok := args.Get("sdp-restrict-ice-udp"); ok {
+		config.SDPRestrictICEToUDP = arg == "true"
+	}
+	if arg, ok := args.Get("nat-mapping"); ok {
+		config.NAT1To1Mappings = util.ParseNAT1To1Mappings(arg)
+	}
+	if arg, ok := args.Get("fronts"); ok {
+		if arg != "" {
+			config.FrontDomains = strings.Split(strings.TrimSpace(arg), ",")
+		}
+	} else if arg, ok := args.Get("front"); ok {
+		config.FrontDomains = strings.Split(strings.TrimSpace(arg), ",")
+	}
+	if arg, ok := args.Get("ice"); ok {
+		config.ICEAddresses = strings.Split(strings.TrimSpace(arg), ",")
+	}
+	if arg, ok := args.Get("max"); ok {
+		max, err := strconv.Atoi(arg)
+		if err != nil {
+			return errors.New("max=" + arg)
+		}
+		config.Max = max
+	}
+	if arg, ok := args.Get("url"); ok {
+		config.BrokerURL = arg
+	}
+	if arg, ok := args.Get("utls-nosni"); ok {
+		switch strings.ToLower(arg) {
+		case "true", "yes":
+			config.UTLSRemoveSNI = true
+		}
+	}
+	if arg, ok := args.Get("utls-imitate"); ok {
+		config.UTLSClientID = arg
+	}
+	if arg, ok := args.Get("fingerprint"); ok {
+		config.BridgeFingerprint = arg
+	}
+	return nil
+}
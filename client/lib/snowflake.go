@@ -0,0 +1,122 @@
+package snowflake_client
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+)
+
+// Transport is the dialable side of a Snowflake client: a rendezvous
+// method and WebRTC dialer built once from a ClientConfig by
+// NewSnowflakeClient, then reused across as many Dial calls as the caller
+// likes. Client.Dial and Runner.handleConn are both thin wrappers around
+// Transport rather than reimplementing rendezvous and WebRTC setup
+// themselves.
+type Transport struct {
+	dialer *WebRTCDialer
+	events event.SnowflakeEventDispatcher
+}
+
+// NewSnowflakeClient builds a Transport from config: a BrokerChannel using
+// whichever RendezvousMethod config selects (AMP cache, HTTP, SQS, a
+// message-queue backend, or a method registered with
+// RegisterRendezvousMethod), and a WebRTCDialer gathering candidates
+// against config's ICE servers, capped at config.Max concurrent peers.
+func NewSnowflakeClient(config ClientConfig) (*Transport, error) {
+	events := event.NewSnowflakeEventDispatcher()
+
+	bc, err := newBrokerChannelFromConfig(config, events)
+	if err != nil {
+		return nil, err
+	}
+
+	max := config.Max
+	if max <= 0 {
+		max = 1
+	}
+
+	dialer := NewWebRTCDialerWithEventsAndProxy(bc, iceServersFromConfig(config), max, events, config.CommunicationProxy)
+	return &Transport{dialer: dialer, events: events}, nil
+}
+
+// iceServersFromConfig builds the webrtc.ICEServer list a WebRTCDialer
+// should gather ICE candidates against: config.ICEServers verbatim, plus
+// one entry per config.ICEAddresses URL a caller set as a bare string
+// instead of a pre-built webrtc.ICEServer (e.g. from the PT binary's
+// comma-separated -ice flag). The broker's own per-connection TURN
+// servers, if any, are merged in later by BrokerChannel.ICEServers inside
+// WebRTCPeer.connect.
+func iceServersFromConfig(config ClientConfig) []webrtc.ICEServer {
+	iceServers := append([]webrtc.ICEServer{}, config.ICEServers...)
+	for _, addr := range config.ICEAddresses {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		iceServers = append(iceServers, webrtc.ICEServer{URLs: []string{addr}})
+	}
+	return iceServers
+}
+
+// AddSnowflakeEventListener registers receiver for every event this
+// Transport's rendezvous and WebRTC dialing report -- the same
+// notifications Client and Runner forward their own events argument to.
+func (t *Transport) AddSnowflakeEventListener(receiver event.SnowflakeEventReceiver) {
+	t.events.AddSnowflakeEventListener(receiver)
+}
+
+// Dial rendezvous with the broker and waits for a snowflake proxy to
+// answer, returning a net.Conn tunneled over the resulting WebRTC
+// DataChannel.
+func (t *Transport) Dial() (net.Conn, error) {
+	peer, err := t.dialer.Catch()
+	if err != nil {
+		return nil, err
+	}
+	return &snowflakeConn{peer: peer}, nil
+}
+
+// errDeadlineNotSupported is returned by snowflakeConn's deadline methods.
+var errDeadlineNotSupported = errors.New("snowflake_client: deadlines are not supported on this conn")
+
+// snowflakeConn adapts a *WebRTCPeer -- which only implements Read, Write,
+// and Close, being backed by an io.Pipe rather than a real socket -- to the
+// full net.Conn interface Transport.Dial promises.
+type snowflakeConn struct {
+	peer *WebRTCPeer
+}
+
+func (c *snowflakeConn) Read(b []byte) (int, error)  { return c.peer.Read(b) }
+func (c *snowflakeConn) Write(b []byte) (int, error) { return c.peer.Write(b) }
+func (c *snowflakeConn) Close() error                { return c.peer.Close() }
+
+func (c *snowflakeConn) LocalAddr() net.Addr  { return snowflakeAddr{} }
+func (c *snowflakeConn) RemoteAddr() net.Addr { return snowflakeAddr{id: c.peer.ID()} }
+
+// SetDeadline, SetReadDeadline, and SetWriteDeadline always return
+// errDeadlineNotSupported: WebRTCPeer's io.Pipe-backed transport has
+// nothing to wire a deadline through to. A caller that needs a hard
+// timeout should cancel the context around its Read/Write instead.
+func (c *snowflakeConn) SetDeadline(time.Time) error      { return errDeadlineNotSupported }
+func (c *snowflakeConn) SetReadDeadline(time.Time) error  { return errDeadlineNotSupported }
+func (c *snowflakeConn) SetWriteDeadline(time.Time) error { return errDeadlineNotSupported }
+
+// snowflakeAddr is a minimal net.Addr for a snowflakeConn: a WebRTC
+// DataChannel has no IP-level address of its own, so this carries only the
+// peer's ID (if any) for logging.
+type snowflakeAddr struct {
+	id string
+}
+
+func (a snowflakeAddr) Network() string { return "snowflake" }
+func (a snowflakeAddr) String() string {
+	if a.id == "" {
+		return "snowflake"
+	}
+	return "snowflake:" + a.id
+}
@@ -5,21 +5,62 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/encapsulation"
 )
 
-var errNotImplemented = errors.New("not implemented")
+// errClosedPacketConn is returned by ReadFrom/WriteTo after Close.
+var errClosedPacketConn = errors.New("read/write on closed encapsulationPacketConn")
+
+// encapsulationMTU bounds the size of the scratch buffer the background
+// reader decodes each frame into, since it reads ahead of whatever buffer
+// size a given ReadFrom call happens to pass.
+const encapsulationMTU = 1280
+
+// readResult is what the background reader goroutine posts to readQueue:
+// either a decoded frame or the error (usually io.EOF) that ended the
+// reader loop.
+type readResult struct {
+	buf []byte
+	err error
+}
+
+// timeoutError is returned by ReadFrom/WriteTo when a deadline set by
+// SetDeadline, SetReadDeadline, or SetWriteDeadline expires. It satisfies
+// net.Error so callers that type-switch for a temporary/timeout condition
+// (DTLS retransmission timers, KCP idle detection, etc.) see the behavior
+// they expect instead of a permanent error.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "deadline exceeded" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
 
 // encapsulationPacketConn implements the net.PacketConn interface over an
 // io.ReadWriteCloser stream, using the encapsulation package to represent
 // packets in a stream.
+//
+// Reads are served from a background goroutine that continuously decodes
+// frames off the underlying stream and pushes them onto a buffered channel,
+// so that ReadFrom can select between an available frame and a deadline
+// timer rather than blocking forever inside encapsulation.ReadData.
 type encapsulationPacketConn struct {
-	io.ReadWriteCloser
+	conn       io.ReadWriteCloser
 	localAddr  net.Addr
 	remoteAddr net.Addr
 	bw         *bufio.Writer
+
+	readQueue chan readResult
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	writeMu sync.Mutex // serializes writeLocked's use of bw
+
+	readDeadline  deadlineTimer
+	writeDeadline deadlineTimer
 }
 
 // newEncapsulationPacketConn makes an encapsulationPacketConn out of a given
@@ -28,26 +69,101 @@ func newEncapsulationPacketConn(
 	localAddr, remoteAddr net.Addr,
 	conn io.ReadWriteCloser,
 ) *encapsulationPacketConn {
-	return &encapsulationPacketConn{
-		ReadWriteCloser: conn,
-		localAddr:       localAddr,
-		remoteAddr:      remoteAddr,
-		bw:              bufio.NewWriter(conn),
+	c := &encapsulationPacketConn{
+		conn:       conn,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		bw:         bufio.NewWriter(conn),
+		// Buffer a few frames so a burst of incoming packets doesn't
+		// stall the reader goroutine while ReadFrom is busy elsewhere.
+		readQueue: make(chan readResult, 8),
+		closed:    make(chan struct{}),
 	}
+	go c.readLoop()
+	return c
 }
 
-// ReadFrom reads an encapsulated packet from the stream.
+// readLoop decodes frames off conn until it errors (typically io.EOF when
+// the underlying stream closes), posting each to readQueue.
+func (c *encapsulationPacketConn) readLoop() {
+	for {
+		buf := make([]byte, encapsulationMTU)
+		n, err := encapsulation.ReadData(c.conn, buf)
+		if err == io.ErrShortBuffer {
+			err = nil
+		}
+		select {
+		case c.readQueue <- readResult{buf: buf[:n], err: err}:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ReadFrom reads an encapsulated packet from the stream, or returns a
+// timeoutError if the read deadline set by SetDeadline/SetReadDeadline
+// expires first.
 func (c *encapsulationPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
-	n, err := encapsulation.ReadData(c.ReadWriteCloser, p)
-	if err == io.ErrShortBuffer {
-		err = nil
+	timer, stop := c.readDeadline.timer()
+	defer stop()
+
+	select {
+	case result := <-c.readQueue:
+		n := copy(p, result.buf)
+		return n, c.remoteAddr, result.err
+	case <-timer:
+		return 0, c.remoteAddr, timeoutError{}
+	case <-c.closed:
+		return 0, c.remoteAddr, errClosedPacketConn
 	}
-	return n, c.remoteAddr, err
 }
 
-// WriteTo writes an encapsulated packet to the stream.
+// WriteTo writes an encapsulated packet to the stream. If the underlying
+// conn supports deadlines itself, they're forwarded to it; otherwise the
+// write is raced against a timer derived from the write deadline set by
+// SetDeadline/SetWriteDeadline.
 func (c *encapsulationPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
 	// addr is ignored.
+	if deadlineSetter, ok := c.conn.(interface {
+		SetWriteDeadline(time.Time) error
+	}); ok {
+		if err := deadlineSetter.SetWriteDeadline(c.writeDeadline.get()); err != nil {
+			return 0, err
+		}
+		return c.writeLocked(p)
+	}
+
+	timer, stop := c.writeDeadline.timer()
+	defer stop()
+
+	type writeResult struct {
+		n   int
+		err error
+	}
+	done := make(chan writeResult, 1)
+	go func() {
+		n, err := c.writeLocked(p)
+		done <- writeResult{n, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.n, result.err
+	case <-timer:
+		return 0, timeoutError{}
+	}
+}
+
+// writeLocked encodes and flushes a single frame while holding writeMu.
+// bufio.Writer is not safe for concurrent use, and a write that WriteTo
+// gave up on at its deadline can still be running when the next WriteTo
+// starts.
+func (c *encapsulationPacketConn) writeLocked(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	_, err := encapsulation.WriteData(c.bw, p)
 	if err == nil {
 		err = c.bw.Flush()
@@ -64,6 +180,59 @@ func (c *encapsulationPacketConn) LocalAddr() net.Addr {
 	return c.localAddr
 }
 
-func (c *encapsulationPacketConn) SetDeadline(t time.Time) error      { return errNotImplemented }
-func (c *encapsulationPacketConn) SetReadDeadline(t time.Time) error  { return errNotImplemented }
-func (c *encapsulationPacketConn) SetWriteDeadline(t time.Time) error { return errNotImplemented }
+// Close stops the background reader and closes the underlying conn.
+func (c *encapsulationPacketConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+func (c *encapsulationPacketConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *encapsulationPacketConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *encapsulationPacketConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deadlineTimer holds a mutable deadline, guarded by a mutex, and vends
+// fresh timer channels reflecting its current value. It's the same pattern
+// the standard library uses internally for net.Conn deadlines, simplified
+// since encapsulationPacketConn only needs a single outstanding timer per
+// direction at a time.
+type deadlineTimer struct {
+	lock     sync.Mutex
+	deadline time.Time
+}
+
+func (d *deadlineTimer) get() time.Time {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.deadline
+}
+
+func (d *deadlineTimer) set(deadline time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deadline = deadline
+}
+
+// timer returns a channel that fires when the current deadline passes, and
+// a nil channel (which blocks forever in a select) if no deadline is set.
+// The returned stop function must be called once the timer is no longer
+// needed, to release its resources.
+func (d *deadlineTimer) timer() (<-chan time.Time, func()) {
+	deadline := d.get()
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, func() { timer.Stop() }
+}
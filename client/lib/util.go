@@ -1,37 +1,101 @@
 package snowflake_client
 
 import (
+	"fmt"
 	"log"
+	"math"
 	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
 )
 
 const (
 	LogTimeInterval = 5 * time.Second
+
+	// defaultRateTau is the default time constant InboundRate/OutboundRate's
+	// exponentially weighted moving average decays over.
+	defaultRateTau = 30 * time.Second
 )
 
-type bytesLogger interface {
-	addOutbound(int64)
-	addInbound(int64)
+// BytesLogger is implemented by callers that want to observe the number
+// of bytes a WebRTCPeer sends and receives, e.g. to show transfer
+// statistics in a GUI; see WithBytesLogger. A nil BytesLogger (the
+// default) logs nothing. GetStat and ThroughputSummary let an embedder
+// poll the running totals instead of only reacting to AddInbound/
+// AddOutbound as they're called. NewBytesSyncLogger returns a BytesLogger
+// that also reports periodic event.EventOnClientBandwidth events, for an
+// embedder that would rather subscribe via the event bus than poll.
+type BytesLogger interface {
+	AddOutbound(int64)
+	AddInbound(int64)
+	// GetStat returns the total inbound and outbound bytes logged since
+	// this BytesLogger was constructed.
+	GetStat() (inbound, outbound int64)
+	// InboundRate and OutboundRate return an exponentially weighted
+	// moving average of bytes/sec, smoothed over the BytesLogger's rate
+	// time constant -- a steadier "current throughput" for UI display
+	// than GetStat's cumulative totals or a single bursty interval.
+	InboundRate() float64
+	OutboundRate() float64
+	// ThroughputSummary returns a human-readable summary of GetStat's
+	// totals and how long they've been accumulating over.
+	ThroughputSummary() string
 }
 
-// Default bytesLogger does nothing.
+// Default BytesLogger does nothing.
 type bytesNullLogger struct{}
 
-func (b bytesNullLogger) addOutbound(amount int64) {}
-func (b bytesNullLogger) addInbound(amount int64)  {}
+func (b bytesNullLogger) AddOutbound(amount int64)           {}
+func (b bytesNullLogger) AddInbound(amount int64)            {}
+func (b bytesNullLogger) GetStat() (inbound, outbound int64) { return 0, 0 }
+func (b bytesNullLogger) InboundRate() float64               { return 0 }
+func (b bytesNullLogger) OutboundRate() float64              { return 0 }
+func (b bytesNullLogger) ThroughputSummary() string          { return "Traffic Bytes (in|out): 0 | 0" }
+
+// bytesLoggerStat is bytesSyncLogger's response to a statChan request: its
+// running totals, accumulated since the logger was constructed and never
+// reset by the periodic log() (unlike the interval counters log() prints
+// and resets every LogTimeInterval), plus the current EWMA rates.
+type bytesLoggerStat struct {
+	inbound, outbound         int64
+	rateInbound, rateOutbound float64
+}
 
 // bytesSyncLogger uses channels to safely log from multiple sources with output
 // occuring at reasonable intervals.
 type bytesSyncLogger struct {
 	outboundChan chan int64
 	inboundChan  chan int64
+	statChan     chan chan bytesLoggerStat
+	start        time.Time
+	events       event.SnowflakeEventReceiver
+	rateTau      time.Duration
+}
+
+// NewBytesSyncLogger returns a BytesLogger for use with WithBytesLogger
+// that, alongside the periodic "Traffic Bytes" log.Printf line every
+// bytesSyncLogger already writes, dispatches an event.EventOnClientBandwidth
+// to events each LogTimeInterval -- the client-side equivalent of how
+// proxy/lib's periodicProxyStats reports event.EventOnProxyStats. events may
+// be nil, in which case only the log.Printf line is produced, same as
+// before this method existed. rateTau is the time constant InboundRate and
+// OutboundRate smooth over; 0 uses defaultRateTau.
+func NewBytesSyncLogger(events event.SnowflakeEventReceiver, rateTau time.Duration) BytesLogger {
+	return newBytesSyncLogger(events, rateTau)
 }
 
 // newBytesSyncLogger returns a new bytesSyncLogger and starts it loggin.
-func newBytesSyncLogger() *bytesSyncLogger {
+func newBytesSyncLogger(events event.SnowflakeEventReceiver, rateTau time.Duration) *bytesSyncLogger {
+	if rateTau <= 0 {
+		rateTau = defaultRateTau
+	}
 	b := &bytesSyncLogger{
 		outboundChan: make(chan int64, 5),
 		inboundChan:  make(chan int64, 5),
+		statChan:     make(chan chan bytesLoggerStat),
+		start:        time.Now(),
+		events:       events,
+		rateTau:      rateTau,
 	}
 	go b.log()
 	return b
@@ -40,6 +104,10 @@ func newBytesSyncLogger() *bytesSyncLogger {
 func (b *bytesSyncLogger) log() {
 	var outbound, inbound int64
 	var outEvents, inEvents int
+	var totalOutbound, totalInbound int64
+	var rateInbound, rateOutbound float64
+	rateWarm := false
+	lastTick := time.Now()
 	ticker := time.NewTicker(LogTimeInterval)
 	for {
 		select {
@@ -47,7 +115,32 @@ func (b *bytesSyncLogger) log() {
 			if outEvents > 0 || inEvents > 0 {
 				log.Printf("Traffic Bytes (in|out): %d | %d -- (%d OnMessages, %d Sends)",
 					inbound, outbound, inEvents, outEvents)
+				if b.events != nil {
+					b.events.OnNewSnowflakeEvent(event.EventOnClientBandwidth{
+						Inbound: inbound, Outbound: outbound,
+						InEvents: inEvents, OutEvents: outEvents,
+						Period: LogTimeInterval,
+					})
+				}
+			}
+
+			now := time.Now()
+			elapsed := now.Sub(lastTick)
+			lastTick = now
+			instantIn := float64(inbound) / elapsed.Seconds()
+			instantOut := float64(outbound) / elapsed.Seconds()
+			if !rateWarm {
+				// Warm-start on the first tick's instantaneous sample
+				// instead of ramping up from zero over several tau.
+				rateInbound = instantIn
+				rateOutbound = instantOut
+				rateWarm = true
+			} else {
+				alpha := 1 - math.Exp(-elapsed.Seconds()/b.rateTau.Seconds())
+				rateInbound += alpha * (instantIn - rateInbound)
+				rateOutbound += alpha * (instantOut - rateOutbound)
 			}
+
 			outbound = 0
 			outEvents = 0
 			inbound = 0
@@ -55,17 +148,82 @@ func (b *bytesSyncLogger) log() {
 		case amount := <-b.outboundChan:
 			outbound += amount
 			outEvents++
+			totalOutbound += amount
 		case amount := <-b.inboundChan:
 			inbound += amount
 			inEvents++
+			totalInbound += amount
+		case respChan := <-b.statChan:
+			// Drain whatever AddInbound/AddOutbound calls are already
+			// queued before answering, so the snapshot reflects every
+			// call that happened-before this GetStat rather than
+			// whatever select's pseudo-random case order left pending.
+			draining := true
+			for draining {
+				select {
+				case amount := <-b.outboundChan:
+					outbound += amount
+					outEvents++
+					totalOutbound += amount
+				case amount := <-b.inboundChan:
+					inbound += amount
+					inEvents++
+					totalInbound += amount
+				default:
+					draining = false
+				}
+			}
+			respChan <- bytesLoggerStat{
+				inbound: totalInbound, outbound: totalOutbound,
+				rateInbound: rateInbound, rateOutbound: rateOutbound,
+			}
 		}
 	}
 }
 
-func (b *bytesSyncLogger) addOutbound(amount int64) {
+func (b *bytesSyncLogger) AddOutbound(amount int64) {
 	b.outboundChan <- amount
 }
 
-func (b *bytesSyncLogger) addInbound(amount int64) {
+func (b *bytesSyncLogger) AddInbound(amount int64) {
 	b.inboundChan <- amount
 }
+
+// getStat is GetStat/InboundRate/OutboundRate's shared request to the log()
+// goroutine, race-free since only that goroutine ever mutates the totals
+// and rates it reports.
+func (b *bytesSyncLogger) getStat() bytesLoggerStat {
+	respChan := make(chan bytesLoggerStat)
+	b.statChan <- respChan
+	return <-respChan
+}
+
+// GetStat returns the total inbound and outbound bytes logged since b was
+// constructed, read race-free via a request to the log() goroutine instead
+// of a mutex.
+func (b *bytesSyncLogger) GetStat() (inbound, outbound int64) {
+	stat := b.getStat()
+	return stat.inbound, stat.outbound
+}
+
+// InboundRate and OutboundRate return b's current exponentially weighted
+// moving average of bytes/sec, recomputed once per LogTimeInterval tick
+// from the bytes logged since the previous tick; see b.rateTau.
+func (b *bytesSyncLogger) InboundRate() float64 {
+	return b.getStat().rateInbound
+}
+
+func (b *bytesSyncLogger) OutboundRate() float64 {
+	return b.getStat().rateOutbound
+}
+
+// ThroughputSummary returns the same "Traffic Bytes (in|out)" line log()
+// periodically writes to log.Printf, plus how long GetStat's totals have
+// been accumulating over and the current smoothed throughput from
+// InboundRate/OutboundRate.
+func (b *bytesSyncLogger) ThroughputSummary() string {
+	stat := b.getStat()
+	return fmt.Sprintf("Traffic Bytes (in|out): %d | %d over %v (~%.2f | %.2f KB/s)",
+		stat.inbound, stat.outbound, time.Since(b.start).Round(time.Second),
+		stat.rateInbound/1024, stat.rateOutbound/1024)
+}
@@ -40,52 +40,116 @@ type WebRTCPeer struct {
 
 	once sync.Once // Synchronization for PeerConnection destruction
 
-	bytesLogger  bytesLogger
-	eventsLogger event.SnowflakeEventReceiver
-	proxy        *url.URL
+	bytesLogger        BytesLogger
+	eventsLogger       event.SnowflakeEventReceiver
+	proxy              *url.URL
+	iceFilter          func(net.IP) bool
+	dataChannelTimeout time.Duration
+
+	// trickleICE, plus iceCandidates/iceCandidatesDone, support sending the
+	// SDP offer to the broker without waiting for local ICE gathering to
+	// finish first; see WithTrickleICE and BrokerChannel.TrickleNegotiate.
+	trickleICE        bool
+	iceCandidates     chan webrtc.ICECandidateInit
+	iceCandidatesDone chan struct{}
 }
 
-// Deprecated: Use NewWebRTCPeerWithNatPolicyAndEventsAndProxy Instead.
-func NewWebRTCPeer(
-	config *webrtc.Configuration, broker *BrokerChannel,
-) (*WebRTCPeer, error) {
-	return NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
-		config, broker, nil, nil, nil,
-	)
+// PeerOptions holds the configuration a PeerOption sets when NewPeer
+// constructs a WebRTCPeer. It's exported, rather than threaded through
+// unexported constructor parameters, specifically so that code outside
+// this package can write its own PeerOption instead of waiting for a
+// dedicated WithXxx helper here.
+type PeerOptions struct {
+	NATPolicy          *NATPolicy
+	EventsLogger       event.SnowflakeEventReceiver
+	Proxy              *url.URL
+	BytesLogger        BytesLogger
+	DataChannelTimeout time.Duration
+	ICEFilter          func(net.IP) bool
+	TURNServers        []webrtc.ICEServer
+	TrickleICE         bool
 }
 
-// Deprecated: Use NewWebRTCPeerWithNatPolicyAndEventsAndProxy Instead.
-func NewWebRTCPeerWithEvents(
-	config *webrtc.Configuration, broker *BrokerChannel,
-	eventsLogger event.SnowflakeEventReceiver,
-) (*WebRTCPeer, error) {
-	return NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
-		config, broker, nil, eventsLogger, nil,
-	)
+// PeerOption configures a WebRTCPeer constructed by NewPeer. Write one
+// by taking and mutating a *PeerOptions, the same way WithNATPolicy and
+// the other With* helpers below do.
+type PeerOption func(*PeerOptions)
+
+// WithNATPolicy sets the NATPolicy that decides what NAT type, if any,
+// gets reported to the broker in place of the client's actual one.
+func WithNATPolicy(natPolicy *NATPolicy) PeerOption {
+	return func(o *PeerOptions) { o.NATPolicy = natPolicy }
 }
 
-// Deprecated: Use NewWebRTCPeerWithNatPolicyAndEventsAndProxy Instead.
-func NewWebRTCPeerWithEventsAndProxy(
-	config *webrtc.Configuration, broker *BrokerChannel,
-	eventsLogger event.SnowflakeEventReceiver, proxy *url.URL,
-) (*WebRTCPeer, error) {
-	return NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
-		config, broker, nil, eventsLogger, proxy,
-	)
+// WithEventsLogger sets the event.SnowflakeEventReceiver notified of
+// this peer's lifecycle events. Omitting it (or passing nil) gets a
+// dispatcher with no registered handlers.
+func WithEventsLogger(eventsLogger event.SnowflakeEventReceiver) PeerOption {
+	return func(o *PeerOptions) { o.EventsLogger = eventsLogger }
+}
+
+// WithProxy routes this peer's ICE traffic through a local SOCKS5 proxy.
+func WithProxy(proxy *url.URL) PeerOption {
+	return func(o *PeerOptions) { o.Proxy = proxy }
+}
+
+// WithBytesLogger sets the BytesLogger that observes this peer's
+// inbound/outbound byte counts. Omitting it logs nothing.
+func WithBytesLogger(bytesLogger BytesLogger) PeerOption {
+	return func(o *PeerOptions) { o.BytesLogger = bytesLogger }
+}
+
+// WithDataChannelTimeout overrides the default DataChannelTimeout for
+// how long this peer waits for its DataChannel to open before giving up
+// on the connection.
+func WithDataChannelTimeout(timeout time.Duration) PeerOption {
+	return func(o *PeerOptions) { o.DataChannelTimeout = timeout }
+}
+
+// WithICEFilter overrides preparePeerConnection's default policy of
+// excluding private/local addresses from gathered ICE candidates with a
+// caller-supplied predicate: filter returns true to keep a gathered
+// host candidate's IP.
+func WithICEFilter(filter func(net.IP) bool) PeerOption {
+	return func(o *PeerOptions) { o.ICEFilter = filter }
 }
 
-// NewWebRTCPeerWithNatPolicyAndEventsAndProxy constructs
-// a WebRTC PeerConnection to a snowflake proxy.
+// WithTURNServers appends servers to this peer's ICE server list,
+// leaving the *webrtc.Configuration passed to NewPeer itself untouched.
+func WithTURNServers(servers ...webrtc.ICEServer) PeerOption {
+	return func(o *PeerOptions) { o.TURNServers = append(o.TURNServers, servers...) }
+}
+
+// WithTrickleICE has this peer send its SDP offer to the broker as soon as
+// it's set as the local description, instead of waiting for ICE candidate
+// gathering to finish first, trickling gathered candidates to the broker
+// afterward. It only takes effect if broker's RendezvousMethod has
+// advertised trickle-ICE support (see BrokerChannel.SupportsTrickleICE);
+// otherwise this peer falls back to the non-trickle behavior regardless.
+func WithTrickleICE(trickleICE bool) PeerOption {
+	return func(o *PeerOptions) { o.TrickleICE = trickleICE }
+}
+
+// NewPeer constructs a WebRTC PeerConnection to a snowflake proxy,
+// signaling through broker. It replaces the historical
+// NewWebRTCPeer/NewWebRTCPeerWithEvents/NewWebRTCPeerWithEventsAndProxy/
+// NewWebRTCPeerWithNatPolicyAndEventsAndProxy constructors below, which
+// are now thin wrappers around it -- a new knob should be added here as
+// a PeerOption instead of yet another constructor name.
 //
 // The creation of the peer handles the signaling to the Snowflake broker, including
 // the exchange of SDP information, the creation of a PeerConnection, and the establishment
 // of a DataChannel to the Snowflake proxy.
-func NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
-	config *webrtc.Configuration, broker *BrokerChannel, natPolicy *NATPolicy,
-	eventsLogger event.SnowflakeEventReceiver, proxy *url.URL,
+func NewPeer(
+	config *webrtc.Configuration, broker *BrokerChannel, opts ...PeerOption,
 ) (*WebRTCPeer, error) {
-	if eventsLogger == nil {
-		eventsLogger = event.NewSnowflakeEventDispatcher()
+	var options PeerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.EventsLogger == nil {
+		options.EventsLogger = event.NewSnowflakeEventDispatcher()
 	}
 
 	connection := new(WebRTCPeer)
@@ -99,15 +163,33 @@ func NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
 	connection.closed = make(chan struct{})
 
 	// Override with something that's not NullLogger to have real logging.
-	connection.bytesLogger = &bytesNullLogger{}
+	connection.bytesLogger = options.BytesLogger
+	if connection.bytesLogger == nil {
+		connection.bytesLogger = &bytesNullLogger{}
+	}
 
 	// Pipes remain the same even when DataChannel gets switched.
 	connection.recvPipe, connection.writePipe = io.Pipe()
 
-	connection.eventsLogger = eventsLogger
-	connection.proxy = proxy
+	connection.eventsLogger = options.EventsLogger
+	connection.proxy = options.Proxy
+	connection.iceFilter = options.ICEFilter
+	connection.trickleICE = options.TrickleICE
+
+	connection.dataChannelTimeout = options.DataChannelTimeout
+	if connection.dataChannelTimeout <= 0 {
+		connection.dataChannelTimeout = DataChannelTimeout
+	}
+
+	if len(options.TURNServers) > 0 {
+		configWithTURN := *config
+		configWithTURN.ICEServers = append(
+			append([]webrtc.ICEServer{}, config.ICEServers...), options.TURNServers...,
+		)
+		config = &configWithTURN
+	}
 
-	err := connection.connect(config, broker, natPolicy)
+	err := connection.connect(config, broker, options.NATPolicy)
 	if err != nil {
 		connection.Close()
 		return nil, err
@@ -115,6 +197,40 @@ func NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
 	return connection, nil
 }
 
+// Deprecated: Use NewPeer instead.
+func NewWebRTCPeer(
+	config *webrtc.Configuration, broker *BrokerChannel,
+) (*WebRTCPeer, error) {
+	return NewPeer(config, broker)
+}
+
+// Deprecated: Use NewPeer instead.
+func NewWebRTCPeerWithEvents(
+	config *webrtc.Configuration, broker *BrokerChannel,
+	eventsLogger event.SnowflakeEventReceiver,
+) (*WebRTCPeer, error) {
+	return NewPeer(config, broker, WithEventsLogger(eventsLogger))
+}
+
+// Deprecated: Use NewPeer instead.
+func NewWebRTCPeerWithEventsAndProxy(
+	config *webrtc.Configuration, broker *BrokerChannel,
+	eventsLogger event.SnowflakeEventReceiver, proxy *url.URL,
+) (*WebRTCPeer, error) {
+	return NewPeer(config, broker, WithEventsLogger(eventsLogger), WithProxy(proxy))
+}
+
+// Deprecated: Use NewPeer instead.
+func NewWebRTCPeerWithNatPolicyAndEventsAndProxy(
+	config *webrtc.Configuration, broker *BrokerChannel, natPolicy *NATPolicy,
+	eventsLogger event.SnowflakeEventReceiver, proxy *url.URL,
+) (*WebRTCPeer, error) {
+	return NewPeer(
+		config, broker,
+		WithNATPolicy(natPolicy), WithEventsLogger(eventsLogger), WithProxy(proxy),
+	)
+}
+
 // Read bytes from local SOCKS.
 // As part of |io.ReadWriter|
 func (c *WebRTCPeer) Read(b []byte) (int, error) {
@@ -128,10 +244,16 @@ func (c *WebRTCPeer) Write(b []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	c.bytesLogger.addOutbound(int64(len(b)))
+	c.bytesLogger.AddOutbound(int64(len(b)))
 	return len(b), nil
 }
 
+// ID returns the peer's internally generated identifier, for correlating
+// events (such as EventOnICEStateChanged) back to a particular snowflake.
+func (c *WebRTCPeer) ID() string {
+	return c.id
+}
+
 // Closed returns a boolean indicated whether the peer is closed.
 func (c *WebRTCPeer) Closed() bool {
 	select {
@@ -191,7 +313,17 @@ func (c *WebRTCPeer) connect(
 ) error {
 	log.Println(c.id, " connecting...")
 
-	err := c.preparePeerConnection(config, broker.keepLocalAddresses)
+	if brokerTURN := broker.ICEServers(); len(brokerTURN) > 0 {
+		configWithBrokerTURN := *config
+		configWithBrokerTURN.ICEServers = append(
+			append([]webrtc.ICEServer{}, config.ICEServers...), brokerTURN...,
+		)
+		config = &configWithBrokerTURN
+	}
+
+	useTrickle := c.trickleICE && broker.SupportsTrickleICE()
+
+	err := c.preparePeerConnection(config, broker.keepLocalAddresses, broker.nat1To1Mappings, useTrickle)
 	localDescription := c.pc.LocalDescription()
 	c.eventsLogger.OnNewSnowflakeEvent(event.EventOnOfferCreated{
 		WebRTCLocalDescription: localDescription,
@@ -218,7 +350,14 @@ func (c *WebRTCPeer) connect(
 		log.Printf("natTypeToSend: \"%v\" (same as actualNatType)", natTypeToSend)
 	}
 
-	answer, err := broker.Negotiate(localDescription, natTypeToSend)
+	var answer *webrtc.SessionDescription
+	if useTrickle {
+		answer, err = broker.TrickleNegotiate(
+			localDescription, natTypeToSend, natPolicy, c.iceCandidates, c.iceCandidatesDone,
+		)
+	} else {
+		answer, err = broker.Negotiate(localDescription, natTypeToSend, natPolicy)
+	}
 	c.eventsLogger.OnNewSnowflakeEvent(event.EventOnBrokerRendezvous{
 		WebRTCRemoteDescription: answer,
 		Error:                   err,
@@ -239,7 +378,7 @@ func (c *WebRTCPeer) connect(
 		if natPolicy != nil {
 			natPolicy.Success(actualNatType, natTypeToSend)
 		}
-	case <-time.After(DataChannelTimeout):
+	case <-time.After(c.dataChannelTimeout):
 		c.transport.Close()
 		err := errors.New("timeout waiting for DataChannel.OnOpen")
 		if natPolicy != nil {
@@ -253,15 +392,43 @@ func (c *WebRTCPeer) connect(
 	return nil
 }
 
-// preparePeerConnection creates a new WebRTC PeerConnection and returns it
-// after non-trickle ICE candidate gathering is complete.
+// reportIfTURNAssigned fires EventOnTURNAssigned if c's selected ICE
+// candidate pair went through a TURN relay, once ICE has reached
+// ICEConnectionStateConnected.
+func (c *WebRTCPeer) reportIfTURNAssigned() {
+	pair, err := c.pc.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return
+	}
+	if pair.Local.Typ == webrtc.ICECandidateTypeRelay {
+		c.eventsLogger.OnNewSnowflakeEvent(event.EventOnTURNAssigned{PeerID: c.id})
+	}
+}
+
+// preparePeerConnection creates a new WebRTC PeerConnection. If useTrickle
+// is false, it returns only once ICE candidate gathering is complete, the
+// same as always before trickle ICE existed. If useTrickle is true, it
+// returns as soon as the offer is set as the local description, without
+// waiting for gathering to finish, and arranges for every gathered
+// candidate to be sent on c.iceCandidates (with c.iceCandidatesDone closed
+// once gathering completes) for BrokerChannel.TrickleNegotiate to relay.
 func (c *WebRTCPeer) preparePeerConnection(
 	config *webrtc.Configuration,
 	keepLocalAddresses bool,
+	nat1To1Mappings []string,
+	useTrickle bool,
 ) error {
 	s := webrtc.SettingEngine{}
 
-	if !keepLocalAddresses {
+	// A client behind a static NAT needs its gathered host candidates (which
+	// carry its private interface address) to survive the IP filter below
+	// so that SetNAT1To1IPs, further down, has a host candidate left to
+	// rewrite to the mapped external address.
+	switch {
+	case c.iceFilter != nil:
+		s.SetIPFilter(c.iceFilter)
+		s.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	case !keepLocalAddresses && len(nat1To1Mappings) == 0:
 		s.SetIPFilter(func(ip net.IP) (keep bool) {
 			// `IsLoopback()` and `IsUnspecified` are likely not neded here,
 			// but let's keep them just in case.
@@ -273,6 +440,12 @@ func (c *WebRTCPeer) preparePeerConnection(
 	}
 	s.SetIncludeLoopbackCandidate(keepLocalAddresses)
 
+	if len(nat1To1Mappings) > 0 {
+		// replace SDP host candidates with the given IP(s) without validation
+		// still have server reflexive candidates to fall back on
+		s.SetNAT1To1IPs(nat1To1Mappings, webrtc.ICECandidateTypeHost)
+	}
+
 	// Use the SetNet setting https://pkg.go.dev/github.com/pion/webrtc/v3#SettingEngine.SetNet
 	// to get snowflake working in shadow (where the AF_NETLINK family is not implemented).
 	// These two lines of code functionally revert a new change in pion by silently ignoring
@@ -296,6 +469,33 @@ func (c *WebRTCPeer) preparePeerConnection(
 		log.Printf("NewPeerConnection ERROR: %s", err)
 		return err
 	}
+	c.pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		c.eventsLogger.OnNewSnowflakeEvent(event.EventOnICEStateChanged{
+			PeerID: c.id,
+			State:  state.String(),
+		})
+		if state == webrtc.ICEConnectionStateConnected {
+			c.reportIfTURNAssigned()
+		}
+	})
+	if useTrickle {
+		// Buffered so OnICECandidate, called from pion's own goroutine,
+		// doesn't block on TrickleNegotiate's drain goroutine starting up.
+		c.iceCandidates = make(chan webrtc.ICECandidateInit, 16)
+		c.iceCandidatesDone = make(chan struct{})
+		c.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			if candidate == nil {
+				// nil marks the end of gathering.
+				close(c.iceCandidatesDone)
+				return
+			}
+			select {
+			case c.iceCandidates <- candidate.ToJSON():
+			default:
+				log.Println("WebRTC: dropping a trickle ICE candidate, buffer full")
+			}
+		})
+	}
 	ordered := true
 	dataChannelOptions := &webrtc.DataChannelInit{
 		Ordered: &ordered,
@@ -324,7 +524,7 @@ func (c *WebRTCPeer) preparePeerConnection(
 			log.Println("0 length message---")
 		}
 		n, err := c.writePipe.Write(msg.Data)
-		c.bytesLogger.addInbound(int64(n))
+		c.bytesLogger.AddInbound(int64(n))
 		if err != nil {
 			// TODO: Maybe shouldn't actually close.
 			log.Println("Error writing to SOCKS pipe")
@@ -349,6 +549,19 @@ func (c *WebRTCPeer) preparePeerConnection(
 	}
 	log.Println("WebRTC: Created offer")
 
+	if useTrickle {
+		// Start gathering candidates, and return as soon as the offer is
+		// set, without waiting for gathering to finish; OnICECandidate
+		// above streams candidates out as they're found instead.
+		if err := c.pc.SetLocalDescription(offer); err != nil {
+			log.Println("Failed to apply offer", err)
+			c.pc.Close()
+			return err
+		}
+		log.Println("WebRTC: Set local description (trickle ICE)")
+		return nil
+	}
+
 	// Allow candidates to accumulate until ICEGatheringStateComplete.
 	done := webrtc.GatheringCompletePromise(c.pc)
 	// Start gathering candidates
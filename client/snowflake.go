@@ -2,17 +2,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 
 	pt "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/goptlib"
@@ -21,6 +19,7 @@ import (
 	sf "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/client/lib"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/proxy"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/util"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/version"
 )
 
@@ -39,126 +38,6 @@ func (p ptEventLogger) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
 	pt.Log(pt.LogSeverityNotice, e.String())
 }
 
-// Exchanges bytes between two ReadWriters.
-// (In this case, between a SOCKS connection and a snowflake transport conn)
-func copyLoop(socks, sfconn io.ReadWriter) {
-	done := make(chan struct{}, 2)
-	go func() {
-		if _, err := io.Copy(socks, sfconn); err != nil {
-			log.Printf("copying Snowflake to SOCKS resulted in error: %v", err)
-		}
-		done <- struct{}{}
-	}()
-	go func() {
-		if _, err := io.Copy(sfconn, socks); err != nil {
-			log.Printf("copying SOCKS to Snowflake resulted in error: %v", err)
-		}
-		done <- struct{}{}
-	}()
-	<-done
-	log.Println("copy loop ended")
-}
-
-// Accept local SOCKS connections and connect to a Snowflake connection
-func socksAcceptLoop(ln *pt.SocksListener, config sf.ClientConfig, shutdown chan struct{}, wg *sync.WaitGroup) {
-	defer ln.Close()
-	for {
-		conn, err := ln.AcceptSocks()
-		if err != nil {
-			if err, ok := err.(net.Error); ok && err.Temporary() {
-				continue
-			}
-			log.Printf("SOCKS accept error: %s", err)
-			break
-		}
-		log.Printf("SOCKS accepted: %v", conn.Req)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			defer conn.Close()
-
-			// Check to see if our command line options are overriden by SOCKS options
-			if arg, ok := conn.Req.Args.Get("ampcache"); ok {
-				config.AmpCacheURL = arg
-			}
-			if arg, ok := conn.Req.Args.Get("sqsqueue"); ok {
-				config.SQSQueueURL = arg
-			}
-			if arg, ok := conn.Req.Args.Get("sqscreds"); ok {
-				config.SQSCredsStr = arg
-			}
-			if arg, ok := conn.Req.Args.Get("fronts"); ok {
-				if arg != "" {
-					config.FrontDomains = strings.Split(strings.TrimSpace(arg), ",")
-				}
-			} else if arg, ok := conn.Req.Args.Get("front"); ok {
-				config.FrontDomains = strings.Split(strings.TrimSpace(arg), ",")
-			}
-			if arg, ok := conn.Req.Args.Get("ice"); ok {
-				config.ICEAddresses = strings.Split(strings.TrimSpace(arg), ",")
-			}
-			if arg, ok := conn.Req.Args.Get("max"); ok {
-				max, err := strconv.Atoi(arg)
-				if err != nil {
-					conn.Reject()
-					log.Println("Invalid SOCKS arg: max=", arg)
-					return
-				}
-				config.Max = max
-			}
-			if arg, ok := conn.Req.Args.Get("url"); ok {
-				config.BrokerURL = arg
-			}
-			if arg, ok := conn.Req.Args.Get("utls-nosni"); ok {
-				switch strings.ToLower(arg) {
-				case "true":
-					fallthrough
-				case "yes":
-					config.UTLSRemoveSNI = true
-				}
-			}
-			if arg, ok := conn.Req.Args.Get("utls-imitate"); ok {
-				config.UTLSClientID = arg
-			}
-			if arg, ok := conn.Req.Args.Get("fingerprint"); ok {
-				config.BridgeFingerprint = arg
-			}
-			transport, err := sf.NewSnowflakeClient(config)
-			if err != nil {
-				conn.Reject()
-				log.Println("Failed to start snowflake transport: ", err)
-				return
-			}
-			transport.AddSnowflakeEventListener(NewPTEventLogger())
-			err = conn.Grant(&net.TCPAddr{IP: net.IPv4zero, Port: 0})
-			if err != nil {
-				log.Printf("conn.Grant error: %s", err)
-				return
-			}
-
-			handler := make(chan struct{})
-			go func() {
-				defer close(handler)
-				sconn, err := transport.Dial()
-				if err != nil {
-					log.Printf("dial error: %s", err)
-					return
-				}
-				defer sconn.Close()
-				// copy between the created Snowflake conn and the SOCKS conn
-				copyLoop(conn, sconn)
-			}()
-			select {
-			case <-shutdown:
-				log.Println("Received shutdown signal")
-			case <-handler:
-				log.Println("Handler ended")
-			}
-			return
-		}()
-	}
-}
-
 func main() {
 	iceServersCommas := flag.String("ice", "", "comma-separated list of ICE servers")
 	brokerURL := flag.String("url", "", "URL of signaling broker")
@@ -167,6 +46,14 @@ func main() {
 	ampCacheURL := flag.String("ampcache", "", "URL of AMP cache to use as a proxy for signaling")
 	sqsQueueURL := flag.String("sqsqueue", "", "URL of SQS Queue to use as a proxy for signaling")
 	sqsCredsStr := flag.String("sqscreds", "", "credentials to access SQS Queue")
+	queueKind := flag.String("queue", "", "message-queue rendezvous backend to use (redis or s3), instead of sqsqueue/sqscreds")
+	queueEndpoint := flag.String("queue-endpoint", "", "address of the -queue backend (e.g. a Redis host:port)")
+	queueCreds := flag.String("queue-creds", "", "credentials to authenticate to the -queue backend")
+	sdpSetupRole := flag.String("sdp-setup-role", "", "rewrite the offer's a=setup: attribute to this role (\"actpass\" or \"active\"), for SDP-shaping experiments")
+	sdpFingerprintAlgo := flag.String("sdp-fingerprint-algo", "", "rewrite the offer's a=fingerprint: hash function name to this value, for SDP-shaping experiments")
+	sdpDataChannelOnly := flag.Bool("sdp-data-channel-only", false, "drop any non-application media sections from the offer SDP")
+	sdpRestrictICEToUDP := flag.Bool("sdp-restrict-ice-udp", false, "drop TCP ICE candidates from the offer SDP")
+	natMappingsCommas := flag.String("nat-mapping", "", "comma-separated list of 1:1 NAT IP mappings (\"external\" or \"internal=external\") to advertise as SDP host candidates, for clients behind a static NAT")
 	logFilename := flag.String("log", "", "name of log file")
 	logToStateDir := flag.Bool("log-to-state-dir", false, "resolve the log file relative to tor's pt state dir")
 	keepLocalAddresses := flag.Bool("keep-local-addresses", false, "keep local LAN address ICE candidates.\nThis is usually pointless because Snowflake proxies don't usually reside on the same local network as the client.")
@@ -232,14 +119,22 @@ func main() {
 	}
 
 	config := sf.ClientConfig{
-		BrokerURL:          *brokerURL,
-		AmpCacheURL:        *ampCacheURL,
-		SQSQueueURL:        *sqsQueueURL,
-		SQSCredsStr:        *sqsCredsStr,
-		FrontDomains:       frontDomains,
-		ICEAddresses:       iceAddresses,
-		KeepLocalAddresses: *keepLocalAddresses || *oldKeepLocalAddresses,
-		Max:                *max,
+		BrokerURL:           *brokerURL,
+		AmpCacheURL:         *ampCacheURL,
+		SQSQueueURL:         *sqsQueueURL,
+		SQSCredsStr:         *sqsCredsStr,
+		QueueKind:           *queueKind,
+		QueueEndpoint:       *queueEndpoint,
+		QueueCreds:          *queueCreds,
+		SDPSetupRole:        *sdpSetupRole,
+		SDPFingerprintAlgo:  *sdpFingerprintAlgo,
+		SDPDataChannelOnly:  *sdpDataChannelOnly,
+		SDPRestrictICEToUDP: *sdpRestrictICEToUDP,
+		NAT1To1Mappings:     util.ParseNAT1To1Mappings(*natMappingsCommas),
+		FrontDomains:        frontDomains,
+		ICEAddresses:        iceAddresses,
+		KeepLocalAddresses:  *keepLocalAddresses || *oldKeepLocalAddresses,
+		Max:                 *max,
 	}
 
 	// Begin goptlib client process.
@@ -264,9 +159,8 @@ func main() {
 		}
 	}
 	pt.ReportVersion("snowflake-client", version.GetVersion())
-	listeners := make([]net.Listener, 0)
-	shutdown := make(chan struct{})
-	var wg sync.WaitGroup
+
+	runner := sf.NewRunner(config, NewPTEventLogger())
 	for _, methodName := range ptInfo.MethodNames {
 		switch methodName {
 		case "snowflake":
@@ -277,15 +171,23 @@ func main() {
 				break
 			}
 			log.Printf("Started SOCKS listener at %v.", ln.Addr())
-			go socksAcceptLoop(ln, config, shutdown, &wg)
+			runner.AddSocksListener(ln)
 			pt.Cmethod(methodName, ln.Version(), ln.Addr())
-			listeners = append(listeners, ln)
 		default:
 			pt.CmethodError(methodName, "no such method")
 		}
 	}
 	pt.CmethodsDone()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		if err := runner.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("runner stopped: %v", err)
+		}
+	}()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM)
 
@@ -306,10 +208,7 @@ func main() {
 	log.Println("stopping snowflake")
 
 	// Signal received, shut down.
-	for _, ln := range listeners {
-		ln.Close()
-	}
-	close(shutdown)
-	wg.Wait()
+	cancel()
+	<-runDone
 	log.Println("snowflake is done.")
 }
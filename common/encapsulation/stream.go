@@ -0,0 +1,96 @@
+package encapsulation
+
+import (
+	"io"
+)
+
+// maxRecordData is the largest data length a single data or padding record
+// can carry, the ceiling imposed by a 3-byte length prefix (see
+// TestReadLimits/TestWriteLimits).
+const maxRecordData = (0x3f << 14) | (0x7f << 7) | 0x7f
+
+// Reader presents a sequence of encapsulation records, read from an
+// underlying io.Reader, as an ordinary byte stream. Padding records (and
+// empty data records, which Writer's Flush uses as an explicit marker) are
+// skipped transparently, exactly as a single ReadData call would skip them;
+// Reader's contribution is refilling an internal, record-sized buffer as
+// the caller drains it with arbitrarily small Read calls, so a caller
+// proxying a stream doesn't have to size its own buffer to the largest
+// record that might appear on the wire.
+type Reader struct {
+	r   io.Reader
+	buf [maxRecordData]byte
+	pos int
+	end int
+}
+
+// NewReader wraps r, an encapsulation-framed stream, presenting its data
+// records as an ordinary byte stream.
+func NewReader(r io.Reader) io.Reader {
+	return &Reader{r: r}
+}
+
+func (sr *Reader) Read(p []byte) (int, error) {
+	for sr.pos == sr.end {
+		// buf is sized to maxRecordData, the largest record ReadData can
+		// produce, so this can never return io.ErrShortBuffer.
+		n, err := ReadData(sr.r, sr.buf[:])
+		if err != nil {
+			return 0, err
+		}
+		sr.pos, sr.end = 0, n
+	}
+	n := copy(p, sr.buf[sr.pos:sr.end])
+	sr.pos += n
+	return n, nil
+}
+
+// Writer presents an ordinary byte stream as a sequence of encapsulation
+// data records written to an underlying io.Writer. Each Write call is
+// chunked into records no larger than MaxDataForSize(maxRecordData) bytes
+// and emitted immediately, so a single large Write doesn't require
+// buffering it all in memory first; a Write spanning several records either
+// completes in full or returns the number of bytes in the records that were
+// successfully written before the first error.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w so that data written to it is framed as a sequence of
+// encapsulation data records.
+func NewWriter(w io.Writer) io.WriteCloser {
+	return &Writer{w: w}
+}
+
+func (sw *Writer) Write(p []byte) (int, error) {
+	maxChunk := MaxDataForSize(maxRecordData)
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		if _, err := WriteData(sw.w, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Flush writes an explicit, empty data record. Reader's Read skips over it
+// transparently, the same as padding, so it carries no data of its own;
+// it's meant for a caller that wants some observable signal (an
+// application-level keepalive, say) that Write alone doesn't provide, since
+// Writer never emits a record unless asked to.
+func (sw *Writer) Flush() error {
+	_, err := WriteData(sw.w, nil)
+	return err
+}
+
+// Close satisfies io.WriteCloser. Writer never buffers bytes across Write
+// calls, so there is nothing pending to flush; it does not close w.
+func (sw *Writer) Close() error {
+	return nil
+}
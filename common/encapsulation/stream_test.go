@@ -0,0 +1,100 @@
+package encapsulation
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// Test that reading a Writer's output back through a Reader, in a variety
+// of write and read chunk sizes, recovers the original stream.
+func TestStreamRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	original := pseudorandomBuffer(1 << 20)
+	for _, writeChunk := range []int{1, 17, 0x3f, 0x10001, len(original)} {
+		var enc bytes.Buffer
+		w := NewWriter(&enc)
+		for i := 0; i < len(original); i += writeChunk {
+			end := i + writeChunk
+			if end > len(original) {
+				end = len(original)
+			}
+			n, err := w.Write(original[i:end])
+			if err != nil {
+				t.Fatalf("writeChunk %d: Write returned error %v", writeChunk, err)
+			}
+			if n != end-i {
+				t.Fatalf("writeChunk %d: wrote %d bytes, expected %d", writeChunk, n, end-i)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("writeChunk %d: Close returned error %v", writeChunk, err)
+		}
+
+		r := NewReader(&enc)
+		recovered, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("writeChunk %d: ReadAll returned error %v", writeChunk, err)
+		}
+		if !bytes.Equal(recovered, original) {
+			t.Fatalf("writeChunk %d: recovered data did not match original", writeChunk)
+		}
+	}
+}
+
+// Test that Reader serves a record's bytes out one small Read at a time,
+// refilling its internal buffer only when fully drained.
+func TestStreamReaderSmallReads(t *testing.T) {
+	t.Parallel()
+
+	original := []byte("hello world")
+	var enc bytes.Buffer
+	if _, err := WriteData(&enc, original); err != nil {
+		t.Fatalf("WriteData returned error %v", err)
+	}
+
+	r := NewReader(&enc)
+	var got []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("Read returned error %v", err)
+			}
+			break
+		}
+	}
+	if !bytes.Equal(got, original) {
+		t.Fatalf("got <%x>, expected <%x>", got, original)
+	}
+}
+
+// Test that Reader skips transparently over padding and over the empty data
+// record that Writer.Flush emits.
+func TestStreamReaderSkipsPaddingAndFlush(t *testing.T) {
+	t.Parallel()
+
+	var enc bytes.Buffer
+	w := NewWriter(&enc)
+	if _, err := WritePadding(&enc, 20); err != nil {
+		t.Fatalf("WritePadding returned error %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush returned error %v", err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+
+	r := NewReader(&enc)
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll returned error %v", err)
+	}
+	if !bytes.Equal(got, []byte("data")) {
+		t.Fatalf("got <%x>, expected <%x>", got, []byte("data"))
+	}
+}
@@ -0,0 +1,154 @@
+package event
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// unfilteredListenerBufferSize is the channel capacity
+// AddSnowflakeEventListener gives its filter=always-true subscription, so
+// the original "every listener sees every event" behavior holds in
+// practice: only a listener that falls far behind this many events will
+// ever see a drop, rather than the deliberately tight bound
+// AddSnowflakeEventListenerFor callers opt into directly.
+const unfilteredListenerBufferSize = 4096
+
+// listenerBufferSize is the channel capacity AddSnowflakeEventListenerFor
+// gives a filtered subscription by default.
+const listenerBufferSize = 64
+
+// subscription is one listener's bounded mailbox: OnNewSnowflakeEvent
+// enqueues onto ch under a drop-oldest policy and a dedicated goroutine
+// (started by addListener) drains it into the listener's own
+// OnNewSnowflakeEvent, so a slow listener can only ever fall behind and
+// drop its own events -- it can't block the dispatcher or any other
+// listener.
+type subscription struct {
+	filter  func(SnowflakeEvent) bool
+	ch      chan SnowflakeEvent
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// enqueue delivers event to s.ch, dropping the oldest still-queued event
+// to make room if it's full, so enqueue itself never blocks the caller.
+// It yields between eviction attempts so the drain goroutine gets a chance
+// to make real progress under a sustained burst, rather than racing it for
+// the same slot on a single OS thread.
+func (s *subscription) enqueue(event SnowflakeEvent) {
+	for {
+		select {
+		case s.ch <- event:
+			return
+		default:
+		}
+
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// snowflakeEventDispatcher is the SnowflakeEventDispatcher
+// NewSnowflakeEventDispatcher returns.
+type snowflakeEventDispatcher struct {
+	mu   sync.Mutex
+	subs map[SnowflakeEventReceiver]*subscription
+}
+
+// NewSnowflakeEventDispatcher constructs an empty SnowflakeEventDispatcher.
+func NewSnowflakeEventDispatcher() SnowflakeEventDispatcher {
+	return &snowflakeEventDispatcher{
+		subs: make(map[SnowflakeEventReceiver]*subscription),
+	}
+}
+
+// AddSnowflakeEventListener registers receiver for every event, via
+// AddSnowflakeEventListenerFor with an always-true filter and a buffer
+// large enough that a typical listener will never observe a drop.
+func (d *snowflakeEventDispatcher) AddSnowflakeEventListener(receiver SnowflakeEventReceiver) {
+	d.addListener(receiver, func(SnowflakeEvent) bool { return true }, unfilteredListenerBufferSize)
+}
+
+// AddSnowflakeEventListenerFor registers receiver for only the events
+// filter returns true for, behind a small bounded mailbox: see
+// subscription and Stats.
+func (d *snowflakeEventDispatcher) AddSnowflakeEventListenerFor(filter func(SnowflakeEvent) bool, receiver SnowflakeEventReceiver) {
+	d.addListener(receiver, filter, listenerBufferSize)
+}
+
+func (d *snowflakeEventDispatcher) addListener(receiver SnowflakeEventReceiver, filter func(SnowflakeEvent) bool, bufferSize int) {
+	sub := &subscription{
+		filter: filter,
+		ch:     make(chan SnowflakeEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	d.subs[receiver] = sub
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case event := <-sub.ch:
+				receiver.OnNewSnowflakeEvent(event)
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+}
+
+// RemoveSnowflakeEventListener unregisters receiver and stops the
+// goroutine draining its mailbox. Any event still queued for it at the
+// time of removal is discarded rather than delivered.
+func (d *snowflakeEventDispatcher) RemoveSnowflakeEventListener(receiver SnowflakeEventReceiver) {
+	d.mu.Lock()
+	sub, ok := d.subs[receiver]
+	if ok {
+		delete(d.subs, receiver)
+	}
+	d.mu.Unlock()
+
+	if ok {
+		close(sub.done)
+	}
+}
+
+// OnNewSnowflakeEvent enqueues event onto every subscription whose filter
+// accepts it. It never blocks: each subscription's own enqueue drops that
+// subscription's oldest queued event rather than waiting for a slow
+// listener to catch up.
+func (d *snowflakeEventDispatcher) OnNewSnowflakeEvent(event SnowflakeEvent) {
+	d.mu.Lock()
+	subs := make([]*subscription, 0, len(d.subs))
+	for _, sub := range d.subs {
+		subs = append(subs, sub)
+	}
+	d.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.filter(event) {
+			sub.enqueue(event)
+		}
+	}
+}
+
+// Stats reports, for every currently registered listener, how many events
+// it has missed because its mailbox was full when OnNewSnowflakeEvent
+// tried to enqueue onto it.
+func (d *snowflakeEventDispatcher) Stats() map[SnowflakeEventReceiver]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make(map[SnowflakeEventReceiver]int64, len(d.subs))
+	for receiver, sub := range d.subs {
+		stats[receiver] = sub.dropped.Load()
+	}
+	return stats
+}
@@ -1,44 +1,139 @@
 package event
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
-type stubReceiver struct {
+// countingReceiver counts how many events it's been given, optionally
+// sleeping first to stand in for a slow listener.
+type countingReceiver struct {
+	mu      sync.Mutex
 	counter int
+	delay   time.Duration
 }
 
-func (s *stubReceiver) OnNewSnowflakeEvent(event SnowflakeEvent) {
+func (s *countingReceiver) OnNewSnowflakeEvent(event SnowflakeEvent) {
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+	s.mu.Lock()
 	s.counter++
+	s.mu.Unlock()
+}
+
+func (s *countingReceiver) Counter() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counter
+}
+
+// waitUntil polls cond until it returns true, failing t if timeout elapses
+// first. OnNewSnowflakeEvent dispatches through a per-listener mailbox
+// drained by its own goroutine, so a test can't assume delivery has
+// happened the instant OnNewSnowflakeEvent returns.
+func waitUntil(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
 }
 
 func TestBusDispatch(t *testing.T) {
 	t.Parallel()
 
 	EventBus := NewSnowflakeEventDispatcher()
-	StubReceiverA := &stubReceiver{}
-	StubReceiverB := &stubReceiver{}
+	StubReceiverA := &countingReceiver{}
+	StubReceiverB := &countingReceiver{}
 	EventBus.AddSnowflakeEventListener(StubReceiverA)
 	EventBus.AddSnowflakeEventListener(StubReceiverB)
-	if StubReceiverA.counter != 0 {
-		t.Fatalf("expected StubReceiverA.counter == 0, got %d", StubReceiverA.counter)
+	if StubReceiverA.Counter() != 0 {
+		t.Fatalf("expected StubReceiverA.counter == 0, got %d", StubReceiverA.Counter())
 	}
-	if StubReceiverB.counter != 0 {
-		t.Fatalf("expected StubReceiverB.counter == 0, got %d", StubReceiverB.counter)
+	if StubReceiverB.Counter() != 0 {
+		t.Fatalf("expected StubReceiverB.counter == 0, got %d", StubReceiverB.Counter())
 	}
+
 	EventBus.OnNewSnowflakeEvent(EventOnSnowflakeConnected{})
-	if StubReceiverA.counter != 1 {
-		t.Fatalf("expected StubReceiverA.counter == 1, got %d", StubReceiverA.counter)
-	}
-	if StubReceiverB.counter != 1 {
-		t.Fatalf("expected StubReceiverB.counter == 1, got %d", StubReceiverB.counter)
-	}
+	waitUntil(t, time.Second, func() bool { return StubReceiverA.Counter() == 1 })
+	waitUntil(t, time.Second, func() bool { return StubReceiverB.Counter() == 1 })
+
 	EventBus.RemoveSnowflakeEventListener(StubReceiverB)
 	EventBus.OnNewSnowflakeEvent(EventOnSnowflakeConnected{})
-	if StubReceiverA.counter != 2 {
-		t.Fatalf("expected StubReceiverA.counter == 2, got %d", StubReceiverA.counter)
+	waitUntil(t, time.Second, func() bool { return StubReceiverA.Counter() == 2 })
+
+	// StubReceiverB was removed before the second event; give any errant
+	// delivery a moment to (not) arrive before asserting it never grew.
+	time.Sleep(20 * time.Millisecond)
+	if StubReceiverB.Counter() != 1 {
+		t.Fatalf("expected StubReceiverB.counter == 1, got %d", StubReceiverB.Counter())
 	}
-	if StubReceiverB.counter != 1 {
-		t.Fatalf("expected StubReceiverB.counter == 1, got %d", StubReceiverB.counter)
+}
+
+func TestAddSnowflakeEventListenerForFiltersEvents(t *testing.T) {
+	t.Parallel()
+
+	bus := NewSnowflakeEventDispatcher()
+	onlyConnected := &countingReceiver{}
+	bus.AddSnowflakeEventListenerFor(func(event SnowflakeEvent) bool {
+		_, ok := event.(EventOnSnowflakeConnected)
+		return ok
+	}, onlyConnected)
+
+	bus.OnNewSnowflakeEvent(EventOnSnowflakeConnected{})
+	bus.OnNewSnowflakeEvent(EventOnProxyStarting{})
+	bus.OnNewSnowflakeEvent(EventOnSnowflakeConnected{})
+
+	waitUntil(t, time.Second, func() bool { return onlyConnected.Counter() == 2 })
+
+	// Give the filtered-out EventOnProxyStarting a moment to (not) arrive.
+	time.Sleep(20 * time.Millisecond)
+	if c := onlyConnected.Counter(); c != 2 {
+		t.Fatalf("expected 2 filtered events delivered, got %d", c)
+	}
+}
+
+// TestSlowListenerDropsInsteadOfBlocking registers a deliberately slow
+// listener alongside a fast one and pushes thousands of events: the fast
+// listener must still receive every one, and the slow listener must fall
+// behind and report drops via Stats instead of the dispatcher deadlocking
+// on it.
+func TestSlowListenerDropsInsteadOfBlocking(t *testing.T) {
+	t.Parallel()
+
+	// totalEvents stays comfortably under unfilteredListenerBufferSize so
+	// fast, draining near-instantly, is never expected to drop; slow's
+	// much smaller buffer and per-event delay guarantee it falls behind
+	// regardless.
+	const totalEvents = 2000
+
+	bus := NewSnowflakeEventDispatcher()
+
+	fast := &countingReceiver{}
+	slow := &countingReceiver{delay: time.Millisecond}
+
+	bus.AddSnowflakeEventListener(fast)
+	bus.AddSnowflakeEventListenerFor(func(SnowflakeEvent) bool { return true }, slow)
+
+	for i := 0; i < totalEvents; i++ {
+		bus.OnNewSnowflakeEvent(EventOnSnowflakeConnected{})
+	}
+
+	waitUntil(t, 5*time.Second, func() bool { return fast.Counter() == totalEvents })
+
+	// Every event was either delivered to slow or dropped from its
+	// mailbox to make room for a newer one; wait for the drain goroutine
+	// to work through whatever is still queued before checking either.
+	waitUntil(t, 5*time.Second, func() bool {
+		return slow.Counter()+int(bus.Stats()[slow]) == totalEvents
+	})
+
+	if dropped := bus.Stats()[slow]; dropped == 0 {
+		t.Fatal("expected the slow listener to have dropped events")
 	}
 }
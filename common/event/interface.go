@@ -59,8 +59,13 @@ func (e EventOnSnowflakeConnectionFailed) String() string {
 	return fmt.Sprintf("trying a new proxy: %s", scrubbed)
 }
 
+// EventOnProxyStarting reports that a proxy has begun its startup sequence.
+// Version, if set, is the running build's version string (see
+// common/version.GetVersion), so a listener like a Prometheus exporter can
+// publish a build_info-style gauge without importing common/version itself.
 type EventOnProxyStarting struct {
 	SnowflakeEvent
+	Version string
 }
 
 func (e EventOnProxyStarting) String() string {
@@ -79,6 +84,9 @@ type EventOnProxyConnectionOver struct {
 	SnowflakeEvent
 	InboundTraffic  int64
 	OutboundTraffic int64
+	// Country is the client's country, when known from the broker offer;
+	// empty otherwise.
+	Country string
 }
 
 func (e EventOnProxyConnectionOver) String() string {
@@ -88,19 +96,50 @@ func (e EventOnProxyConnectionOver) String() string {
 type EventOnProxyStats struct {
 	SnowflakeEvent
 	ConnectionCount             int
+	FailedConnectionCount       uint
 	InboundBytes, OutboundBytes int64
 	InboundUnit, OutboundUnit   string
 	SummaryInterval             time.Duration
 }
 
 func (e EventOnProxyStats) String() string {
-	statString := fmt.Sprintf("In the last %v, there were %v completed connections. Traffic Relayed ↓ %v %v (%.2f %v%s), ↑ %v %v (%.2f %v%s).",
-		e.SummaryInterval.String(), e.ConnectionCount,
+	statString := fmt.Sprintf("In the last %v, there were %v completed connections and %v failed connections. Traffic Relayed ↓ %v %v (%.2f %v%s), ↑ %v %v (%.2f %v%s).",
+		e.SummaryInterval.String(), e.ConnectionCount, e.FailedConnectionCount,
 		e.InboundBytes, e.InboundUnit, float64(e.InboundBytes)/e.SummaryInterval.Seconds(), e.InboundUnit, "/s",
 		e.OutboundBytes, e.OutboundUnit, float64(e.OutboundBytes)/e.SummaryInterval.Seconds(), e.OutboundUnit, "/s")
 	return statString
 }
 
+// EventOnProxyLifetimeStats reports the full history periodicProxyStats
+// keeps for a long-lived proxy: cumulative totals since Since (the proxy's
+// start, or whenever its state file was first created if it survived a
+// restart), plus Window, a rolling breakdown of the most recent buckets
+// (see LifetimeStatsBucket) for an operator or exporter that wants more
+// than a single lifetime number -- e.g. "traffic over the last 24h".
+type EventOnProxyLifetimeStats struct {
+	SnowflakeEvent
+	Since                                 time.Time
+	TotalConnectionCount                  int
+	TotalFailedConnectionCount            uint
+	TotalInboundBytes, TotalOutboundBytes int64
+	Window                                []LifetimeStatsBucket
+}
+
+func (e EventOnProxyLifetimeStats) String() string {
+	return fmt.Sprintf("Since %v: %v completed connections, %v failed connections, %d bytes in, %d bytes out.",
+		e.Since.Format(time.RFC3339), e.TotalConnectionCount, e.TotalFailedConnectionCount, e.TotalInboundBytes, e.TotalOutboundBytes)
+}
+
+// LifetimeStatsBucket is one fixed-width time slice (see
+// periodicProxyStats' bucketInterval) of EventOnProxyLifetimeStats.Window,
+// covering [Start, Start+bucket width).
+type LifetimeStatsBucket struct {
+	Start                       time.Time
+	ConnectionCount             int
+	FailedConnectionCount       uint
+	InboundBytes, OutboundBytes int64
+}
+
 type EventOnCurrentNATTypeDetermined struct {
 	SnowflakeEvent
 	CurNATType string
@@ -110,6 +149,227 @@ func (e EventOnCurrentNATTypeDetermined) String() string {
 	return fmt.Sprintf("NAT type: %v", e.CurNATType)
 }
 
+// EventOnNATBehaviorDetermined reports the result of the full RFC 5780
+// mapping/filtering classification, as opposed to the single restricted/
+// unrestricted bit carried by EventOnCurrentNATTypeDetermined.
+type EventOnNATBehaviorDetermined struct {
+	SnowflakeEvent
+	Mapping         string
+	Filtering       string
+	MappingLifetime time.Duration
+}
+
+func (e EventOnNATBehaviorDetermined) String() string {
+	return fmt.Sprintf("NAT mapping: %v, filtering: %v, mapping lifetime: %v", e.Mapping, e.Filtering, e.MappingLifetime)
+}
+
+// EventOnBrokerRendezvousStarted reports that a client has begun a broker
+// poll for a new snowflake, before the outcome (EventOnBrokerRendezvous) is
+// known. Embedders use it to distinguish "still looking for a proxy" from
+// "stalled" in a progress UI.
+type EventOnBrokerRendezvousStarted struct {
+	SnowflakeEvent
+}
+
+func (e EventOnBrokerRendezvousStarted) String() string {
+	return "broker rendezvous started"
+}
+
+// EventOnICEStateChanged reports a WebRTCPeer's ICE connection state as it
+// progresses through gathering, checking, connected, and (on failure)
+// disconnected/failed, identified by PeerID so an embedder can track several
+// concurrently negotiating snowflakes.
+type EventOnICEStateChanged struct {
+	SnowflakeEvent
+	PeerID string
+	State  string
+}
+
+func (e EventOnICEStateChanged) String() string {
+	return fmt.Sprintf("snowflake %s ICE state: %s", e.PeerID, e.State)
+}
+
+// EventOnTunnelFirstByte reports that the first byte of application data has
+// passed through the tunnel on a given connection, the signal an embedder
+// typically uses to dismiss a "connecting..." progress indicator.
+type EventOnTunnelFirstByte struct {
+	SnowflakeEvent
+}
+
+func (e EventOnTunnelFirstByte) String() string {
+	return "first byte through tunnel"
+}
+
+// EventOnSnowflakeChurn reports a change in the number of currently active,
+// multiplexed snowflake proxy connections, so an embedder can show how many
+// of its configured Max snowflakes are actually in use.
+type EventOnSnowflakeChurn struct {
+	SnowflakeEvent
+	Active int
+	Max    int
+}
+
+func (e EventOnSnowflakeChurn) String() string {
+	return fmt.Sprintf("active snowflakes: %d/%d", e.Active, e.Max)
+}
+
+// EventOnTURNAssigned reports that a WebRTCPeer's selected ICE candidate
+// pair ended up going through a TURN relay, once ICE reaches
+// ICEConnectionStateConnected, so an embedder can tell a restricted-NAT
+// user their connection needed a relay rather than a direct or
+// server-reflexive path.
+type EventOnTURNAssigned struct {
+	SnowflakeEvent
+	PeerID string
+}
+
+func (e EventOnTURNAssigned) String() string {
+	return fmt.Sprintf("snowflake %s connected via TURN relay", e.PeerID)
+}
+
+// EventOnBrokerDemoted reports that a proxy's broker pool stopped using
+// BrokerURL after consecutive rendezvous failures, and is backing off from it
+// for a while in favor of another configured broker.
+type EventOnBrokerDemoted struct {
+	SnowflakeEvent
+	BrokerURL           string
+	ConsecutiveFailures int
+}
+
+func (e EventOnBrokerDemoted) String() string {
+	return fmt.Sprintf("broker %s demoted after %d consecutive failures", e.BrokerURL, e.ConsecutiveFailures)
+}
+
+// EventOnBrokerPromoted reports that a previously demoted broker in a proxy's
+// broker pool answered successfully again and is back in rotation.
+type EventOnBrokerPromoted struct {
+	SnowflakeEvent
+	BrokerURL string
+}
+
+func (e EventOnBrokerPromoted) String() string {
+	return fmt.Sprintf("broker %s back in rotation", e.BrokerURL)
+}
+
+// EventOnClientThrottled reports that a proxy applied its configured
+// PerClientBytesPerSec/PerClientBurst/MaxNewClientsPerMinute shaping against
+// a client -- either declining a new offer outright or capping an
+// already-open session's bandwidth -- so an embedder can tell the operator
+// or user their proxy is rate limiting traffic.
+type EventOnClientThrottled struct {
+	SnowflakeEvent
+	Reason string
+}
+
+func (e EventOnClientThrottled) String() string {
+	return fmt.Sprintf("client throttled: %s", e.Reason)
+}
+
+// EventOnProxySessionStarted reports that a proxy has begun relaying a new
+// client session in datachannelHandler, before its outcome
+// (EventOnProxySessionEnded) is known. Unlike EventOnProxyClientConnected,
+// which fires per WebRTC DataChannel, this fires once per client session
+// attempt, including ones that never reach a DataChannel at all (e.g. a
+// relay dial failure).
+type EventOnProxySessionStarted struct {
+	SnowflakeEvent
+	RemoteAddr string
+}
+
+func (e EventOnProxySessionStarted) String() string {
+	return "proxy session started"
+}
+
+// EventOnProxySessionEnded reports the outcome of a client session started
+// by EventOnProxySessionStarted: BytesIn/BytesOut and Duration cover the
+// whole session, not just one DataChannel, and Err is set if the session
+// never relayed any traffic (e.g. the relay dial failed).
+type EventOnProxySessionEnded struct {
+	SnowflakeEvent
+	BytesIn, BytesOut int64
+	Duration          time.Duration
+	RemoteAddr        string
+	Err               error
+}
+
+func (e EventOnProxySessionEnded) String() string {
+	if e.Err != nil {
+		scrubbed := safelog.Scrub([]byte(e.Err.Error()))
+		return fmt.Sprintf("proxy session ended after %v: %s", e.Duration, scrubbed)
+	}
+	return fmt.Sprintf("proxy session ended after %v: %d bytes in, %d bytes out", e.Duration, e.BytesIn, e.BytesOut)
+}
+
+// EventOnProxyNegotiationFailed reports that a proxy gave up on a client
+// rendezvous before any traffic could be relayed -- a bad relay URL from the
+// broker, a PeerConnection that failed to set up, a broker answer that
+// couldn't be delivered, or a client that never opened its DataChannel --
+// identified by a short machine-readable Reason so an embedder or metrics
+// collector can alert on client-negotiation failures without tailing logs.
+type EventOnProxyNegotiationFailed struct {
+	SnowflakeEvent
+	Reason string
+}
+
+func (e EventOnProxyNegotiationFailed) String() string {
+	return fmt.Sprintf("proxy negotiation failed: %s", e.Reason)
+}
+
+// EventOnAdmissionCapacityChanged reports that a proxy's admission
+// controller (see snowflake_proxy's tokens_t) ramped its concurrent-session
+// Capacity up or down in response to sustained utilization, with Clients
+// the number of sessions in flight at the moment of the change.
+type EventOnAdmissionCapacityChanged struct {
+	SnowflakeEvent
+	Capacity int64
+	Clients  int64
+}
+
+func (e EventOnAdmissionCapacityChanged) String() string {
+	return fmt.Sprintf("admission capacity changed to %d (%d clients in flight)", e.Capacity, e.Clients)
+}
+
+// EventOnRendezvousMethodAttempt reports one Exchange call against a single
+// named rendezvous method inside an ordered RendezvousSpecs fallback chain
+// (see client/lib's RendezvousRegistry), so an embedder can chart per-method
+// latency and failure rates instead of only seeing the chain's overall
+// outcome via EventOnBrokerRendezvous. Error is the transport-level error
+// Exchange returned, if any; it is never a broker-returned
+// messages.ClientPollResponse.Error, since that's only decoded after a
+// method's Exchange has already succeeded.
+type EventOnRendezvousMethodAttempt struct {
+	SnowflakeEvent
+	Method   string
+	Duration time.Duration
+	Error    error
+}
+
+func (e EventOnRendezvousMethodAttempt) String() string {
+	if e.Error != nil {
+		scrubbed := safelog.Scrub([]byte(e.Error.Error()))
+		return fmt.Sprintf("rendezvous method %s failed after %v: %s", e.Method, e.Duration, scrubbed)
+	}
+	return fmt.Sprintf("rendezvous method %s succeeded after %v", e.Method, e.Duration)
+}
+
+// EventOnClientBandwidth reports a client's WebRTC traffic over the last
+// Period, the client-side equivalent of EventOnProxyStats: Inbound/Outbound
+// are the raw byte totals client/lib's bytesSyncLogger accumulated during
+// Period, and InEvents/OutEvents are how many separate AddInbound/
+// AddOutbound calls made up those totals (roughly, how many DataChannel
+// messages were exchanged).
+type EventOnClientBandwidth struct {
+	SnowflakeEvent
+	Inbound, Outbound   int64
+	InEvents, OutEvents int
+	Period              time.Duration
+}
+
+func (e EventOnClientBandwidth) String() string {
+	return fmt.Sprintf("Traffic Bytes (in|out): %d | %d -- (%d OnMessages, %d Sends) over %v",
+		e.Inbound, e.Outbound, e.InEvents, e.OutEvents, e.Period)
+}
+
 type SnowflakeEventReceiver interface {
 	// OnNewSnowflakeEvent notify receiver about a new event
 	// This method MUST not block
@@ -123,5 +383,15 @@ type SnowflakeEventDispatcher interface {
 	// Every event listener added will be called when an event is received by the dispatcher.
 	// The order each listener is called is undefined.
 	AddSnowflakeEventListener(receiver SnowflakeEventReceiver)
+	// AddSnowflakeEventListenerFor is AddSnowflakeEventListener restricted
+	// to events filter returns true for. Unlike AddSnowflakeEventListener,
+	// receiver is fed through a small bounded mailbox: if receiver falls
+	// behind, the dispatcher drops receiver's oldest undelivered events
+	// instead of blocking OnNewSnowflakeEvent or any other listener (see
+	// Stats).
+	AddSnowflakeEventListenerFor(filter func(SnowflakeEvent) bool, receiver SnowflakeEventReceiver)
 	RemoveSnowflakeEventListener(receiver SnowflakeEventReceiver)
+	// Stats reports, per currently registered listener, how many events
+	// it has missed to its mailbox filling up.
+	Stats() map[SnowflakeEventReceiver]int64
 }
@@ -0,0 +1,221 @@
+package event
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DeliveryMode selects how a MultiSink sink receives events relative to the
+// caller of MultiSink.OnNewSnowflakeEvent.
+type DeliveryMode int
+
+const (
+	// DeliverSync calls the sink's Receiver inline, blocking
+	// OnNewSnowflakeEvent (and therefore every other sink, and whatever
+	// event source called it, possibly a WebRTC callback) until Receiver
+	// returns. Reserve this for receivers that are always fast and must
+	// never miss an event, e.g. a Prometheus counter increment.
+	DeliverSync DeliveryMode = iota
+	// DeliverBuffered queues the event onto a bounded channel drained by a
+	// dedicated goroutine, applying backpressure -- OnNewSnowflakeEvent
+	// blocks once the channel is full -- rather than ever dropping an
+	// event for this sink.
+	DeliverBuffered
+	// DeliverDropOldest is DeliverBuffered, except once the channel is
+	// full it discards the oldest still-queued event to make room instead
+	// of blocking, so a slow sink only ever loses its own history instead
+	// of slowing down whatever produces events.
+	DeliverDropOldest
+)
+
+// defaultSinkQueueSize is the channel capacity AddSink gives a
+// DeliverBuffered or DeliverDropOldest sink that leaves QueueSize unset.
+const defaultSinkQueueSize = 64
+
+// SinkConfig configures one receiver registered with MultiSink.AddSink.
+type SinkConfig struct {
+	Receiver SnowflakeEventReceiver
+	Mode     DeliveryMode
+	// QueueSize bounds the channel DeliverBuffered/DeliverDropOldest
+	// allocate for this sink; ignored for DeliverSync. Defaults to
+	// defaultSinkQueueSize if <= 0.
+	QueueSize int
+	// Allow, if non-empty, restricts delivery to events whose Go type name
+	// (e.g. "EventOnProxyStats", via reflect.TypeOf(event).Name()) appears
+	// in it. Deny, checked first, always excludes the names it lists even
+	// if Allow would otherwise admit them. Both nil delivers every event,
+	// MultiSink's default.
+	Allow, Deny []string
+}
+
+func (cfg *SinkConfig) accepts(typeName string) bool {
+	for _, d := range cfg.Deny {
+		if d == typeName {
+			return false
+		}
+	}
+
+	if len(cfg.Allow) == 0 {
+		return true
+	}
+	for _, a := range cfg.Allow {
+		if a == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+// sink is one receiver MultiSink.AddSink registered, plus whatever
+// delivery-mode plumbing it needs.
+type sink struct {
+	cfg     SinkConfig
+	ch      chan SnowflakeEvent
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+func (s *sink) drain() {
+	for {
+		select {
+		case event := <-s.ch:
+			s.cfg.Receiver.OnNewSnowflakeEvent(event)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// enqueueDropOldest delivers event to s.ch, discarding the oldest
+// still-queued event to make room if it's full, so it never blocks the
+// caller. It yields between eviction attempts so the drain goroutine gets a
+// chance to make real progress under a sustained burst, the same technique
+// subscription.enqueue in bus.go uses.
+func (s *sink) enqueueDropOldest(event SnowflakeEvent) {
+	for {
+		select {
+		case s.ch <- event:
+			return
+		default:
+		}
+
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// MultiSink fans one stream of events out to any number of
+// SnowflakeEventReceivers, each with its own type-name Allow/Deny filter
+// and DeliveryMode: DeliverSync for fast receivers that must never miss an
+// event (a Prometheus exporter), DeliverBuffered for receivers that can
+// tolerate OnNewSnowflakeEvent blocking under load, and DeliverDropOldest
+// for receivers (a log sink) where losing old events under sustained load
+// beats slowing down the event source. It implements SnowflakeEventReceiver
+// itself, so it can be registered with a SnowflakeEventDispatcher via
+// AddSnowflakeEventListener, letting several independently-configured sinks
+// (a text logger, a JSON logger, a Prometheus exporter, a user-supplied
+// webhook) share one dispatcher subscription. A DeliverDropOldest sink never
+// blocks the others or the event source; a slow DeliverSync sink, or a full
+// DeliverBuffered one, does.
+type MultiSink struct {
+	mu    sync.Mutex
+	sinks []*sink
+}
+
+// NewMultiSink returns an empty MultiSink.
+func NewMultiSink() *MultiSink {
+	return &MultiSink{}
+}
+
+// AddSink registers cfg.Receiver for delivery per cfg.Mode/Allow/Deny.
+// DeliverBuffered and DeliverDropOldest each start a dedicated goroutine
+// that RemoveSink stops.
+func (m *MultiSink) AddSink(cfg SinkConfig) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultSinkQueueSize
+	}
+
+	s := &sink{cfg: cfg}
+	if cfg.Mode != DeliverSync {
+		s.ch = make(chan SnowflakeEvent, cfg.QueueSize)
+		s.done = make(chan struct{})
+		go s.drain()
+	}
+
+	m.mu.Lock()
+	m.sinks = append(m.sinks, s)
+	m.mu.Unlock()
+}
+
+// RemoveSink unregisters every sink currently added for receiver (normally
+// just one), stopping its drain goroutine if DeliverBuffered/DeliverDropOldest
+// started one. Any event still queued for it at the time of removal is
+// discarded rather than delivered.
+func (m *MultiSink) RemoveSink(receiver SnowflakeEventReceiver) {
+	m.mu.Lock()
+	kept := m.sinks[:0]
+	var removed []*sink
+	for _, s := range m.sinks {
+		if s.cfg.Receiver == receiver {
+			removed = append(removed, s)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	m.sinks = kept
+	m.mu.Unlock()
+
+	for _, s := range removed {
+		if s.done != nil {
+			close(s.done)
+		}
+	}
+}
+
+// OnNewSnowflakeEvent delivers event to every registered sink whose
+// Allow/Deny filter accepts it, per that sink's DeliveryMode. It never
+// blocks on a DeliverDropOldest sink, but DOES block on a DeliverSync or
+// DeliverBuffered sink that is slow or has fallen behind -- choose those
+// modes only for receivers where that's acceptable.
+func (m *MultiSink) OnNewSnowflakeEvent(event SnowflakeEvent) {
+	m.mu.Lock()
+	sinks := make([]*sink, len(m.sinks))
+	copy(sinks, m.sinks)
+	m.mu.Unlock()
+
+	typeName := reflect.TypeOf(event).Name()
+	for _, s := range sinks {
+		if !s.cfg.accepts(typeName) {
+			continue
+		}
+
+		switch s.cfg.Mode {
+		case DeliverSync:
+			s.cfg.Receiver.OnNewSnowflakeEvent(event)
+		case DeliverDropOldest:
+			s.enqueueDropOldest(event)
+		default: // DeliverBuffered
+			s.ch <- event
+		}
+	}
+}
+
+// Stats reports, for every currently registered sink, how many events
+// DeliverDropOldest has discarded for it because its queue was full.
+// DeliverSync and DeliverBuffered sinks never drop, so they always report 0.
+func (m *MultiSink) Stats() map[SnowflakeEventReceiver]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[SnowflakeEventReceiver]int64, len(m.sinks))
+	for _, s := range m.sinks {
+		stats[s.cfg.Receiver] = s.dropped.Load()
+	}
+	return stats
+}
@@ -0,0 +1,28 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// classifyConnectionFailure buckets the error carried by
+// EventOnSnowflakeConnectionFailed into a small, stable label a dashboard
+// can group or alert on, instead of the raw (and high-cardinality,
+// IP-bearing) error string.
+func classifyConnectionFailure(err error) string {
+	if err == nil {
+		return "unknown"
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "other"
+}
@@ -0,0 +1,113 @@
+package sinks
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"tgragnato.it/snowflake/common/event"
+)
+
+// meterName identifies the Meter OTelReceiver asks mp for, following OTel's
+// convention of naming it after the instrumented module.
+const meterName = "tgragnato.it/snowflake"
+
+// OTelReceiver mirrors PrometheusReceiver's event mapping -- the same four
+// event types, the same labels -- but as instruments on a caller-supplied
+// metric.MeterProvider, for an operator whose pipeline already ships
+// metrics to an OTLP collector instead of scraping Prometheus.
+type OTelReceiver struct {
+	inboundBytes              metric.Int64Counter
+	outboundBytes             metric.Int64Counter
+	connectionCount           metric.Int64Counter
+	connectionFailures        metric.Int64Counter
+	currentNATType            metric.Int64Gauge
+	proxyStatsConnections     metric.Int64Gauge
+	proxyStatsIntervalSeconds metric.Float64Gauge
+
+	natTypeLock sync.Mutex // guards lastNATType
+	lastNATType string
+}
+
+// NewOTelReceiver creates the instruments OTelReceiver needs on a Meter
+// obtained from mp, returning the first instrument-creation error
+// encountered, if any.
+func NewOTelReceiver(mp metric.MeterProvider) (*OTelReceiver, error) {
+	meter := mp.Meter(meterName)
+	var err error
+	r := &OTelReceiver{}
+
+	if r.inboundBytes, err = meter.Int64Counter(
+		"snowflake.proxy.inbound_bytes",
+		metric.WithDescription("Total InboundTraffic reported by EventOnProxyConnectionOver."),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if r.outboundBytes, err = meter.Int64Counter(
+		"snowflake.proxy.outbound_bytes",
+		metric.WithDescription("Total OutboundTraffic reported by EventOnProxyConnectionOver."),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if r.connectionCount, err = meter.Int64Counter(
+		"snowflake.proxy.connections",
+		metric.WithDescription("Connections reported by EventOnProxyConnectionOver, labeled by the client's country when known."),
+	); err != nil {
+		return nil, err
+	}
+	if r.connectionFailures, err = meter.Int64Counter(
+		"snowflake.connection_failures",
+		metric.WithDescription("EventOnSnowflakeConnectionFailed occurrences, labeled by a coarse failure class."),
+	); err != nil {
+		return nil, err
+	}
+	if r.currentNATType, err = meter.Int64Gauge(
+		"snowflake.proxy.current_nat_type",
+		metric.WithDescription("1 for the most recently reported EventOnCurrentNATTypeDetermined NAT type, 0 for others."),
+	); err != nil {
+		return nil, err
+	}
+	if r.proxyStatsConnections, err = meter.Int64Gauge(
+		"snowflake.proxy.stats_connections",
+		metric.WithDescription("ConnectionCount from the most recent EventOnProxyStats summary."),
+	); err != nil {
+		return nil, err
+	}
+	if r.proxyStatsIntervalSeconds, err = meter.Float64Gauge(
+		"snowflake.proxy.stats_interval_seconds",
+		metric.WithDescription("SummaryInterval from the most recent EventOnProxyStats summary, so a missed summary is visible as a stale value."),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// OnNewSnowflakeEvent implements event.SnowflakeEventReceiver.
+func (r *OTelReceiver) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
+	ctx := context.Background()
+	switch v := e.(type) {
+	case event.EventOnProxyConnectionOver:
+		r.inboundBytes.Add(ctx, v.InboundTraffic)
+		r.outboundBytes.Add(ctx, v.OutboundTraffic)
+		r.connectionCount.Add(ctx, 1, metric.WithAttributes(attribute.String("country", v.Country)))
+	case event.EventOnSnowflakeConnectionFailed:
+		r.connectionFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("class", classifyConnectionFailure(v.Error))))
+	case event.EventOnCurrentNATTypeDetermined:
+		r.natTypeLock.Lock()
+		if r.lastNATType != "" && r.lastNATType != v.CurNATType {
+			r.currentNATType.Record(ctx, 0, metric.WithAttributes(attribute.String("nat_type", r.lastNATType)))
+		}
+		r.lastNATType = v.CurNATType
+		r.currentNATType.Record(ctx, 1, metric.WithAttributes(attribute.String("nat_type", v.CurNATType)))
+		r.natTypeLock.Unlock()
+	case event.EventOnProxyStats:
+		r.proxyStatsConnections.Record(ctx, int64(v.ConnectionCount))
+		r.proxyStatsIntervalSeconds.Record(ctx, v.SummaryInterval.Seconds())
+	}
+}
@@ -0,0 +1,122 @@
+package sinks
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"tgragnato.it/snowflake/common/event"
+)
+
+const metricNamespace = "snowflake_event"
+
+// PrometheusReceiver adapts EventOnProxyConnectionOver,
+// EventOnSnowflakeConnectionFailed, EventOnCurrentNATTypeDetermined, and
+// EventOnProxyStats onto Prometheus collectors, for an embedder or
+// broker/proxy operator who wants metrics on the SnowflakeEvent bus itself
+// rather than tailing logs or wiring up proxy/lib.Metrics by hand. Add it to
+// a dispatcher with AddSnowflakeEventListener (or RegisterAll), and register
+// the receiver with a prometheus.Registerer the same way proxy/lib.Metrics
+// is registered via Metrics.Start.
+type PrometheusReceiver struct {
+	inboundBytes              prometheus.Counter
+	outboundBytes             prometheus.Counter
+	connectionCount           *prometheus.CounterVec
+	connectionFailures        *prometheus.CounterVec
+	currentNATType            *prometheus.GaugeVec
+	proxyStatsConnections     prometheus.Gauge
+	proxyStatsIntervalSeconds prometheus.Gauge
+
+	natTypeLock sync.Mutex // guards lastNATType
+	lastNATType string
+}
+
+// NewPrometheusReceiver builds a PrometheusReceiver with constLabels
+// attached to every collector, mirroring proxy/lib.NewMetrics, so an
+// operator running a pool of proxies or brokers can tag which instance
+// each series came from.
+func NewPrometheusReceiver(constLabels prometheus.Labels) *PrometheusReceiver {
+	return &PrometheusReceiver{
+		inboundBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "inbound_bytes_total",
+			Help:        "Total InboundTraffic reported by EventOnProxyConnectionOver.",
+			ConstLabels: constLabels,
+		}),
+		outboundBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "outbound_bytes_total",
+			Help:        "Total OutboundTraffic reported by EventOnProxyConnectionOver.",
+			ConstLabels: constLabels,
+		}),
+		connectionCount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "connections_total",
+			Help:        "Connections reported by EventOnProxyConnectionOver, labeled by the client's country when known.",
+			ConstLabels: constLabels,
+		}, []string{"country"}),
+		connectionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "connection_failures_total",
+			Help:        "EventOnSnowflakeConnectionFailed occurrences, labeled by a coarse failure class.",
+			ConstLabels: constLabels,
+		}, []string{"class"}),
+		currentNATType: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "current_nat_type",
+			Help:        "1 for the most recently reported EventOnCurrentNATTypeDetermined NAT type, 0 for others.",
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		proxyStatsConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "proxy_stats_connections",
+			Help:        "ConnectionCount from the most recent EventOnProxyStats summary.",
+			ConstLabels: constLabels,
+		}),
+		proxyStatsIntervalSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "proxy_stats_interval_seconds",
+			Help:        "SummaryInterval from the most recent EventOnProxyStats summary, so a missed summary is visible as a stale value.",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *PrometheusReceiver) Describe(descs chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(r, descs)
+}
+
+// Collect implements prometheus.Collector.
+func (r *PrometheusReceiver) Collect(ch chan<- prometheus.Metric) {
+	r.inboundBytes.Collect(ch)
+	r.outboundBytes.Collect(ch)
+	r.connectionCount.Collect(ch)
+	r.connectionFailures.Collect(ch)
+	r.currentNATType.Collect(ch)
+	r.proxyStatsConnections.Collect(ch)
+	r.proxyStatsIntervalSeconds.Collect(ch)
+}
+
+// OnNewSnowflakeEvent implements event.SnowflakeEventReceiver.
+func (r *PrometheusReceiver) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
+	switch v := e.(type) {
+	case event.EventOnProxyConnectionOver:
+		r.inboundBytes.Add(float64(v.InboundTraffic))
+		r.outboundBytes.Add(float64(v.OutboundTraffic))
+		r.connectionCount.With(prometheus.Labels{"country": v.Country}).Inc()
+	case event.EventOnSnowflakeConnectionFailed:
+		r.connectionFailures.With(prometheus.Labels{"class": classifyConnectionFailure(v.Error)}).Inc()
+	case event.EventOnCurrentNATTypeDetermined:
+		r.natTypeLock.Lock()
+		if r.lastNATType != "" && r.lastNATType != v.CurNATType {
+			r.currentNATType.With(prometheus.Labels{"nat_type": r.lastNATType}).Set(0)
+		}
+		r.lastNATType = v.CurNATType
+		r.currentNATType.With(prometheus.Labels{"nat_type": v.CurNATType}).Set(1)
+		r.natTypeLock.Unlock()
+	case event.EventOnProxyStats:
+		r.proxyStatsConnections.Set(float64(v.ConnectionCount))
+		r.proxyStatsIntervalSeconds.Set(v.SummaryInterval.Seconds())
+	}
+}
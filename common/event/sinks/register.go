@@ -0,0 +1,19 @@
+// Package sinks provides SnowflakeEventReceiver implementations that
+// export SnowflakeEvents to external monitoring systems, as an alternative
+// to the logging receiver in client/lib and proxy/lib: a Prometheus
+// receiver (see PrometheusReceiver), an OpenTelemetry receiver (see
+// OTelReceiver), and a webhook receiver that POSTs a signed JSON envelope
+// per event (see WebhookReceiver).
+package sinks
+
+import "tgragnato.it/snowflake/common/event"
+
+// RegisterAll adds every receiver in receivers to dispatcher, so an
+// operator can wire several sinks onto one SnowflakeEventDispatcher (e.g.
+// PrometheusReceiver for scraping and WebhookReceiver for alerting) without
+// calling AddSnowflakeEventListener once per sink.
+func RegisterAll(dispatcher event.SnowflakeEventDispatcher, receivers ...event.SnowflakeEventReceiver) {
+	for _, r := range receivers {
+		dispatcher.AddSnowflakeEventListener(r)
+	}
+}
@@ -0,0 +1,102 @@
+package sinks
+
+import (
+	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/ptutil/safelog"
+
+	"tgragnato.it/snowflake/common/event"
+)
+
+// EventEnvelope is the stable wire format WebhookReceiver serializes every
+// delivery as: Type identifies which concrete shape Data holds, so external
+// tooling can dispatch on it without depending on this package's Go types,
+// and Time is when the envelope was built rather than when the underlying
+// event actually happened.
+type EventEnvelope struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// ProxyConnectionOverData is the stable JSON shape of
+// event.EventOnProxyConnectionOver.
+type ProxyConnectionOverData struct {
+	InboundBytes  int64  `json:"inbound_bytes"`
+	OutboundBytes int64  `json:"outbound_bytes"`
+	Country       string `json:"country,omitempty"`
+}
+
+// SnowflakeConnectionFailedData is the stable JSON shape of
+// event.EventOnSnowflakeConnectionFailed. Error is scrubbed the same way
+// EventOnSnowflakeConnectionFailed.String() is, so it never carries an IP
+// address or other sensitive detail off-host.
+type SnowflakeConnectionFailedData struct {
+	Class string `json:"class"`
+	Error string `json:"error"`
+}
+
+// CurrentNATTypeDeterminedData is the stable JSON shape of
+// event.EventOnCurrentNATTypeDetermined.
+type CurrentNATTypeDeterminedData struct {
+	NATType string `json:"nat_type"`
+}
+
+// ProxyStatsData is the stable JSON shape of event.EventOnProxyStats.
+type ProxyStatsData struct {
+	ConnectionCount int64   `json:"connection_count"`
+	InboundBytes    int64   `json:"inbound_bytes"`
+	OutboundBytes   int64   `json:"outbound_bytes"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+}
+
+// encodeEvent converts e to its stable EventEnvelope, for the event types
+// this package ships a schema for. ok is false for any other event type,
+// so a caller like WebhookReceiver knows to drop it rather than guess at a
+// shape.
+func encodeEvent(e event.SnowflakeEvent) (envelope EventEnvelope, ok bool) {
+	switch v := e.(type) {
+	case event.EventOnProxyConnectionOver:
+		return EventEnvelope{
+			Type: "proxy_connection_over",
+			Time: time.Now(),
+			Data: ProxyConnectionOverData{
+				InboundBytes:  v.InboundTraffic,
+				OutboundBytes: v.OutboundTraffic,
+				Country:       v.Country,
+			},
+		}, true
+	case event.EventOnSnowflakeConnectionFailed:
+		errStr := ""
+		if v.Error != nil {
+			errStr = string(safelog.Scrub([]byte(v.Error.Error())))
+		}
+		return EventEnvelope{
+			Type: "snowflake_connection_failed",
+			Time: time.Now(),
+			Data: SnowflakeConnectionFailedData{
+				Class: classifyConnectionFailure(v.Error),
+				Error: errStr,
+			},
+		}, true
+	case event.EventOnCurrentNATTypeDetermined:
+		return EventEnvelope{
+			Type: "current_nat_type_determined",
+			Time: time.Now(),
+			Data: CurrentNATTypeDeterminedData{NATType: v.CurNATType},
+		}, true
+	case event.EventOnProxyStats:
+		return EventEnvelope{
+			Type: "proxy_stats",
+			Time: time.Now(),
+			Data: ProxyStatsData{
+				ConnectionCount: int64(v.ConnectionCount),
+				InboundBytes:    v.InboundBytes,
+				OutboundBytes:   v.OutboundBytes,
+				IntervalSeconds: v.SummaryInterval.Seconds(),
+			},
+		}, true
+	default:
+		return EventEnvelope{}, false
+	}
+}
@@ -0,0 +1,55 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tgragnato.it/snowflake/common/event"
+)
+
+func TestEncodeEvent(t *testing.T) {
+	t.Parallel()
+
+	envelope, ok := encodeEvent(event.EventOnProxyConnectionOver{
+		InboundTraffic:  10,
+		OutboundTraffic: 20,
+		Country:         "fr",
+	})
+	if !ok {
+		t.Fatal("expected ok == true for EventOnProxyConnectionOver")
+	}
+	data, ok := envelope.Data.(ProxyConnectionOverData)
+	if !ok {
+		t.Fatalf("expected Data to be a ProxyConnectionOverData, got %T", envelope.Data)
+	}
+	if data.InboundBytes != 10 || data.OutboundBytes != 20 || data.Country != "fr" {
+		t.Fatalf("unexpected data: %+v", data)
+	}
+
+	if _, ok := encodeEvent(event.EventOnSnowflakeConnected{}); ok {
+		t.Fatal("expected ok == false for an event type with no schema")
+	}
+}
+
+func TestClassifyConnectionFailure(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, "unknown"},
+		{"deadline exceeded", context.DeadlineExceeded, "timeout"},
+		{"canceled", context.Canceled, "canceled"},
+		{"other", errors.New("connection refused"), "other"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := classifyConnectionFailure(c.err); got != c.want {
+				t.Errorf("classifyConnectionFailure(%v) = %q, want %q", c.err, got, c.want)
+			}
+		})
+	}
+}
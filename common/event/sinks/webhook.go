@@ -0,0 +1,151 @@
+package sinks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"tgragnato.it/snowflake/common/event"
+)
+
+const (
+	// webhookQueueSize bounds how many undelivered events WebhookReceiver
+	// buffers before it starts dropping the newest ones, so a webhook
+	// endpoint that's down can't make OnNewSnowflakeEvent block or grow
+	// unbounded memory.
+	webhookQueueSize = 256
+
+	// webhookMaxAttempts is how many times WebhookReceiver attempts a
+	// delivery, doubling its backoff between attempts, before giving up on
+	// that event.
+	webhookMaxAttempts = 5
+
+	webhookBackoffBase = 500 * time.Millisecond
+	webhookBackoffMax  = 30 * time.Second
+
+	// webhookSignatureHeader carries a hex-encoded HMAC-SHA256 of the
+	// request body, keyed by the secret passed to NewWebhookReceiver, so a
+	// receiving endpoint can authenticate the delivery.
+	webhookSignatureHeader = "X-Snowflake-Event-Signature"
+)
+
+// WebhookReceiver POSTs a signed EventEnvelope to a configured URL for
+// every event it has a schema for (see encodeEvent), retrying failed
+// deliveries with exponential backoff. OnNewSnowflakeEvent only enqueues,
+// so it never blocks the dispatcher; a background goroutine does the
+// actual delivery.
+type WebhookReceiver struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+
+	queue chan EventEnvelope
+	done  chan struct{}
+}
+
+// NewWebhookReceiver starts a WebhookReceiver that POSTs to url. If secret
+// is non-empty, every delivery carries an HMAC-SHA256 signature of its body
+// in the webhookSignatureHeader header. Call Close to stop the background
+// delivery goroutine.
+func NewWebhookReceiver(url string, secret []byte) *WebhookReceiver {
+	w := &WebhookReceiver{
+		url:        url,
+		secret:     secret,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		queue:      make(chan EventEnvelope, webhookQueueSize),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// OnNewSnowflakeEvent implements event.SnowflakeEventReceiver.
+func (w *WebhookReceiver) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
+	envelope, ok := encodeEvent(e)
+	if !ok {
+		return
+	}
+	select {
+	case w.queue <- envelope:
+	default:
+		log.Printf("WebhookReceiver: delivery queue full, dropping a %s event\n", envelope.Type)
+	}
+}
+
+// Close stops the background delivery goroutine. Envelopes still queued at
+// that point are discarded.
+func (w *WebhookReceiver) Close() {
+	close(w.done)
+}
+
+func (w *WebhookReceiver) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case envelope := <-w.queue:
+			w.deliver(envelope)
+		}
+	}
+}
+
+// deliver retries envelope with exponential backoff, giving up after
+// webhookMaxAttempts.
+func (w *WebhookReceiver) deliver(envelope EventEnvelope) {
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("WebhookReceiver: encountered error marshaling a %s event: %v\n", envelope.Type, err)
+		return
+	}
+
+	backoff := webhookBackoffBase
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if err := w.post(body); err == nil {
+			return
+		} else if attempt == webhookMaxAttempts {
+			log.Printf("WebhookReceiver: giving up on a %s event after %d attempts: %v\n", envelope.Type, attempt, err)
+			return
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > webhookBackoffMax {
+			backoff = webhookBackoffMax
+		}
+	}
+}
+
+func (w *WebhookReceiver) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint returned %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package messages
+
+import "encoding/json"
+
+// CandidateRequest carries one client ICE candidate to the broker during a
+// trickle-ICE negotiation, keyed by the ClientID the broker's poll response
+// assigned to the session. Done, once true, tells the broker the client has
+// no more candidates to send for this session.
+type CandidateRequest struct {
+	ClientID  string `json:"client_id"`
+	Candidate string `json:"candidate,omitempty"`
+	Done      bool   `json:"done,omitempty"`
+}
+
+// CandidateResponse carries the broker's relayed proxy ICE candidates back
+// to the client in answer to a CandidateRequest. Done is set once the
+// broker has no more of the proxy's candidates to relay.
+type CandidateResponse struct {
+	Candidates []string `json:"candidates,omitempty"`
+	Done       bool     `json:"done,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// EncodeCandidateRequest serializes a CandidateRequest to JSON.
+func (req *CandidateRequest) EncodeCandidateRequest() ([]byte, error) {
+	return json.Marshal(req)
+}
+
+// DecodeCandidateRequest parses a CandidateRequest previously produced by
+// EncodeCandidateRequest.
+func DecodeCandidateRequest(data []byte) (*CandidateRequest, error) {
+	var req CandidateRequest
+	err := json.Unmarshal(data, &req)
+	return &req, err
+}
+
+// EncodeCandidateResponse serializes a CandidateResponse to JSON.
+func (resp *CandidateResponse) EncodeCandidateResponse() ([]byte, error) {
+	return json.Marshal(resp)
+}
+
+// DecodeCandidateResponse parses a CandidateResponse previously produced by
+// EncodeCandidateResponse.
+func DecodeCandidateResponse(data []byte) (*CandidateResponse, error) {
+	var resp CandidateResponse
+	err := json.Unmarshal(data, &resp)
+	return &resp, err
+}
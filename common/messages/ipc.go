@@ -10,12 +10,28 @@ const (
 	RendezvousHttp     RendezvousMethod = "http"
 	RendezvousAmpCache RendezvousMethod = "ampcache"
 	RendezvousSqs      RendezvousMethod = "sqs"
+	RendezvousWhip     RendezvousMethod = "whip"
+
+	// RendezvousQuic identifies a client poll that arrived over the
+	// broker's raw-QUIC listener (see broker/quic.go's quicHandler)
+	// instead of any HTTP-based transport -- distinct from the
+	// http-frontend's HTTP/3 listener, which still arrives tagged
+	// RendezvousHttp since it's HTTP end to end, just carried over QUIC.
+	RendezvousQuic RendezvousMethod = "quic"
 )
 
 type Arg struct {
 	Body             []byte
 	RemoteAddr       string
 	RendezvousMethod RendezvousMethod
+	// RequestID correlates this IPC call with the structured log event
+	// the HTTP frontend emitted for the request it came from, so an
+	// operator can join "offer arrived" and "answer returned" lines
+	// across the unix socket. It's set by http-frontend/http.go's
+	// handlers; IPC methods that don't log per-request (or don't exist
+	// yet in this tree -- see IPC's doc comment in broker/ipc_prometheus.go)
+	// are free to ignore it.
+	RequestID string
 }
 
 var (
@@ -0,0 +1,42 @@
+package messages
+
+import "encoding/json"
+
+// CandidatePairType classifies the local ICE candidate of the pair a probe
+// used to reach a proxy: host, srflx, prflx or relay, per RFC 5245.
+type CandidatePairType string
+
+const (
+	CandidatePairHost  CandidatePairType = "host"
+	CandidatePairSrflx CandidatePairType = "srflx"
+	CandidatePairPrflx CandidatePairType = "prflx"
+	CandidatePairRelay CandidatePairType = "relay"
+)
+
+// ProbeReport summarizes the connection quality a probetest server measured
+// for one proxy's DataChannel: round-trip latency and jitter from timestamped
+// ping frames, achieved throughput from bulk-data frames, how long ICE
+// gathering took, which kind of candidate pair was selected, and whether a
+// TURN relay was needed. Proxies log this and may forward it to the broker
+// to inform scheduling decisions.
+type ProbeReport struct {
+	RTTMillis          float64           `json:"rtt_ms"`
+	JitterMillis       float64           `json:"jitter_ms"`
+	ThroughputKbps     float64           `json:"kbps"`
+	CandidatePairType  CandidatePairType `json:"candidate_pair_type"`
+	ICEGatheringMillis float64           `json:"ice_gathering_ms"`
+	UsedTURN           bool              `json:"used_turn"`
+}
+
+// EncodeProbeReport serializes a ProbeReport to JSON.
+func EncodeProbeReport(report ProbeReport) ([]byte, error) {
+	return json.Marshal(report)
+}
+
+// DecodeProbeReport parses a ProbeReport previously produced by
+// EncodeProbeReport.
+func DecodeProbeReport(data []byte) (ProbeReport, error) {
+	var report ProbeReport
+	err := json.Unmarshal(data, &report)
+	return report, err
+}
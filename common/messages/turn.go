@@ -0,0 +1,16 @@
+package messages
+
+import "time"
+
+// TurnServer is one TURN relay the broker has provisioned short-lived
+// credentials for, to hand a client whose NAT policy failed and that needs
+// a relay path rather than a direct or server-reflexive one. TTL is how
+// long Credential remains valid from the moment the response carrying it
+// was issued.
+type TurnServer struct {
+	URLs       []string      `json:"urls"`
+	Username   string        `json:"username"`
+	Credential string        `json:"credential"`
+	TTL        time.Duration `json:"ttl"`
+	RealmHint  string        `json:"realm_hint,omitempty"`
+}
@@ -0,0 +1,102 @@
+package messages
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SymmetricNATVerdictResult is the outcome a probetest server recorded for
+// one proxy's attempt to accept a DataChannel from behind a simulated
+// symmetric NAT.
+type SymmetricNATVerdictResult string
+
+const (
+	VerdictPass SymmetricNATVerdictResult = "pass"
+	VerdictFail SymmetricNATVerdictResult = "fail"
+)
+
+// ErrVerdictUnsigned is returned by VerifySymmetricNATVerdict when the
+// signature doesn't match the verdict fields under the given prober key.
+var ErrVerdictUnsigned = errors.New("symmetric NAT verdict: bad signature")
+
+// SymmetricNATVerdict is a probetest server's signed statement that a proxy
+// did or didn't successfully accept a symmetric-NAT test connection, carried
+// in a proxy's poll body so the broker can use it when matching that proxy
+// against symmetric-NAT clients. ProberID names the signing key (so a
+// broker trusting more than one prober can tell them apart); Sig is the
+// base64-less raw ed25519 signature over the other fields, produced by
+// SignSymmetricNATVerdict.
+type SymmetricNATVerdict struct {
+	ProbedAt time.Time                 `json:"probed_at"`
+	Verdict  SymmetricNATVerdictResult `json:"verdict"`
+	ProberID string                    `json:"prober_id"`
+	Sig      []byte                    `json:"sig"`
+}
+
+// signedFields returns the bytes SignSymmetricNATVerdict and
+// VerifySymmetricNATVerdict sign: everything in v except Sig itself, in a
+// fixed order so both sides hash the same thing regardless of struct
+// layout or JSON key ordering.
+func (v SymmetricNATVerdict) signedFields() []byte {
+	return []byte(v.ProbedAt.UTC().Format(time.RFC3339) + "|" + string(v.Verdict) + "|" + v.ProberID)
+}
+
+// SignSymmetricNATVerdict fills in v.Sig by signing v's other fields with
+// key. The caller sets ProbedAt, Verdict and ProberID first.
+func SignSymmetricNATVerdict(key ed25519.PrivateKey, v SymmetricNATVerdict) SymmetricNATVerdict {
+	v.Sig = ed25519.Sign(key, v.signedFields())
+	return v
+}
+
+// VerifySymmetricNATVerdict reports whether v.Sig is a valid signature over
+// v's other fields under pub. It does not check ProbedAt's age; callers
+// that care how recent a verdict is (the broker's VerdictCache does) check
+// that separately after a successful verification.
+func VerifySymmetricNATVerdict(pub ed25519.PublicKey, v SymmetricNATVerdict) error {
+	if len(v.Sig) != ed25519.SignatureSize {
+		return ErrVerdictUnsigned
+	}
+	if !ed25519.Verify(pub, v.signedFields(), v.Sig) {
+		return ErrVerdictUnsigned
+	}
+	return nil
+}
+
+// EncodeSymmetricNATVerdict serializes a SymmetricNATVerdict to JSON, for a
+// proxy to attach to its poll body.
+func EncodeSymmetricNATVerdict(v SymmetricNATVerdict) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// DecodeSymmetricNATVerdict parses a SymmetricNATVerdict previously produced
+// by EncodeSymmetricNATVerdict. It does not verify the signature; call
+// VerifySymmetricNATVerdict on the result.
+func DecodeSymmetricNATVerdict(data []byte) (SymmetricNATVerdict, error) {
+	var v SymmetricNATVerdict
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ParseEd25519PublicKey checks that raw is the right length to be an
+// ed25519 public key, so callers reading one out of a flag or config file
+// get one consistent, checked conversion instead of each hand-rolling the
+// length check themselves.
+func ParseEd25519PublicKey(raw []byte) (ed25519.PublicKey, error) {
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ed25519 public key: want %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Valid reports whether r is one of the known verdict results.
+func (r SymmetricNATVerdictResult) Valid() bool {
+	switch r {
+	case VerdictPass, VerdictFail:
+		return true
+	default:
+		return false
+	}
+}
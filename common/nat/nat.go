@@ -14,11 +14,16 @@ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLI
 package nat
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pion/stun/v3"
@@ -27,12 +32,74 @@ import (
 
 var ErrTimedOut = errors.New("timed out waiting for response")
 
+// ErrChangeRequestUnsupportedOverStream is returned by RoundTrip when asked
+// to send a CHANGE-REQUEST over a STUN/TCP or STUN/TLS connection. RFC 5780
+// filtering tests rely on the server replying from a different address or
+// port than the request was sent to, which a connection-oriented transport
+// cannot represent: callers should fall back to a UDP-based probe (or
+// simply accept that filtering behavior is unknown) when they see this
+// error.
+var ErrChangeRequestUnsupportedOverStream = errors.New("CHANGE-REQUEST is not supported over stream transports (stun+tcp/stuns); use a UDP-based probe to determine filtering behavior")
+
 const (
 	NATUnknown      = "unknown"
 	NATRestricted   = "restricted"
 	NATUnrestricted = "unrestricted"
 )
 
+// Outcome labels a client attaches to a poll request, reporting what
+// happened after its *previous* attempt sent a (possibly spoofed) NAT type
+// to the broker: OutcomeMatched means it sent its real NAT type, so no
+// spoof was in play; OutcomeMismatchedSuccess/OutcomeMismatchedFailure
+// mean it spoofed NATUnrestricted and the resulting connection did or
+// didn't succeed. The broker aggregates these per actual NAT type to
+// decide whether spoofing is still paying off; see the broker's
+// NATHintTracker and client/lib's NATPolicy.
+const (
+	OutcomeMatched           = "matched"
+	OutcomeMismatchedSuccess = "mismatched-success"
+	OutcomeMismatchedFailure = "mismatched-failure"
+)
+
+// Hint is what the broker's aggregated Outcome data tells a client to do
+// about spoofing, returned in a poll response so NATPolicy can make a
+// data-driven decision instead of relying solely on its own single local
+// attempt. HintNone means the broker hasn't seen enough mismatched
+// attempts for this client's actual NAT type yet to have an opinion.
+const (
+	HintNone         = ""
+	HintSpoofOK      = "spoof-ok"
+	HintStopSpoofing = "stop-spoofing"
+)
+
+// Behavior classifies one dimension (mapping or filtering) of a NAT's
+// RFC 5780 behavior.
+type Behavior string
+
+const (
+	EndpointIndependent     Behavior = "endpoint-independent"
+	AddressDependent        Behavior = "address-dependent"
+	AddressAndPortDependent Behavior = "address-and-port-dependent"
+)
+
+// NATBehavior is the combined result of the RFC 5780 mapping and filtering
+// tests against a single STUN server.
+type NATBehavior struct {
+	Mapping   Behavior
+	Filtering Behavior
+	// MappingLifetime is how long the server's response kept mapping
+	// requests to the same external address/port, or 0 if it could not
+	// be determined (e.g. the mapping was already address-dependent).
+	MappingLifetime time.Duration
+}
+
+// IsRestricted reports whether this combination of mapping and filtering
+// behavior is expected to need a relay, i.e. it will not hole-punch
+// reliably with most other NATs.
+func (b NATBehavior) IsRestricted() bool {
+	return b.Mapping != EndpointIndependent || b.Filtering != EndpointIndependent
+}
+
 // Deprecated: Use CheckIfRestrictedNATWithProxy Instead.
 func CheckIfRestrictedNAT(server string) (bool, error) {
 	return CheckIfRestrictedNATWithProxy(server, nil)
@@ -44,63 +111,196 @@ func CheckIfRestrictedNAT(server string) (bool, error) {
 // and false if the NAT is unrestrictive (meaning it
 // will work with most other NATs),
 func CheckIfRestrictedNATWithProxy(server string, proxy *url.URL) (bool, error) {
-	return isRestrictedMapping(server, proxy)
+	behavior, err := DiscoverNATBehavior(server, proxy)
+	if err != nil {
+		return false, err
+	}
+	return behavior.IsRestricted(), nil
 }
 
-// Performs two tests from RFC 5780 to determine whether the mapping type
-// of the client's NAT is address-independent or address-dependent
-// Returns true if the mapping is address-dependent and false otherwise
-func isRestrictedMapping(addrStr string, proxy *url.URL) (bool, error) {
-	var xorAddr1 stun.XORMappedAddress
-	var xorAddr2 stun.XORMappedAddress
+// DiscoverNATBehavior performs the full set of RFC 5780 mapping (section
+// 4.3, Tests I-III) and filtering (section 4.4, Tests I-III) tests against
+// addrStr, classifying each dimension independently rather than collapsing
+// the result to a single restricted/unrestricted bit.
+//
+// addrStr accepts an optional scheme prefix selecting the transport to the
+// STUN server: "stun:" (the default if no scheme is given) for plain UDP,
+// "stun+tcp:" for STUN over TCP, and "stuns:" for STUN over TLS, per RFC
+// 5389 sections 7.2.1-7.2.3. Over a stream transport, filtering behavior
+// cannot be determined (see ErrChangeRequestUnsupportedOverStream); mapping
+// behavior is still discovered by opening a fresh connection per
+// destination address.
+func DiscoverNATBehavior(addrStr string, proxy *url.URL) (NATBehavior, error) {
+	conn, err := connect(addrStr, proxy)
+	if err != nil {
+		return NATBehavior{}, fmt.Errorf("error creating STUN connection: %w", err)
+	}
+	defer conn.Close()
+
+	mapping, lifetime, err := discoverMappingBehavior(conn)
+	if err != nil {
+		return NATBehavior{}, err
+	}
 
-	mapTestConn, err := connect(addrStr, proxy)
+	filtering, err := discoverFilteringBehavior(conn)
 	if err != nil {
-		return false, fmt.Errorf("error creating STUN connection: %w", err)
+		// Mapping behavior is still meaningful even when filtering
+		// couldn't be determined (typically because conn is a stream
+		// transport), so return it alongside the error rather than
+		// discarding it.
+		return NATBehavior{Mapping: mapping, MappingLifetime: lifetime}, err
 	}
 
-	defer mapTestConn.Close()
+	return NATBehavior{
+		Mapping:         mapping,
+		Filtering:       filtering,
+		MappingLifetime: lifetime,
+	}, nil
+}
+
+// discoverMappingBehavior runs RFC 5780 section 4.3 Tests I-III to
+// determine whether the NAT's external mapping for a given internal
+// address:port is endpoint-independent, address-dependent, or
+// address-and-port-dependent. It also populates conn.OtherAddr as a side
+// effect, which discoverFilteringBehavior relies on.
+func discoverMappingBehavior(conn *StunServerConn) (Behavior, time.Duration, error) {
+	var xorAddr1, xorAddr2, xorAddr3 stun.XORMappedAddress
 
-	// Test I: Regular binding request
 	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
 
-	resp, err := mapTestConn.RoundTrip(message, mapTestConn.PrimaryAddr)
+	// Test I: Regular binding request to the primary address/port.
+	firstRequestAt := time.Now()
+	resp, err := conn.RoundTrip(message, conn.PrimaryAddr)
 	if err != nil {
-		return false, fmt.Errorf("error completing roundtrip map test: %w", err)
+		return "", 0, fmt.Errorf("error completing roundtrip map test: %w", err)
 	}
 
-	// Decoding XOR-MAPPED-ADDRESS attribute from message.
 	if err = xorAddr1.GetFrom(resp); err != nil {
-		return false, fmt.Errorf("error retrieving XOR-MAPPED-ADDRESS resonse: %w", err)
+		return "", 0, fmt.Errorf("error retrieving XOR-MAPPED-ADDRESS resonse: %w", err)
 	}
 
-	// Decoding OTHER-ADDRESS attribute from message.
 	var otherAddr stun.OtherAddress
 	if err = otherAddr.GetFrom(resp); err != nil {
-		return false, fmt.Errorf("NAT discovery feature not supported: %w", err)
+		return "", 0, fmt.Errorf("NAT discovery feature not supported: %w", err)
+	}
+	if err = conn.AddOtherAddr(otherAddr.String()); err != nil {
+		return "", 0, fmt.Errorf("error resolving address %s: %w", otherAddr.String(), err)
+	}
+
+	// Test II: Send a binding request to the other server address, but
+	// keep the primary port, to check whether mapping depends on the
+	// destination address.
+	otherAddrPrimaryPort := *conn.OtherAddr
+	otherAddrPrimaryPort.Port = conn.PrimaryAddr.Port
+	resp, err = conn.RoundTrip(message, &otherAddrPrimaryPort)
+	if err != nil {
+		return "", 0, fmt.Errorf("error retrieveing server response: %w", err)
+	}
+	if err = xorAddr2.GetFrom(resp); err != nil {
+		return "", 0, fmt.Errorf("error retrieving XOR-MAPPED-ADDRESS resonse: %w", err)
 	}
 
-	if err = mapTestConn.AddOtherAddr(otherAddr.String()); err != nil {
-		return false, fmt.Errorf("error resolving address %s: %w", otherAddr.String(), err)
+	if xorAddr1.String() == xorAddr2.String() {
+		// Mapping is stable across destination addresses; re-send the
+		// same request once more to the primary address to estimate how
+		// long the mapping is kept alive.
+		lifetime := time.Duration(0)
+		if resp, err := conn.RoundTrip(message, conn.PrimaryAddr); err == nil {
+			var xorAddrRepeat stun.XORMappedAddress
+			if xorAddrRepeat.GetFrom(resp) == nil && xorAddrRepeat.String() == xorAddr1.String() {
+				lifetime = time.Since(firstRequestAt)
+			}
+		}
+		return EndpointIndependent, lifetime, nil
 	}
 
-	// Test II: Send binding request to other address
-	resp, err = mapTestConn.RoundTrip(message, mapTestConn.OtherAddr)
+	// Test III: Send a binding request to the other address and port, to
+	// distinguish address-dependent from address-and-port-dependent
+	// mapping.
+	resp, err = conn.RoundTrip(message, conn.OtherAddr)
 	if err != nil {
-		return false, fmt.Errorf("error retrieveing server response: %w", err)
+		return "", 0, fmt.Errorf("error retrieveing server response: %w", err)
+	}
+	if err = xorAddr3.GetFrom(resp); err != nil {
+		return "", 0, fmt.Errorf("error retrieving XOR-MAPPED-ADDRESS resonse: %w", err)
 	}
 
-	// Decoding XOR-MAPPED-ADDRESS attribute from message.
-	if err = xorAddr2.GetFrom(resp); err != nil {
-		return false, fmt.Errorf("error retrieving XOR-MAPPED-ADDRESS resonse: %w", err)
+	if xorAddr3.String() == xorAddr2.String() {
+		return AddressDependent, 0, nil
+	}
+	return AddressAndPortDependent, 0, nil
+}
+
+// discoverFilteringBehavior runs RFC 5780 section 4.4 Tests II-III using
+// the CHANGE-REQUEST attribute to determine whether the NAT accepts
+// unsolicited traffic from any source (endpoint-independent filtering),
+// only from the address the request was sent to (address-dependent), or
+// only from the exact address and port (address-and-port-dependent).
+// conn.OtherAddr must already be populated, as it is by
+// discoverMappingBehavior.
+func discoverFilteringBehavior(conn *StunServerConn) (Behavior, error) {
+	if conn.OtherAddr == nil {
+		return "", fmt.Errorf("NAT discovery feature not supported: missing OTHER-ADDRESS")
+	}
+
+	// Test II: ask the server to respond from a different IP and port.
+	changeIPAndPort := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	changeIPAndPort.Add(stun.AttrChangeRequest, []byte{0x00, 0x00, 0x00, 0x06})
+	if _, err := conn.RoundTrip(changeIPAndPort, conn.PrimaryAddr); err == nil {
+		return EndpointIndependent, nil
+	} else if !errors.Is(err, ErrTimedOut) {
+		return "", fmt.Errorf("error completing roundtrip filtering test: %w", err)
+	}
+
+	// Test III: ask the server to respond from the same IP but a
+	// different port.
+	changePortOnly := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	changePortOnly.Add(stun.AttrChangeRequest, []byte{0x00, 0x00, 0x00, 0x02})
+	if _, err := conn.RoundTrip(changePortOnly, conn.PrimaryAddr); err == nil {
+		return AddressDependent, nil
+	} else if !errors.Is(err, ErrTimedOut) {
+		return "", fmt.Errorf("error completing roundtrip filtering test: %w", err)
 	}
 
-	return xorAddr1.String() != xorAddr2.String(), nil
+	return AddressAndPortDependent, nil
+}
+
+const (
+	schemeUDP = "stun:"
+	schemeTCP = "stun+tcp:"
+	schemeTLS = "stuns:"
+)
 
+// parseServerAddr splits addrStr into a transport network ("udp4", "tcp",
+// or "tls") and the bare host:port to dial, defaulting to "udp4" when
+// addrStr has no recognized scheme prefix (preserving the historical
+// bare-host:port behavior of this package).
+func parseServerAddr(addrStr string) (network, hostport string) {
+	switch {
+	case strings.HasPrefix(addrStr, schemeTCP):
+		return "tcp", strings.TrimPrefix(addrStr, schemeTCP)
+	case strings.HasPrefix(addrStr, schemeTLS):
+		return "tls", strings.TrimPrefix(addrStr, schemeTLS)
+	case strings.HasPrefix(addrStr, schemeUDP):
+		return "udp4", strings.TrimPrefix(addrStr, schemeUDP)
+	default:
+		return "udp4", addrStr
+	}
 }
 
-// Given an address string, returns a StunServerConn
+// connect dials addrStr (see DiscoverNATBehavior for accepted schemes) and
+// returns a StunServerConn ready to use for RFC 5780 tests.
 func connect(addrStr string, proxyAddr *url.URL) (*StunServerConn, error) {
+	network, hostport := parseServerAddr(addrStr)
+	if network == "tcp" || network == "tls" {
+		return connectStream(network, hostport, proxyAddr)
+	}
+	return connectUDP(hostport, proxyAddr)
+}
+
+// connectUDP dials a plain UDP STUN server, optionally through a SOCKS5
+// UDP association.
+func connectUDP(addrStr string, proxyAddr *url.URL) (*StunServerConn, error) {
 	// Creating a "connection" to STUN server.
 	var conn net.PacketConn
 
@@ -140,31 +340,192 @@ func connect(addrStr string, proxyAddr *url.URL) (*StunServerConn, error) {
 	}, nil
 }
 
+// connectStream dials a STUN/TCP ("tcp") or STUN/TLS ("tls") server,
+// optionally through a SOCKS5 CONNECT rather than a UDP association.
+func connectStream(network, addrStr string, proxyAddr *url.URL) (*StunServerConn, error) {
+	conn, err := dialStreamPeer(network, addrStr, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// PrimaryAddr is kept as a *net.UDPAddr purely for its IP/Port
+	// bookkeeping (discoverMappingBehavior builds other addresses out of
+	// it); it is never used to address a packet, since addressing over a
+	// stream transport happens at dial time instead.
+	addr, err := net.ResolveUDPAddr("udp4", addrStr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &StunServerConn{
+		streamConn:  conn,
+		isStream:    true,
+		network:     network,
+		proxyAddr:   proxyAddr,
+		PrimaryAddr: addr,
+		messageChan: listenStream(conn),
+	}, nil
+}
+
+// dialStreamPeer opens a TCP connection to addrStr, through proxyAddr via
+// SOCKS5 CONNECT if set, upgrading to TLS when network is "tls".
+func dialStreamPeer(network, addrStr string, proxyAddr *url.URL) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if proxyAddr != nil {
+		socksClient := proxy.NewSocks5UDPClient(proxyAddr)
+		conn, err = socksClient.DialContext(context.Background(), "tcp", addrStr)
+	} else {
+		conn, err = net.Dial("tcp", addrStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if network != "tls" {
+		return conn, nil
+	}
+
+	host, _, err := net.SplitHostPort(addrStr)
+	if err != nil {
+		host = addrStr
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %w", addrStr, err)
+	}
+	return tlsConn, nil
+}
+
+const (
+	// initialRTO is the initial retransmission timeout, as recommended by
+	// RFC 5389 section 7.2.1.
+	initialRTO = 500 * time.Millisecond
+	// maxRetransmits is the number of requests sent (the first one plus
+	// its retransmits) before giving up,
+	// following the Rc=7 request/Rm=16 final-wait schedule of RFC 5389
+	// section 7.2.1 (7 requests plus a final wait at 16x the RTO is
+	// equivalent to roughly 9 RTO-spaced attempts).
+	maxRetransmits = 7
+	// finalWaitMultiplier is how long, as a multiple of initialRTO, to
+	// keep waiting for a response after the last request's own wait has
+	// run out, before giving up.
+	finalWaitMultiplier = 16
+)
+
+// streamResponseTimeout bounds how long RoundTrip waits for a response over
+// a stream transport. Unlike UDP, TCP/TLS delivery is reliable, so there's
+// no need for RFC 5389's exponential retransmission schedule — a single
+// generous wait is enough.
+const streamResponseTimeout = 8 * time.Second
+
 type StunServerConn struct {
 	conn        net.PacketConn
 	PrimaryAddr *net.UDPAddr
 	OtherAddr   *net.UDPAddr
 	messageChan chan *stun.Message
+
+	// isStream, network, streamConn, and proxyAddr are set by
+	// connectStream instead of connectUDP, and let RoundTrip dial a
+	// fresh connection per destination address, since a TCP/TLS socket
+	// can't retarget an established peer the way a UDP socket can.
+	isStream   bool
+	network    string
+	streamConn net.Conn
+	proxyAddr  *url.URL
 }
 
 func (c *StunServerConn) Close() {
+	if c.isStream {
+		c.streamConn.Close()
+		return
+	}
 	c.conn.Close()
 }
 
+// RoundTrip sends msg to addr and waits for a response.
+//
+// Over UDP it retransmits with an exponentially increasing timeout per RFC
+// 5389 section 7.2.1: it sends msg up to maxRetransmits times, waiting
+// initialRTO after the first send and doubling the wait after each later
+// one, then waits a further finalWaitMultiplier times initialRTO before
+// giving up with ErrTimedOut. This lets binding-change tests (which rely on a timeout to
+// signal a negative result) distinguish a dropped packet from a NAT that is
+// genuinely filtering the reply.
+//
+// Over a stream transport, msg carrying a CHANGE-REQUEST attribute fails
+// immediately with ErrChangeRequestUnsupportedOverStream, since there is no
+// way to ask a stream peer to reply from a different address or port. A
+// request to an address other than the one this StunServerConn is already
+// connected to is satisfied by dialing a new, short-lived connection to
+// that address.
 func (c *StunServerConn) RoundTrip(msg *stun.Message, addr net.Addr) (*stun.Message, error) {
-	_, err := c.conn.WriteTo(msg.Raw, addr)
-	if err != nil {
-		return nil, err
+	if c.isStream {
+		return c.roundTripStream(msg, addr)
+	}
+
+	rto := initialRTO
+	for attempt := 0; attempt < maxRetransmits; attempt++ {
+		if _, err := c.conn.WriteTo(msg.Raw, addr); err != nil {
+			return nil, err
+		}
+
+		select {
+		case m, ok := <-c.messageChan:
+			if !ok {
+				return nil, fmt.Errorf("error reading from messageChan")
+			}
+			return m, nil
+		case <-time.After(rto):
+			rto *= 2
+		}
 	}
 
-	// Wait for response or timeout
 	select {
 	case m, ok := <-c.messageChan:
 		if !ok {
 			return nil, fmt.Errorf("error reading from messageChan")
 		}
 		return m, nil
-	case <-time.After(10 * time.Second):
+	case <-time.After(initialRTO * finalWaitMultiplier):
+		return nil, ErrTimedOut
+	}
+}
+
+func (c *StunServerConn) roundTripStream(msg *stun.Message, addr net.Addr) (*stun.Message, error) {
+	if msg.Contains(stun.AttrChangeRequest) {
+		return nil, ErrChangeRequestUnsupportedOverStream
+	}
+
+	if addr.String() == c.PrimaryAddr.String() {
+		return roundTripOnConn(c.streamConn, c.messageChan, msg)
+	}
+
+	// A mapping test against a different destination can't reuse this
+	// connection's established peer; open a short-lived one instead.
+	peerConn, err := dialStreamPeer(c.network, addr.String(), c.proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing %s: %w", addr, err)
+	}
+	defer peerConn.Close()
+	return roundTripOnConn(peerConn, listenStream(peerConn), msg)
+}
+
+// roundTripOnConn writes msg to conn and waits up to streamResponseTimeout
+// for a response decoded by mChan's feeding goroutine (see listenStream).
+func roundTripOnConn(conn net.Conn, mChan chan *stun.Message, msg *stun.Message) (*stun.Message, error) {
+	if _, err := conn.Write(msg.Raw); err != nil {
+		return nil, err
+	}
+	select {
+	case m, ok := <-mChan:
+		if !ok {
+			return nil, fmt.Errorf("error reading from messageChan")
+		}
+		return m, nil
+	case <-time.After(streamResponseTimeout):
 		return nil, ErrTimedOut
 	}
 }
@@ -205,3 +566,46 @@ func listen(conn net.PacketConn) chan *stun.Message {
 	}()
 	return messages
 }
+
+// stunHeaderLength is the fixed size, in bytes, of a STUN message header:
+// 2 bytes message type, 2 bytes message length, 4 bytes magic cookie, and
+// 12 bytes transaction ID (RFC 5389 section 6).
+const stunHeaderLength = 20
+
+// listenStream decodes a stream of length-prefixed STUN messages off conn,
+// per RFC 5389 section 7.2.2/7.2.3, and posts each to the returned channel,
+// which is closed when conn errors (typically on close). The "length
+// prefix" stream transports need is the STUN header's own 2-byte Message
+// Length field: each message is read by first reading the fixed-size
+// header to learn how many more bytes follow, then reading exactly that
+// many more.
+func listenStream(conn net.Conn) chan *stun.Message {
+	messages := make(chan *stun.Message)
+	go func() {
+		defer close(messages)
+		for {
+			header := make([]byte, stunHeaderLength)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			bodyLen := binary.BigEndian.Uint16(header[2:4])
+
+			buf := make([]byte, stunHeaderLength+int(bodyLen))
+			copy(buf, header)
+			if bodyLen > 0 {
+				if _, err := io.ReadFull(conn, buf[stunHeaderLength:]); err != nil {
+					return
+				}
+			}
+
+			m := new(stun.Message)
+			m.Raw = buf
+			if err := m.Decode(); err != nil {
+				return
+			}
+
+			messages <- m
+		}
+	}()
+	return messages
+}
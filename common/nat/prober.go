@@ -0,0 +1,183 @@
+package nat
+
+import (
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+)
+
+// ProbeResult records the outcome of probing a single STUN server, for
+// diagnostics and for the broker's client-reported NAT metric.
+type ProbeResult struct {
+	Server  string
+	Latency time.Duration
+	Err     error
+}
+
+// DiscoverNATBehaviorMulti races RFC 5780 discovery against each of servers
+// concurrently through proxy (which may be nil), returning the behavior
+// from whichever server answers successfully first. It also returns a
+// ProbeResult, in the order the probes completed, for every server whose
+// probe completed up to and including the first success (for every server
+// when none succeeds), so callers can record per-server latency and
+// failures.
+func DiscoverNATBehaviorMulti(servers []string, proxy *url.URL) (NATBehavior, []ProbeResult, error) {
+	type outcome struct {
+		behavior NATBehavior
+		result   ProbeResult
+	}
+
+	outcomes := make(chan outcome, len(servers))
+	for _, server := range servers {
+		server := server
+		go func() {
+			start := time.Now()
+			behavior, err := DiscoverNATBehavior(server, proxy)
+			outcomes <- outcome{
+				behavior: behavior,
+				result:   ProbeResult{Server: server, Latency: time.Since(start), Err: err},
+			}
+		}()
+	}
+
+	var results []ProbeResult
+	var firstErr error
+	for range servers {
+		o := <-outcomes
+		results = append(results, o.result)
+		if o.result.Err == nil {
+			return o.behavior, results, nil
+		}
+		if firstErr == nil {
+			firstErr = o.result.Err
+		}
+	}
+	if firstErr == nil {
+		firstErr = ErrNoServers
+	}
+	return NATBehavior{}, results, firstErr
+}
+
+// ErrNoServers is returned by DiscoverNATBehaviorMulti and Prober.Refresh
+// when the server list is empty.
+var ErrNoServers = &net.AddrError{Err: "no STUN servers configured", Addr: ""}
+
+// defaultCacheTTL is how long Prober trusts a cached classification before
+// Behavior triggers a fresh probe on its own.
+const defaultCacheTTL = 10 * time.Minute
+
+// Prober maintains a cached RFC 5780 NAT classification, keyed by which
+// local address the host is currently routing outbound traffic through, and
+// re-probes the configured STUN servers whenever that changes, the cache
+// goes stale, or Refresh is called explicitly. This keeps the classification
+// honest for a client that migrates networks (e.g. a phone moving from Wi-Fi
+// to cellular) partway through a long-lived Tor session, where a single
+// probe taken at startup would otherwise go stale silently.
+type Prober struct {
+	Servers []string
+	Proxy   *url.URL
+	TTL     time.Duration
+	// EventDispatcher, if set, receives an
+	// event.EventOnNATBehaviorDetermined every time Refresh changes the
+	// cached classification.
+	EventDispatcher event.SnowflakeEventReceiver
+
+	lock      sync.Mutex
+	cached    NATBehavior
+	cachedAt  time.Time
+	cachedKey string
+	lastErr   error
+}
+
+// NewProber constructs a Prober that probes servers (through proxy, which
+// may be nil) and caches results for ttl (defaultCacheTTL if ttl <= 0).
+func NewProber(servers []string, proxy *url.URL, ttl time.Duration) *Prober {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Prober{
+		Servers: servers,
+		Proxy:   proxy,
+		TTL:     ttl,
+	}
+}
+
+// Behavior returns the cached NAT classification, re-probing first if the
+// cache is empty, stale, or the outbound interface has changed since the
+// last probe.
+func (p *Prober) Behavior() (NATBehavior, error) {
+	key, err := outboundInterfaceID(p.Servers, p.Proxy)
+	if err != nil {
+		key = ""
+	}
+
+	p.lock.Lock()
+	fresh := !p.cachedAt.IsZero() &&
+		time.Since(p.cachedAt) < p.TTL &&
+		(key == "" || key == p.cachedKey)
+	behavior, lastErr := p.cached, p.lastErr
+	p.lock.Unlock()
+
+	if fresh {
+		return behavior, lastErr
+	}
+	return p.Refresh()
+}
+
+// Refresh unconditionally re-probes the configured STUN servers, updates
+// the cache, and — if the classification changed from what was previously
+// cached — notifies EventDispatcher. Within this package only Behavior
+// calls it, when the cache is empty, stale, or keyed to another outbound
+// interface; the client's socksAcceptLoop does not call it.
+func (p *Prober) Refresh() (NATBehavior, error) {
+	behavior, _, err := DiscoverNATBehaviorMulti(p.Servers, p.Proxy)
+	key, keyErr := outboundInterfaceID(p.Servers, p.Proxy)
+	if keyErr != nil {
+		key = ""
+	}
+
+	p.lock.Lock()
+	changed := err == nil && (p.lastErr != nil || behavior != p.cached)
+	if err == nil {
+		p.cached = behavior
+		p.cachedAt = time.Now()
+		p.cachedKey = key
+	}
+	p.lastErr = err
+	p.lock.Unlock()
+
+	if changed && p.EventDispatcher != nil {
+		p.EventDispatcher.OnNewSnowflakeEvent(event.EventOnNATBehaviorDetermined{
+			Mapping:         string(behavior.Mapping),
+			Filtering:       string(behavior.Filtering),
+			MappingLifetime: behavior.MappingLifetime,
+		})
+	}
+
+	return behavior, err
+}
+
+// outboundInterfaceID identifies, as a best effort, the local address the
+// host currently uses to reach the given STUN servers. It changes when the
+// host migrates to a different network interface or gets a new DHCP lease,
+// which is the signal Prober uses to decide a cached classification might
+// no longer be valid.
+func outboundInterfaceID(servers []string, proxy *url.URL) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoServers
+	}
+	if proxy != nil {
+		// Outbound routing is determined by the proxy, not by a local
+		// interface; there's nothing meaningful to key on.
+		return "", nil
+	}
+	conn, err := net.Dial("udp4", servers[0])
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String(), nil
+}
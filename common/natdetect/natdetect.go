@@ -0,0 +1,51 @@
+// Package natdetect gives a client a single authoritative answer to "what
+// is my NAT type", classified locally at startup, instead of trusting
+// whatever the broker-side proxy probetest last reported for some other
+// client behind the same NAT.
+package natdetect
+
+import (
+	"context"
+	"net/url"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/nat"
+)
+
+// NATType is one of nat.NATUnknown, nat.NATRestricted, or
+// nat.NATUnrestricted: the coarse classification the broker protocol's NAT
+// field expects, as opposed to nat.NATBehavior's full RFC 5780
+// mapping/filtering pair.
+type NATType = string
+
+// Classify races RFC 5780 behavior discovery (see nat.DiscoverNATBehaviorMulti)
+// against every server in servers, through proxy (which may be nil), and
+// collapses whichever result answers first to the broker's coarse NATType.
+// It returns nat.NATUnknown alongside ctx's error if ctx ends before any
+// server answers; callers should give ctx a short deadline, since this is
+// meant to run once at startup rather than block it indefinitely.
+func Classify(ctx context.Context, servers []string, proxy *url.URL) (NATType, error) {
+	type outcome struct {
+		natType NATType
+		err     error
+	}
+	resultCh := make(chan outcome, 1)
+	go func() {
+		behavior, _, err := nat.DiscoverNATBehaviorMulti(servers, proxy)
+		if err != nil {
+			resultCh <- outcome{nat.NATUnknown, err}
+			return
+		}
+		if behavior.IsRestricted() {
+			resultCh <- outcome{nat.NATRestricted, nil}
+		} else {
+			resultCh <- outcome{nat.NATUnrestricted, nil}
+		}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.natType, result.err
+	case <-ctx.Done():
+		return nat.NATUnknown, ctx.Err()
+	}
+}
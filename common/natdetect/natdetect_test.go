@@ -0,0 +1,101 @@
+package natdetect
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/nat"
+)
+
+// fakeSTUNServer simulates a fully permissive (endpoint-independent
+// mapping and filtering) NAT/STUN pair for exercising Classify without a
+// real network: primary and other are two distinct UDP sockets, each
+// echoing the same XOR-MAPPED-ADDRESS regardless of which socket a request
+// arrived on (endpoint-independent mapping), and primary answers a
+// CHANGE-REQUEST by replying from other's socket instead of its own
+// (endpoint-independent filtering).
+type fakeSTUNServer struct {
+	primary, other *net.UDPConn
+}
+
+func newFakeSTUNServer(t *testing.T) *fakeSTUNServer {
+	t.Helper()
+	primary, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening primary: %v", err)
+	}
+	other, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		primary.Close()
+		t.Fatalf("listening other: %v", err)
+	}
+	s := &fakeSTUNServer{primary: primary, other: other}
+	go s.serve(primary, other)
+	go s.serve(other, other)
+	t.Cleanup(func() {
+		primary.Close()
+		other.Close()
+	})
+	return s
+}
+
+func (s *fakeSTUNServer) serve(conn *net.UDPConn, changeReplyFrom *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, raddr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+		if err := req.Decode(); err != nil {
+			continue
+		}
+
+		resp := stun.MustBuild(req, stun.BindingSuccess)
+		xorAddr := &stun.XORMappedAddress{IP: raddr.IP, Port: raddr.Port}
+		xorAddr.AddTo(resp)
+		otherAddr := &stun.OtherAddress{IP: s.other.LocalAddr().(*net.UDPAddr).IP, Port: s.other.LocalAddr().(*net.UDPAddr).Port}
+		otherAddr.AddTo(resp)
+
+		replyFrom := conn
+		if req.Contains(stun.AttrChangeRequest) {
+			replyFrom = changeReplyFrom
+		}
+		replyFrom.WriteToUDP(resp.Raw, raddr)
+	}
+}
+
+func (s *fakeSTUNServer) addr() string {
+	return s.primary.LocalAddr().String()
+}
+
+func TestClassifyUnrestricted(t *testing.T) {
+	server := newFakeSTUNServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	natType, err := Classify(ctx, []string{server.addr()}, nil)
+	if err != nil {
+		t.Fatalf("Classify: %v", err)
+	}
+	if natType != nat.NATUnrestricted {
+		t.Errorf("Classify() = %q, want %q", natType, nat.NATUnrestricted)
+	}
+}
+
+func TestClassifyUnreachableTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	natType, err := Classify(ctx, []string{"127.0.0.1:1"}, nil)
+	if err == nil {
+		t.Fatal("Classify with no reachable server: expected an error, got nil")
+	}
+	if natType != nat.NATUnknown {
+		t.Errorf("Classify() with no reachable server = %q, want %q", natType, nat.NATUnknown)
+	}
+}
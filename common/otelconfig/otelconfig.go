@@ -0,0 +1,215 @@
+// Package otelconfig builds OTLP metric and trace exporters from a small,
+// flag-friendly Config, shared by snowflake-proxy and the broker so both
+// processes construct their OTLP pipeline the same way and can be pointed
+// at the same collector.
+package otelconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Config holds the settings common to every OTLP exporter this package
+// builds. It is designed to be filled in directly from flag.String/
+// flag.Bool values, the same way the rest of this repo's config structs
+// (e.g. proxy/lib.SnowflakeProxy) are.
+type Config struct {
+	// Endpoint is the collector's host:port (http/grpc) or host:port/path
+	// (http). Required; NewMeterProvider and NewTracerProvider return an
+	// error if it's empty.
+	Endpoint string
+	// Headers are sent with every export request, e.g. for collector
+	// authentication. See ParseHeaders for the "-otlp-headers" flag format.
+	Headers map[string]string
+	// Protocol selects the wire protocol: "http" (gzip-compressed protobuf
+	// POSTs to /v1/metrics and /v1/traces, the default) or "grpc".
+	Protocol string
+	// Insecure disables TLS on the exporter connection, for a collector
+	// reached over a private network or an SSH tunnel.
+	Insecure bool
+	// Compression is "gzip", or "" or "none" for no compression. Any other
+	// value is an error.
+	Compression string
+}
+
+// ParseHeaders parses the "-otlp-headers" flag value, a comma-separated
+// list of key=value pairs (the same format as the OTEL_EXPORTER_OTLP_HEADERS
+// environment variable), into the map NewMeterProvider/NewTracerProvider
+// expect.
+func ParseHeaders(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -otlp-headers entry %q: want key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// retryBackoff is the exponential-backoff schedule handed to the official
+// exporters' own retry machinery (both the HTTP and gRPC OTLP exporters
+// already retry on 429/5xx and honor a Retry-After response header
+// themselves; this just bounds how long and how hard they retry before
+// giving up on one export).
+var retryBackoff = struct {
+	Enabled         bool
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+}{
+	Enabled:         true,
+	InitialInterval: 1 * time.Second,
+	MaxInterval:     30 * time.Second,
+	MaxElapsedTime:  1 * time.Minute,
+}
+
+// NewMeterProvider builds a periodic-reader MeterProvider backed by an OTLP
+// exporter configured from cfg.
+func NewMeterProvider(ctx context.Context, cfg Config) (*sdkmetric.MeterProvider, error) {
+	exporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+	), nil
+}
+
+// NewTracerProvider builds a batch-span-processor TracerProvider backed by
+// an OTLP exporter configured from cfg.
+func NewTracerProvider(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	exporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+	), nil
+}
+
+func newMetricExporter(ctx context.Context, cfg Config) (sdkmetric.Exporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("otlpconfig: endpoint is required")
+	}
+	compression, err := metricCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Protocol {
+	case "", "http":
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(cfg.Endpoint),
+			otlpmetrichttp.WithCompression(compression),
+			otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig(retryBackoff)),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	case "grpc":
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(cfg.Endpoint),
+			otlpmetricgrpc.WithCompressor(grpcCompressorName(cfg.Compression)),
+			otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig(retryBackoff)),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(cfg.Headers))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("otlpconfig: unknown protocol %q (want \"http\" or \"grpc\")", cfg.Protocol)
+	}
+}
+
+func newTraceExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("otlpconfig: endpoint is required")
+	}
+	compression, err := traceCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Protocol {
+	case "", "http":
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(cfg.Endpoint),
+			otlptracehttp.WithCompression(compression),
+			otlptracehttp.WithRetry(otlptracehttp.RetryConfig(retryBackoff)),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case "grpc":
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(cfg.Endpoint),
+			otlptracegrpc.WithCompressor(grpcCompressorName(cfg.Compression)),
+			otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(retryBackoff)),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(cfg.Headers))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("otlpconfig: unknown protocol %q (want \"http\" or \"grpc\")", cfg.Protocol)
+	}
+}
+
+func metricCompression(compression string) (otlpmetrichttp.Compression, error) {
+	switch compression {
+	case "", "none":
+		return otlpmetrichttp.NoCompression, nil
+	case "gzip":
+		return otlpmetrichttp.GzipCompression, nil
+	default:
+		return 0, fmt.Errorf("otlpconfig: unknown compression %q (want \"gzip\" or \"\")", compression)
+	}
+}
+
+func traceCompression(compression string) (otlptracehttp.Compression, error) {
+	switch compression {
+	case "", "none":
+		return otlptracehttp.NoCompression, nil
+	case "gzip":
+		return otlptracehttp.GzipCompression, nil
+	default:
+		return 0, fmt.Errorf("otlpconfig: unknown compression %q (want \"gzip\" or \"\")", compression)
+	}
+}
+
+// grpcCompressorName maps Config.Compression onto the gRPC compressor
+// name the otlpmetricgrpc/otlptracegrpc WithCompressor options expect
+// ("gzip" is registered by importing google.golang.org/grpc/encoding/gzip,
+// which both packages do internally); "" disables compression.
+func grpcCompressorName(compression string) string {
+	if compression == "none" {
+		return ""
+	}
+	return compression
+}
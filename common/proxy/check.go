@@ -8,9 +8,19 @@ import (
 
 var errUnsupportedProxyType = errors.New("unsupported proxy type")
 
+// CheckProxyProtocolSupport reports whether proxy's scheme is one this
+// package's SocksClient can route both the TCP rendezvous and the UDP
+// ICE/STUN traffic through. "socks5h" is accepted alongside "socks5": this
+// package always forwards hostnames to the proxy for it to resolve (see
+// SocksClient.DialContext/ResolveUDPAddr), which is "socks5h" behavior
+// regardless of which of the two schemes is written in the URL.
+//
+// An HTTP CONNECT proxy (see HTTPConnectClient) is deliberately not accepted
+// here: CONNECT only tunnels TCP, so it cannot carry the UDP ASSOCIATE
+// traffic this check gates.
 func CheckProxyProtocolSupport(proxy *url.URL) error {
 	switch strings.ToLower(proxy.Scheme) {
-	case "socks5":
+	case "socks5", "socks5h":
 		return nil
 	default:
 		return errUnsupportedProxyType
@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/url"
@@ -12,12 +13,23 @@ import (
 	"github.com/miekg/dns"
 	"github.com/pion/transport/v3"
 	"github.com/txthinking/socks5"
+	xproxy "golang.org/x/net/proxy"
 )
 
 func NewSocks5UDPClient(addr *url.URL) SocksClient {
 	return SocksClient{addr: addr}
 }
 
+// DialUDPViaSOCKS5 opens a UDP ASSOCIATE session against the SOCKS5 proxy at
+// proxy and returns a net.PacketConn that wraps/strips the SOCKS5 UDP
+// request header (RFC 1928 section 7) on every datagram, so that WebRTC
+// ICE/STUN traffic (or any other UDP transport) can egress through e.g.
+// Tor's SocksPort, including per-connection circuit isolation via
+// IsolateSOCKSAuth and a username/password in proxy's URL.
+func DialUDPViaSOCKS5(proxy *url.URL) (net.PacketConn, error) {
+	return NewSocks5UDPClient(proxy).listenPacket()
+}
+
 type SocksClient struct {
 	addr *url.URL
 }
@@ -121,6 +133,103 @@ func (sc *SocksClient) listenPacket() (transport.UDPConn, error) {
 	return &SocksConn{conn, client}, nil
 }
 
+// ErrGSSAPIUnsupported is returned when the upstream SOCKS5 server will
+// accept only GSSAPI authentication (RFC 1961), which this client does not
+// implement.
+var ErrGSSAPIUnsupported = errors.New("socks5: GSSAPI authentication is not supported")
+
+// DialContext issues a SOCKS5 CONNECT request for the given TCP address and
+// returns the resulting connection, so that rendezvous transports that speak
+// TCP (the broker HTTP client, AMP cache, domain fronting) can be tunneled
+// through the same upstream SOCKS5 proxy as the WebRTC ICE traffic.
+func (sc *SocksClient) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+
+	var username, password string
+	if sc.addr.User != nil {
+		username = sc.addr.User.Username()
+		password, _ = sc.addr.User.Password()
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, sc.addr.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &socks5.Client{Server: sc.addr.Host, UserName: username, Password: password, TCPConn: conn, TCPTimeout: 300}
+	if err := negotiateMethod(client, username, password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	a, h, p, err := socks5.ParseAddress(addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if a == socks5.ATYPDomain {
+		h = h[1:]
+	}
+	if _, err := client.Request(socks5.NewRequest(socks5.CmdConnect, a, h, p)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// negotiateMethod performs the SOCKS5 method negotiation (RFC 1928 section
+// 3), offering no-auth, username/password (RFC 1929) when credentials are
+// configured, and GSSAPI (RFC 1961) last since it isn't implemented.
+func negotiateMethod(client *socks5.Client, username, password string) error {
+	methods := []byte{socks5.MethodNone}
+	if username != "" {
+		methods = append(methods, socks5.MethodUsernamePassword)
+	}
+	methods = append(methods, socks5.MethodGSSAPI)
+
+	if _, err := socks5.NewNegotiationRequest(methods).WriteTo(client.TCPConn); err != nil {
+		return err
+	}
+	reply, err := socks5.NewNegotiationReplyFrom(client.TCPConn)
+	if err != nil {
+		return err
+	}
+
+	switch reply.Method {
+	case socks5.MethodNone:
+		return nil
+	case socks5.MethodUsernamePassword:
+		req := socks5.NewUserPassNegotiationRequest([]byte(username), []byte(password))
+		if _, err := req.WriteTo(client.TCPConn); err != nil {
+			return err
+		}
+		rep, err := socks5.NewUserPassNegotiationReplyFrom(client.TCPConn)
+		if err != nil {
+			return err
+		}
+		if rep.Status != socks5.UserPassStatusSuccess {
+			return socks5.ErrUserPassAuth
+		}
+		return nil
+	case socks5.MethodGSSAPI:
+		return ErrGSSAPIUnsupported
+	default:
+		return errors.New("socks5: server did not accept any offered authentication method")
+	}
+}
+
+// Dialer returns sc as a proxy.ContextDialer, so that HTTP and other TCP
+// clients can be routed through the same SOCKS5 endpoint configured for
+// WebRTC ICE via -proxy.
+func (sc *SocksClient) Dialer() xproxy.ContextDialer {
+	return sc
+}
+
 func (s SocksConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
 	return s.WriteToUDP(p, addr.(*net.UDPAddr))
 }
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// HTTPConnectClient routes TCP connections through an HTTP proxy's CONNECT
+// method (RFC 9110 section 9.3.6), for rendezvous transports (the broker
+// HTTP client, AMP cache, domain fronting) in environments where only an
+// HTTP(S) proxy is available, not SOCKS. Unlike SocksClient, it has no UDP
+// ASSOCIATE equivalent, so it cannot carry WebRTC ICE/STUN traffic; see
+// CheckProxyProtocolSupport.
+type HTTPConnectClient struct {
+	addr *url.URL
+}
+
+// NewHTTPConnectClient builds an HTTPConnectClient dialing through the
+// HTTP(S) proxy at addr. Basic authentication credentials in addr.User, if
+// any, are sent as Proxy-Authorization on every CONNECT request.
+func NewHTTPConnectClient(addr *url.URL) HTTPConnectClient {
+	return HTTPConnectClient{addr: addr}
+}
+
+// DialContext issues an HTTP CONNECT request for addr and returns the
+// resulting tunnel, once the proxy replies with a 2xx status.
+func (c HTTPConnectClient) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, c.addr.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if c.addr.User != nil {
+		password, _ := c.addr.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(c.addr.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		conn.Close()
+		return nil, fmt.Errorf("http proxy CONNECT to %s failed: %s", addr, resp.Status)
+	}
+
+	return conn, nil
+}
+
+// Dialer returns c as a proxy.ContextDialer, mirroring SocksClient.Dialer.
+func (c HTTPConnectClient) Dialer() xproxy.ContextDialer {
+	return c
+}
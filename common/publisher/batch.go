@@ -0,0 +1,87 @@
+package publisher
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchSender delivers a batch of Events to a backend in a single call, for
+// backends (SNS's PublishBatch, for example) that charge per call rather
+// than per event.
+type BatchSender interface {
+	PublishBatch(ctx context.Context, events []Event) error
+}
+
+// BatchPublisher is a Publisher that accumulates Events and hands them to a
+// BatchSender once MaxBatchSize have arrived or FlushInterval has elapsed
+// since the first one was buffered, whichever comes first.
+type BatchPublisher struct {
+	Sender        BatchSender
+	MaxBatchSize  int
+	FlushInterval time.Duration
+
+	mu      sync.Mutex
+	pending []Event
+	timer   *time.Timer
+}
+
+// NewBatchPublisher builds a BatchPublisher that flushes to sender after
+// maxBatchSize events or flushInterval, whichever comes first. A
+// non-positive maxBatchSize or flushInterval falls back to 10 events or one
+// second, respectively.
+func NewBatchPublisher(sender BatchSender, maxBatchSize int, flushInterval time.Duration) *BatchPublisher {
+	if maxBatchSize <= 0 {
+		maxBatchSize = 10
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	return &BatchPublisher{
+		Sender:        sender,
+		MaxBatchSize:  maxBatchSize,
+		FlushInterval: flushInterval,
+	}
+}
+
+func (b *BatchPublisher) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	b.pending = append(b.pending, event)
+
+	var batch []Event
+	if len(b.pending) >= b.MaxBatchSize {
+		batch = b.pending
+		b.pending = nil
+		if b.timer != nil {
+			b.timer.Stop()
+			b.timer = nil
+		}
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.FlushInterval, b.flush)
+	}
+	b.mu.Unlock()
+
+	if batch == nil {
+		return nil
+	}
+	return b.Sender.PublishBatch(ctx, batch)
+}
+
+// flush is run by the FlushInterval timer, so it has no caller-supplied
+// context to forward; it uses context.Background() the same way other
+// fire-and-forget notification paths in the broker do.
+func (b *BatchPublisher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.timer = nil
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := b.Sender.PublishBatch(context.Background(), batch); err != nil {
+		log.Printf("BatchPublisher: error publishing batch: %v\n", err)
+	}
+}
@@ -0,0 +1,60 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	mu      sync.Mutex
+	batches [][]Event
+}
+
+func (f *fakeSender) PublishBatch(ctx context.Context, events []Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cp := make([]Event, len(events))
+	copy(cp, events)
+	f.batches = append(f.batches, cp)
+	return nil
+}
+
+func (f *fakeSender) snapshot() [][]Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.batches
+}
+
+func TestBatchPublisherFlushesOnSize(t *testing.T) {
+	sender := &fakeSender{}
+	bp := NewBatchPublisher(sender, 2, time.Hour)
+
+	bp.Publish(context.Background(), Event{Type: EventProxyAvailable, ClientID: "a"})
+	bp.Publish(context.Background(), Event{Type: EventProxyAvailable, ClientID: "b"})
+
+	batches := sender.snapshot()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2 events, got %+v", batches)
+	}
+}
+
+func TestBatchPublisherFlushesOnInterval(t *testing.T) {
+	sender := &fakeSender{}
+	bp := NewBatchPublisher(sender, 10, 20*time.Millisecond)
+
+	bp.Publish(context.Background(), Event{Type: EventClientMatched, ClientID: "c"})
+	time.Sleep(100 * time.Millisecond)
+
+	batches := sender.snapshot()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("expected one batch of 1 event after interval flush, got %+v", batches)
+	}
+}
+
+func TestNoOpDiscardsEvents(t *testing.T) {
+	if err := (NoOp{}).Publish(context.Background(), Event{Type: EventQueueCreated}); err != nil {
+		t.Fatalf("expected NoOp.Publish to never error, got %v", err)
+	}
+}
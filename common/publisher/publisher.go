@@ -0,0 +1,38 @@
+// Package publisher lets the broker fan broker-lifecycle and match events
+// (proxy-available, client-matched, queue-created) out to an external
+// pub/sub backend, in addition to the reply it hands back over a client's
+// own reply channel (an SQS queue, an sqsclient.RendezvousQueue receive, or
+// an HTTP response body). Interested clients or auxiliary services can then
+// subscribe to the backend (SNS to SQS, HTTPS, or Lambda, for example)
+// instead of long-polling their own channel.
+package publisher
+
+import "context"
+
+// Event types published by the broker.
+const (
+	EventProxyAvailable = "proxy-available"
+	EventClientMatched  = "client-matched"
+	EventQueueCreated   = "queue-created"
+)
+
+// Event is one broker lifecycle or match notification.
+type Event struct {
+	Type       string
+	ClientID   string
+	Attributes map[string]string
+}
+
+// Publisher fans Events out to subscribers. Implementations may buffer an
+// event rather than send it immediately, to batch several into one
+// backend call; callers should not assume Publish has flushed to the
+// backend by the time it returns.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// NoOp discards every event. It's the Publisher to use when no backend is
+// configured, so broker code can call Publish unconditionally.
+type NoOp struct{}
+
+func (NoOp) Publish(context.Context, Event) error { return nil }
@@ -0,0 +1,141 @@
+// Package redisclient implements sqsclient.RendezvousQueue on top of Redis
+// Streams, for operators who want queue-based rendezvous without an AWS
+// account: a request goes onto a shared stream, and proxies answer on a
+// stream named for the requesting client, mirroring the "send request, poll
+// per-client response channel" pattern sqsclient.AWSQueue uses for SQS.
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqsclient"
+)
+
+// requestStream is the single stream that every client's poll request is
+// published to; the broker consumes it to learn about new clients.
+const requestStream = "snowflake:rendezvous"
+
+// responseStreamPrefix names the per-client stream a client polls for proxy
+// answers, the same role "snowflake-client-<clientID>" plays for SQS.
+const responseStreamPrefix = "snowflake:client:"
+
+// StreamsQueue implements sqsclient.RendezvousQueue against a Redis server,
+// using one XADD-per-request and one per-client response stream per
+// rendezvous.
+type StreamsQueue struct {
+	client *redis.Client
+}
+
+// NewStreamsQueue connects to the Redis server at addr (host:port, or a full
+// redis:// URL), authenticating with creds if non-empty (a password, or a
+// "user:password" pair when ACL users are in use).
+func NewStreamsQueue(addr, creds string) (*StreamsQueue, error) {
+	opts, err := parseOptions(addr, creds)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamsQueue{client: redis.NewClient(opts)}, nil
+}
+
+func parseOptions(addr, creds string) (*redis.Options, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("redisclient: queue endpoint is required")
+	}
+	username, password := "", creds
+	if user, pass, ok := strings.Cut(creds, ":"); ok {
+		username, password = user, pass
+	}
+	if opts, err := redis.ParseURL(addr); err == nil {
+		if creds != "" {
+			opts.Username = username
+			opts.Password = password
+		}
+		return opts, nil
+	}
+	return &redis.Options{Addr: addr, Username: username, Password: password}, nil
+}
+
+// Send publishes a client's poll request to the shared request stream,
+// tagged with ClientID so the broker knows which response stream to answer
+// on.
+func (q *StreamsQueue) Send(ctx context.Context, clientID string, body []byte, attributes map[string]string) error {
+	values := make(map[string]interface{}, len(attributes)+2)
+	values["ClientID"] = clientID
+	values["Body"] = body
+	for k, v := range attributes {
+		values[k] = v
+	}
+	return q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: requestStream,
+		Values: values,
+	}).Err()
+}
+
+// Receive blocks on the client's response stream until maxMessages answers
+// have arrived or timeout elapses, returning whatever arrived; if nothing
+// did, it returns an error.
+func (q *StreamsQueue) Receive(ctx context.Context, clientID string, maxMessages int, timeout time.Duration) ([]sqsclient.QueueMessage, error) {
+	stream := responseStreamPrefix + clientID
+	lastID := "0"
+	deadline := time.Now().Add(timeout)
+
+	var pool []sqsclient.QueueMessage
+	for len(pool) < maxMessages {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		res, err := q.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{stream, lastID},
+			Count:   int64(maxMessages - len(pool)),
+			Block:   remaining,
+		}).Result()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range res {
+			for _, msg := range s.Messages {
+				pool = append(pool, queueMessageFromEntry(msg))
+				lastID = msg.ID
+			}
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("no answer received from response stream for client %s", clientID)
+	}
+	return pool, nil
+}
+
+// queueMessageFromEntry converts one Redis stream entry into a
+// sqsclient.QueueMessage, pulling Body out as raw bytes and leaving every
+// other field as an attribute.
+func queueMessageFromEntry(msg redis.XMessage) sqsclient.QueueMessage {
+	qm := sqsclient.QueueMessage{ID: msg.ID, Attributes: map[string]string{}}
+	for k, v := range msg.Values {
+		s := fmt.Sprint(v)
+		if k == "Body" {
+			qm.Body = []byte(s)
+			continue
+		}
+		qm.Attributes[k] = s
+	}
+	return qm
+}
+
+// Delete removes answered-but-unused entries from the client's response
+// stream so they don't linger.
+func (q *StreamsQueue) Delete(ctx context.Context, clientID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	stream := responseStreamPrefix + clientID
+	return q.client.XDel(ctx, stream, ids...).Err()
+}
@@ -0,0 +1,202 @@
+// Package s3client implements sqsclient.RendezvousQueue on top of an S3
+// bucket (or any S3-compatible endpoint), for operators who already run
+// rendezvous infrastructure on S3 rather than SQS: a client's poll request
+// is uploaded as an object under offers/, and the broker's answer(s) are
+// polled back from objects under answers/<clientID>/, mirroring the "send
+// request, poll per-client response channel" pattern sqsclient.AWSQueue
+// uses for SQS.
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqsclient"
+	sqscreds "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqscreds/lib"
+)
+
+// offersPrefix is where a client uploads its poll request, keyed by client
+// ID: offers/<clientID>/<requestID>.json. answersPrefix is where the broker
+// uploads the proxy answer(s) it matched that request with:
+// answers/<clientID>/<answerID>.json.
+const (
+	offersPrefix  = "offers/"
+	answersPrefix = "answers/"
+)
+
+// Queue implements sqsclient.RendezvousQueue against an S3 bucket.
+type Queue struct {
+	Client S3Client
+	Bucket string
+
+	// PollRetries bounds how many ListObjectsV2 polls Receive makes looking
+	// for an answer object before giving up. Defaults to 5 if <= 0.
+	PollRetries int
+	// PollDelay is the base delay between those polls. Defaults to one
+	// second if <= 0.
+	PollDelay time.Duration
+}
+
+// NewQueue builds a Queue backed by the S3 bucket named by bucket, in
+// region, authenticating with the base64-encoded sqscreds.AwsCreds in
+// credsStr. endpoint overrides the default AWS S3 endpoint, for LocalStack
+// or any other S3-compatible service.
+func NewQueue(bucket, credsStr, region, endpoint string) (*Queue, error) {
+	creds, err := sqscreds.AwsCredsFromBase64(credsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(creds.AwsAccessKeyId, creds.AwsSecretKey, creds.SessionToken),
+		),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var optFns []func(*s3.Options)
+	if endpoint != "" {
+		optFns = append(optFns, func(o *s3.Options) { o.BaseEndpoint = aws.String(endpoint) })
+	}
+
+	return &Queue{Client: s3.NewFromConfig(cfg, optFns...), Bucket: bucket}, nil
+}
+
+func (q *Queue) pollRetries() int {
+	if q.PollRetries <= 0 {
+		return 5
+	}
+
+	return q.PollRetries
+}
+
+func (q *Queue) pollDelay() time.Duration {
+	if q.PollDelay <= 0 {
+		return time.Second
+	}
+
+	return q.PollDelay
+}
+
+// Send uploads body as a new object under offers/<clientID>/, named with a
+// random request ID so that concurrent or retried sends for the same
+// client don't collide.
+func (q *Queue) Send(ctx context.Context, clientID string, body []byte, attributes map[string]string) error {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+
+	metadata := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		metadata[k] = v
+	}
+
+	key := offersPrefix + clientID + "/" + hex.EncodeToString(id[:]) + ".json"
+	_, err := q.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(q.Bucket),
+		Key:      aws.String(key),
+		Body:     bytes.NewReader(body),
+		Metadata: metadata,
+	})
+
+	return err
+}
+
+// Receive polls answers/<clientID>/ until maxMessages answer objects have
+// appeared, timeout elapses, or PollRetries polls have been made, returning
+// whatever arrived; if nothing did, it returns an error.
+func (q *Queue) Receive(ctx context.Context, clientID string, maxMessages int, timeout time.Duration) ([]sqsclient.QueueMessage, error) {
+	prefix := answersPrefix + clientID + "/"
+	deadline := time.Now().Add(timeout)
+
+	var pool []sqsclient.QueueMessage
+	for i := 0; i < q.pollRetries() && len(pool) < maxMessages && time.Now().Before(deadline); i++ {
+		res, err := q.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:  aws.String(q.Bucket),
+			Prefix:  aws.String(prefix),
+			MaxKeys: aws.Int32(int32(maxMessages - len(pool))),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(res.Contents) == 0 {
+			delay := float64(i)/2.0 + 1
+			time.Sleep(time.Duration(delay * float64(q.pollDelay())))
+
+			continue
+		}
+
+		for _, obj := range res.Contents {
+			qm, err := q.getAnswer(ctx, *obj.Key)
+			if err != nil {
+				continue
+			}
+			pool = append(pool, qm)
+		}
+	}
+
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("no answer received from bucket %s for client %s", q.Bucket, clientID)
+	}
+
+	return pool, nil
+}
+
+func (q *Queue) getAnswer(ctx context.Context, key string) (sqsclient.QueueMessage, error) {
+	res, err := q.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(q.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return sqsclient.QueueMessage{}, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return sqsclient.QueueMessage{}, err
+	}
+
+	qm := sqsclient.QueueMessage{ID: key, Body: body, Attributes: map[string]string{}}
+	for k, v := range res.Metadata {
+		qm.Attributes[k] = v
+	}
+
+	return qm, nil
+}
+
+// Delete removes answered-but-unused objects so they don't linger in the
+// bucket. ids are the object keys returned as QueueMessage.ID by Receive.
+func (q *Queue) Delete(ctx context.Context, clientID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	objects := make([]types.ObjectIdentifier, 0, len(ids))
+	for _, id := range ids {
+		objects = append(objects, types.ObjectIdentifier{Key: aws.String(id)})
+	}
+
+	_, err := q.Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(q.Bucket),
+		Delete: &types.Delete{Objects: objects},
+	})
+
+	return err
+}
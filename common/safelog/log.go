@@ -1,11 +1,11 @@
-//Package for a safer logging wrapper around the standard logging package
-
+// Package safelog provides a safer logging wrapper around the standard
+// logging package: an io.Writer that scrubs sensitive values (IP addresses
+// by default) out of each line before handing it to the real output.
 package safelog
 
 import (
 	"bytes"
 	"io"
-	"regexp"
 	"sync"
 )
 
@@ -22,15 +22,28 @@ const optionalPort = `(:\d{1,5})?`
 const addressPattern = `((` + ipv4Address + `)|(\[(` + ipv6Full + `)\])|(` + ipv6Full + `))` + optionalPort
 const fullAddrPattern = `(?:^|\s|[^\w:])(` + addressPattern + `)(?:\s|(:\s)|[^\w:]|$)`
 
-var scrubberPatterns = []*regexp.Regexp{
-	regexp.MustCompile(fullAddrPattern),
+// defaultScrubber is the Scrubber package-level Scrub and the zero-value
+// LogScrubber use: just the ip-address rule, matching safelog's behavior
+// from before Scrubber existed.
+var defaultScrubber = NewScrubber()
+
+// Scrub sanitizes b using the package's default Scrubber. Callers that need
+// extra rules (see RegisterRule) or JSON-aware mode (see EnableJSON) should
+// build their own *Scrubber with NewScrubber instead.
+func Scrub(b []byte) []byte {
+	return defaultScrubber.Scrub(b)
 }
 
-// An io.Writer that can be used as the output for a logger that first
-// sanitizes logs and then writes to the provided io.Writer
+// LogScrubber is an io.Writer that can be used as the output for a logger
+// that first sanitizes logs and then writes to the provided io.Writer.
 type LogScrubber struct {
 	Output io.Writer
-	buffer []byte
+	// Scrubber selects which rules and mode (line vs JSON-aware) Write
+	// applies. A nil Scrubber, the zero value, falls back to the package
+	// default (just the ip-address rule), so existing
+	// &LogScrubber{Output: ...} call sites keep working unchanged.
+	Scrubber *Scrubber
+	buffer   []byte
 
 	lock sync.Mutex
 }
@@ -38,25 +51,11 @@ type LogScrubber struct {
 func (ls *LogScrubber) Lock()   { (*ls).lock.Lock() }
 func (ls *LogScrubber) Unlock() { (*ls).lock.Unlock() }
 
-func Scrub(b []byte) []byte {
-	scrubbedBytes := b
-	for _, pattern := range scrubberPatterns {
-		// this is a workaround since go does not yet support look ahead or look
-		// behind for regular expressions.
-		var newBytes []byte
-		index := 0
-		for {
-			loc := pattern.FindSubmatchIndex(scrubbedBytes[index:])
-			if loc == nil {
-				break
-			}
-			newBytes = append(newBytes, scrubbedBytes[index:index+loc[2]]...)
-			newBytes = append(newBytes, []byte("[scrubbed]")...)
-			index = index + loc[3]
-		}
-		scrubbedBytes = append(newBytes, scrubbedBytes[index:]...)
+func (ls *LogScrubber) scrubber() *Scrubber {
+	if ls.Scrubber != nil {
+		return ls.Scrubber
 	}
-	return scrubbedBytes
+	return defaultScrubber
 }
 
 func (ls *LogScrubber) Write(b []byte) (n int, err error) {
@@ -71,7 +70,7 @@ func (ls *LogScrubber) Write(b []byte) (n int, err error) {
 			return
 		}
 		fullLines := ls.buffer[:i+1]
-		_, err = ls.Output.Write(Scrub(fullLines))
+		_, err = ls.Output.Write(ls.scrubber().Scrub(fullLines))
 		if err != nil {
 			return
 		}
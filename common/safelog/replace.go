@@ -0,0 +1,32 @@
+package safelog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// LiteralReplacer returns a replace function that discards every match and
+// substitutes literal in its place. This is the replacement safelog used
+// unconditionally before rules became pluggable.
+func LiteralReplacer(literal string) func([]byte) []byte {
+	replacement := []byte(literal)
+	return func([]byte) []byte {
+		return replacement
+	}
+}
+
+// HMACReplacer returns a replace function that substitutes the hex-encoded
+// HMAC-SHA256 of the match, keyed by key. Unlike LiteralReplacer, distinct
+// inputs produce distinct outputs while the same input always produces the
+// same output, so scrubbed values that recur
+// across log lines (the same client IP across several requests, say) can
+// still be correlated without an operator who only has the scrubbed logs
+// being able to recover the original value.
+func HMACReplacer(key []byte) func([]byte) []byte {
+	return func(match []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(match)
+		return []byte(hex.EncodeToString(mac.Sum(nil)))
+	}
+}
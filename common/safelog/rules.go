@@ -0,0 +1,54 @@
+package safelog
+
+import "regexp"
+
+// onionAddressPattern matches a Tor onion-service address: 16 base32
+// characters followed by ".onion" for a v2 address, or 56 for v3.
+const onionAddressPattern = `\b[a-z2-7]{16}(?:[a-z2-7]{40})?\.onion\b`
+
+// OnionAddressRule scrubs Tor onion-service addresses.
+func OnionAddressRule(replace func([]byte) []byte) Rule {
+	return Rule{Name: "onion-address", Pattern: regexp.MustCompile(onionAddressPattern), Replace: replace}
+}
+
+// iceCandidatePattern matches the connection-address field of an SDP ICE
+// candidate line (RFC 5245 Section 15.1), e.g.
+// "a=candidate:1 1 udp 2122260223 192.168.1.5 54400 typ host", capturing
+// just the address so the foundation, priority, port, and typ stay intact.
+const iceCandidatePattern = `(?m)(?:^a=candidate:\S+ \d+ \S+ \d+ )(` + addressPattern + `)(?: )`
+
+// ICECandidateRule scrubs the host/srflx/relay address out of SDP ICE
+// candidate lines, the "a=candidate:..." lines WebRTC offers and answers
+// carry.
+func ICECandidateRule(replace func([]byte) []byte) Rule {
+	return Rule{Name: "ice-candidate", Pattern: regexp.MustCompile(iceCandidatePattern), Replace: replace}
+}
+
+// jwtPattern matches a compact JSON Web Token: three dot-separated
+// base64url segments, each long enough to rule out incidental matches.
+const jwtPattern = `\b[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`
+
+// JWTRule scrubs compact-serialized JSON Web Tokens.
+func JWTRule(replace func([]byte) []byte) Rule {
+	return Rule{Name: "jwt", Pattern: regexp.MustCompile(jwtPattern), Replace: replace}
+}
+
+// awsCredsPattern matches a base64-encoded sqscreds.AwsCreds blob. The
+// encoded payload is opaque base64, so this only recognizes it by context:
+// a long base64 run immediately following something that looks like an AWS
+// credentials flag or field name, to avoid scrubbing unrelated base64 data
+// elsewhere in a log line.
+const awsCredsPattern = `(?i:aws[-_]?creds\S*[=:]\s*)([A-Za-z0-9+/]{20,}={0,2})`
+
+// AWSCredsRule scrubs base64-encoded sqscreds.AwsCreds values.
+func AWSCredsRule(replace func([]byte) []byte) Rule {
+	return Rule{Name: "aws-creds", Pattern: regexp.MustCompile(awsCredsPattern), Replace: replace}
+}
+
+// emailPattern matches an email address.
+const emailPattern = `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`
+
+// EmailRule scrubs email addresses.
+func EmailRule(replace func([]byte) []byte) Rule {
+	return Rule{Name: "email", Pattern: regexp.MustCompile(emailPattern), Replace: replace}
+}
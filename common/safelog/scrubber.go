@@ -0,0 +1,183 @@
+package safelog
+
+import (
+	"encoding/json"
+	"regexp"
+	"sync"
+)
+
+// Rule is one named scrubbing pattern: every match of Pattern is passed to
+// Replace and the result substituted in its place. If Pattern has a capture
+// group, only group 1 is substituted and the rest of the match is left
+// untouched (the same technique the original ip-address-only Scrub used to
+// keep the character before/after an address intact); otherwise the whole
+// match is substituted.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Replace func([]byte) []byte
+}
+
+// Scrubber applies an ordered set of Rules to log output, optionally in a
+// JSON-aware mode that scrubs only string field values of each line that
+// parses as JSON, leaving keys and structure alone.
+type Scrubber struct {
+	mu    sync.RWMutex
+	rules []Rule
+	json  bool
+}
+
+// NewScrubber builds a Scrubber with safelog's original rule already
+// registered: ip-address, replaced with the literal "[scrubbed]".
+func NewScrubber() *Scrubber {
+	s := &Scrubber{}
+	s.RegisterRule("ip-address", regexp.MustCompile(fullAddrPattern), LiteralReplacer("[scrubbed]"))
+	return s
+}
+
+// RegisterRule adds a rule under name, or replaces the existing rule of
+// that name in place if one is already registered. Rules run in
+// registration order (first registration order; a replacement keeps its
+// original position).
+func (s *Scrubber) RegisterRule(name string, pattern *regexp.Regexp, replace func([]byte) []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.rules {
+		if r.Name == name {
+			s.rules[i] = Rule{Name: name, Pattern: pattern, Replace: replace}
+			return
+		}
+	}
+	s.rules = append(s.rules, Rule{Name: name, Pattern: pattern, Replace: replace})
+}
+
+// EnableJSON turns JSON-aware mode on or off: when on, Scrub parses each
+// line as JSON and, if that succeeds, scrubs only string values (preserving
+// keys, numbers, and structure) instead of scrubbing the raw line text.
+// Lines that don't parse as JSON fall back to ordinary rule matching.
+func (s *Scrubber) EnableJSON(enable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.json = enable
+}
+
+// Scrub applies every registered rule to b, a buffer of one or more
+// newline-terminated lines, and returns the sanitized result.
+func (s *Scrubber) Scrub(b []byte) []byte {
+	s.mu.RLock()
+	rules := append([]Rule(nil), s.rules...)
+	useJSON := s.json
+	s.mu.RUnlock()
+
+	if !useJSON {
+		return applyRules(b, rules)
+	}
+
+	var out []byte
+	for _, line := range splitLines(b) {
+		trimmed, newline := trimNewline(line)
+		if scrubbed, ok := scrubJSONLine(trimmed, rules); ok {
+			out = append(out, scrubbed...)
+			out = append(out, newline...)
+			continue
+		}
+		out = append(out, applyRules(line, rules)...)
+	}
+	return out
+}
+
+// applyRules runs every rule over b in order, each rule's replacements
+// feeding into the next rule's input.
+func applyRules(b []byte, rules []Rule) []byte {
+	for _, r := range rules {
+		b = applyRule(b, r.Pattern, r.Replace)
+	}
+	return b
+}
+
+// applyRule substitutes every match of pattern in b, as described on Rule.
+func applyRule(b []byte, pattern *regexp.Regexp, replace func([]byte) []byte) []byte {
+	var out []byte
+	index := 0
+	for {
+		loc := pattern.FindSubmatchIndex(b[index:])
+		if loc == nil {
+			break
+		}
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] != -1 {
+			start, end = loc[2], loc[3]
+		}
+		out = append(out, b[index:index+start]...)
+		out = append(out, replace(b[index+start:index+end])...)
+		index += end
+	}
+	return append(out, b[index:]...)
+}
+
+// splitLines splits b into lines, each retaining its trailing newline (if
+// any), the same way bytes.SplitAfter with "\n" does.
+func splitLines(b []byte) [][]byte {
+	var lines [][]byte
+	start := 0
+	for i, c := range b {
+		if c == '\n' {
+			lines = append(lines, b[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(b) {
+		lines = append(lines, b[start:])
+	}
+	return lines
+}
+
+// trimNewline splits line into its content and its trailing newline (empty
+// if line had none).
+func trimNewline(line []byte) (content, newline []byte) {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		return line[:len(line)-1], line[len(line)-1:]
+	}
+	return line, nil
+}
+
+// scrubJSONLine parses line as a JSON value and, on success, scrubs every
+// string found within it (recursing into objects and arrays) before
+// re-marshaling. It reports false if line isn't valid JSON, so the caller
+// can fall back to scrubbing it as plain text.
+func scrubJSONLine(line []byte, rules []Rule) ([]byte, bool) {
+	if len(line) == 0 {
+		return nil, false
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(line, &v); err != nil {
+		return nil, false
+	}
+
+	scrubJSONValue(&v, rules)
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func scrubJSONValue(v *interface{}, rules []Rule) {
+	switch val := (*v).(type) {
+	case string:
+		*v = string(applyRules([]byte(val), rules))
+	case map[string]interface{}:
+		for k, e := range val {
+			scrubJSONValue(&e, rules)
+			val[k] = e
+		}
+	case []interface{}:
+		for i, e := range val {
+			scrubJSONValue(&e, rules)
+			val[i] = e
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package snsclient implements publisher.BatchSender on top of an SNS
+// topic, so broker lifecycle and match events can fan out over whatever
+// subscribes to that topic (SQS, HTTPS, or Lambda), the same amortize-
+// the-AWS-call role sqsclient.AWSQueue's batched deletes play for cleanup.
+package snsclient
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/publisher"
+	sqscreds "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqscreds/lib"
+)
+
+// maxBatchEntries is the number of entries SNS allows per PublishBatch call.
+const maxBatchEntries = 10
+
+// Publisher implements publisher.BatchSender against an SNS topic.
+type Publisher struct {
+	Client   SNSClient
+	TopicArn string
+}
+
+// NewPublisher builds a Publisher that sends to topicArn, authenticating
+// with the base64-encoded sqscreds.AwsCreds in credsStr.
+func NewPublisher(topicArn, credsStr, region string) (*Publisher, error) {
+	creds, err := sqscreds.AwsCredsFromBase64(credsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(creds.AwsAccessKeyId, creds.AwsSecretKey, creds.SessionToken),
+		),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Publisher{Client: sns.NewFromConfig(cfg), TopicArn: topicArn}, nil
+}
+
+// PublishBatch sends events to the topic in PublishBatch calls of at most
+// maxBatchEntries entries each, the limit SNS enforces per call.
+func (p *Publisher) PublishBatch(ctx context.Context, events []publisher.Event) error {
+	for start := 0; start < len(events); start += maxBatchEntries {
+		end := start + maxBatchEntries
+		if end > len(events) {
+			end = len(events)
+		}
+
+		entries := make([]types.PublishBatchRequestEntry, 0, end-start)
+		for i, event := range events[start:end] {
+			body, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, types.PublishBatchRequestEntry{
+				Id:      aws.String(strconv.Itoa(start + i)),
+				Message: aws.String(string(body)),
+				Subject: aws.String(event.Type),
+			})
+		}
+
+		if _, err := p.Client.PublishBatch(ctx, &sns.PublishBatchInput{
+			TopicArn:                   aws.String(p.TopicArn),
+			PublishBatchRequestEntries: entries,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+package snsclient
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+type SNSClient interface {
+	PublishBatch(ctx context.Context, input *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
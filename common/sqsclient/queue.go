@@ -0,0 +1,190 @@
+package sqsclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// QueueMessage is one proxy answer retrieved by RendezvousQueue.Receive,
+// backend-agnostic so callers don't need to know whether it came from SQS,
+// NATS, Redis Streams, or anything else implementing RendezvousQueue.
+type QueueMessage struct {
+	// ID identifies this message to a later Delete call. Its meaning is
+	// backend-specific (an SQS receipt handle, a Redis stream entry ID,
+	// ...); callers should treat it as opaque.
+	ID         string
+	Body       []byte
+	Attributes map[string]string
+}
+
+// RendezvousQueue is the "send request, poll per-client response channel"
+// operation a queue-backed RendezvousMethod needs from its message broker,
+// independent of which backend provides it. Send publishes an encoded
+// client poll request tagged with clientID to the shared request channel;
+// Receive polls the response channel scoped to that same clientID for the
+// proxies' encoded answers; Delete removes messages that were polled but
+// not used, so they aren't redelivered.
+type RendezvousQueue interface {
+	Send(ctx context.Context, clientID string, body []byte, attributes map[string]string) error
+	Receive(ctx context.Context, clientID string, maxMessages int, timeout time.Duration) ([]QueueMessage, error)
+	Delete(ctx context.Context, clientID string, ids []string) error
+}
+
+// AWSQueue implements RendezvousQueue against an AWS SQS queue, or any
+// SQS-compatible endpoint such as LocalStack. Requests go to the shared
+// queue at QueueURL; responses are polled from the per-client queue named
+// "snowflake-client-<clientID>", the same naming the broker uses to address
+// proxy answers back to a specific client.
+type AWSQueue struct {
+	Client   SQSClient
+	QueueURL string
+
+	// ResponseQueueRetries bounds how many times Receive retries looking up
+	// the per-client response queue, in case the broker hasn't finished
+	// creating it yet, and how many empty polls it tolerates once found.
+	// Defaults to 5 if <= 0.
+	ResponseQueueRetries int
+	// RetryDelay is the base delay between those retries. Defaults to one
+	// second if <= 0.
+	RetryDelay time.Duration
+
+	mu                sync.Mutex
+	responseQueueURLs map[string]*string
+}
+
+func (q *AWSQueue) retries() int {
+	if q.ResponseQueueRetries <= 0 {
+		return 5
+	}
+	return q.ResponseQueueRetries
+}
+
+func (q *AWSQueue) retryDelay() time.Duration {
+	if q.RetryDelay <= 0 {
+		return time.Second
+	}
+	return q.RetryDelay
+}
+
+func (q *AWSQueue) Send(ctx context.Context, clientID string, body []byte, attributes map[string]string) error {
+	attrs := make(map[string]types.MessageAttributeValue, len(attributes)+1)
+	attrs["ClientID"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(clientID)}
+	for k, v := range attributes {
+		attrs[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	_, err := q.Client.SendMessage(ctx, &sqs.SendMessageInput{
+		MessageAttributes: attrs,
+		MessageBody:       aws.String(string(body)),
+		QueueUrl:          aws.String(q.QueueURL),
+	})
+	return err
+}
+
+func (q *AWSQueue) Receive(ctx context.Context, clientID string, maxMessages int, timeout time.Duration) ([]QueueMessage, error) {
+	responseQueueURL, err := q.resolveResponseQueue(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool []QueueMessage
+	deadline := time.Now().Add(timeout)
+	for i := 0; i < q.retries() && len(pool) < maxMessages && time.Now().Before(deadline); i++ {
+		res, err := q.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              responseQueueURL,
+			MaxNumberOfMessages:   int32(maxMessages - len(pool)),
+			WaitTimeSeconds:       20,
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Messages) == 0 {
+			delay := float64(i)/2.0 + 1
+			time.Sleep(time.Duration(delay * float64(q.retryDelay())))
+			continue
+		}
+		for _, msg := range res.Messages {
+			qm := QueueMessage{Attributes: map[string]string{}}
+			if msg.ReceiptHandle != nil {
+				qm.ID = *msg.ReceiptHandle
+			}
+			if msg.Body != nil {
+				qm.Body = []byte(*msg.Body)
+			}
+			for name, attr := range msg.MessageAttributes {
+				if attr.StringValue != nil {
+					qm.Attributes[name] = *attr.StringValue
+				}
+			}
+			pool = append(pool, qm)
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("no answer received from response queue for client %s", clientID)
+	}
+	return pool, nil
+}
+
+func (q *AWSQueue) Delete(ctx context.Context, clientID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	queueURL := q.responseQueueURLs[clientID]
+	q.mu.Unlock()
+	if queueURL == nil {
+		var err error
+		queueURL, err = q.resolveResponseQueue(ctx, clientID)
+		if err != nil {
+			return err
+		}
+	}
+	entries := make([]types.DeleteMessageBatchRequestEntry, 0, len(ids))
+	for i, id := range ids {
+		entries = append(entries, types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(fmt.Sprint(i)),
+			ReceiptHandle: aws.String(id),
+		})
+	}
+	_, err := q.Client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: queueURL,
+		Entries:  entries,
+	})
+	return err
+}
+
+// resolveResponseQueue looks up, and caches, the queue URL for a client's
+// response queue, retrying while the broker may still be creating it.
+func (q *AWSQueue) resolveResponseQueue(ctx context.Context, clientID string) (*string, error) {
+	q.mu.Lock()
+	if url, ok := q.responseQueueURLs[clientID]; ok {
+		q.mu.Unlock()
+		return url, nil
+	}
+	q.mu.Unlock()
+
+	var lastErr error
+	for i := 0; i < q.retries(); i++ {
+		res, err := q.Client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+			QueueName: aws.String("snowflake-client-" + clientID),
+		})
+		if err == nil {
+			q.mu.Lock()
+			if q.responseQueueURLs == nil {
+				q.responseQueueURLs = map[string]*string{}
+			}
+			q.responseQueueURLs[clientID] = res.QueueUrl
+			q.mu.Unlock()
+			return res.QueueUrl, nil
+		}
+		lastErr = err
+		time.Sleep(q.retryDelay())
+	}
+	return nil, fmt.Errorf("could not find response queue for client %s: %w", clientID, lastErr)
+}
@@ -1,36 +1,114 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	sqscreds "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/sqscreds/lib"
 )
 
-// This script can be run to generate the encoded SQS credentials to pass as a CLI param or SOCKS option to the client
+// This script can be run to generate the encoded SQS credentials to pass as
+// a CLI param or SOCKS option to the client. By default it resolves
+// whatever the AWS SDK's standard credential-provider chain finds --
+// environment variables, the shared config/credentials file (see
+// -profile), or an IAM instance/task role via IMDSv2 -- so a deployment
+// that already federates into AWS doesn't need to mint a permanent IAM user
+// just to run the SQS rendezvous. -role-arn additionally assumes a role on
+// top of that chain, and -get-session-token calls sts:GetSessionToken
+// directly for a caller that wants a temporary version of its own
+// long-lived user's permissions (optionally behind MFA via -mfa-serial).
 func main() {
-	var accessKey, secretKey string
+	profile := flag.String("profile", "", "shared config/credentials file profile to resolve credentials from (default: the AWS SDK's own default profile resolution)")
+	roleArn := flag.String("role-arn", "", "ARN of an IAM role to assume on top of the resolved credential chain, via sts:AssumeRole")
+	roleSessionName := flag.String("role-session-name", "snowflake-sqscreds", "session name to use when assuming -role-arn")
+	getSessionToken := flag.Bool("get-session-token", false, "call sts:GetSessionToken instead of using the resolved credentials directly, for a long-lived IAM user that wants to hand out a temporary credential set")
+	mfaSerial := flag.String("mfa-serial", "", "ARN or serial number of an MFA device to present to sts:GetSessionToken (requires -get-session-token)")
+	mfaToken := flag.String("mfa-token", "", "current code from the -mfa-serial device (requires -mfa-serial)")
+	duration := flag.Duration("duration", time.Hour, "how long the credentials returned by -role-arn or -get-session-token should remain valid")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	var cfgOpts []func(*config.LoadOptions) error
+	if *profile != "" {
+		cfgOpts = append(cfgOpts, config.WithSharedConfigProfile(*profile))
+	}
 
-	fmt.Print("Enter Access Key: ")
-	_, err := fmt.Scanln(&accessKey)
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
 	if err != nil {
-		fmt.Println("Error reading access key:", err)
+		fmt.Println("Error loading AWS credential chain:", err)
 		return
 	}
 
-	fmt.Print("Enter Secret Key: ")
-	_, err = fmt.Scanln(&secretKey)
+	switch {
+	case *roleArn != "":
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), *roleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = *roleSessionName
+			o.Duration = *duration
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	case *getSessionToken:
+		stsClient := sts.NewFromConfig(cfg)
+		input := &sts.GetSessionTokenInput{
+			DurationSeconds: aws.Int32(int32(duration.Seconds())),
+		}
+		if *mfaSerial != "" {
+			input.SerialNumber = aws.String(*mfaSerial)
+			input.TokenCode = aws.String(*mfaToken)
+		}
+
+		out, err := stsClient.GetSessionToken(ctx, input)
+		if err != nil {
+			fmt.Println("Error calling sts:GetSessionToken:", err)
+			return
+		}
+		cfg.Credentials = credentialsFromSessionToken(out)
+	}
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
 	if err != nil {
-		fmt.Println("Error reading access key:", err)
+		fmt.Println("Error resolving AWS credentials:", err)
 		return
 	}
 
-	awsCreds := sqscreds.AwsCreds{AwsAccessKeyId: accessKey, AwsSecretKey: secretKey}
-	println()
-	println("Encoded Credentials:")
+	awsCreds := sqscreds.AwsCreds{
+		AwsAccessKeyId: creds.AccessKeyID,
+		AwsSecretKey:   creds.SecretAccessKey,
+		SessionToken:   creds.SessionToken,
+	}
+	if creds.CanExpire {
+		expiration := creds.Expires
+		awsCreds.Expiration = &expiration
+	}
+
+	fmt.Println()
+	fmt.Println("Encoded Credentials:")
 	res, err := awsCreds.Base64()
 	if err != nil {
 		fmt.Println("Error encoding credentials:", err)
 		return
 	}
-	println(res)
+	fmt.Println(res)
+}
+
+// credentialsFromSessionToken wraps the static credentials sts:GetSessionToken
+// returned in a CredentialsProvider, the shape cfg.Credentials.Retrieve expects.
+func credentialsFromSessionToken(out *sts.GetSessionTokenOutput) aws.CredentialsProvider {
+	return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{
+			AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(out.Credentials.SessionToken),
+			CanExpire:       true,
+			Expires:         aws.ToTime(out.Credentials.Expiration),
+		}, nil
+	})
 }
@@ -3,11 +3,27 @@ package sqscreds
 import (
 	"encoding/base64"
 	"encoding/json"
+	"time"
 )
 
+// AwsCreds is the base64-encoded blob a caller passes to the SQS/SNS/S3
+// rendezvous methods in place of a long-lived IAM user's access/secret pair.
+// SessionToken and Expiration are only set when the credentials came from a
+// temporary source (an assumed role, IMDSv2 instance role, or
+// sts:GetSessionToken, see generate_creds.go); a caller authenticating with
+// a permanent IAM user leaves both zero.
 type AwsCreds struct {
 	AwsAccessKeyId string `json:"aws-access-key-id"`
 	AwsSecretKey   string `json:"aws-secret-key"`
+	// SessionToken, if non-empty, is presented alongside AwsAccessKeyId and
+	// AwsSecretKey to authenticate a temporary credential set.
+	SessionToken string `json:"aws-session-token,omitempty"`
+	// Expiration is when SessionToken (and the secret key paired with it)
+	// stops being valid, if known. It's informational only -- the decoding
+	// client doesn't refresh or reject an expired blob itself, since doing
+	// so requires re-running generate_creds against whatever credential
+	// source issued it in the first place.
+	Expiration *time.Time `json:"expiration,omitempty"`
 }
 
 func (awsCreds AwsCreds) Base64() (string, error) {
@@ -0,0 +1,375 @@
+/*
+Package turbotunnel provides net.PacketConn plumbing for Turbo Tunnel:
+session-oriented protocols like KCP need a net.PacketConn to run over, but
+what we actually have is a changing collection of WebSocket streams, each
+carrying packets for possibly many different client sessions. QueuePacketConn
+bridges the two: ReadFrom/WriteTo on one side look like an ordinary
+net.PacketConn to the KCP layer, while QueueIncoming/OutgoingQueue on the
+other side let the WebSocket handling code feed in and drain per-client
+datagrams.
+*/
+package turbotunnel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ClientID is an opaque identifier, attached to every packet belonging to a
+// given client session, that lets QueuePacketConn address datagrams to a
+// particular client across however many WebSocket connections that
+// client's session happens to use over its lifetime.
+type ClientID [8]byte
+
+// NewClientID returns a random ClientID.
+func NewClientID() ClientID {
+	var id ClientID
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// Network implements the net.Addr interface, so a ClientID can be passed
+// anywhere a net.Addr is expected (notably as the addr argument of
+// QueuePacketConn's ReadFrom/WriteTo/QueueIncoming).
+func (id ClientID) Network() string { return "clientid" }
+
+func (id ClientID) String() string { return hex.EncodeToString(id[:]) }
+
+// Token is the fixed byte sequence a client sends at the start of a
+// WebSocket stream to announce that the rest of the stream is turbotunnel
+// traffic (encapsulated, ClientID-addressed packets), rather than the
+// legacy one-shot mode.
+var Token = [8]byte{0x7c, 0x30, 0x31, 0xd1, 0xdb, 0x0c, 0x39, 0x67}
+
+// defaultMTU bounds the size of the scratch buffers QueuePacketConn pools,
+// used when NewQueuePacketConn is called with mtu <= 0.
+const defaultMTU = 1280
+
+// defaultRingCapacity is the default capacity of the incoming-datagram
+// ring, rounded up to a power of two by newRing.
+const defaultRingCapacity = 256
+
+// outgoingQueueCapacity bounds the number of not-yet-sent packets kept per
+// client in the outgoing direction. When full, the oldest queued packet is
+// dropped to make room, the same backpressure behavior an unbounded queue
+// with a timeout would eventually have anyway.
+const outgoingQueueCapacity = 64
+
+// errClosedPacketConn is returned by QueuePacketConn's I/O methods after
+// Close.
+var errClosedPacketConn = errors.New("read/write on closed QueuePacketConn")
+
+// errNotImplemented is returned by the deadline methods, which
+// QueuePacketConn does not support.
+var errNotImplemented = errors.New("not implemented")
+
+// packet is a datagram paired with the address it arrived from, plus the
+// pool handle (see QueuePacketConn.getBuffer) that owns buf's storage, so
+// a consumer can return it to the pool once it's done reading buf.
+type packet struct {
+	buf  []byte
+	bufp *[]byte
+	addr net.Addr
+}
+
+// QueuePacketConn implements the net.PacketConn interface over queues of
+// packets, rather than over an actual network socket. On the ReadFrom/
+// WriteTo side, it looks like a conn that can send and receive packets
+// addressed by ClientID. On the QueueIncoming/OutgoingQueue side, it's fed
+// datagrams by, and hands datagrams to, whatever is actually terminating
+// the transport (e.g. the WebSocket handler in server/lib/http.go).
+//
+// The incoming path (QueueIncoming → ReadFrom) and the per-client scratch
+// buffers on both paths are backed by a sync.Pool of MTU-sized buffers, so
+// steady-state traffic doesn't allocate a new slice per packet. The
+// incoming path additionally uses a lock-free ring buffer instead of an
+// unbounded channel, bounding memory use under sustained load.
+type QueuePacketConn struct {
+	localAddr net.Addr
+	timeout   time.Duration
+	mtu       int
+
+	bufferPool *sync.Pool
+
+	incoming *ring
+	// notify is signaled (non-blocking) whenever a packet is pushed onto
+	// incoming, to wake a ReadFrom that's blocked on an empty ring.
+	notify chan struct{}
+
+	sendQueuesLock      sync.Mutex
+	sendQueues          map[net.Addr]chan *[]byte
+	sendQueueTimestamps map[net.Addr]time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewQueuePacketConn creates a QueuePacketConn addressed as localAddr,
+// which purges idle per-client outgoing queues after timeout, and which
+// pools scratch buffers sized to mtu bytes (defaultMTU if mtu <= 0).
+func NewQueuePacketConn(localAddr net.Addr, timeout time.Duration, mtu int) *QueuePacketConn {
+	if mtu <= 0 {
+		mtu = defaultMTU
+	}
+
+	c := &QueuePacketConn{
+		localAddr:           localAddr,
+		timeout:             timeout,
+		mtu:                 mtu,
+		incoming:            newRing(defaultRingCapacity),
+		notify:              make(chan struct{}, 1),
+		sendQueues:          make(map[net.Addr]chan *[]byte),
+		sendQueueTimestamps: make(map[net.Addr]time.Time),
+		closed:              make(chan struct{}),
+	}
+	c.bufferPool = c.newDefaultBufferPool()
+
+	go c.purgeLoop()
+
+	return c
+}
+
+// newDefaultBufferPool returns a pool of mtu-sized byte slices (putBuffer
+// trims each to zero length on return), handed out as *[]byte so that Put doesn't have to box a
+// slice header (a value type) into an interface, which would otherwise
+// allocate on every Put.
+func (c *QueuePacketConn) newDefaultBufferPool() *sync.Pool {
+	mtu := c.mtu
+	return &sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, mtu)
+			return &buf
+		},
+	}
+}
+
+// SetBufferPool overrides the pool of MTU-sized scratch buffers used by
+// QueueIncoming, WriteTo and ReadFrom. Passing nil restores the default
+// pool sized to the mtu given to NewQueuePacketConn. Not safe to call
+// concurrently with the conn's I/O methods; call it during setup, before
+// any packets are exchanged.
+func (c *QueuePacketConn) SetBufferPool(pool *sync.Pool) {
+	if pool == nil {
+		pool = c.newDefaultBufferPool()
+	}
+	c.bufferPool = pool
+}
+
+// SetRingCapacity replaces the incoming-datagram ring with a new, empty
+// one sized to hold at least capacity packets (rounded up to the next
+// power of two). Anything already queued in the old ring is dropped, and
+// its buffers are returned to the buffer pool. Not safe to call
+// concurrently with QueueIncoming/ReadFrom; call it during setup.
+func (c *QueuePacketConn) SetRingCapacity(capacity int) {
+	old := c.incoming
+	c.incoming = newRing(capacity)
+	for {
+		pkt, ok := old.pop()
+		if !ok {
+			break
+		}
+		c.putBuffer(pkt.bufp)
+	}
+}
+
+// getBuffer returns an mtu-capacity buffer from the pool, sliced to its
+// full capacity, along with the pool handle that owns its storage (to be
+// passed back to putBuffer later).
+func (c *QueuePacketConn) getBuffer() (buf []byte, bufp *[]byte) {
+	bufp = c.bufferPool.Get().(*[]byte)
+	return (*bufp)[:cap(*bufp)], bufp
+}
+
+// putBuffer returns the buffer owned by bufp to the pool for reuse.
+func (c *QueuePacketConn) putBuffer(bufp *[]byte) {
+	if bufp == nil {
+		return
+	}
+	*bufp = (*bufp)[:0:cap(*bufp)]
+	c.bufferPool.Put(bufp)
+}
+
+// QueueIncoming feeds p, addressed from addr, into the conn's incoming
+// ring, to be returned by a subsequent ReadFrom. p is copied into a
+// pooled buffer, so the caller retains ownership of p itself. If the
+// incoming ring is full (the consumer isn't keeping up), the packet is
+// dropped.
+func (c *QueuePacketConn) QueueIncoming(p []byte, addr net.Addr) {
+	buf, bufp := c.getBuffer()
+	n := copy(buf, p)
+	buf = buf[:n]
+
+	if !c.incoming.push(packet{buf: buf, bufp: bufp, addr: addr}) {
+		c.putBuffer(bufp)
+		return
+	}
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// ReadFrom implements the net.PacketConn interface.
+func (c *QueuePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		if pkt, ok := c.incoming.pop(); ok {
+			n := copy(p, pkt.buf)
+			c.putBuffer(pkt.bufp)
+			return n, pkt.addr, nil
+		}
+		select {
+		case <-c.notify:
+		case <-c.closed:
+			return 0, nil, errClosedPacketConn
+		}
+	}
+}
+
+// send enqueues bufp onto addr's outgoing queue, creating the queue if
+// this is the first packet seen for addr, and dropping the oldest queued
+// packet to make room if the queue is full.
+func (c *QueuePacketConn) send(bufp *[]byte, addr net.Addr) {
+	c.sendQueuesLock.Lock()
+	defer c.sendQueuesLock.Unlock()
+
+	q, ok := c.sendQueues[addr]
+	if !ok {
+		q = make(chan *[]byte, outgoingQueueCapacity)
+		c.sendQueues[addr] = q
+	}
+	c.sendQueueTimestamps[addr] = time.Now()
+
+	select {
+	case q <- bufp:
+	default:
+		select {
+		case old := <-q:
+			c.putBuffer(old)
+		default:
+		}
+		select {
+		case q <- bufp:
+		default:
+			// Lost a race with another sender; drop bufp rather than block.
+			c.putBuffer(bufp)
+		}
+	}
+}
+
+// WriteTo implements the net.PacketConn interface.
+func (c *QueuePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	buf, bufp := c.getBuffer()
+	n := copy(buf, p)
+	*bufp = buf[:n]
+
+	c.send(bufp, addr)
+
+	return len(p), nil
+}
+
+// OutgoingQueue returns the channel of outgoing packets addressed to addr,
+// creating it if necessary. The returned channel is never closed, neither
+// by Close nor when purgeLoop discards the queue. Each received *[]byte
+// must eventually be passed to Restore.
+func (c *QueuePacketConn) OutgoingQueue(addr net.Addr) <-chan *[]byte {
+	c.sendQueuesLock.Lock()
+	defer c.sendQueuesLock.Unlock()
+
+	q, ok := c.sendQueues[addr]
+	if !ok {
+		q = make(chan *[]byte, outgoingQueueCapacity)
+		c.sendQueues[addr] = q
+		c.sendQueueTimestamps[addr] = time.Now()
+	}
+	return q
+}
+
+// Restore returns a buffer previously handed out by WriteTo or received
+// from an OutgoingQueue channel back to the buffer pool, once the caller
+// is done with it (e.g. after writing it out to a WebSocket connection).
+func (c *QueuePacketConn) Restore(bufp *[]byte) {
+	c.putBuffer(bufp)
+}
+
+// purgeLoop periodically discards outgoing queues that have seen no
+// traffic in c.timeout, so a client that has gone away doesn't keep its
+// queue in sendQueues forever. A discarded queue is dropped from the map
+// without being closed, so a goroutine still receiving from it is not woken.
+func (c *QueuePacketConn) purgeLoop() {
+	if c.timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.timeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.purgeStaleQueues()
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *QueuePacketConn) purgeStaleQueues() {
+	c.sendQueuesLock.Lock()
+	defer c.sendQueuesLock.Unlock()
+
+	now := time.Now()
+	for addr, ts := range c.sendQueueTimestamps {
+		if now.Sub(ts) >= c.timeout {
+			delete(c.sendQueues, addr)
+			delete(c.sendQueueTimestamps, addr)
+		}
+	}
+}
+
+// QueueDepth returns the number of packets currently queued in the
+// incoming ring, waiting to be consumed by ReadFrom. It's a gauge meant
+// for reporting load (e.g. to a Balancer or a Prometheus collector), not
+// a precise count.
+func (c *QueuePacketConn) QueueDepth() int {
+	return c.incoming.Len()
+}
+
+// SessionCount returns the number of distinct addresses (ClientIDs, in
+// the server's usage) that currently have an outgoing queue, i.e. have
+// been seen at least once by WriteTo or OutgoingQueue and not yet
+// purged by purgeLoop. It's used as a proxy for the number of active
+// sessions a pconn is carrying.
+func (c *QueuePacketConn) SessionCount() int {
+	c.sendQueuesLock.Lock()
+	defer c.sendQueuesLock.Unlock()
+	return len(c.sendQueues)
+}
+
+// LocalAddr implements the net.PacketConn interface.
+func (c *QueuePacketConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// Close implements the net.PacketConn interface.
+func (c *QueuePacketConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// SetDeadline implements the net.PacketConn interface, but deadlines are
+// not supported by QueuePacketConn.
+func (c *QueuePacketConn) SetDeadline(t time.Time) error { return errNotImplemented }
+
+// SetReadDeadline implements the net.PacketConn interface, but deadlines
+// are not supported by QueuePacketConn.
+func (c *QueuePacketConn) SetReadDeadline(t time.Time) error { return errNotImplemented }
+
+// SetWriteDeadline implements the net.PacketConn interface, but deadlines
+// are not supported by QueuePacketConn.
+func (c *QueuePacketConn) SetWriteDeadline(t time.Time) error { return errNotImplemented }
@@ -0,0 +1,117 @@
+package turbotunnel
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ring is a fixed-capacity, lock-free ring buffer of packets, implemented
+// as a Vyukov-style bounded queue: a slot array with a per-slot sequence
+// number, and atomic head/tail cursors that producers and consumers advance
+// with a compare-and-swap loop, retrying with runtime.Gosched() on
+// contention instead of blocking on a mutex. Capacity is rounded up to a
+// power of two so index wraparound is a bitmask instead of a modulo.
+//
+// QueuePacketConn uses a ring as its incoming-datagram queue: push is
+// called from the (single) goroutine that demultiplexes arriving
+// datagrams, and pop is called from however many goroutines are reading
+// from the conn. The algorithm itself tolerates multiple concurrent
+// pushers too, which is what lets it double as an ordinary lock-free
+// bounded queue rather than requiring single-writer discipline elsewhere
+// in this package.
+type ring struct {
+	mask  uint64
+	slots []ringSlot
+	head  atomic.Uint64
+	tail  atomic.Uint64
+}
+
+type ringSlot struct {
+	seq atomic.Uint64
+	pkt packet
+}
+
+// newRing returns an empty ring sized to hold at least capacity packets.
+func newRing(capacity int) *ring {
+	capacity = nextPowerOfTwo(capacity)
+	r := &ring{
+		mask:  uint64(capacity - 1),
+		slots: make([]ringSlot, capacity),
+	}
+	for i := range r.slots {
+		r.slots[i].seq.Store(uint64(i))
+	}
+	return r
+}
+
+// push enqueues pkt, reporting false instead of blocking if the ring is
+// currently full.
+func (r *ring) push(pkt packet) bool {
+	for {
+		head := r.head.Load()
+		slot := &r.slots[head&r.mask]
+		seq := slot.seq.Load()
+		switch diff := int64(seq) - int64(head); {
+		case diff == 0:
+			if r.head.CompareAndSwap(head, head+1) {
+				slot.pkt = pkt
+				slot.seq.Store(head + 1)
+				return true
+			}
+		case diff < 0:
+			return false // full
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// pop dequeues the oldest packet, reporting false instead of blocking if
+// the ring is currently empty.
+func (r *ring) pop() (packet, bool) {
+	for {
+		tail := r.tail.Load()
+		slot := &r.slots[tail&r.mask]
+		seq := slot.seq.Load()
+		switch diff := int64(seq) - int64(tail+1); {
+		case diff == 0:
+			if r.tail.CompareAndSwap(tail, tail+1) {
+				pkt := slot.pkt
+				slot.pkt = packet{}
+				slot.seq.Store(tail + r.mask + 1)
+				return pkt, true
+			}
+		case diff < 0:
+			return packet{}, false // empty
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// Len returns the number of packets currently queued in the ring. It's
+// a snapshot, racing with concurrent push/pop the same way len() on a
+// channel would; meant for reporting (e.g. a Prometheus gauge), not for
+// flow control.
+func (r *ring) Len() int {
+	head := r.head.Load()
+	tail := r.tail.Load()
+	if head < tail {
+		return 0
+	}
+	return int(head - tail)
+}
+
+// nextPowerOfTwo rounds n up to the next power of two, with a floor of 2 so
+// a ring always has room for at least one in-flight push and one in-flight
+// pop.
+func nextPowerOfTwo(n int) int {
+	if n < 2 {
+		return 2
+	}
+	p := 2
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
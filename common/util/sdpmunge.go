@@ -0,0 +1,136 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/pion/sdp/v3"
+)
+
+// ChangeSetupRole rewrites every a=setup: attribute in sdpStr to "actpass"
+// (if actpass is true) or "active" (otherwise). Some DTLS/SCTP endpoints
+// behave differently depending on which side is offered as actpass vs.
+// active, which is occasionally useful for interop, and the fixed
+// "a=setup:actpass" Snowflake normally offers is also one of the more
+// obvious fingerprints DPI classifiers pattern-match on. Returns sdpStr
+// unchanged if it fails to parse.
+func ChangeSetupRole(sdpStr string, actpass bool) string {
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(sdpStr)); err != nil {
+		return sdpStr
+	}
+
+	role := "active"
+	if actpass {
+		role = "actpass"
+	}
+
+	for _, m := range desc.MediaDescriptions {
+		for i, a := range m.Attributes {
+			if a.Key == "setup" {
+				m.Attributes[i] = sdp.Attribute{Key: "setup", Value: role}
+			}
+		}
+	}
+
+	bts, err := desc.Marshal()
+	if err != nil {
+		return sdpStr
+	}
+	return string(bts)
+}
+
+// ForceDataChannelOnly drops every m=audio and m=video media section from
+// sdpStr, keeping only m=application (the SCTP/DataChannel section
+// Snowflake actually uses). Returns sdpStr unchanged if it fails to parse.
+func ForceDataChannelOnly(sdpStr string) string {
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(sdpStr)); err != nil {
+		return sdpStr
+	}
+
+	kept := make([]*sdp.MediaDescription, 0, len(desc.MediaDescriptions))
+	for _, m := range desc.MediaDescriptions {
+		if m.MediaName.Media == "application" {
+			kept = append(kept, m)
+		}
+	}
+	desc.MediaDescriptions = kept
+
+	bts, err := desc.Marshal()
+	if err != nil {
+		return sdpStr
+	}
+	return string(bts)
+}
+
+// RestrictICEToUDP drops TCP host/srflx/relay ICE candidates from sdpStr,
+// keeping only UDP candidates. Returns sdpStr unchanged if it fails to
+// parse.
+func RestrictICEToUDP(sdpStr string) string {
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(sdpStr)); err != nil {
+		return sdpStr
+	}
+
+	for _, m := range desc.MediaDescriptions {
+		attrs := make([]sdp.Attribute, 0, len(m.Attributes))
+		for _, a := range m.Attributes {
+			if a.IsICECandidate() && isTCPCandidate(a.Value) {
+				continue
+			}
+			attrs = append(attrs, a)
+		}
+		m.Attributes = attrs
+	}
+
+	bts, err := desc.Marshal()
+	if err != nil {
+		return sdpStr
+	}
+	return string(bts)
+}
+
+// isTCPCandidate reports whether a raw a=candidate attribute value's
+// transport field (the third token, per RFC 8445 section 5.1) is "tcp".
+func isTCPCandidate(candidateValue string) bool {
+	fields := strings.Fields(candidateValue)
+	if len(fields) < 3 {
+		return false
+	}
+	return strings.EqualFold(fields[2], "tcp")
+}
+
+// RewriteFingerprintAlgo rewrites the hash function name in every
+// a=fingerprint: attribute of sdpStr to algo (e.g. "sha-1", "sha-512"),
+// leaving the fingerprint value itself untouched. Returns sdpStr unchanged
+// if it fails to parse.
+func RewriteFingerprintAlgo(sdpStr string, algo string) string {
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(sdpStr)); err != nil {
+		return sdpStr
+	}
+
+	rewrite := func(attrs []sdp.Attribute) {
+		for i, a := range attrs {
+			if a.Key != "fingerprint" {
+				continue
+			}
+			fields := strings.SplitN(a.Value, " ", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			attrs[i] = sdp.Attribute{Key: "fingerprint", Value: algo + " " + fields[1]}
+		}
+	}
+
+	rewrite(desc.Attributes)
+	for _, m := range desc.MediaDescriptions {
+		rewrite(m.Attributes)
+	}
+
+	bts, err := desc.Marshal()
+	if err != nil {
+		return sdpStr
+	}
+	return string(bts)
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"slices"
 	"sort"
+	"strings"
 
 	"github.com/pion/ice/v4"
 	"github.com/pion/sdp/v3"
@@ -69,10 +70,15 @@ func IsLocal(ip net.IP) bool {
 			(ip4[0] == 169 && ip4[1] == 254)
 	}
 	// Local IPv6 addresses are defined in https://tools.ietf.org/html/rfc4193
-	return len(ip) == net.IPv6len && ip[0]&0xfe == 0xfc
+	// (unique local) and https://tools.ietf.org/html/rfc4291 (link-local)
+	return len(ip) == net.IPv6len &&
+		(ip[0]&0xfe == 0xfc || (ip[0] == 0xfe && ip[1]&0xc0 == 0x80))
 }
 
-// Removes local LAN address ICE candidates
+// Removes local LAN address ICE candidates, mDNS hostname candidates (which
+// Chrome/Firefox emit by default instead of a host's real address), and the
+// RelatedAddress of srflx/prflx candidates when it reveals a local network,
+// matching what browsers do themselves when asked to hide local topology.
 func StripLocalAddresses(str string) string {
 	var desc sdp.SessionDescription
 	err := desc.Unmarshal([]byte(str))
@@ -84,11 +90,22 @@ func StripLocalAddresses(str string) string {
 		for _, a := range m.Attributes {
 			if a.IsICECandidate() {
 				c, err := ice.UnmarshalCandidate(a.Value)
-				if err == nil && c.Type() == ice.CandidateTypeHost {
-					ip := net.ParseIP(c.Address())
-					if ip != nil && (IsLocal(ip) || ip.IsUnspecified() || ip.IsLoopback()) {
-						/* no append in this case */
-						continue
+				if err == nil {
+					if c.Type() == ice.CandidateTypeHost {
+						addr := c.Address()
+						ip := net.ParseIP(addr)
+						if ip == nil || strings.HasSuffix(addr, ".local") ||
+							IsLocal(ip) || ip.IsUnspecified() || ip.IsLoopback() {
+							/* no append in this case */
+							continue
+						}
+					}
+					if c.Type() == ice.CandidateTypeServerReflexive || c.Type() == ice.CandidateTypePeerReflexive {
+						if raddr, ok := candidateRelatedAddress(a.Value); ok {
+							if ip := net.ParseIP(raddr); ip == nil || IsLocal(ip) || ip.IsUnspecified() || ip.IsLoopback() {
+								a.Value = scrubRelatedAddress(a.Value)
+							}
+						}
 					}
 				}
 			}
@@ -103,6 +120,61 @@ func StripLocalAddresses(str string) string {
 	return string(bts)
 }
 
+// candidateRelatedAddress extracts the "raddr" token's value out of a raw
+// a=candidate attribute value, as found on srflx/prflx candidates.
+func candidateRelatedAddress(candidateValue string) (addr string, found bool) {
+	fields := strings.Fields(candidateValue)
+	for i, f := range fields {
+		if f == "raddr" && i+1 < len(fields) {
+			return fields[i+1], true
+		}
+	}
+	return "", false
+}
+
+// scrubRelatedAddress rewrites the raddr/rport tokens of a raw a=candidate
+// attribute value to 0.0.0.0/9, the same placeholder browsers use when
+// hiding a candidate's internal network from its public mapping.
+func scrubRelatedAddress(candidateValue string) string {
+	fields := strings.Fields(candidateValue)
+	for i, f := range fields {
+		switch f {
+		case "raddr":
+			if i+1 < len(fields) {
+				fields[i+1] = "0.0.0.0"
+			}
+		case "rport":
+			if i+1 < len(fields) {
+				fields[i+1] = "9"
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// ParseNAT1To1Mappings parses a comma-separated list of 1:1 NAT IP mappings,
+// as given on the command line or in a JSON config, into the ips argument
+// expected by pion's SettingEngine.SetNAT1To1IPs. Each entry is either a bare
+// external IP, applied to every gathered host candidate, or an
+// "internal=external" pair -- pion itself has no notion of a per-interface
+// internal address, so only the external half is kept; the internal half
+// exists purely so operators can document which local interface a mapping
+// corresponds to.
+func ParseNAT1To1Mappings(raw string) []string {
+	var ips []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, external, ok := strings.Cut(entry, "="); ok {
+			entry = external
+		}
+		ips = append(ips, entry)
+	}
+	return ips
+}
+
 // Attempts to retrieve the client IP of where the HTTP request originating.
 // There is no standard way to do this since the original client IP can be included in a number of different headers,
 // depending on the proxies and load balancers between the client and the server. We attempt to check as many of these
@@ -120,13 +192,129 @@ func GetClientIp(req *http.Request) string {
 	return clientIp
 }
 
-// Returns a list of IP addresses of ICE candidates, roughly in descending order for accuracy for geolocation
-func GetCandidateAddrs(sdpStr string) []net.IP {
+// ClientIPResolver derives a request's client IP the way GetClientIp does,
+// except it only believes a Forwarded/X-Forwarded-For hop -- or the
+// optional single-IP header configured as realIPHeader -- when it arrived
+// through a reverse proxy the operator actually trusts. Without this, any
+// client can set its own Forwarded header and forge the address that ends
+// up in the broker's geoip metrics; GetClientIp's "leftmost" strategies are
+// explicitly documented by realclientip as unsuitable for that reason.
+//
+// Use NewClientIPResolver to build one from an operator's configured list
+// of trusted CIDRs.
+type ClientIPResolver struct {
+	trustedRanges []net.IPNet
+	realIPStrat   realclientip.SingleIPHeaderStrategy
+	hasRealIP     bool
+	chain         realclientip.ChainStrategy
+}
+
+// NewClientIPResolver builds a ClientIPResolver that trusts trustedRanges as
+// the direct peers fronting this server (e.g. an operator's nginx/Caddy/
+// Cloudflare hops). If realIPHeader is non-empty, that single-IP header
+// (e.g. "X-Real-IP") is consulted first and takes precedence over the
+// Forwarded/X-Forwarded-For walk described below.
+func NewClientIPResolver(trustedRanges []net.IPNet, realIPHeader string) (*ClientIPResolver, error) {
+	forwarded, err := realclientip.NewRightmostTrustedRangeStrategy("Forwarded", trustedRanges)
+	if err != nil {
+		return nil, err
+	}
+	forwardedFor, err := realclientip.NewRightmostTrustedRangeStrategy("X-Forwarded-For", trustedRanges)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ClientIPResolver{
+		trustedRanges: trustedRanges,
+		chain: realclientip.NewChainStrategy(
+			forwarded,
+			forwardedFor,
+			realclientip.RemoteAddrStrategy{},
+		),
+	}
+
+	if realIPHeader != "" {
+		strat, err := realclientip.NewSingleIPHeaderStrategy(realIPHeader)
+		if err != nil {
+			return nil, err
+		}
+		r.realIPStrat = strat
+		r.hasRealIP = true
+	}
+
+	return r, nil
+}
+
+// ClientIP derives req's client IP. If req.RemoteAddr -- the actual TCP
+// peer, which unlike any header can't be spoofed -- isn't inside one of r's
+// trusted CIDRs, nothing the peer says about earlier hops can be believed
+// either, since it could be the attacker itself forging whatever
+// Forwarded/X-Forwarded-For/X-Real-IP chain it likes; ClientIP then simply
+// returns RemoteAddr. Otherwise, the configured X-Real-IP-style header is
+// consulted first if set, then Forwarded and X-Forwarded-For are each
+// walked from their rightmost (nearest) entry inward, trusting only hops
+// inside trustedRanges and returning the first untrusted address found --
+// the real client, assuming every trusted hop faithfully appended its
+// peer's address.
+func (r *ClientIPResolver) ClientIP(req *http.Request) string {
+	if !r.remoteAddrTrusted(req.RemoteAddr) {
+		return realclientip.RemoteAddrStrategy{}.ClientIP(req.Header, req.RemoteAddr)
+	}
+	if r.hasRealIP {
+		if ip := r.realIPStrat.ClientIP(req.Header, req.RemoteAddr); ip != "" {
+			return ip
+		}
+	}
+	return r.chain.ClientIP(req.Header, req.RemoteAddr)
+}
+
+// remoteAddrTrusted reports whether remoteAddr's host (an http.Request's
+// RemoteAddr, "host:port") falls within one of r's trusted CIDRs.
+func (r *ClientIPResolver) remoteAddrTrusted(remoteAddr string) bool {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range r.trustedRanges {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxyCIDRs parses a comma-separated list of CIDR ranges, as
+// given on the command line, into the trustedRanges argument expected by
+// NewClientIPResolver.
+func ParseTrustedProxyCIDRs(raw string) ([]net.IPNet, error) {
+	var ranges []net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, *ipNet)
+	}
+	return ranges, nil
+}
+
+// collectSortedICECandidates unmarshals sdpStr and returns its ICE candidates
+// sorted in descending order of (ICE candidate type preference, priority),
+// shared by GetCandidateAddrs and GetCandidateAddrsForGeoIP.
+func collectSortedICECandidates(sdpStr string) []ice.Candidate {
 	var desc sdp.SessionDescription
 	err := desc.Unmarshal([]byte(sdpStr))
 	if err != nil {
 		log.Printf("GetCandidateAddrs: failed to unmarshal SDP: %v\n", err)
-		return []net.IP{}
+		return nil
 	}
 
 	iceCandidates := make([]ice.Candidate, 0)
@@ -156,6 +344,13 @@ func GetCandidateAddrs(sdpStr string) []net.IP {
 	})
 	slices.Reverse(iceCandidates)
 
+	return iceCandidates
+}
+
+// Returns a list of IP addresses of ICE candidates, roughly in descending order for accuracy for geolocation
+func GetCandidateAddrs(sdpStr string) []net.IP {
+	iceCandidates := collectSortedICECandidates(sdpStr)
+
 	sortedIpAddr := make([]net.IP, 0)
 	for _, c := range iceCandidates {
 		ip := net.ParseIP(c.Address())
@@ -165,3 +360,132 @@ func GetCandidateAddrs(sdpStr string) []net.IP {
 	}
 	return sortedIpAddr
 }
+
+// GetCandidateAddrsForGeoIP returns the same ICE-priority ordering as
+// GetCandidateAddrs, but within each bucket of candidates that share an
+// equal ICE type and priority, it additionally stable-sorts by an RFC
+// 6724-style destination address selection pass: IPv6 global unicast is
+// preferred over 6to4/Teredo, deprecated site-local, and unique-local
+// addresses, and IPv4-mapped IPv6 addresses are unwrapped to plain IPv4.
+// This gives the broker's MaxMind lookup a more accurate "closest to
+// client" address to try first when several equal-priority srflx/host
+// candidates survive.
+func GetCandidateAddrsForGeoIP(sdpStr string) []net.IP {
+	iceCandidates := collectSortedICECandidates(sdpStr)
+
+	sortedIpAddr := make([]net.IP, 0, len(iceCandidates))
+	bucketStart := 0
+	flushBucket := func(end int) {
+		bucket := iceCandidates[bucketStart:end]
+		sort.SliceStable(bucket, func(i, j int) bool {
+			ipI, ipJ := net.ParseIP(bucket[i].Address()), net.ParseIP(bucket[j].Address())
+			if ipI == nil || ipJ == nil {
+				return false
+			}
+			if pi, pj := rfc6724Precedence(ipI), rfc6724Precedence(ipJ); pi != pj {
+				return pi > pj
+			}
+			return rfc6724Scope(ipI) > rfc6724Scope(ipJ)
+		})
+		for _, c := range bucket {
+			ip := net.ParseIP(c.Address())
+			if ip == nil {
+				continue
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			sortedIpAddr = append(sortedIpAddr, ip)
+		}
+	}
+	for i := 1; i <= len(iceCandidates); i++ {
+		if i == len(iceCandidates) ||
+			iceCandidates[i].Type() != iceCandidates[bucketStart].Type() ||
+			iceCandidates[i].Priority() != iceCandidates[bucketStart].Priority() {
+			flushBucket(i)
+			bucketStart = i
+		}
+	}
+	return sortedIpAddr
+}
+
+// RFC 6724 address scopes, from narrowest to widest. Only the unicast
+// ranges actually reachable from the policy table below are used here;
+// admin-local is kept for documentation parity with the RFC even though no
+// unicast range maps to it.
+const (
+	scopeInterfaceLocal = 1
+	scopeLinkLocal      = 2
+	scopeAdminLocal     = 4
+	scopeSiteLocal      = 5
+	scopeOrgLocal       = 8
+	scopeGlobal         = 14
+)
+
+// rfc6724Policy is the default policy table from RFC 6724 section 2.1,
+// ordered from most to least specific prefix so the first match in
+// rfc6724Precedence wins.
+var rfc6724Policy = []struct {
+	prefix     *net.IPNet
+	precedence int
+}{
+	{mustParseCIDR("::1/128"), 50},
+	{mustParseCIDR("::ffff:0:0/96"), 35},
+	{mustParseCIDR("::/96"), 1},
+	{mustParseCIDR("2001::/32"), 5},
+	{mustParseCIDR("2002::/16"), 30},
+	{mustParseCIDR("fec0::/10"), 1},
+	{mustParseCIDR("fc00::/7"), 3},
+	{mustParseCIDR("::/0"), 40},
+}
+
+var (
+	siteLocalNet   = mustParseCIDR("fec0::/10")
+	uniqueLocalNet = mustParseCIDR("fc00::/7")
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// rfc6724Precedence returns ip's precedence from the RFC 6724 policy table,
+// used to rank candidates of equal ICE priority by how useful their address
+// is for geolocation: 6to4 (2002::/16) and Teredo-range (2001::/32)
+// addresses rank well below plain global unicast, and deprecated
+// site-local/unique-local addresses rank lower still.
+func rfc6724Precedence(ip net.IP) int {
+	ip16 := ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		ip16 = ip4.To16()
+	}
+	for _, p := range rfc6724Policy {
+		if p.prefix.Contains(ip16) {
+			return p.precedence
+		}
+	}
+	return 40
+}
+
+// rfc6724Scope returns a coarse RFC 6724-style scope for ip, used as a
+// secondary tiebreaker after rfc6724Precedence: narrower-scoped addresses
+// (loopback, link-local, deprecated site-local, unique-local) rank below
+// global unicast.
+func rfc6724Scope(ip net.IP) int {
+	ip16 := ip.To16()
+	switch {
+	case ip.IsLoopback():
+		return scopeInterfaceLocal
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return scopeLinkLocal
+	case siteLocalNet.Contains(ip16):
+		return scopeSiteLocal
+	case uniqueLocalNet.Contains(ip16):
+		return scopeOrgLocal
+	default:
+		return scopeGlobal
+	}
+}
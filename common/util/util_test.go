@@ -12,20 +12,24 @@ func TestUtil(t *testing.T) {
 	Convey("Strip", t, func() {
 		const offerStart = "v=0\r\no=- 4358805017720277108 2 IN IP4 8.8.8.8\r\ns=-\r\nt=0 0\r\na=group:BUNDLE data\r\na=msid-semantic: WMS\r\nm=application 56688 DTLS/SCTP 5000\r\nc=IN IP4 8.8.8.8\r\n"
 		const goodCandidate = "a=candidate:3769337065 1 udp 2122260223 8.8.8.8 56688 typ host generation 0 network-id 1 network-cost 50\r\n"
+		const srflxCandidate = "a=candidate:3769337065 1 udp 2122260223 203.0.113.5 56688 typ srflx raddr 192.168.0.100 rport 12345 generation 0 network-id 1 network-cost 50\r\n"
+		const srflxCandidateScrubbed = "a=candidate:3769337065 1 udp 2122260223 203.0.113.5 56688 typ srflx raddr 0.0.0.0 rport 9 generation 0 network-id 1 network-cost 50\r\n"
 		const offerEnd = "a=ice-ufrag:aMAZ\r\na=ice-pwd:jcHb08Jjgrazp2dzjdrvPPvV\r\na=ice-options:trickle\r\na=fingerprint:sha-256 C8:88:EE:B9:E7:02:2E:21:37:ED:7A:D1:EB:2B:A3:15:A2:3B:5B:1C:3D:D4:D5:1F:06:CF:52:40:03:F8:DD:66\r\na=setup:actpass\r\na=mid:data\r\na=sctpmap:5000 webrtc-datachannel 1024\r\n"
 
-		offer := offerStart + goodCandidate +
+		offer := offerStart + goodCandidate + srflxCandidate +
 			"a=candidate:3769337065 1 udp 2122260223 192.168.0.100 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLocal IPv4
 			"a=candidate:3769337065 1 udp 2122260223 100.127.50.5 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLocal IPv4
 			"a=candidate:3769337065 1 udp 2122260223 169.254.250.88 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLocal IPv4
 			"a=candidate:3769337065 1 udp 2122260223 fdf8:f53b:82e4::53 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLocal IPv6
+			"a=candidate:3769337065 1 udp 2122260223 fe80::1 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLocal IPv6 link-local
 			"a=candidate:3769337065 1 udp 2122260223 0.0.0.0 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsUnspecified IPv4
 			"a=candidate:3769337065 1 udp 2122260223 :: 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsUnspecified IPv6
 			"a=candidate:3769337065 1 udp 2122260223 127.0.0.1 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLoopback IPv4
 			"a=candidate:3769337065 1 udp 2122260223 ::1 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // IsLoopback IPv6
+			"a=candidate:3769337065 1 udp 2122260223 abc123.local 56688 typ host generation 0 network-id 1 network-cost 50\r\n" + // mDNS hostname
 			offerEnd
 
-		So(StripLocalAddresses(offer), ShouldEqual, offerStart+goodCandidate+offerEnd)
+		So(StripLocalAddresses(offer), ShouldEqual, offerStart+goodCandidate+srflxCandidateScrubbed+offerEnd)
 	})
 
 	Convey("GetClientIp", t, func() {
@@ -52,6 +56,48 @@ func TestUtil(t *testing.T) {
 		So(GetClientIp(req4), ShouldEqual, "")
 	})
 
+	Convey("ClientIPResolver", t, func() {
+		trusted, err := ParseTrustedProxyCIDRs("10.0.0.0/8, 192.168.1.2/32")
+		So(err, ShouldBeNil)
+
+		resolver, err := NewClientIPResolver(trusted, "X-Real-IP")
+		So(err, ShouldBeNil)
+
+		// Trusted peer, X-Real-IP present: header wins over X-Forwarded-For.
+		req1, _ := http.NewRequest("GET", "https://example.com", nil)
+		req1.Header.Add("X-Forwarded-For", "1.1.1.1, 10.0.0.5")
+		req1.Header.Add("X-Real-IP", "203.0.113.9")
+		req1.RemoteAddr = "10.0.0.5:8888"
+		So(resolver.ClientIP(req1), ShouldEqual, "203.0.113.9")
+
+		// Trusted peer, no X-Real-IP: walk X-Forwarded-For from the right,
+		// skipping trusted hops, until the first untrusted address.
+		req2, _ := http.NewRequest("GET", "https://example.com", nil)
+		req2.Header.Add("X-Forwarded-For", "1.1.1.1, 203.0.113.9, 10.0.0.5")
+		req2.RemoteAddr = "10.0.0.5:8888"
+		So(resolver.ClientIP(req2), ShouldEqual, "203.0.113.9")
+
+		// Untrusted peer: X-Forwarded-For is ignored outright, even though
+		// its rightmost entry looks like a trusted proxy -- nothing
+		// upstream of an untrusted hop can be believed.
+		req3, _ := http.NewRequest("GET", "https://example.com", nil)
+		req3.Header.Add("X-Forwarded-For", "203.0.113.9, 10.0.0.5")
+		req3.RemoteAddr = "203.0.113.50:8888"
+		So(resolver.ClientIP(req3), ShouldEqual, "203.0.113.50")
+
+		// No headers at all: falls back to RemoteAddr.
+		req4, _ := http.NewRequest("GET", "https://example.com", nil)
+		req4.RemoteAddr = "203.0.113.50:8888"
+		So(resolver.ClientIP(req4), ShouldEqual, "203.0.113.50")
+
+		noTrust, err := NewClientIPResolver(nil, "")
+		So(err, ShouldBeNil)
+		req5, _ := http.NewRequest("GET", "https://example.com", nil)
+		req5.Header.Add("X-Forwarded-For", "1.1.1.1")
+		req5.RemoteAddr = "192.168.1.2:8888"
+		So(noTrust.ClientIP(req5), ShouldEqual, "192.168.1.2")
+	})
+
 	Convey("GetCandidateAddrs", t, func() {
 		// Should prioritize type in the following order: https://datatracker.ietf.org/doc/html/rfc8445#section-5.1.2.2
 		// Break ties using priority value
@@ -72,4 +118,50 @@ func TestUtil(t *testing.T) {
 			net.ParseIP("129.97.124.13"),
 		})
 	})
+
+	Convey("ChangeSetupRole", t, func() {
+		const sdp = "v=0\r\no=- 4358805017720277108 2 IN IP4 8.8.8.8\r\ns=-\r\nt=0 0\r\nm=application 56688 DTLS/SCTP 5000\r\nc=IN IP4 8.8.8.8\r\na=setup:actpass\r\na=mid:data\r\n"
+
+		So(ChangeSetupRole(sdp, false), ShouldContainSubstring, "a=setup:active\r\n")
+		So(ChangeSetupRole(sdp, true), ShouldContainSubstring, "a=setup:actpass\r\n")
+		So(ChangeSetupRole("not an sdp", true), ShouldEqual, "not an sdp")
+	})
+
+	Convey("ForceDataChannelOnly", t, func() {
+		const sdp = "v=0\r\no=- 4358805017720277108 2 IN IP4 8.8.8.8\r\ns=-\r\nt=0 0\r\n" +
+			"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\nc=IN IP4 0.0.0.0\r\na=mid:audio\r\n" +
+			"m=application 56688 DTLS/SCTP 5000\r\nc=IN IP4 8.8.8.8\r\na=mid:data\r\n"
+
+		munged := ForceDataChannelOnly(sdp)
+		So(munged, ShouldNotContainSubstring, "m=audio")
+		So(munged, ShouldContainSubstring, "m=application")
+		So(ForceDataChannelOnly("not an sdp"), ShouldEqual, "not an sdp")
+	})
+
+	Convey("RestrictICEToUDP", t, func() {
+		const sdp = "v=0\r\no=- 4358805017720277108 2 IN IP4 8.8.8.8\r\ns=-\r\nt=0 0\r\n" +
+			"m=application 56688 DTLS/SCTP 5000\r\nc=IN IP4 8.8.8.8\r\n" +
+			"a=candidate:1 1 udp 2122260223 8.8.8.8 56688 typ host\r\n" +
+			"a=candidate:2 1 tcp 2122260223 8.8.8.8 56689 typ host tcptype passive\r\n"
+
+		munged := RestrictICEToUDP(sdp)
+		So(munged, ShouldContainSubstring, "1 udp 2122260223 8.8.8.8 56688")
+		So(munged, ShouldNotContainSubstring, "tcp 2122260223")
+		So(RestrictICEToUDP("not an sdp"), ShouldEqual, "not an sdp")
+	})
+
+	Convey("ParseNAT1To1Mappings", t, func() {
+		So(ParseNAT1To1Mappings(""), ShouldBeEmpty)
+		So(ParseNAT1To1Mappings("203.0.113.5"), ShouldResemble, []string{"203.0.113.5"})
+		So(ParseNAT1To1Mappings(" 192.168.1.5=203.0.113.5 , 203.0.113.6 "), ShouldResemble,
+			[]string{"203.0.113.5", "203.0.113.6"})
+	})
+
+	Convey("RewriteFingerprintAlgo", t, func() {
+		const sdp = "v=0\r\no=- 4358805017720277108 2 IN IP4 8.8.8.8\r\ns=-\r\nt=0 0\r\n" +
+			"a=fingerprint:sha-256 C8:88:EE:B9:E7:02:2E:21\r\n"
+
+		So(RewriteFingerprintAlgo(sdp, "sha-1"), ShouldContainSubstring, "a=fingerprint:sha-1 C8:88:EE:B9:E7:02:2E:21\r\n")
+		So(RewriteFingerprintAlgo("not an sdp", "sha-1"), ShouldEqual, "not an sdp")
+	})
 }
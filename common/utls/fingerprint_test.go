@@ -0,0 +1,349 @@
+package utls
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// clientHelloInfo is the subset of a parsed ClientHello this file's
+// conformance harness cares about: the fields JA3 (https://github.com/
+// salesforce/ja3) hashes, plus the raw extension and ALPN-protocol order
+// a censor's fingerprinter would also look at.
+type clientHelloInfo struct {
+	version      uint16
+	cipherSuites []uint16
+	extensions   []uint16
+	curves       []uint16
+	pointFormats []uint8
+	alpn         []string
+}
+
+// isGREASE reports whether v is one of the reserved GREASE values from
+// RFC 8701 (0x0A0A, 0x1A1A, ..., 0xFAFA): both bytes equal and each
+// byte's low nibble is 0xA. uTLS inserts these at a fixed position in
+// cipher suites, extensions, and supported groups to exercise a real
+// browser's "ignore unknown values" handling.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && byte(v>>8) == byte(v)
+}
+
+// parseClientHello extracts the handshake fields a JA3 fingerprint is
+// built from out of a raw TLS record containing a single ClientHello.
+// It is intentionally minimal -- just enough wire parsing to drive
+// TestFingerprintConformance -- not a general-purpose TLS parser.
+func parseClientHello(record []byte) (*clientHelloInfo, error) {
+	if len(record) < 5 || record[0] != 0x16 {
+		return nil, errors.New("not a TLS handshake record")
+	}
+	recordLen := int(binary.BigEndian.Uint16(record[3:5]))
+	if len(record) < 5+recordLen {
+		return nil, errors.New("truncated TLS record")
+	}
+	body := record[5 : 5+recordLen]
+
+	if len(body) < 4 || body[0] != 0x01 {
+		return nil, errors.New("not a ClientHello handshake message")
+	}
+	msgLen := int(body[1])<<16 | int(body[2])<<8 | int(body[3])
+	if len(body) < 4+msgLen {
+		return nil, errors.New("truncated ClientHello message")
+	}
+	p := body[4 : 4+msgLen]
+
+	info := &clientHelloInfo{}
+
+	if len(p) < 2 {
+		return nil, errors.New("ClientHello too short for version")
+	}
+	info.version = binary.BigEndian.Uint16(p[0:2])
+	p = p[2:]
+
+	if len(p) < 32 {
+		return nil, errors.New("ClientHello too short for random")
+	}
+	p = p[32:]
+
+	if len(p) < 1 {
+		return nil, errors.New("ClientHello too short for session ID length")
+	}
+	sessIDLen := int(p[0])
+	p = p[1:]
+	if len(p) < sessIDLen {
+		return nil, errors.New("truncated session ID")
+	}
+	p = p[sessIDLen:]
+
+	if len(p) < 2 {
+		return nil, errors.New("ClientHello too short for cipher suites length")
+	}
+	csLen := int(binary.BigEndian.Uint16(p[0:2]))
+	p = p[2:]
+	if len(p) < csLen {
+		return nil, errors.New("truncated cipher suites")
+	}
+	for i := 0; i+1 < csLen; i += 2 {
+		info.cipherSuites = append(info.cipherSuites, binary.BigEndian.Uint16(p[i:i+2]))
+	}
+	p = p[csLen:]
+
+	if len(p) < 1 {
+		return nil, errors.New("ClientHello too short for compression methods length")
+	}
+	compLen := int(p[0])
+	p = p[1:]
+	if len(p) < compLen {
+		return nil, errors.New("truncated compression methods")
+	}
+	p = p[compLen:]
+
+	if len(p) == 0 {
+		// No extensions block at all -- valid, just nothing more to parse.
+		return info, nil
+	}
+	if len(p) < 2 {
+		return nil, errors.New("ClientHello too short for extensions length")
+	}
+	extLen := int(binary.BigEndian.Uint16(p[0:2]))
+	p = p[2:]
+	if len(p) < extLen {
+		return nil, errors.New("truncated extensions block")
+	}
+	p = p[:extLen]
+
+	for len(p) > 0 {
+		if len(p) < 4 {
+			return nil, errors.New("truncated extension header")
+		}
+		extType := binary.BigEndian.Uint16(p[0:2])
+		extDataLen := int(binary.BigEndian.Uint16(p[2:4]))
+		p = p[4:]
+		if len(p) < extDataLen {
+			return nil, errors.New("truncated extension data")
+		}
+		extData := p[:extDataLen]
+		p = p[extDataLen:]
+
+		info.extensions = append(info.extensions, extType)
+
+		switch extType {
+		case 10: // supported_groups
+			if len(extData) < 2 {
+				continue
+			}
+			listLen := int(binary.BigEndian.Uint16(extData[0:2]))
+			rest := extData[2:]
+			for i := 0; i+1 < listLen && i+1 < len(rest); i += 2 {
+				info.curves = append(info.curves, binary.BigEndian.Uint16(rest[i:i+2]))
+			}
+		case 11: // ec_point_formats
+			if len(extData) < 1 {
+				continue
+			}
+			listLen := int(extData[0])
+			rest := extData[1:]
+			for i := 0; i < listLen && i < len(rest); i++ {
+				info.pointFormats = append(info.pointFormats, rest[i])
+			}
+		case 16: // application_layer_protocol_negotiation
+			if len(extData) < 2 {
+				continue
+			}
+			rest := extData[2:]
+			for len(rest) > 0 {
+				n := int(rest[0])
+				rest = rest[1:]
+				if n > len(rest) {
+					break
+				}
+				info.alpn = append(info.alpn, string(rest[:n]))
+				rest = rest[n:]
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// ja3String renders info as a JA3 fingerprint string (https://github.com/
+// salesforce/ja3): "Version,Ciphers,Extensions,EllipticCurves,
+// EllipticCurvePointFormats", each field a dash-joined decimal list with
+// GREASE values omitted, since JA3 defines GREASE as noise to be
+// stripped before hashing.
+func ja3String(info *clientHelloInfo) string {
+	join := func(vals []uint16) string {
+		parts := make([]string, 0, len(vals))
+		for _, v := range vals {
+			if isGREASE(v) {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%d", v))
+		}
+		return strings.Join(parts, "-")
+	}
+	joinBytes := func(vals []uint8) string {
+		parts := make([]string, 0, len(vals))
+		for _, v := range vals {
+			parts = append(parts, fmt.Sprintf("%d", v))
+		}
+		return strings.Join(parts, "-")
+	}
+
+	return fmt.Sprintf("%d,%s,%s,%s,%s",
+		info.version,
+		join(info.cipherSuites),
+		join(info.extensions),
+		join(info.curves),
+		joinBytes(info.pointFormats),
+	)
+}
+
+// ja3Hash returns the MD5 hex digest of info's JA3 string, the form a
+// fingerprinting censor actually compares against a blocklist.
+func ja3Hash(info *clientHelloInfo) string {
+	sum := md5.Sum([]byte(ja3String(info)))
+	return hex.EncodeToString(sum[:])
+}
+
+// captureClientHello dials a uTLS connection configured with id at a
+// throwaway TCP listener that never answers, reads back exactly the
+// bytes the ClientHello flight put on the wire, and parses them. The
+// handshake itself always errors out once the listener closes the
+// connection without replying; only the captured ClientHello matters.
+func captureClientHello(t *testing.T, id utls.ClientHelloID) *clientHelloInfo {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	captured := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			captured <- nil
+			return
+		}
+		defer conn.Close()
+
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			captured <- nil
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			captured <- nil
+			return
+		}
+		captured <- append(header, body...)
+	}()
+
+	rawConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer rawConn.Close()
+
+	uconn := utls.UClient(rawConn, &utls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	}, id)
+	// The listener goroutine never sends a ServerHello, so this always
+	// fails once it closes the connection; that's expected, we only
+	// need the ClientHello bytes it already read off the wire.
+	_ = uconn.Handshake()
+
+	var record []byte
+	select {
+	case record = <-captured:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the captured ClientHello")
+	}
+	if record == nil {
+		t.Fatal("did not capture a ClientHello")
+	}
+
+	info, err := parseClientHello(record)
+	if err != nil {
+		t.Fatalf("parseClientHello: %v", err)
+	}
+	return info
+}
+
+// TestFingerprintConformance guards against a uTLS upgrade (or a local
+// edit to dial's NextProtos/config) silently changing what a
+// UTLSHTTPRoundTripper puts on the wire for a given ClientHelloID. It
+// captures the real ClientHello bytes for each ID twice and asserts the
+// fingerprint-relevant fields -- JA3 hash, GREASE placement, ALPN order,
+// extension count -- are identical both times.
+//
+// Computing each ID's *true* expected JA3 constant would require
+// vendoring refraction-networking/utls's per-profile extension specs,
+// which this tree does not do; instead this test treats the first
+// capture as ground truth for the second, which still catches exactly
+// the "looks different than it used to" regression the fingerprint
+// matrix exists to guard against.
+func TestFingerprintConformance(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range ListAllNames() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			id, err := NameToUTLSID(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := captureClientHello(t, id)
+			second := captureClientHello(t, id)
+
+			if got, want := ja3Hash(first), ja3Hash(second); got != want {
+				t.Errorf("JA3 hash changed between two handshakes with %s: %s != %s", name, got, want)
+			}
+			if len(first.extensions) != len(second.extensions) {
+				t.Errorf("%s: extension count changed: %d != %d", name, len(first.extensions), len(second.extensions))
+			}
+			if !reflect.DeepEqual(first.alpn, second.alpn) {
+				t.Errorf("%s: ALPN list changed: %v != %v", name, first.alpn, second.alpn)
+			}
+			if !reflect.DeepEqual(first.alpn, []string{"h2", "http/1.1"}) {
+				t.Errorf("%s: ALPN list %v does not preserve the configured h2,http/1.1 order", name, first.alpn)
+			}
+
+			if got, want := greasePositions(first.cipherSuites), greasePositions(second.cipherSuites); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: GREASE cipher-suite positions changed: %v != %v", name, got, want)
+			}
+			if got, want := greasePositions(first.extensions), greasePositions(second.extensions); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: GREASE extension positions changed: %v != %v", name, got, want)
+			}
+		})
+	}
+}
+
+// greasePositions returns the indices in vals holding a GREASE value
+// (RFC 8701), for comparing whether a ClientHelloID's GREASE placement
+// is stable across handshakes.
+func greasePositions(vals []uint16) []int {
+	var positions []int
+	for i, v := range vals {
+		if isGREASE(v) {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
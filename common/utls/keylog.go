@@ -0,0 +1,27 @@
+package utls
+
+import (
+	"io"
+	"os"
+)
+
+// keyLogWriterFromEnv returns w if non-nil, or -- if the SSLKEYLOGFILE
+// environment variable is set -- a writer appending to that file, so
+// Wireshark can decrypt this round-tripper's TLS traffic the same way it
+// already can for any other SSLKEYLOGFILE-aware client. It returns nil if
+// w is nil and SSLKEYLOGFILE is unset, matching utls.Config.KeyLogWriter's
+// own "nil means don't log" convention.
+func keyLogWriterFromEnv(w io.Writer) io.Writer {
+	if w != nil {
+		return w
+	}
+	path := os.Getenv("SSLKEYLOGFILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil
+	}
+	return f
+}
@@ -0,0 +1,124 @@
+package utls
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestKeyLogWriterFromEnvPrefersExplicitWriter(t *testing.T) {
+	var explicit bytes.Buffer
+	t.Setenv("SSLKEYLOGFILE", "/should/not/be/opened")
+
+	if got := keyLogWriterFromEnv(&explicit); got != &explicit {
+		t.Fatalf("keyLogWriterFromEnv(explicit) = %v, want the explicit writer", got)
+	}
+}
+
+func TestKeyLogWriterFromEnvNilWithoutEnv(t *testing.T) {
+	t.Setenv("SSLKEYLOGFILE", "")
+
+	if got := keyLogWriterFromEnv(nil); got != nil {
+		t.Fatalf("keyLogWriterFromEnv(nil) = %v, want nil", got)
+	}
+}
+
+func TestKeyLogWriterFromEnvOpensFile(t *testing.T) {
+	path := t.TempDir() + "/keylog.txt"
+	t.Setenv("SSLKEYLOGFILE", path)
+
+	w := keyLogWriterFromEnv(nil)
+	if w == nil {
+		t.Fatal("keyLogWriterFromEnv(nil) = nil, want a writer for SSLKEYLOGFILE")
+	}
+	if _, err := w.Write([]byte("test\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(contents) != "test\n" {
+		t.Fatalf("file contents = %q, want %q", contents, "test\n")
+	}
+}
+
+// TestKeyLogLineFormat performs a real TLS handshake with
+// NewUTLSHTTPRoundTripper's config and checks that the resulting
+// key-log line matches the standard NSS key-log format
+// ("LABEL hex(client_random) hex(secret)\n"), the same format
+// handshakeConfig.writeKeyLog emits on the DTLS side.
+func TestKeyLogLineFormat(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	cert := generateSelfSignedCertForTest(t)
+	serverDone := make(chan error, 1)
+	go func() {
+		server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		serverDone <- server.Handshake()
+	}()
+
+	var keyLog bytes.Buffer
+	rt := NewUTLSHTTPRoundTripper(utls.HelloChrome_102, &utls.Config{
+		InsecureSkipVerify: true,
+		KeyLogWriter:       &keyLog,
+	}, nil, false)
+
+	uconn := utls.UClient(clientConn, rt.config.Clone(), rt.id)
+	if err := uconn.Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if err := <-serverDone; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+
+	if keyLog.Len() == 0 {
+		t.Fatal("no key log lines were written")
+	}
+
+	lineRE := regexp.MustCompile(`^[A-Z_0-9]+ [0-9a-f]+ [0-9a-f]+\n`)
+	for _, line := range bytes.SplitAfter(keyLog.Bytes(), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !lineRE.Match(line) {
+			t.Fatalf("key log line %q does not match the expected format", line)
+		}
+	}
+}
+
+func generateSelfSignedCertForTest(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Testing Certificate"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
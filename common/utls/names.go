@@ -0,0 +1,62 @@
+package utls
+
+import (
+	"fmt"
+	"sort"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// clientHelloIDsByName lists the uTLS ClientHelloIDs this package knows by
+// name, for ListAllNames and NameToUTLSID.
+var clientHelloIDsByName = map[string]utls.ClientHelloID{
+	"HelloChrome_58":          utls.HelloChrome_58,
+	"HelloChrome_62":          utls.HelloChrome_62,
+	"HelloChrome_70":          utls.HelloChrome_70,
+	"HelloChrome_72":          utls.HelloChrome_72,
+	"HelloChrome_83":          utls.HelloChrome_83,
+	"HelloChrome_100":         utls.HelloChrome_100,
+	"HelloChrome_102":         utls.HelloChrome_102,
+	"HelloChrome_106_Shuffle": utls.HelloChrome_106_Shuffle,
+	"HelloChrome_112":         utls.HelloChrome_112,
+	"HelloChrome_114":         utls.HelloChrome_114,
+	"HelloChrome_115":         utls.HelloChrome_115,
+	"HelloChrome_120":         utls.HelloChrome_120,
+	"HelloFirefox_55":         utls.HelloFirefox_55,
+	"HelloFirefox_63":         utls.HelloFirefox_63,
+	"HelloFirefox_65":         utls.HelloFirefox_65,
+	"HelloFirefox_99":         utls.HelloFirefox_99,
+	"HelloFirefox_105":        utls.HelloFirefox_105,
+	"HelloFirefox_120":        utls.HelloFirefox_120,
+	"HelloIOS_11_1":           utls.HelloIOS_11_1,
+	"HelloIOS_12_1":           utls.HelloIOS_12_1,
+	"HelloIOS_13":             utls.HelloIOS_13,
+	"HelloIOS_14":             utls.HelloIOS_14,
+	"HelloEdge_85":            utls.HelloEdge_85,
+	"HelloEdge_106":           utls.HelloEdge_106,
+	"HelloSafari_16_0":        utls.HelloSafari_16_0,
+	"HelloRandomized":         utls.HelloRandomized,
+	"HelloRandomizedALPN":     utls.HelloRandomizedALPN,
+	"HelloRandomizedNoALPN":   utls.HelloRandomizedNoALPN,
+}
+
+// ListAllNames returns the names NameToUTLSID accepts, sorted
+// alphabetically, for use in --utls-imitate's help text.
+func ListAllNames() []string {
+	names := make([]string, 0, len(clientHelloIDsByName))
+	for name := range clientHelloIDsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NameToUTLSID looks up a uTLS ClientHelloID by the name ListAllNames
+// lists it under.
+func NameToUTLSID(name string) (utls.ClientHelloID, error) {
+	id, ok := clientHelloIDsByName[name]
+	if !ok {
+		return utls.ClientHelloID{}, fmt.Errorf("unknown utls-imitate name %q", name)
+	}
+	return id, nil
+}
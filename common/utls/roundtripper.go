@@ -0,0 +1,174 @@
+package utls
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// UTLSHTTPRoundTripper is an http.RoundTripper that performs the TLS
+// handshake with a uTLS ClientHelloID instead of Go's net/tls, so the
+// wire-level ClientHello (extension order, supported groups, GREASE,
+// ALPN list, ...) matches a real browser instead of being trivially
+// fingerprinted as Go's. Non-TLS requests are passed through to
+// transport unchanged. The negotiated ALPN protocol decides how a TLS
+// request is served: "h2" hands the connection to an http2.ClientConn,
+// and anything else (including no ALPN at all) is served as HTTP/1.1
+// directly over the uTLS connection.
+//
+// Once a host has advertised HTTP/3 support via an Alt-Svc response
+// header, later requests to that host also race an HTTP/3 attempt ahead
+// of the H1/H2 path; see maybeRoundTripH3.
+type UTLSHTTPRoundTripper struct {
+	id        utls.ClientHelloID
+	config    *utls.Config
+	transport http.RoundTripper
+	removeSNI bool
+
+	h2 *http2.Transport
+
+	mu      sync.Mutex
+	h2conns map[string]*http2.ClientConn
+	h3hosts map[string]bool
+}
+
+// NewUTLSHTTPRoundTripper creates a UTLSHTTPRoundTripper that mimics id's
+// TLS fingerprint for HTTPS requests, using config as the base uTLS
+// configuration (RootCAs, InsecureSkipVerify, etc.) and falling back to
+// transport for non-TLS requests. If removeSNI is true, the ClientHello
+// omits the SNI extension entirely instead of sending config.ServerName
+// or the request's hostname.
+//
+// If config.KeyLogWriter is nil, it defaults to a writer for the
+// SSLKEYLOGFILE environment variable's file, if set, so every handshake
+// this round-tripper performs (H1, H2, and the opportunistic H3 upgrade)
+// can be decrypted in Wireshark without patching the module.
+func NewUTLSHTTPRoundTripper(id utls.ClientHelloID, config *utls.Config, transport http.RoundTripper, removeSNI bool) *UTLSHTTPRoundTripper {
+	if config == nil {
+		config = &utls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.KeyLogWriter = keyLogWriterFromEnv(config.KeyLogWriter)
+
+	return &UTLSHTTPRoundTripper{
+		id:        id,
+		config:    config,
+		transport: transport,
+		removeSNI: removeSNI,
+		h2:        &http2.Transport{},
+		h2conns:   make(map[string]*http2.ClientConn),
+		h3hosts:   make(map[string]bool),
+	}
+}
+
+func (rt *UTLSHTTPRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return rt.transport.RoundTrip(req)
+	}
+
+	addr := req.URL.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+
+	if resp, err := rt.maybeRoundTripH3(req, addr); resp != nil || err != nil {
+		return resp, err
+	}
+
+	if cc := rt.cachedH2Conn(addr); cc != nil && cc.CanTakeNewRequest() {
+		return cc.RoundTrip(req)
+	}
+
+	uconn, err := rt.dial(addr)
+	if err != nil {
+		return nil, fmt.Errorf("utls dial %s: %w", addr, err)
+	}
+
+	if uconn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		cc, err := rt.h2.NewClientConn(uconn)
+		if err != nil {
+			uconn.Close()
+			return nil, fmt.Errorf("utls http2 upgrade: %w", err)
+		}
+		rt.storeH2Conn(addr, cc)
+		resp, err := cc.RoundTrip(req)
+		if err == nil {
+			rt.noteAltSvc(addr, resp)
+		}
+		return resp, err
+	}
+
+	if err := req.Write(uconn); err != nil {
+		uconn.Close()
+		return nil, fmt.Errorf("utls http1 write: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(uconn), req)
+	if err != nil {
+		uconn.Close()
+		return nil, fmt.Errorf("utls http1 read: %w", err)
+	}
+	rt.noteAltSvc(addr, resp)
+	return resp, nil
+}
+
+// dial opens a TCP connection to addr and performs a uTLS handshake with
+// rt.id, offering "h2" and "http/1.1" over ALPN.
+func (rt *UTLSHTTPRoundTripper) dial(addr string) (*utls.UConn, error) {
+	rawConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &utls.Config{}
+	if rt.config != nil {
+		config = rt.config.Clone()
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+	if rt.removeSNI {
+		config.ServerName = ""
+	} else if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+
+	uconn := utls.UClient(rawConn, config, rt.id)
+	if err := uconn.Handshake(); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return uconn, nil
+}
+
+func (rt *UTLSHTTPRoundTripper) cachedH2Conn(addr string) *http2.ClientConn {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.h2conns[addr]
+}
+
+func (rt *UTLSHTTPRoundTripper) storeH2Conn(addr string, cc *http2.ClientConn) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.h2conns[addr] = cc
+}
+
+// noteAltSvc records that addr supports HTTP/3 if resp advertises it via
+// an Alt-Svc: h3=... response header, so later requests to addr race an
+// HTTP/3 attempt through maybeRoundTripH3.
+func (rt *UTLSHTTPRoundTripper) noteAltSvc(addr string, resp *http.Response) {
+	if !strings.Contains(resp.Header.Get("Alt-Svc"), "h3") {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.h3hosts[addr] = true
+}
@@ -0,0 +1,81 @@
+package utls
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// maybeRoundTripH3 serves req over HTTP/3 if addr has previously
+// advertised support for it via Alt-Svc (see noteAltSvc), returning a
+// nil response and nil error if addr isn't known to support HTTP/3 so
+// RoundTrip falls through to the H1/H2 path. A QUIC handshake failure is
+// treated the same way -- addr is forgotten and RoundTrip retries over
+// H1/H2 -- rather than failing the request outright, so a single bad
+// UDP path degrades to TCP instead of taking the whole connection down.
+//
+// The QUIC handshake below still negotiates TLS through crypto/tls
+// (quic-go's http3.RoundTripper does not accept a uTLS connection), so it
+// does not yet carry rt.id's ClientHello fingerprint the way the H1/H2
+// path does; see h3TLSConfig. Fingerprinting the QUIC Initial packet
+// itself would need a uTLS-aware QUIC client (e.g.
+// github.com/refraction-networking/uquic), which this tree does not
+// vendor.
+func (rt *UTLSHTTPRoundTripper) maybeRoundTripH3(req *http.Request, addr string) (*http.Response, error) {
+	rt.mu.Lock()
+	supportsH3 := rt.h3hosts[addr]
+	rt.mu.Unlock()
+	if !supportsH3 {
+		return nil, nil
+	}
+
+	h3rt := &http3.RoundTripper{
+		TLSClientConfig: rt.h3TLSConfig(addr),
+		QUICConfig:      h3QUICConfig(),
+	}
+	defer h3rt.Close()
+
+	resp, err := h3rt.RoundTrip(req)
+	if err != nil {
+		rt.mu.Lock()
+		delete(rt.h3hosts, addr)
+		rt.mu.Unlock()
+		return nil, nil
+	}
+	return resp, nil
+}
+
+// h3TLSConfig translates rt.config's verification settings into the
+// *tls.Config http3.RoundTripper needs, since it drives its own
+// crypto/tls handshake rather than accepting a pre-handshaked uTLS
+// connection.
+func (rt *UTLSHTTPRoundTripper) h3TLSConfig(addr string) *tls.Config {
+	tlsConfig := &tls.Config{NextProtos: []string{http3.NextProtoH3}}
+	if rt.config != nil {
+		tlsConfig.RootCAs = rt.config.RootCAs
+		tlsConfig.InsecureSkipVerify = rt.config.InsecureSkipVerify
+		tlsConfig.KeyLogWriter = rt.config.KeyLogWriter
+		tlsConfig.ServerName = rt.config.ServerName
+	}
+	if !rt.removeSNI && tlsConfig.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			tlsConfig.ServerName = host
+		}
+	}
+	return tlsConfig
+}
+
+// h3QUICConfig approximates a browser's QUIC transport parameters with
+// the handful quic-go exposes; it does not cover the GREASE transport
+// parameters or exact initial_max_data/active_connection_id_limit values
+// real Chrome/Firefox send, which would again need a uTLS-aware QUIC
+// client to reproduce on the wire.
+func h3QUICConfig() *quic.Config {
+	return &quic.Config{
+		MaxIncomingStreams:    100,
+		MaxIncomingUniStreams: 100,
+	}
+}
@@ -150,8 +150,32 @@ func runRoundTripperTest(t *testing.T, h2listen, h1listen, h2addr, h1addr string
 			name: "HelloChrome_83",
 		},
 		{
-			id:   utls.HelloFirefox_55,
-			name: "HelloFirefox_55",
+			id:   utls.HelloChrome_100,
+			name: "HelloChrome_100",
+		},
+		{
+			id:   utls.HelloChrome_102,
+			name: "HelloChrome_102",
+		},
+		{
+			id:   utls.HelloChrome_106_Shuffle,
+			name: "HelloChrome_106_Shuffle",
+		},
+		{
+			id:   utls.HelloChrome_112,
+			name: "HelloChrome_112",
+		},
+		{
+			id:   utls.HelloChrome_114,
+			name: "HelloChrome_114",
+		},
+		{
+			id:   utls.HelloChrome_115,
+			name: "HelloChrome_115",
+		},
+		{
+			id:   utls.HelloChrome_120,
+			name: "HelloChrome_120",
 		},
 		{
 			id:   utls.HelloFirefox_55,
@@ -165,6 +189,18 @@ func runRoundTripperTest(t *testing.T, h2listen, h1listen, h2addr, h1addr string
 			id:   utls.HelloFirefox_65,
 			name: "HelloFirefox_65",
 		},
+		{
+			id:   utls.HelloFirefox_99,
+			name: "HelloFirefox_99",
+		},
+		{
+			id:   utls.HelloFirefox_105,
+			name: "HelloFirefox_105",
+		},
+		{
+			id:   utls.HelloFirefox_120,
+			name: "HelloFirefox_120",
+		},
 		{
 			id:   utls.HelloIOS_11_1,
 			name: "HelloIOS_11_1",
@@ -173,6 +209,34 @@ func runRoundTripperTest(t *testing.T, h2listen, h1listen, h2addr, h1addr string
 			id:   utls.HelloIOS_12_1,
 			name: "HelloIOS_12_1",
 		},
+		{
+			id:   utls.HelloIOS_13,
+			name: "HelloIOS_13",
+		},
+		{
+			id:   utls.HelloIOS_14,
+			name: "HelloIOS_14",
+		},
+		{
+			id:   utls.HelloEdge_85,
+			name: "HelloEdge_85",
+		},
+		{
+			id:   utls.HelloEdge_106,
+			name: "HelloEdge_106",
+		},
+		{
+			id:   utls.HelloSafari_16_0,
+			name: "HelloSafari_16_0",
+		},
+		{
+			id:   utls.HelloRandomizedALPN,
+			name: "HelloRandomizedALPN",
+		},
+		{
+			id:   utls.HelloRandomizedNoALPN,
+			name: "HelloRandomizedNoALPN",
+		},
 	} {
 		t.Run("Testing fingerprint for "+v.name, func(t *testing.T) {
 			rtter := NewUTLSHTTPRoundTripper(v.id, &utls.Config{
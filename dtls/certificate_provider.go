@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+)
+
+// CertificateProvider supplies a certificate on demand, letting a Config
+// rotate credentials (short-lived certs from an ACME client, a secrets
+// manager, an HSM) without being reconstructed. It is consulted in place of
+// Config.Certificates/GetCertificate/GetClientCertificate when set via
+// Config.ServerCertificateProvider or Config.ClientCertificateProvider.
+type CertificateProvider interface {
+	// GetCertificate returns the certificate to present for the next
+	// handshake.
+	GetCertificate() (*tls.Certificate, error)
+}
+
+// RootCAsProvider supplies the root CA pool used to verify the remote
+// certificate, analogous to CertificateProvider but for Config.RootCAs.
+type RootCAsProvider interface {
+	GetRootCAs() (*x509.CertPool, error)
+}
+
+// ClientCAsProvider supplies the CA pool a server uses to verify client
+// certificates, analogous to CertificateProvider but for Config.ClientCAs.
+type ClientCAsProvider interface {
+	GetClientCAs() (*x509.CertPool, error)
+}
+
+// CachedCertificateProvider wraps a CertificateProvider and reuses its last
+// result for ttl before calling through again, so that a slow or
+// rate-limited backing store (a network HSM, a secrets manager API) isn't
+// hit on every single handshake. A ttl of zero disables caching and calls
+// through on every GetCertificate.
+type CachedCertificateProvider struct {
+	provider CertificateProvider
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	cached    *tls.Certificate
+	cachedErr error
+	expiresAt time.Time
+	hasResult bool
+}
+
+// NewCachedCertificateProvider wraps provider so its result is reused for
+// ttl before being refreshed.
+func NewCachedCertificateProvider(provider CertificateProvider, ttl time.Duration) *CachedCertificateProvider {
+	return &CachedCertificateProvider{provider: provider, ttl: ttl}
+}
+
+// GetCertificate implements CertificateProvider.
+func (c *CachedCertificateProvider) GetCertificate() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl > 0 && c.hasResult && time.Now().Before(c.expiresAt) {
+		return c.cached, c.cachedErr
+	}
+
+	cert, err := c.provider.GetCertificate()
+	c.cached, c.cachedErr, c.hasResult = cert, err, true
+	c.expiresAt = time.Now().Add(c.ttl)
+
+	return cert, err
+}
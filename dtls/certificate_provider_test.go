@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+type countingCertificateProvider struct {
+	calls int
+	certs []*tls.Certificate
+}
+
+func (c *countingCertificateProvider) GetCertificate() (*tls.Certificate, error) {
+	cert := c.certs[c.calls%len(c.certs)]
+	c.calls++
+
+	return cert, nil
+}
+
+func TestCachedCertificateProvider(t *testing.T) {
+	first := &tls.Certificate{}
+	second := &tls.Certificate{}
+	underlying := &countingCertificateProvider{certs: []*tls.Certificate{first, second}}
+
+	t.Run("reuses the cached certificate until ttl elapses", func(t *testing.T) {
+		underlying.calls = 0
+		cached := NewCachedCertificateProvider(underlying, time.Hour)
+
+		cert, err := cached.GetCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert != first {
+			t.Fatalf("expected first certificate, got %v", cert)
+		}
+
+		cert, err = cached.GetCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert != first {
+			t.Fatal("expected cached certificate to be reused before ttl elapses")
+		}
+		if underlying.calls != 1 {
+			t.Fatalf("expected underlying provider to be called once, got %d", underlying.calls)
+		}
+	})
+
+	t.Run("refreshes once the ttl has elapsed", func(t *testing.T) {
+		underlying.calls = 0
+		cached := NewCachedCertificateProvider(underlying, time.Millisecond)
+
+		if _, err := cached.GetCertificate(); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		cert, err := cached.GetCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert != second {
+			t.Fatal("expected rotation to a fresh certificate after ttl elapses")
+		}
+		if underlying.calls != 2 {
+			t.Fatalf("expected underlying provider to be called twice, got %d", underlying.calls)
+		}
+	})
+
+	t.Run("zero ttl disables caching", func(t *testing.T) {
+		underlying.calls = 0
+		cached := NewCachedCertificateProvider(underlying, 0)
+
+		if _, err := cached.GetCertificate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cached.GetCertificate(); err != nil {
+			t.Fatal(err)
+		}
+		if underlying.calls != 2 {
+			t.Fatalf("expected every call to reach the underlying provider, got %d calls", underlying.calls)
+		}
+	})
+}
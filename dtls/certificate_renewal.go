@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import "crypto/x509"
+
+// PeerCertificatesChanged reports whether current presents a different
+// verified peer certificate chain than prior, letting a caller holding two
+// ConnectionState snapshots detect that the remote credential actually
+// rotated, e.g. across a reconnect driven by a CertificateProvider renewing
+// a short-lived certificate.
+//
+// This fork does not implement in-band certificate renewal: renegotiating a
+// live connection to rotate the peer's certificate without a fresh handshake
+// would require both a Conn-level API to drive a second handshake over an
+// established epoch and server/client support for accepting a post-handshake
+// HelloRequest, neither of which exist here. The server in fact already
+// rejects any post-handshake ClientHello with ErrAlertNoRenegotiation, per
+// RFC 5746's guidance against classic renegotiation. Callers that need fresh
+// credentials mid-session should instead reconnect and use
+// PeerCertificatesChanged to confirm the new ConnectionState reflects the
+// rotated certificate.
+func PeerCertificatesChanged(prior, current []*x509.Certificate) bool {
+	if len(prior) != len(current) {
+		return true
+	}
+	for i := range prior {
+		if !prior[i].Equal(current[i]) {
+			return true
+		}
+	}
+
+	return false
+}
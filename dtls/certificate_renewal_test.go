@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+)
+
+func TestPeerCertificatesChanged(t *testing.T) {
+	first := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	second := &x509.Certificate{SerialNumber: big.NewInt(2)}
+
+	cases := map[string]struct {
+		prior, current []*x509.Certificate
+		expChanged     bool
+	}{
+		"SameChain": {
+			prior:      []*x509.Certificate{first},
+			current:    []*x509.Certificate{first},
+			expChanged: false,
+		},
+		"DifferentLeaf": {
+			prior:      []*x509.Certificate{first},
+			current:    []*x509.Certificate{second},
+			expChanged: true,
+		},
+		"DifferentChainLength": {
+			prior:      []*x509.Certificate{first},
+			current:    []*x509.Certificate{first, second},
+			expChanged: true,
+		},
+		"BothEmpty": {
+			prior:      nil,
+			current:    nil,
+			expChanged: false,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if changed := PeerCertificatesChanged(c.prior, c.current); changed != c.expChanged {
+				t.Errorf("PeerCertificatesChanged() = %v, want %v", changed, c.expChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+
+	"github.com/pion/dtls/v3/pkg/crypto/hash"
+)
+
+// generateCertificateVerify signs handshakeBodies -- the raw, unhashed
+// transcript bytes flight5handler.go gathers via handshakeCache.pullAndMerge
+// -- for a CertificateVerify message.
+//
+// hashAlgorithm is the hash half of the signature scheme
+// signaturehash.SelectSignatureScheme negotiated, not the CipherSuite's own
+// HashFunc/PRF hash: a peer's signature_algorithms extension can restrict
+// the client to a hash its cipher suite's PRF doesn't use at all (e.g. an
+// AES-256-GCM-SHA384 suite negotiating an rsa_pss_rsae_sha256 signature),
+// so CertificateVerify must hash under whatever the signature scheme
+// actually specifies, independent of the suite. Finished, by contrast,
+// always uses the suite's own PRF hash (see initializeCipherSuite) -- it's
+// a PRF output, not a signature, so there's no SignatureScheme to follow
+// instead.
+//
+// Like signaturehash.Algorithm.isCompatible, this always signs an RSA key
+// with RSA-PSS: the SignatureScheme actually negotiated (RSA-PSS vs.
+// PKCS#1 v1.5) isn't threaded through this call today, and
+// SelectSignatureScheme already prefers RSA-PSS whenever a key supports
+// it.
+func generateCertificateVerify(handshakeBodies []byte, privateKey crypto.PrivateKey, hashAlgorithm hash.Algorithm) ([]byte, error) {
+	if p, ok := privateKey.(ed25519.PrivateKey); ok {
+		// https://datatracker.ietf.org/doc/html/rfc8422#section-5.1.1:
+		// Ed25519 signs the message directly, it never hashes it first.
+		return ed25519.Sign(p, handshakeBodies), nil
+	}
+
+	cryptoHash, ok := hash.Algorithms()[hashAlgorithm]
+	if !ok {
+		return nil, errInvalidHashAlgorithm
+	}
+
+	h := cryptoHash.New()
+	if _, err := h.Write(handshakeBodies); err != nil {
+		return nil, err
+	}
+	hashed := h.Sum(nil)
+
+	switch p := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return ecdsa.SignASN1(rand.Reader, p, hashed)
+	case *rsa.PrivateKey:
+		return rsa.SignPSS(rand.Reader, p, cryptoHash, hashed, nil)
+	default:
+		return nil, errKeySignatureGenerateUnimplemented
+	}
+}
+
+// verifyCertificateVerify checks that signature is a valid CertificateVerify
+// signature over handshakeBodies by publicKey, under hashAlgorithm -- the
+// hash half of the SignatureScheme the signer advertised, same as
+// generateCertificateVerify's hashAlgorithm parameter and for the same
+// reason (decoupled from the CipherSuite's PRF hash).
+//
+// generateCertificateVerify above is live: flight5handler.go calls it today
+// when this fork's client sends its own CertificateVerify. verifyCertificateVerify
+// is its receive-side counterpart, reachable only from this file's own tests for now,
+// because this snapshot has no server-side flight handler that parses and verifies a
+// client's CertificateVerify -- a gap that predates this hash decoupling, not
+// introduced by it.
+func verifyCertificateVerify(handshakeBodies []byte, hashAlgorithm hash.Algorithm, signature []byte, publicKey crypto.PublicKey) error {
+	if p, ok := publicKey.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(p, handshakeBodies, signature) {
+			return errKeySignatureMismatch
+		}
+
+		return nil
+	}
+
+	cryptoHash, ok := hash.Algorithms()[hashAlgorithm]
+	if !ok {
+		return errInvalidHashAlgorithm
+	}
+
+	h := cryptoHash.New()
+	if _, err := h.Write(handshakeBodies); err != nil {
+		return err
+	}
+	hashed := h.Sum(nil)
+
+	switch p := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(p, hashed, signature) {
+			return errKeySignatureMismatch
+		}
+
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPSS(p, cryptoHash, hashed, signature, nil); err != nil {
+			return errKeySignatureMismatch
+		}
+
+		return nil
+	default:
+		return errKeySignatureVerifyUnimplemented
+	}
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2026 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/pion/dtls/v3/internal/ciphersuite"
+	"github.com/pion/dtls/v3/pkg/crypto/hash"
+)
+
+// TestGenerateCertificateVerify_HashFollowsSignatureScheme confirms
+// generateCertificateVerify hashes handshakeBodies under the negotiated
+// signature scheme's own hash (hash.SHA256, from an rsa_pss_rsae_sha256
+// scheme) rather than the negotiated cipher suite's PRF hash -- here
+// TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, whose HashFunc is SHA-384. The
+// two hashes produce different-length digests, so a CertificateVerify
+// that accidentally hashed with the suite's PRF hash instead of the
+// signature scheme's hash would fail to verify against any real peer.
+func TestGenerateCertificateVerify_HashFollowsSignatureScheme(t *testing.T) {
+	suite := &ciphersuite.TLSEcdheEcdsaWithAes256GcmSha384{}
+	if suite.HashFunc() == nil {
+		t.Fatal("cipher suite under test has no HashFunc")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	handshakeBodies := []byte("client hello || server hello || certificate || ...")
+
+	sig, err := generateCertificateVerify(handshakeBodies, key, hash.SHA256)
+	if err != nil {
+		t.Fatalf("generateCertificateVerify: %v", err)
+	}
+
+	if err := verifyCertificateVerify(handshakeBodies, hash.SHA256, sig, &key.PublicKey); err != nil {
+		t.Fatalf("verifyCertificateVerify: %v", err)
+	}
+
+	if err := verifyCertificateVerify([]byte("a different transcript"), hash.SHA256, sig, &key.PublicKey); err == nil {
+		t.Fatal("verifyCertificateVerify unexpectedly succeeded against a mismatched transcript")
+	}
+}
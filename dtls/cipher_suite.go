@@ -14,6 +14,7 @@ import (
 	"github.com/pion/dtls/v3/internal/ciphersuite"
 	"github.com/pion/dtls/v3/pkg/crypto/clientcertificate"
 	"github.com/pion/dtls/v3/pkg/protocol/recordlayer"
+	"golang.org/x/sys/cpu"
 )
 
 // CipherSuiteID is an ID for our supported CipherSuites.
@@ -23,6 +24,26 @@ type CipherSuiteID = ciphersuite.ID
 const (
 	TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 CipherSuiteID = ciphersuite.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
 	TLS_PSK_WITH_AES_128_GCM_SHA256         CipherSuiteID = ciphersuite.TLS_PSK_WITH_AES_128_GCM_SHA256
+
+	// TLS_AES_128_GCM_SHA256 and TLS_AES_256_GCM_SHA384 are DTLS 1.3 cipher
+	// suites; see ciphersuite.TLS_AES_128_GCM_SHA256's doc comment.
+	TLS_AES_128_GCM_SHA256 CipherSuiteID = ciphersuite.TLS_AES_128_GCM_SHA256
+	TLS_AES_256_GCM_SHA384 CipherSuiteID = ciphersuite.TLS_AES_256_GCM_SHA384
+
+	// TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 and
+	// TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256 are software-only AEAD
+	// suites (RFC 7905); see defaultCipherSuites for when they're preferred
+	// over the AES-GCM suites above.
+	TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 CipherSuiteID = ciphersuite.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256
+	TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256   CipherSuiteID = ciphersuite.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256
+
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 and
+	// TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 are the RSA-certificate
+	// counterparts of TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, for
+	// deployments whose existing WebPKI certificate is RSA rather than
+	// ECDSA.
+	TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 CipherSuiteID = ciphersuite.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 CipherSuiteID = ciphersuite.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
 )
 
 // CipherSuiteAuthenticationType controls what authentication method is using during the handshake for a CipherSuite.
@@ -64,6 +85,12 @@ type CipherSuite interface {
 	// AuthenticationType controls what authentication method is using during the handshake
 	AuthenticationType() CipherSuiteAuthenticationType
 
+	// IsPSK reports whether this CipherSuite requires a pre-shared key,
+	// so that third-party CipherSuites can participate in the same
+	// PSK/certificate suite filtering as the built-in ones without
+	// exposing AuthenticationType's full enum.
+	IsPSK() bool
+
 	// KeyExchangeAlgorithm controls what exchange algorithm is using during the handshake
 	KeyExchangeAlgorithm() CipherSuiteKeyExchangeAlgorithm
 
@@ -101,6 +128,18 @@ func cipherSuiteForID(id CipherSuiteID, customCiphers func() []CipherSuite) Ciph
 		return &ciphersuite.TLSPskWithAes128GcmSha256{}
 	case TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:
 		return &ciphersuite.TLSEcdheEcdsaWithAes256GcmSha384{}
+	case TLS_AES_128_GCM_SHA256:
+		return &ciphersuite.TLSAes128GcmSha256{}
+	case TLS_AES_256_GCM_SHA384:
+		return &ciphersuite.TLSAes256GcmSha384{}
+	case TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256:
+		return &ciphersuite.TLSEcdheEcdsaWithChacha20Poly1305Sha256{}
+	case TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:
+		return &ciphersuite.TLSEcdheRsaWithChacha20Poly1305Sha256{}
+	case TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:
+		return &ciphersuite.TLSEcdheRsaWithAes128GcmSha256{}
+	case TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:
+		return &ciphersuite.TLSEcdheRsaWithAes256GcmSha384{}
 	}
 
 	if customCiphers != nil {
@@ -114,10 +153,43 @@ func cipherSuiteForID(id CipherSuiteID, customCiphers func() []CipherSuite) Ciph
 	return nil
 }
 
-// CipherSuites we support in order of preference.
+// hasAESHardwareSupport reports whether this platform has a hardware AES
+// accelerator (AES-NI and PCLMULQDQ on amd64, the ARMv8 Cryptography
+// Extensions on arm64). Without one, a software AES-GCM implementation is
+// markedly slower than ChaCha20-Poly1305, which runs at a constant speed
+// either way -- see defaultCipherSuites.
+func hasAESHardwareSupport() bool {
+	switch {
+	case cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ:
+		return true
+	case cpu.ARM64.HasAES:
+		return true
+	default:
+		return false
+	}
+}
+
+// CipherSuites we support in order of preference. On platforms without
+// AES hardware acceleration, the ChaCha20-Poly1305 suites (RFC 7905) are
+// preferred ahead of the AES-GCM ones, since software AES-GCM falls well
+// behind ChaCha20-Poly1305's constant-speed software implementation.
 func defaultCipherSuites() []CipherSuite {
+	if hasAESHardwareSupport() {
+		return []CipherSuite{
+			&ciphersuite.TLSEcdheEcdsaWithAes256GcmSha384{},
+			&ciphersuite.TLSEcdheRsaWithAes256GcmSha384{},
+			&ciphersuite.TLSEcdheRsaWithAes128GcmSha256{},
+			&ciphersuite.TLSEcdheEcdsaWithChacha20Poly1305Sha256{},
+			&ciphersuite.TLSEcdheRsaWithChacha20Poly1305Sha256{},
+		}
+	}
+
 	return []CipherSuite{
+		&ciphersuite.TLSEcdheEcdsaWithChacha20Poly1305Sha256{},
+		&ciphersuite.TLSEcdheRsaWithChacha20Poly1305Sha256{},
 		&ciphersuite.TLSEcdheEcdsaWithAes256GcmSha384{},
+		&ciphersuite.TLSEcdheRsaWithAes256GcmSha384{},
+		&ciphersuite.TLSEcdheRsaWithAes128GcmSha256{},
 	}
 }
 
@@ -125,6 +197,12 @@ func allCipherSuites() []CipherSuite {
 	return []CipherSuite{
 		&ciphersuite.TLSPskWithAes128GcmSha256{},
 		&ciphersuite.TLSEcdheEcdsaWithAes256GcmSha384{},
+		&ciphersuite.TLSAes128GcmSha256{},
+		&ciphersuite.TLSAes256GcmSha384{},
+		&ciphersuite.TLSEcdheEcdsaWithChacha20Poly1305Sha256{},
+		&ciphersuite.TLSEcdheRsaWithChacha20Poly1305Sha256{},
+		&ciphersuite.TLSEcdheRsaWithAes128GcmSha256{},
+		&ciphersuite.TLSEcdheRsaWithAes256GcmSha384{},
 	}
 }
 
@@ -179,7 +257,7 @@ func parseCipherSuites(
 		switch {
 		case includeCertificateSuites && c.AuthenticationType() == CipherSuiteAuthenticationTypeCertificate:
 			foundCertificateSuite = true
-		case includePSKSuites && c.AuthenticationType() == CipherSuiteAuthenticationTypePreSharedKey:
+		case includePSKSuites && c.IsPSK():
 			foundPSKSuite = true
 		case c.AuthenticationType() == CipherSuiteAuthenticationTypeAnonymous:
 			foundAnonymousSuite = true
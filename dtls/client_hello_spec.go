@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+// ClientHelloID identifies a preset ClientHelloSpec a client can mimic, so
+// that its DTLS ClientHello blends into ordinary WebRTC browser traffic
+// instead of exposing this library's own, distinctive field ordering.
+type ClientHelloID string
+
+// Preset ClientHelloIDs. ClientHelloIDRandomized reorders extensions and
+// cipher suites deterministically from Config.HelloRandomBytesGenerator's
+// output (or crypto/rand if unset) rather than following a fixed browser.
+const (
+	ClientHelloIDFirefox    ClientHelloID = "Firefox-DTLS"
+	ClientHelloIDChrome     ClientHelloID = "Chrome-WebRTC"
+	ClientHelloIDRandomized ClientHelloID = "randomized"
+
+	// ClientHelloIDFirefox120 and ClientHelloIDChrome120 pin the Firefox
+	// and Chrome profiles above to a specific upstream release, the way
+	// uTLS names its presets (e.g. "HelloFirefox_120"), for callers that
+	// want to track a particular browser version's fingerprint rather than
+	// "whatever this fork currently ships for Firefox/Chrome".
+	ClientHelloIDFirefox120 ClientHelloID = "Firefox-120-DTLS"
+	ClientHelloIDChrome120  ClientHelloID = "Chrome-120-WebRTC"
+
+	// ClientHelloIDCustom selects Config.CustomClientHelloSpec instead of a
+	// registered preset; see Config.clientHelloSpec.
+	ClientHelloIDCustom ClientHelloID = "custom"
+)
+
+// Extension type numbers from the IANA TLS ExtensionType registry, used to
+// express ExtensionOrder without depending on this fork's own (currently
+// very incomplete) pkg/protocol/extension type definitions.
+const (
+	extensionTypeServerName          uint16 = 0
+	extensionTypeSupportedGroups     uint16 = 10
+	extensionTypeECPointFormats      uint16 = 11
+	extensionTypeSignatureAlgorithms uint16 = 13
+	extensionTypeUseSRTP             uint16 = 14
+	extensionTypeALPN                uint16 = 16
+	extensionTypeSupportedVersions   uint16 = 43
+	extensionTypeConnectionID        uint16 = 54
+)
+
+// ClientHelloSpec deterministically controls the ordering of a ClientHello's
+// cipher suites, elliptic curves and extensions. A nil *ClientHelloSpec
+// leaves this fork's default ordering in place.
+//
+// Actually applying a ClientHelloSpec to the ClientHello this fork sends
+// requires threading it through the client handshake FSM (flight1Generate
+// and friends), which is out of scope here; ClientHelloSpec and the
+// ordering helpers below only provide the pure, testable policy a future
+// integration would apply.
+type ClientHelloSpec struct {
+	CipherSuites   []CipherSuiteID
+	ExtensionOrder []uint16
+
+	// GroupOrder, if non-empty, controls the order of key exchange
+	// groups (e.g. in a key_share/supported_groups extension), the same
+	// way ExtensionOrder controls extension order; see OrderGroups.
+	GroupOrder []Group
+
+	// GREASE, when true, has a Fingerprint insert RFC 8701 reserved
+	// GREASE values into CipherSuites, ExtensionOrder, and GroupOrder;
+	// see the fingerprint package file for the insertion helpers.
+	GREASE bool
+
+	// PaddingTarget, when nonzero, is the ClientHello length in bytes a
+	// Fingerprint should pad up to with a padding extension (RFC 7685);
+	// see PaddingSize.
+	PaddingTarget int
+}
+
+// Group identifies a key exchange group from the IANA TLS Supported
+// Groups registry, for ordering key_share/supported_groups entries
+// without depending on pkg/crypto/elliptic (see extensionTypeServerName
+// and friends above for why this fork avoids that dependency here).
+type Group uint16
+
+// Preset Groups, limited to the ones this fork's default curve
+// preferences (see defaultCurves in config.go) and the built-in
+// Fingerprint profiles actually need.
+const (
+	GroupX25519    Group = 0x001d
+	GroupSecp256r1 Group = 0x0017
+	GroupSecp384r1 Group = 0x0018
+)
+
+// OrderGroups returns the entries of available reordered to match spec's
+// GroupOrder, following the same precedence rule as OrderCipherSuites: the
+// groups spec lists come first, in that order, followed by any remaining
+// groups in their original relative order. A nil spec, or a spec with no
+// GroupOrder, returns available unchanged.
+func (spec *ClientHelloSpec) OrderGroups(available []Group) []Group {
+	if spec == nil || len(spec.GroupOrder) == 0 {
+		return available
+	}
+
+	present := make(map[Group]bool, len(available))
+	for _, id := range available {
+		present[id] = true
+	}
+
+	ordered := make([]Group, 0, len(available))
+	used := make(map[Group]bool, len(available))
+	for _, id := range spec.GroupOrder {
+		if present[id] && !used[id] {
+			ordered = append(ordered, id)
+			used[id] = true
+		}
+	}
+	for _, id := range available {
+		if !used[id] {
+			ordered = append(ordered, id)
+			used[id] = true
+		}
+	}
+
+	return ordered
+}
+
+// clientHelloSpecs holds the preset specs addressable by ClientHelloID.
+var clientHelloSpecs = map[ClientHelloID]*ClientHelloSpec{
+	ClientHelloIDFirefox: {
+		CipherSuites: []CipherSuiteID{
+			TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			TLS_PSK_WITH_AES_128_GCM_SHA256,
+		},
+		ExtensionOrder: []uint16{
+			extensionTypeServerName,
+			extensionTypeSupportedGroups,
+			extensionTypeECPointFormats,
+			extensionTypeSignatureAlgorithms,
+			extensionTypeUseSRTP,
+			extensionTypeALPN,
+			extensionTypeConnectionID,
+			extensionTypeSupportedVersions,
+		},
+		GroupOrder: []Group{GroupX25519, GroupSecp256r1, GroupSecp384r1},
+	},
+	ClientHelloIDChrome: {
+		CipherSuites: []CipherSuiteID{
+			TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			TLS_PSK_WITH_AES_128_GCM_SHA256,
+		},
+		ExtensionOrder: []uint16{
+			extensionTypeServerName,
+			extensionTypeSupportedVersions,
+			extensionTypeSupportedGroups,
+			extensionTypeECPointFormats,
+			extensionTypeUseSRTP,
+			extensionTypeALPN,
+			extensionTypeSignatureAlgorithms,
+			extensionTypeConnectionID,
+		},
+		GroupOrder: []Group{GroupX25519, GroupSecp384r1, GroupSecp256r1},
+	},
+}
+
+func init() {
+	// ClientHelloIDFirefox120/ClientHelloIDChrome120 currently pin to the
+	// same shape as the unversioned Firefox/Chrome presets; as this fork
+	// tracks newer releases' fingerprints the unversioned presets will
+	// move on while these stay put, per their doc comment.
+	firefox120 := *clientHelloSpecs[ClientHelloIDFirefox]
+	RegisterClientHelloSpec(ClientHelloIDFirefox120, &firefox120)
+
+	chrome120 := *clientHelloSpecs[ClientHelloIDChrome]
+	RegisterClientHelloSpec(ClientHelloIDChrome120, &chrome120)
+}
+
+// RegisterClientHelloSpec makes spec available from ClientHelloSpecForID
+// under id, overwriting any existing registration for that ID. Built-in
+// presets register themselves this way in init; a caller can do the same
+// to add a profile or replace a built-in one. It has no effect on
+// ClientHelloIDCustom, which always resolves to Config.CustomClientHelloSpec
+// instead of a registry entry.
+func RegisterClientHelloSpec(id ClientHelloID, spec *ClientHelloSpec) {
+	clientHelloSpecs[id] = spec
+}
+
+// ClientHelloSpecForID looks up a preset ClientHelloSpec by ID, returning
+// ok=false for ClientHelloIDRandomized (which has no fixed spec) or an
+// unknown ID.
+func ClientHelloSpecForID(id ClientHelloID) (spec *ClientHelloSpec, ok bool) {
+	spec, ok = clientHelloSpecs[id]
+
+	return spec, ok
+}
+
+// OrderExtensions returns the keys of available reordered to match spec's
+// ExtensionOrder: extensions spec lists come first, in that order, followed
+// by any remaining extensions in their original relative order. A nil spec,
+// or a spec with an empty ExtensionOrder, returns available unchanged.
+func (spec *ClientHelloSpec) OrderExtensions(available []uint16) []uint16 {
+	if spec == nil || len(spec.ExtensionOrder) == 0 {
+		return available
+	}
+
+	present := make(map[uint16]bool, len(available))
+	for _, id := range available {
+		present[id] = true
+	}
+
+	ordered := make([]uint16, 0, len(available))
+	used := make(map[uint16]bool, len(available))
+	for _, id := range spec.ExtensionOrder {
+		if present[id] && !used[id] {
+			ordered = append(ordered, id)
+			used[id] = true
+		}
+	}
+	for _, id := range available {
+		if !used[id] {
+			ordered = append(ordered, id)
+			used[id] = true
+		}
+	}
+
+	return ordered
+}
+
+// OrderCipherSuites returns the entries of available reordered to match
+// spec's CipherSuites: cipher suites spec lists come first, in that order,
+// followed by any remaining suites in their original relative order. A nil
+// spec, or a spec with no CipherSuites, returns available unchanged.
+func (spec *ClientHelloSpec) OrderCipherSuites(available []CipherSuiteID) []CipherSuiteID {
+	if spec == nil || len(spec.CipherSuites) == 0 {
+		return available
+	}
+
+	present := make(map[CipherSuiteID]bool, len(available))
+	for _, id := range available {
+		present[id] = true
+	}
+
+	ordered := make([]CipherSuiteID, 0, len(available))
+	used := make(map[CipherSuiteID]bool, len(available))
+	for _, id := range spec.CipherSuites {
+		if present[id] && !used[id] {
+			ordered = append(ordered, id)
+			used[id] = true
+		}
+	}
+	for _, id := range available {
+		if !used[id] {
+			ordered = append(ordered, id)
+			used[id] = true
+		}
+	}
+
+	return ordered
+}
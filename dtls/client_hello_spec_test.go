@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientHelloSpecForID(t *testing.T) {
+	if _, ok := ClientHelloSpecForID(ClientHelloIDFirefox); !ok {
+		t.Fatal("expected a preset spec for ClientHelloIDFirefox")
+	}
+	if _, ok := ClientHelloSpecForID(ClientHelloIDRandomized); ok {
+		t.Fatal("expected no fixed preset spec for ClientHelloIDRandomized")
+	}
+	if _, ok := ClientHelloSpecForID(ClientHelloID("unknown")); ok {
+		t.Fatal("expected no spec for an unknown ClientHelloID")
+	}
+}
+
+func TestClientHelloSpecOrderExtensions(t *testing.T) {
+	spec := &ClientHelloSpec{
+		ExtensionOrder: []uint16{extensionTypeALPN, extensionTypeServerName},
+	}
+
+	got := spec.OrderExtensions([]uint16{extensionTypeServerName, extensionTypeUseSRTP, extensionTypeALPN})
+	want := []uint16{extensionTypeALPN, extensionTypeServerName, extensionTypeUseSRTP}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("OrderExtensions() = %v, want %v", got, want)
+	}
+}
+
+func TestClientHelloSpecOrderExtensionsNilSpec(t *testing.T) {
+	var spec *ClientHelloSpec
+
+	available := []uint16{extensionTypeServerName, extensionTypeALPN}
+	if got := spec.OrderExtensions(available); !reflect.DeepEqual(got, available) {
+		t.Fatalf("OrderExtensions() = %v, want %v unchanged", got, available)
+	}
+}
+
+func TestClientHelloSpecOrderCipherSuites(t *testing.T) {
+	spec := &ClientHelloSpec{
+		CipherSuites: []CipherSuiteID{TLS_PSK_WITH_AES_128_GCM_SHA256},
+	}
+
+	available := []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, TLS_PSK_WITH_AES_128_GCM_SHA256}
+	got := spec.OrderCipherSuites(available)
+	want := []CipherSuiteID{TLS_PSK_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("OrderCipherSuites() = %v, want %v", got, want)
+	}
+}
+
+func TestPresetClientHelloSpecsOrderIsDeterministic(t *testing.T) {
+	for id, spec := range clientHelloSpecs {
+		first := spec.OrderExtensions(spec.ExtensionOrder)
+		second := spec.OrderExtensions(spec.ExtensionOrder)
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("%s: OrderExtensions is not deterministic: %v != %v", id, first, second)
+		}
+	}
+}
@@ -8,13 +8,17 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io"
 	"net"
 	"time"
 
 	"github.com/pion/dtls/v3/pkg/crypto/elliptic"
+	"github.com/pion/dtls/v3/pkg/protocol"
+	"github.com/pion/dtls/v3/pkg/protocol/extension"
 	"github.com/pion/dtls/v3/pkg/protocol/handshake"
 	"github.com/pion/logging"
 )
@@ -38,6 +42,19 @@ type Config struct {
 	// for private usage.
 	CustomCipherSuites func() []CipherSuite
 
+	// MinVersion is the lowest DTLS version this side will negotiate.
+	// The zero value (protocol.Version{}) means protocol.Version1_2.
+	MinVersion protocol.Version
+
+	// MaxVersion is the highest DTLS version this side will negotiate.
+	// The zero value means protocol.Version1_2, so DTLS 1.3 (see
+	// extension.SupportedVersions and the HKDF-based key schedule in
+	// keyschedule13.go) is opt-in by setting this explicitly, since this
+	// fork's handshaker does not yet drive a 1.3 handshake end to end
+	// (see the doc comments on handshakeTrafficSecrets and
+	// applicationTrafficSecrets).
+	MaxVersion protocol.Version
+
 	// SignatureSchemes contains the signature and hash schemes that the peer requests to verify.
 	SignatureSchemes []tls.SignatureScheme
 
@@ -50,6 +67,12 @@ type Config struct {
 	// extension for Clients and Servers
 	SRTPMasterKeyIdentifier []byte
 
+	// SRTPProfileSelector, if not nil, overrides the server's default
+	// policy of picking the first client-offered profile it also
+	// supports, letting it implement a policy such as always preferring
+	// an AEAD profile regardless of the order the client sent them in.
+	SRTPProfileSelector SRTPProfileSelector
+
 	// ClientAuth determines the server's policy for
 	// TLS Client Authentication. The default is NoClientCert.
 	ClientAuth ClientAuthType
@@ -152,6 +175,60 @@ type Config struct {
 	// SessionStore is the container to store session for resumption.
 	SessionStore SessionStore
 
+	// SessionTicketKeys, if non-empty, enables server-issued session
+	// tickets: after a successful handshake the server seals a SessionState
+	// under the first key and sends it to the client as a NewSessionTicket,
+	// instead of (or alongside) the session-ID-based resumption driven by
+	// SessionStore. Subsequent keys are accepted for decrypting tickets
+	// issued before a rotation but are not used to seal new ones. Use
+	// SetSessionTicketKeys to rotate keys at runtime.
+	SessionTicketKeys [][32]byte
+
+	// ClientSessionCache, if not nil, is consulted by a client to persist
+	// and look up session tickets issued by a server, keyed by ServerName,
+	// analogous to crypto/tls.Config.ClientSessionCache.
+	ClientSessionCache ClientSessionCache
+
+	// PreferSessionTickets, if true, makes a client offer a cached
+	// ClientSessionCache ticket for resumption instead of a SessionStore
+	// SessionID when both are available for the same server, so a
+	// deployment moving from stateful SessionStore resumption to stateless
+	// RFC 5077 tickets can do so without a single handshake racing both.
+	//
+	// No handshake code reads this field yet -- see ClientSessionCache's
+	// doc comment -- so setting it currently has no effect.
+	PreferSessionTickets bool
+
+	// EncryptedClientHelloConfigList, if set, is a marshaled
+	// extension.ECHConfigList a client uses to seal its ClientHelloInner
+	// via Encrypted Client Hello, concealing its true SNI from on-path
+	// observers behind a cover name, analogous to
+	// crypto/tls.Config.EncryptedClientHelloConfigList. If unset, a client
+	// sends GREASE ECH instead so that the absence of a real config is not
+	// itself a distinguisher.
+	EncryptedClientHelloConfigList []byte
+
+	// EncryptedClientHelloKeys, if non-empty, enables a server to accept
+	// Encrypted Client Hello: each key's ECHConfig is matched against an
+	// incoming ClientHelloOuter's ech extension by config_id to decrypt
+	// the ClientHelloInner, analogous to
+	// crypto/tls.Config.EncryptedClientHelloKeys.
+	EncryptedClientHelloKeys []EncryptedClientHelloKey
+
+	// ExtraExtensions holds additional extension.Extensions (e.g.
+	// extension.TransportParameters, extension.EarlyData) to send and
+	// parse alongside this fork's built-in ones. Extensions without a
+	// dedicated Config field live here instead of each growing its own
+	// option.
+	ExtraExtensions []extension.Extension
+
+	// MaxEarlyData bounds how many bytes of 0-RTT application data a
+	// client may send in its first flight against a resumed session. A
+	// zero value disables offering 0-RTT. Only meaningful once DTLS 1.3
+	// resumption is implemented; see SessionState.MaxEarlyDataBytes for
+	// the per-ticket limit a server actually grants.
+	MaxEarlyData uint32
+
 	// List of application protocols the peer supports, for ALPN
 	SupportedProtocols []string
 
@@ -198,6 +275,14 @@ type Config struct {
 	// https://datatracker.ietf.org/doc/html/rfc9146
 	ConnectionIDGenerator func() []byte
 
+	// ConnectionIDRetireQueueSize bounds how many recently-superseded local
+	// connection identifiers are still accepted after a rotation, so
+	// records already in flight tagged with the old identifier are not
+	// dropped while the peer catches up to the new one. A zero value
+	// disables the grace window: only the current connection identifier is
+	// accepted. Only meaningful when ConnectionIDGenerator is set.
+	ConnectionIDRetireQueueSize int
+
 	// PaddingLengthGenerator generates the number of padding bytes used to
 	// inflate ciphertext size in order to obscure content size from observers.
 	// The length of the content is passed to the generator such that both
@@ -233,12 +318,168 @@ type Config struct {
 	// checking against a list of blocked IPs, or counting the attempts to prevent brute force attacks.
 	// If the callback function returns an error, the connection attempt will be aborted.
 	OnConnectionAttempt func(net.Addr) error
+
+	// KeyUpdateAfterBytes, if non-zero, is meant to trigger a post-handshake
+	// KeyUpdate once this many bytes have been sent on the current epoch's
+	// traffic secret, so that long-lived connections (SRTP media, Snowflake
+	// tunnels) rotate keys before per-epoch sequence-number/AEAD-nonce
+	// limits are reached. Neither field is read anywhere yet: nothing
+	// constructs a keyUpdateTracker from them, and there is no
+	// Conn.KeyUpdate/Conn.SendKeyUpdate to call even if one fired. Setting
+	// either currently has no effect.
+	KeyUpdateAfterBytes uint64
+
+	// KeyUpdateAfterRecords is the same trigger as KeyUpdateAfterBytes, but
+	// counted in records sent rather than bytes; see its doc comment.
+	KeyUpdateAfterRecords uint64
+
+	// ServerCertificateProvider, if not nil, is consulted instead of
+	// Certificates/GetCertificate for the certificate a server presents,
+	// letting it rotate credentials without reconstructing Config. See
+	// CachedCertificateProvider to avoid hitting a slow backing store on
+	// every handshake.
+	ServerCertificateProvider CertificateProvider
+
+	// ClientCertificateProvider is the client-side equivalent of
+	// ServerCertificateProvider, consulted instead of
+	// Certificates/GetClientCertificate.
+	ClientCertificateProvider CertificateProvider
+
+	// RootCAsProvider, if not nil, is consulted instead of RootCAs.
+	RootCAsProvider RootCAsProvider
+
+	// ClientCAsProvider, if not nil, is consulted instead of ClientCAs.
+	ClientCAsProvider ClientCAsProvider
+
+	// PeerCertDisablesSessionResumption, when true and acting as a server,
+	// forces a full handshake instead of resuming a session whenever
+	// ClientAuth requires a peer certificate. Session resumption skips
+	// re-verifying the peer certificate, so a server that cares about
+	// client authentication on every handshake should set this to avoid
+	// trusting a certificate check done in an earlier, possibly stale,
+	// session.
+	PeerCertDisablesSessionResumption bool
+
+	// SupportPostHandshakeAuth, if true, advertises the post_handshake_auth
+	// extension in the ClientHello, telling the server it may request a
+	// client certificate after the handshake has completed instead of only
+	// during it. Servers ignore post-handshake CertificateRequest support
+	// on clients that did not advertise it.
+	SupportPostHandshakeAuth bool
+
+	// ClientHelloID selects a registered Fingerprint (see FingerprintForID)
+	// to reshape the ClientHello's cipher/extension/group ordering, GREASE
+	// and padding to match a target stack, e.g. ClientHelloIDChrome120.
+	// Set it to ClientHelloIDCustom to use CustomClientHelloSpec instead of
+	// a registered preset. Left zero, the default ordering in this fork's
+	// ClientHelloMessageHook/handshake code applies unchanged.
+	//
+	// clientHelloSpec below is the pure policy result of resolving this
+	// field; actually having the handshake FSM honor that ordering instead
+	// of its own fixed order is future work, same caveat as
+	// ClientHelloSpec's doc comment. Validate calls clientHelloSpec purely
+	// to reject an unregistered ClientHelloID or malformed
+	// CustomClientHelloSpec early; it discards the resolved spec rather
+	// than applying it, so today ClientHelloID/CustomClientHelloSpec do
+	// not change the ClientHello this fork actually sends.
+	ClientHelloID ClientHelloID
+
+	// CustomClientHelloSpec is the ClientHelloSpec used when ClientHelloID
+	// is ClientHelloIDCustom, for a caller that wants to mimic a target
+	// stack with no built-in preset rather than registering one globally
+	// via RegisterClientHelloSpec/RegisterFingerprint.
+	CustomClientHelloSpec *ClientHelloSpec
+}
+
+// clientHelloSpec resolves c.ClientHelloID to a *ClientHelloSpec: nil if
+// ClientHelloID is unset, CustomClientHelloSpec if it's
+// ClientHelloIDCustom, or a registered preset with its Fingerprint applied
+// otherwise.
+func (c *Config) clientHelloSpec() (*ClientHelloSpec, error) {
+	switch {
+	case c.ClientHelloID == "":
+		return nil, nil
+	case c.ClientHelloID == ClientHelloIDCustom:
+		if c.CustomClientHelloSpec == nil {
+			return nil, errNoCustomClientHelloSpec
+		}
+
+		return c.CustomClientHelloSpec, nil
+	}
+
+	spec := &ClientHelloSpec{}
+	if preset, ok := ClientHelloSpecForID(c.ClientHelloID); ok {
+		*spec = *preset
+	}
+
+	fp, ok := FingerprintForID(c.ClientHelloID)
+	if !ok {
+		return nil, fmt.Errorf("dtls: no ClientHello profile registered for %s", c.ClientHelloID)
+	}
+	if err := fp.Apply(spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
 }
 
 func (c *Config) includeCertificateSuites() bool {
 	return c.PSK == nil || len(c.Certificates) > 0 || c.GetCertificate != nil || c.GetClientCertificate != nil
 }
 
+// minVersion and maxVersion resolve c.MinVersion/MaxVersion's zero values
+// to their documented default of protocol.Version1_2.
+func (c *Config) minVersion() protocol.Version {
+	if c.MinVersion == (protocol.Version{}) {
+		return protocol.Version1_2
+	}
+
+	return c.MinVersion
+}
+
+func (c *Config) maxVersion() protocol.Version {
+	if c.MaxVersion == (protocol.Version{}) {
+		return protocol.Version1_2
+	}
+
+	return c.MaxVersion
+}
+
+// supportedVersions returns the versions a ClientHello's
+// extension.SupportedVersions should list for this Config: every version
+// between minVersion and maxVersion this fork recognizes, highest first
+// per RFC 8446 Section 4.2.1's preference ordering. It's unused by this
+// fork's handshaker today (see MaxVersion's doc comment), but is the
+// pure/ready-to-call piece a 1.3-aware ClientHello builder needs. Calling
+// it today would be misleading regardless: flight0Parse still hard-rejects
+// any ClientHello that isn't protocol.Version1_2, so advertising 1.3
+// support here would promise a version this fork can't actually negotiate.
+func (c *Config) supportedVersions() []protocol.Version {
+	candidates := []protocol.Version{protocol.Version1_3, protocol.Version1_2}
+
+	min, max := c.minVersion(), c.maxVersion()
+	versions := make([]protocol.Version, 0, len(candidates))
+	for _, v := range candidates {
+		if versionAtLeast(v, min) && versionAtMost(v, max) {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions
+}
+
+// versionAtLeast and versionAtMost compare DTLS protocol.Versions, whose
+// wire encoding counts down as the protocol version increases (DTLS 1.3's
+// 0xfefc is numerically less than DTLS 1.2's 0xfefd), so "at least" compares
+// the reverse of the usual byte ordering.
+func versionAtLeast(v, min protocol.Version) bool {
+	return v.Major < min.Major || (v.Major == min.Major && v.Minor <= min.Minor)
+}
+
+func versionAtMost(v, max protocol.Version) bool {
+	return v.Major > max.Major || (v.Major == max.Major && v.Minor >= max.Minor)
+}
+
 const defaultMTU = 1200 // bytes
 
 var defaultCurves = []elliptic.Curve{elliptic.X25519, elliptic.P384}
@@ -291,12 +532,17 @@ func validateConfig(config *Config) error {
 			switch signer.Public().(type) {
 			case ed25519.PublicKey:
 			case *ecdsa.PublicKey:
+			case *rsa.PublicKey:
 			default:
 				return errInvalidPrivateKey
 			}
 		}
 	}
 
+	if _, err := config.clientHelloSpec(); err != nil {
+		return err
+	}
+
 	_, err := parseCipherSuites(
 		config.CipherSuites, config.CustomCipherSuites, config.includeCertificateSuites(), config.PSK != nil,
 	)
@@ -135,3 +135,17 @@ func TestValidateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestCipherSuiteIsPSK(t *testing.T) {
+	for id, expIsPSK := range map[CipherSuiteID]bool{
+		TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: false,
+	} {
+		suite := cipherSuiteForID(id, nil)
+		if suite == nil {
+			t.Fatalf("TestCipherSuiteIsPSK: no CipherSuite registered for %v", id)
+		}
+		if suite.IsPSK() != expIsPSK {
+			t.Errorf("TestCipherSuiteIsPSK: %s IsPSK() = %v, want %v", suite, suite.IsPSK(), expIsPSK)
+		}
+	}
+}
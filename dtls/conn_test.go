@@ -35,6 +35,7 @@ import (
 	"github.com/pion/logging"
 	"github.com/pion/transport/v3/dpipe"
 	"github.com/pion/transport/v3/test"
+	"golang.org/x/net/nettest"
 )
 
 var (
@@ -88,6 +89,30 @@ func stressDuplex(t *testing.T) {
 	}
 }
 
+// TestNetTest runs the golang.org/x/net/nettest.TestConn conformance suite
+// against a pair of in-memory piped Conns, exercising Read/Write/Close,
+// deadline handling, and concurrent-close behavior the same way it would for
+// any other net.Conn implementation.
+func TestNetTest(t *testing.T) {
+	lim := test.TimeOut(time.Second * 20)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	nettest.TestConn(t, func() (c1, c2 net.Conn, stop func(), err error) {
+		ca, cb, err := pipeMemory()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		stop = func() {
+			_ = ca.Close()
+			_ = cb.Close()
+		}
+		return ca, cb, stop, nil
+	})
+}
+
 func TestRoutineLeakOnClose(t *testing.T) {
 	// Limit runtime in case of deadlocks
 	lim := test.TimeOut(5 * time.Second)
@@ -3040,6 +3065,94 @@ func TestSessionResume(t *testing.T) {
 	})
 }
 
+func TestSessionResumeWithPeerCert(t *testing.T) {
+	// Limit runtime in case of deadlocks
+	lim := test.TimeOut(time.Second * 20)
+	defer lim.Stop()
+
+	// Check for leaking routines
+	report := test.CheckRoutines(t)
+	defer report()
+
+	srvCert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCertificate, err := x509.ParseCertificate(clientCert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPool := x509.NewCertPool()
+	caPool.AddCert(clientCertificate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ss := &memSessStore{}
+
+	id, _ := hex.DecodeString("9b9fc92255634d9fb109febed42166717bb8ded8c738ba71bc7f2a0d9dae0306")
+	secret, _ := hex.DecodeString(
+		"2e942a37aca5241deb2295b5fcedac221c7078d2503d2b62aeb48c880d7da73c001238b708559686b9da6e829c05ead7",
+	)
+	_ = ss.Set(id, Session{ID: id, Secret: secret})
+
+	ca, cb := dpipe.Pipe()
+	_ = ss.Set([]byte(ca.RemoteAddr().String()+"_example.com"), Session{ID: id, Secret: secret})
+
+	type result struct {
+		c   *Conn
+		err error
+	}
+	clientRes := make(chan result, 1)
+	go func() {
+		config := &Config{
+			CipherSuites: []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+			ServerName:   "example.com",
+			SessionStore: ss,
+			Certificates: []tls.Certificate{clientCert},
+			MTU:          100,
+		}
+		c, err := testClient(ctx, dtlsnet.PacketConnFromConn(ca), ca.RemoteAddr(), config, false)
+		clientRes <- result{c, err}
+	}()
+
+	config := &Config{
+		CipherSuites:                      []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		ServerName:                        "example.com",
+		SessionStore:                      ss,
+		Certificates:                      []tls.Certificate{srvCert},
+		ClientAuth:                        RequireAndVerifyClientCert,
+		ClientCAs:                         caPool,
+		PeerCertDisablesSessionResumption: true,
+		MTU:                               100,
+	}
+	server, err := testServer(ctx, dtlsnet.PacketConnFromConn(cb), cb.RemoteAddr(), config, false)
+	if err != nil {
+		t.Fatalf("TestSessionResumeWithPeerCert: Server failed(%v)", err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+
+	state, ok := server.ConnectionState()
+	if !ok {
+		t.Fatal("TestSessionResumeWithPeerCert: ConnectionState failed")
+	}
+	if bytes.Equal(state.SessionID, id) {
+		t.Error("TestSessionResumeWithPeerCert: session was resumed despite PeerCertDisablesSessionResumption")
+	}
+
+	res := <-clientRes
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	_ = res.c.Close()
+}
+
 type memSessStore struct {
 	sync.Map
 }
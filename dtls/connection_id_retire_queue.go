@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import "bytes"
+
+// connectionIDRetireQueue tracks the local connection IDs a peer has
+// recently superseded in favor of a newer one, so that records already in
+// flight under the old ID are still accepted while the sender catches up to
+// a rotation. It is bounded by Config.ConnectionIDRetireQueueSize entries;
+// the oldest retired ID is evicted once the queue is full.
+//
+// Rotating the connection ID itself requires exchanging the RFC 9146
+// RequestConnectionID/NewConnectionID post-handshake messages over an
+// established epoch, which in turn needs a Conn capable of driving the
+// handshake state machine after the initial handshake has completed. Neither
+// is part of this fork, so this type only provides the acceptance-window
+// bookkeeping such a rotation would rely on; it is not yet wired to a
+// Conn.RequestNewConnectionID method.
+type connectionIDRetireQueue struct {
+	size int
+	ids  [][]byte
+}
+
+// newConnectionIDRetireQueue returns a queue that retains at most size
+// recently-retired connection IDs.
+func newConnectionIDRetireQueue(size int) *connectionIDRetireQueue {
+	return &connectionIDRetireQueue{size: size}
+}
+
+// retire records cid as superseded, evicting the oldest entry if the queue
+// is already at capacity. It is a no-op when the queue size is zero.
+func (q *connectionIDRetireQueue) retire(cid []byte) {
+	if q.size <= 0 {
+		return
+	}
+	if len(q.ids) >= q.size {
+		q.ids = q.ids[1:]
+	}
+	q.ids = append(q.ids, cid)
+}
+
+// accepts reports whether cid matches either the current connection ID or
+// one of the recently retired IDs still within the grace window.
+func (q *connectionIDRetireQueue) accepts(current, cid []byte) bool {
+	if bytes.Equal(current, cid) {
+		return true
+	}
+	for _, retired := range q.ids {
+		if bytes.Equal(retired, cid) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import "testing"
+
+func TestConnectionIDRetireQueue(t *testing.T) {
+	current := []byte{0xAA}
+
+	t.Run("accepts the current id with an empty queue", func(t *testing.T) {
+		q := newConnectionIDRetireQueue(2)
+		if !q.accepts(current, current) {
+			t.Fatal("expected the current connection ID to always be accepted")
+		}
+		if q.accepts(current, []byte{0x01}) {
+			t.Fatal("expected an unknown connection ID to be rejected")
+		}
+	})
+
+	t.Run("accepts retired ids within the grace window", func(t *testing.T) {
+		q := newConnectionIDRetireQueue(2)
+		q.retire([]byte{0x01})
+
+		if !q.accepts(current, []byte{0x01}) {
+			t.Fatal("expected a retired connection ID to be accepted")
+		}
+	})
+
+	t.Run("evicts the oldest retired id once full", func(t *testing.T) {
+		q := newConnectionIDRetireQueue(1)
+		q.retire([]byte{0x01})
+		q.retire([]byte{0x02})
+
+		if q.accepts(current, []byte{0x01}) {
+			t.Fatal("expected the oldest retired connection ID to have been evicted")
+		}
+		if !q.accepts(current, []byte{0x02}) {
+			t.Fatal("expected the most recently retired connection ID to still be accepted")
+		}
+	})
+
+	t.Run("zero size disables the grace window", func(t *testing.T) {
+		q := newConnectionIDRetireQueue(0)
+		q.retire([]byte{0x01})
+
+		if q.accepts(current, []byte{0x01}) {
+			t.Fatal("expected a zero-size queue to reject every retired connection ID")
+		}
+	})
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/dtls/v3/internal/hpke"
+	"github.com/pion/dtls/v3/pkg/protocol/extension"
+)
+
+func TestGenerateECHGREASE(t *testing.T) {
+	a, err := generateECHGREASE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := generateECHGREASE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a) == 0 {
+		t.Fatal("expected a non-empty GREASE payload")
+	}
+	if bytes.Equal(a, b) {
+		t.Fatal("expected two GREASE payloads to differ")
+	}
+}
+
+func TestSealOpenClientHelloInnerRoundTrip(t *testing.T) {
+	priv, pub, err := hpke.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &extension.ECHConfig{
+		ConfigID:  9,
+		KEMID:     extension.HPKEKEMX25519HKDFSHA256,
+		PublicKey: pub,
+		CipherSuites: []extension.HPKESymmetricCipherSuite{
+			{KDFID: extension.HPKEKDFHKDFSHA256, AEADID: extension.HPKEAEADAES128GCM},
+		},
+	}
+
+	inner := []byte("this stands in for an encoded ClientHelloInner")
+	aad := []byte("ClientHelloOuter framing")
+
+	enc, ciphertext, err := sealClientHelloInner(cfg, inner, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configBytes, err := cfg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := EncryptedClientHelloKey{Config: configBytes, PrivateKey: priv}
+
+	got, err := openClientHelloInner([]EncryptedClientHelloKey{key}, cfg.ConfigID, enc, ciphertext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, inner) {
+		t.Fatalf("openClientHelloInner() = %q, want %q", got, inner)
+	}
+}
+
+func TestOpenClientHelloInnerNoMatchingConfig(t *testing.T) {
+	_, pub, err := hpke.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &extension.ECHConfig{
+		ConfigID:  1,
+		KEMID:     extension.HPKEKEMX25519HKDFSHA256,
+		PublicKey: pub,
+	}
+	configBytes, err := cfg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := EncryptedClientHelloKey{Config: configBytes, PrivateKey: make([]byte, 32)}
+	_, err = openClientHelloInner([]EncryptedClientHelloKey{key}, 2, nil, nil, nil)
+	if err != errECHConfigNotFound {
+		t.Fatalf("expected errECHConfigNotFound, got %v", err)
+	}
+}
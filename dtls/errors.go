@@ -35,11 +35,13 @@ var (
 	errClientCertificateRequired         = &FatalError{Err: errors.New("server required client verification, but got none")}
 	errClientNoMatchingSRTPProfile       = &FatalError{Err: errors.New("server responded with SRTP Profile we do not support")}
 	errClientRequiredButNoServerEMS      = &FatalError{Err: errors.New("client required Extended Master Secret extension, but server does not support it")}
+	errCIDMismatch                       = &FatalError{Err: errors.New("connection ID in incoming record does not match the one negotiated for this connection")}
 	errCookieMismatch                    = &FatalError{Err: errors.New("client+server cookie does not match")}
 	errIdentityNoPSK                     = &FatalError{Err: errors.New("PSK Identity Hint provided but PSK is nil")}
 	errInvalidCertificate                = &FatalError{Err: errors.New("no certificate provided")}
 	errInvalidCipherSuite                = &FatalError{Err: errors.New("invalid or unknown cipher suite")}
 	errInvalidECDSASignature             = &FatalError{Err: errors.New("ECDSA signature contained zero or negative values")}
+	errInvalidHashAlgorithm              = &FatalError{Err: errors.New("invalid hash algorithm")}
 	errInvalidPrivateKey                 = &FatalError{Err: errors.New("invalid private key type")}
 	errInvalidSignatureAlgorithm         = &FatalError{Err: errors.New("invalid signature algorithm")}
 	errKeySignatureMismatch              = &FatalError{Err: errors.New("expected and actual key signature do not match")}
@@ -50,7 +52,9 @@ var (
 	errNoAvailableSignatureSchemes       = &FatalError{Err: errors.New("connection can not be created, no SignatureScheme satisfy this Config")}
 	errNoCertificates                    = &FatalError{Err: errors.New("no certificates configured")}
 	errNoConfigProvided                  = &FatalError{Err: errors.New("no config provided")}
+	errNoCustomClientHelloSpec           = &FatalError{Err: errors.New("ClientHelloID is ClientHelloIDCustom but Config.CustomClientHelloSpec is nil")}
 	errNoSupportedEllipticCurves         = &FatalError{Err: errors.New("client requested zero or more elliptic curves that are not supported by the server")}
+	errUnsupportedCID                    = &FatalError{Err: errors.New("remote party does not support the connection_id extension")}
 	errUnsupportedProtocolVersion        = &FatalError{Err: errors.New("unsupported protocol version")}
 	errPSKAndIdentityMustBeSetForClient  = &FatalError{Err: errors.New("PSK and PSK Identity Hint must both be set for client")}
 	errRequestedButNoSRTPExtension       = &FatalError{Err: errors.New("SRTP support was requested but server did not respond with use_srtp extension")}
@@ -58,6 +62,8 @@ var (
 	errServerRequiredButNoClientEMS      = &FatalError{Err: errors.New("server requires the Extended Master Secret extension, but the client does not support it")}
 	errVerifyDataMismatch                = &FatalError{Err: errors.New("expected and actual verify data does not match")}
 	errNotAcceptableCertificateChain     = &FatalError{Err: errors.New("certificate chain is not signed by an acceptable CA")}
+	errPostHandshakeAuthNotSupported     = &FatalError{Err: errors.New("peer did not advertise post_handshake_auth, refusing to request a post-handshake certificate")}
+	errCertificateRequestContextMismatch = &FatalError{Err: errors.New("post-handshake certificate_request_context does not match the pending request")}
 
 	errInvalidFlight                     = &InternalError{Err: errors.New("invalid flight number")}
 	errKeySignatureGenerateUnimplemented = &InternalError{Err: errors.New("unable to generate key signature, unimplemented")}
@@ -113,17 +119,64 @@ func (e *alertError) Error() string {
 }
 
 func (e *alertError) IsFatalOrCloseNotify() bool {
-	return e.Level == alert.Fatal || e.Description == alert.CloseNotify
+	return e.Alert.Level == alert.Fatal || e.Alert.Description == alert.CloseNotify
 }
 
 func (e *alertError) Is(err error) bool {
 	var other *alertError
 	if errors.As(err, &other) {
-		return e.Level == other.Level && e.Description == other.Description
+		return e.Alert.Level == other.Alert.Level && e.Alert.Description == other.Alert.Description
 	}
 	return false
 }
 
+// AlertError is the exported form of alertError, letting callers outside
+// this package use errors.As to recover the alert that terminated or
+// warned about a connection.
+type AlertError = alertError
+
+// Level returns the severity of the alert (alert.Warning or alert.Fatal).
+func (e *alertError) Level() alert.Level {
+	return e.Alert.Level
+}
+
+// Description returns the alert's description code, e.g. alert.BadCertificate.
+func (e *alertError) Description() alert.Description {
+	return e.Alert.Description
+}
+
+// sentinel alert errors, one per RFC 8446 alert description, so that
+// callers can branch on a specific alert with errors.Is(err, dtls.ErrAlertXxx)
+// instead of string-matching the formatted error.
+var (
+	ErrAlertCloseNotify            = &alertError{&alert.Alert{Level: alert.Warning, Description: alert.CloseNotify}}
+	ErrAlertUnexpectedMessage      = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.UnexpectedMessage}}
+	ErrAlertBadRecordMac           = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.BadRecordMac}}
+	ErrAlertDecryptionFailed       = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.DecryptionFailed}}
+	ErrAlertRecordOverflow         = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.RecordOverflow}}
+	ErrAlertDecompressionFailure   = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.DecompressionFailure}}
+	ErrAlertHandshakeFailure       = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.HandshakeFailure}}
+	ErrAlertNoCertificate          = &alertError{&alert.Alert{Level: alert.Warning, Description: alert.NoCertificate}}
+	ErrAlertBadCertificate         = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.BadCertificate}}
+	ErrAlertUnsupportedCertificate = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.UnsupportedCertificate}}
+	ErrAlertCertificateRevoked     = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.CertificateRevoked}}
+	ErrAlertCertificateExpired     = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.CertificateExpired}}
+	ErrAlertCertificateUnknown     = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.CertificateUnknown}}
+	ErrAlertIllegalParameter       = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.IllegalParameter}}
+	ErrAlertUnknownCA              = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.UnknownCA}}
+	ErrAlertAccessDenied           = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.AccessDenied}}
+	ErrAlertDecodeError            = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.DecodeError}}
+	ErrAlertDecryptError           = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.DecryptError}}
+	ErrAlertExportRestriction      = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.ExportRestriction}}
+	ErrAlertProtocolVersion        = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.ProtocolVersion}}
+	ErrAlertInsufficientSecurity   = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.InsufficientSecurity}}
+	ErrAlertInternalError          = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.InternalError}}
+	ErrAlertUserCanceled           = &alertError{&alert.Alert{Level: alert.Warning, Description: alert.UserCanceled}}
+	ErrAlertNoRenegotiation        = &alertError{&alert.Alert{Level: alert.Warning, Description: alert.NoRenegotiation}}
+	ErrAlertUnsupportedExtension   = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.UnsupportedExtension}}
+	ErrAlertNoApplicationProtocol  = &alertError{&alert.Alert{Level: alert.Fatal, Description: alert.NoApplicationProtocol}}
+)
+
 // netError translates an error from underlying Conn to corresponding net.Error.
 func netError(err error) error {
 	switch {
@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Fingerprint drives a ClientHelloSpec's ordering, GREASE, and padding
+// fields to match a target profile (e.g. "blend into ordinary Chrome
+// WebRTC traffic"), so a caller can rotate between several plausible
+// ClientHello shapes instead of always producing the one, distinctive
+// shape a bare ClientHelloSpec would otherwise leave fixed.
+//
+// Apply takes a *ClientHelloSpec rather than a wire-level ClientHello,
+// for the same reason ClientHelloSpec itself avoids pkg/protocol/
+// extension: that package (and the flight1Generate handshake state that
+// would consume a wire-level hello) is still too incomplete in this fork
+// to target directly. A Fingerprint is therefore a pure, testable policy
+// layer; wiring ClientHelloSpec/Fingerprint output into an actual
+// outgoing ClientHello via Config.ClientHelloMessageHook is future work.
+type Fingerprint interface {
+	// Name returns the ClientHelloID this Fingerprint was registered
+	// under.
+	Name() ClientHelloID
+	// Apply mutates spec in place to match this Fingerprint's profile.
+	Apply(spec *ClientHelloSpec) error
+}
+
+// fingerprints holds the registered Fingerprints addressable by
+// ClientHelloID, mirroring clientHelloSpecs' registry above.
+var fingerprints = map[ClientHelloID]Fingerprint{}
+
+func init() {
+	RegisterFingerprint(presetFingerprint{id: ClientHelloIDFirefox, paddingTarget: 512})
+	RegisterFingerprint(presetFingerprint{id: ClientHelloIDChrome, paddingTarget: 512})
+	RegisterFingerprint(presetFingerprint{id: ClientHelloIDFirefox120, paddingTarget: 512})
+	RegisterFingerprint(presetFingerprint{id: ClientHelloIDChrome120, paddingTarget: 512})
+	RegisterFingerprint(randomizedFingerprint{})
+}
+
+// RegisterFingerprint makes fp available from FingerprintForID under
+// fp.Name(), overwriting any existing registration for that ID. Built-in
+// profiles register themselves this way in init; a caller can do the same
+// to add a profile or replace a built-in one.
+func RegisterFingerprint(fp Fingerprint) {
+	fingerprints[fp.Name()] = fp
+}
+
+// FingerprintForID looks up a registered Fingerprint by ID.
+func FingerprintForID(id ClientHelloID) (fp Fingerprint, ok bool) {
+	fp, ok = fingerprints[id]
+	return fp, ok
+}
+
+// presetFingerprint applies one of clientHelloSpecs' fixed browser
+// profiles, plus GREASE and a padding target, so picking e.g.
+// ClientHelloIDChrome doesn't also require separately remembering to turn
+// GREASE and padding on.
+type presetFingerprint struct {
+	id            ClientHelloID
+	paddingTarget int
+}
+
+func (p presetFingerprint) Name() ClientHelloID { return p.id }
+
+func (p presetFingerprint) Apply(spec *ClientHelloSpec) error {
+	preset, ok := ClientHelloSpecForID(p.id)
+	if !ok {
+		return fmt.Errorf("dtls: no preset ClientHelloSpec registered for %s", p.id)
+	}
+	spec.CipherSuites = preset.CipherSuites
+	spec.ExtensionOrder = preset.ExtensionOrder
+	spec.GroupOrder = preset.GroupOrder
+	spec.GREASE = true
+	spec.PaddingTarget = p.paddingTarget
+	return nil
+}
+
+// randomizedFingerprint shuffles whatever cipher suites, extensions, and
+// groups are already on spec from crypto/rand, rather than following a
+// fixed browser profile, per ClientHelloIDRandomized.
+type randomizedFingerprint struct{}
+
+func (randomizedFingerprint) Name() ClientHelloID { return ClientHelloIDRandomized }
+
+func (randomizedFingerprint) Apply(spec *ClientHelloSpec) error {
+	suites := append([]CipherSuiteID(nil), spec.CipherSuites...)
+	if err := shuffleCipherSuites(suites); err != nil {
+		return err
+	}
+	spec.CipherSuites = suites
+
+	extensions := append([]uint16(nil), spec.ExtensionOrder...)
+	if err := shuffleUint16s(extensions); err != nil {
+		return err
+	}
+	spec.ExtensionOrder = extensions
+
+	groups := append([]Group(nil), spec.GroupOrder...)
+	if err := shuffleGroups(groups); err != nil {
+		return err
+	}
+	spec.GroupOrder = groups
+
+	spec.GREASE = true
+	return nil
+}
+
+// greaseValues are the sixteen RFC 8701 reserved values of the form
+// 0x?A?A: placeholder cipher suites, extension types, supported-group
+// IDs, and version numbers that a compliant peer must ignore. Injecting
+// one into each list on every connection means a real implementation's
+// "ignore unrecognized value" path is always exercised, instead of that
+// path itself being a fingerprinting signal.
+var greaseValues = [...]uint16{
+	0x0a0a, 0x1a1a, 0x2a2a, 0x3a3a,
+	0x4a4a, 0x5a5a, 0x6a6a, 0x7a7a,
+	0x8a8a, 0x9a9a, 0xaaaa, 0xbaba,
+	0xcaca, 0xdada, 0xeaea, 0xfafa,
+}
+
+// randGREASEValue picks a uniformly random entry from greaseValues using
+// crypto/rand, so consecutive connections don't all GREASE with the same
+// value.
+func randGREASEValue() (uint16, error) {
+	var b [1]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return greaseValues[int(b[0])%len(greaseValues)], nil
+}
+
+// randIndex returns a uniformly random index in [0, n) using crypto/rand.
+// n must be > 0.
+func randIndex(n int) (int, error) {
+	var b [1]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int(b[0]) % n, nil
+}
+
+// InjectGREASECipherSuite returns a copy of suites with a random GREASE
+// value inserted at a random position, formatted as a CipherSuiteID.
+func InjectGREASECipherSuite(suites []CipherSuiteID) ([]CipherSuiteID, error) {
+	v, err := randGREASEValue()
+	if err != nil {
+		return nil, err
+	}
+	pos, err := randIndex(len(suites) + 1)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CipherSuiteID, 0, len(suites)+1)
+	out = append(out, suites[:pos]...)
+	out = append(out, CipherSuiteID(v))
+	out = append(out, suites[pos:]...)
+	return out, nil
+}
+
+// InjectGREASEExtension returns a copy of order with a random GREASE
+// value inserted at a random position, except as the very first entry:
+// RFC 8701 recommends against that position, since some real
+// implementations special-case it (e.g. treating the first extension as
+// a protocol version signal).
+func InjectGREASEExtension(order []uint16) ([]uint16, error) {
+	v, err := randGREASEValue()
+	if err != nil {
+		return nil, err
+	}
+	pos := 0
+	if len(order) > 0 {
+		idx, err := randIndex(len(order))
+		if err != nil {
+			return nil, err
+		}
+		pos = idx + 1
+	}
+	out := make([]uint16, 0, len(order)+1)
+	out = append(out, order[:pos]...)
+	out = append(out, v)
+	out = append(out, order[pos:]...)
+	return out, nil
+}
+
+// InjectGREASEGroup returns a copy of groups with a random GREASE value
+// inserted at a random position, formatted as a Group.
+func InjectGREASEGroup(groups []Group) ([]Group, error) {
+	v, err := randGREASEValue()
+	if err != nil {
+		return nil, err
+	}
+	pos, err := randIndex(len(groups) + 1)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Group, 0, len(groups)+1)
+	out = append(out, groups[:pos]...)
+	out = append(out, Group(v))
+	out = append(out, groups[pos:]...)
+	return out, nil
+}
+
+// PaddingSize returns the number of bytes a padding extension (RFC 7685)
+// needs to carry to round a ClientHello of helloLen bytes (not counting
+// the padding extension itself) up to target bytes. It returns 0 if
+// target is not larger than the 4-byte padding extension header plus
+// helloLen, since padding can't make a message shorter.
+func PaddingSize(helloLen, target int) int {
+	const extensionHeaderSize = 4
+	need := target - helloLen - extensionHeaderSize
+	if need < 0 {
+		return 0
+	}
+	return need
+}
+
+// shuffleCipherSuites Fisher-Yates shuffles suites in place using
+// crypto/rand.
+func shuffleCipherSuites(suites []CipherSuiteID) error {
+	for i := len(suites) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return err
+		}
+		suites[i], suites[j] = suites[j], suites[i]
+	}
+	return nil
+}
+
+// shuffleUint16s Fisher-Yates shuffles vals in place using crypto/rand.
+func shuffleUint16s(vals []uint16) error {
+	for i := len(vals) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return err
+		}
+		vals[i], vals[j] = vals[j], vals[i]
+	}
+	return nil
+}
+
+// shuffleGroups Fisher-Yates shuffles groups in place using crypto/rand.
+func shuffleGroups(groups []Group) error {
+	for i := len(groups) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return err
+		}
+		groups[i], groups[j] = groups[j], groups[i]
+	}
+	return nil
+}
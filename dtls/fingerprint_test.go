@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"testing"
+)
+
+func TestFingerprintForID(t *testing.T) {
+	if _, ok := FingerprintForID(ClientHelloIDChrome); !ok {
+		t.Fatal("expected a registered Fingerprint for ClientHelloIDChrome")
+	}
+	if _, ok := FingerprintForID(ClientHelloIDRandomized); !ok {
+		t.Fatal("expected a registered Fingerprint for ClientHelloIDRandomized")
+	}
+	if _, ok := FingerprintForID(ClientHelloID("unknown")); ok {
+		t.Fatal("expected no Fingerprint for an unknown ClientHelloID")
+	}
+}
+
+func TestPresetFingerprintApply(t *testing.T) {
+	fp, ok := FingerprintForID(ClientHelloIDFirefox)
+	if !ok {
+		t.Fatal("expected a registered Fingerprint for ClientHelloIDFirefox")
+	}
+
+	spec := &ClientHelloSpec{}
+	if err := fp.Apply(spec); err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+
+	preset, _ := ClientHelloSpecForID(ClientHelloIDFirefox)
+	if len(spec.CipherSuites) != len(preset.CipherSuites) {
+		t.Fatalf("CipherSuites = %v, want %v", spec.CipherSuites, preset.CipherSuites)
+	}
+	if !spec.GREASE {
+		t.Fatal("expected GREASE to be enabled by the preset Fingerprint")
+	}
+	if spec.PaddingTarget == 0 {
+		t.Fatal("expected a nonzero PaddingTarget from the preset Fingerprint")
+	}
+}
+
+func TestRandomizedFingerprintApplyPreservesElements(t *testing.T) {
+	fp, ok := FingerprintForID(ClientHelloIDRandomized)
+	if !ok {
+		t.Fatal("expected a registered Fingerprint for ClientHelloIDRandomized")
+	}
+
+	spec := &ClientHelloSpec{
+		CipherSuites:   []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, TLS_PSK_WITH_AES_128_GCM_SHA256},
+		ExtensionOrder: []uint16{extensionTypeServerName, extensionTypeALPN, extensionTypeUseSRTP},
+		GroupOrder:     []Group{GroupX25519, GroupSecp256r1},
+	}
+
+	if err := fp.Apply(spec); err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+
+	if len(spec.CipherSuites) != 2 {
+		t.Fatalf("CipherSuites length = %d, want 2", len(spec.CipherSuites))
+	}
+	if len(spec.ExtensionOrder) != 3 {
+		t.Fatalf("ExtensionOrder length = %d, want 3", len(spec.ExtensionOrder))
+	}
+	if len(spec.GroupOrder) != 2 {
+		t.Fatalf("GroupOrder length = %d, want 2", len(spec.GroupOrder))
+	}
+	if !spec.GREASE {
+		t.Fatal("expected GREASE to be enabled by the randomized Fingerprint")
+	}
+}
+
+func TestOrderGroups(t *testing.T) {
+	spec := &ClientHelloSpec{
+		GroupOrder: []Group{GroupSecp256r1, GroupX25519},
+	}
+
+	got := spec.OrderGroups([]Group{GroupX25519, GroupSecp384r1, GroupSecp256r1})
+	want := []Group{GroupSecp256r1, GroupX25519, GroupSecp384r1}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("OrderGroups() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestInjectGREASECipherSuite(t *testing.T) {
+	suites := []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	got, err := InjectGREASECipherSuite(suites)
+	if err != nil {
+		t.Fatalf("InjectGREASECipherSuite() = %v", err)
+	}
+	if len(got) != len(suites)+1 {
+		t.Fatalf("len(got) = %d, want %d", len(got), len(suites)+1)
+	}
+	var sawGrease bool
+	for _, id := range got {
+		if isGREASEValue(uint16(id)) {
+			sawGrease = true
+		}
+	}
+	if !sawGrease {
+		t.Fatalf("expected a GREASE value in %v", got)
+	}
+}
+
+func TestInjectGREASEExtensionNeverFirst(t *testing.T) {
+	order := []uint16{extensionTypeServerName, extensionTypeALPN, extensionTypeUseSRTP}
+	for i := 0; i < 50; i++ {
+		got, err := InjectGREASEExtension(order)
+		if err != nil {
+			t.Fatalf("InjectGREASEExtension() = %v", err)
+		}
+		if isGREASEValue(got[0]) {
+			t.Fatalf("GREASE extension landed first in %v", got)
+		}
+	}
+}
+
+func TestInjectGREASEGroup(t *testing.T) {
+	groups := []Group{GroupX25519}
+	got, err := InjectGREASEGroup(groups)
+	if err != nil {
+		t.Fatalf("InjectGREASEGroup() = %v", err)
+	}
+	if len(got) != len(groups)+1 {
+		t.Fatalf("len(got) = %d, want %d", len(got), len(groups)+1)
+	}
+}
+
+func TestPaddingSize(t *testing.T) {
+	tests := []struct {
+		helloLen, target, want int
+	}{
+		{100, 512, 408},
+		{512, 512, 0},
+		{600, 512, 0},
+	}
+	for _, tt := range tests {
+		if got := PaddingSize(tt.helloLen, tt.target); got != tt.want {
+			t.Fatalf("PaddingSize(%d, %d) = %d, want %d", tt.helloLen, tt.target, got, tt.want)
+		}
+	}
+}
+
+func isGREASEValue(v uint16) bool {
+	for _, g := range greaseValues {
+		if g == v {
+			return true
+		}
+	}
+	return false
+}
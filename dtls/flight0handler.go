@@ -124,6 +124,13 @@ func handleHelloResume(
 	cfg *handshakeConfig,
 	next flightVal,
 ) (flightVal, *alert.Alert, error) {
+	// Resuming a session skips re-verifying the client certificate, so a
+	// server that requires one must force a full handshake instead of
+	// trusting a session negotiated before (or without) that requirement.
+	if cfg.peerCertDisablesSessionResumption && cfg.clientAuth != NoClientCert {
+		return next, nil, nil
+	}
+
 	if len(sessionID) > 0 && cfg.sessionStore != nil {
 		if s, err := cfg.sessionStore.Get(sessionID); err != nil {
 			return 0, &alert.Alert{Level: alert.Fatal, Description: alert.InternalError}, err
@@ -164,7 +171,7 @@ func flight0Generate(
 	var zeroEpoch uint16
 	state.localEpoch.Store(zeroEpoch)
 	state.remoteEpoch.Store(zeroEpoch)
-	state.namedCurve = defaultNamedCurve
+	state.namedCurve = elliptic.X25519
 
 	if err := state.localRandom.Populate(); err != nil {
 		return nil, nil, err
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"hash"
+	"sort"
+	"sync"
+
+	"github.com/pion/dtls/v3/pkg/protocol/handshake"
+)
+
+// handshakeCacheItem is one handshake message flight{0,1,3,5}handler.go has
+// sent or received, kept around so later flights can rebuild the exact
+// transcript bytes a Finished or CertificateVerify needs to hash.
+type handshakeCacheItem struct {
+	typ             handshake.Type
+	isClient        bool
+	epoch           uint16
+	messageSequence uint16
+	data            []byte
+}
+
+// handshakeCachePullRule selects one handshakeCacheItem out of a
+// handshakeCache: the item whose typ, epoch, and isClient all match. See
+// handshakeCache.pullAndMerge.
+type handshakeCachePullRule struct {
+	typ      handshake.Type
+	epoch    uint16
+	isClient bool
+	optional bool
+}
+
+// handshakeCache collects every handshake message sent or received over the
+// lifetime of a Conn, in push order, so flight handlers can later pull out
+// an exact, ordered transcript (see pullAndMerge) or fold the whole
+// transcript into a session hash (see sessionHash) without having to keep
+// the raw flight data around themselves.
+type handshakeCache struct {
+	mu    sync.Mutex
+	cache []*handshakeCacheItem
+}
+
+func newHandshakeCache() *handshakeCache {
+	return &handshakeCache{}
+}
+
+// push appends data to the cache under the given epoch, messageSequence,
+// typ and isClient, unless an item with the same messageSequence and
+// isClient has already been pushed -- a retransmitted flight re-pushes the
+// same messageSequence, and only the first copy should count toward the
+// transcript.
+func (h *handshakeCache) push(data []byte, epoch, messageSequence uint16, typ handshake.Type, isClient bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, i := range h.cache {
+		if i.messageSequence == messageSequence && i.isClient == isClient {
+			return false
+		}
+	}
+
+	h.cache = append(h.cache, &handshakeCacheItem{
+		typ:             typ,
+		isClient:        isClient,
+		epoch:           epoch,
+		messageSequence: messageSequence,
+		data:            append([]byte{}, data...),
+	})
+
+	return true
+}
+
+// pullAndMerge concatenates the data of the items pullAndMerge's rules
+// select, in rule order: for each rule, the first pushed item whose typ,
+// epoch and isClient all match. A rule with no matching item contributes
+// nothing, whether or not it is marked optional -- optional exists so a
+// caller building the rule list can record, for its own reference, which
+// messages aren't always present (e.g. CertificateRequest).
+func (h *handshakeCache) pullAndMerge(rules ...handshakeCachePullRule) []byte {
+	merged := []byte{}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, r := range rules {
+		for _, i := range h.cache {
+			if i.typ == r.typ && i.isClient == r.isClient && i.epoch == r.epoch {
+				merged = append(merged, i.data...)
+
+				break
+			}
+		}
+	}
+
+	return merged
+}
+
+// sessionHash folds every item pushed under epoch into a single digest with
+// hf, ordered by messageSequence rather than push order, for
+// ExtendedMasterSecret's session_hash (RFC 7627) and similar transcript
+// hashes. CertificateVerify and Finished messages are always excluded: by
+// the time either is sent, its own contents can't be part of the hash it
+// is itself computed over or verified against.
+func (h *handshakeCache) sessionHash(hf func() hash.Hash, epoch uint16) ([]byte, error) {
+	h.mu.Lock()
+	cache := make([]*handshakeCacheItem, len(h.cache))
+	copy(cache, h.cache)
+	h.mu.Unlock()
+
+	sort.SliceStable(cache, func(i, j int) bool {
+		return cache[i].messageSequence < cache[j].messageSequence
+	})
+
+	hasher := hf()
+	for _, i := range cache {
+		if i.epoch != epoch {
+			continue
+		}
+		if i.typ == handshake.TypeCertificateVerify || i.typ == handshake.TypeFinished {
+			continue
+		}
+		if _, err := hasher.Write(i.data); err != nil {
+			return nil, err
+		}
+	}
+
+	return hasher.Sum(nil), nil
+}
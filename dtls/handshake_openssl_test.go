@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+)
+
+// updateOpenSSLGoldenEnv, when set to "1", makes the opensslInterop cases
+// spawn a real openssl subprocess and overwrite their golden transcript
+// instead of only replaying it. This mirrors the opensslInputEvent update
+// mode in Go's crypto/tls tree.
+const updateOpenSSLGoldenEnv = "PION_DTLS_UPDATE_OPENSSL"
+
+// opensslPacket is one recorded UDP datagram in an interop transcript.
+// Direction is "send" for datagrams we sent to the OpenSSL peer and "recv"
+// for datagrams we received from it; golden files are newline-delimited
+// JSON so that diffs on update stay readable.
+type opensslPacket struct {
+	Direction string `json:"direction"`
+	Data      string `json:"data"`
+}
+
+// recordingPacketConn wraps a net.PacketConn, appending every datagram it
+// sees to packets so a live handshake against an OpenSSL subprocess can be
+// saved as a golden transcript for future offline replay/inspection.
+type recordingPacketConn struct {
+	net.PacketConn
+	packets *[]opensslPacket
+}
+
+func (c *recordingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if n > 0 {
+		*c.packets = append(*c.packets, opensslPacket{
+			Direction: "recv",
+			Data:      base64.StdEncoding.EncodeToString(p[:n]),
+		})
+	}
+	return n, addr, err
+}
+
+func (c *recordingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if n > 0 {
+		*c.packets = append(*c.packets, opensslPacket{
+			Direction: "send",
+			Data:      base64.StdEncoding.EncodeToString(p[:n]),
+		})
+	}
+	return n, err
+}
+
+func writeGoldenTranscript(path string, packets []opensslPacket) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, pkt := range packets {
+		if err := enc.Encode(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readGoldenTranscript(path string) ([]opensslPacket, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var packets []opensslPacket
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var pkt opensslPacket
+		if err := dec.Decode(&pkt); err != nil {
+			return nil, err
+		}
+		packets = append(packets, pkt)
+	}
+	return packets, nil
+}
+
+// opensslInteropCase is one handshake configuration exercised against a real
+// openssl s_server/s_client subprocess.
+type opensslInteropCase struct {
+	name        string
+	goldenFile  string
+	opensslArgs []string // extra args appended to "openssl s_server -dtls1_2 -quiet"
+	clientConf  func() *Config
+}
+
+// Only ECDHE_ECDSA and PSK cipher suites are implemented in this fork
+// snapshot (see cipher_suite.go); an ECDHE_RSA case is intentionally omitted
+// rather than asserted against a suite this package cannot negotiate.
+var opensslInteropCases = []opensslInteropCase{
+	{
+		name:        "ECDHE_ECDSA",
+		goldenFile:  "ecdhe_ecdsa.golden",
+		opensslArgs: []string{"-cipher", "ECDHE-ECDSA-AES256-GCM-SHA384"},
+		clientConf: func() *Config {
+			return &Config{
+				CipherSuites:       []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+				InsecureSkipVerify: true,
+			}
+		},
+	},
+	{
+		name:        "PSK",
+		goldenFile:  "psk.golden",
+		opensslArgs: []string{"-psk", "0011223344556677", "-cipher", "PSK-AES128-GCM-SHA256"},
+		clientConf: func() *Config {
+			return &Config{
+				CipherSuites: []CipherSuiteID{TLS_PSK_WITH_AES_128_GCM_SHA256},
+				PSK: func([]byte) ([]byte, error) {
+					return []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77}, nil
+				},
+				PSKIdentityHint: []byte("pion-dtls-interop"),
+			}
+		},
+	},
+	{
+		name:        "SRTP",
+		goldenFile:  "srtp.golden",
+		opensslArgs: []string{"-cipher", "ECDHE-ECDSA-AES256-GCM-SHA384", "-use_srtp", "SRTP_AES128_CM_SHA1_80"},
+		clientConf: func() *Config {
+			return &Config{
+				CipherSuites:           []CipherSuiteID{TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+				SRTPProtectionProfiles: []SRTPProtectionProfile{SRTP_AES128_CM_HMAC_SHA1_80},
+				InsecureSkipVerify:     true,
+			}
+		},
+	},
+}
+
+// TestOpenSSLInterop drives our Client against an "openssl s_server"
+// subprocess, recording the UDP transcript to testdata/ when
+// PION_DTLS_UPDATE_OPENSSL=1 is set and OpenSSL is installed, and otherwise
+// only asserting that a previously recorded transcript is present and well
+// formed (a full crypto replay of a captured handshake would need either a
+// deterministic RNG or baked-in key material, which this harness does not
+// attempt -- its purpose is catching wire-format regressions at record time,
+// same as the reference run this mirrors in Go's crypto/tls tree).
+func TestOpenSSLInterop(t *testing.T) {
+	for _, c := range opensslInteropCases {
+		t.Run(c.name, func(t *testing.T) {
+			goldenPath := filepath.Join("testdata", "openssl", c.goldenFile)
+
+			if os.Getenv(updateOpenSSLGoldenEnv) != "1" {
+				packets, err := readGoldenTranscript(goldenPath)
+				if err != nil {
+					t.Skipf("golden transcript not recorded in this environment (%v); "+
+						"run with %s=1 and an OpenSSL install to generate it", err, updateOpenSSLGoldenEnv)
+				}
+				if len(packets) == 0 {
+					t.Fatalf("golden transcript %s is empty", goldenPath)
+				}
+				return
+			}
+
+			opensslPath, err := exec.LookPath("openssl")
+			if err != nil {
+				t.Skipf("openssl not found in PATH: %v", err)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			packets, err := recordOpenSSLInterop(t, opensslPath, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeGoldenTranscript(goldenPath, packets); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// recordOpenSSLInterop spawns "openssl s_server" bound to an ephemeral UDP
+// port, drives our Client against it, and returns the recorded transcript.
+func recordOpenSSLInterop(t *testing.T, opensslPath string, c opensslInteropCase) ([]opensslPacket, error) {
+	t.Helper()
+
+	serverCert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		return nil, err
+	}
+	certFile, keyFile, err := writeTempCertAndKey(t, serverCert)
+	if err != nil {
+		return nil, err
+	}
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	serverPort := udpConn.LocalAddr().(*net.UDPAddr).Port
+	udpConn.Close()
+
+	args := append([]string{
+		"s_server", "-dtls1_2", "-quiet",
+		"-accept", net.JoinHostPort("127.0.0.1", strconv.Itoa(serverPort)),
+		"-cert", certFile, "-key", keyFile,
+	}, c.opensslArgs...)
+
+	cmd := exec.Command(opensslPath, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+
+	// Give openssl a moment to bind its listening socket before we dial.
+	time.Sleep(200 * time.Millisecond)
+
+	clientConn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: serverPort})
+	if err != nil {
+		return nil, err
+	}
+	defer clientConn.Close()
+
+	var packets []opensslPacket
+	recorder := &recordingPacketConn{PacketConn: clientConn, packets: &packets}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := Client(recorder, clientConn.RemoteAddr(), c.clientConf())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return packets, nil
+}
+
+// writeTempCertAndKey PEM-encodes cert for consumption by openssl's
+// "-cert"/"-key" flags, which expect file paths rather than in-memory DER.
+func writeTempCertAndKey(t *testing.T, cert tls.Certificate) (certFile, keyFile string, err error) {
+	t.Helper()
+	dir := t.TempDir()
+
+	certFile = filepath.Join(dir, "cert.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		return "", "", err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+	keyFile = filepath.Join(dir, "key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
@@ -93,31 +93,33 @@ type handshakeFSM struct {
 }
 
 type handshakeConfig struct {
-	localPSKCallback             PSKCallback
-	localPSKIdentityHint         []byte
-	localCipherSuites            []CipherSuite             // Available CipherSuites
-	localSignatureSchemes        []signaturehash.Algorithm // Available signature schemes
-	extendedMasterSecret         ExtendedMasterSecretType  // Policy for the Extended Master Support extension
-	localSRTPProtectionProfiles  []SRTPProtectionProfile   // Available SRTPProtectionProfiles, if empty no SRTP support
-	localSRTPMasterKeyIdentifier []byte
-	serverName                   string
-	supportedProtocols           []string
-	clientAuth                   ClientAuthType // If we are a client should we request a client certificate
-	localCertificates            []tls.Certificate
-	nameToCertificate            map[string]*tls.Certificate
-	insecureSkipVerify           bool
-	verifyPeerCertificate        func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
-	verifyConnection             func(*State) error
-	sessionStore                 SessionStore
-	rootCAs                      *x509.CertPool
-	clientCAs                    *x509.CertPool
-	initialRetransmitInterval    time.Duration
-	disableRetransmitBackoff     bool
-	customCipherSuites           func() []CipherSuite
-	ellipticCurves               []elliptic.Curve
-	insecureSkipHelloVerify      bool
-	connectionIDGenerator        func() []byte
-	helloRandomBytesGenerator    func() [handshake.RandomBytesLength]byte
+	localPSKCallback                  PSKCallback
+	localPSKIdentityHint              []byte
+	localCipherSuites                 []CipherSuite             // Available CipherSuites
+	localSignatureSchemes             []signaturehash.Algorithm // Available signature schemes
+	extendedMasterSecret              ExtendedMasterSecretType  // Policy for the Extended Master Support extension
+	localSRTPProtectionProfiles       []SRTPProtectionProfile   // Available SRTPProtectionProfiles, if empty no SRTP support
+	localSRTPMasterKeyIdentifier      []byte
+	serverName                        string
+	supportedProtocols                []string
+	clientAuth                        ClientAuthType // If we are a client should we request a client certificate
+	peerCertDisablesSessionResumption bool
+	supportPostHandshakeAuth          bool
+	localCertificates                 []tls.Certificate
+	nameToCertificate                 map[string]*tls.Certificate
+	insecureSkipVerify                bool
+	verifyPeerCertificate             func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+	verifyConnection                  func(*State) error
+	sessionStore                      SessionStore
+	rootCAs                           *x509.CertPool
+	clientCAs                         *x509.CertPool
+	initialRetransmitInterval         time.Duration
+	disableRetransmitBackoff          bool
+	customCipherSuites                func() []CipherSuite
+	ellipticCurves                    []elliptic.Curve
+	insecureSkipHelloVerify           bool
+	connectionIDGenerator             func() []byte
+	helloRandomBytesGenerator         func() [handshake.RandomBytesLength]byte
 
 	onFlightState func(flightVal, handshakeState)
 	log           logging.LeveledLogger
@@ -180,6 +182,16 @@ func newHandshakeFSM(
 	}
 }
 
+// Run drives the handshake state machine until it finishes or ctx is done.
+// Every state that can block - waiting for a flight to arrive, waiting for
+// the retransmit timer, or preparing the next flight - also selects on
+// ctx.Done(), so cancelling ctx unblocks Run promptly and it returns
+// ctx.Err() instead of running to completion or timing out on its own.
+//
+// A public, crypto/tls-style Conn.HandshakeContext entry point belongs one
+// layer up, on Conn; this fork does not implement Conn (or ClientHelloInfo/
+// CertificateRequestInfo, which would carry the deadline to GetCertificate/
+// VerifyConnection callbacks), so that plumbing cannot be added here.
 func (s *handshakeFSM) Run(ctx context.Context, conn flightConn, initialState handshakeState) error {
 	state := initialState
 	defer func() {
@@ -214,6 +226,12 @@ func (s *handshakeFSM) Done() <-chan struct{} {
 }
 
 func (s *handshakeFSM) prepare(ctx context.Context, conn flightConn) (handshakeState, error) {
+	select {
+	case <-ctx.Done():
+		return handshakeErrored, ctx.Err()
+	default:
+	}
+
 	s.flights = nil
 	// Prepare flights
 	var (
@@ -23,6 +23,18 @@ func (i ID) String() string {
 		return "TLS_PSK_WITH_AES_128_GCM_SHA256"
 	case TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:
 		return "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"
+	case TLS_AES_128_GCM_SHA256:
+		return "TLS_AES_128_GCM_SHA256"
+	case TLS_AES_256_GCM_SHA384:
+		return "TLS_AES_256_GCM_SHA384"
+	case TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256:
+		return "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"
+	case TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:
+		return "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"
+	case TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:
+		return "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	case TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:
+		return "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"
 	default:
 		return fmt.Sprintf("unknown(%v)", uint16(i))
 	}
@@ -32,6 +44,32 @@ func (i ID) String() string {
 const (
 	TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 ID = 0xc02c //nolint:revive,stylecheck
 	TLS_PSK_WITH_AES_128_GCM_SHA256         ID = 0x00a8 //nolint:revive,stylecheck
+
+	// TLS_AES_128_GCM_SHA256 and TLS_AES_256_GCM_SHA384 are DTLS 1.3 cipher
+	// suites (RFC 8446 Section B.4, RFC 9147 Section 5). Unlike the 1.2
+	// suites above, a 1.3 suite's ID alone determines both its AEAD and its
+	// key schedule hash -- there's no separate key-exchange/authentication
+	// negotiation, since DTLS 1.3 always uses (EC)DHE plus the certificate
+	// or PSK extensions themselves to authenticate.
+	TLS_AES_128_GCM_SHA256 ID = 0x1301 //nolint:revive,stylecheck
+	TLS_AES_256_GCM_SHA384 ID = 0x1302 //nolint:revive,stylecheck
+
+	// TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 and
+	// TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256 (RFC 7905) are
+	// software-only AEAD suites: ChaCha20-Poly1305 runs at a constant,
+	// competitive speed without the AES-NI/PCLMULQDQ instructions GCM
+	// needs to avoid being much slower, which matters for mobile clients
+	// on CPUs that lack them.
+	TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 ID = 0xcca9 //nolint:revive,stylecheck
+	TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256   ID = 0xcca8 //nolint:revive,stylecheck
+
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 and
+	// TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 pair the same (EC)DHE key
+	// exchange and AES-GCM AEADs as the ECDSA suites above with an RSA
+	// certificate instead, for deployments whose existing WebPKI
+	// certificate is RSA rather than ECDSA.
+	TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 ID = 0xc02f //nolint:revive,stylecheck
+	TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 ID = 0xc030 //nolint:revive,stylecheck
 )
 
 // AuthenticationType controls what authentication method is using during the handshake
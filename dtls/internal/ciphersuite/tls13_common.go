@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ciphersuite
+
+import (
+	"crypto"
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/dtls/v2/pkg/protocol"
+	"golang.org/x/crypto/hkdf"
+)
+
+// errDTLS13RequiresInit13 is returned by a DTLS 1.3 CipherSuite's Init,
+// which exists only to satisfy the CipherSuite interface: 1.3 suites are
+// keyed from independent client/server traffic secrets rather than a
+// single master secret plus client/server randoms (the DTLS 1.2 shape
+// Init's parameters assume), so they're initialized through Init13 instead.
+var errDTLS13RequiresInit13 = &protocol.TemporaryError{ //nolint:revive
+	Err: errors.New("DTLS 1.3 cipher suite requires Init13, not Init"),
+}
+
+// hkdfExpandLabel13 implements the HKDF-Expand-Label construction (RFC 8446
+// Section 7.1), reused from the traffic secret down to the record
+// protection key and IV (RFC 8446 Section 7.3) the same way it's used
+// earlier in the key schedule (see the parent dtls package's
+// keyschedule13.go, which derives the traffic secrets this function
+// consumes). HkdfLabel's context is the empty string for "key"/"iv".
+func hkdfExpandLabel13(hash crypto.Hash, secret []byte, label string, length int) ([]byte, error) {
+	var hkdfLabel []byte
+	hkdfLabel = binary.BigEndian.AppendUint16(hkdfLabel, uint16(length))
+
+	fullLabel := "tls13 " + label
+	hkdfLabel = append(hkdfLabel, byte(len(fullLabel)))
+	hkdfLabel = append(hkdfLabel, fullLabel...)
+	hkdfLabel = append(hkdfLabel, 0) // empty context
+
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(hash.New, secret, hkdfLabel).Read(out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// trafficKeyAndIV derives the AEAD key and IV for one traffic secret (RFC
+// 8446 Section 7.3's "key" and "iv" labels), the final key-schedule step
+// before a DTLS 1.3 epoch can encrypt or decrypt records.
+func trafficKeyAndIV(hash crypto.Hash, trafficSecret []byte, keyLen, ivLen int) (key, iv []byte, err error) {
+	key, err = hkdfExpandLabel13(hash, trafficSecret, "key", keyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iv, err = hkdfExpandLabel13(hash, trafficSecret, "iv", ivLen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, iv, nil
+}
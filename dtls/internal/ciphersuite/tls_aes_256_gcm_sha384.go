@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ciphersuite
+
+import (
+	"crypto"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sync/atomic"
+
+	"github.com/pion/dtls/v2/pkg/crypto/ciphersuite"
+	"github.com/pion/dtls/v2/pkg/crypto/clientcertificate"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+)
+
+// TLSAes256GcmSha384 represents the DTLS 1.3 TLS_AES_256_GCM_SHA384 cipher
+// suite (RFC 8446 Section B.4): AES-256-GCM record protection keyed from
+// the HKDF-based DTLS 1.3 key schedule instead of DTLS 1.2's PRF.
+type TLSAes256GcmSha384 struct {
+	gcm atomic.Value // *ciphersuite.GCM
+}
+
+// CertificateType returns what type of certificate this CipherSuite
+// exchanges. See TLSAes128GcmSha256.CertificateType for why this fork
+// still ties a DTLS 1.3 suite to one.
+func (c *TLSAes256GcmSha384) CertificateType() clientcertificate.Type {
+	return clientcertificate.ECDSASign
+}
+
+// KeyExchangeAlgorithm controls what key exchange algorithm is using during the handshake
+func (c *TLSAes256GcmSha384) KeyExchangeAlgorithm() KeyExchangeAlgorithm {
+	return KeyExchangeAlgorithmEcdhe
+}
+
+// ECC uses Elliptic Curve Cryptography
+func (c *TLSAes256GcmSha384) ECC() bool {
+	return true
+}
+
+// ID returns the ID of the CipherSuite
+func (c *TLSAes256GcmSha384) ID() ID {
+	return TLS_AES_256_GCM_SHA384
+}
+
+func (c *TLSAes256GcmSha384) String() string {
+	return "TLS_AES_256_GCM_SHA384"
+}
+
+// HashFunc returns the hashing func for this CipherSuite
+func (c *TLSAes256GcmSha384) HashFunc() func() hash.Hash {
+	return sha512.New384
+}
+
+// AuthenticationType controls what authentication method is using during the handshake
+func (c *TLSAes256GcmSha384) AuthenticationType() AuthenticationType {
+	return AuthenticationTypeCertificate
+}
+
+// IsPSK reports whether this CipherSuite requires a pre-shared key
+func (c *TLSAes256GcmSha384) IsPSK() bool {
+	return false
+}
+
+// Init satisfies the CipherSuite interface but always fails; see
+// TLSAes128GcmSha256.Init.
+func (c *TLSAes256GcmSha384) Init(masterSecret, clientRandom, serverRandom []byte, isClient bool) error {
+	return errDTLS13RequiresInit13
+}
+
+// Init13 initializes the cipher from this epoch's already-derived
+// client/server traffic secrets; see TLSAes128GcmSha256.Init13.
+func (c *TLSAes256GcmSha384) Init13(clientTrafficSecret, serverTrafficSecret []byte, isClient bool) error {
+	const (
+		keyLen = 32 // AES-256
+		ivLen  = 12 // GCM nonce length
+	)
+
+	clientKey, clientIV, err := trafficKeyAndIV(crypto.SHA384, clientTrafficSecret, keyLen, ivLen)
+	if err != nil {
+		return err
+	}
+	serverKey, serverIV, err := trafficKeyAndIV(crypto.SHA384, serverTrafficSecret, keyLen, ivLen)
+	if err != nil {
+		return err
+	}
+
+	var gcm *ciphersuite.GCM
+	if isClient {
+		gcm, err = ciphersuite.NewGCM(clientKey, clientIV, serverKey, serverIV)
+	} else {
+		gcm, err = ciphersuite.NewGCM(serverKey, serverIV, clientKey, clientIV)
+	}
+	c.gcm.Store(gcm)
+
+	return err
+}
+
+// IsInitialized returns if the CipherSuite has keying material and can
+// encrypt/decrypt packets
+func (c *TLSAes256GcmSha384) IsInitialized() bool {
+	return c.gcm.Load() != nil
+}
+
+// Encrypt encrypts a single TLS RecordLayer
+func (c *TLSAes256GcmSha384) Encrypt(pkt *recordlayer.RecordLayer, raw []byte) ([]byte, error) {
+	cipherSuite, ok := c.gcm.Load().(*ciphersuite.GCM)
+	if !ok {
+		return nil, fmt.Errorf("%w, unable to encrypt", errCipherSuiteNotInit)
+	}
+
+	return cipherSuite.Encrypt(pkt, raw)
+}
+
+// Decrypt decrypts a single TLS RecordLayer
+func (c *TLSAes256GcmSha384) Decrypt(h recordlayer.Header, in []byte) ([]byte, error) {
+	cipherSuite, ok := c.gcm.Load().(*ciphersuite.GCM)
+	if !ok {
+		return nil, fmt.Errorf("%w, unable to decrypt", errCipherSuiteNotInit)
+	}
+
+	return cipherSuite.Decrypt(in)
+}
@@ -54,6 +54,11 @@ func (c *TLSEcdheEcdsaWithAes256GcmSha384) AuthenticationType() AuthenticationTy
 	return AuthenticationTypeCertificate
 }
 
+// IsPSK reports whether this CipherSuite requires a pre-shared key
+func (c *TLSEcdheEcdsaWithAes256GcmSha384) IsPSK() bool {
+	return false
+}
+
 func (c *TLSEcdheEcdsaWithAes256GcmSha384) init(masterSecret, clientRandom, serverRandom []byte, isClient bool, prfMacLen, prfKeyLen, prfIvLen int, hashFunc func() hash.Hash) error {
 	keys, err := prf.GenerateEncryptionKeys(masterSecret, clientRandom, serverRandom, prfMacLen, prfKeyLen, prfIvLen, hashFunc)
 	if err != nil {
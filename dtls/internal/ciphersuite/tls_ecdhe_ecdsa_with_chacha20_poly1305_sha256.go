@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ciphersuite
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sync/atomic"
+
+	"github.com/pion/dtls/v2/pkg/crypto/ciphersuite"
+	"github.com/pion/dtls/v2/pkg/crypto/clientcertificate"
+	"github.com/pion/dtls/v2/pkg/crypto/prf"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+)
+
+// TLSEcdheEcdsaWithChacha20Poly1305Sha256 represents a
+// TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 CipherSuite (RFC 7905).
+type TLSEcdheEcdsaWithChacha20Poly1305Sha256 struct {
+	chacha20poly1305 atomic.Value // *ciphersuite.ChaCha20Poly1305
+}
+
+// CertificateType returns what type of certificate this CipherSuite exchanges
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) CertificateType() clientcertificate.Type {
+	return clientcertificate.ECDSASign
+}
+
+// KeyExchangeAlgorithm controls what key exchange algorithm is using during the handshake
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) KeyExchangeAlgorithm() KeyExchangeAlgorithm {
+	return KeyExchangeAlgorithmEcdhe
+}
+
+// ECC uses Elliptic Curve Cryptography
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) ECC() bool {
+	return true
+}
+
+// ID returns the ID of the CipherSuite
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) ID() ID {
+	return TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256
+}
+
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) String() string {
+	return "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"
+}
+
+// HashFunc returns the hashing func for this CipherSuite
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) HashFunc() func() hash.Hash {
+	return sha256.New
+}
+
+// AuthenticationType controls what authentication method is using during the handshake
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) AuthenticationType() AuthenticationType {
+	return AuthenticationTypeCertificate
+}
+
+// IsPSK reports whether this CipherSuite requires a pre-shared key
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) IsPSK() bool {
+	return false
+}
+
+// Init initializes the internal Cipher with keying material
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) Init(masterSecret, clientRandom, serverRandom []byte, isClient bool) error {
+	const (
+		prfMacLen = 0
+		prfKeyLen = 32 // RFC 7905 Section 3: a 256-bit ChaCha20 key
+		prfIvLen  = 12 // RFC 7905 Section 3: a 96-bit fixed IV, XORed with the sequence number per record
+	)
+
+	keys, err := prf.GenerateEncryptionKeys(masterSecret, clientRandom, serverRandom, prfMacLen, prfKeyLen, prfIvLen, c.HashFunc())
+	if err != nil {
+		return err
+	}
+
+	var aead *ciphersuite.ChaCha20Poly1305
+	if isClient {
+		aead, err = ciphersuite.NewChaCha20Poly1305(keys.ClientWriteKey, keys.ClientWriteIV, keys.ServerWriteKey, keys.ServerWriteIV)
+	} else {
+		aead, err = ciphersuite.NewChaCha20Poly1305(keys.ServerWriteKey, keys.ServerWriteIV, keys.ClientWriteKey, keys.ClientWriteIV)
+	}
+	c.chacha20poly1305.Store(aead)
+
+	return err
+}
+
+// IsInitialized returns if the CipherSuite has keying material and can
+// encrypt/decrypt packets
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) IsInitialized() bool {
+	return c.chacha20poly1305.Load() != nil
+}
+
+// Encrypt encrypts a single TLS RecordLayer
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) Encrypt(pkt *recordlayer.RecordLayer, raw []byte) ([]byte, error) {
+	cipherSuite, ok := c.chacha20poly1305.Load().(*ciphersuite.ChaCha20Poly1305)
+	if !ok {
+		return nil, fmt.Errorf("%w, unable to encrypt", errCipherSuiteNotInit)
+	}
+
+	return cipherSuite.Encrypt(pkt, raw)
+}
+
+// Decrypt decrypts a single TLS RecordLayer
+func (c *TLSEcdheEcdsaWithChacha20Poly1305Sha256) Decrypt(h recordlayer.Header, in []byte) ([]byte, error) {
+	cipherSuite, ok := c.chacha20poly1305.Load().(*ciphersuite.ChaCha20Poly1305)
+	if !ok {
+		return nil, fmt.Errorf("%w, unable to decrypt", errCipherSuiteNotInit)
+	}
+
+	return cipherSuite.Decrypt(in)
+}
@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package hpke implements the subset of HPKE (RFC 9180) base mode needed to
+// seal and open Encrypted Client Hello (ECH) payloads: single-shot
+// Seal/Open under DHKEM(X25519, HKDF-SHA256) with HKDF-SHA256 and
+// AES-128-GCM.
+//
+// This package only provides the HPKE primitive. Building ECH on top of it
+// additionally needs an ECHConfig wire format, an outer/inner ClientHello
+// split, and handshake-layer plumbing to carry the ech extension and
+// retry_configs, none of which are implemented by this fork.
+package hpke
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// KEM(X25519, HKDF-SHA256), KDF(HKDF-SHA256) and AEAD(AES-128-GCM), the
+	// only suite combination this package implements.
+	kemID  uint16 = 0x0020
+	kdfID  uint16 = 0x0001
+	aeadID uint16 = 0x0001
+
+	nSecret = 32 // shared secret / key-schedule secret length for SHA-256
+	nKey    = 16 // AES-128-GCM key length
+	nNonce  = 12 // AES-128-GCM nonce length
+
+	modeBase = 0x00
+)
+
+var errOpen = errors.New("hpke: message authentication failed")
+
+func newHash() hash.Hash { return sha256.New() }
+
+// Context is a one-shot HPKE context bound to a single direction (seal or
+// open) after base-mode key derivation. It is not safe for concurrent use.
+type Context struct {
+	aead cipher.AEAD
+	// baseNonce is XORed with the big-endian sequence number for each
+	// message, per RFC 9180 Section 5.2.
+	baseNonce []byte
+	seq       uint64
+}
+
+// labeledExtract implements RFC 9180's LabeledExtract(salt, label, ikm)
+// under the ciphersuite identified by suiteID.
+func labeledExtract(suiteID []byte, salt []byte, label string, ikm []byte) []byte {
+	labeledIKM := make([]byte, 0, len("HPKE-v1")+len(suiteID)+len(label)+len(ikm))
+	labeledIKM = append(labeledIKM, "HPKE-v1"...)
+	labeledIKM = append(labeledIKM, suiteID...)
+	labeledIKM = append(labeledIKM, label...)
+	labeledIKM = append(labeledIKM, ikm...)
+
+	return hkdf.Extract(newHash, labeledIKM, salt)
+}
+
+// labeledExpand implements RFC 9180's LabeledExpand(prk, label, info, length)
+// under the ciphersuite identified by suiteID.
+func labeledExpand(suiteID []byte, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeledInfo := make([]byte, 0, 2+len("HPKE-v1")+len(suiteID)+len(label)+len(info))
+	labeledInfo = binary.BigEndian.AppendUint16(labeledInfo, uint16(length))
+	labeledInfo = append(labeledInfo, "HPKE-v1"...)
+	labeledInfo = append(labeledInfo, suiteID...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(newHash, prk, labeledInfo).Read(out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func kemSuiteID() []byte {
+	suiteID := make([]byte, 0, 5)
+	suiteID = append(suiteID, "KEM"...)
+
+	return binary.BigEndian.AppendUint16(suiteID, kemID)
+}
+
+func hpkeSuiteID() []byte {
+	suiteID := make([]byte, 0, 10)
+	suiteID = append(suiteID, "HPKE"...)
+	suiteID = binary.BigEndian.AppendUint16(suiteID, kemID)
+	suiteID = binary.BigEndian.AppendUint16(suiteID, kdfID)
+
+	return binary.BigEndian.AppendUint16(suiteID, aeadID)
+}
+
+// extractAndExpand derives the KEM shared secret from a raw X25519 DH
+// output and the encapsulated-key/recipient-key context, per RFC 9180
+// Section 4.1.
+func extractAndExpand(dh, kemContext []byte) ([]byte, error) {
+	suiteID := kemSuiteID()
+	eaePRK := labeledExtract(suiteID, nil, "eae_prk", dh)
+
+	return labeledExpand(suiteID, eaePRK, "shared_secret", kemContext, nSecret)
+}
+
+// GenerateKeyPair generates a fresh X25519 key pair for use as either side
+// of Encap/Decap.
+func GenerateKeyPair() (priv, pub []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// encap runs DHKEM(X25519, HKDF-SHA256)'s Encap against recipient public
+// key pkR, returning the shared secret and the encapsulated ephemeral
+// public key to send alongside the ciphertext.
+func encap(pkR []byte) (sharedSecret, enc []byte, err error) {
+	recipientPub, err := ecdh.X25519().NewPublicKey(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dh, err := ephemeral.ECDH(recipientPub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc = ephemeral.PublicKey().Bytes()
+	kemContext := append(append([]byte{}, enc...), pkR...)
+
+	sharedSecret, err = extractAndExpand(dh, kemContext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sharedSecret, enc, nil
+}
+
+// decap runs DHKEM(X25519, HKDF-SHA256)'s Decap: it recovers the shared
+// secret encap produced, given the recipient private key skR and the
+// encapsulated ephemeral public key enc.
+func decap(enc, skR []byte) (sharedSecret []byte, err error) {
+	recipientPriv, err := ecdh.X25519().NewPrivateKey(skR)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPub, err := ecdh.X25519().NewPublicKey(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	dh, err := recipientPriv.ECDH(ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+
+	pkR := recipientPriv.PublicKey().Bytes()
+	kemContext := append(append([]byte{}, enc...), pkR...)
+
+	return extractAndExpand(dh, kemContext)
+}
+
+// keySchedule derives the AEAD key and base nonce for base mode (no PSK),
+// per RFC 9180 Section 5.1.
+func keySchedule(sharedSecret, info []byte) (*Context, error) {
+	suiteID := hpkeSuiteID()
+
+	pskIDHash := labeledExtract(suiteID, nil, "psk_id_hash", nil)
+	infoHash := labeledExtract(suiteID, nil, "info_hash", info)
+
+	keySchedContext := make([]byte, 0, 1+len(pskIDHash)+len(infoHash))
+	keySchedContext = append(keySchedContext, modeBase)
+	keySchedContext = append(keySchedContext, pskIDHash...)
+	keySchedContext = append(keySchedContext, infoHash...)
+
+	secret := labeledExtract(suiteID, sharedSecret, "secret", nil)
+
+	key, err := labeledExpand(suiteID, secret, "key", keySchedContext, nKey)
+	if err != nil {
+		return nil, err
+	}
+	baseNonce, err := labeledExpand(suiteID, secret, "base_nonce", keySchedContext, nNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Context{aead: aead, baseNonce: baseNonce}, nil
+}
+
+// nonce computes the per-message nonce for the current sequence number, per
+// RFC 9180 Section 5.2, then advances the sequence number.
+func (c *Context) nonce() []byte {
+	seqBytes := make([]byte, nNonce)
+	binary.BigEndian.PutUint64(seqBytes[nNonce-8:], c.seq)
+
+	out := make([]byte, nNonce)
+	for i := range out {
+		out[i] = c.baseNonce[i] ^ seqBytes[i]
+	}
+	c.seq++
+
+	return out
+}
+
+// Seal encrypts and authenticates pt (with aad as associated data) under
+// the next sequence number.
+func (c *Context) Seal(aad, pt []byte) []byte {
+	return c.aead.Seal(nil, c.nonce(), pt, aad)
+}
+
+// Open decrypts and authenticates ct (with aad as associated data) under
+// the next sequence number.
+func (c *Context) Open(aad, ct []byte) ([]byte, error) {
+	pt, err := c.aead.Open(nil, c.nonce(), ct, aad)
+	if err != nil {
+		return nil, errOpen
+	}
+
+	return pt, nil
+}
+
+// SetupBaseS is the sender side of HPKE base-mode setup: it encapsulates a
+// shared secret to recipient public key pkR and derives a sealing Context
+// bound to info. enc must be sent to the recipient alongside every
+// ciphertext sealed with the returned Context.
+func SetupBaseS(pkR, info []byte) (enc []byte, ctx *Context, err error) {
+	sharedSecret, enc, err := encap(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, err = keySchedule(sharedSecret, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return enc, ctx, nil
+}
+
+// SetupBaseR is the recipient side of HPKE base-mode setup: given the
+// sender's encapsulated key enc, the recipient private key skR and the same
+// info used by the sender, it derives an opening Context.
+func SetupBaseR(enc, skR, info []byte) (*Context, error) {
+	sharedSecret, err := decap(enc, skR)
+	if err != nil {
+		return nil, err
+	}
+
+	return keySchedule(sharedSecret, info)
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package hpke
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	priv, pub, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := []byte("ech accept confirmation")
+	enc, sealCtx, err := SetupBaseS(pub, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openCtx, err := SetupBaseR(enc, priv, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aad := []byte("outer-client-hello")
+	for i, pt := range [][]byte{[]byte("inner-client-hello-1"), []byte("inner-client-hello-2")} {
+		ct := sealCtx.Seal(aad, pt)
+
+		got, err := openCtx.Open(aad, ct)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !bytes.Equal(got, pt) {
+			t.Fatalf("message %d: got %q, want %q", i, got, pt)
+		}
+	}
+}
+
+func TestOpenRejectsWrongRecipientKey(t *testing.T) {
+	_, pub, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongPriv, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := []byte("ech accept confirmation")
+	enc, sealCtx, err := SetupBaseS(pub, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openCtx, err := SetupBaseR(enc, wrongPriv, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := sealCtx.Seal(nil, []byte("inner-client-hello"))
+	if _, err := openCtx.Open(nil, ct); err == nil {
+		t.Fatal("expected Open to fail under the wrong recipient key")
+	}
+}
@@ -0,0 +1,871 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package net implements DTLS specific networking primitives.
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned by ReadFrom (and its batch counterpart) once the
+// configured read deadline has elapsed with no packet available.
+var ErrTimeout = &timeoutError{}
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+// ErrBufferFull is returned by WriteTo/WriteBatchTo on a bounded
+// PacketBuffer (see NewBoundedPacketBuffer) using OverflowError when the
+// write would exceed maxPackets or maxBytes.
+var ErrBufferFull = errors.New("net: packet buffer full")
+
+// ErrDropped is returned by WriteTo/WriteBatchTo on a bounded PacketBuffer
+// using OverflowDropNewest or OverflowDropOldest when the packet was
+// discarded instead of enqueued to make room; see Stats for a running
+// count of how many packets a policy has dropped this way.
+var ErrDropped = errors.New("net: packet dropped to relieve backpressure")
+
+// OverflowPolicy controls what a bounded PacketBuffer (see
+// NewBoundedPacketBuffer) does with a write that doesn't fit within
+// maxPackets/maxBytes.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes WriteTo/WriteBatchTo block until enough space
+	// frees up, the buffer is closed, or the write deadline elapses.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the packet being written and returns
+	// ErrDropped, leaving the buffer's existing contents untouched.
+	OverflowDropNewest
+	// OverflowDropOldest discards already-buffered packets, oldest first,
+	// until the new packet fits, then enqueues it normally.
+	OverflowDropOldest
+	// OverflowError makes WriteTo/WriteBatchTo return ErrBufferFull
+	// immediately instead of blocking or dropping anything.
+	OverflowError
+)
+
+// Stats is a snapshot of a PacketBuffer's lifetime packet/byte accounting,
+// returned by Stats. It is most useful on a bounded buffer (see
+// NewBoundedPacketBuffer), where DroppedNewest/DroppedOldest track how
+// often its OverflowPolicy has had to act.
+type Stats struct {
+	Enqueued      uint64
+	Dequeued      uint64
+	DroppedNewest uint64
+	DroppedOldest uint64
+	BytesInFlight int
+}
+
+// packet is one buffered datagram: a copy of the payload plus the address
+// it was addressed to (for WriteTo) or received from (for ReadFrom).
+// pooled is true when data came from packetDataPool via WriteToPooled,
+// meaning it's eligible to be returned there once fully consumed.
+type packet struct {
+	data   []byte
+	addr   net.Addr
+	pooled bool
+}
+
+// pooledPacketSize is the capacity of buffers packetDataPool hands out.
+// It comfortably fits a UDP datagram under the common internet MTU.
+const pooledPacketSize = 1500
+
+// packetDataPool recycles packet payload buffers across WriteToPooled and
+// Peek/Discard, so a UDP read loop feeding a PacketBuffer doesn't have to
+// allocate on every datagram the way WriteTo's copy does.
+var packetDataPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, pooledPacketSize)
+
+		return &buf
+	},
+}
+
+// PooledPacket is a packet payload obtained from packetDataPool via
+// GetPooled, written into in place (e.g. by a UDP read) and then handed to
+// WriteToPooled, which takes ownership of Data without copying it.
+type PooledPacket struct {
+	Data []byte
+	Addr net.Addr
+}
+
+// GetPooled returns a PooledPacket whose Data has length n, backed by a
+// buffer drawn from the shared pool when one of sufficient capacity is
+// available. The caller fills Data and sets Addr, then either passes the
+// PooledPacket to WriteToPooled or, if it decides not to, calls Recycle to
+// return the buffer to the pool.
+func GetPooled(n int) *PooledPacket {
+	bufp, _ := packetDataPool.Get().(*[]byte)
+	buf := *bufp
+	if cap(buf) < n {
+		buf = make([]byte, pooledPacketSize)
+		if n > len(buf) {
+			buf = make([]byte, n)
+		}
+	}
+
+	return &PooledPacket{Data: buf[:n]}
+}
+
+// Recycle returns p's underlying buffer to the shared pool. Callers that
+// hand p to WriteToPooled must not call Recycle themselves -- ownership of
+// Data has passed to the PacketBuffer, which recycles it once the packet
+// is fully consumed via ReadFrom/ReadBatchFrom/Discard, or discards it
+// immediately if the write itself didn't succeed.
+func (p *PooledPacket) Recycle() {
+	putPooledBuf(p.Data)
+}
+
+// putPooledBuf returns buf to packetDataPool if it's a plausible fit for
+// reuse (i.e. not wildly oversized relative to pooledPacketSize); a buffer
+// grown far beyond that for one outsized packet is left for the garbage
+// collector instead of bloating the pool.
+func putPooledBuf(buf []byte) {
+	if cap(buf) > pooledPacketSize*4 {
+		return
+	}
+
+	full := buf[:cap(buf)]
+	packetDataPool.Put(&full)
+}
+
+// recycleConsumedLocked returns pkt's buffer to packetDataPool once it's
+// safe to, after pkt has just been removed from the ring by tryReadLocked,
+// Discard, or dropOldestLocked. Since a Peek only ever pins the current
+// head, and pkt here is always the packet that was just popped from the
+// head, an active b.pending necessarily refers to pkt: recycling is then
+// deferred until Peek's release func has also run. The caller must hold
+// b.mutex.
+func (b *PacketBuffer) recycleConsumedLocked(pkt packet) {
+	if !pkt.pooled {
+		return
+	}
+
+	if b.pending.active {
+		b.pending.discarded = true
+		if b.pending.released {
+			putPooledBuf(b.pending.data)
+			b.pending.active = false
+		}
+
+		return
+	}
+
+	putPooledBuf(pkt.data)
+}
+
+// PacketBuffer is an unbounded, in-memory queue of packets, each tagged
+// with a net.Addr, read out in the order they were written. It exists so
+// DTLS code that wants net.PacketConn-shaped semantics (WriteTo/ReadFrom,
+// read deadlines) can sit in front of a transport that doesn't naturally
+// provide them.
+//
+// packets is a circular buffer: read and write are monotonically
+// increasing counts (never reduced modulo len(packets)), and the slot for
+// the n-th packet is packets[n%len(packets)]. Because read and write are
+// never wrapped, read == write unambiguously means "empty" -- the buffer
+// is always grown before a write would make that ambiguous with "full".
+type PacketBuffer struct {
+	mutex sync.Mutex
+
+	packets      []packet
+	read         int
+	write        int
+	closed       bool
+	notify       chan struct{}
+	readDeadline time.Time
+
+	// The fields below are only meaningful on a bounded buffer; see
+	// NewBoundedPacketBuffer. maxPackets == 0 means unbounded.
+	maxPackets    int
+	maxBytes      int
+	policy        OverflowPolicy
+	bytesInFlight int
+	enqueued      uint64
+	dequeued      uint64
+	droppedNewest uint64
+	droppedOldest uint64
+	writeNotify   chan struct{}
+	writeDeadline time.Time
+
+	// pending tracks the single outstanding zero-copy read started by
+	// Peek, so its buffer is only returned to packetDataPool once both
+	// sides are done with it: the caller (via the release func Peek
+	// returned) and Discard (which actually removes the packet from the
+	// ring). Whichever of the two finishes second performs the pool Put.
+	pending pendingPeek
+}
+
+type pendingPeek struct {
+	active    bool
+	data      []byte
+	pooled    bool
+	released  bool
+	discarded bool
+}
+
+// NewPacketBuffer creates an empty PacketBuffer ready for use. It grows
+// without bound; see NewBoundedPacketBuffer for a buffer that applies
+// backpressure instead.
+func NewPacketBuffer() *PacketBuffer {
+	return &PacketBuffer{}
+}
+
+// NewBoundedPacketBuffer creates an empty PacketBuffer that holds at most
+// maxPackets packets and maxBytes bytes of payload, applying policy to
+// writes that would exceed either limit. maxPackets <= 0 or maxBytes <= 0
+// means that dimension is unbounded.
+func NewBoundedPacketBuffer(maxPackets, maxBytes int, policy OverflowPolicy) *PacketBuffer {
+	return &PacketBuffer{
+		maxPackets: maxPackets,
+		maxBytes:   maxBytes,
+		policy:     policy,
+	}
+}
+
+// isBounded reports whether this buffer enforces maxPackets/maxBytes.
+func (b *PacketBuffer) isBounded() bool {
+	return b.maxPackets > 0 || b.maxBytes > 0
+}
+
+// fitsLocked reports whether a packet of length n can be enqueued without
+// exceeding maxPackets/maxBytes. The caller must hold b.mutex.
+func (b *PacketBuffer) fitsLocked(n int) bool {
+	if b.maxPackets > 0 && b.write-b.read >= b.maxPackets {
+		return false
+	}
+	if b.maxBytes > 0 && b.bytesInFlight+n > b.maxBytes {
+		return false
+	}
+
+	return true
+}
+
+// dropOldestLocked discards the oldest buffered packet, if any, accounting
+// it as dropped. The caller must hold b.mutex.
+func (b *PacketBuffer) dropOldestLocked() {
+	if b.read == b.write {
+		return
+	}
+
+	idx := b.read % len(b.packets)
+	pkt := b.packets[idx]
+	b.bytesInFlight -= len(pkt.data)
+	b.packets[idx] = packet{}
+	b.read++
+	b.droppedOldest++
+	if b.read == b.write {
+		b.read, b.write = 0, 0
+	}
+
+	b.recycleConsumedLocked(pkt)
+}
+
+// takeWriteNotifyLocked is the write-side counterpart of
+// takeNotifyLocked: it returns the channel blocked writers are waiting
+// on, if any, clearing it so a future block creates a fresh one. The
+// caller must hold b.mutex; the caller is responsible for closing the
+// returned channel after releasing the lock.
+func (b *PacketBuffer) takeWriteNotifyLocked() chan struct{} {
+	notify := b.writeNotify
+	b.writeNotify = nil
+	return notify
+}
+
+// Stats returns a snapshot of this buffer's lifetime packet/byte counters.
+func (b *PacketBuffer) Stats() Stats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return Stats{
+		Enqueued:      b.enqueued,
+		Dequeued:      b.dequeued,
+		DroppedNewest: b.droppedNewest,
+		DroppedOldest: b.droppedOldest,
+		BytesInFlight: b.bytesInFlight,
+	}
+}
+
+// grow doubles the capacity of the ring buffer (from zero to one, the base
+// case, and from there by doubling), re-laying out the currently buffered
+// packets contiguously starting at index zero of the new slice. The caller
+// must hold b.mutex.
+func (b *PacketBuffer) grow() {
+	newCap := len(b.packets) * 2
+	if newCap == 0 {
+		newCap = 1
+	}
+
+	count := b.write - b.read
+	newPackets := make([]packet, newCap)
+	for i := 0; i < count; i++ {
+		newPackets[i] = b.packets[(b.read+i)%len(b.packets)]
+	}
+
+	b.packets = newPackets
+	b.read = 0
+	b.write = count
+}
+
+// writeLocked appends a copy of p, tagged with addr, to the ring buffer,
+// growing it first if it's full. The caller must hold b.mutex.
+func (b *PacketBuffer) writeLocked(p []byte, addr net.Addr) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	b.writeOwnedLocked(data, addr, false)
+}
+
+// writeOwnedLocked appends data, tagged with addr, to the ring buffer,
+// taking ownership of data rather than copying it -- the caller must not
+// retain a reference to it. pooled marks data as eligible to be returned
+// to packetDataPool once the packet is fully consumed. The caller must
+// hold b.mutex.
+func (b *PacketBuffer) writeOwnedLocked(data []byte, addr net.Addr, pooled bool) {
+	if len(b.packets) == 0 || b.write-b.read == len(b.packets) {
+		b.grow()
+	}
+
+	b.packets[b.write%len(b.packets)] = packet{data: data, addr: addr, pooled: pooled}
+	b.write++
+	b.enqueued++
+	b.bytesInFlight += len(data)
+}
+
+// takeNotifyLocked returns the channel blocked readers are waiting on, if
+// any, clearing it so a future block creates a fresh one. The caller must
+// hold b.mutex; the caller is responsible for closing the returned channel
+// after releasing the lock.
+func (b *PacketBuffer) takeNotifyLocked() chan struct{} {
+	notify := b.notify
+	b.notify = nil
+	return notify
+}
+
+// writeOne enqueues a single packet, copying p, applying this buffer's
+// OverflowPolicy if it's bounded and the packet doesn't currently fit. It
+// returns len(p), nil on success, or an error once the buffer has been
+// closed, the packet was dropped (OverflowDropNewest), it didn't fit
+// (OverflowError), or a blocked write (OverflowBlock) timed out.
+func (b *PacketBuffer) writeOne(p []byte, addr net.Addr) (int, error) {
+	n, err := b.enqueueOne(len(p), addr, func() []byte {
+		data := make([]byte, len(p))
+		copy(data, p)
+
+		return data
+	}, false)
+
+	return n, err
+}
+
+// enqueueOne is the shared implementation behind writeOne and
+// WriteToPooled. size is the packet's length, used against
+// fitsLocked/ErrBufferFull/OverflowDropOldest before the packet data
+// itself is materialized; makeData is only called once this buffer has
+// decided to actually enqueue the packet, and must return a []byte of
+// length size. If pooled, a packet that doesn't end up enqueued (because
+// the buffer is closed, or OverflowDropNewest/OverflowError reject it) has
+// its data -- obtained by calling makeData eagerly in that case -- handed
+// back to packetDataPool rather than leaked.
+func (b *PacketBuffer) enqueueOne(size int, addr net.Addr, makeData func() []byte, pooled bool) (int, error) {
+	for {
+		b.mutex.Lock()
+		if b.closed {
+			b.mutex.Unlock()
+			if pooled {
+				putPooledBuf(makeData())
+			}
+
+			return 0, net.ErrClosed
+		}
+
+		if !b.isBounded() || b.fitsLocked(size) {
+			b.writeOwnedLocked(makeData(), addr, pooled)
+			notify := b.takeNotifyLocked()
+			b.mutex.Unlock()
+
+			if notify != nil {
+				close(notify)
+			}
+
+			return size, nil
+		}
+
+		switch b.policy {
+		case OverflowDropNewest:
+			b.droppedNewest++
+			b.mutex.Unlock()
+			if pooled {
+				putPooledBuf(makeData())
+			}
+
+			return 0, ErrDropped
+
+		case OverflowDropOldest:
+			for !b.fitsLocked(size) && b.read != b.write {
+				b.dropOldestLocked()
+			}
+			b.writeOwnedLocked(makeData(), addr, pooled)
+			notify := b.takeNotifyLocked()
+			b.mutex.Unlock()
+
+			if notify != nil {
+				close(notify)
+			}
+
+			return size, nil
+
+		case OverflowError:
+			b.mutex.Unlock()
+			if pooled {
+				putPooledBuf(makeData())
+			}
+
+			return 0, ErrBufferFull
+
+		default: // OverflowBlock
+			deadline := b.writeDeadline
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				b.mutex.Unlock()
+
+				return 0, ErrTimeout
+			}
+
+			if b.writeNotify == nil {
+				b.writeNotify = make(chan struct{})
+			}
+			notify := b.writeNotify
+			b.mutex.Unlock()
+
+			if deadline.IsZero() {
+				<-notify
+
+				continue
+			}
+
+			timer := time.NewTimer(time.Until(deadline))
+			select {
+			case <-notify:
+				timer.Stop()
+			case <-timer.C:
+				return 0, ErrTimeout
+			}
+		}
+	}
+}
+
+// WriteTo enqueues p (copied) tagged with addr. It returns len(p), nil on
+// success, or an error once the buffer has been closed. On a bounded
+// buffer (see NewBoundedPacketBuffer) it also applies that buffer's
+// OverflowPolicy once a write would exceed maxPackets/maxBytes.
+func (b *PacketBuffer) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return b.writeOne(p, addr)
+}
+
+// WriteToPooled enqueues p, tagged with p.Addr, taking ownership of
+// p.Data rather than copying it -- the caller must not read or write
+// p.Data again, whether or not this call succeeds. It otherwise behaves
+// exactly like WriteTo(p.Data, p.Addr), including OverflowPolicy handling
+// on a bounded buffer. Pair with GetPooled so a UDP read loop can hand a
+// datagram to a PacketBuffer without an intermediate allocation.
+func (b *PacketBuffer) WriteToPooled(p *PooledPacket) (int, error) {
+	return b.enqueueOne(len(p.Data), p.Addr, func() []byte { return p.Data }, true)
+}
+
+// WriteBatchTo enqueues len(payloads) packets, each payloads[i] tagged
+// with addrs[i]. len(payloads) must equal len(addrs). On an unbounded
+// buffer this happens under a single lock acquisition and fails
+// atomically if the buffer is already closed: on error, none of the
+// batch was written. On a bounded buffer each packet goes through
+// WriteTo's OverflowPolicy handling individually, so the batch can
+// partially succeed; n reports how many packets were written before the
+// first error.
+func (b *PacketBuffer) WriteBatchTo(payloads [][]byte, addrs []net.Addr) (int, error) {
+	if len(payloads) != len(addrs) {
+		return 0, fmt.Errorf("net: WriteBatchTo: %d payloads but %d addrs", len(payloads), len(addrs))
+	}
+	if len(payloads) == 0 {
+		return 0, nil
+	}
+
+	if b.isBounded() {
+		for i, p := range payloads {
+			if _, err := b.writeOne(p, addrs[i]); err != nil {
+				return i, err
+			}
+		}
+
+		return len(payloads), nil
+	}
+
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+
+		return 0, net.ErrClosed
+	}
+
+	for i, p := range payloads {
+		b.writeLocked(p, addrs[i])
+	}
+
+	notify := b.takeNotifyLocked()
+	b.mutex.Unlock()
+
+	if notify != nil {
+		close(notify)
+	}
+
+	return len(payloads), nil
+}
+
+// tryReadLocked attempts to read the oldest buffered packet into p without
+// blocking. The caller must hold b.mutex. ok is false if the buffer is
+// currently empty. short is true if p is too small for the packet, in
+// which case the packet is left in the buffer so a subsequent call with a
+// larger p can still read it. eof is true if the packet itself is empty
+// and p is not: per the io.Reader convention, a read is discouraged from
+// reporting a zero byte count with a nil error except when len(p) == 0, so
+// an empty packet is surfaced as io.EOF to any caller whose buffer could
+// have held more.
+func (b *PacketBuffer) tryReadLocked(p []byte) (n int, addr net.Addr, ok, short, eof bool) {
+	if b.read == b.write {
+		return 0, nil, false, false, false
+	}
+
+	idx := b.read % len(b.packets)
+	pkt := b.packets[idx]
+	if len(p) < len(pkt.data) {
+		return 0, nil, true, true, false
+	}
+
+	n = copy(p, pkt.data)
+	b.packets[idx] = packet{}
+	b.read++
+	b.dequeued++
+	b.bytesInFlight -= len(pkt.data)
+	if b.read == b.write {
+		b.read, b.write = 0, 0
+	}
+	b.recycleConsumedLocked(pkt)
+
+	if n == 0 && len(p) != 0 {
+		return 0, nil, true, false, true
+	}
+
+	return n, pkt.addr, true, false, false
+}
+
+// ReadFrom blocks until a packet is available, the buffer is closed, or
+// the read deadline (see SetReadDeadline) elapses. Once closed, it keeps
+// returning already-buffered packets and only reports io.EOF once the
+// buffer is fully drained. If p is too small for the next packet, it
+// returns io.ErrShortBuffer without consuming that packet.
+func (b *PacketBuffer) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		b.mutex.Lock()
+
+		if n, addr, ok, short, eof := b.tryReadLocked(p); ok {
+			var writeNotify chan struct{}
+			if !short {
+				writeNotify = b.takeWriteNotifyLocked()
+			}
+			b.mutex.Unlock()
+
+			if writeNotify != nil {
+				close(writeNotify)
+			}
+			if short {
+				return 0, nil, io.ErrShortBuffer
+			}
+			if eof {
+				return 0, nil, io.EOF
+			}
+
+			return n, addr, nil
+		}
+
+		if b.closed {
+			b.mutex.Unlock()
+
+			return 0, nil, io.EOF
+		}
+
+		deadline := b.readDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			b.mutex.Unlock()
+
+			return 0, nil, ErrTimeout
+		}
+
+		if b.notify == nil {
+			b.notify = make(chan struct{})
+		}
+		notify := b.notify
+		b.mutex.Unlock()
+
+		if deadline.IsZero() {
+			<-notify
+
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+			return 0, nil, ErrTimeout
+		}
+	}
+}
+
+// ReadBatchFrom reads up to len(bufs) already-buffered packets under a
+// single lock acquisition, recording each packet's length in sizes[i] and
+// its source address in addrs[i]. Unlike ReadFrom it never blocks: once
+// the buffer empties it returns the number of packets read so far with a
+// nil error. If bufs[i] is too small for the next packet, the batch stops
+// there and returns io.ErrShortBuffer, leaving that packet unconsumed (so
+// it can still be read, by itself or in the next batch, with a larger
+// slot) without discarding the packets already read into earlier slots.
+// An empty packet met with a non-empty bufs[i] stops the batch the same
+// way, with io.EOF, per the same convention ReadFrom follows.
+// len(bufs), len(sizes) and len(addrs) must all match.
+func (b *PacketBuffer) ReadBatchFrom(bufs [][]byte, sizes []int, addrs []net.Addr) (int, error) {
+	if len(bufs) != len(sizes) || len(bufs) != len(addrs) {
+		return 0, fmt.Errorf("net: ReadBatchFrom: %d bufs, %d sizes, %d addrs", len(bufs), len(sizes), len(addrs))
+	}
+
+	b.mutex.Lock()
+
+	read := 0
+	var readErr error
+	for i := range bufs {
+		n, addr, ok, short, eof := b.tryReadLocked(bufs[i])
+		if !ok {
+			break
+		}
+		if short {
+			readErr = io.ErrShortBuffer
+
+			break
+		}
+		if eof {
+			readErr = io.EOF
+
+			break
+		}
+
+		sizes[i] = n
+		addrs[i] = addr
+		read++
+	}
+
+	var writeNotify chan struct{}
+	if read > 0 || readErr == io.EOF {
+		writeNotify = b.takeWriteNotifyLocked()
+	}
+	b.mutex.Unlock()
+
+	if writeNotify != nil {
+		close(writeNotify)
+	}
+
+	return read, readErr
+}
+
+// Peek blocks until a packet is available, the buffer is closed, or the
+// read deadline elapses -- the same contract as ReadFrom -- but returns
+// the head packet's payload directly instead of copying it into a
+// caller-supplied buffer, and without removing it from the buffer. A
+// repeated Peek with no intervening Discard returns the same packet
+// again.
+//
+// release must be called exactly once when the caller is done reading
+// payload. Discard (see below) defers returning a pooled packet's buffer
+// (see WriteToPooled) to packetDataPool until release has also been
+// called, so a subsequent pooled write can't overwrite memory payload
+// still points into. Calling Peek again before Discard does not create a
+// second outstanding release.
+func (b *PacketBuffer) Peek() (payload []byte, addr net.Addr, release func(), err error) {
+	for {
+		b.mutex.Lock()
+
+		if b.read != b.write {
+			idx := b.read % len(b.packets)
+			pkt := b.packets[idx]
+			if !b.pending.active {
+				b.pending = pendingPeek{active: true, data: pkt.data, pooled: pkt.pooled}
+			}
+			b.mutex.Unlock()
+
+			return pkt.data, pkt.addr, func() { b.releasePending() }, nil
+		}
+
+		if b.closed {
+			b.mutex.Unlock()
+
+			return nil, nil, func() {}, io.EOF
+		}
+
+		deadline := b.readDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			b.mutex.Unlock()
+
+			return nil, nil, func() {}, ErrTimeout
+		}
+
+		if b.notify == nil {
+			b.notify = make(chan struct{})
+		}
+		notify := b.notify
+		b.mutex.Unlock()
+
+		if deadline.IsZero() {
+			<-notify
+
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+			return nil, nil, func() {}, ErrTimeout
+		}
+	}
+}
+
+// releasePending marks the pending peek as released by its Peek caller, and
+// recycles its buffer if Discard has already run too.
+func (b *PacketBuffer) releasePending() {
+	b.mutex.Lock()
+	b.pending.released = true
+	if b.pending.discarded {
+		if b.pending.pooled {
+			putPooledBuf(b.pending.data)
+		}
+		b.pending.active = false
+	}
+	b.mutex.Unlock()
+}
+
+// Discard removes the packet Peek last returned from the buffer, the same
+// way ReadFrom would, without copying its data anywhere. It returns
+// io.EOF if the buffer is currently empty. If Peek was used to view the
+// packet being discarded, its buffer is only returned to packetDataPool
+// once the corresponding release func has also been called.
+func (b *PacketBuffer) Discard() error {
+	b.mutex.Lock()
+
+	if b.read == b.write {
+		b.mutex.Unlock()
+
+		return io.EOF
+	}
+
+	idx := b.read % len(b.packets)
+	pkt := b.packets[idx]
+	b.packets[idx] = packet{}
+	b.read++
+	b.dequeued++
+	b.bytesInFlight -= len(pkt.data)
+	if b.read == b.write {
+		b.read, b.write = 0, 0
+	}
+	b.recycleConsumedLocked(pkt)
+
+	writeNotify := b.takeWriteNotifyLocked()
+	b.mutex.Unlock()
+
+	if writeNotify != nil {
+		close(writeNotify)
+	}
+
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future ReadFrom (and ReadBatchFrom)
+// calls. A zero time.Time clears the deadline. A deadline in the past
+// causes the next ReadFrom call -- including one already blocked -- to
+// return ErrTimeout immediately.
+func (b *PacketBuffer) SetReadDeadline(t time.Time) error {
+	b.mutex.Lock()
+	b.readDeadline = t
+	notify := b.takeNotifyLocked()
+	b.mutex.Unlock()
+
+	if notify != nil {
+		close(notify)
+	}
+
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future WriteTo/WriteBatchTo calls
+// blocked on a bounded buffer with OverflowBlock (see
+// NewBoundedPacketBuffer); it has no effect otherwise, since no other mode
+// or policy ever blocks a write. A zero time.Time clears the deadline. A
+// deadline in the past causes the next blocked write -- including one
+// already blocked -- to return ErrTimeout with n == 0.
+func (b *PacketBuffer) SetWriteDeadline(t time.Time) error {
+	b.mutex.Lock()
+	b.writeDeadline = t
+	notify := b.takeWriteNotifyLocked()
+	b.mutex.Unlock()
+
+	if notify != nil {
+		close(notify)
+	}
+
+	return nil
+}
+
+// SetDeadline sets both the read and write deadlines; see SetReadDeadline
+// and SetWriteDeadline.
+func (b *PacketBuffer) SetDeadline(t time.Time) error {
+	if err := b.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return b.SetWriteDeadline(t)
+}
+
+// Close unblocks any goroutine blocked in ReadFrom or, on a bounded buffer
+// with OverflowBlock (see NewBoundedPacketBuffer), in WriteTo/WriteBatchTo,
+// and causes future WriteTo/WriteBatchTo calls to fail. It does not discard
+// packets that were already buffered: ReadFrom keeps returning them until
+// the buffer is drained, at which point it starts returning io.EOF. Close
+// is idempotent.
+func (b *PacketBuffer) Close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+
+		return nil
+	}
+
+	b.closed = true
+	notify := b.takeNotifyLocked()
+	writeNotify := b.takeWriteNotifyLocked()
+	b.mutex.Unlock()
+
+	if notify != nil {
+		close(notify)
+	}
+	if writeNotify != nil {
+		close(writeNotify)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package net
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestWriteBatchToReadBatchFrom(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := [][]byte{{0, 1}, {2, 3, 4}, {5}}
+	addrs := []net.Addr{addr, addr, addr}
+
+	n, err := buffer.WriteBatchTo(payloads, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalInt(t, len(payloads), n)
+
+	bufs := make([][]byte, len(payloads))
+	for i := range bufs {
+		bufs[i] = make([]byte, 8)
+	}
+	sizes := make([]int, len(payloads))
+	raddrs := make([]net.Addr, len(payloads))
+
+	n, err = buffer.ReadBatchFrom(bufs, sizes, raddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalInt(t, len(payloads), n)
+
+	for i, p := range payloads {
+		equalBytes(t, p, bufs[i][:sizes[i]])
+		equalUDPAddr(t, addr, raddrs[i])
+	}
+}
+
+func TestWriteBatchToMismatchedLengths(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteBatchTo([][]byte{{0}}, nil); err == nil {
+		t.Fatal("Expected error from mismatched payloads/addrs lengths")
+	}
+
+	bufs := [][]byte{make([]byte, 1)}
+	if _, err := buffer.ReadBatchFrom(bufs, nil, []net.Addr{addr}); err == nil {
+		t.Fatal("Expected error from mismatched bufs/sizes/addrs lengths")
+	}
+}
+
+func TestReadBatchFromPartialDrain(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteBatchTo([][]byte{{1}, {2}}, []net.Addr{addr, addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	bufs := make([][]byte, 5)
+	for i := range bufs {
+		bufs[i] = make([]byte, 1)
+	}
+	sizes := make([]int, 5)
+	raddrs := make([]net.Addr, 5)
+
+	// Only 2 packets are buffered, so the batch stops early with no error.
+	n, err := buffer.ReadBatchFrom(bufs, sizes, raddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalInt(t, 2, n)
+	equalBytes(t, []byte{1}, bufs[0][:sizes[0]])
+	equalBytes(t, []byte{2}, bufs[1][:sizes[1]])
+}
+
+func TestReadBatchFromShortSlot(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteBatchTo([][]byte{{1}, {2, 3}}, []net.Addr{addr, addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Second slot is too small for the second packet: the batch should stop
+	// there, reporting the first packet already read, and leave the second
+	// packet in the buffer for the next call.
+	bufs := [][]byte{make([]byte, 1), make([]byte, 1)}
+	sizes := make([]int, 2)
+	raddrs := make([]net.Addr, 2)
+	n, err := buffer.ReadBatchFrom(bufs, sizes, raddrs)
+	if !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("Unexpected err %v wanted io.ErrShortBuffer", err)
+	}
+	equalInt(t, 1, n)
+	equalBytes(t, []byte{1}, bufs[0][:sizes[0]])
+
+	// Retrying with a big enough slot reads the still-buffered packet.
+	bufs = [][]byte{make([]byte, 2)}
+	sizes = make([]int, 1)
+	raddrs = make([]net.Addr, 1)
+	n, err = buffer.ReadBatchFrom(bufs, sizes, raddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalInt(t, 1, n)
+	equalBytes(t, []byte{2, 3}, bufs[0][:sizes[0]])
+}
+
+func TestWriteBatchToAfterClose(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteBatchTo([][]byte{{0}}, []net.Addr{addr}); err == nil {
+		t.Fatal("Expected error from WriteBatchTo after Close")
+	}
+}
+
+func benchmarkBufferBatchWR(b *testing.B, size int64, batch int) {
+	b.Helper()
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		b.Fatalf("net.ResolveUDPAddr: %v", err)
+	}
+	buffer := NewPacketBuffer()
+
+	payloads := make([][]byte, batch)
+	addrs := make([]net.Addr, batch)
+	bufs := make([][]byte, batch)
+	sizes := make([]int, batch)
+	raddrs := make([]net.Addr, batch)
+	for i := 0; i < batch; i++ {
+		payloads[i] = make([]byte, size)
+		addrs[i] = addr
+		bufs[i] = make([]byte, size)
+	}
+
+	b.SetBytes(size * int64(batch))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := buffer.WriteBatchTo(payloads, addrs); err != nil {
+			b.Fatalf("WriteBatchTo: %v", err)
+		}
+		if _, err := buffer.ReadBatchFrom(bufs, sizes, raddrs); err != nil {
+			b.Fatalf("ReadBatchFrom: %v", err)
+		}
+	}
+}
+
+func BenchmarkBufferBatchWR14x8(b *testing.B) {
+	benchmarkBufferBatchWR(b, 14, 8)
+}
+
+func BenchmarkBufferBatchWR1400x8(b *testing.B) {
+	benchmarkBufferBatchWR(b, 1400, 8)
+}
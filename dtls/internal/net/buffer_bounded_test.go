@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package net
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBoundedPacketBufferOverflowError(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(2, 0, OverflowError)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := buffer.WriteTo([]byte{byte(i)}, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := buffer.WriteTo([]byte{2}, addr); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("Unexpected err %v wanted ErrBufferFull", err)
+	}
+
+	stats := buffer.Stats()
+	equalInt(t, 2, int(stats.Enqueued))
+}
+
+func TestBoundedPacketBufferOverflowDropNewest(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowDropNewest)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1}, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buffer.WriteTo([]byte{2}, addr); !errors.Is(err, ErrDropped) {
+		t.Fatalf("Unexpected err %v wanted ErrDropped", err)
+	}
+
+	p := make([]byte, 4)
+	n, _, err := buffer.ReadFrom(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, []byte{1}, p[:n])
+
+	stats := buffer.Stats()
+	equalInt(t, 1, int(stats.DroppedNewest))
+}
+
+func TestBoundedPacketBufferOverflowDropOldest(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowDropOldest)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1}, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buffer.WriteTo([]byte{2}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	p := make([]byte, 4)
+	n, _, err := buffer.ReadFrom(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, []byte{2}, p[:n])
+
+	stats := buffer.Stats()
+	equalInt(t, 1, int(stats.DroppedOldest))
+	equalInt(t, 1, int(stats.Enqueued)-int(stats.DroppedOldest))
+}
+
+func TestBoundedPacketBufferMaxBytes(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(0, 4, OverflowError)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1, 2, 3}, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buffer.WriteTo([]byte{4, 5}, addr); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("Unexpected err %v wanted ErrBufferFull", err)
+	}
+
+	stats := buffer.Stats()
+	equalInt(t, 3, stats.BytesInFlight)
+}
+
+func TestBoundedPacketBufferOverflowBlock(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowBlock)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := buffer.WriteTo([]byte{2}, addr)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("WriteTo returned early with err %v, wanted it to block", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p := make([]byte, 4)
+	if _, _, err := buffer.ReadFrom(p); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteTo did not unblock after a read freed space")
+	}
+}
+
+func TestBoundedPacketBufferOverflowBlockUnblocksOnClose(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowBlock)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := buffer.WriteTo([]byte{2}, addr)
+		done <- err
+	}()
+
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Unexpected err %v wanted net.ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteTo did not unblock after Close")
+	}
+}
+
+func TestPacketBufferStatsUnbounded(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1, 2}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	p := make([]byte, 4)
+	if _, _, err := buffer.ReadFrom(p); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := buffer.Stats()
+	equalInt(t, 1, int(stats.Enqueued))
+	equalInt(t, 1, int(stats.Dequeued))
+	equalInt(t, 0, stats.BytesInFlight)
+}
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package net
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestPeekDiscard(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1, 2, 3}, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buffer.WriteTo([]byte{4, 5}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, raddr, release, err := buffer.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, []byte{1, 2, 3}, payload)
+	equalUDPAddr(t, addr, raddr)
+
+	// A repeated Peek without an intervening Discard sees the same packet.
+	payload2, _, release2, err := buffer.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, []byte{1, 2, 3}, payload2)
+
+	release()
+	release2()
+
+	if err := buffer.Discard(); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := make([]byte, 4)
+	n, _, err := buffer.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, []byte{4, 5}, packet[:n])
+}
+
+func TestPeekDiscardEmpty(t *testing.T) {
+	buffer := NewPacketBuffer()
+
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := buffer.Peek(); !errors.Is(err, io.EOF) {
+		t.Fatalf("Unexpected err %v wanted io.EOF", err)
+	}
+	if err := buffer.Discard(); !errors.Is(err, io.EOF) {
+		t.Fatalf("Unexpected err %v wanted io.EOF", err)
+	}
+}
+
+func TestWriteToPooledRecyclesOnDiscard(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pooled := GetPooled(4)
+	copy(pooled.Data, []byte{9, 9, 9, 9})
+	pooled.Addr = addr
+
+	n, err := buffer.WriteToPooled(pooled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalInt(t, 4, n)
+
+	payload, raddr, release, err := buffer.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, []byte{9, 9, 9, 9}, payload)
+	equalUDPAddr(t, addr, raddr)
+
+	if err := buffer.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestWriteToPooledRecyclesOnFailure(t *testing.T) {
+	buffer := NewPacketBuffer()
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pooled := GetPooled(2)
+	pooled.Addr = addr
+	if _, err := buffer.WriteToPooled(pooled); err == nil {
+		t.Fatal("Expected error from WriteToPooled after Close")
+	}
+}
+
+func TestBoundedWriteToPooledDropped(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowDropNewest)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{1}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	pooled := GetPooled(1)
+	pooled.Addr = addr
+	if _, err := buffer.WriteToPooled(pooled); !errors.Is(err, ErrDropped) {
+		t.Fatalf("Unexpected err %v wanted ErrDropped", err)
+	}
+}
+
+func benchmarkBufferPooledWR(b *testing.B, size int64) {
+	b.Helper()
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		b.Fatalf("net.ResolveUDPAddr: %v", err)
+	}
+	buffer := NewPacketBuffer()
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		pooled := GetPooled(int(size))
+		pooled.Addr = addr
+		if _, err := buffer.WriteToPooled(pooled); err != nil {
+			b.Fatalf("WriteToPooled: %v", err)
+		}
+
+		if _, _, release, err := buffer.Peek(); err != nil {
+			b.Fatalf("Peek: %v", err)
+		} else {
+			release()
+		}
+		if err := buffer.Discard(); err != nil {
+			b.Fatalf("Discard: %v", err)
+		}
+	}
+}
+
+// BenchmarkBufferPooledWR1400 is BenchmarkBufferWR1400's zero-copy
+// counterpart: WriteToPooled/Peek/Discard replace WriteTo/ReadFrom's
+// mandatory copy with buffers drawn from packetDataPool.
+func BenchmarkBufferPooledWR1400(b *testing.B) {
+	benchmarkBufferPooledWR(b, 1400)
+}
@@ -345,6 +345,81 @@ func TestBufferAsync(t *testing.T) {
 	}
 }
 
+// TestBufferAsyncWriteDeadline is TestBufferAsync's write-side counterpart:
+// it blocks a writer on a full bounded buffer, resets the write deadline
+// while the writer is still blocked, and confirms the writer only unblocks
+// once the deadline actually expires.
+func TestBufferAsyncWriteDeadline(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowBlock)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{0}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	// Start up a goroutine to block on a write to the full ring.
+	done := make(chan error, 1)
+	go func() {
+		_, wErr := buffer.WriteTo([]byte{1}, addr)
+		done <- wErr
+	}()
+
+	// Wait for the writer to start blocking.
+	time.Sleep(time.Millisecond)
+
+	// Resetting the deadline to a value in the future shouldn't unblock it.
+	if err := buffer.SetWriteDeadline(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case wErr := <-done:
+		t.Fatalf("WriteTo returned early with err %v, wanted it to stay blocked", wErr)
+	case <-time.After(time.Millisecond):
+	}
+
+	// A deadline in the past unblocks it with ErrTimeout.
+	if err := buffer.SetWriteDeadline(time.Unix(0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if wErr := <-done; !errors.Is(wErr, ErrTimeout) {
+		t.Fatalf("Unexpected err %v wanted ErrTimeout", wErr)
+	}
+}
+
+// TestBufferAsyncWriteClose races Close against a writer already blocked on
+// a full bounded buffer, as TestBufferAsync does for a blocked reader.
+func TestBufferAsyncWriteClose(t *testing.T) {
+	buffer := NewBoundedPacketBuffer(1, 0, OverflowBlock)
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5684")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.WriteTo([]byte{0}, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, wErr := buffer.WriteTo([]byte{1}, addr)
+		done <- wErr
+	}()
+
+	// Wait for the writer to start blocking.
+	time.Sleep(time.Millisecond)
+
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if wErr := <-done; !errors.Is(wErr, net.ErrClosed) {
+		t.Fatalf("Unexpected err %v wanted net.ErrClosed", wErr)
+	}
+}
+
 func benchmarkBufferWR(b *testing.B, size int64, write bool, grow int) {
 	b.Helper()
 
@@ -560,7 +635,24 @@ func FuzzPacketBuffer_WriteReadRoundTrip(f *testing.F) {
 			}
 		}
 
-		readOnce(p1)
+		// Peek+Discard p1 (zero-copy), interleaved with a normal
+		// ReadFrom of p2, to make sure the two read paths agree on what
+		// the head of the buffer is.
+		peeked, peekAddr, release, errPeek := buf.Peek()
+		if errPeek != nil {
+			t.Fatalf("Peek: %v", errPeek)
+		}
+		if !bytes.Equal(p1, peeked) {
+			t.Fatalf("Expected %v got %v", p1, peeked)
+		}
+		if peekAddr == nil || peekAddr.String() != addr.String() {
+			t.Fatalf("Expected addr %v got %v", addr.String(), peekAddr)
+		}
+		release()
+		if err := buf.Discard(); err != nil {
+			t.Fatalf("Discard: %v", err)
+		}
+
 		readOnce(p2)
 
 		if err := buf.Close(); err != nil {
@@ -608,6 +700,24 @@ func FuzzPacketBuffer_DeadlineAndShortBuffer(f *testing.F) {
 			t.Fatalf("SetReadDeadline: %v", err)
 		}
 
+		// A write deadline in the past only takes effect once a write
+		// would actually block, which never happens on an unbounded
+		// buffer: SetWriteDeadline is otherwise a no-op here.
+		if err := buf.SetWriteDeadline(time.Unix(0, 1)); err != nil {
+			t.Fatalf("SetWriteDeadline: %v", err)
+		}
+		if n, err := buf.WriteTo(payload, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9999}); err != nil {
+			t.Fatalf("WriteTo: %v", err)
+		} else if n != len(payload) {
+			t.Fatalf("Expected %d bytes written, got %d", len(payload), n)
+		}
+		if _, _, err := buf.ReadFrom(make([]byte, len(payload))); err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		if err := buf.SetWriteDeadline(time.Time{}); err != nil {
+			t.Fatalf("SetWriteDeadline: %v", err)
+		}
+
 		ua := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9999}
 		n, err = buf.WriteTo(payload, ua)
 		if err != nil {
@@ -0,0 +1,272 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package net
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrDemuxerClosed is returned by Accept once the PacketDemuxer's read
+// loop has stopped -- because the underlying net.PacketConn returned an
+// error, or Close was called -- and every already-observed remote has
+// been drained from the accept queue. If the read loop stopped because
+// of a read error, Accept (and Err) return that error instead.
+var ErrDemuxerClosed = errors.New("net: packet demuxer closed")
+
+// DemuxerConfig configures a PacketDemuxer. MaxPackets, MaxBytes and
+// Policy are passed through to NewBoundedPacketBuffer for every flow's
+// PacketBuffer, so MaxPackets <= 0 or MaxBytes <= 0 leaves that
+// dimension unbounded, same as there. MaxFlows <= 0 leaves the number of
+// tracked remotes unbounded; otherwise a datagram from a remote not
+// already tracked, arriving while MaxFlows remotes are tracked, is
+// dropped. IdleTimeout <= 0 disables idle eviction; otherwise a flow
+// that goes IdleTimeout without a new datagram has its PacketBuffer
+// closed and is forgotten, so a reader blocked on it sees io.EOF.
+type DemuxerConfig struct {
+	MaxPackets  int
+	MaxBytes    int
+	Policy      OverflowPolicy
+	MaxFlows    int
+	IdleTimeout time.Duration
+}
+
+// demuxFlow is one remote's slice of a PacketDemuxer: its private
+// PacketBuffer, plus the idle-eviction timer armed for it.
+type demuxFlow struct {
+	addr       net.Addr
+	buffer     *PacketBuffer
+	lastActive time.Time
+	timer      *time.Timer
+}
+
+// PacketDemuxer reads datagrams off a single net.PacketConn and fans
+// them out to a private PacketBuffer per remote address, so server-side
+// DTLS/ICE code handling many client 5-tuples on one UDP socket doesn't
+// have to reimplement this demultiplexing itself. A newly observed
+// remote is surfaced through Accept; Get looks an already-observed
+// remote's buffer back up by address without waiting.
+type PacketDemuxer struct {
+	conn   net.PacketConn
+	config DemuxerConfig
+
+	mutex   sync.Mutex
+	flows   map[string]*demuxFlow
+	closed  bool
+	readErr error
+
+	accept chan *demuxFlow
+	done   chan struct{}
+}
+
+// NewPacketDemuxer creates a PacketDemuxer reading from conn, and
+// immediately starts its background read loop. Closing the returned
+// PacketDemuxer also closes conn.
+func NewPacketDemuxer(conn net.PacketConn, config DemuxerConfig) *PacketDemuxer {
+	d := &PacketDemuxer{
+		conn:   conn,
+		config: config,
+		flows:  make(map[string]*demuxFlow),
+		accept: make(chan *demuxFlow),
+		done:   make(chan struct{}),
+	}
+
+	go d.readLoop()
+
+	return d
+}
+
+// Accept blocks until a datagram arrives from a remote address not yet
+// tracked, and returns that remote's new PacketBuffer and address. Once
+// the read loop has stopped and every pending remote has been returned
+// this way, Accept returns the error that stopped it, or
+// ErrDemuxerClosed if it stopped because of a call to Close.
+func (d *PacketDemuxer) Accept() (*PacketBuffer, net.Addr, error) {
+	flow, ok := <-d.accept
+	if !ok {
+		if err := d.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrDemuxerClosed
+	}
+
+	return flow.buffer, flow.addr, nil
+}
+
+// Get returns the PacketBuffer already tracked for addr, or nil if no
+// datagram from addr has been observed yet, or its flow has since been
+// idle-evicted.
+func (d *PacketDemuxer) Get(addr net.Addr) *PacketBuffer {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	flow := d.flows[addr.String()]
+	if flow == nil {
+		return nil
+	}
+
+	return flow.buffer
+}
+
+// Err returns the error that stopped the read loop, or nil if it's
+// still running, or if it stopped cleanly via Close.
+func (d *PacketDemuxer) Err() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.readErr
+}
+
+// Close stops the read loop, closes conn, closes every tracked flow's
+// PacketBuffer, and unblocks a goroutine in Accept with
+// ErrDemuxerClosed. Close is idempotent.
+func (d *PacketDemuxer) Close() error {
+	err := d.conn.Close()
+	d.stop(nil)
+
+	return err
+}
+
+// readLoop is the PacketDemuxer's single reader: it owns conn and
+// repeatedly reads a datagram into a pooled buffer, dispatches it to the
+// addressed remote's flow (creating one if MaxFlows allows it), and
+// announces newly created flows over d.accept. It runs until conn
+// returns a read error or Close is called.
+func (d *PacketDemuxer) readLoop() {
+	for {
+		pooled := GetPooled(pooledPacketSize)
+
+		n, addr, err := d.conn.ReadFrom(pooled.Data)
+		if err != nil {
+			pooled.Recycle()
+			d.stop(err)
+
+			return
+		}
+
+		pooled.Data = pooled.Data[:n]
+		pooled.Addr = addr
+
+		flow, created := d.getOrCreateFlow(addr)
+		if flow == nil {
+			// At MaxFlows with no room for this new remote.
+			pooled.Recycle()
+
+			continue
+		}
+
+		if _, err := flow.buffer.WriteToPooled(pooled); err != nil {
+			pooled.Recycle()
+		}
+
+		if created != nil {
+			select {
+			case d.accept <- created:
+			case <-d.done:
+				return
+			}
+		}
+	}
+}
+
+// getOrCreateFlow returns addr's flow, resetting its idle timer, and
+// creates one -- returned again as created -- if addr wasn't already
+// tracked and MaxFlows allows it. Both return values are nil if addr is
+// new and the demuxer is already at MaxFlows.
+func (d *PacketDemuxer) getOrCreateFlow(addr net.Addr) (flow, created *demuxFlow) {
+	key := addr.String()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if flow, ok := d.flows[key]; ok {
+		d.resetIdleLocked(flow)
+
+		return flow, nil
+	}
+
+	if d.config.MaxFlows > 0 && len(d.flows) >= d.config.MaxFlows {
+		return nil, nil
+	}
+
+	flow = &demuxFlow{
+		addr:   addr,
+		buffer: NewBoundedPacketBuffer(d.config.MaxPackets, d.config.MaxBytes, d.config.Policy),
+	}
+	d.flows[key] = flow
+	d.resetIdleLocked(flow)
+
+	return flow, flow
+}
+
+// resetIdleLocked records flow as just having been active, and arms (or
+// rearms) its idle-eviction timer. The caller must hold d.mutex.
+func (d *PacketDemuxer) resetIdleLocked(flow *demuxFlow) {
+	flow.lastActive = time.Now()
+
+	if d.config.IdleTimeout <= 0 {
+		return
+	}
+
+	if flow.timer == nil {
+		flow.timer = time.AfterFunc(d.config.IdleTimeout, func() { d.checkIdle(flow) })
+
+		return
+	}
+
+	flow.timer.Reset(d.config.IdleTimeout)
+}
+
+// checkIdle evicts flow if it's been idle for at least IdleTimeout,
+// closing its PacketBuffer; otherwise, a reset raced with this timer
+// firing, so it reschedules for the remaining time instead.
+func (d *PacketDemuxer) checkIdle(flow *demuxFlow) {
+	d.mutex.Lock()
+
+	idleFor := time.Since(flow.lastActive)
+	if idleFor < d.config.IdleTimeout {
+		flow.timer.Reset(d.config.IdleTimeout - idleFor)
+		d.mutex.Unlock()
+
+		return
+	}
+
+	delete(d.flows, flow.addr.String())
+	d.mutex.Unlock()
+
+	flow.buffer.Close()
+}
+
+// stop marks the demuxer closed -- if it isn't already -- recording err,
+// then unblocks Accept and closes every tracked flow's PacketBuffer.
+func (d *PacketDemuxer) stop(err error) {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+
+		return
+	}
+
+	d.closed = true
+	d.readErr = err
+	flows := make([]*demuxFlow, 0, len(d.flows))
+	for _, flow := range d.flows {
+		flows = append(flows, flow)
+	}
+	d.flows = nil
+	d.mutex.Unlock()
+
+	close(d.done)
+	close(d.accept)
+
+	for _, flow := range flows {
+		if flow.timer != nil {
+			flow.timer.Stop()
+		}
+		flow.buffer.Close()
+	}
+}
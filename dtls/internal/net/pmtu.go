@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package net
+
+import (
+	"errors"
+	"net"
+)
+
+// errUnsupportedConn is returned by SetDF/DiscoveredMTU when pc is not a
+// *net.UDPConn, since the DF-bit/PMTU-discovery socket options below only
+// make sense for a UDP socket.
+var errUnsupportedConn = errors.New("pmtu: not a *net.UDPConn")
+
+// SetDF configures pc so the kernel sets the IPv4 Don't Fragment bit (or,
+// for IPv6, relies on there being no in-network fragmentation to begin
+// with) and reports EMSGSIZE -- or the platform's equivalent -- from a
+// write that would otherwise need to fragment, instead of silently
+// fragmenting it (IPv4) or having it dropped in transit (IPv6). The DTLS
+// handshake FSM's flightConn.writePackets should call this once, right
+// after dialing, so a write that's too big for the path surfaces as an
+// error it can react to (see DiscoveredMTU) rather than as a mysteriously
+// stalled handshake.
+//
+// Platform-specific implementations of setDF/discoveredMTU live in
+// pmtu_linux.go, pmtu_darwin.go, pmtu_windows.go, and pmtu_other.go (the
+// fallback for every other GOOS, which always fails). On darwin, pc must
+// be bound to a single address family -- net.ListenUDP("udp4", ...) or
+// net.ListenUDP("udp6", ...), not the dual-stack "udp" -- because xnu's
+// IP_DONTFRAG/IPV6_DONTFRAG only take effect per-family; see
+// pmtu_darwin.go.
+func SetDF(pc net.PacketConn) error {
+	return setDF(pc)
+}
+
+// DiscoveredMTU returns the path MTU the kernel learned from the write
+// that most recently failed with EMSGSIZE (or the platform's equivalent)
+// on pc. ok is false if the platform doesn't expose a learned MTU -- only
+// Linux's IP_MTU/IPV6_MTU getsockopt does; darwin and windows only report
+// "too big" without a usable size, so a caller there has to probe
+// downward (e.g. by halving the handshake fragment size) instead.
+func DiscoveredMTU(pc net.PacketConn) (mtu int, ok bool) {
+	return discoveredMTU(pc)
+}
+
+// isIPv6UDPConn reports whether conn's local address is an IPv6 address,
+// to choose between the IPv4 and IPv6 forms of each platform's socket
+// options. It treats an unspecified dual-stack address as IPv6 only if it
+// has no IPv4-mapped form, matching how net.ListenUDP("udp", ...)
+// resolves "" to "::" when the platform supports dual-stack sockets.
+func isIPv6UDPConn(conn *net.UDPConn) bool {
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+
+	return ok && addr.IP.To4() == nil
+}
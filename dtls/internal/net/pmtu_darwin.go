@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build darwin
+
+package net
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// errDualStackUnsupported is returned by setDF when pc's local address is
+// the IPv6 unspecified address, which net.ListenUDP("udp", ...) binds
+// dual-stack on darwin. Unlike Linux's IP_MTU_DISCOVER, xnu's
+// IP_DONTFRAG/IPV6_DONTFRAG only take effect on a socket bound to a
+// single address family, so there is no single option to set here;
+// callers on darwin must net.ListenUDP("udp4", ...) or
+// net.ListenUDP("udp6", ...) explicitly instead of the dual-stack "udp".
+var errDualStackUnsupported = errors.New("pmtu: darwin requires a udp4 or udp6 listener, not dual-stack udp")
+
+func setDF(pc net.PacketConn) error {
+	udpConn, ok := pc.(*net.UDPConn)
+	if !ok {
+		return errUnsupportedConn
+	}
+
+	addr, ok := udpConn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return errUnsupportedConn
+	}
+	if addr.IP == nil || addr.IP.IsUnspecified() && addr.IP.To4() == nil {
+		return errDualStackUnsupported
+	}
+
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if isIPv6UDPConn(udpConn) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG, 1)
+		} else {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_DONTFRAG, 1)
+		}
+	}); err != nil {
+		return err
+	}
+
+	return sockErr
+}
+
+// discoveredMTU always returns ok=false on darwin: xnu does not expose a
+// getsockopt to read the kernel's learned path MTU the way Linux's
+// IP_MTU/IPV6_MTU does, so a caller here only learns "too big" (EMSGSIZE)
+// from the failed write, not the actual size, and has to probe downward.
+func discoveredMTU(net.PacketConn) (int, bool) {
+	return 0, false
+}
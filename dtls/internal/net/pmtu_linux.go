@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package net
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDF enables kernel path-MTU discovery on pc via
+// IP_MTU_DISCOVER=IP_PMTUDISC_DO (IPv4) or IPV6_MTU_DISCOVER=
+// IPV6_PMTUDISC_DO (IPv6): the kernel sets DF on every outgoing datagram
+// and a write that would need fragmentation fails with EMSGSIZE instead
+// of being silently fragmented.
+func setDF(pc net.PacketConn) error {
+	udpConn, ok := pc.(*net.UDPConn)
+	if !ok {
+		return errUnsupportedConn
+	}
+
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if isIPv6UDPConn(udpConn) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DO)
+		} else {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO)
+		}
+	}); err != nil {
+		return err
+	}
+
+	return sockErr
+}
+
+// discoveredMTU reads the path MTU the kernel learned from the ICMP
+// "fragmentation needed"/"packet too big" message that produced the
+// write's EMSGSIZE, via the IP_MTU/IPV6_MTU getsockopt.
+func discoveredMTU(pc net.PacketConn) (int, bool) {
+	udpConn, ok := pc.(*net.UDPConn)
+	if !ok {
+		return 0, false
+	}
+
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var mtu int
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if isIPv6UDPConn(udpConn) {
+			mtu, sockErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU)
+		} else {
+			mtu, sockErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU)
+		}
+	}); err != nil || sockErr != nil {
+		return 0, false
+	}
+
+	return mtu, true
+}
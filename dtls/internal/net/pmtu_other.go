@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux && !darwin && !windows
+
+package net
+
+import (
+	"errors"
+	"net"
+)
+
+// errUnsupportedPlatform is returned by setDF on every GOOS other than
+// linux, darwin, and windows, which do not have a setDF/discoveredMTU
+// implementation in this package.
+var errUnsupportedPlatform = errors.New("pmtu: DF-bit control is not implemented on this platform")
+
+func setDF(net.PacketConn) error {
+	return errUnsupportedPlatform
+}
+
+func discoveredMTU(net.PacketConn) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package net
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSetDFRejectsNonUDPConn(t *testing.T) {
+	conn := newFakePacketConn()
+	defer conn.Close()
+
+	if err := SetDF(conn); err != errUnsupportedConn {
+		t.Fatalf("SetDF on a non-*net.UDPConn returned %v, wanted errUnsupportedConn", err)
+	}
+}
+
+func TestDiscoveredMTURejectsNonUDPConn(t *testing.T) {
+	conn := newFakePacketConn()
+	defer conn.Close()
+
+	if _, ok := DiscoveredMTU(conn); ok {
+		t.Fatal("DiscoveredMTU on a non-*net.UDPConn returned ok=true")
+	}
+}
+
+func TestSetDFOnLoopbackUDP(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Every supported platform (linux, darwin, windows) can set the DF
+	// bit on an IPv4 socket; only pmtu_other.go's fallback fails, and
+	// this test only runs where internal/net itself can be built.
+	if err := SetDF(conn); err != nil {
+		t.Fatalf("SetDF on a loopback UDP4 socket failed: %v", err)
+	}
+}
+
+func TestIsIPv6UDPConn(t *testing.T) {
+	conn4, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn4.Close()
+
+	if isIPv6UDPConn(conn4) {
+		t.Fatal("isIPv6UDPConn reported true for a udp4 socket")
+	}
+
+	conn6, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer conn6.Close()
+
+	if !isIPv6UDPConn(conn6) {
+		t.Fatal("isIPv6UDPConn reported false for a udp6 socket")
+	}
+}
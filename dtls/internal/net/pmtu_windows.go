@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package net
+
+import (
+	"net"
+
+	"golang.org/x/sys/windows"
+)
+
+// setDF enables Don't Fragment on pc via IP_DONTFRAGMENT (IPv4) or
+// IPV6_DONTFRAG (IPv6), Winsock's equivalents of Linux's
+// IP_MTU_DISCOVER=IP_PMTUDISC_DO.
+func setDF(pc net.PacketConn) error {
+	udpConn, ok := pc.(*net.UDPConn)
+	if !ok {
+		return errUnsupportedConn
+	}
+
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if isIPv6UDPConn(udpConn) {
+			sockErr = windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IPV6, windows.IPV6_DONTFRAG, 1)
+		} else {
+			sockErr = windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IP, windows.IP_DONTFRAGMENT, 1)
+		}
+	}); err != nil {
+		return err
+	}
+
+	return sockErr
+}
+
+// discoveredMTU always returns ok=false on windows: learning the path MTU
+// Winsock discovered requires overlapped I/O (WSAGetOverlappedResult's
+// extended error data on a WSAEMSGSIZE completion), which this package's
+// synchronous net.UDPConn usage does not set up. A caller here only
+// learns "too big" from the failed write, not the actual size.
+func discoveredMTU(net.PacketConn) (int, bool) {
+	return 0, false
+}
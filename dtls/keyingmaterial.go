@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+)
+
+// errReservedExporterLabel is returned by exportKeyingMaterial12 and
+// exportKeyingMaterial13 for a label TLS/DTLS itself uses internally,
+// analogous to crypto/tls's identical check in ExportKeyingMaterial:
+// allowing an application to pick one of these would let it derive values
+// that collide with the handshake's own secrets.
+func errReservedExporterLabel(label string) error {
+	return fmt.Errorf("dtls: reserved ExportKeyingMaterial label: %s", label)
+}
+
+// checkExporterLabel rejects the four labels RFC 5705 reserves for
+// internal TLS/DTLS use. It does not reject the "EXPORTER-" prefix itself:
+// that prefix is how the IANA TLS Exporter Label registry names exporters
+// for higher-layer protocols (e.g. "EXPORTER-Channel-Binding", RFC 9266),
+// and is the normal, expected form of a caller-supplied label.
+func checkExporterLabel(label string) error {
+	switch label {
+	case "client finished", "server finished", "master secret", "key expansion":
+		return errReservedExporterLabel(label)
+	}
+
+	return nil
+}
+
+// exportKeyingMaterialSeed builds the PRF seed used by
+// State.ExportKeyingMaterial, as defined in RFC 5705 Section 4. The label
+// and, depending on perspective, the local/remote randoms always form the
+// seed's prefix; when withContext is true the seed gains a two-byte
+// big-endian length followed by context, even when context itself is empty
+// -- RFC 5705 requires a zero-length context to remain distinguishable from
+// no context being supplied at all, since the two change the exported value
+// differently.
+func exportKeyingMaterialSeed(
+	label string,
+	localRandom, remoteRandom []byte,
+	isClient bool,
+	withContext bool,
+	context []byte,
+) []byte {
+	seed := make([]byte, 0, len(label)+len(localRandom)+len(remoteRandom)+2+len(context))
+	seed = append(seed, label...)
+	if isClient {
+		seed = append(seed, localRandom...)
+		seed = append(seed, remoteRandom...)
+	} else {
+		seed = append(seed, remoteRandom...)
+		seed = append(seed, localRandom...)
+	}
+	if withContext {
+		seed = binary.BigEndian.AppendUint16(seed, uint16(len(context)))
+		seed = append(seed, context...)
+	}
+
+	return seed
+}
+
+// pHash implements the TLS 1.0-1.2 PRF's P_hash(secret, seed) expansion
+// function (RFC 5246 Section 5): iterated HMAC over a chain
+// A(0) = seed, A(i) = HMAC_hash(secret, A(i-1)), truncated to length bytes.
+func pHash(hash crypto.Hash, secret, seed []byte, length int) []byte {
+	h := hmac.New(hash.New, secret)
+
+	a := seed
+	result := make([]byte, 0, length)
+	for len(result) < length {
+		h.Reset()
+		h.Write(a)
+		a = h.Sum(nil)
+
+		h.Reset()
+		h.Write(a)
+		h.Write(seed)
+		result = h.Sum(result)
+	}
+
+	return result[:length]
+}
+
+// exportKeyingMaterial12 implements RFC 5705 keying material export for
+// DTLS 1.2: PRF(master_secret, label, client_random + server_random, and
+// optionally a length-prefixed context)[length], using the TLS 1.2 PRF
+// (RFC 5246 Section 5, P_hash keyed on masterSecret's cipher suite hash).
+//
+// Wiring this into a Conn.ExportKeyingMaterial method requires access to
+// the negotiated master secret, cipher suite hash and handshake randoms
+// this fork's State does not expose; this function only provides the pure
+// RFC 5705 computation those would be threaded into.
+func exportKeyingMaterial12(
+	hash crypto.Hash,
+	masterSecret, localRandom, remoteRandom []byte,
+	isClient bool,
+	label string,
+	context []byte,
+	withContext bool,
+	length int,
+) ([]byte, error) {
+	if err := checkExporterLabel(label); err != nil {
+		return nil, err
+	}
+
+	seed := exportKeyingMaterialSeed(label, localRandom, remoteRandom, isClient, withContext, context)
+
+	return pHash(hash, masterSecret, seed, length), nil
+}
+
+// exportKeyingMaterial13 implements RFC 5705 keying material export for
+// DTLS 1.3, per the TLS 1.3 exporter interface DTLS 1.3 reuses unchanged
+// (RFC 9147 Section 5.8, RFC 8446 Section 7.5):
+//
+//	derived_secret  = Derive-Secret(exporterMasterSecret, label, "")
+//	exported_value  = HKDF-Expand-Label(derived_secret, "exporter",
+//	                      Hash(context), length)
+//
+// Wiring this into a Conn.ExportKeyingMaterial method requires the
+// exporter_master_secret this fork's DTLS 1.3 key schedule
+// (handshakeTrafficSecrets, applicationTrafficSecrets) does not yet derive;
+// this function only provides the pure RFC 8446 Section 7.5 computation.
+func exportKeyingMaterial13(
+	hash crypto.Hash,
+	exporterMasterSecret []byte,
+	label string,
+	context []byte,
+	length int,
+) ([]byte, error) {
+	if err := checkExporterLabel(label); err != nil {
+		return nil, err
+	}
+
+	emptyTranscriptHash := hash.New().Sum(nil)
+	derivedSecret, err := deriveSecret(hash, exporterMasterSecret, label, emptyTranscriptHash)
+	if err != nil {
+		return nil, err
+	}
+
+	contextHash := hash.New()
+	contextHash.Write(context)
+
+	return hkdfExpandLabel(hash, derivedSecret, contextHash.Sum(nil), "exporter", length)
+}
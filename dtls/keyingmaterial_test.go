@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // register SHA-256 with the crypto package
+	"testing"
+)
+
+func TestExportKeyingMaterialSeed(t *testing.T) {
+	label := "EXTRACTOR-dtls_srtp"
+	localRandom := bytes.Repeat([]byte{0x11}, 32)
+	remoteRandom := bytes.Repeat([]byte{0x22}, 32)
+
+	noContext := exportKeyingMaterialSeed(label, localRandom, remoteRandom, true, false, nil)
+	emptyContext := exportKeyingMaterialSeed(label, localRandom, remoteRandom, true, true, nil)
+	if bytes.Equal(noContext, emptyContext) {
+		t.Fatal("a nil context and an explicit empty context must produce different seeds")
+	}
+	if len(emptyContext) != len(noContext)+2 {
+		t.Fatalf("empty context seed should only add the 2-byte length prefix, got %d extra bytes",
+			len(emptyContext)-len(noContext))
+	}
+
+	withContext := exportKeyingMaterialSeed(label, localRandom, remoteRandom, true, true, []byte("channel-binding"))
+	if !bytes.HasPrefix(withContext, noContext) {
+		t.Fatal("seed with context must extend the no-context seed")
+	}
+
+	clientSeed := exportKeyingMaterialSeed(label, localRandom, remoteRandom, true, false, nil)
+	serverSeed := exportKeyingMaterialSeed(label, localRandom, remoteRandom, false, false, nil)
+	if bytes.Equal(clientSeed, serverSeed) {
+		t.Fatal("client and server perspectives must order the randoms differently")
+	}
+}
+
+func TestCheckExporterLabel(t *testing.T) {
+	for _, label := range []string{"client finished", "server finished", "master secret", "key expansion"} {
+		if err := checkExporterLabel(label); err == nil {
+			t.Fatalf("expected %q to be rejected as a reserved label", label)
+		}
+	}
+
+	for _, label := range []string{"EXTRACTOR-dtls_srtp", "EXPORTER-Channel-Binding"} {
+		if err := checkExporterLabel(label); err != nil {
+			t.Fatalf("expected %q to be accepted, got %v", label, err)
+		}
+	}
+}
+
+func TestExportKeyingMaterial12PeerAgreement(t *testing.T) {
+	clientRandom := bytes.Repeat([]byte{0x11}, 32)
+	serverRandom := bytes.Repeat([]byte{0x22}, 32)
+	masterSecret := bytes.Repeat([]byte{0x33}, 48)
+
+	clientSide, err := exportKeyingMaterial12(
+		crypto.SHA256, masterSecret, clientRandom, serverRandom, true, "EXTRACTOR-dtls_srtp", nil, false, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSide, err := exportKeyingMaterial12(
+		crypto.SHA256, masterSecret, serverRandom, clientRandom, false, "EXTRACTOR-dtls_srtp", nil, false, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(clientSide, serverSide) {
+		t.Fatalf("client and server exported different keying material: %x != %x", clientSide, serverSide)
+	}
+}
+
+func TestExportKeyingMaterial12RejectsReservedLabel(t *testing.T) {
+	_, err := exportKeyingMaterial12(crypto.SHA256, nil, nil, nil, true, "master secret", nil, false, 16)
+	if err == nil {
+		t.Fatal("expected an error for a reserved label")
+	}
+}
+
+func TestExportKeyingMaterial13PeerAgreement(t *testing.T) {
+	exporterMasterSecret := bytes.Repeat([]byte{0x44}, 32)
+	context := []byte("channel-binding")
+
+	a, err := exportKeyingMaterial13(crypto.SHA256, exporterMasterSecret, "EXPORTER-Channel-Binding", context, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := exportKeyingMaterial13(crypto.SHA256, exporterMasterSecret, "EXPORTER-Channel-Binding", context, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(a, b) {
+		t.Fatalf("exporting the same label/context twice should be deterministic: %x != %x", a, b)
+	}
+
+	differentContext, err := exportKeyingMaterial13(crypto.SHA256, exporterMasterSecret, "EXPORTER-Channel-Binding", []byte("other"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, differentContext) {
+		t.Fatal("exporting with a different context should produce different keying material")
+	}
+}
+
+func TestExportKeyingMaterial13RejectsReservedLabel(t *testing.T) {
+	_, err := exportKeyingMaterial13(crypto.SHA256, bytes.Repeat([]byte{0x01}, 32), "key expansion", nil, 16)
+	if err == nil {
+		t.Fatal("expected an error for a reserved label")
+	}
+}
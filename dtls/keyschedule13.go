@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+// This file implements the pure HKDF secret-derivation steps of the DTLS
+// 1.3 key schedule (RFC 9147 Section 5.8). It does not add DTLS 1.3
+// handshake support on its own: flight0Parse (flight0handler.go) still
+// rejects any ClientHello whose version isn't protocol.Version1_2, so
+// nothing in handshaker.go ever calls these functions yet. A real 1.3
+// handshake additionally needs a negotiated flight path (HelloRetryRequest,
+// key_share, epoch-switched encrypted records), none of which exists in
+// this fork.
+
+import (
+	"crypto"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// earlySecret derives the DTLS 1.3 key schedule's early_secret (RFC 9147
+// Section 5.8, RFC 8446 Section 7.1) from a resumption PSK: the key
+// schedule's first HKDF-Extract, salted with a zero string of the hash's
+// length rather than a prior secret.
+func earlySecret(hash crypto.Hash, psk []byte) []byte {
+	return hkdf.Extract(hash.New, psk, make([]byte, hash.Size()))
+}
+
+// clientEarlyTrafficSecret derives the client_early_traffic_secret used to
+// protect 0-RTT application data (RFC 9147 Section 5.8, RFC 8446
+// Section 7.1), the key-schedule step taken directly from earlySecret.
+// helloTranscriptHash is the transcript hash through ClientHello.
+//
+// A full 0-RTT flow additionally needs a Conn-level early-data write path
+// and a server-side accept/reject decision communicated via
+// EncryptedExtensions, neither of which exist in this fork; this function
+// only provides the pure key-schedule step.
+func clientEarlyTrafficSecret(hash crypto.Hash, earlySecretValue, helloTranscriptHash []byte) ([]byte, error) {
+	return deriveSecret(hash, earlySecretValue, "c e traffic", helloTranscriptHash)
+}
+
+// deriveSecret implements the Derive-Secret function used by the DTLS 1.3
+// key schedule (RFC 9147 Section 5.8), which mirrors TLS 1.3's Derive-Secret
+// (RFC 8446 Section 7.1):
+//
+//	Derive-Secret(Secret, Label, Messages) =
+//	    HKDF-Expand-Label(Secret, Label, Transcript-Hash(Messages), Hash.length)
+//
+// transcriptHash is the caller-computed running transcript hash through the
+// messages the label calls for; this function does not hash the transcript
+// itself.
+func deriveSecret(hash crypto.Hash, secret []byte, label string, transcriptHash []byte) ([]byte, error) {
+	return hkdfExpandLabel(hash, secret, transcriptHash, label, hash.Size())
+}
+
+// handshakeSecret derives the DTLS 1.3 key schedule's Handshake Secret
+// (RFC 9147 Section 5.8, RFC 8446 Section 7.1): the second HKDF-Extract,
+// salted with Derive-Secret(earlySecretValue, "derived", "") and keyed on
+// the (EC)DHE shared secret. This is the step between earlySecret and
+// handshakeTrafficSecrets.
+func handshakeSecret(hash crypto.Hash, earlySecretValue, sharedSecret []byte) ([]byte, error) {
+	salt, err := deriveSecret(hash, earlySecretValue, "derived", emptyHash(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	return hkdf.Extract(hash.New, sharedSecret, salt), nil
+}
+
+// masterSecret13 derives the DTLS 1.3 key schedule's Master Secret
+// (RFC 9147 Section 5.8, RFC 8446 Section 7.1): the final HKDF-Extract,
+// salted with Derive-Secret(handshakeSecretValue, "derived", "") and keyed
+// on a zero string of the hash's length. applicationTrafficSecrets derives
+// from the result.
+func masterSecret13(hash crypto.Hash, handshakeSecretValue []byte) ([]byte, error) {
+	salt, err := deriveSecret(hash, handshakeSecretValue, "derived", emptyHash(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	return hkdf.Extract(hash.New, make([]byte, hash.Size()), salt), nil
+}
+
+// emptyHash returns hash.Hash()'s digest of the empty string, the
+// transcript hash Derive-Secret's "derived" step always uses since it
+// runs between key-schedule stages rather than over any handshake
+// messages.
+func emptyHash(hash crypto.Hash) []byte {
+	h := hash.New()
+
+	return h.Sum(nil)
+}
+
+// handshakeTrafficSecrets derives the client_handshake_traffic_secret and
+// server_handshake_traffic_secret from the handshake secret, the next step
+// of the DTLS 1.3 key schedule (RFC 9147 Section 5.8) after the initial
+// HKDF-Extract over the (EC)DHE shared secret. helloTranscriptHash is the
+// transcript hash through ServerHello.
+//
+// A full DTLS 1.3 handshake additionally needs a Conn-level state machine to
+// negotiate key_share, send HelloRetryRequest, and switch record-layer
+// epochs mid-flight, none of which exist in this fork; this function only
+// provides the pure key-schedule step built on top of the
+// hkdfExpandLabel/updateTrafficSecret primitives already used for DTLS 1.3
+// KeyUpdate.
+func handshakeTrafficSecrets(
+	hash crypto.Hash,
+	handshakeSecret, helloTranscriptHash []byte,
+) (clientSecret, serverSecret []byte, err error) {
+	clientSecret, err = deriveSecret(hash, handshakeSecret, "c hs traffic", helloTranscriptHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverSecret, err = deriveSecret(hash, handshakeSecret, "s hs traffic", helloTranscriptHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clientSecret, serverSecret, nil
+}
+
+// applicationTrafficSecrets derives the client_application_traffic_secret_0
+// and server_application_traffic_secret_0 from the master secret, the final
+// step of the DTLS 1.3 key schedule (RFC 9147 Section 5.8) before the first
+// KeyUpdate. fullTranscriptHash is the transcript hash through the server's
+// Finished message.
+func applicationTrafficSecrets(
+	hash crypto.Hash,
+	masterSecret, fullTranscriptHash []byte,
+) (clientSecret, serverSecret []byte, err error) {
+	clientSecret, err = deriveSecret(hash, masterSecret, "c ap traffic", fullTranscriptHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverSecret, err = deriveSecret(hash, masterSecret, "s ap traffic", fullTranscriptHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clientSecret, serverSecret, nil
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+)
+
+func TestHandshakeTrafficSecrets(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x11}, crypto.SHA256.Size())
+	transcriptHash := bytes.Repeat([]byte{0x22}, crypto.SHA256.Size())
+
+	client, server, err := handshakeTrafficSecrets(crypto.SHA256, secret, transcriptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client) != crypto.SHA256.Size() || len(server) != crypto.SHA256.Size() {
+		t.Fatalf("expected %d-byte secrets, got client=%d server=%d", crypto.SHA256.Size(), len(client), len(server))
+	}
+	if bytes.Equal(client, server) {
+		t.Fatal("client and server handshake traffic secrets must differ")
+	}
+
+	clientAgain, serverAgain, err := handshakeTrafficSecrets(crypto.SHA256, secret, transcriptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(client, clientAgain) || !bytes.Equal(server, serverAgain) {
+		t.Fatal("handshakeTrafficSecrets must be deterministic for the same input")
+	}
+}
+
+func TestEarlySecretDeterministic(t *testing.T) {
+	psk := bytes.Repeat([]byte{0x55}, 32)
+
+	a := earlySecret(crypto.SHA256, psk)
+	b := earlySecret(crypto.SHA256, psk)
+	if !bytes.Equal(a, b) {
+		t.Fatal("earlySecret must be deterministic for the same PSK")
+	}
+	if len(a) != crypto.SHA256.Size() {
+		t.Fatalf("expected a %d-byte secret, got %d", crypto.SHA256.Size(), len(a))
+	}
+
+	other := earlySecret(crypto.SHA256, bytes.Repeat([]byte{0x66}, 32))
+	if bytes.Equal(a, other) {
+		t.Fatal("earlySecret must differ for a different PSK")
+	}
+}
+
+func TestClientEarlyTrafficSecret(t *testing.T) {
+	secret := earlySecret(crypto.SHA256, bytes.Repeat([]byte{0x77}, 32))
+	transcriptHash := bytes.Repeat([]byte{0x88}, crypto.SHA256.Size())
+
+	a, err := clientEarlyTrafficSecret(crypto.SHA256, secret, transcriptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != crypto.SHA256.Size() {
+		t.Fatalf("expected a %d-byte secret, got %d", crypto.SHA256.Size(), len(a))
+	}
+
+	otherTranscript := bytes.Repeat([]byte{0x99}, crypto.SHA256.Size())
+	b, err := clientEarlyTrafficSecret(crypto.SHA256, secret, otherTranscript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, b) {
+		t.Fatal("clientEarlyTrafficSecret must differ for a different transcript hash")
+	}
+}
+
+func TestHandshakeSecretDeterministic(t *testing.T) {
+	early := earlySecret(crypto.SHA256, make([]byte, crypto.SHA256.Size()))
+	sharedSecret := bytes.Repeat([]byte{0xab}, 32)
+
+	a, err := handshakeSecret(crypto.SHA256, early, sharedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != crypto.SHA256.Size() {
+		t.Fatalf("expected a %d-byte secret, got %d", crypto.SHA256.Size(), len(a))
+	}
+
+	b, err := handshakeSecret(crypto.SHA256, early, sharedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatal("handshakeSecret must be deterministic for the same inputs")
+	}
+
+	otherShared := bytes.Repeat([]byte{0xcd}, 32)
+	c, err := handshakeSecret(crypto.SHA256, early, otherShared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, c) {
+		t.Fatal("handshakeSecret must differ for a different shared secret")
+	}
+}
+
+func TestMasterSecret13Deterministic(t *testing.T) {
+	hs := bytes.Repeat([]byte{0xef}, crypto.SHA256.Size())
+
+	a, err := masterSecret13(crypto.SHA256, hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != crypto.SHA256.Size() {
+		t.Fatalf("expected a %d-byte secret, got %d", crypto.SHA256.Size(), len(a))
+	}
+
+	b, err := masterSecret13(crypto.SHA256, hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatal("masterSecret13 must be deterministic for the same input")
+	}
+
+	otherHS := bytes.Repeat([]byte{0x12}, crypto.SHA256.Size())
+	c, err := masterSecret13(crypto.SHA256, otherHS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, c) {
+		t.Fatal("masterSecret13 must differ for a different handshake secret")
+	}
+}
+
+// TestKeySchedule13FullChain exercises earlySecret → handshakeSecret →
+// masterSecret13 → applicationTrafficSecrets end to end, confirming the
+// chain composes the way RFC 9147 Section 5.8 lays it out even though
+// this fork has no Conn/State machinery to drive it from a live
+// handshake.
+func TestKeySchedule13FullChain(t *testing.T) {
+	early := earlySecret(crypto.SHA256, make([]byte, crypto.SHA256.Size()))
+	sharedSecret := bytes.Repeat([]byte{0x01}, 32)
+
+	hs, err := handshakeSecret(crypto.SHA256, early, sharedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	helloTranscriptHash := bytes.Repeat([]byte{0x02}, crypto.SHA256.Size())
+	clientHS, serverHS, err := handshakeTrafficSecrets(crypto.SHA256, hs, helloTranscriptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(clientHS, serverHS) {
+		t.Fatal("client and server handshake traffic secrets must differ")
+	}
+
+	master, err := masterSecret13(crypto.SHA256, hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finishedTranscriptHash := bytes.Repeat([]byte{0x03}, crypto.SHA256.Size())
+	clientAP, serverAP, err := applicationTrafficSecrets(crypto.SHA256, master, finishedTranscriptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(clientAP, serverAP) {
+		t.Fatal("client and server application traffic secrets must differ")
+	}
+	if bytes.Equal(clientAP, clientHS) {
+		t.Fatal("application and handshake traffic secrets must differ")
+	}
+}
+
+func TestApplicationTrafficSecrets(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x33}, crypto.SHA256.Size())
+	transcriptHash := bytes.Repeat([]byte{0x44}, crypto.SHA256.Size())
+
+	client, server, err := applicationTrafficSecrets(crypto.SHA256, secret, transcriptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client) != crypto.SHA256.Size() || len(server) != crypto.SHA256.Size() {
+		t.Fatalf("expected %d-byte secrets, got client=%d server=%d", crypto.SHA256.Size(), len(client), len(server))
+	}
+	if bytes.Equal(client, server) {
+		t.Fatal("client and server application traffic secrets must differ")
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto"
+	_ "crypto/sha256" // register SHA-256 with the crypto package
+	_ "crypto/sha512" // register SHA-384/512 with the crypto package
+	"encoding/binary"
+	"io"
+
+	"github.com/pion/dtls/v3/pkg/protocol/handshake"
+	"golang.org/x/crypto/hkdf"
+)
+
+// This file has no Conn-level entry point: there is no Conn.KeyUpdate or
+// Conn.SendKeyUpdate a caller can invoke, and no receive-side handling of a
+// peer's KeyUpdate in handleIncomingPacket. prepareKeyUpdate only computes
+// the message and next secret; nothing in this fork sends it, switches the
+// record-layer epoch, or reacts to one arriving.
+const hkdfLabelPrefix = "dtls13 "
+
+// hkdfExpandLabel implements the HKDF-Expand-Label construction used by
+// DTLS 1.3 key derivation (RFC 9147 Section 5.8), which mirrors TLS 1.3's
+// HKDF-Expand-Label (RFC 8446 Section 7.1) with the "dtls13 " label prefix
+// in place of "tls13 ".
+func hkdfExpandLabel(hash crypto.Hash, secret, context []byte, label string, length int) ([]byte, error) {
+	fullLabel := hkdfLabelPrefix + label
+
+	hkdfLabel := make([]byte, 0, 2+1+len(fullLabel)+1+len(context))
+	hkdfLabel = binary.BigEndian.AppendUint16(hkdfLabel, uint16(length))
+	hkdfLabel = append(hkdfLabel, byte(len(fullLabel)))
+	hkdfLabel = append(hkdfLabel, fullLabel...)
+	hkdfLabel = append(hkdfLabel, byte(len(context)))
+	hkdfLabel = append(hkdfLabel, context...)
+
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(hash.New, secret, hkdfLabel), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// updateTrafficSecret derives the next traffic secret from the current one
+// using the "traffic upd" label, as specified for post-handshake KeyUpdate
+// messages in RFC 9147 Section 5.8. The returned secret has the same length
+// as hash's output size and is used to derive fresh traffic keys at an
+// incremented epoch, whether rotating our own outbound keys or installing
+// the peer's after it sends a KeyUpdate.
+func updateTrafficSecret(hash crypto.Hash, secret []byte) ([]byte, error) {
+	return hkdfExpandLabel(hash, secret, nil, "traffic upd", hash.Size())
+}
+
+// prepareKeyUpdate builds the post-handshake KeyUpdate message to send for a
+// rotation keyUpdateTracker decided is due, and the traffic secret to
+// install at the next epoch once that message has actually gone out.
+// requestUpdate asks the peer to in turn rotate and send its own KeyUpdate.
+//
+// Sending the message, bumping the record-layer epoch only after it is
+// written, and receive-side handling of the peer's KeyUpdate all require a
+// Conn capable of driving a post-handshake flight, which this fork does not
+// implement; this function only provides the pure step of going from
+// "a rotation is due" to "here is the message and the next secret".
+func prepareKeyUpdate(
+	hash crypto.Hash,
+	currentTrafficSecret []byte,
+	requestUpdate bool,
+) (*handshake.MessageKeyUpdate, []byte, error) {
+	nextSecret, err := updateTrafficSecret(hash, currentTrafficSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &handshake.MessageKeyUpdate{UpdateRequested: requestUpdate}, nextSecret, nil
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+)
+
+func TestUpdateTrafficSecret(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x42}, crypto.SHA256.Size())
+
+	updated, err := updateTrafficSecret(crypto.SHA256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != crypto.SHA256.Size() {
+		t.Fatalf("expected %d-byte secret, got %d", crypto.SHA256.Size(), len(updated))
+	}
+	if bytes.Equal(updated, secret) {
+		t.Fatal("updated traffic secret must differ from the input secret")
+	}
+
+	updatedAgain, err := updateTrafficSecret(crypto.SHA256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(updated, updatedAgain) {
+		t.Fatal("updateTrafficSecret must be deterministic for the same input")
+	}
+}
+
+func TestPrepareKeyUpdate(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x24}, crypto.SHA256.Size())
+
+	msg, nextSecret, err := prepareKeyUpdate(crypto.SHA256, secret, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.UpdateRequested {
+		t.Fatal("expected UpdateRequested to be carried through")
+	}
+
+	wantSecret, err := updateTrafficSecret(crypto.SHA256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nextSecret, wantSecret) {
+		t.Fatal("prepareKeyUpdate's next secret must match updateTrafficSecret")
+	}
+
+	msg, _, err = prepareKeyUpdate(crypto.SHA256, secret, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.UpdateRequested {
+		t.Fatal("expected UpdateRequested to be false")
+	}
+}
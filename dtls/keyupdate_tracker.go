@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+// keyUpdateTracker counts bytes and records sent on the current epoch and
+// reports when Config.KeyUpdateAfterBytes/KeyUpdateAfterRecords has been
+// reached, so a caller can trigger a post-handshake KeyUpdate before an AEAD
+// nonce is reused or a sequence number wraps.
+//
+// Actually sending and handling KeyUpdate handshake messages, bumping the
+// record-layer epoch, and switching to the next traffic secret (derived via
+// updateTrafficSecret) requires a Conn capable of driving a post-handshake
+// flight, which this fork does not implement; this tracker only decides
+// when such a rotation should happen. There is no Conn.KeyUpdate or
+// Conn.SendKeyUpdate method anywhere in this package, so nothing currently
+// calls recordSent or acts on its result.
+type keyUpdateTracker struct {
+	afterBytes   uint64
+	afterRecords uint64
+
+	bytesSent   uint64
+	recordsSent uint64
+}
+
+// newKeyUpdateTracker returns a tracker that signals a KeyUpdate once
+// afterBytes bytes or afterRecords records have been sent, whichever comes
+// first. A zero threshold disables that trigger.
+func newKeyUpdateTracker(afterBytes, afterRecords uint64) *keyUpdateTracker {
+	return &keyUpdateTracker{afterBytes: afterBytes, afterRecords: afterRecords}
+}
+
+// recordSent accounts for a record of n bytes having been sent on the
+// current epoch and reports whether a KeyUpdate should now be triggered.
+func (t *keyUpdateTracker) recordSent(n uint64) bool {
+	t.bytesSent += n
+	t.recordsSent++
+
+	return (t.afterBytes > 0 && t.bytesSent >= t.afterBytes) ||
+		(t.afterRecords > 0 && t.recordsSent >= t.afterRecords)
+}
+
+// reset zeroes the counters, e.g. once a KeyUpdate has rotated the epoch.
+func (t *keyUpdateTracker) reset() {
+	t.bytesSent = 0
+	t.recordsSent = 0
+}
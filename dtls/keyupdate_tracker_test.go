@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import "testing"
+
+func TestKeyUpdateTracker(t *testing.T) {
+	t.Run("triggers once the byte threshold is reached", func(t *testing.T) {
+		tracker := newKeyUpdateTracker(100, 0)
+
+		if tracker.recordSent(60) {
+			t.Fatal("did not expect a trigger before the byte threshold")
+		}
+		if !tracker.recordSent(60) {
+			t.Fatal("expected a trigger once cumulative bytes reach the threshold")
+		}
+	})
+
+	t.Run("triggers once the record threshold is reached", func(t *testing.T) {
+		tracker := newKeyUpdateTracker(0, 2)
+
+		if tracker.recordSent(1) {
+			t.Fatal("did not expect a trigger before the record threshold")
+		}
+		if !tracker.recordSent(1) {
+			t.Fatal("expected a trigger once the record count reaches the threshold")
+		}
+	})
+
+	t.Run("reset clears the counters", func(t *testing.T) {
+		tracker := newKeyUpdateTracker(10, 0)
+		tracker.recordSent(10)
+		tracker.reset()
+
+		if tracker.recordSent(1) {
+			t.Fatal("expected the tracker to need a fresh threshold after reset")
+		}
+	})
+
+	t.Run("zero thresholds never trigger", func(t *testing.T) {
+		tracker := newKeyUpdateTracker(0, 0)
+
+		for i := 0; i < 1000; i++ {
+			if tracker.recordSent(1000) {
+				t.Fatal("a zero threshold must never trigger")
+			}
+		}
+	})
+}
@@ -42,7 +42,13 @@ func generateAEADAdditionalData(h *recordlayer.Header, payloadLen int) []byte {
 
 // generateAEADAdditionalDataCID generates additional data for AEAD ciphers
 // according to https://datatracker.ietf.org/doc/html/rfc9146#name-aead-ciphers
-func generateAEADAdditionalDataCID(h *recordlayer.Header, payloadLen int) []byte {
+//
+// It returns an error rather than panicking if the builder failed partway
+// through (e.g. a ConnectionID too long to fit the uint8 length prefix
+// above), since this is reached from the record-protection path on every
+// write and a panic here would crash the whole process rather than just
+// failing the one record.
+func generateAEADAdditionalDataCID(h *recordlayer.Header, payloadLen int) ([]byte, error) {
 	var b cryptobyte.Builder
 
 	b.AddUint64(seqNumPlaceholder)
@@ -56,5 +62,5 @@ func generateAEADAdditionalDataCID(h *recordlayer.Header, payloadLen int) []byte
 	b.AddBytes(h.ConnectionID)
 	b.AddUint16(uint16(payloadLen))
 
-	return b.BytesOrPanic()
+	return b.Bytes()
 }
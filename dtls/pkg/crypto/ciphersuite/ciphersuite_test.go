@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ciphersuite
+
+import (
+	"testing"
+
+	"github.com/pion/dtls/v3/pkg/protocol/recordlayer"
+)
+
+func TestGenerateAEADAdditionalDataCIDDoesNotPanic(t *testing.T) {
+	h := &recordlayer.Header{
+		Epoch:          1,
+		SequenceNumber: 2,
+		ConnectionID:   []byte{0x01, 0x02, 0x03, 0x04},
+	}
+
+	additionalData, err := generateAEADAdditionalDataCID(h, 64)
+	if err != nil {
+		t.Fatalf("generateAEADAdditionalDataCID returned an error: %v", err)
+	}
+	if len(additionalData) == 0 {
+		t.Fatal("generateAEADAdditionalDataCID returned no data")
+	}
+}
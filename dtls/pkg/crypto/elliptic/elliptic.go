@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package elliptic provides the named-curve key-exchange groups DTLS's
+// supported_groups extension negotiates, and the keypairs generated
+// for them.
+package elliptic
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Curve is a named elliptic curve (or other key-exchange group)
+// identifier, using the IANA TLS "Supported Groups" registry's values
+// so it can be read and written directly as a supported_groups/
+// key_share extension entry.
+type Curve uint16
+
+// Curve IDs this package supports, from the IANA TLS "Supported
+// Groups" registry (https://www.iana.org/assignments/tls-extensiontype-values).
+const (
+	P256   Curve = 0x0017
+	P384   Curve = 0x0018
+	X25519 Curve = 0x001d
+)
+
+// errInvalidNamedCurve is returned by GenerateKeypair and toECDH for a
+// Curve value this package does not implement.
+var errInvalidNamedCurve = errors.New("elliptic: invalid named curve")
+
+// String returns curve's IANA name, or its numeric ID in 0x-prefixed
+// hex if curve isn't one this package knows.
+func (c Curve) String() string {
+	switch c {
+	case P256:
+		return "P-256"
+	case P384:
+		return "P-384"
+	case X25519:
+		return "X25519"
+	default:
+		return fmt.Sprintf("0x%x", uint16(c))
+	}
+}
+
+// toECDH returns the crypto/ecdh.Curve implementing c, or
+// errInvalidNamedCurve if c isn't one this package supports.
+func (c Curve) toECDH() (ecdh.Curve, error) {
+	switch c {
+	case P256:
+		return ecdh.P256(), nil
+	case P384:
+		return ecdh.P384(), nil
+	case X25519:
+		return ecdh.X25519(), nil
+	default:
+		return nil, errInvalidNamedCurve
+	}
+}
+
+// Keypair is an ephemeral key-exchange keypair for a single Curve, as
+// generated by GenerateKeypair and carried in State.localKeypair across
+// a handshake.
+type Keypair struct {
+	Curve      Curve
+	PublicKey  []byte
+	PrivateKey *ecdh.PrivateKey
+}
+
+// GenerateKeypair generates a fresh ephemeral Keypair for curve.
+func GenerateKeypair(curve Curve) (*Keypair, error) {
+	c, err := curve.toECDH()
+	if err != nil {
+		return nil, err
+	}
+
+	priv, err := c.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keypair{
+		Curve:      curve,
+		PublicKey:  priv.PublicKey().Bytes(),
+		PrivateKey: priv,
+	}, nil
+}
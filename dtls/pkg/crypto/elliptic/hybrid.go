@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package elliptic
+
+import "errors"
+
+// HybridX25519Kyber768 is the hybrid post-quantum key-exchange group
+// combining X25519 with Kyber768, using the code point BoringSSL/Chrome
+// assigned it (X25519Kyber768Draft00, since this group predates an IANA
+// "Supported Groups" assignment). A client offering it alongside
+// HybridKeyShare's concatenated key_share, and a server willing to
+// negotiate it, keep the session secret against a future break of
+// either component alone: see CombinePremasterSecrets.
+const HybridX25519Kyber768 Curve = 0x6399
+
+// Wire sizes for HybridX25519Kyber768's two components, used to
+// validate a peer's key_share/ClientKeyExchange payload before
+// splitting it into its classical and post-quantum halves.
+const (
+	X25519PublicKeySize    = 32
+	Kyber768PublicKeySize  = 1184
+	Kyber768CiphertextSize = 1088
+)
+
+// errHybridKEMNotImplemented is returned by GenerateHybridKeypair: this
+// fork does not vendor a Kyber768 implementation (e.g.
+// cloudflare/circl's kyber768 package), so it cannot perform the
+// post-quantum half of HybridX25519Kyber768's key generation,
+// encapsulation, or decapsulation. Everything else in this file --
+// the wire sizes, IsHybrid, and CombinePremasterSecrets -- is usable
+// independently of that gap.
+var errHybridKEMNotImplemented = errors.New("elliptic: HybridX25519Kyber768 requires a Kyber768 implementation this fork does not vendor")
+
+// IsHybrid reports whether curve is a hybrid classical/post-quantum
+// group, so a client can reject a server's choice of a non-hybrid
+// group after having only offered hybrids -- the downgrade this
+// package's caller must refuse to accept.
+func IsHybrid(curve Curve) bool {
+	return curve == HybridX25519Kyber768
+}
+
+// GenerateHybridKeypair would generate an ephemeral HybridX25519Kyber768
+// keypair -- an X25519 keypair plus a Kyber768 encapsulation/decapsulation
+// keypair -- but always fails with errHybridKEMNotImplemented; see that
+// error's doc comment.
+func GenerateHybridKeypair() (*Keypair, error) {
+	return nil, errHybridKEMNotImplemented
+}
+
+// CombinePremasterSecrets concatenates a hybrid key exchange's classical
+// and post-quantum shared secrets into the single premaster secret fed
+// to prf.MasterSecret/prf.ExtendedMasterSecret, per the hybrid key
+// exchange's design goal: recovering either secret alone must not be
+// enough to recover the premaster secret.
+func CombinePremasterSecrets(classicalSharedSecret, pqSharedSecret []byte) []byte {
+	combined := make([]byte, 0, len(classicalSharedSecret)+len(pqSharedSecret))
+	combined = append(combined, classicalSharedSecret...)
+	combined = append(combined, pqSharedSecret...)
+
+	return combined
+}
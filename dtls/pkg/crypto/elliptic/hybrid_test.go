@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package elliptic
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestIsHybrid(t *testing.T) {
+	if !IsHybrid(HybridX25519Kyber768) {
+		t.Fatal("expected HybridX25519Kyber768 to be reported as hybrid")
+	}
+	if IsHybrid(X25519) {
+		t.Fatal("expected X25519 not to be reported as hybrid")
+	}
+	if IsHybrid(P384) {
+		t.Fatal("expected P384 not to be reported as hybrid")
+	}
+}
+
+func TestGenerateHybridKeypairNotImplemented(t *testing.T) {
+	_, err := GenerateHybridKeypair()
+	if !errors.Is(err, errHybridKEMNotImplemented) {
+		t.Fatalf("expected errHybridKEMNotImplemented, got %v", err)
+	}
+}
+
+func TestCombinePremasterSecrets(t *testing.T) {
+	classical := bytes.Repeat([]byte{0x01}, X25519PublicKeySize)
+	pq := bytes.Repeat([]byte{0x02}, Kyber768CiphertextSize)
+
+	combined := CombinePremasterSecrets(classical, pq)
+	if len(combined) != len(classical)+len(pq) {
+		t.Fatalf("expected a %d-byte premaster secret, got %d", len(classical)+len(pq), len(combined))
+	}
+	if !bytes.Equal(combined[:len(classical)], classical) {
+		t.Fatal("expected the classical shared secret first")
+	}
+	if !bytes.Equal(combined[len(classical):], pq) {
+		t.Fatal("expected the post-quantum shared secret second")
+	}
+}
+
+func TestHybridSizeConstants(t *testing.T) {
+	if X25519PublicKeySize != 32 {
+		t.Fatalf("expected X25519PublicKeySize == 32, got %d", X25519PublicKeySize)
+	}
+	if Kyber768PublicKeySize != 1184 {
+		t.Fatalf("expected Kyber768PublicKeySize == 1184, got %d", Kyber768PublicKeySize)
+	}
+	if Kyber768CiphertextSize != 1088 {
+		t.Fatalf("expected Kyber768CiphertextSize == 1088, got %d", Kyber768CiphertextSize)
+	}
+}
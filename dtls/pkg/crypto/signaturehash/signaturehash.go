@@ -8,6 +8,8 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"crypto/tls"
 	"fmt"
 
@@ -25,21 +27,39 @@ type Algorithm struct {
 }
 
 // Algorithms are all the know SignatureHash Algorithms.
+//
+// The ecdsa_secp256r1_sha256/secp384r1_sha384/secp521r1_sha512 TLS 1.3
+// SignatureScheme codepoints aren't listed separately here: their wire
+// values happen to already be valid TLS 1.2 hash<<8|sig pairs (0x0403,
+// 0x0503, 0x0603), so they're exactly the three ECDSA entries below; the
+// curve each one is bound to is enforced in isCompatible instead.
 func Algorithms() []Algorithm {
 	return []Algorithm{
 		{hash.SHA256, signature.ECDSA},
 		{hash.SHA384, signature.ECDSA},
 		{hash.SHA512, signature.ECDSA},
 		{hash.Ed25519, signature.Ed25519},
+		{hash.SHA256, signature.RSA},
+		{hash.SHA256, signature.RSA_PSS_RSAE_SHA256},
+		{hash.SHA384, signature.RSA_PSS_RSAE_SHA384},
+		{hash.SHA512, signature.RSA_PSS_RSAE_SHA512},
 	}
 }
 
-// SelectSignatureScheme returns most preferred and compatible scheme.
+// SelectSignatureScheme returns most preferred and compatible scheme. When a
+// private key supports both an RSA-PSS and a PKCS#1 v1.5 scheme from sigs,
+// the RSA-PSS one is preferred, per RFC 8446's recommendation to negotiate
+// RSA-PSS wherever possible.
 func SelectSignatureScheme(sigs []Algorithm, privateKey crypto.PrivateKey) (Algorithm, error) {
 	signer, ok := privateKey.(crypto.Signer)
 	if !ok {
 		return Algorithm{}, errInvalidPrivateKey
 	}
+	for _, ss := range sigs {
+		if ss.Signature.IsPSS() && ss.isCompatible(signer) {
+			return ss, nil
+		}
+	}
 	for _, ss := range sigs {
 		if ss.isCompatible(signer) {
 			return ss, nil
@@ -51,11 +71,44 @@ func SelectSignatureScheme(sigs []Algorithm, privateKey crypto.PrivateKey) (Algo
 
 // isCompatible checks that given private key is compatible with the signature scheme.
 func (a *Algorithm) isCompatible(signer crypto.Signer) bool {
-	switch signer.Public().(type) {
+	switch pub := signer.Public().(type) {
 	case ed25519.PublicKey:
 		return a.Signature == signature.Ed25519
 	case *ecdsa.PublicKey:
-		return a.Signature == signature.ECDSA
+		return a.Signature == signature.ECDSA && curveMatchesHash(pub.Curve, a.Hash)
+	case *rsa.PublicKey:
+		switch a.Signature {
+		case signature.RSA:
+			return true
+		case signature.RSA_PSS_RSAE_SHA256, signature.RSA_PSS_RSAE_SHA384, signature.RSA_PSS_RSAE_SHA512:
+			// rsa_pss_rsae_*: an ordinary RSASSA-PKCS1-v1_5 key signing with
+			// PSS padding, which any *rsa.PublicKey can do.
+			return true
+		case signature.RSA_PSS_PSS_SHA256, signature.RSA_PSS_PSS_SHA384, signature.RSA_PSS_PSS_SHA512:
+			// rsa_pss_pss_*: requires a certificate whose key is restricted
+			// to RSASSA-PSS (a distinct key OID); a bare *rsa.PublicKey
+			// doesn't carry that restriction, so it can't satisfy it.
+			return false
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+}
+
+// curveMatchesHash reports whether hash is the one RFC 8446 §4.2.3 binds to
+// curve for the ecdsa_secp*_sha* signature schemes: secp256r1 with SHA-256,
+// secp384r1 with SHA-384, and secp521r1 with SHA-512. A scheme that mixes a
+// curve with the wrong hash (e.g. ecdsa_secp256r1_sha384) is rejected.
+func curveMatchesHash(curve elliptic.Curve, h hash.Algorithm) bool {
+	switch h {
+	case hash.SHA256:
+		return curve == elliptic.P256()
+	case hash.SHA384:
+		return curve == elliptic.P384()
+	case hash.SHA512:
+		return curve == elliptic.P521()
 	default:
 		return false
 	}
@@ -69,6 +122,21 @@ func ParseSignatureSchemes(sigs []tls.SignatureScheme, insecureHashes bool) ([]A
 	}
 	out := []Algorithm{}
 	for _, ss := range sigs {
+		// RSA-PSS schemes (rsa_pss_rsae_* and rsa_pss_pss_*) don't fit the
+		// TLS 1.2 hash<<8|sig encoding the rest of this loop assumes, so
+		// signature.Algorithm carries their full 16-bit SignatureScheme
+		// value instead of a byte pair; recognize those up front.
+		if full := signature.Algorithm(ss); full.IsPSS() {
+			if full.IsUnsupported() {
+				continue
+			}
+			out = append(out, Algorithm{
+				Hash:      full.GetPSSHash(),
+				Signature: full,
+			})
+			continue
+		}
+
 		sig := signature.Algorithm(ss & 0xFF)
 		if _, ok := signature.Algorithms()[sig]; !ok {
 			return nil,
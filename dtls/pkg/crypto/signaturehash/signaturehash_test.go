@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2026 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package signaturehash
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"testing"
+
+	"github.com/pion/dtls/v3/pkg/crypto/hash"
+	"github.com/pion/dtls/v3/pkg/crypto/signature"
+)
+
+func TestIsCompatible_ECDSACurveBinding(t *testing.T) {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		a    Algorithm
+		key  *ecdsa.PrivateKey
+		want bool
+	}{
+		{"secp256r1 key with sha256", Algorithm{hash.SHA256, signature.ECDSA}, p256Key, true},
+		{"secp384r1 key with sha384", Algorithm{hash.SHA384, signature.ECDSA}, p384Key, true},
+		{"secp256r1 key with sha384 (RFC 8446 mismatch)", Algorithm{hash.SHA384, signature.ECDSA}, p256Key, false},
+		{"secp384r1 key with sha256 (RFC 8446 mismatch)", Algorithm{hash.SHA256, signature.ECDSA}, p384Key, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.isCompatible(tt.key); got != tt.want {
+				t.Fatalf("isCompatible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCompatible_RSA(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		sig  signature.Algorithm
+		want bool
+	}{
+		{"rsa_pkcs1", signature.RSA, true},
+		{"rsa_pss_rsae_sha256", signature.RSA_PSS_RSAE_SHA256, true},
+		{"rsa_pss_pss_sha256", signature.RSA_PSS_PSS_SHA256, false},
+		{"ecdsa", signature.ECDSA, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := Algorithm{Hash: hash.SHA256, Signature: tt.sig}
+			if got := a.isCompatible(rsaKey); got != tt.want {
+				t.Fatalf("isCompatible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectSignatureScheme_PrefersPSS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	sigs := []Algorithm{
+		{hash.SHA256, signature.RSA},
+		{hash.SHA256, signature.RSA_PSS_RSAE_SHA256},
+	}
+
+	got, err := SelectSignatureScheme(sigs, rsaKey)
+	if err != nil {
+		t.Fatalf("SelectSignatureScheme: %v", err)
+	}
+	if got.Signature != signature.RSA_PSS_RSAE_SHA256 {
+		t.Fatalf("expected rsa_pss_rsae_sha256 to be preferred over rsa_pkcs1, got %v", got.Signature)
+	}
+}
+
+func TestParseSignatureSchemes_RSAPSS(t *testing.T) {
+	out, err := ParseSignatureSchemes([]tls.SignatureScheme{
+		tls.SignatureScheme(signature.RSA_PSS_RSAE_SHA256),
+		tls.SignatureScheme(signature.RSA_PSS_PSS_SHA256),
+	}, false)
+	if err != nil {
+		t.Fatalf("ParseSignatureSchemes: %v", err)
+	}
+
+	// rsa_pss_pss_sha256 is parsed but unsupported, so only rsa_pss_rsae_sha256 survives.
+	if len(out) != 1 || out[0].Signature != signature.RSA_PSS_RSAE_SHA256 || out[0].Hash != hash.SHA256 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+// ConnectionID carries the RFC 9146 connection_id extension: a client
+// advertises support by sending one (possibly empty, to mean "I support
+// connection IDs but don't have a preferred value yet") in its ClientHello,
+// and a server that wants to assign one echoes the CID it wants the client
+// to use in its ServerHello. extension_data is `opaque cid<0..2^8-1>`.
+type ConnectionID struct {
+	CID []byte
+}
+
+// TypeValue implements Extension.
+func (c *ConnectionID) TypeValue() TypeValue {
+	return ConnectionIDTypeValue
+}
+
+// Marshal encodes c into its wire representation.
+func (c *ConnectionID) Marshal() ([]byte, error) {
+	if len(c.CID) > 0xff {
+		return nil, errInvalidCIDFormat
+	}
+
+	out := make([]byte, 0, 1+len(c.CID))
+	out = append(out, byte(len(c.CID)))
+	out = append(out, c.CID...)
+
+	return out, nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into c.
+func (c *ConnectionID) Unmarshal(buf []byte) error {
+	if len(buf) == 0 {
+		return errBufferTooSmall
+	}
+
+	length := int(buf[0])
+	if len(buf) != 1+length {
+		return errBufferTooSmall
+	}
+
+	c.CID = append([]byte(nil), buf[1:]...)
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConnectionIDRoundTrip(t *testing.T) {
+	original := &ConnectionID{CID: []byte{0x1, 0x2, 0x3, 0x4}}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ConnectionID{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded.CID, original.CID) {
+		t.Fatalf("Unmarshal(Marshal(c)) = %x, want %x", decoded.CID, original.CID)
+	}
+}
+
+func TestConnectionIDEmptyAdvertisesSupport(t *testing.T) {
+	raw, err := (&ConnectionID{}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 1 {
+		t.Fatalf("expected a 1-byte (zero length) wire encoding, got %d bytes", len(raw))
+	}
+
+	decoded := &ConnectionID{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.CID) != 0 {
+		t.Fatalf("expected no CID, got %d bytes", len(decoded.CID))
+	}
+}
+
+func TestConnectionIDTooLong(t *testing.T) {
+	if _, err := (&ConnectionID{CID: make([]byte, 256)}).Marshal(); err != errInvalidCIDFormat {
+		t.Fatalf("expected errInvalidCIDFormat, got %v", err)
+	}
+}
+
+func TestConnectionIDUnmarshalTruncated(t *testing.T) {
+	if err := (&ConnectionID{}).Unmarshal([]byte{0x4, 0x1, 0x2}); err != errBufferTooSmall {
+		t.Fatalf("expected errBufferTooSmall, got %v", err)
+	}
+	if err := (&ConnectionID{}).Unmarshal(nil); err != errBufferTooSmall {
+		t.Fatalf("expected errBufferTooSmall for empty input, got %v", err)
+	}
+}
+
+func TestConnectionIDImplementsExtension(t *testing.T) {
+	var e Extension = &ConnectionID{}
+	if e.TypeValue() != ConnectionIDTypeValue {
+		t.Fatalf("TypeValue() = %d, want %d", e.TypeValue(), ConnectionIDTypeValue)
+	}
+}
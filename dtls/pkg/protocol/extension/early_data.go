@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+// EarlyData is the early_data extension (RFC 8446 Section 4.2.10) as it
+// appears in a ClientHello (offering 0-RTT) or in EncryptedExtensions
+// (accepting it): both carry empty extension_data, the presence of the
+// extension itself is the signal. A server rejects 0-RTT by omitting
+// early_data from EncryptedExtensions rather than sending any particular
+// EarlyData value, so there is no "rejected" encoding to represent.
+//
+// The per-ticket 0-RTT data limit is carried by SessionState's
+// MaxEarlyDataBytes instead of a NewSessionTicket early_data extension,
+// since this fork's session tickets are already its own opaque encoding
+// rather than a real NewSessionTicket handshake message.
+//
+// Acting on EarlyData's presence or absence to drive an actual 0-RTT
+// write/accept/reject-and-retry flow requires the Conn and handshake FSM
+// this fork does not implement; EarlyData only provides the marker
+// extension's wire encoding.
+type EarlyData struct{}
+
+// TypeValue implements Extension.
+func (e *EarlyData) TypeValue() TypeValue {
+	return EarlyDataTypeValue
+}
+
+// Marshal implements Extension.
+func (e *EarlyData) Marshal() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// Unmarshal implements Extension. It rejects a non-empty buf: a
+// client/server exchanging a non-empty early_data extension_data is not
+// speaking RFC 8446.
+func (e *EarlyData) Unmarshal(buf []byte) error {
+	if len(buf) != 0 {
+		return errLengthMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import "testing"
+
+func TestEarlyDataMarshalEmpty(t *testing.T) {
+	var e Extension = &EarlyData{}
+
+	raw, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 0 {
+		t.Fatalf("expected an empty wire encoding, got %d bytes", len(raw))
+	}
+	if e.TypeValue() != EarlyDataTypeValue {
+		t.Fatalf("TypeValue() = %d, want %d", e.TypeValue(), EarlyDataTypeValue)
+	}
+}
+
+func TestEarlyDataUnmarshalRejectsNonEmpty(t *testing.T) {
+	if err := (&EarlyData{}).Unmarshal([]byte{0x01}); err != errLengthMismatch {
+		t.Fatalf("expected errLengthMismatch, got %v", err)
+	}
+}
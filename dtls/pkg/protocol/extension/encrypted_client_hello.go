@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import "encoding/binary"
+
+// HPKE KEM/KDF/AEAD identifiers used by ECHConfig.KeyConfig, taken from the
+// IANA HPKE registry (RFC 9180 Section 7). Only the combination this fork's
+// internal/hpke package implements is meaningful here.
+const (
+	HPKEKEMX25519HKDFSHA256 uint16 = 0x0020
+	HPKEKDFHKDFSHA256       uint16 = 0x0001
+	HPKEAEADAES128GCM       uint16 = 0x0001
+)
+
+// HPKESymmetricCipherSuite pairs a KDF and an AEAD, as carried in an
+// ECHConfig's cipher_suites list (draft-ietf-tls-esni Section 4).
+type HPKESymmetricCipherSuite struct {
+	KDFID  uint16
+	AEADID uint16
+}
+
+// ECHConfig is a single Encrypted Client Hello configuration
+// (draft-ietf-tls-esni Section 4): the server's HPKE public key plus the
+// parameters a client needs to encrypt an inner ClientHello against it.
+//
+//	struct {
+//	    uint8 version[2];
+//	    uint16 length;
+//	    uint8 contents[length];
+//	} ECHConfig;
+//
+// This type only covers the wire encoding of one draft-13 ECHConfigContents;
+// using it to actually split and seal a ClientHello, carry the result in an
+// "ech" extension, and have a server decrypt and select on the inner SNI in
+// GetCertificate/ClientHelloInfo is not implemented by this fork.
+type ECHConfig struct {
+	Version           uint16
+	ConfigID          uint8
+	KEMID             uint16
+	PublicKey         []byte
+	CipherSuites      []HPKESymmetricCipherSuite
+	MaximumNameLength uint8
+	PublicName        []byte
+}
+
+// echConfigVersionDraft13 is the only ECHConfig.Version this fork encodes or
+// recognizes (draft-ietf-tls-esni-13, the version Go 1.22's crypto/tls also
+// targets).
+const echConfigVersionDraft13 uint16 = 0xfe0d
+
+// Marshal encodes c into its draft-ietf-tls-esni wire representation.
+func (c *ECHConfig) Marshal() ([]byte, error) {
+	contents := make([]byte, 0, 64+len(c.PublicKey)+len(c.PublicName))
+	contents = binary.BigEndian.AppendUint16(contents, echConfigVersionDraft13)
+
+	body := make([]byte, 0, cap(contents))
+	body = append(body, c.ConfigID)
+	body = binary.BigEndian.AppendUint16(body, c.KEMID)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(c.PublicKey)))
+	body = append(body, c.PublicKey...)
+
+	suites := make([]byte, 0, len(c.CipherSuites)*4)
+	for _, s := range c.CipherSuites {
+		suites = binary.BigEndian.AppendUint16(suites, s.KDFID)
+		suites = binary.BigEndian.AppendUint16(suites, s.AEADID)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(suites)))
+	body = append(body, suites...)
+
+	body = append(body, c.MaximumNameLength)
+	body = append(body, uint8(len(c.PublicName)))
+	body = append(body, c.PublicName...)
+
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(body)))
+
+	return append(contents, body...), nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into c.
+func (c *ECHConfig) Unmarshal(buf []byte) error {
+	if len(buf) < 4 {
+		return errBufferTooSmall
+	}
+
+	version := binary.BigEndian.Uint16(buf)
+	length := binary.BigEndian.Uint16(buf[2:])
+	buf = buf[4:]
+	if version != echConfigVersionDraft13 {
+		return errInvalidExtensionType
+	}
+	if len(buf) != int(length) {
+		return errLengthMismatch
+	}
+
+	if len(buf) < 5 {
+		return errBufferTooSmall
+	}
+	c.Version = version
+	c.ConfigID = buf[0]
+	c.KEMID = binary.BigEndian.Uint16(buf[1:])
+	keyLen := binary.BigEndian.Uint16(buf[3:])
+	buf = buf[5:]
+	if len(buf) < int(keyLen) {
+		return errBufferTooSmall
+	}
+	c.PublicKey = append([]byte(nil), buf[:keyLen]...)
+	buf = buf[keyLen:]
+
+	if len(buf) < 2 {
+		return errBufferTooSmall
+	}
+	suitesLen := binary.BigEndian.Uint16(buf)
+	buf = buf[2:]
+	if len(buf) < int(suitesLen) || suitesLen%4 != 0 {
+		return errBufferTooSmall
+	}
+	c.CipherSuites = make([]HPKESymmetricCipherSuite, 0, suitesLen/4)
+	for i := uint16(0); i < suitesLen; i += 4 {
+		c.CipherSuites = append(c.CipherSuites, HPKESymmetricCipherSuite{
+			KDFID:  binary.BigEndian.Uint16(buf[i:]),
+			AEADID: binary.BigEndian.Uint16(buf[i+2:]),
+		})
+	}
+	buf = buf[suitesLen:]
+
+	if len(buf) < 2 {
+		return errBufferTooSmall
+	}
+	c.MaximumNameLength = buf[0]
+	nameLen := buf[1]
+	buf = buf[2:]
+	if len(buf) != int(nameLen) {
+		return errLengthMismatch
+	}
+	c.PublicName = append([]byte(nil), buf...)
+
+	return nil
+}
+
+// ECHConfigList is a sequence of ECHConfigs a server publishes (typically
+// via DNS HTTPS/SVCB records), in preference order, as defined by
+// draft-ietf-tls-esni Section 4:
+//
+//	struct {
+//	    ECHConfig configs<4..2^16-1>;
+//	} ECHConfigList;
+type ECHConfigList struct {
+	Configs []ECHConfig
+}
+
+// Marshal encodes l into its wire representation.
+func (l *ECHConfigList) Marshal() ([]byte, error) {
+	body := []byte{}
+	for i := range l.Configs {
+		raw, err := l.Configs[i].Marshal()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, raw...)
+	}
+
+	out := make([]byte, 0, 2+len(body))
+	out = binary.BigEndian.AppendUint16(out, uint16(len(body)))
+
+	return append(out, body...), nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into l.
+func (l *ECHConfigList) Unmarshal(buf []byte) error {
+	if len(buf) < 2 {
+		return errBufferTooSmall
+	}
+
+	length := binary.BigEndian.Uint16(buf)
+	buf = buf[2:]
+	if len(buf) != int(length) {
+		return errLengthMismatch
+	}
+
+	l.Configs = nil
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return errBufferTooSmall
+		}
+		configLen := binary.BigEndian.Uint16(buf[2:])
+		total := 4 + int(configLen)
+		if len(buf) < total {
+			return errBufferTooSmall
+		}
+
+		var cfg ECHConfig
+		if err := cfg.Unmarshal(buf[:total]); err != nil {
+			return err
+		}
+		l.Configs = append(l.Configs, cfg)
+		buf = buf[total:]
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestECHConfigRoundTrip(t *testing.T) {
+	original := &ECHConfig{
+		ConfigID:  7,
+		KEMID:     HPKEKEMX25519HKDFSHA256,
+		PublicKey: []byte{1, 2, 3, 4, 5},
+		CipherSuites: []HPKESymmetricCipherSuite{
+			{KDFID: HPKEKDFHKDFSHA256, AEADID: HPKEAEADAES128GCM},
+		},
+		MaximumNameLength: 32,
+		PublicName:        []byte("public.example"),
+	}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ECHConfig{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	original.Version = echConfigVersionDraft13
+
+	if !reflect.DeepEqual(original, decoded) {
+		t.Fatalf("Unmarshal(Marshal(c)) = %+v, want %+v", decoded, original)
+	}
+}
+
+func TestECHConfigUnmarshalWrongVersion(t *testing.T) {
+	buf := []byte{0x00, 0x01, 0x00, 0x00}
+	if err := (&ECHConfig{}).Unmarshal(buf); err != errInvalidExtensionType {
+		t.Fatalf("expected errInvalidExtensionType, got %v", err)
+	}
+}
+
+func TestECHConfigUnmarshalTruncated(t *testing.T) {
+	if err := (&ECHConfig{}).Unmarshal([]byte{0x00}); err != errBufferTooSmall {
+		t.Fatalf("expected errBufferTooSmall, got %v", err)
+	}
+}
+
+func TestECHConfigListRoundTrip(t *testing.T) {
+	original := &ECHConfigList{
+		Configs: []ECHConfig{
+			{
+				ConfigID:  1,
+				KEMID:     HPKEKEMX25519HKDFSHA256,
+				PublicKey: []byte{0xaa, 0xbb},
+				CipherSuites: []HPKESymmetricCipherSuite{
+					{KDFID: HPKEKDFHKDFSHA256, AEADID: HPKEAEADAES128GCM},
+				},
+				MaximumNameLength: 16,
+				PublicName:        []byte("a.example"),
+			},
+			{
+				ConfigID:  2,
+				KEMID:     HPKEKEMX25519HKDFSHA256,
+				PublicKey: []byte{0xcc, 0xdd, 0xee},
+				CipherSuites: []HPKESymmetricCipherSuite{
+					{KDFID: HPKEKDFHKDFSHA256, AEADID: HPKEAEADAES128GCM},
+				},
+				MaximumNameLength: 16,
+				PublicName:        []byte("b.example"),
+			},
+		},
+	}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ECHConfigList{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	for i := range original.Configs {
+		original.Configs[i].Version = echConfigVersionDraft13
+	}
+
+	if !reflect.DeepEqual(original, decoded) {
+		t.Fatalf("Unmarshal(Marshal(l)) = %+v, want %+v", decoded, original)
+	}
+}
+
+func TestECHConfigListUnmarshalEmpty(t *testing.T) {
+	original := &ECHConfigList{}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ECHConfigList{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Configs) != 0 {
+		t.Fatalf("expected no configs, got %d", len(decoded.Configs))
+	}
+}
@@ -35,4 +35,10 @@ var (
 	errMasterKeyIdentifierTooLarge = &protocol.FatalError{
 		Err: errors.New("master key identifier is over 255 bytes"),
 	}
+	errInvalidDTLSVersion = &protocol.FatalError{
+		Err: errors.New("invalid DTLS version"),
+	}
+	errInvalidSupportedVersionsFormat = &protocol.FatalError{
+		Err: errors.New("invalid supported_versions format"),
+	}
 )
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+// TypeValue is a TLS ExtensionType, as assigned by the IANA TLS
+// ExtensionType registry.
+type TypeValue uint16
+
+const (
+	// SessionTicketTypeValue is session_ticket (RFC 5077 Section 3.2).
+	SessionTicketTypeValue TypeValue = 35
+
+	// EarlyDataTypeValue is early_data (RFC 8446 Section 4.2.10).
+	EarlyDataTypeValue TypeValue = 42
+
+	// TransportParametersTypeValue is quic_transport_parameters
+	// (RFC 9001 Section 8.2).
+	TransportParametersTypeValue TypeValue = 57
+
+	// ConnectionIDTypeValue is connection_id (RFC 9146 Section 3).
+	ConnectionIDTypeValue TypeValue = 54
+
+	// SupportedVersionsTypeValue is supported_versions (RFC 8446
+	// Section 4.2.1), used by DTLS 1.3 per RFC 9147 Section 5.3.
+	SupportedVersionsTypeValue TypeValue = 43
+)
+
+// Extension is a single TLS/DTLS ClientHello, ServerHello, EncryptedExtensions
+// or NewSessionTicket extension: a TypeValue identifying it plus a wire
+// encoding of its extension_data.
+//
+// Config.ExtraExtensions holds Extensions that do not already have a
+// first-class Config field, so a caller can attach them (e.g.
+// TransportParameters, EarlyData) without this fork growing a dedicated
+// option for every extension type. Actually sending and parsing an
+// Extension still requires the extension-list plumbing in the ClientHello
+// and ServerHello handshake messages, which this fork does not implement.
+type Extension interface {
+	// TypeValue returns the extension's IANA-assigned ExtensionType.
+	TypeValue() TypeValue
+
+	// Marshal encodes the extension's extension_data.
+	Marshal() ([]byte, error)
+
+	// Unmarshal decodes buf, as produced by Marshal, into the extension.
+	Unmarshal(buf []byte) error
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import "testing"
+
+// FuzzConnectionIDUnmarshal exercises ConnectionID.Unmarshal against
+// arbitrary, possibly truncated or over-long, attacker-controlled bytes: it
+// must only ever return a well-formed result or an error, never panic.
+func FuzzConnectionIDUnmarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x0})
+	f.Add([]byte{0x4, 0x1, 0x2, 0x3, 0x4})
+	f.Add([]byte{0xff})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		_ = (&ConnectionID{}).Unmarshal(buf)
+	})
+}
+
+// FuzzSessionTicketUnmarshal exercises SessionTicket.Unmarshal, which
+// accepts any byte string verbatim as the ticket and so can never error;
+// the fuzz target only guards against a future panic regression.
+func FuzzSessionTicketUnmarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("opaque-ticket-bytes"))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		_ = (&SessionTicket{}).Unmarshal(buf)
+	})
+}
+
+// FuzzTransportParametersUnmarshal exercises TransportParameters.Unmarshal
+// against arbitrary QUIC varint-framed input, including truncated varints
+// and declared lengths that overrun the buffer.
+func FuzzTransportParametersUnmarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x0, 0x3, 0x1, 0x2, 0x3})
+	f.Add([]byte{0x40})
+	f.Add([]byte{0xc0})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		_ = (&TransportParameters{}).Unmarshal(buf)
+	})
+}
+
+// FuzzEarlyDataUnmarshal exercises EarlyData.Unmarshal, whose only valid
+// input is an empty buffer.
+func FuzzEarlyDataUnmarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x0})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		_ = (&EarlyData{}).Unmarshal(buf)
+	})
+}
+
+// FuzzECHConfigListUnmarshal exercises ECHConfigList.Unmarshal against
+// arbitrary, possibly truncated or malformed, ECHConfigList wire data.
+func FuzzECHConfigListUnmarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x0, 0x0})
+	f.Add([]byte{0xfe, 0x0d, 0x0, 0x4, 0x0, 0x1, 0x0, 0x0})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		_ = (&ECHConfigList{}).Unmarshal(buf)
+	})
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+// SessionTicket carries the RFC 5077 session_ticket TLS extension. A client
+// with no ticket sends an empty SessionTicket in its ClientHello to
+// advertise support; a client with one includes it so the server can
+// attempt RFC 5077 stateless resumption instead of (or alongside) a
+// SessionStore lookup by session ID. The extension_data is the ticket's
+// raw bytes verbatim -- RFC 5077 defines no further structure around it.
+type SessionTicket struct {
+	Ticket []byte
+}
+
+// TypeValue implements Extension.
+func (s *SessionTicket) TypeValue() TypeValue {
+	return SessionTicketTypeValue
+}
+
+// Marshal encodes s into its wire representation.
+func (s *SessionTicket) Marshal() ([]byte, error) {
+	return append([]byte{}, s.Ticket...), nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into s.
+func (s *SessionTicket) Unmarshal(buf []byte) error {
+	s.Ticket = append([]byte(nil), buf...)
+
+	return nil
+}
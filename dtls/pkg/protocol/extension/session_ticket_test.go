@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSessionTicketRoundTrip(t *testing.T) {
+	original := &SessionTicket{Ticket: []byte("opaque-ticket-bytes")}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &SessionTicket{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded.Ticket, original.Ticket) {
+		t.Fatalf("Unmarshal(Marshal(s)) = %q, want %q", decoded.Ticket, original.Ticket)
+	}
+}
+
+func TestSessionTicketEmptyAdvertisesSupport(t *testing.T) {
+	raw, err := (&SessionTicket{}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 0 {
+		t.Fatalf("expected an empty wire encoding, got %d bytes", len(raw))
+	}
+
+	decoded := &SessionTicket{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Ticket) != 0 {
+		t.Fatalf("expected no ticket, got %d bytes", len(decoded.Ticket))
+	}
+}
+
+func TestSessionTicketImplementsExtension(t *testing.T) {
+	var e Extension = &SessionTicket{}
+	if e.TypeValue() != SessionTicketTypeValue {
+		t.Fatalf("TypeValue() = %d, want %d", e.TypeValue(), SessionTicketTypeValue)
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import (
+	"encoding/binary"
+
+	"github.com/pion/dtls/v3/pkg/protocol"
+)
+
+// maxSupportedVersionsListBytes is the largest a ClientHello's
+// supported_versions list can be: the list length is itself a single byte
+// (RFC 8446 Section 4.2.1), so at most 255 bytes of version pairs fit, and
+// since each version is 2 bytes the list must also be an even length.
+const maxSupportedVersionsListBytes = 254
+
+// SupportedVersions carries the supported_versions TLS/DTLS extension
+// (RFC 8446 Section 4.2.1, used by DTLS 1.3 per RFC 9147 Section 5.3) used
+// to negotiate between DTLS 1.2 and 1.3: a ClientHello lists every version
+// it's willing to speak, and a ServerHello (or HelloRetryRequest) echoes
+// back exactly the one it selected.
+//
+// Unlike the other extension types in this package, Marshal and Unmarshal
+// here produce and consume the extension's full TLV encoding (type, length
+// and extension_data together), not just extension_data -- this fork has
+// no ClientHello/ServerHello extension-list marshaler to add that wrapper
+// (see the Extension interface's doc comment), and this type needs to be
+// usable standalone until one exists.
+type SupportedVersions struct {
+	// Versions is the version list to send. A single entry marshals as
+	// the ServerHello/HelloRetryRequest "selected_version" form; any other
+	// length marshals as the ClientHello list form.
+	Versions []protocol.Version
+}
+
+// TypeValue implements Extension.
+func (s *SupportedVersions) TypeValue() TypeValue {
+	return SupportedVersionsTypeValue
+}
+
+// Marshal encodes s into its wire representation: the ServerHello/HRR
+// selected_version form if s.Versions has exactly one entry, otherwise the
+// ClientHello list form.
+func (s *SupportedVersions) Marshal() ([]byte, error) {
+	for _, v := range s.Versions {
+		if !v.Valid() {
+			return nil, errInvalidDTLSVersion
+		}
+	}
+
+	var data []byte
+	if len(s.Versions) == 1 {
+		data = []byte{s.Versions[0].Major, s.Versions[0].Minor}
+	} else {
+		if len(s.Versions)*2 > maxSupportedVersionsListBytes {
+			return nil, errInvalidSupportedVersionsFormat
+		}
+		data = make([]byte, 0, 1+len(s.Versions)*2)
+		data = append(data, byte(len(s.Versions)*2))
+		for _, v := range s.Versions {
+			data = append(data, v.Major, v.Minor)
+		}
+	}
+
+	out := make([]byte, 0, 4+len(data))
+	out = binary.BigEndian.AppendUint16(out, uint16(SupportedVersionsTypeValue))
+	out = binary.BigEndian.AppendUint16(out, uint16(len(data)))
+	out = append(out, data...)
+
+	return out, nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into s. Unknown/invalid
+// version entries inside a ClientHello list are silently dropped rather
+// than rejected outright, matching RFC 8446's guidance to ignore
+// unrecognized versions rather than treat them as malformed.
+func (s *SupportedVersions) Unmarshal(buf []byte) error {
+	if len(buf) < 2 {
+		return errInvalidSupportedVersionsFormat
+	}
+	if TypeValue(binary.BigEndian.Uint16(buf[0:2])) != SupportedVersionsTypeValue {
+		return errInvalidExtensionType
+	}
+	if len(buf) < 4 {
+		return errInvalidSupportedVersionsFormat
+	}
+
+	extDataLen := int(binary.BigEndian.Uint16(buf[2:4]))
+	if extDataLen == 0 || len(buf) < 4+extDataLen {
+		return errInvalidSupportedVersionsFormat
+	}
+	data := buf[4 : 4+extDataLen]
+
+	if len(data) == 2 {
+		s.Versions = []protocol.Version{{Major: data[0], Minor: data[1]}}
+
+		return nil
+	}
+
+	listLen := int(data[0])
+	rest := data[1:]
+	if listLen%2 != 0 || listLen != len(rest) {
+		return errInvalidSupportedVersionsFormat
+	}
+
+	versions := make([]protocol.Version, 0, listLen/2)
+	for i := 0; i+1 < len(rest); i += 2 {
+		if v := (protocol.Version{Major: rest[i], Minor: rest[i+1]}); v.Valid() {
+			versions = append(versions, v)
+		}
+	}
+	s.Versions = versions
+
+	return nil
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+// TransportParameter is a single (id, value) pair of the quic_transport_parameters
+// extension (RFC 9001 Section 8.2, RFC 9000 Section 18.2). id and the length of
+// value are both encoded as QUIC variable-length integers.
+type TransportParameter struct {
+	ID    uint64
+	Value []byte
+}
+
+// TransportParameters is the quic_transport_parameters extension
+// (RFC 9001 Section 8.2): a list of TransportParameters a QUIC-DTLS
+// integration carries end to end through the handshake, unvalidated by the
+// DTLS layer itself.
+//
+// Carrying TransportParameters through an actual handshake requires the
+// ClientHello/EncryptedExtensions extension-list plumbing this fork does
+// not implement; attach it via Config.ExtraExtensions once that plumbing
+// exists. TransportParameters only provides the wire encoding.
+type TransportParameters struct {
+	Parameters []TransportParameter
+}
+
+// TypeValue implements Extension.
+func (t *TransportParameters) TypeValue() TypeValue {
+	return TransportParametersTypeValue
+}
+
+// Marshal encodes t into its wire representation.
+func (t *TransportParameters) Marshal() ([]byte, error) {
+	out := []byte{}
+	for _, p := range t.Parameters {
+		out = appendQUICVarint(out, p.ID)
+		out = appendQUICVarint(out, uint64(len(p.Value)))
+		out = append(out, p.Value...)
+	}
+
+	return out, nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into t.
+func (t *TransportParameters) Unmarshal(buf []byte) error {
+	t.Parameters = nil
+
+	for len(buf) > 0 {
+		id, rest, ok := readQUICVarint(buf)
+		if !ok {
+			return errBufferTooSmall
+		}
+
+		length, rest, ok := readQUICVarint(rest)
+		if !ok || uint64(len(rest)) < length {
+			return errBufferTooSmall
+		}
+
+		value := make([]byte, length)
+		copy(value, rest[:length])
+		t.Parameters = append(t.Parameters, TransportParameter{ID: id, Value: value})
+		buf = rest[length:]
+	}
+
+	return nil
+}
+
+// appendQUICVarint appends v to buf using the QUIC variable-length integer
+// encoding (RFC 9000 Section 16): the two most-significant bits of the
+// first byte select a 1/2/4/8-byte encoding for the remaining 6/14/30/62
+// bits of v.
+func appendQUICVarint(buf []byte, v uint64) []byte {
+	switch {
+	case v <= 0x3f:
+		return append(buf, byte(v))
+	case v <= 0x3fff:
+		return append(buf, byte(v>>8)|0x40, byte(v))
+	case v <= 0x3fffffff:
+		return append(buf, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(buf,
+			byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// readQUICVarint decodes a single QUIC variable-length integer from the
+// front of buf, returning the value, the remaining bytes and whether buf
+// held a complete encoding.
+func readQUICVarint(buf []byte) (value uint64, rest []byte, ok bool) {
+	if len(buf) == 0 {
+		return 0, nil, false
+	}
+
+	length := 1 << (buf[0] >> 6)
+	if len(buf) < length {
+		return 0, nil, false
+	}
+
+	value = uint64(buf[0] & 0x3f)
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64(buf[i])
+	}
+
+	return value, buf[length:], true
+}
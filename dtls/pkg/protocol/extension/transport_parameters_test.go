@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package extension
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransportParametersRoundTrip(t *testing.T) {
+	var tp Extension = &TransportParameters{
+		Parameters: []TransportParameter{
+			{ID: 0, Value: []byte{1, 2, 3}},
+			{ID: 0x1234, Value: []byte{}},
+			{ID: 0x3fffffff, Value: []byte("max_idle_timeout-ish")},
+		},
+	}
+
+	raw, err := tp.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &TransportParameters{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tp.(*TransportParameters).Parameters, decoded.Parameters) {
+		t.Fatalf("Unmarshal(Marshal(t)) = %+v, want %+v", decoded.Parameters, tp.(*TransportParameters).Parameters)
+	}
+	if decoded.TypeValue() != TransportParametersTypeValue {
+		t.Fatalf("TypeValue() = %d, want %d", decoded.TypeValue(), TransportParametersTypeValue)
+	}
+}
+
+func TestQUICVarintBoundaries(t *testing.T) {
+	for _, v := range []uint64{0, 0x3f, 0x40, 0x3fff, 0x4000, 0x3fffffff, 0x40000000, 0x3fffffffffffffff} {
+		encoded := appendQUICVarint(nil, v)
+		decoded, rest, ok := readQUICVarint(encoded)
+		if !ok {
+			t.Fatalf("readQUICVarint(%x) failed to decode", encoded)
+		}
+		if len(rest) != 0 {
+			t.Fatalf("readQUICVarint(%x) left %d trailing bytes", encoded, len(rest))
+		}
+		if decoded != v {
+			t.Fatalf("round-tripped %d as %d", v, decoded)
+		}
+	}
+}
+
+func TestTransportParametersUnmarshalTruncated(t *testing.T) {
+	if err := (&TransportParameters{}).Unmarshal([]byte{0x40}); err != errBufferTooSmall {
+		t.Fatalf("expected errBufferTooSmall, got %v", err)
+	}
+}
@@ -25,4 +25,6 @@ var (
 	errCompressionMethodUnset    = &protocol.FatalError{Err: errors.New("server hello can not be created without a compression method")}
 	errInvalidCompressionMethod  = &protocol.FatalError{Err: errors.New("invalid or unknown compression method")}
 	errNotImplemented            = &protocol.InternalError{Err: errors.New("feature has not been implemented yet")}
+	errInvalidKeyUpdateRequest   = &protocol.FatalError{Err: errors.New("invalid key update request value")}
+	errSessionTicketTooLong      = &protocol.FatalError{Err: errors.New("session ticket must not be longer than 65535 bytes")}
 )
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package handshake
+
+const messageKeyUpdateLength = 1
+
+// MessageKeyUpdate is the post-handshake KeyUpdate message (RFC 9147
+// Section 5.11, mirroring RFC 8446 Section 4.6.3): a single byte telling the
+// peer whether it must in turn send its own KeyUpdate (UpdateRequested
+// true, update_requested(1)) or may just install the sender's new traffic
+// secret (update_not_requested(0)).
+type MessageKeyUpdate struct {
+	UpdateRequested bool
+}
+
+// Marshal encodes m into its wire representation.
+func (m *MessageKeyUpdate) Marshal() ([]byte, error) {
+	if m.UpdateRequested {
+		return []byte{1}, nil
+	}
+
+	return []byte{0}, nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into m.
+func (m *MessageKeyUpdate) Unmarshal(buf []byte) error {
+	if len(buf) != messageKeyUpdateLength {
+		return errBufferTooSmall
+	}
+
+	switch buf[0] {
+	case 0:
+		m.UpdateRequested = false
+	case 1:
+		m.UpdateRequested = true
+	default:
+		return errInvalidKeyUpdateRequest
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package handshake
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeMessageKeyUpdate(t *testing.T) {
+	cases := map[string]struct {
+		raw    []byte
+		parsed *MessageKeyUpdate
+		expErr error
+	}{
+		"update not requested": {
+			raw:    []byte{0x0},
+			parsed: &MessageKeyUpdate{UpdateRequested: false},
+		},
+		"update requested": {
+			raw:    []byte{0x1},
+			parsed: &MessageKeyUpdate{UpdateRequested: true},
+		},
+		"invalid value": {
+			raw:    []byte{0x2},
+			expErr: errInvalidKeyUpdateRequest,
+		},
+		"too short": {
+			raw:    []byte{},
+			expErr: errBufferTooSmall,
+		},
+		"too long": {
+			raw:    []byte{0x0, 0x0},
+			expErr: errBufferTooSmall,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			parsed := &MessageKeyUpdate{}
+			err := parsed.Unmarshal(c.raw)
+			if c.expErr != nil {
+				if err == nil || err.Error() != c.expErr.Error() {
+					t.Fatalf("Unmarshal: expected error %v, got %v", c.expErr, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal: unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(parsed, c.parsed) {
+				t.Fatalf("Unmarshal = %+v, want %+v", parsed, c.parsed)
+			}
+
+			raw, err := c.parsed.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(raw, c.raw) {
+				t.Fatalf("Marshal = %x, want %x", raw, c.raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package handshake
+
+import "encoding/binary"
+
+const messageNewSessionTicketHeaderLength = 4 + 2 // ticket_lifetime_hint + ticket length prefix
+
+// MessageNewSessionTicket is the RFC 5077 Section 3.3 NewSessionTicket
+// handshake message a server sends between ChangeCipherSpec and Finished
+// to issue a session ticket for a later abbreviated handshake:
+//
+//	struct {
+//	    uint32 ticket_lifetime_hint;
+//	    opaque ticket<0..2^16-1>;
+//	} NewSessionTicket;
+//
+// Ticket is this fork's opaque, already-sealed session_ticket.go ticket
+// (AEAD ciphertext plus its key-ID header and nonce); this type only
+// (un)marshals the envelope around it. Nothing in this fork's handshaker
+// sends or parses one yet -- the flight5/flight1 integration the parent
+// dtls package's SessionState doc comment describes doesn't exist -- so
+// MessageNewSessionTicket is reachable only from this package's own tests.
+type MessageNewSessionTicket struct {
+	TicketLifetimeHint uint32
+	Ticket             []byte
+}
+
+// Marshal encodes m into its wire representation.
+func (m *MessageNewSessionTicket) Marshal() ([]byte, error) {
+	if len(m.Ticket) > 0xffff {
+		return nil, errSessionTicketTooLong
+	}
+
+	out := make([]byte, messageNewSessionTicketHeaderLength, messageNewSessionTicketHeaderLength+len(m.Ticket))
+	binary.BigEndian.PutUint32(out[0:4], m.TicketLifetimeHint)
+	binary.BigEndian.PutUint16(out[4:6], uint16(len(m.Ticket)))
+
+	return append(out, m.Ticket...), nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into m.
+func (m *MessageNewSessionTicket) Unmarshal(buf []byte) error {
+	if len(buf) < messageNewSessionTicketHeaderLength {
+		return errBufferTooSmall
+	}
+
+	m.TicketLifetimeHint = binary.BigEndian.Uint32(buf[0:4])
+	ticketLen := int(binary.BigEndian.Uint16(buf[4:6]))
+	buf = buf[6:]
+	if len(buf) != ticketLen {
+		return errLengthMismatch
+	}
+
+	m.Ticket = append([]byte(nil), buf...)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package handshake
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeMessageNewSessionTicket(t *testing.T) {
+	cases := map[string]struct {
+		raw    []byte
+		parsed *MessageNewSessionTicket
+		expErr error
+	}{
+		"empty ticket": {
+			raw:    []byte{0x0, 0x0, 0x1c, 0x20, 0x0, 0x0},
+			parsed: &MessageNewSessionTicket{TicketLifetimeHint: 7200},
+		},
+		"with ticket": {
+			raw:    []byte{0x0, 0x0, 0x0e, 0x10, 0x0, 0x3, 0xaa, 0xbb, 0xcc},
+			parsed: &MessageNewSessionTicket{TicketLifetimeHint: 3600, Ticket: []byte{0xaa, 0xbb, 0xcc}},
+		},
+		"too short": {
+			raw:    []byte{0x0, 0x0, 0x0},
+			expErr: errBufferTooSmall,
+		},
+		"declared length mismatch": {
+			raw:    []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5, 0xaa},
+			expErr: errLengthMismatch,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			parsed := &MessageNewSessionTicket{}
+			err := parsed.Unmarshal(c.raw)
+			if c.expErr != nil {
+				if err == nil || err.Error() != c.expErr.Error() {
+					t.Fatalf("Unmarshal: expected error %v, got %v", c.expErr, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal: unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(parsed, c.parsed) {
+				t.Fatalf("Unmarshal = %+v, want %+v", parsed, c.parsed)
+			}
+
+			raw, err := c.parsed.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(raw, c.raw) {
+				t.Fatalf("Marshal = %x, want %x", raw, c.raw)
+			}
+		})
+	}
+}
+
+func TestMessageNewSessionTicketMarshalTooLong(t *testing.T) {
+	m := &MessageNewSessionTicket{Ticket: make([]byte, 0x10000)}
+	if _, err := m.Marshal(); err == nil || err.Error() != errSessionTicketTooLong.Error() {
+		t.Fatalf("Marshal: expected error %v, got %v", errSessionTicketTooLong, err)
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package recordlayer
+
+import "encoding/binary"
+
+const recordNumberLength = 16 // epoch (8 bytes) + sequence_number (8 bytes)
+
+// RecordNumber identifies a single DTLS record by epoch and sequence
+// number, the unit an ACK record (RFC 9147 Section 7) acknowledges.
+type RecordNumber struct {
+	Epoch          uint64
+	SequenceNumber uint64
+}
+
+// ACK is the DTLS 1.3 ACK message (RFC 9147 Section 7), acknowledging
+// receipt of one or more records so a peer can avoid needless
+// retransmission. ACK is carried in its own record rather than as a
+// handshake message.
+//
+// Wiring ACK into the record layer and handshake/retransmission FSM
+// requires the DTLS 1.3 epoch and flight-tracking machinery this fork does
+// not implement; this type only provides the wire encoding RFC 9147
+// Section 7 defines. Nothing outside this package's own tests constructs
+// or reads an ACK today:
+//
+//	struct {
+//	    RecordNumber record_numbers<0..2^16-1>;
+//	} ACK;
+type ACK struct {
+	RecordNumbers []RecordNumber
+}
+
+// Marshal encodes a into its wire representation.
+func (a *ACK) Marshal() ([]byte, error) {
+	body := make([]byte, 0, len(a.RecordNumbers)*recordNumberLength)
+	for _, rn := range a.RecordNumbers {
+		body = binary.BigEndian.AppendUint64(body, rn.Epoch)
+		body = binary.BigEndian.AppendUint64(body, rn.SequenceNumber)
+	}
+
+	out := make([]byte, 0, 2+len(body))
+	out = binary.BigEndian.AppendUint16(out, uint16(len(body)))
+
+	return append(out, body...), nil
+}
+
+// Unmarshal decodes buf, as produced by Marshal, into a.
+func (a *ACK) Unmarshal(buf []byte) error {
+	if len(buf) < 2 {
+		return errBufferTooSmall
+	}
+
+	length := binary.BigEndian.Uint16(buf)
+	buf = buf[2:]
+	if len(buf) != int(length) || length%recordNumberLength != 0 {
+		return errBufferTooSmall
+	}
+
+	a.RecordNumbers = make([]RecordNumber, 0, int(length)/recordNumberLength)
+	for len(buf) > 0 {
+		a.RecordNumbers = append(a.RecordNumbers, RecordNumber{
+			Epoch:          binary.BigEndian.Uint64(buf),
+			SequenceNumber: binary.BigEndian.Uint64(buf[8:]),
+		})
+		buf = buf[recordNumberLength:]
+	}
+
+	return nil
+}
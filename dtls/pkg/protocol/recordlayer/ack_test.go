@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package recordlayer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestACKRoundTrip(t *testing.T) {
+	original := &ACK{
+		RecordNumbers: []RecordNumber{
+			{Epoch: 1, SequenceNumber: 42},
+			{Epoch: 1, SequenceNumber: 43},
+			{Epoch: 2, SequenceNumber: 0},
+		},
+	}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ACK{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(original, decoded) {
+		t.Fatalf("Unmarshal(Marshal(a)) = %+v, want %+v", decoded, original)
+	}
+}
+
+func TestACKUnmarshalEmpty(t *testing.T) {
+	original := &ACK{}
+
+	raw, err := original.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ACK{}
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.RecordNumbers) != 0 {
+		t.Fatalf("expected no record numbers, got %d", len(decoded.RecordNumbers))
+	}
+}
+
+func TestACKUnmarshalTruncated(t *testing.T) {
+	if err := (&ACK{}).Unmarshal([]byte{0x00, 0x10, 0x01, 0x02}); err != errBufferTooSmall {
+		t.Fatalf("expected errBufferTooSmall, got %v", err)
+	}
+}
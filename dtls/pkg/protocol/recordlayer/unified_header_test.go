@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package recordlayer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnifiedHeaderRoundTrip(t *testing.T) {
+	original := &UnifiedHeader{
+		EpochLowBits:   2,
+		SequenceNumber: 42,
+		Length:         17,
+	}
+
+	raw, err := original.Marshal(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &UnifiedHeader{}
+	n, err := decoded.Unmarshal(raw, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(raw) {
+		t.Fatalf("Unmarshal consumed %d bytes, want %d", n, len(raw))
+	}
+	if !decoded.HasLength() {
+		t.Fatal("expected HasLength() to be true")
+	}
+	if !reflect.DeepEqual(original, decoded) {
+		t.Fatalf("Unmarshal(Marshal(h)) = %+v, want %+v", decoded, original)
+	}
+}
+
+func TestUnifiedHeaderRoundTripWithConnectionID(t *testing.T) {
+	original := &UnifiedHeader{
+		ConnectionID:   []byte{0xAA, 0xBB, 0xCC, 0xDD},
+		EpochLowBits:   1,
+		SequenceNumber: 7,
+	}
+
+	raw, err := original.Marshal(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &UnifiedHeader{}
+	if _, err := decoded.Unmarshal(raw, len(original.ConnectionID)); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.HasLength() {
+		t.Fatal("expected HasLength() to be false")
+	}
+	if !reflect.DeepEqual(original, decoded) {
+		t.Fatalf("Unmarshal(Marshal(h)) = %+v, want %+v", decoded, original)
+	}
+}
+
+func TestUnifiedHeaderUnmarshalRejectsDTLS12ContentType(t *testing.T) {
+	// 22 (0x16) is the DTLS 1.2 handshake ContentType, which must not be
+	// mistaken for a DTLS 1.3 unified header.
+	if _, err := (&UnifiedHeader{}).Unmarshal([]byte{0x16, 0x00, 0x00}, 0); err != errInvalidContentType {
+		t.Fatalf("expected errInvalidContentType, got %v", err)
+	}
+}
+
+func TestUnifiedHeaderUnmarshalTruncated(t *testing.T) {
+	if _, err := (&UnifiedHeader{}).Unmarshal([]byte{unifiedHeaderFixedBits | unifiedHeaderSeqNumBit}, 0); err != errBufferTooSmall {
+		t.Fatalf("expected errBufferTooSmall, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package protocol
+
+import "fmt"
+
+// Version is a DTLS protocol version, as carried on the wire in the legacy
+// record/handshake version fields and in the supported_versions extension
+// (RFC 9147 Section 5.3). DTLS versions count down from the TLS versions
+// they correspond to (255 minus the TLS minor version), so DTLS 1.2 is
+// 0xfefd and DTLS 1.3 is 0xfefc even though TLS 1.3 is 0x0304.
+type Version struct {
+	Major uint8
+	Minor uint8
+}
+
+// Versions this fork recognizes on the wire. Version1_0 is included only
+// because peers are required to accept it appearing in a supported_versions
+// list; this fork never negotiates it (see Config.MinVersion/MaxVersion).
+var (
+	Version1_0 = Version{Major: 0xfe, Minor: 0xff}
+	Version1_2 = Version{Major: 0xfe, Minor: 0xfd}
+	Version1_3 = Version{Major: 0xfe, Minor: 0xfc}
+)
+
+// Valid reports whether v is one of the versions this fork recognizes on
+// the wire, whether or not it's one this fork will actually negotiate.
+func (v Version) Valid() bool {
+	switch v {
+	case Version1_0, Version1_2, Version1_3:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v Version) String() string {
+	switch v {
+	case Version1_0:
+		return "DTLS 1.0"
+	case Version1_2:
+		return "DTLS 1.2"
+	case Version1_3:
+		return "DTLS 1.3"
+	default:
+		return fmt.Sprintf("DTLS unknown(0x%02x%02x)", v.Major, v.Minor)
+	}
+}
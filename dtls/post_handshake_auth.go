@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bytes"
+	"crypto/rand"
+)
+
+// certificateRequestContextLength is the size of the opaque
+// certificate_request_context a post-handshake CertificateRequest carries,
+// per RFC 8446 Section 4.3.2. It correlates the client's eventual
+// Certificate/CertificateVerify/Finished response with the request that
+// prompted it, which matters once more than one post-handshake
+// CertificateRequest can be outstanding.
+const certificateRequestContextLength = 32
+
+// newCertificateRequestContext generates a fresh certificate_request_context
+// for a post-handshake CertificateRequest.
+func newCertificateRequestContext() ([]byte, error) {
+	context := make([]byte, certificateRequestContextLength)
+	if _, err := rand.Read(context); err != nil {
+		return nil, err
+	}
+
+	return context, nil
+}
+
+// validateCertificateRequestContext reports whether received matches the
+// context of the pending post-handshake CertificateRequest, returning
+// errCertificateRequestContextMismatch if not.
+//
+// Actually sending/receiving post-handshake CertificateRequest and
+// Certificate/CertificateVerify/Finished messages requires a Conn capable of
+// driving a new flight after the handshake has completed, which this fork
+// does not implement; this helper only provides the context
+// generation/validation step such a Conn.RequestClientCert would rely on.
+func validateCertificateRequestContext(pending, received []byte) error {
+	if !bytes.Equal(pending, received) {
+		return errCertificateRequestContextMismatch
+	}
+
+	return nil
+}
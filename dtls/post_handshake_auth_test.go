@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewCertificateRequestContext(t *testing.T) {
+	first, err := newCertificateRequestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != certificateRequestContextLength {
+		t.Fatalf("expected a %d-byte context, got %d", certificateRequestContextLength, len(first))
+	}
+
+	second, err := newCertificateRequestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, second) {
+		t.Fatal("expected successive contexts to differ")
+	}
+}
+
+func TestValidateCertificateRequestContext(t *testing.T) {
+	pending, err := newCertificateRequestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateCertificateRequestContext(pending, pending); err != nil {
+		t.Fatalf("expected a matching context to validate, got %v", err)
+	}
+
+	other, err := newCertificateRequestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCertificateRequestContext(pending, other); err != errCertificateRequestContextMismatch {
+		t.Fatalf("expected errCertificateRequestContextMismatch, got %v", err)
+	}
+}
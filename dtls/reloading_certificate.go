@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/tls"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReloadingCertificate watches a certificate/key pair on disk and serves the
+// most recently loaded *tls.Certificate, so a long-lived server can rotate
+// certificates (e.g. after a Let's Encrypt renewal) without a restart and
+// without racing handshakes that are reading the certificate concurrently.
+//
+// Use it as Config.GetCertificate:
+//
+//	reloader, err := dtls.NewReloadingCertificate(certPath, keyPath, time.Hour)
+//	...
+//	config := &dtls.Config{GetCertificate: reloader.GetCertificate}
+type ReloadingCertificate struct {
+	certPath, keyPath string
+
+	current atomic.Value // *tls.Certificate
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReloadingCertificate loads certPath/keyPath once synchronously, then
+// starts a background goroutine that reloads them every refresh interval.
+// A reload that fails (e.g. the files are mid-write) logs nothing and keeps
+// serving the last good certificate; NewReloadingCertificate itself returns
+// an error only for the initial load.
+func NewReloadingCertificate(certPath, keyPath string, refresh time.Duration) (*ReloadingCertificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReloadingCertificate{
+		certPath: certPath,
+		keyPath:  keyPath,
+		done:     make(chan struct{}),
+	}
+	r.current.Store(&cert)
+
+	go r.watch(refresh)
+
+	return r, nil
+}
+
+func (r *ReloadingCertificate) watch(refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath); err == nil {
+				r.current.Store(&cert)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// GetCertificate returns the most recently loaded certificate. It matches
+// Config.GetCertificate's signature so a *ReloadingCertificate can be
+// assigned directly.
+func (r *ReloadingCertificate) GetCertificate(*ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current.Load().(*tls.Certificate), nil
+}
+
+// Certificate returns the most recently loaded certificate directly, for
+// callers that do not go through Config.GetCertificate.
+func (r *ReloadingCertificate) Certificate() *tls.Certificate {
+	return r.current.Load().(*tls.Certificate)
+}
+
+// Close stops the background reload goroutine. It is safe to call more than
+// once.
+func (r *ReloadingCertificate) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+
+	return nil
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+)
+
+func writeCertKeyPair(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+
+	cert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		t.Fatalf("GenerateSelfSigned: %v", err)
+	}
+
+	certPath = filepath.Join(dir, "cert.pem")
+	certOut, err := os.Create(certPath)
+	if err != nil {
+		t.Fatalf("create cert file: %v", err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}); err != nil {
+		t.Fatalf("encode cert: %v", err)
+	}
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	keyPath = filepath.Join(dir, "key.pem")
+	keyOut, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatalf("create key file: %v", err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}); err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestReloadingCertificateServesLoadedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCertKeyPair(t, dir)
+
+	reloader, err := NewReloadingCertificate(certPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewReloadingCertificate: %v", err)
+	}
+	defer reloader.Close()
+
+	got, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if got != reloader.Certificate() {
+		t.Fatal("GetCertificate and Certificate disagree on the current certificate")
+	}
+}
+
+func TestReloadingCertificatePicksUpChanges(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCertKeyPair(t, dir)
+
+	reloader, err := NewReloadingCertificate(certPath, keyPath, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloadingCertificate: %v", err)
+	}
+	defer reloader.Close()
+
+	first := reloader.Certificate()
+
+	// Replace the cert/key pair with a freshly generated one in place.
+	writeCertKeyPair(t, dir)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if reloader.Certificate() != first {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("ReloadingCertificate did not pick up the replaced certificate/key pair in time")
+}
+
+func TestReloadingCertificateCloseStopsReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCertKeyPair(t, dir)
+
+	reloader, err := NewReloadingCertificate(certPath, keyPath, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloadingCertificate: %v", err)
+	}
+
+	if err := reloader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := reloader.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestNewReloadingCertificateInvalidPath(t *testing.T) {
+	if _, err := NewReloadingCertificate("does-not-exist.pem", "does-not-exist-key.pem", time.Hour); err == nil {
+		t.Fatal("expected an error loading a non-existent certificate/key pair")
+	}
+}
@@ -0,0 +1,452 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// sessionTicketKeyIDLength is the size of the per-key-ID header
+// sealSessionTicket prepends to every ticket, letting openSessionTicket
+// pick the one key to try instead of brute-forcing every configured key
+// in turn -- the cost of which grows linearly with how many rotations
+// back a still-valid ticket was issued.
+const sessionTicketKeyIDLength = 4
+
+// sessionTicketKeyID derives a stable, public identifier for a session
+// ticket key: HMAC-SHA256 of a fixed label under the key itself,
+// truncated to sessionTicketKeyIDLength bytes. It does not need to be
+// secret -- only collision-resistant enough to disambiguate a handful of
+// rotated keys -- so a truncated MAC is a deliberate, not just
+// convenient, choice over e.g. an index into Config.SessionTicketKeys,
+// which would break as soon as keys are added, removed, or reordered
+// between the ticket being sealed and being opened.
+func sessionTicketKeyID(key [32]byte) [sessionTicketKeyIDLength]byte {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("dtls session ticket key id"))
+	sum := mac.Sum(nil)
+
+	var id [sessionTicketKeyIDLength]byte
+	copy(id[:], sum)
+
+	return id
+}
+
+// errSessionTicketDecrypt is returned by openSessionTicket when a ticket
+// cannot be authenticated under any configured key, e.g. because it was
+// sealed by a key that has since been rotated out, or tampered with.
+var errSessionTicketDecrypt = errors.New("dtls: session ticket could not be decrypted")
+
+// SessionState is the information a server seals into a session ticket (and
+// a client caches against it) so a later handshake can be resumed without
+// repeating a full key exchange. It plays the same role as the SessionID
+// lookup served by SessionStore, but travels with the client instead of
+// being kept server-side.
+//
+// Wiring SessionState into an actual abbreviated handshake -- consuming a
+// handshake.MessageNewSessionTicket between a server's ChangeCipherSpec and
+// Finished, and a client skipping ClientKeyExchange/CertificateVerify on
+// resumption -- requires the flight1/flight3/flight5 state machine and the
+// State/handshakeConfig types that drive it, none of which exist in this
+// fork; SessionState and the seal/open/resume functions below only provide
+// the ticket encoding, the key-ID-tagged AEAD sealing keyed by
+// Config.SessionTicketKeys, and the fall-back-on-failure policy RFC 5077
+// Section 3.3 requires of that resumption attempt.
+type SessionState struct {
+	CipherSuiteID     CipherSuiteID
+	MasterSecret      []byte
+	ResumptionSecret  []byte
+	ALPNProtocol      string
+	ServerName        string
+	PeerCertificates  [][]byte
+	IssuedAt          time.Time
+	Lifetime          time.Duration
+	MaxEarlyDataBytes uint32
+}
+
+// DefaultSessionTicketLifetime is the Lifetime NewSessionTicketState applies
+// when called with lifetime <= 0, chosen to bound how long a compromised
+// ticket key or a stolen ticket remains useful without requiring every
+// caller to pick a value.
+const DefaultSessionTicketLifetime = 24 * time.Hour
+
+// NewSessionTicketState builds the SessionState a server seals into a
+// NewSessionTicket after a handshake completes: issuedAt is now, and
+// lifetime falls back to DefaultSessionTicketLifetime if <= 0.
+// peerCertificates, if any, are sealed as-is; callers that only need to
+// bind a ticket to a client certificate rather than reproduce it in full
+// can pass a single-element slice holding just a hash of the leaf.
+//
+// Wiring the result into an actual NewSessionTicket message after Finished,
+// and a client replaying it on a later Dial, is the flight5/flight1
+// integration this fork's missing handshake state machine prevents (see the
+// SessionState doc comment); this constructor only fixes the defaulting
+// policy those call sites would need.
+// Nothing in this fork calls NewSessionTicketState outside its own tests:
+// there is no server flight that would issue a ticket to seal it into.
+func NewSessionTicketState(cipherSuiteID CipherSuiteID, masterSecret []byte, peerCertificates [][]byte, lifetime time.Duration) *SessionState {
+	if lifetime <= 0 {
+		lifetime = DefaultSessionTicketLifetime
+	}
+
+	return &SessionState{
+		CipherSuiteID:    cipherSuiteID,
+		MasterSecret:     masterSecret,
+		PeerCertificates: peerCertificates,
+		IssuedAt:         time.Now(),
+		Lifetime:         lifetime,
+	}
+}
+
+// Expired reports whether state's ticket lifetime has elapsed as of now, per
+// RFC 5077 Section 3.3: a server must fall back to a full handshake rather
+// than resume from an expired ticket.
+func (s *SessionState) Expired(now time.Time) bool {
+	return now.After(s.IssuedAt.Add(s.Lifetime))
+}
+
+// PeerCertificateChain parses PeerCertificates back into *x509.Certificate
+// values, in the order they were sealed.
+func (s *SessionState) PeerCertificateChain() ([]*x509.Certificate, error) {
+	chain := make([]*x509.Certificate, 0, len(s.PeerCertificates))
+	for _, der := range s.PeerCertificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+
+	return chain, nil
+}
+
+// ClientSessionCache is consulted by a client to persist and look up
+// encrypted session tickets issued by a server, analogous to
+// crypto/tls.ClientSessionCache. Both methods may be called concurrently.
+//
+// No handshake code in this fork calls Get or Put yet -- see SessionState's
+// doc comment for what's still missing -- so a configured
+// Config.ClientSessionCache is not consulted by anything today.
+type ClientSessionCache interface {
+	// Get searches for a ticket associated with serverName, returning the
+	// ticket as it was stored by Put and a bool indicating whether one was
+	// found.
+	Get(serverName string) (ticket []byte, ok bool)
+
+	// Put adds or replaces the ticket associated with serverName. A nil
+	// ticket indicates that the entry, if any, should be removed.
+	Put(serverName string, ticket []byte)
+}
+
+// SetSessionTicketKeys rotates the keys used to seal and open session
+// tickets, analogous to crypto/tls.Config.SetSessionTicketKeys. The first
+// key in keys seals new tickets; every key remains valid for opening
+// tickets issued while it was first in the list.
+func (c *Config) SetSessionTicketKeys(keys [][32]byte) {
+	c.SessionTicketKeys = keys
+}
+
+// sealSessionTicket encodes state and seals it under the first configured
+// session ticket key using AES-256-GCM, prefixing the result with that
+// key's sessionTicketKeyID so a later openSessionTicket can select the
+// right key directly instead of trying every configured key in turn. It
+// returns an error if no session ticket key is configured.
+func sealSessionTicket(keys [][32]byte, state *SessionState) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("dtls: no session ticket key configured")
+	}
+
+	plaintext := encodeSessionState(state)
+
+	block, err := aes.NewCipher(keys[0][:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	keyID := sessionTicketKeyID(keys[0])
+
+	ticket := make([]byte, 0, sessionTicketKeyIDLength+len(nonce)+len(plaintext)+aead.Overhead())
+	ticket = append(ticket, keyID[:]...)
+	ticket = append(ticket, nonce...)
+	ticket = aead.Seal(ticket, nonce, plaintext, nil)
+
+	return ticket, nil
+}
+
+// openSessionTicket authenticates and decodes ticket, first looking up
+// its key by the sessionTicketKeyID header sealSessionTicket prefixed it
+// with and, failing that (e.g. a ticket sealed before this header
+// existed), falling back to trying every configured key in turn. It
+// returns errSessionTicketDecrypt if no configured key opens it.
+func openSessionTicket(keys [][32]byte, ticket []byte) (*SessionState, error) {
+	if len(ticket) >= sessionTicketKeyIDLength {
+		var id [sessionTicketKeyIDLength]byte
+		copy(id[:], ticket[:sessionTicketKeyIDLength])
+
+		for _, key := range keys {
+			if sessionTicketKeyID(key) != id {
+				continue
+			}
+			if state, err := openSessionTicketWithKey(key, ticket[sessionTicketKeyIDLength:]); err == nil {
+				return state, nil
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if state, err := openSessionTicketWithKey(key, ticket); err == nil {
+			return state, nil
+		}
+	}
+
+	return nil, errSessionTicketDecrypt
+}
+
+// openSessionTicketWithKey authenticates and decodes body (ticket with
+// any sessionTicketKeyID header already stripped) under a single key.
+func openSessionTicketWithKey(key [32]byte, body []byte) (*SessionState, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < aead.NonceSize() {
+		return nil, errSessionTicketDecrypt
+	}
+
+	nonce, sealed := body[:aead.NonceSize()], body[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errSessionTicketDecrypt
+	}
+
+	return decodeSessionState(plaintext)
+}
+
+// resumeSessionTicket tries to recover a usable SessionState from ticket,
+// returning ok=false whenever RFC 5077 Section 3.3 calls for falling back
+// to a full handshake instead of raising an error: ticket is empty (no
+// ticket offered), it does not decrypt under any of keys (unknown to this
+// server, e.g. issued before a restart, or corrupted), or it decodes but
+// has expired per its own Lifetime.
+func resumeSessionTicket(keys [][32]byte, ticket []byte, now time.Time) (state *SessionState, ok bool) {
+	if len(ticket) == 0 {
+		return nil, false
+	}
+
+	state, err := openSessionTicket(keys, ticket)
+	if err != nil {
+		return nil, false
+	}
+	if state.Expired(now) {
+		return nil, false
+	}
+
+	return state, true
+}
+
+// GetSessionTicket looks up config.ClientSessionCache for a ticket stored
+// under serverName and, if one is found, opens and validates it the same
+// way a resumption attempt during a handshake would (see
+// resumeSessionTicket): an expired or otherwise unusable ticket is treated
+// as not found rather than returned as an error, per RFC 5077 Section 3.3's
+// fall-back-to-full-handshake policy. It returns ok=false if
+// config.ClientSessionCache is nil, no ticket is cached for serverName, or
+// the cached ticket doesn't decrypt under config.SessionTicketKeys.
+//
+// This lets a caller that persists ClientSessionCache to disk (so sessions
+// survive a process restart) inspect what it would resume with before
+// spending a handshake on it. GetSessionTicket and SetSessionTicket work
+// standalone today, but a ticket they round-trip is not yet consulted by
+// any handshake (see ClientSessionCache's doc comment), so persisting one
+// doesn't shorten a real Dial until that integration exists.
+func GetSessionTicket(config *Config, serverName string, now time.Time) (state *SessionState, ok bool) {
+	if config.ClientSessionCache == nil {
+		return nil, false
+	}
+
+	ticket, ok := config.ClientSessionCache.Get(serverName)
+	if !ok {
+		return nil, false
+	}
+
+	return resumeSessionTicket(config.SessionTicketKeys, ticket, now)
+}
+
+// SetSessionTicket seals state under the first of config.SessionTicketKeys
+// and stores the result into config.ClientSessionCache under serverName,
+// the same sealing sealSessionTicket applies to a server-issued ticket.
+//
+// This lets a caller restore a ticket it persisted to disk into
+// ClientSessionCache ahead of dialing, without first completing a full
+// handshake to obtain one, and is the encrypt-side counterpart to
+// GetSessionTicket.
+func SetSessionTicket(config *Config, serverName string, state *SessionState) error {
+	if config.ClientSessionCache == nil {
+		return errors.New("dtls: SetSessionTicket requires a non-nil Config.ClientSessionCache")
+	}
+
+	ticket, err := sealSessionTicket(config.SessionTicketKeys, state)
+	if err != nil {
+		return err
+	}
+
+	config.ClientSessionCache.Put(serverName, ticket)
+
+	return nil
+}
+
+// encodeSessionState serializes state into a flat, length-prefixed binary
+// encoding suitable for sealing into a ticket.
+func encodeSessionState(state *SessionState) []byte {
+	buf := make([]byte, 0, 256)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(state.CipherSuiteID))
+	buf = appendLengthPrefixed(buf, state.MasterSecret)
+	buf = appendLengthPrefixed(buf, state.ResumptionSecret)
+	buf = appendLengthPrefixed(buf, []byte(state.ALPNProtocol))
+	buf = appendLengthPrefixed(buf, []byte(state.ServerName))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(state.PeerCertificates)))
+	for _, der := range state.PeerCertificates {
+		buf = appendLengthPrefixed32(buf, der)
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(state.IssuedAt.Unix()))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(state.Lifetime))
+	buf = binary.BigEndian.AppendUint32(buf, state.MaxEarlyDataBytes)
+
+	return buf
+}
+
+// decodeSessionState is the inverse of encodeSessionState.
+func decodeSessionState(buf []byte) (*SessionState, error) {
+	state := &SessionState{}
+
+	var ok bool
+	var id uint16
+	if id, buf, ok = readUint16(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.CipherSuiteID = CipherSuiteID(id)
+
+	if state.MasterSecret, buf, ok = readLengthPrefixed(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	if state.ResumptionSecret, buf, ok = readLengthPrefixed(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+
+	var alpn, sni []byte
+	if alpn, buf, ok = readLengthPrefixed(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.ALPNProtocol = string(alpn)
+	if sni, buf, ok = readLengthPrefixed(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.ServerName = string(sni)
+
+	var certCount uint16
+	if certCount, buf, ok = readUint16(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.PeerCertificates = make([][]byte, 0, certCount)
+	for i := uint16(0); i < certCount; i++ {
+		var der []byte
+		if der, buf, ok = readLengthPrefixed32(buf); !ok {
+			return nil, errSessionTicketDecrypt
+		}
+		state.PeerCertificates = append(state.PeerCertificates, der)
+	}
+
+	var issuedAt, lifetime uint64
+	if issuedAt, buf, ok = readUint64(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.IssuedAt = time.Unix(int64(issuedAt), 0)
+	if lifetime, buf, ok = readUint64(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.Lifetime = time.Duration(lifetime)
+
+	var maxEarlyData uint32
+	if maxEarlyData, _, ok = readUint32(buf); !ok {
+		return nil, errSessionTicketDecrypt
+	}
+	state.MaxEarlyDataBytes = maxEarlyData
+
+	return state, nil
+}
+
+func appendLengthPrefixed(buf, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+
+	return append(buf, data...)
+}
+
+func appendLengthPrefixed32(buf, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+
+	return append(buf, data...)
+}
+
+func readUint16(buf []byte) (value uint16, rest []byte, ok bool) {
+	if len(buf) < 2 {
+		return 0, nil, false
+	}
+
+	return binary.BigEndian.Uint16(buf), buf[2:], true
+}
+
+func readUint32(buf []byte) (value uint32, rest []byte, ok bool) {
+	if len(buf) < 4 {
+		return 0, nil, false
+	}
+
+	return binary.BigEndian.Uint32(buf), buf[4:], true
+}
+
+func readUint64(buf []byte) (value uint64, rest []byte, ok bool) {
+	if len(buf) < 8 {
+		return 0, nil, false
+	}
+
+	return binary.BigEndian.Uint64(buf), buf[8:], true
+}
+
+func readLengthPrefixed(buf []byte) (data, rest []byte, ok bool) {
+	length, buf, ok := readUint16(buf)
+	if !ok || len(buf) < int(length) {
+		return nil, nil, false
+	}
+
+	return buf[:length], buf[length:], true
+}
+
+func readLengthPrefixed32(buf []byte) (data, rest []byte, ok bool) {
+	length, buf, ok := readUint32(buf)
+	if !ok || len(buf) < int(length) {
+		return nil, nil, false
+	}
+
+	return buf[:length], buf[length:], true
+}
@@ -19,3 +19,75 @@ const (
 	SRTP_AEAD_AES_128_GCM       SRTPProtectionProfile = extension.SRTP_AEAD_AES_128_GCM
 	SRTP_AEAD_AES_256_GCM       SRTPProtectionProfile = extension.SRTP_AEAD_AES_256_GCM
 )
+
+// srtpProtectionProfileKeySaltLengths gives the SRTP master key and salt
+// lengths, in bytes, that ExportKeyingMaterial must derive for each
+// protection profile: 16/32-byte keys for AES-128/256 (RFC 3711/5764
+// Section 4.1.2), and a 12-byte salt for the AEAD GCM profiles versus a
+// 14-byte salt for the CM/NULL profiles (RFC 7714 Section 8.1).
+var srtpProtectionProfileKeySaltLengths = map[SRTPProtectionProfile]struct{ keyLen, saltLen int }{
+	SRTP_AES128_CM_HMAC_SHA1_80: {keyLen: 16, saltLen: 14},
+	SRTP_AES128_CM_HMAC_SHA1_32: {keyLen: 16, saltLen: 14},
+	SRTP_AES256_CM_SHA1_80:      {keyLen: 32, saltLen: 14},
+	SRTP_AES256_CM_SHA1_32:      {keyLen: 32, saltLen: 14},
+	SRTP_NULL_HMAC_SHA1_80:      {keyLen: 16, saltLen: 14},
+	SRTP_NULL_HMAC_SHA1_32:      {keyLen: 16, saltLen: 14},
+	SRTP_AEAD_AES_128_GCM:       {keyLen: 16, saltLen: 12},
+	SRTP_AEAD_AES_256_GCM:       {keyLen: 32, saltLen: 12},
+}
+
+// SRTPProtectionProfileKeySaltLength returns the SRTP master key and salt
+// lengths, in bytes, for profile, as used when exporting SRTP keying
+// material via State.ExportKeyingMaterial. ok is false for an unrecognized
+// profile.
+func SRTPProtectionProfileKeySaltLength(profile SRTPProtectionProfile) (keyLen, saltLen int, ok bool) {
+	lengths, ok := srtpProtectionProfileKeySaltLengths[profile]
+	if !ok {
+		return 0, 0, false
+	}
+
+	return lengths.keyLen, lengths.saltLen, true
+}
+
+// SRTPProfileSelector picks the SRTP protection profile a server will use
+// from the profiles the client offered and the profiles the server
+// supports, in that order, so a server can implement a policy stronger than
+// "pick the first client-offered profile" (the default when Config's
+// selector is nil) -- for example always preferring an AEAD profile.
+// Returning an error aborts the handshake with a fatal alert.
+type SRTPProfileSelector func(client, server []SRTPProtectionProfile) (SRTPProtectionProfile, error)
+
+// selectSRTPProtectionProfile picks a profile using selector when set, or
+// falls back to the default "first client-offered profile the server also
+// supports" policy. It returns errServerNoMatchingSRTPProfile both when no
+// shared profile exists and when selector picks one the client never
+// offered, so a misbehaving selector can't smuggle an unoffered profile
+// past the client.
+func selectSRTPProtectionProfile(
+	selector SRTPProfileSelector,
+	client, server []SRTPProtectionProfile,
+) (SRTPProtectionProfile, error) {
+	if selector != nil {
+		profile, err := selector(client, server)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range client {
+			if c == profile {
+				return profile, nil
+			}
+		}
+
+		return 0, errServerNoMatchingSRTPProfile
+	}
+
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c, nil
+			}
+		}
+	}
+
+	return 0, errServerNoMatchingSRTPProfile
+}
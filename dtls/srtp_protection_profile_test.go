@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package dtls
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSRTPProtectionProfileKeySaltLength(t *testing.T) {
+	keyLen, saltLen, ok := SRTPProtectionProfileKeySaltLength(SRTP_AEAD_AES_128_GCM)
+	if !ok || keyLen != 16 || saltLen != 12 {
+		t.Errorf("SRTP_AEAD_AES_128_GCM: got (%d, %d, %v), want (16, 12, true)", keyLen, saltLen, ok)
+	}
+
+	keyLen, saltLen, ok = SRTPProtectionProfileKeySaltLength(SRTP_AEAD_AES_256_GCM)
+	if !ok || keyLen != 32 || saltLen != 12 {
+		t.Errorf("SRTP_AEAD_AES_256_GCM: got (%d, %d, %v), want (32, 12, true)", keyLen, saltLen, ok)
+	}
+
+	if _, _, ok := SRTPProtectionProfileKeySaltLength(SRTPProtectionProfile(0xffff)); ok {
+		t.Error("expected ok=false for an unrecognized profile")
+	}
+}
+
+func TestSelectSRTPProtectionProfile(t *testing.T) {
+	client := []SRTPProtectionProfile{SRTP_AES128_CM_HMAC_SHA1_80, SRTP_AEAD_AES_128_GCM}
+	server := []SRTPProtectionProfile{SRTP_AEAD_AES_128_GCM, SRTP_AES128_CM_HMAC_SHA1_80}
+
+	t.Run("default policy picks first client-offered profile", func(t *testing.T) {
+		profile, err := selectSRTPProtectionProfile(nil, client, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile != SRTP_AES128_CM_HMAC_SHA1_80 {
+			t.Errorf("got %v, want SRTP_AES128_CM_HMAC_SHA1_80", profile)
+		}
+	})
+
+	t.Run("selector overrides the default policy", func(t *testing.T) {
+		preferGCM := func(client, server []SRTPProtectionProfile) (SRTPProtectionProfile, error) {
+			for _, c := range client {
+				if c == SRTP_AEAD_AES_128_GCM {
+					return c, nil
+				}
+			}
+
+			return client[0], nil
+		}
+
+		profile, err := selectSRTPProtectionProfile(preferGCM, client, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile != SRTP_AEAD_AES_128_GCM {
+			t.Errorf("got %v, want SRTP_AEAD_AES_128_GCM", profile)
+		}
+	})
+
+	t.Run("selector error is fatal", func(t *testing.T) {
+		errSelector := errors.New("policy rejected client profiles")
+		_, err := selectSRTPProtectionProfile(
+			func(client, server []SRTPProtectionProfile) (SRTPProtectionProfile, error) {
+				return 0, errSelector
+			},
+			client, server,
+		)
+		if !errors.Is(err, errSelector) {
+			t.Errorf("got %v, want %v", err, errSelector)
+		}
+	})
+
+	t.Run("selector picking an unoffered profile is rejected", func(t *testing.T) {
+		_, err := selectSRTPProtectionProfile(
+			func(client, server []SRTPProtectionProfile) (SRTPProtectionProfile, error) {
+				return SRTP_AES256_CM_SHA1_80, nil
+			},
+			client, server,
+		)
+		if !errors.Is(err, errServerNoMatchingSRTPProfile) {
+			t.Errorf("got %v, want errServerNoMatchingSRTPProfile", err)
+		}
+	})
+
+	t.Run("no shared profile", func(t *testing.T) {
+		_, err := selectSRTPProtectionProfile(nil, []SRTPProtectionProfile{SRTP_AES256_CM_SHA1_80}, server)
+		if !errors.Is(err, errServerNoMatchingSRTPProfile) {
+			t.Errorf("got %v, want errServerNoMatchingSRTPProfile", err)
+		}
+	})
+}
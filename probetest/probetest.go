@@ -10,6 +10,7 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/ptutil/safelog"
@@ -37,6 +39,23 @@ const (
 	dataChannelCloseTimeout = 5 * time.Second
 	// Default STUN URL
 	defaultStunUrls = "stun:stun.l.google.com:19302,stun:stun.voip.blackberry.com:3478"
+
+	// probeHandshake is a fixed text frame the probe sends immediately after
+	// the DataChannel opens, before any ping or bulk frame, so the far end
+	// can tell a quality probe apart from a plain reachability check.
+	probeHandshake = "snowflake-probe-quality-v1"
+
+	// Number of timestamped ping frames sent to measure RTT and jitter, the
+	// gap between them, and how long to keep listening for echoes of the
+	// last one before giving up.
+	qualityProbePingCount   = 5
+	qualityProbePingGap     = 200 * time.Millisecond
+	qualityProbePingTimeout = 2 * time.Second
+
+	// Number and size of bulk-data frames sent to estimate achieved
+	// send-side throughput.
+	qualityProbeBulkCount = 4
+	qualityProbeBulkSize  = 16 * 1024
 )
 
 type ProbeHandler struct {
@@ -50,8 +69,12 @@ func (h ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // Create a PeerConnection from an SDP offer. Blocks until the gathering of ICE
 // candidates is complete and the answer is available in LocalDescription.
+// dataChan receives the proxy's DataChannel as soon as it's created, so a
+// caller can run a quality probe on it once dataChanOpen fires. The second
+// return value is how long ICE gathering actually took, for ProbeReport.
 func makePeerConnectionFromOffer(stunURL string, sdp *webrtc.SessionDescription,
-	dataChanOpen chan struct{}, dataChanClosed chan struct{}, iceGatheringTimeout time.Duration) (*webrtc.PeerConnection, error) {
+	dataChanOpen chan struct{}, dataChanClosed chan struct{}, dataChan chan *webrtc.DataChannel,
+	iceGatheringTimeout time.Duration) (*webrtc.PeerConnection, time.Duration, error) {
 
 	settingsEngine := webrtc.SettingEngine{}
 	// Use the SetNet setting https://pkg.go.dev/github.com/pion/webrtc/v3#SettingEngine.SetNet
@@ -70,9 +93,10 @@ func makePeerConnectionFromOffer(stunURL string, sdp *webrtc.SessionDescription,
 	}
 	pc, err := api.NewPeerConnection(config)
 	if err != nil {
-		return nil, fmt.Errorf("accept: NewPeerConnection: %s", err)
+		return nil, 0, fmt.Errorf("accept: NewPeerConnection: %s", err)
 	}
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dataChan <- dc
 		dc.OnOpen(func() {
 			close(dataChanOpen)
 		})
@@ -84,13 +108,14 @@ func makePeerConnectionFromOffer(stunURL string, sdp *webrtc.SessionDescription,
 	// As of v3.0.0, pion-webrtc uses trickle ICE by default.
 	// We have to wait for candidate gathering to complete
 	// before we send the offer
+	gatherStart := time.Now()
 	done := webrtc.GatheringCompletePromise(pc)
 	err = pc.SetRemoteDescription(*sdp)
 	if err != nil {
 		if inerr := pc.Close(); inerr != nil {
 			log.Printf("unable to call pc.Close after pc.SetRemoteDescription with error: %v", inerr)
 		}
-		return nil, fmt.Errorf("accept: SetRemoteDescription: %s", err)
+		return nil, 0, fmt.Errorf("accept: SetRemoteDescription: %s", err)
 	}
 
 	answer, err := pc.CreateAnswer(nil)
@@ -98,7 +123,7 @@ func makePeerConnectionFromOffer(stunURL string, sdp *webrtc.SessionDescription,
 		if inerr := pc.Close(); inerr != nil {
 			log.Printf("ICE gathering has generated an error when calling pc.Close: %v", inerr)
 		}
-		return nil, err
+		return nil, 0, err
 	}
 
 	err = pc.SetLocalDescription(answer)
@@ -106,7 +131,7 @@ func makePeerConnectionFromOffer(stunURL string, sdp *webrtc.SessionDescription,
 		if err = pc.Close(); err != nil {
 			log.Printf("pc.Close after setting local description returned : %v", err)
 		}
-		return nil, err
+		return nil, 0, err
 	}
 
 	// Wait for ICE candidate gathering to complete,
@@ -116,7 +141,7 @@ func makePeerConnectionFromOffer(stunURL string, sdp *webrtc.SessionDescription,
 	case <-done:
 	case <-time.After(iceGatheringTimeout):
 	}
-	return pc, nil
+	return pc, time.Since(gatherStart), nil
 }
 
 func probeHandler(stunURL string, w http.ResponseWriter, r *http.Request) {
@@ -148,10 +173,11 @@ func probeHandler(stunURL string, w http.ResponseWriter, r *http.Request) {
 
 	dataChanOpen := make(chan struct{})
 	dataChanClosed := make(chan struct{})
+	dataChan := make(chan *webrtc.DataChannel, 1)
 	// TODO refactor: DRY this must be below `ResponseHeaderTimeout` in proxy
 	// https://gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/-/blob/e1d9b4ace69897521cc29585b5084c5f4d1ce874/proxy/lib/snowflake.go#L207
 	iceGatheringTimeout := 10 * time.Second
-	pc, err := makePeerConnectionFromOffer(stunURL, sdp, dataChanOpen, dataChanClosed, iceGatheringTimeout)
+	pc, gatherDuration, err := makePeerConnectionFromOffer(stunURL, sdp, dataChanOpen, dataChanClosed, dataChan, iceGatheringTimeout)
 	if err != nil {
 		log.Printf("Error making WebRTC connection: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -196,6 +222,14 @@ func probeHandler(stunURL string, w http.ResponseWriter, r *http.Request) {
 
 		select {
 		case <-dataChanOpen:
+			if dc := <-dataChan; dc != nil {
+				report := runQualityProbe(pc, dc, gatherDuration)
+				if encoded, err := messages.EncodeProbeReport(report); err != nil {
+					log.Printf("Error encoding probe report: %v", err)
+				} else {
+					log.Printf("Probe report: %s", encoded)
+				}
+			}
 			// Let's not close the `PeerConnection` immediately now,
 			// instead let's wait for the peer (or timeout)
 			// to close the connection,
@@ -220,6 +254,121 @@ func probeHandler(stunURL string, w http.ResponseWriter, r *http.Request) {
 
 }
 
+// probePingFrame is one timestamped ping frame of the quality probe; the far
+// end is expected to echo it back unmodified so the probe can measure
+// round-trip latency.
+type probePingFrame struct {
+	Seq          int   `json:"seq"`
+	SentUnixNano int64 `json:"sent_unix_nano"`
+}
+
+// runQualityProbe sends probeHandshake, then qualityProbePingCount
+// timestamped ping frames and qualityProbeBulkCount bulk-data frames over dc,
+// and returns the result as a messages.ProbeReport. RTT and jitter are only
+// computed from pings the far end echoes back; today's proxy data channel
+// handler doesn't echo probe frames yet (see
+// https://gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/-/blob/main/proxy/lib/snowflake.go),
+// so those fields read zero until it does. Everything runQualityProbe can
+// measure unilaterally -- the selected candidate pair's type, whether a TURN
+// relay was needed, and how fast the bulk frames could be queued -- is
+// always reported.
+func runQualityProbe(pc *webrtc.PeerConnection, dc *webrtc.DataChannel, gatherDuration time.Duration) messages.ProbeReport {
+	report := messages.ProbeReport{
+		ICEGatheringMillis: float64(gatherDuration.Milliseconds()),
+	}
+
+	if pair, err := pc.SCTP().Transport().ICETransport().GetSelectedCandidatePair(); err == nil && pair != nil {
+		report.CandidatePairType = messages.CandidatePairType(pair.Local.Typ.String())
+		report.UsedTURN = pair.Local.Typ == webrtc.ICECandidateTypeRelay
+	}
+
+	var mutex sync.Mutex
+	sent := make(map[int]time.Time, qualityProbePingCount)
+	var rtts []time.Duration
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var ping probePingFrame
+		if err := json.Unmarshal(msg.Data, &ping); err != nil {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if sentAt, ok := sent[ping.Seq]; ok {
+			rtts = append(rtts, time.Since(sentAt))
+			delete(sent, ping.Seq)
+		}
+	})
+
+	if err := dc.SendText(probeHandshake); err != nil {
+		return report
+	}
+
+	for seq := 0; seq < qualityProbePingCount; seq++ {
+		ping := probePingFrame{Seq: seq, SentUnixNano: time.Now().UnixNano()}
+		encoded, err := json.Marshal(ping)
+		if err != nil {
+			continue
+		}
+		mutex.Lock()
+		sent[seq] = time.Now()
+		mutex.Unlock()
+		if err := dc.Send(encoded); err != nil {
+			break
+		}
+		time.Sleep(qualityProbePingGap)
+	}
+	time.Sleep(qualityProbePingTimeout)
+
+	mutex.Lock()
+	report.RTTMillis, report.JitterMillis = summarizeRTTs(rtts)
+	mutex.Unlock()
+
+	bulkFrame := make([]byte, qualityProbeBulkSize)
+	bulkStart := time.Now()
+	var bulkBytes int
+	for i := 0; i < qualityProbeBulkCount; i++ {
+		if err := dc.Send(bulkFrame); err != nil {
+			break
+		}
+		bulkBytes += len(bulkFrame)
+	}
+	if elapsed := time.Since(bulkStart); elapsed > 0 {
+		report.ThroughputKbps = float64(bulkBytes) * 8 / 1000 / elapsed.Seconds()
+	}
+
+	return report
+}
+
+// summarizeRTTs returns the mean RTT and the mean absolute difference
+// between consecutive RTTs (a simple jitter estimate, in the style of RFC
+// 3550's interarrival jitter) from a set of ping round-trip times. Both are
+// zero if fewer than two RTTs were observed.
+func summarizeRTTs(rtts []time.Duration) (meanMillis, jitterMillis float64) {
+	if len(rtts) == 0 {
+		return 0, 0
+	}
+	var total time.Duration
+	for _, rtt := range rtts {
+		total += rtt
+	}
+	mean := total / time.Duration(len(rtts))
+	if len(rtts) < 2 {
+		return float64(mean.Milliseconds()), 0
+	}
+
+	var deviation time.Duration
+	for i := 1; i < len(rtts); i++ {
+		diff := rtts[i] - rtts[i-1]
+		if diff < 0 {
+			diff = -diff
+		}
+		deviation += diff
+	}
+	jitter := deviation / time.Duration(len(rtts)-1)
+
+	return float64(mean.Milliseconds()), float64(jitter.Milliseconds())
+}
+
 func main() {
 	var acmeEmail string
 	var acmeHostnamesCommas string
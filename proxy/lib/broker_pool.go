@@ -0,0 +1,180 @@
+package snowflake_proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"tgragnato.it/snowflake/common/event"
+)
+
+// brokerBackoffBase, brokerBackoffMax, and brokerDemoteThreshold tune how a
+// brokerPool reacts to a broker that stops answering: it takes
+// brokerDemoteThreshold consecutive failures before a broker is considered
+// unhealthy, and an unhealthy broker's backoff then doubles from
+// brokerBackoffBase up to brokerBackoffMax with every further failure.
+const (
+	brokerBackoffBase     = 10 * time.Second
+	brokerBackoffMax      = 5 * time.Minute
+	brokerDemoteThreshold = 3
+)
+
+// brokerBackoffDuration returns how long a broker should be skipped after
+// consecutiveFailures in a row, doubling from brokerBackoffBase and
+// saturating at brokerBackoffMax.
+func brokerBackoffDuration(consecutiveFailures int) time.Duration {
+	backoff := brokerBackoffBase
+	for i := brokerDemoteThreshold; i < consecutiveFailures; i++ {
+		backoff *= 2
+		if backoff >= brokerBackoffMax {
+			return brokerBackoffMax
+		}
+	}
+	return backoff
+}
+
+// brokerHealth tracks one broker's recent rendezvous outcomes within a
+// brokerPool.
+type brokerHealth struct {
+	consecutiveFailures int
+	backoffUntil        time.Time
+	healthy             bool
+}
+
+// brokerPool round-robins proxy/broker rendezvous across several
+// SignalingServers, preferring whichever one last succeeded and backing off
+// a broker for a while after repeated failures, so a proxy operator can
+// configure several brokers for resilience during a censorship event.
+type brokerPool struct {
+	mu       sync.Mutex
+	servers  []*SignalingServer
+	urls     []string
+	health   []brokerHealth
+	lastGood int
+	events   event.SnowflakeEventDispatcher
+}
+
+// newBrokerPool builds a brokerPool over servers, all initially considered
+// healthy. events, if non-nil, receives EventOnBrokerDemoted/
+// EventOnBrokerPromoted as the pool's view of each broker's health changes.
+func newBrokerPool(servers []*SignalingServer, events event.SnowflakeEventDispatcher) *brokerPool {
+	p := &brokerPool{
+		servers: servers,
+		urls:    make([]string, len(servers)),
+		health:  make([]brokerHealth, len(servers)),
+		events:  events,
+	}
+	for i, s := range servers {
+		p.urls[i] = s.url.String()
+		p.health[i] = brokerHealth{healthy: true}
+	}
+	return p
+}
+
+// pick returns the index of the broker the pool should try next: lastGood,
+// if it isn't currently backed off, otherwise the next broker in rotation
+// that isn't backed off, otherwise (every broker is backed off) whichever
+// one's backoff expires soonest, so the pool always returns a broker to try
+// rather than refusing outright.
+func (p *brokerPool) pick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.health[p.lastGood].backoffUntil.Before(now) {
+		return p.lastGood
+	}
+	for i := 1; i <= len(p.servers); i++ {
+		idx := (p.lastGood + i) % len(p.servers)
+		if p.health[idx].backoffUntil.Before(now) {
+			return idx
+		}
+	}
+
+	soonest := 0
+	for i, h := range p.health {
+		if h.backoffUntil.Before(p.health[soonest].backoffUntil) {
+			soonest = i
+		}
+	}
+	return soonest
+}
+
+// recordResult updates idx's health following a rendezvous attempt that
+// either succeeded (err == nil) or failed to reach the broker at all.
+func (p *brokerPool) recordResult(idx int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := &p.health[idx]
+	if err == nil {
+		wasUnhealthy := !h.healthy
+		h.consecutiveFailures = 0
+		h.backoffUntil = time.Time{}
+		h.healthy = true
+		p.lastGood = idx
+		if wasUnhealthy && p.events != nil {
+			p.events.OnNewSnowflakeEvent(event.EventOnBrokerPromoted{BrokerURL: p.urls[idx]})
+		}
+		return
+	}
+
+	h.consecutiveFailures++
+	if h.consecutiveFailures >= brokerDemoteThreshold {
+		wasHealthy := h.healthy
+		h.healthy = false
+		h.backoffUntil = time.Now().Add(brokerBackoffDuration(h.consecutiveFailures))
+		if wasHealthy && p.events != nil {
+			p.events.OnNewSnowflakeEvent(event.EventOnBrokerDemoted{
+				BrokerURL:           p.urls[idx],
+				ConsecutiveFailures: h.consecutiveFailures,
+			})
+		}
+	}
+}
+
+// pollOffer is SignalingServer.pollOffer, tried against a broker chosen by
+// pick and recorded back into the pool's health tracking. A transport or
+// decode failure demotes the broker; a legitimate "no client waiting" poll
+// does not.
+func (p *brokerPool) pollOffer(sid string, proxyType string, acceptedRelayPattern string) (*webrtc.SessionDescription, string) {
+	idx := p.pick()
+	offer, relayURL, err := p.servers[idx].pollOfferWithStatus(sid, proxyType, acceptedRelayPattern)
+	p.recordResult(idx, err)
+	return offer, relayURL
+}
+
+// sendAnswer is SignalingServer.sendAnswer, tried against the same broker
+// that offered sid (the one pick most recently returned to pollOffer) and
+// recorded back into the pool's health tracking.
+func (p *brokerPool) sendAnswer(sid string, pc *webrtc.PeerConnection) error {
+	idx := p.pick()
+	err := p.servers[idx].sendAnswer(sid, pc)
+	p.recordResult(idx, err)
+	return err
+}
+
+// pollBrokerOffer polls sf.brokerFailover if configured, otherwise the
+// single sf.broker, for a new client offer. It takes sf.mu only long enough
+// to snapshot which of the two Reconfigure last set up.
+func (sf *SnowflakeProxy) pollBrokerOffer(sid string, proxyType string, acceptedRelayPattern string) (*webrtc.SessionDescription, string) {
+	sf.mu.RLock()
+	pool, single := sf.brokerFailover, sf.broker
+	sf.mu.RUnlock()
+	if pool != nil {
+		return pool.pollOffer(sid, proxyType, acceptedRelayPattern)
+	}
+	return single.pollOffer(sid, proxyType, acceptedRelayPattern)
+}
+
+// sendBrokerAnswer sends pc's answer through sf.brokerFailover if
+// configured, otherwise the single sf.broker.
+func (sf *SnowflakeProxy) sendBrokerAnswer(sid string, pc *webrtc.PeerConnection) error {
+	sf.mu.RLock()
+	pool, single := sf.brokerFailover, sf.broker
+	sf.mu.RUnlock()
+	if pool != nil {
+		return pool.sendAnswer(sid, pc)
+	}
+	return single.sendAnswer(sid, pc)
+}
@@ -0,0 +1,87 @@
+package snowflake_proxy
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"tgragnato.it/snowflake/common/event"
+)
+
+type recordingEventReceiver struct {
+	events []event.SnowflakeEvent
+}
+
+func (r *recordingEventReceiver) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
+	r.events = append(r.events, e)
+}
+
+func newTestBrokerPool(n int) *brokerPool {
+	servers := make([]*SignalingServer, n)
+	for i := range servers {
+		s, err := newSignalingServer(fmt.Sprintf("https://broker%d.example.com", i))
+		if err != nil {
+			panic(err)
+		}
+		servers[i] = s
+	}
+	events := event.NewSnowflakeEventDispatcher()
+	return newBrokerPool(servers, events)
+}
+
+func TestBrokerPool(t *testing.T) {
+	Convey("A fresh pool prefers broker 0", t, func() {
+		p := newTestBrokerPool(3)
+		So(p.pick(), ShouldEqual, 0)
+	})
+
+	Convey("A broker is demoted only after brokerDemoteThreshold consecutive failures", t, func() {
+		p := newTestBrokerPool(2)
+		for i := 0; i < brokerDemoteThreshold-1; i++ {
+			p.recordResult(0, fmt.Errorf("boom"))
+			So(p.pick(), ShouldEqual, 0)
+		}
+		p.recordResult(0, fmt.Errorf("boom"))
+		So(p.pick(), ShouldEqual, 1)
+	})
+
+	Convey("A success on the current broker keeps it preferred", t, func() {
+		p := newTestBrokerPool(2)
+		p.recordResult(0, nil)
+		So(p.pick(), ShouldEqual, 0)
+	})
+
+	Convey("Demotion and promotion fire the matching events", t, func() {
+		receiver := &recordingEventReceiver{}
+		events := event.NewSnowflakeEventDispatcher()
+		events.AddSnowflakeEventListener(receiver)
+
+		servers := make([]*SignalingServer, 2)
+		for i := range servers {
+			s, err := newSignalingServer(fmt.Sprintf("https://broker%d.example.com", i))
+			So(err, ShouldBeNil)
+			servers[i] = s
+		}
+		p := newBrokerPool(servers, events)
+
+		for i := 0; i < brokerDemoteThreshold; i++ {
+			p.recordResult(0, fmt.Errorf("boom"))
+		}
+		So(receiver.events, ShouldHaveLength, 1)
+		So(receiver.events[0], ShouldHaveSameTypeAs, event.EventOnBrokerDemoted{})
+
+		p.recordResult(0, nil)
+		So(receiver.events, ShouldHaveLength, 2)
+		So(receiver.events[1], ShouldHaveSameTypeAs, event.EventOnBrokerPromoted{})
+	})
+
+	Convey("If every broker is backed off, pick still returns one", t, func() {
+		p := newTestBrokerPool(2)
+		for _, idx := range []int{0, 1} {
+			for i := 0; i < brokerDemoteThreshold; i++ {
+				p.recordResult(idx, fmt.Errorf("boom"))
+			}
+		}
+		So(p.pick(), ShouldBeIn, 0, 1)
+	})
+}
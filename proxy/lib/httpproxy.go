@@ -0,0 +1,25 @@
+package snowflake_proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// buildProxyFunc returns the http.Transport.Proxy function customtransport
+// should use for broker rendezvous and NAT probe requests. An empty
+// rawProxyURL falls back to http.ProxyFromEnvironment, so HTTPS_PROXY/
+// ALL_PROXY/NO_PROXY are honored the same way they are for any other Go
+// program, rather than being silently ignored. A non-empty rawProxyURL is
+// parsed once and used unconditionally, the same way SnowflakeProxy.BrokerURL
+// and friends are parsed once by their own callers.
+func buildProxyFunc(rawProxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if rawProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(rawProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
@@ -0,0 +1,48 @@
+package snowflake_proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBuildProxyFuncEmpty(t *testing.T) {
+	t.Parallel()
+
+	proxyFunc, err := buildProxyFunc("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "https://snowflake-broker.example.com/", nil)
+	got, err := proxyFunc(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected no proxy without HTTPS_PROXY/ALL_PROXY set, got %v", got)
+	}
+}
+
+func TestBuildProxyFuncExplicit(t *testing.T) {
+	t.Parallel()
+
+	proxyFunc, err := buildProxyFunc("http://proxy.example.com:3128")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "https://snowflake-broker.example.com/", nil)
+	got, err := proxyFunc(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got == nil || got.String() != "http://proxy.example.com:3128" {
+		t.Errorf("expected proxy url http://proxy.example.com:3128, got %v", got)
+	}
+}
+
+func TestBuildProxyFuncInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := buildProxyFunc(":://not-a-url"); err == nil {
+		t.Error("expected an error for an invalid proxy url")
+	}
+}
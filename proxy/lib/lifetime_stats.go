@@ -0,0 +1,140 @@
+package snowflake_proxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+)
+
+// lifetimeStatsBucketWidth and lifetimeStatsBucketCount size
+// lifetimeStats.Buckets: a rolling 24h window in 1h slices, recent enough
+// to be useful after a restart but small enough that the state file never
+// grows unbounded.
+const (
+	lifetimeStatsBucketWidth = time.Hour
+	lifetimeStatsBucketCount = 24
+)
+
+// lifetimeStats is periodicProxyStats' cumulative, optionally-persisted
+// counterpart to its per-tick EventOnProxyStats: Since and the Total* fields
+// only ever grow, while Buckets holds the most recent lifetimeStatsBucketCount
+// hourly slices (oldest first) backing EventOnProxyLifetimeStats.Window. It's
+// marshaled as-is to/from SnowflakeProxy.StatsFilename by loadLifetimeStats
+// and save.
+type lifetimeStats struct {
+	Since                                 time.Time
+	TotalConnectionCount                  int
+	TotalFailedConnectionCount            uint
+	TotalInboundBytes, TotalOutboundBytes int64
+	Buckets                               []event.LifetimeStatsBucket
+}
+
+// loadLifetimeStats reads lifetime totals and the rolling window back from
+// path, for a proxy resuming after a crash or upgrade. A missing file (e.g.
+// the first time a proxy runs with StatsFilename set) is not an error: it
+// just starts a fresh lifetimeStats with Since set to now.
+func loadLifetimeStats(path string) (*lifetimeStats, error) {
+	if path == "" {
+		return &lifetimeStats{Since: time.Now()}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &lifetimeStats{Since: time.Now()}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ls lifetimeStats
+	if err := json.Unmarshal(raw, &ls); err != nil {
+		return nil, err
+	}
+	if ls.Since.IsZero() {
+		ls.Since = time.Now()
+	}
+	return &ls, nil
+}
+
+// save writes ls to path as JSON, via a temp file and rename so a reader (or
+// a crash mid-write) never sees a half-written file.
+func (ls *lifetimeStats) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(ls)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// record folds one tick's worth of raw counters, observed at now, into ls:
+// the lifetime totals always grow, and now is bucketed to the hour to
+// either accumulate into the most recent open bucket or start a new one,
+// trimming from the front so Buckets never holds more than
+// lifetimeStatsBucketCount entries. inboundBytes/outboundBytes are raw byte
+// counts (unlike EventOnProxyStats.InboundBytes/OutboundBytes, which
+// periodicProxyStats formats into InboundUnit/OutboundUnit for human
+// display and would otherwise compound rounding error here).
+func (ls *lifetimeStats) record(now time.Time, connectionCount int, failedConnectionCount uint, inboundBytes, outboundBytes int64) {
+	ls.TotalConnectionCount += connectionCount
+	ls.TotalFailedConnectionCount += failedConnectionCount
+	ls.TotalInboundBytes += inboundBytes
+	ls.TotalOutboundBytes += outboundBytes
+
+	start := now.Truncate(lifetimeStatsBucketWidth)
+	if n := len(ls.Buckets); n > 0 && ls.Buckets[n-1].Start.Equal(start) {
+		b := &ls.Buckets[n-1]
+		b.ConnectionCount += connectionCount
+		b.FailedConnectionCount += failedConnectionCount
+		b.InboundBytes += inboundBytes
+		b.OutboundBytes += outboundBytes
+	} else {
+		ls.Buckets = append(ls.Buckets, event.LifetimeStatsBucket{
+			Start:                 start,
+			ConnectionCount:       connectionCount,
+			FailedConnectionCount: failedConnectionCount,
+			InboundBytes:          inboundBytes,
+			OutboundBytes:         outboundBytes,
+		})
+	}
+
+	if len(ls.Buckets) > lifetimeStatsBucketCount {
+		ls.Buckets = ls.Buckets[len(ls.Buckets)-lifetimeStatsBucketCount:]
+	}
+}
+
+// event builds the EventOnProxyLifetimeStats snapshot periodicProxyStats
+// dispatches after each record.
+func (ls *lifetimeStats) event() event.EventOnProxyLifetimeStats {
+	window := make([]event.LifetimeStatsBucket, len(ls.Buckets))
+	copy(window, ls.Buckets)
+
+	return event.EventOnProxyLifetimeStats{
+		Since:                      ls.Since,
+		TotalConnectionCount:       ls.TotalConnectionCount,
+		TotalFailedConnectionCount: ls.TotalFailedConnectionCount,
+		TotalInboundBytes:          ls.TotalInboundBytes,
+		TotalOutboundBytes:         ls.TotalOutboundBytes,
+		Window:                     window,
+	}
+}
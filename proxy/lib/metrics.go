@@ -2,8 +2,11 @@ package snowflake_proxy
 
 import (
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -12,38 +15,189 @@ const (
 	metricNamespace = "tor_snowflake_proxy"
 )
 
+// Per-connection QoS collectors below are labeled by nat_type, the proxy's
+// own NAT classification (see getCurrentNATType), not by the client's
+// country: the broker-proxy protocol (common/messages) never tells a proxy
+// the client's country, so there's nothing to label these with on a
+// per-connection basis. Only the broker itself knows client countries, via
+// geoip on the client's polling IP (see broker/metrics.go), which is why
+// totalConnections below is the one collector that carries a country label.
 type Metrics struct {
 	totalInBoundTraffic    prometheus.Counter
 	totalOutBoundTraffic   prometheus.Counter
 	totalConnections       *prometheus.CounterVec
 	totalFailedConnections prometheus.Counter
+	activeSessions         *prometheus.GaugeVec
+	sessionBytesIn         *prometheus.HistogramVec
+	sessionBytesOut        *prometheus.HistogramVec
+	sessionDuration        *prometheus.HistogramVec
+	timeToFirstByte        *prometheus.HistogramVec
+	iceGatheringTime       *prometheus.HistogramVec
+	brokerPolls            *prometheus.CounterVec
+	offersReceived         prometheus.Counter
+	answersSent            *prometheus.CounterVec
+	peerConnectionsOpened  prometheus.Counter
+	peerConnectionsClosed  prometheus.Counter
+	dataChannelOpenLatency prometheus.Histogram
+	connectingClients      prometheus.GaugeFunc
+	currentNATType         *prometheus.GaugeVec
+	relayDialFailures      *prometheus.CounterVec
+	negotiationFailures    *prometheus.CounterVec
+	buildInfo              *prometheus.GaugeVec
+
+	// tokensSource, when non-nil, is the owning SnowflakeProxy's current
+	// client count, read by connectingClients. Set by SnowflakeProxy.Start
+	// (and Reconfigure); nil if these Metrics were never attached to a
+	// running proxy.
+	tokensSource *uint64
 }
 
-func NewMetrics() *Metrics {
-	return &Metrics{
+// NewMetrics builds a Metrics with constLabels attached to every collector,
+// so an operator running a pool of proxies can tag which instance each
+// series came from (e.g. ConstLabels{"instance": "proxy-3"}).
+func NewMetrics(constLabels prometheus.Labels) *Metrics {
+	m := &Metrics{
 		totalConnections: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: metricNamespace,
-			Name:      "connections_total",
-			Help:      "The total number of successful connections handled by the snowflake proxy",
+			Namespace:   metricNamespace,
+			Name:        "connections_total",
+			Help:        "The total number of successful connections handled by the snowflake proxy",
+			ConstLabels: constLabels,
 		},
 			[]string{"country"},
 		),
 		totalFailedConnections: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: metricNamespace,
-			Name:      "connection_timeouts_total",
-			Help:      "The total number of client connection attempts that failed after successful rendezvous. Note that failures can occur for reasons outside of the proxy's control, such as the client's NAT and censorship situation.",
+			Namespace:   metricNamespace,
+			Name:        "connection_timeouts_total",
+			Help:        "The total number of client connection attempts that failed after successful rendezvous. Note that failures can occur for reasons outside of the proxy's control, such as the client's NAT and censorship situation.",
+			ConstLabels: constLabels,
 		}),
 		totalInBoundTraffic: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: metricNamespace,
-			Name:      "traffic_inbound_bytes_total",
-			Help:      "The total in bound traffic by the snowflake proxy (KB)",
+			Namespace:   metricNamespace,
+			Name:        "traffic_inbound_bytes_total",
+			Help:        "The total in bound traffic by the snowflake proxy (KB)",
+			ConstLabels: constLabels,
 		}),
 		totalOutBoundTraffic: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: metricNamespace,
-			Name:      "traffic_outbound_bytes_total",
-			Help:      "The total out bound traffic by the snowflake proxy (KB)",
+			Namespace:   metricNamespace,
+			Name:        "traffic_outbound_bytes_total",
+			Help:        "The total out bound traffic by the snowflake proxy (KB)",
+			ConstLabels: constLabels,
+		}),
+		activeSessions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "active_sessions",
+			Help:        "The number of Turbo Tunnel client sessions currently being relayed by the snowflake proxy",
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		sessionBytesIn: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricNamespace,
+			Name:        "session_inbound_bytes",
+			Help:        "Distribution of total inbound bytes relayed per finished client session",
+			Buckets:     prometheus.ExponentialBuckets(1024, 4, 10),
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		sessionBytesOut: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricNamespace,
+			Name:        "session_outbound_bytes",
+			Help:        "Distribution of total outbound bytes relayed per finished client session",
+			Buckets:     prometheus.ExponentialBuckets(1024, 4, 10),
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		sessionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricNamespace,
+			Name:        "session_duration_seconds",
+			Help:        "Distribution of Turbo Tunnel client session lifetimes",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		timeToFirstByte: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricNamespace,
+			Name:        "time_to_first_byte_seconds",
+			Help:        "Distribution of the time between a session's DataChannel opening and its first relayed byte",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		iceGatheringTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricNamespace,
+			Name:        "ice_gathering_time_seconds",
+			Help:        "Distribution of how long WebRTC ICE candidate gathering took while answering an offer",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		brokerPolls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "broker_polls_total",
+			Help:        "The total number of proxy polls made to a broker, labeled by broker and outcome",
+			ConstLabels: constLabels,
+		}, []string{"broker", "outcome"}),
+		offersReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "offers_received_total",
+			Help:        "The total number of client SDP offers received from a broker poll",
+			ConstLabels: constLabels,
+		}),
+		answersSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "answers_sent_total",
+			Help:        "The total number of SDP answers sent to a broker, labeled by outcome",
+			ConstLabels: constLabels,
+		}, []string{"outcome"}),
+		peerConnectionsOpened: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "peer_connections_opened_total",
+			Help:        "The total number of WebRTC peer connections created in response to a broker offer",
+			ConstLabels: constLabels,
+		}),
+		peerConnectionsClosed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "peer_connections_closed_total",
+			Help:        "The total number of WebRTC peer connections closed, however they ended",
+			ConstLabels: constLabels,
+		}),
+		dataChannelOpenLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   metricNamespace,
+			Name:        "data_channel_open_latency_seconds",
+			Help:        "Distribution of the time between a peer connection being created and its DataChannel opening",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}),
+		connectingClients: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "connecting_clients",
+			Help:        "The current number of clients the proxy is in the middle of connecting (from poll to DataChannel open or timeout)",
+			ConstLabels: constLabels,
+		}, func() float64 {
+			if m.tokensSource == nil {
+				return 0
+			}
+			return float64(atomic.LoadUint64(m.tokensSource))
 		}),
+		currentNATType: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "current_nat_type",
+			Help:        "1 for the proxy's current NAT type, 0 for others; see TrackCurrentNATType",
+			ConstLabels: constLabels,
+		}, []string{"nat_type"}),
+		relayDialFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "relay_dial_failures_total",
+			Help:        "The total number of failures to dial the relay websocket, labeled by reason",
+			ConstLabels: constLabels,
+		}, []string{"reason"}),
+		negotiationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricNamespace,
+			Name:        "negotiation_failures_total",
+			Help:        "The total number of client rendezvous attempts that were abandoned before any traffic could be relayed, labeled by reason",
+			ConstLabels: constLabels,
+		}, []string{"reason"}),
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricNamespace,
+			Name:        "build_info",
+			Help:        "Always 1, labeled by the running build's version string; see TrackBuildInfo",
+			ConstLabels: constLabels,
+		}, []string{"version"}),
 	}
+	return m
 }
 
 // Start register the metrics server and serve them on the given address
@@ -55,6 +209,13 @@ func (m *Metrics) Start(addr string) error {
 		}
 	}()
 
+	if err := prometheus.Register(collectors.NewGoCollector()); err != nil {
+		return err
+	}
+	if err := prometheus.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return err
+	}
+
 	return prometheus.Register(m)
 }
 
@@ -63,6 +224,23 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 	m.totalFailedConnections.Collect(ch)
 	m.totalInBoundTraffic.Collect(ch)
 	m.totalOutBoundTraffic.Collect(ch)
+	m.activeSessions.Collect(ch)
+	m.sessionBytesIn.Collect(ch)
+	m.sessionBytesOut.Collect(ch)
+	m.sessionDuration.Collect(ch)
+	m.timeToFirstByte.Collect(ch)
+	m.iceGatheringTime.Collect(ch)
+	m.brokerPolls.Collect(ch)
+	m.offersReceived.Collect(ch)
+	m.answersSent.Collect(ch)
+	m.peerConnectionsOpened.Collect(ch)
+	m.peerConnectionsClosed.Collect(ch)
+	m.dataChannelOpenLatency.Collect(ch)
+	m.connectingClients.Collect(ch)
+	m.currentNATType.Collect(ch)
+	m.relayDialFailures.Collect(ch)
+	m.negotiationFailures.Collect(ch)
+	m.buildInfo.Collect(ch)
 }
 
 func (m *Metrics) Describe(descs chan<- *prometheus.Desc) {
@@ -90,3 +268,125 @@ func (m *Metrics) TrackNewConnection(country string) {
 func (m *Metrics) TrackFailedConnection() {
 	m.totalFailedConnections.Inc()
 }
+
+// TrackSessionStarted increments the active-sessions gauge for a newly
+// joined Turbo Tunnel client session, labeled by the proxy's current NAT
+// type.
+func (m *Metrics) TrackSessionStarted(natType string) {
+	m.activeSessions.With(prometheus.Labels{"nat_type": natType}).Inc()
+}
+
+// TrackSessionEnded records a finished session's total byte counts and
+// lifetime in the per-session histograms, labeled by the proxy's NAT type,
+// and decrements the active-sessions gauge.
+func (m *Metrics) TrackSessionEnded(bytesIn, bytesOut int64, duration time.Duration, natType string) {
+	m.activeSessions.With(prometheus.Labels{"nat_type": natType}).Dec()
+	m.sessionBytesIn.With(prometheus.Labels{"nat_type": natType}).Observe(float64(bytesIn))
+	m.sessionBytesOut.With(prometheus.Labels{"nat_type": natType}).Observe(float64(bytesOut))
+	m.sessionDuration.With(prometheus.Labels{"nat_type": natType}).Observe(duration.Seconds())
+}
+
+// TrackTimeToFirstByte records, labeled by the proxy's NAT type, how long
+// it took after a session's DataChannel opened for its first byte to be
+// relayed.
+func (m *Metrics) TrackTimeToFirstByte(delay time.Duration, natType string) {
+	m.timeToFirstByte.With(prometheus.Labels{"nat_type": natType}).Observe(delay.Seconds())
+}
+
+// TrackICEGatheringTime records, labeled by the proxy's NAT type, how long
+// WebRTC ICE candidate gathering took while answering an offer.
+func (m *Metrics) TrackICEGatheringTime(duration time.Duration, natType string) {
+	m.iceGatheringTime.With(prometheus.Labels{"nat_type": natType}).Observe(duration.Seconds())
+}
+
+// TrackBrokerPoll counts a proxy/broker poll, labeled by the broker URL
+// polled and "success" or "failure" (a transport or decode failure; a
+// legitimate "no client waiting" poll is still a success).
+func (m *Metrics) TrackBrokerPoll(brokerURL string, ok bool) {
+	m.brokerPolls.With(prometheus.Labels{"broker": brokerURL, "outcome": outcomeLabel(ok)}).Inc()
+}
+
+// TrackOfferReceived counts a client SDP offer received from a broker poll.
+func (m *Metrics) TrackOfferReceived() {
+	m.offersReceived.Inc()
+}
+
+// TrackAnswerSent counts an SDP answer sent to the broker, labeled by
+// "success" or "failure".
+func (m *Metrics) TrackAnswerSent(ok bool) {
+	m.answersSent.With(prometheus.Labels{"outcome": outcomeLabel(ok)}).Inc()
+}
+
+// TrackPeerConnectionOpened counts a WebRTC peer connection created in
+// response to a broker offer.
+func (m *Metrics) TrackPeerConnectionOpened() {
+	m.peerConnectionsOpened.Inc()
+}
+
+// TrackPeerConnectionClosed counts a WebRTC peer connection closing, however
+// the session ended.
+func (m *Metrics) TrackPeerConnectionClosed() {
+	m.peerConnectionsClosed.Inc()
+}
+
+// TrackDataChannelOpenLatency records how long it took a peer connection's
+// DataChannel to open after the peer connection was created.
+func (m *Metrics) TrackDataChannelOpenLatency(duration time.Duration) {
+	m.dataChannelOpenLatency.Observe(duration.Seconds())
+}
+
+// TrackCurrentNATType sets the current_nat_type gauge to 1 for natType and 0
+// for previousNATType (if it differs), so the series for the proxy's active
+// NAT type is always the one reading 1.
+func (m *Metrics) TrackCurrentNATType(natType, previousNATType string) {
+	if previousNATType != "" && previousNATType != natType {
+		m.currentNATType.With(prometheus.Labels{"nat_type": previousNATType}).Set(0)
+	}
+	m.currentNATType.With(prometheus.Labels{"nat_type": natType}).Set(1)
+}
+
+// TrackRelayDialFailure counts a failure to dial the relay websocket,
+// labeled by a short machine-readable reason (e.g. "invalid_relay_url",
+// "dial_failed").
+func (m *Metrics) TrackRelayDialFailure(reason string) {
+	m.relayDialFailures.With(prometheus.Labels{"reason": reason}).Inc()
+}
+
+// TrackSessionDuration observes a finished client session's lifetime in the
+// session_duration_seconds histogram, labeled by the proxy's NAT type at the
+// time the session ended. This is the EventCollector-facing counterpart to
+// TrackSessionEnded, driven from EventOnProxySessionEnded instead of being
+// called directly out of datachannelHandler.
+func (m *Metrics) TrackSessionDuration(duration time.Duration, natType string) {
+	m.sessionDuration.With(prometheus.Labels{"nat_type": natType}).Observe(duration.Seconds())
+}
+
+// TrackNATType sets the current_nat_type gauge to 1 for natType, driven from
+// EventOnCurrentNATTypeDetermined. Unlike TrackCurrentNATType, it has no
+// previous NAT type to clear to 0; callers that need that invariant should
+// use TrackCurrentNATType directly instead.
+func (m *Metrics) TrackNATType(natType string) {
+	m.currentNATType.With(prometheus.Labels{"nat_type": natType}).Set(1)
+}
+
+// TrackFailure counts a client-negotiation failure reported via
+// EventOnProxyNegotiationFailed, labeled by its short machine-readable
+// reason (e.g. "bad_relay_url", "peer_connection_failed",
+// "broker_answer_failed", "datachannel_timeout").
+func (m *Metrics) TrackFailure(reason string) {
+	m.negotiationFailures.With(prometheus.Labels{"reason": reason}).Inc()
+}
+
+// TrackBuildInfo sets the build_info gauge to 1 for the running version,
+// driven from EventOnProxyStarting, so a scraping operator can tell which
+// build a long-running proxy is on.
+func (m *Metrics) TrackBuildInfo(version string) {
+	m.buildInfo.With(prometheus.Labels{"version": version}).Set(1)
+}
+
+func outcomeLabel(ok bool) string {
+	if ok {
+		return "success"
+	}
+	return "failure"
+}
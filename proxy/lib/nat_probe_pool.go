@@ -0,0 +1,75 @@
+package snowflake_proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// natProbePool round-robins NAT classification probes across several probe
+// URLs, using the same lastGood/backoff strategy as brokerPool: a probe URL
+// is skipped for a while after brokerDemoteThreshold consecutive failures,
+// so a proxy configured with several NATProbeURLs keeps classifying its NAT
+// even while one probe server is down.
+type natProbePool struct {
+	mu       sync.Mutex
+	urls     []string
+	health   []brokerHealth
+	lastGood int
+}
+
+// newNATProbePool builds a natProbePool over urls, all initially considered
+// healthy.
+func newNATProbePool(urls []string) *natProbePool {
+	return &natProbePool{
+		urls:   urls,
+		health: make([]brokerHealth, len(urls)),
+	}
+}
+
+// pick returns the index of the probe URL to try next: lastGood, if it
+// isn't currently backed off, otherwise the next one in rotation that isn't,
+// otherwise (every probe URL is backed off) whichever one's backoff expires
+// soonest.
+func (p *natProbePool) pick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.health[p.lastGood].backoffUntil.Before(now) {
+		return p.lastGood
+	}
+	for i := 1; i <= len(p.urls); i++ {
+		idx := (p.lastGood + i) % len(p.urls)
+		if p.health[idx].backoffUntil.Before(now) {
+			return idx
+		}
+	}
+
+	soonest := 0
+	for i, h := range p.health {
+		if h.backoffUntil.Before(p.health[soonest].backoffUntil) {
+			soonest = i
+		}
+	}
+	return soonest
+}
+
+// recordResult updates idx's health following a probe attempt that either
+// succeeded (err == nil) or failed to reach the probe server at all.
+func (p *natProbePool) recordResult(idx int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := &p.health[idx]
+	if err == nil {
+		h.consecutiveFailures = 0
+		h.backoffUntil = time.Time{}
+		p.lastGood = idx
+		return
+	}
+
+	h.consecutiveFailures++
+	if h.consecutiveFailures >= brokerDemoteThreshold {
+		h.backoffUntil = time.Now().Add(brokerBackoffDuration(h.consecutiveFailures))
+	}
+}
@@ -338,13 +338,11 @@ func TestBrokerInteractions(t *testing.T) {
 	const sampleAnswer = `{"type":"answer","sdp":` + sampleSDP + `}`
 
 	Convey("Proxy connections to broker", t, func() {
-		var err error
-		broker, err = newSignalingServer("localhost", false)
+		broker, err := newSignalingServer("localhost")
 		So(err, ShouldBeNil)
-		tokens = 0
 
 		//Mock peerConnection
-		config = webrtc.Configuration{
+		config := webrtc.Configuration{
 			ICEServers: []webrtc.ICEServer{
 				{
 					URLs: []string{"stun:stun.l.google.com:19302"},
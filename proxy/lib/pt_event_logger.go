@@ -1,8 +1,10 @@
 package snowflake_proxy
 
 import (
+	"encoding/json"
 	"io"
 	"log"
+	"reflect"
 	"sync/atomic"
 	"time"
 
@@ -10,36 +12,70 @@ import (
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/task"
 )
 
-func NewProxyEventLogger(output io.Writer, disableStats bool) event.SnowflakeEventReceiver {
+// NewProxyEventLogger returns an event sink that writes one line per event
+// it's given to output: by default a free-form English sentence via
+// e.String(), or, if jsonOutput is true, one JSON object per event (see
+// proxyEventLogger.logJSON) for piping into journald/Loki/Vector without
+// regex-scraping the human-readable format. Unlike earlier versions of this
+// logger, it no longer decides for itself which event types are worth
+// printing or whether stats events should be suppressed: wire it into a
+// event.MultiSink sink with an Allow/Deny list (see SnowflakeProxy.Sinks)
+// to restrict what it receives.
+func NewProxyEventLogger(output io.Writer, jsonOutput bool) event.SnowflakeEventReceiver {
 	logger := log.New(output, "", log.Flags())
-	return &proxyEventLogger{logger: logger, disableStats: disableStats}
+	return &proxyEventLogger{logger: logger, jsonOutput: jsonOutput}
 }
 
 type proxyEventLogger struct {
-	logger       *log.Logger
-	disableStats bool
+	logger     *log.Logger
+	jsonOutput bool
 }
 
 func (p *proxyEventLogger) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
-	switch e.(type) {
-	case event.EventOnProxyStarting:
-		p.logger.Println(e.String())
+	if p.jsonOutput {
+		p.logJSON(e)
+		return
+	}
 
-		if p.logger.Flags()&log.LUTC == 0 {
-			p.logger.Println("Local time is being used for logging. If you want to " +
-				"share your log, consider to modify the date/time for more anonymity.")
-		}
-	case event.EventOnProxyStats:
-		if !p.disableStats {
-			p.logger.Println(e.String())
+	p.logger.Println(e.String())
+
+	if _, ok := e.(event.EventOnProxyStarting); ok && p.logger.Flags()&log.LUTC == 0 {
+		p.logger.Println("Local time is being used for logging. If you want to " +
+			"share your log, consider to modify the date/time for more anonymity.")
+	}
+}
+
+// logJSON writes e as a single-line JSON object with "type" (the event's Go
+// type name, e.g. "EventOnProxyStats") and "timestamp" added, alongside
+// every typed field e itself carries -- marshaling e generically rather
+// than switching on its type keeps this in sync automatically as
+// common/event grows new event types. The unexported embedded
+// event.SnowflakeEvent marker field every event type carries for
+// IsSnowflakeEvent is stripped since it never holds data worth reporting.
+func (p *proxyEventLogger) logJSON(e event.SnowflakeEvent) {
+	fields := map[string]json.RawMessage{}
+	if raw, err := json.Marshal(e); err == nil {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			p.logger.Printf("eventlogger: could not decode %T as JSON: %v", e, err)
+			return
 		}
-	case event.EventOnCurrentNATTypeDetermined:
-		p.logger.Println(e.String())
-	default:
-		// Suppress logs of these events
-		// https://gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/-/issues/40310
-		// https://gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/-/issues/40413
+	} else {
+		p.logger.Printf("eventlogger: could not encode %T as JSON: %v", e, err)
+		return
+	}
+	delete(fields, "SnowflakeEvent")
+
+	timestamp, _ := json.Marshal(time.Now().UTC().Format(time.RFC3339Nano))
+	typeName, _ := json.Marshal(reflect.TypeOf(e).Name())
+	fields["timestamp"] = timestamp
+	fields["type"] = typeName
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		p.logger.Printf("eventlogger: could not encode %T as JSON: %v", e, err)
+		return
 	}
+	p.logger.Println(string(out))
 }
 
 type periodicProxyStats struct {
@@ -51,10 +87,30 @@ type periodicProxyStats struct {
 	logPeriod             time.Duration
 	task                  *task.Periodic
 	dispatcher            event.SnowflakeEventDispatcher
+
+	// statsFilename, if non-empty, is where lifetime is periodically
+	// flushed to and was reloaded from at startup (see
+	// SnowflakeProxy.StatsFilename). lifetime itself is always kept
+	// in-memory and reported via EventOnProxyLifetimeStats regardless of
+	// whether persistence is configured.
+	statsFilename string
+	lifetime      *lifetimeStats
 }
 
-func newPeriodicProxyStats(logPeriod time.Duration, dispatcher event.SnowflakeEventDispatcher, bytesLogger bytesLogger) *periodicProxyStats {
-	el := &periodicProxyStats{logPeriod: logPeriod, dispatcher: dispatcher, bytesLogger: bytesLogger}
+func newPeriodicProxyStats(logPeriod time.Duration, dispatcher event.SnowflakeEventDispatcher, bytesLogger bytesLogger, statsFilename string) *periodicProxyStats {
+	lifetime, err := loadLifetimeStats(statsFilename)
+	if err != nil {
+		log.Printf("error loading proxy stats file %q, starting fresh: %v", statsFilename, err)
+		lifetime = &lifetimeStats{Since: time.Now()}
+	}
+
+	el := &periodicProxyStats{
+		logPeriod:     logPeriod,
+		dispatcher:    dispatcher,
+		bytesLogger:   bytesLogger,
+		statsFilename: statsFilename,
+		lifetime:      lifetime,
+	}
 	el.task = &task.Periodic{Interval: logPeriod, Execute: el.logTick}
 	el.task.WaitThenStart()
 	return el
@@ -71,14 +127,24 @@ func (p *periodicProxyStats) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
 
 func (p *periodicProxyStats) logTick() error {
 	inboundSum, outboundSum := p.bytesLogger.GetStat()
+	connectionCount := int(p.connectionCount.Swap(0))
+	failedConnectionCount := uint(p.failedConnectionCount.Swap(0))
+
 	e := event.EventOnProxyStats{
 		SummaryInterval:       p.logPeriod,
-		ConnectionCount:       int(p.connectionCount.Swap(0)),
-		FailedConnectionCount: uint(p.failedConnectionCount.Swap(0)),
+		ConnectionCount:       connectionCount,
+		FailedConnectionCount: failedConnectionCount,
 	}
 	e.InboundBytes, e.InboundUnit = formatTraffic(inboundSum)
 	e.OutboundBytes, e.OutboundUnit = formatTraffic(outboundSum)
 	p.dispatcher.OnNewSnowflakeEvent(e)
+
+	p.lifetime.record(time.Now(), connectionCount, failedConnectionCount, inboundSum, outboundSum)
+	if err := p.lifetime.save(p.statsFilename); err != nil {
+		log.Printf("error saving proxy stats file %q: %v", p.statsFilename, err)
+	}
+	p.dispatcher.OnNewSnowflakeEvent(p.lifetime.event())
+
 	return nil
 }
 
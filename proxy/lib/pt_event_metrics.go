@@ -1,6 +1,8 @@
 package snowflake_proxy
 
 import (
+	"time"
+
 	"tgragnato.it/snowflake/common/event"
 )
 
@@ -8,6 +10,20 @@ type EventCollector interface {
 	TrackInBoundTraffic(value int64)
 	TrackOutBoundTraffic(value int64)
 	TrackNewConnection(country string)
+	// TrackSessionDuration records a finished client session's lifetime,
+	// labeled by the proxy's NAT type at the time it ended.
+	TrackSessionDuration(duration time.Duration, natType string)
+	// TrackNATType records the proxy's current NAT classification, as it
+	// changes.
+	TrackNATType(natType string)
+	// TrackFailure counts a client-negotiation failure -- the rendezvous
+	// never reached the point of relaying any traffic -- labeled by a short
+	// machine-readable reason, so an operator can alert on these instead of
+	// tailing logs.
+	TrackFailure(reason string)
+	// TrackBuildInfo publishes the running build's version, driven from
+	// EventOnProxyStarting.
+	TrackBuildInfo(version string)
 }
 
 type EventMetrics struct {
@@ -20,11 +36,19 @@ func NewEventMetrics(collector EventCollector) *EventMetrics {
 
 func (em *EventMetrics) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
 	switch v := e.(type) {
+	case event.EventOnProxyStarting:
+		em.collector.TrackBuildInfo(v.Version)
 	case event.EventOnProxyStats:
 		em.collector.TrackInBoundTraffic(v.InboundBytes)
 		em.collector.TrackOutBoundTraffic(v.OutboundBytes)
 	case event.EventOnProxyConnectionOver:
 		e := e.(event.EventOnProxyConnectionOver)
 		em.collector.TrackNewConnection(e.Country)
+	case event.EventOnProxySessionEnded:
+		em.collector.TrackSessionDuration(v.Duration, getCurrentNATType())
+	case event.EventOnCurrentNATTypeDetermined:
+		em.collector.TrackNATType(v.CurNATType)
+	case event.EventOnProxyNegotiationFailed:
+		em.collector.TrackFailure(v.Reason)
 	}
 }
@@ -0,0 +1,61 @@
+package snowflake_proxy
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedReadWriteCloser wraps an io.ReadWriteCloser so that every byte
+// read or written passes through limiter, shaping a single client session to
+// SnowflakeProxy.PerClientBytesPerSec/PerClientBurst.
+type rateLimitedReadWriteCloser struct {
+	io.ReadWriteCloser
+	limiter *rate.Limiter
+}
+
+// newRateLimitedConn wraps conn with a token-bucket limiter allowing
+// bytesPerSec bytes/sec on average, with bursts up to burst bytes.
+func newRateLimitedConn(conn io.ReadWriteCloser, bytesPerSec float64, burst int) io.ReadWriteCloser {
+	return &rateLimitedReadWriteCloser{
+		ReadWriteCloser: conn,
+		limiter:         rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+	}
+}
+
+func (c *rateLimitedReadWriteCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		if waitErr := waitN(context.Background(), c.limiter, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (c *rateLimitedReadWriteCloser) Write(p []byte) (int, error) {
+	if err := waitN(context.Background(), c.limiter, len(p)); err != nil {
+		return 0, err
+	}
+	return c.ReadWriteCloser.Write(p)
+}
+
+// waitN reserves n tokens from limiter, splitting the request into
+// limiter.Burst()-sized chunks as needed -- rate.Limiter.WaitN refuses any
+// single call requesting more than the burst size, but io.Copy's buffer can
+// be larger than a small configured PerClientBurst.
+func waitN(ctx context.Context, limiter *rate.Limiter, n int) error {
+	burst := limiter.Burst()
+	for n > 0 {
+		chunk := n
+		if burst > 0 && chunk > burst {
+			chunk = burst
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package snowflake_proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RelayDialer abstracts how a proxy opens a connection to a relay once
+// RelayPolicy has approved its URL, so embedders can substitute a custom
+// transport (e.g. a pre-established MASQUE/HTTP3 tunnel) for the default
+// WebSocket dial performed by connectToRelay.
+type RelayDialer interface {
+	DialRelay(ctx context.Context, relayURL string, remoteAddr net.Addr) (net.Conn, error)
+}
+
+// websocketRelayDialer is the RelayPolicy default RelayDialer, preserving
+// the WebSocket dial that connectToRelay has always performed.
+type websocketRelayDialer struct{}
+
+func (websocketRelayDialer) DialRelay(_ context.Context, relayURL string, remoteAddr net.Addr) (net.Conn, error) {
+	conn, _, err := connectToRelay(relayURL, remoteAddr)
+	return conn, err
+}
+
+// relayHealth is the dial history RelayPolicy keeps for one relay URL, used
+// to bias FallbackRelayURLs selection toward relays that have recently been
+// reachable and fast.
+type relayHealth struct {
+	consecutiveFailures int
+	lastLatency         time.Duration
+}
+
+// relayStats is a RelayPolicy's per-URL relayHealth cache.
+type relayStats struct {
+	mu    sync.Mutex
+	byURL map[string]relayHealth
+}
+
+func (s *relayStats) record(relayURL string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byURL == nil {
+		s.byURL = make(map[string]relayHealth)
+	}
+	h := s.byURL[relayURL]
+	if err != nil {
+		h.consecutiveFailures++
+	} else {
+		h.consecutiveFailures = 0
+		h.lastLatency = latency
+	}
+	s.byURL[relayURL] = h
+}
+
+// order returns relayURLs sorted so that the relay with the fewest
+// consecutive dial failures, and among ties the lowest last recorded
+// latency, comes first. Relays with no history yet sort ahead of any relay
+// with a recorded failure.
+func (s *relayStats) order(relayURLs []string) []string {
+	ordered := append([]string(nil), relayURLs...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		hi, hj := s.byURL[ordered[i]], s.byURL[ordered[j]]
+		if hi.consecutiveFailures != hj.consecutiveFailures {
+			return hi.consecutiveFailures < hj.consecutiveFailures
+		}
+		return hi.lastLatency < hj.lastLatency
+	})
+	return ordered
+}
+
+// RelayHealth is a snapshot of one relay URL's recent dial history, as
+// recorded by RelayPolicy.Dial.
+type RelayHealth struct {
+	// ConsecutiveFailures is the number of dials in a row that have failed
+	// against this relay URL; it resets to 0 on the next successful dial.
+	ConsecutiveFailures int
+	// LastLatency is the dial latency of the most recent successful dial.
+	LastLatency time.Duration
+}
+
+// Stats returns a snapshot of p's per-relay-URL dial health, keyed by relay
+// URL. Only relays p has actually tried to dial appear in the result.
+func (p *RelayPolicy) Stats() map[string]RelayHealth {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	snapshot := make(map[string]RelayHealth, len(p.stats.byURL))
+	for url, h := range p.stats.byURL {
+		snapshot[url] = RelayHealth{
+			ConsecutiveFailures: h.consecutiveFailures,
+			LastLatency:         h.lastLatency,
+		}
+	}
+	return snapshot
+}
+
+// Dial tries relayURL and then each of p.FallbackRelayURLs, in health-biased
+// order, stopping at the first candidate that both passes p.Evaluate and
+// dials successfully through p.Dialer (the default WebSocket dial, unless
+// overridden). It returns the open connection together with the relay URL
+// that was actually used, or the last error encountered if every candidate
+// failed.
+func (p *RelayPolicy) Dial(ctx context.Context, relayURL string, remoteAddr net.Addr) (net.Conn, string, error) {
+	dialer := p.Dialer
+	if dialer == nil {
+		dialer = websocketRelayDialer{}
+	}
+
+	candidates := make([]string, 0, 1+len(p.FallbackRelayURLs))
+	if relayURL != "" {
+		candidates = append(candidates, relayURL)
+	}
+	candidates = append(candidates, p.FallbackRelayURLs...)
+
+	var lastErr error
+	for _, candidate := range p.stats.order(candidates) {
+		if err := p.Evaluate(candidate); err != nil {
+			lastErr = err
+			continue
+		}
+		start := time.Now()
+		conn, err := dialer.DialRelay(ctx, candidate, remoteAddr)
+		p.stats.record(candidate, time.Since(start), err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return conn, candidate, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no relay URL configured")
+	}
+	return nil, "", lastErr
+}
@@ -0,0 +1,92 @@
+package snowflake_proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fakeRelayConn is a net.Conn stand-in with no-op methods, just enough for
+// Dial's callers to hold and close a "connection" in tests.
+type fakeRelayConn struct {
+	net.Conn
+}
+
+func (fakeRelayConn) Close() error { return nil }
+
+// stubRelayDialer dials successfully only for URLs in ok, recording every
+// attempted URL in order.
+type stubRelayDialer struct {
+	ok       map[string]bool
+	attempts []string
+}
+
+func (d *stubRelayDialer) DialRelay(_ context.Context, relayURL string, _ net.Addr) (net.Conn, error) {
+	d.attempts = append(d.attempts, relayURL)
+	if d.ok[relayURL] {
+		return fakeRelayConn{}, nil
+	}
+	return nil, fmt.Errorf("stub dial failure for %s", relayURL)
+}
+
+func allowAllRelayPolicy(dialer RelayDialer, fallbacks ...string) *RelayPolicy {
+	rules := []RelayRule{
+		{Pattern: "wss://primary.example.com", Verb: RelayRuleAllow},
+		{Pattern: "wss://flaky.example.com", Verb: RelayRuleAllow},
+		{Pattern: "wss://good.example.com", Verb: RelayRuleAllow},
+		{Pattern: "wss://fallback.example.com", Verb: RelayRuleAllow},
+	}
+	return &RelayPolicy{
+		Rules:             rules,
+		FallbackRelayURLs: fallbacks,
+		Dialer:            dialer,
+	}
+}
+
+func TestRelayPolicyDialFallsBackOnFailure(t *testing.T) {
+	dialer := &stubRelayDialer{ok: map[string]bool{"wss://fallback.example.com/": true}}
+	policy := allowAllRelayPolicy(dialer, "wss://fallback.example.com/")
+
+	conn, used, err := policy.Dial(context.Background(), "wss://primary.example.com/", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if used != "wss://fallback.example.com/" {
+		t.Errorf("Dial() used = %q, want fallback", used)
+	}
+	if len(dialer.attempts) != 2 {
+		t.Errorf("Dial() attempted %v, want 2 attempts", dialer.attempts)
+	}
+}
+
+func TestRelayPolicyDialPrefersHealthyRelay(t *testing.T) {
+	dialer := &stubRelayDialer{ok: map[string]bool{
+		"wss://flaky.example.com/": true,
+		"wss://good.example.com/":  true,
+	}}
+	policy := allowAllRelayPolicy(dialer, "wss://good.example.com/")
+
+	// Give the primary relay a recorded failure so the next Dial should try
+	// the healthier fallback first.
+	policy.stats.record("wss://flaky.example.com/", 0, fmt.Errorf("boom"))
+
+	_, used, err := policy.Dial(context.Background(), "wss://flaky.example.com/", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	if used != "wss://good.example.com/" {
+		t.Errorf("Dial() used = %q, want the relay with no recorded failures", used)
+	}
+}
+
+func TestRelayPolicyDialReturnsErrorWhenAllFail(t *testing.T) {
+	dialer := &stubRelayDialer{}
+	policy := allowAllRelayPolicy(dialer, "wss://fallback.example.com/")
+
+	_, _, err := policy.Dial(context.Background(), "wss://primary.example.com/", nil)
+	if err == nil {
+		t.Fatal("Dial() error = nil, want an error when every candidate fails")
+	}
+}
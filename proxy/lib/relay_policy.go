@@ -0,0 +1,102 @@
+package snowflake_proxy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"tgragnato.it/snowflake/common/namematcher"
+)
+
+// RelayRuleVerb is the action a matching RelayRule takes.
+type RelayRuleVerb int
+
+const (
+	// RelayRuleAllow lets a matching relay URL through.
+	RelayRuleAllow RelayRuleVerb = iota
+	// RelayRuleDeny rejects a matching relay URL, even if an earlier or
+	// later rule would otherwise allow it.
+	RelayRuleDeny
+)
+
+// RelayRule is a single entry in a RelayPolicy. Pattern is either a
+// "scheme://host[:port][/path-prefix]" glob (matched against the relay URL
+// the way namematcher matches hostnames, applied to the whole origin+path)
+// or a bare CIDR (matched against the relay's IP address, when it has one).
+type RelayRule struct {
+	Pattern string
+	Verb    RelayRuleVerb
+}
+
+// RelayPolicy is an ordered list of allow/deny rules evaluated against a
+// relay URL, replacing the single regex-suffix-plus-private-range check that
+// checkIsRelayURLAcceptable used to perform on its own. Proxies that serve
+// more than one relay (e.g. Tor plus a non-Tor overlay) can list each one
+// explicitly instead of relying on a single hostname suffix pattern.
+type RelayPolicy struct {
+	Rules []RelayRule
+	// AllowNonTLSRelay, if false, rejects any relay URL that isn't "wss".
+	AllowNonTLSRelay bool
+	// FallbackRelayURLs are additional relays, tried in health-biased order
+	// by Dial, if the broker-provided (or default) relay URL fails to dial.
+	// Each must still pass Evaluate to be used.
+	FallbackRelayURLs []string
+	// Dialer opens the connection to a relay URL that Evaluate has already
+	// approved. If nil, Dial falls back to the WebSocket dial connectToRelay
+	// has always performed.
+	Dialer RelayDialer
+
+	stats relayStats
+}
+
+// Evaluate returns nil if relayURL is acceptable under the policy, or an
+// error explaining why it was rejected. The first matching rule, in order,
+// decides the outcome; a relay URL that matches no rule is rejected.
+func (p *RelayPolicy) Evaluate(relayURL string) error {
+	if relayURL == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(relayURL)
+	if err != nil {
+		return fmt.Errorf("bad Relay URL %w", err)
+	}
+	if parsed.Scheme != "ws" && parsed.Scheme != "wss" {
+		return fmt.Errorf("rejected Relay URL protocol: only WebSocket is allowed")
+	}
+	if !p.AllowNonTLSRelay && parsed.Scheme != "wss" {
+		return fmt.Errorf("rejected Relay URL protocol: non-TLS not allowed")
+	}
+
+	ip := net.ParseIP(parsed.Hostname())
+
+	for _, rule := range p.Rules {
+		if rule.matches(relayURL, parsed, ip) {
+			if rule.Verb == RelayRuleDeny {
+				return fmt.Errorf("rejected Relay URL: denied by policy rule %q", rule.Pattern)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("rejected Relay URL: no policy rule allows %q", relayURL)
+}
+
+func (r RelayRule) matches(relayURL string, parsed *url.URL, ip net.IP) bool {
+	if ip != nil {
+		if _, cidr, err := net.ParseCIDR(r.Pattern); err == nil {
+			return cidr.Contains(ip)
+		}
+	}
+
+	schemeHostPath, ok := strings.CutPrefix(r.Pattern, parsed.Scheme+"://")
+	if !ok {
+		return false
+	}
+	hostPattern, pathPrefix, _ := strings.Cut(schemeHostPath, "/")
+	if !namematcher.NewNameMatcher(hostPattern).IsMember(parsed.Hostname()) {
+		return false
+	}
+	return pathPrefix == "" || strings.HasPrefix(strings.TrimPrefix(parsed.Path, "/"), pathPrefix)
+}
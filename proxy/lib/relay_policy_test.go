@@ -0,0 +1,37 @@
+package snowflake_proxy
+
+import "testing"
+
+func TestRelayPolicyEvaluate(t *testing.T) {
+	t.Parallel()
+
+	policy := &RelayPolicy{
+		AllowNonTLSRelay: false,
+		Rules: []RelayRule{
+			{Pattern: "wss://snowflake.torproject.net", Verb: RelayRuleAllow},
+			{Pattern: "wss://overlay.example.com/relay", Verb: RelayRuleAllow},
+			{Pattern: "10.0.0.0/8", Verb: RelayRuleDeny},
+			{Pattern: "192.168.0.0/16", Verb: RelayRuleAllow},
+		},
+	}
+
+	tests := []struct {
+		relayURL string
+		wantErr  bool
+	}{
+		{"wss://snowflake.torproject.net/", false},
+		{"wss://overlay.example.com/relay/path", false},
+		{"wss://overlay.example.com/other", true},
+		{"ws://snowflake.torproject.net/", true},
+		{"wss://10.1.2.3/", true},
+		{"wss://192.168.1.1/", false},
+		{"wss://unknown.example.com/", true},
+	}
+
+	for _, test := range tests {
+		err := policy.Evaluate(test.relayURL)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Evaluate(%q) error = %v, wantErr %v", test.relayURL, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package snowflake_proxy
+
+import (
+	"net"
+	"time"
+)
+
+// relayURLPool health-tracks a plain list of relay URLs (SnowflakeProxy's
+// RelayURLs) the same way RelayPolicy tracks FallbackRelayURLs, for proxies
+// that want a health-biased list of relays to fall back on without opting
+// into the richer RelayPolicy allow/deny rules.
+type relayURLPool struct {
+	urls  []string
+	stats relayStats
+}
+
+// newRelayURLPool builds a relayURLPool over urls, all initially considered
+// equally healthy.
+func newRelayURLPool(urls []string) *relayURLPool {
+	return &relayURLPool{urls: urls}
+}
+
+// dial tries each url in p, in health-biased order, stopping at the first
+// one that dials successfully via connectToRelay. It returns the open
+// connection together with the relay URL that was used, or the last error
+// encountered if every candidate failed.
+func (p *relayURLPool) dial(remoteAddr net.Addr) (net.Conn, string, error) {
+	var lastErr error
+	for _, candidate := range p.stats.order(p.urls) {
+		start := time.Now()
+		conn, _, err := connectToRelay(candidate, remoteAddr)
+		p.stats.record(candidate, time.Since(start), err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return conn, candidate, nil
+	}
+	return nil, "", lastErr
+}
@@ -0,0 +1,211 @@
+package snowflake_proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"tgragnato.it/snowflake/common/amp"
+)
+
+// RendezvousMethod is a pluggable way for a proxy to exchange signaling
+// messages with the broker. It generalizes the plain HTTPS POST that
+// SignalingServer.Post performs, so that a proxy stuck behind a censor or a
+// broken front still has alternative paths to register.
+type RendezvousMethod interface {
+	// Exchange posts payload to the broker-relative path (e.g. "proxy" or
+	// "answer") and returns the raw response body.
+	Exchange(path string, payload []byte) ([]byte, error)
+}
+
+// httpsRendezvousMethod is the default RendezvousMethod: a plain (optionally
+// domain-fronted) HTTPS POST to the broker, using the given RoundTripper.
+type httpsRendezvousMethod struct {
+	brokerURL *url.URL
+	front     string // Optional front domain, replaces brokerURL.Host.
+	transport http.RoundTripper
+}
+
+// newHTTPSRendezvousMethod builds a RendezvousMethod that POSTs directly to
+// brokerURL (optionally through the front domain front, for domain fronting)
+// using transport to make the request.
+func newHTTPSRendezvousMethod(brokerURL *url.URL, front string, transport http.RoundTripper) *httpsRendezvousMethod {
+	return &httpsRendezvousMethod{brokerURL: brokerURL, front: front, transport: transport}
+}
+
+func (r *httpsRendezvousMethod) Exchange(path string, payload []byte) ([]byte, error) {
+	reqURL := *r.brokerURL.ResolveReference(&url.URL{Path: path})
+	host := reqURL.Host
+	if r.front != "" {
+		host = r.front
+	}
+	req, err := http.NewRequest("POST", reqURL.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Host = reqURL.Hostname()
+	req.URL.Host = host
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote returned status code %d", resp.StatusCode)
+	}
+	return limitedRead(resp.Body, readLimit)
+}
+
+// ampCacheRendezvousMethod exchanges signaling messages via the broker's
+// amp/client route, optionally relayed through an AMP cache and/or a front
+// domain, the way snowflake-client already does. Since AMP caches only
+// forward GET requests, the payload is encoded into the request path rather
+// than the request body.
+type ampCacheRendezvousMethod struct {
+	brokerURL *url.URL
+	cacheURL  *url.URL
+	fronts    []string
+	transport http.RoundTripper
+}
+
+// newAMPCacheRendezvousMethod builds a RendezvousMethod that contacts the
+// broker at brokerURL's amp/client route, optionally through cacheURL and a
+// randomly chosen front domain from fronts.
+func newAMPCacheRendezvousMethod(brokerURL, cacheURL *url.URL, fronts []string, transport http.RoundTripper) *ampCacheRendezvousMethod {
+	return &ampCacheRendezvousMethod{brokerURL: brokerURL, cacheURL: cacheURL, fronts: fronts, transport: transport}
+}
+
+func (r *ampCacheRendezvousMethod) Exchange(path string, payload []byte) ([]byte, error) {
+	reqURL := r.brokerURL.ResolveReference(&url.URL{
+		Path: "amp/" + path + "/" + amp.EncodePath(payload),
+	})
+
+	if r.cacheURL != nil {
+		var err error
+		reqURL, err = amp.CacheURL(reqURL, r.cacheURL, "c")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.fronts) != 0 {
+		front := r.fronts[rand.Intn(len(r.fronts))]
+		req.Host = req.URL.Hostname()
+		req.URL.Host = front
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// A non-200 status usually means the AMP cache rejected the
+		// broker's response as invalid AMP, or translated a 5xx from
+		// the broker into a 404.
+		return nil, fmt.Errorf("remote returned status code %d", resp.StatusCode)
+	}
+	if _, err := resp.Location(); err == nil {
+		// A "silent redirect": the cache wants us to fetch the origin
+		// directly. We don't follow redirects, so treat it as a failure.
+		return nil, fmt.Errorf("amp cache returned a silent redirect")
+	}
+
+	lr := io.LimitReader(resp.Body, readLimit+1)
+	dec, err := amp.NewArmorDecoder(lr)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := io.ReadAll(dec)
+	if err != nil {
+		return nil, err
+	}
+	if lr.(*io.LimitedReader).N == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return decoded, nil
+}
+
+// RendezvousMethodFactory builds a RendezvousMethod for a SnowflakeProxy's
+// broker signaling, given the proxy's own configuration and the shared
+// broker transport. It is the shape expected by RegisterRendezvousMethod.
+type RendezvousMethodFactory func(sf *SnowflakeProxy, transport http.RoundTripper) (RendezvousMethod, error)
+
+var (
+	rendezvousRegistryMu sync.Mutex
+	rendezvousRegistry   = map[string]RendezvousMethodFactory{}
+)
+
+// RegisterRendezvousMethod makes a custom RendezvousMethod, built by
+// factory, selectable by setting SnowflakeProxy.BrokerRendezvousMethod to
+// name. This lets embedders reach the broker through a proprietary
+// signaling channel without forking the proxy library. Registering under a
+// name that is already taken overwrites the previous factory.
+func RegisterRendezvousMethod(name string, factory RendezvousMethodFactory) {
+	rendezvousRegistryMu.Lock()
+	defer rendezvousRegistryMu.Unlock()
+	rendezvousRegistry[name] = factory
+}
+
+// newRegisteredRendezvousMethod looks up and builds the RendezvousMethod
+// registered under sf.BrokerRendezvousMethod. It returns (nil, nil) if
+// BrokerRendezvousMethod is unset, so callers can fall through to the
+// built-in AMP cache/domain fronting/direct HTTPS selection.
+func newRegisteredRendezvousMethod(sf *SnowflakeProxy, transport http.RoundTripper) (RendezvousMethod, error) {
+	if sf.BrokerRendezvousMethod == "" {
+		return nil, nil
+	}
+	rendezvousRegistryMu.Lock()
+	factory, ok := rendezvousRegistry[sf.BrokerRendezvousMethod]
+	rendezvousRegistryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown broker rendezvous method %q", sf.BrokerRendezvousMethod)
+	}
+	return factory(sf, transport)
+}
+
+// brokerRendezvousMethods builds the prioritized RendezvousMethod list for
+// sf's broker signaling: sf.BrokerRendezvousMethod, if set, takes priority
+// over the built-in AMP cache/domain fronting selection below it. It
+// returns an empty slice (not an error) if none of these are configured, so
+// the caller falls back to SignalingServer's default plain HTTPS POST.
+func (sf *SnowflakeProxy) brokerRendezvousMethods() ([]RendezvousMethod, error) {
+	custom, err := newRegisteredRendezvousMethod(sf, customtransport)
+	if err != nil {
+		return nil, err
+	}
+	if custom != nil {
+		return []RendezvousMethod{custom}, nil
+	}
+
+	if sf.BrokerAMPCacheURL == "" && len(sf.BrokerFrontDomains) == 0 {
+		return nil, nil
+	}
+
+	brokerURL, err := url.Parse(sf.BrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker url: %w", err)
+	}
+
+	var methods []RendezvousMethod
+	if sf.BrokerAMPCacheURL != "" {
+		cacheURL, err := url.Parse(sf.BrokerAMPCacheURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker AMP cache url: %w", err)
+		}
+		methods = append(methods, newAMPCacheRendezvousMethod(brokerURL, cacheURL, sf.BrokerFrontDomains, customtransport))
+	}
+	for _, front := range sf.BrokerFrontDomains {
+		methods = append(methods, newHTTPSRendezvousMethod(brokerURL, front, customtransport))
+	}
+	return methods, nil
+}
@@ -0,0 +1,71 @@
+package snowflake_proxy
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBrokerRendezvousMethods(t *testing.T) {
+	Convey("With none of BrokerRendezvousMethod/BrokerFrontDomains/BrokerAMPCacheURL set", t, func() {
+		sf := &SnowflakeProxy{BrokerURL: "https://broker.example.com"}
+		methods, err := sf.brokerRendezvousMethods()
+		So(err, ShouldBeNil)
+		So(methods, ShouldBeEmpty)
+	})
+
+	Convey("With BrokerFrontDomains set", t, func() {
+		sf := &SnowflakeProxy{
+			BrokerURL:          "https://broker.example.com",
+			BrokerFrontDomains: []string{"front1.example.com", "front2.example.com"},
+		}
+		methods, err := sf.brokerRendezvousMethods()
+		So(err, ShouldBeNil)
+		So(methods, ShouldHaveLength, 2)
+	})
+
+	Convey("With BrokerAMPCacheURL and BrokerFrontDomains set", t, func() {
+		sf := &SnowflakeProxy{
+			BrokerURL:          "https://broker.example.com",
+			BrokerAMPCacheURL:  "https://cdn.ampproject.org",
+			BrokerFrontDomains: []string{"front1.example.com"},
+		}
+		methods, err := sf.brokerRendezvousMethods()
+		So(err, ShouldBeNil)
+		So(methods, ShouldHaveLength, 2)
+	})
+
+	Convey("With an invalid BrokerAMPCacheURL", t, func() {
+		sf := &SnowflakeProxy{
+			BrokerURL:         "https://broker.example.com",
+			BrokerAMPCacheURL: "://not-a-url",
+		}
+		_, err := sf.brokerRendezvousMethods()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With an unregistered BrokerRendezvousMethod", t, func() {
+		sf := &SnowflakeProxy{
+			BrokerURL:              "https://broker.example.com",
+			BrokerRendezvousMethod: "does-not-exist",
+		}
+		_, err := sf.brokerRendezvousMethods()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a registered BrokerRendezvousMethod", t, func() {
+		RegisterRendezvousMethod("test-method", func(sf *SnowflakeProxy, transport http.RoundTripper) (RendezvousMethod, error) {
+			return newHTTPSRendezvousMethod(nil, "", transport), nil
+		})
+		sf := &SnowflakeProxy{
+			BrokerURL:              "https://broker.example.com",
+			BrokerRendezvousMethod: "test-method",
+			// Set to confirm the registered method takes priority.
+			BrokerFrontDomains: []string{"front1.example.com"},
+		}
+		methods, err := sf.brokerRendezvousMethods()
+		So(err, ShouldBeNil)
+		So(methods, ShouldHaveLength, 1)
+	})
+}
@@ -0,0 +1,177 @@
+package snowflake_proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// errSDPRejected is wrapped by every error validateOfferSDP returns, so
+// callers can tell a validation failure apart from a parse error elsewhere
+// with errors.Is.
+var errSDPRejected = errors.New("sdp rejected by validator")
+
+// maxOfferCandidates bounds how many a=candidate lines an offer may carry
+// before validateOfferSDP gives up on it. Real Snowflake clients gather a
+// handful of host/srflx candidates; an offer shaped to carry far more than
+// that is more likely to be an attempt to fingerprint or load the proxy.
+const maxOfferCandidates = 20
+
+var remoteIPPatterns = []*regexp.Regexp{
+	// Parse IP address for 'c=IN IP4 ' or 'c=IN IP6 ' line.
+	regexp.MustCompile(`(?m)^c=IN IP4 ([\d.]+)(?:$|[ /])`),
+	regexp.MustCompile(`(?m)^c=IN IP6 ([0-9A-Fa-f:]+)(?:$|[ /])`),
+}
+
+// remoteIPFromSDP returns the remote peer's IP address as parsed from an SDP
+// offer or answer, looking first at ICE candidate attributes and falling
+// back to the "c=" connection-data field. It returns nil if no remote
+// (non-local) address could be found.
+func remoteIPFromSDP(str string) net.IP {
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(str)); err != nil {
+		log.Println("Error parsing SDP: ", err.Error())
+		return nil
+	}
+
+	// Look for remote IP in "a=candidate" attribute fields.
+	// https://tools.ietf.org/html/rfc5245#section-15.1
+	for _, m := range desc.MediaDescriptions {
+		for _, a := range m.Attributes {
+			if a.IsICECandidate() {
+				c, err := ice.UnmarshalCandidate(a.Value)
+				if err == nil {
+					ip := net.ParseIP(c.Address())
+					if ip != nil && isRemoteAddress(ip) {
+						return ip
+					}
+				}
+			}
+		}
+	}
+
+	// Finally look for remote IP in "c=" Connection Data field.
+	// https://tools.ietf.org/html/rfc4566#section-5.7
+	for _, pattern := range remoteIPPatterns {
+		m := pattern.FindStringSubmatch(str)
+		if m != nil {
+			// Ignore parsing errors, ParseIP returns nil.
+			ip := net.ParseIP(m[1])
+			if ip != nil && isRemoteAddress(ip) {
+				return ip
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateOfferSDP parses sdpText with a real SDP parser (pion/sdp) and
+// enforces the narrow whitelist of fields the Snowflake pipeline actually
+// needs, rejecting everything else outright. It is meant to run on every
+// offer the proxy receives from the broker, before a PeerConnection is ever
+// created from it, so that malformed or attacker-shaped SDPs cannot be used
+// to fingerprint or crash proxies.
+func validateOfferSDP(sdpText string) error {
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(sdpText)); err != nil {
+		return fmt.Errorf("%w: %v", errSDPRejected, err)
+	}
+
+	if len(desc.MediaDescriptions) != 1 {
+		return fmt.Errorf("%w: expected exactly one m= section, got %d", errSDPRejected, len(desc.MediaDescriptions))
+	}
+	md := desc.MediaDescriptions[0]
+
+	if md.MediaName.Media != "application" {
+		return fmt.Errorf("%w: unexpected m= media type %q", errSDPRejected, md.MediaName.Media)
+	}
+	switch strings.Join(md.MediaName.Protos, "/") {
+	case "DTLS/SCTP", "UDP/DTLS/SCTP":
+	default:
+		return fmt.Errorf("%w: unexpected m= protocol %q", errSDPRejected, strings.Join(md.MediaName.Protos, "/"))
+	}
+
+	if group, ok := desc.Attribute("group"); !ok || strings.Count(group, " ") != 1 || !strings.HasPrefix(group, "BUNDLE ") {
+		return fmt.Errorf("%w: missing or malformed single BUNDLE group", errSDPRejected)
+	}
+
+	fingerprint, ok := md.Attribute("fingerprint")
+	if !ok {
+		fingerprint, ok = desc.Attribute("fingerprint")
+	}
+	if !ok {
+		return fmt.Errorf("%w: missing a=fingerprint", errSDPRejected)
+	}
+	if !strings.HasPrefix(fingerprint, "sha-256 ") {
+		return fmt.Errorf("%w: a=fingerprint is not sha-256", errSDPRejected)
+	}
+
+	ufrag, ok := md.Attribute("ice-ufrag")
+	if !ok || len(ufrag) < 4 || len(ufrag) > 256 {
+		return fmt.Errorf("%w: missing or out-of-range a=ice-ufrag", errSDPRejected)
+	}
+	pwd, ok := md.Attribute("ice-pwd")
+	if !ok || len(pwd) < 22 || len(pwd) > 256 {
+		return fmt.Errorf("%w: missing or out-of-range a=ice-pwd", errSDPRejected)
+	}
+
+	setup, ok := md.Attribute("setup")
+	if !ok {
+		return fmt.Errorf("%w: missing a=setup", errSDPRejected)
+	}
+	switch setup {
+	case "actpass", "active", "passive":
+	default:
+		return fmt.Errorf("%w: unexpected a=setup value %q", errSDPRejected, setup)
+	}
+
+	numCandidates := 0
+	for _, a := range md.Attributes {
+		if !a.IsICECandidate() {
+			continue
+		}
+		numCandidates++
+		if numCandidates > maxOfferCandidates {
+			return fmt.Errorf("%w: too many a=candidate lines (> %d)", errSDPRejected, maxOfferCandidates)
+		}
+		c, err := ice.UnmarshalCandidate(a.Value)
+		if err != nil {
+			return fmt.Errorf("%w: unparseable a=candidate: %v", errSDPRejected, err)
+		}
+		ip := net.ParseIP(c.Address())
+		if ip == nil {
+			return fmt.Errorf("%w: a=candidate with non-IP address %q", errSDPRejected, c.Address())
+		}
+		if !isRemoteAddress(ip) {
+			return fmt.Errorf("%w: a=candidate with non-remote address %q", errSDPRejected, c.Address())
+		}
+	}
+
+	return nil
+}
+
+// validateAnswerSDP applies the same structural checks as validateOfferSDP
+// to the answer the proxy is about to hand back to the broker. It is looser
+// about ICE candidates, since trickled candidates may still be arriving when
+// the local description is read.
+func validateAnswerSDP(answer *webrtc.SessionDescription) error {
+	if answer == nil {
+		return fmt.Errorf("%w: nil answer", errSDPRejected)
+	}
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal([]byte(answer.SDP)); err != nil {
+		return fmt.Errorf("%w: %v", errSDPRejected, err)
+	}
+	if len(desc.MediaDescriptions) != 1 {
+		return fmt.Errorf("%w: expected exactly one m= section in answer, got %d", errSDPRejected, len(desc.MediaDescriptions))
+	}
+	return nil
+}
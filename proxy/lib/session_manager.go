@@ -0,0 +1,89 @@
+package snowflake_proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionStats is a snapshot of one Turbo Tunnel client session's activity,
+// returned by SnowflakeProxy.SessionStats.
+type SessionStats struct {
+	BytesIn, BytesOut int64
+	Started           time.Time
+	Duration          time.Duration
+}
+
+// clientSession accounts for the traffic and lifetime of a single logical
+// Turbo Tunnel client, identified by the client ID it presents, across
+// however many short-lived WebRTC DataChannels join and leave it.
+type clientSession struct {
+	started  time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+// sessionManager keys in-progress Turbo Tunnel sessions by client ID, so that
+// a single logical client session can be accounted for as a whole even when
+// it's carried across several WebRTC connections, possibly handled by
+// different proxy processes over time.
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*clientSession
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{sessions: make(map[string]*clientSession)}
+}
+
+// join registers a DataChannel joining the session for clientID, creating the
+// session's bookkeeping entry on first use.
+func (m *sessionManager) join(clientID string) *clientSession {
+	if clientID == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cs, ok := m.sessions[clientID]
+	if !ok {
+		cs = &clientSession{started: time.Now()}
+		m.sessions[clientID] = cs
+	}
+	return cs
+}
+
+// leave removes a client's session bookkeeping once its last DataChannel has
+// closed and the relay connection it backed has been torn down.
+func (m *sessionManager) leave(clientID string) {
+	if clientID == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, clientID)
+}
+
+// stats returns a snapshot of every session currently tracked.
+func (m *sessionManager) stats() map[string]SessionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]SessionStats, len(m.sessions))
+	for id, cs := range m.sessions {
+		out[id] = SessionStats{
+			BytesIn:  cs.bytesIn.Load(),
+			BytesOut: cs.bytesOut.Load(),
+			Started:  cs.started,
+			Duration: time.Since(cs.started),
+		}
+	}
+	return out
+}
+
+// SessionStats returns a snapshot of every Turbo Tunnel client session
+// currently being relayed by this proxy, keyed by client ID.
+func (sf *SnowflakeProxy) SessionStats() map[string]SessionStats {
+	if sf.sessions == nil {
+		return nil
+	}
+	return sf.sessions.stats()
+}
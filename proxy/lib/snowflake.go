@@ -46,11 +46,19 @@ import (
 	"github.com/pion/ice/v4"
 	"github.com/pion/transport/v3/stdnet"
 	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 	"tgragnato.it/snowflake/common/event"
+	"tgragnato.it/snowflake/common/event/sinks"
 	"tgragnato.it/snowflake/common/messages"
 	"tgragnato.it/snowflake/common/namematcher"
+	"tgragnato.it/snowflake/common/nat"
+	"tgragnato.it/snowflake/common/otelconfig"
 	"tgragnato.it/snowflake/common/task"
 	"tgragnato.it/snowflake/common/util"
+	"tgragnato.it/snowflake/common/version"
 
 	snowflakeClient "tgragnato.it/snowflake/client/lib"
 )
@@ -71,7 +79,19 @@ const (
 	// NATRestricted is set if the proxy times out when connecting to a symmetric NAT.
 	NATRestricted = "restricted"
 	// NATUnrestricted is set if the proxy successfully connects to a symmetric NAT.
-	NATUnrestricted                   = "unrestricted"
+	NATUnrestricted = "unrestricted"
+	// NATTypeDetectionRemote has checkNATType rely solely on NATProbeURL,
+	// giving up with NATUnknown if it can't be reached (this package's
+	// historical behavior).
+	NATTypeDetectionRemote = "remote"
+	// NATTypeDetectionLocal has checkNATType skip NATProbeURL entirely and
+	// always classify the NAT locally via RFC 5780 behavior discovery
+	// against STUNURL.
+	NATTypeDetectionLocal = "local"
+	// NATTypeDetectionAuto, the default, has checkNATType try NATProbeURL
+	// first and fall back to the local RFC 5780 probe if it can't be
+	// reached.
+	NATTypeDetectionAuto              = "auto"
 	bufferedAmountLowThreshold uint64 = 256 * 1024 // 256 KB
 	// Amount of time after sending an SDP answer before the proxy assumes the
 	// client is not going to connect
@@ -81,12 +101,13 @@ const (
 )
 
 var (
-	broker               *SignalingServer
 	currentNATType       = NATUnknown
 	currentNATTypeAccess = &sync.RWMutex{}
-	tokens               uint64
-	config               webrtc.Configuration
-	customtransport      = &http.Transport{
+	// lastNATProbeAt is when currentNATType was last (re)measured, whether
+	// the probe concluded NATUnrestricted, NATRestricted, or fell back to
+	// NATUnknown. It's read out through SnowflakeProxy.Stats.
+	lastNATProbeAt  time.Time
+	customtransport = &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Minute,
 			KeepAlive: time.Millisecond,
@@ -132,6 +153,13 @@ func setCurrentNATType(newType string) {
 	currentNATTypeAccess.Lock()
 	defer currentNATTypeAccess.Unlock()
 	currentNATType = newType
+	lastNATProbeAt = time.Now()
+}
+
+func getLastNATProbeAt() time.Time {
+	currentNATTypeAccess.RLock()
+	defer currentNATTypeAccess.RUnlock()
+	return lastNATProbeAt
 }
 
 // SnowflakeProxy is used to configure an embedded
@@ -147,14 +175,53 @@ type SnowflakeProxy struct {
 	STUNURL string
 	// BrokerURL is the URL of the Snowflake broker
 	BrokerURL string
+	// HTTPProxyURL, if set, routes the proxy's broker rendezvous (direct
+	// HTTPS POST, AMP cache, domain fronting) and NAT probe HTTP traffic
+	// through this HTTP/HTTPS CONNECT proxy, the way an operator behind a
+	// restrictive corporate or institutional firewall would need. It's
+	// parsed once, in Start, and applied to the package-level
+	// customtransport shared by every SnowflakeProxy in this process --
+	// see buildProxyFunc in httpproxy.go. If unset, customtransport falls
+	// back to honoring HTTPS_PROXY/ALL_PROXY/NO_PROXY the way net/http's
+	// DefaultTransport does, rather than proxying nothing as it did
+	// before this field existed.
+	//
+	// This has no effect on STUN/TURN traffic: ICE's UDP STUN exchanges
+	// can't be tunneled through an HTTP CONNECT proxy, which only
+	// forwards TCP byte streams. A proxy operator who needs to reach
+	// STUN/TURN servers through a firewall needs a SOCKS5 proxy with UDP
+	// ASSOCIATE support configured at the OS/network level instead; this
+	// package has no hook for that.
+	HTTPProxyURL string
+	// BrokerURLs, if set, has the proxy round-robin its poll/answer
+	// rendezvous across several brokers instead of the single BrokerURL,
+	// preferring whichever one last succeeded and backing off a broker for a
+	// while after repeated failures. Useful during a censorship event that
+	// takes one broker's domain down. BrokerRendezvousMethod/
+	// BrokerFrontDomains/BrokerAMPCacheURL still only apply to the single
+	// BrokerURL path; each URL in BrokerURLs is reached directly.
+	BrokerURLs []string
 	// KeepLocalAddresses indicates whether local SDP candidates will be sent to the broker
 	KeepLocalAddresses bool
 	// RelayURL is the default `URL` of the server (relay)
 	// that this proxy will forward client connections to,
 	// in case the broker itself did not specify the said URL
 	RelayURL string
+	// RelayURLs, if set, extends RelayURL with additional relays tried (in
+	// health-biased order, like RelayPolicy.FallbackRelayURLs) whenever the
+	// broker doesn't specify a relay URL of its own. Only consulted when
+	// RelayPolicy is nil; a proxy that needs richer per-relay rules should
+	// use RelayPolicy.FallbackRelayURLs instead.
+	RelayURLs []string
 	// OutboundAddress specify an IP address to use as SDP host candidate
 	OutboundAddress string
+	// NAT1To1Mappings lists additional 1:1 NAT IP mappings ("external" or
+	// "internal=external", see util.ParseNAT1To1Mappings) to program into
+	// pion's SettingEngine, for proxies sitting behind a static NAT (a VPS
+	// or a home router with port forwarding) that want to advertise a
+	// mapped address instead of relying solely on srflx candidates learned
+	// from STUN.
+	NAT1To1Mappings []string
 	// EphemeralMinPort and EphemeralMaxPort limit the range of ports that
 	// ICE UDP connections may allocate from.
 	// When specifying the range, make sure it's at least 2x as wide
@@ -162,6 +229,15 @@ type SnowflakeProxy struct {
 	// (see the `Capacity` property).
 	EphemeralMinPort uint16
 	EphemeralMaxPort uint16
+	// UDPMuxPorts, if non-empty, has every concurrent client PeerConnection
+	// share ICE UDP traffic over listeners bound to these specific ports,
+	// instead of each PeerConnection allocating its own ephemeral port from
+	// EphemeralMinPort/EphemeralMaxPort. This lets an operator publish just
+	// one or a handful of fixed UDP ports through a firewall and still serve
+	// 100+ concurrent clients behind it. Coexists with EphemeralMinPort/
+	// EphemeralMaxPort: when UDPMuxPorts is empty, the ephemeral port range
+	// is used as before.
+	UDPMuxPorts []int
 	// RelayDomainNamePattern is the pattern specify allowed domain name for relay
 	// If the pattern starts with ^ then an exact match is required.
 	// The rest of pattern is the suffix of domain name.
@@ -177,8 +253,29 @@ type SnowflakeProxy struct {
 	// as this proxy.
 	AllowProxyingToPrivateAddresses bool
 	AllowNonTLSRelay                bool
+	// RelayPolicy, if set, replaces RelayDomainNamePattern/
+	// AllowProxyingToPrivateAddresses/AllowNonTLSRelay with a richer
+	// ordered allow/deny rule list (wildcards, CIDRs, path prefixes).
+	RelayPolicy *RelayPolicy
 	// NATProbeURL is the URL of the probe service we use for NAT checks
 	NATProbeURL string
+	// NATProbeURLs, if set, extends NATProbeURL with additional probe
+	// servers: checkNATType round-robins across them, preferring whichever
+	// last succeeded and backing off one for a while after repeated
+	// failures (the same strategy BrokerURLs uses for brokers), so a
+	// proxy keeps classifying its NAT even while one probe server is down.
+	NATProbeURLs []string
+	// NATTypeDetectionMode selects how checkNATType classifies this proxy's
+	// NAT. "" or NATTypeDetectionAuto (the default) tries the remote
+	// NATProbeURL first and falls back to a local RFC 5780 behavior-discovery
+	// probe (see common/nat) against STUNURL if the remote probe can't be
+	// reached, rather than giving up with NATUnknown. NATTypeDetectionRemote
+	// disables that fallback, matching this package's historical behavior.
+	// NATTypeDetectionLocal skips NATProbeURL entirely and always classifies
+	// locally. The local probe requires at least one configured STUN server
+	// to advertise OTHER-ADDRESS; servers that don't are simply an error, not
+	// wired up to change NATTypeDetectionMode's selection.
+	NATTypeDetectionMode string
 	// NATTypeMeasurementInterval is time before NAT type is retested
 	NATTypeMeasurementInterval time.Duration
 	// ProxyType is the type reported to the broker, if not provided it "standalone" will be used
@@ -186,11 +283,142 @@ type SnowflakeProxy struct {
 	EventDispatcher event.SnowflakeEventDispatcher
 	shutdown        chan struct{}
 
+	// Sinks, if set, is registered on EventDispatcher by Start and is where
+	// an embedder should add its own pluggable event receivers (a log
+	// formatter, a metrics exporter, a webhook) via event.MultiSink.AddSink,
+	// each with its own event-type Allow/Deny filter and DeliveryMode,
+	// instead of registering them on EventDispatcher directly. If left nil,
+	// Start builds an empty one so internal listeners always have
+	// somewhere to register.
+	Sinks *event.MultiSink
+
 	// SummaryInterval is the time interval at which proxy stats will be logged
 	SummaryInterval time.Duration
 
+	// StatsFilename, if set, has Start periodically flush lifetime proxy
+	// totals and a rolling 24h/1h-bucket window to this path (see
+	// lifetimeStats), and reload them from it at startup, so an operator of
+	// a long-lived proxy can see meaningful uptime/throughput numbers
+	// across a crash or upgrade without an external metrics system. Leave
+	// unset to keep these EventOnProxyLifetimeStats numbers in memory only.
+	StatsFilename string
+
+	// Metrics, if set, switches bytesLogger to promBytesLogger so that
+	// traffic counters, an active-sessions gauge, and per-session
+	// byte/lifetime histograms are fed into it as connections happen,
+	// in addition to the existing polled SummaryInterval logging.
+	Metrics *Metrics
+
+	// MetricsListenAddr, if set and Metrics is nil, has Start build a Metrics
+	// with no ConstLabels, serve it at "/internal/metrics" on this address,
+	// and use it as Metrics for the rest of this proxy's lifetime. Leave
+	// unset (and set Metrics directly instead) to customize ConstLabels or
+	// to serve the registry some other way.
+	MetricsListenAddr string
+
+	// Tracer, if set, has datachannelHandler wrap each client session in a
+	// span (covering the DataChannel opening, bytes being relayed, and the
+	// session closing), with attributes for the proxy's NAT type, the relay
+	// it forwarded to, and the final byte counts. Built from OTLPEndpoint
+	// below when that's set and Tracer is left nil; leave both unset to
+	// disable tracing entirely.
+	Tracer trace.Tracer
+
+	// OTLPEndpoint, if set and Tracer/Metrics are nil, has Start build an
+	// OTLP exporter pipeline (see common/otelconfig) and use it as both
+	// Tracer and a metrics.EventCollector registered on EventDispatcher,
+	// so an operator can point this proxy at a collector without wiring
+	// providers together themselves. OTLPHeaders/OTLPProtocol/OTLPInsecure/
+	// OTLPCompression configure that pipeline; see their flag descriptions
+	// in proxy/main.go for the accepted values.
+	OTLPEndpoint    string
+	OTLPHeaders     map[string]string
+	OTLPProtocol    string
+	OTLPInsecure    bool
+	OTLPCompression string
+
+	// SDPRestrictICEToUDP drops TCP ICE candidates from the answer SDP sent
+	// to the broker, for operators experimenting with SDP shaping to defeat
+	// DPI classifiers that pattern-match on Snowflake's default SDP layout.
+	SDPRestrictICEToUDP bool
+
+	// BrokerRendezvousMethod selects a RendezvousMethod previously
+	// registered with RegisterRendezvousMethod to reach the broker,
+	// overriding BrokerFrontDomains/BrokerAMPCacheURL below. Leave unset to
+	// use the built-in selection.
+	BrokerRendezvousMethod string
+	// BrokerFrontDomains, if set, has the proxy reach the broker through
+	// domain fronting -- sending the request to one of these front domains
+	// with a Host header naming the broker -- the same technique
+	// snowflake-client already uses, for a proxy operator in a censored
+	// region where the broker's own domain is blocked. Tried in order,
+	// after BrokerAMPCacheURL if that's also set.
+	BrokerFrontDomains []string
+	// BrokerAMPCacheURL, if set, has the proxy reach the broker through
+	// this AMP cache instead of (optionally in addition to, via
+	// BrokerFrontDomains as a fallback) contacting it directly.
+	BrokerAMPCacheURL string
+
+	// PerClientBytesPerSec, if non-zero, caps each client session's relayed
+	// traffic (in both directions independently) to this many bytes/sec on
+	// average, to limit how much one abusive client can take from a
+	// high-capacity standalone proxy.
+	PerClientBytesPerSec float64
+	// PerClientBurst is the token-bucket burst size, in bytes, paired with
+	// PerClientBytesPerSec. It must be at least as large as the biggest
+	// single Read/Write the relay websocket or DataChannel makes in
+	// practice; if zero and PerClientBytesPerSec is set, it defaults to
+	// PerClientBytesPerSec (one second's worth of traffic).
+	PerClientBurst int
+	// MaxNewClientsPerMinute, if non-zero, caps how many new client offers
+	// runSession will accept per minute; offers beyond that are declined
+	// before a PeerConnection is ever created.
+	MaxNewClientsPerMinute int
+
 	periodicProxyStats *periodicProxyStats
 	bytesLogger        bytesLogger
+	sessions           *sessionManager
+	admissionLimiter   *rate.Limiter
+
+	// mu guards broker, brokerFailover, config, and tokens -- the
+	// configuration Reconfigure can swap out while the proxy keeps running,
+	// so that both the poll loop (via pollBrokerOffer/sendBrokerAnswer/
+	// currentConfig) and Reconfigure itself see a consistent snapshot. It's
+	// a pointer, set up by Start, so that SnowflakeProxy itself (as taken by
+	// value in Reconfigure's newCfg parameter) stays copyable.
+	mu             *sync.RWMutex
+	broker         *SignalingServer
+	brokerFailover *brokerPool
+	config         webrtc.Configuration
+	tokens         uint64
+
+	// sessionsStarted, sessionsCompleted, and sessionsFailed count client
+	// sessions handled by datachannelHandler since Start, and
+	// bytesRelayedIn/bytesRelayedOut are their cumulative byte totals;
+	// together they back Stats(). Unlike bytesLogger's periodic counters,
+	// these never reset.
+	sessionsStarted   uint64
+	sessionsCompleted uint64
+	sessionsFailed    uint64
+	bytesRelayedIn    int64
+	bytesRelayedOut   int64
+
+	// udpMux, when non-nil, is the shared ICE UDP listener set built from
+	// UDPMuxPorts by Start. It's fixed for the life of the proxy (unlike
+	// broker/config/tokens above, Reconfigure does not touch it), so it
+	// needs no mutex: it's written once before any client session can
+	// start, and only read afterwards.
+	udpMux ice.UDPMux
+
+	// relayFailover, built from RelayURLs by Start, is consulted by
+	// datachannelHandler whenever the broker doesn't specify a relay URL.
+	// Like udpMux, it's fixed for the proxy's lifetime and needs no mutex.
+	relayFailover *relayURLPool
+
+	// natProbes, built from NATProbeURLs by Start, is consulted by
+	// checkNATType instead of the single NATProbeURL. Fixed for the
+	// proxy's lifetime; needs no mutex.
+	natProbes *natProbePool
 }
 
 // Checks whether an IP address is a remote address for the client
@@ -221,6 +449,28 @@ func limitedRead(r io.Reader, limit int64) ([]byte, error) {
 type SignalingServer struct {
 	url       *url.URL
 	transport http.RoundTripper
+	// methods, when non-empty, overrides the plain HTTPS POST made by
+	// Post/exchange with a prioritized list of RendezvousMethods, tried in
+	// order until one succeeds. This lets a proxy stuck behind a censor or
+	// a broken front still reach the broker through e.g. an AMP cache.
+	methods []RendezvousMethod
+	// sdpMunge, when non-nil, transforms the answer SDP before it's sent to
+	// the broker.
+	sdpMunge func(string) string
+	// metrics, when non-nil, receives per-broker poll/answer counters for
+	// SnowflakeProxy.Metrics.
+	metrics *Metrics
+	// tokens, when non-nil, points at the owning SnowflakeProxy's current
+	// client count, reported to the broker with every poll. Set by Start
+	// (and Reconfigure); nil for a SignalingServer built directly, e.g. in
+	// tests or by checkNATType's probe connection.
+	tokens *uint64
+	// capacity is the owning SnowflakeProxy's configured Capacity (see its
+	// doc comment), reported to the broker alongside tokens with every
+	// poll so PopWeighted can prefer proxies with the most spare capacity
+	// instead of treating every available proxy as interchangeable. 0
+	// means unlimited, the same meaning Capacity itself carries.
+	capacity uint
 }
 
 func newSignalingServer(rawURL string) (*SignalingServer, error) {
@@ -236,6 +486,37 @@ func newSignalingServer(rawURL string) (*SignalingServer, error) {
 	return s, nil
 }
 
+// newSignalingServerWithRendezvousMethods is like newSignalingServer, but has
+// the SignalingServer try each of methods in order for every poll/answer
+// exchange instead of going straight to a plain HTTPS POST.
+func newSignalingServerWithRendezvousMethods(rawURL string, methods []RendezvousMethod) (*SignalingServer, error) {
+	s, err := newSignalingServer(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	s.methods = methods
+	return s, nil
+}
+
+// exchange sends payload to the broker-relative path, either through the
+// configured RendezvousMethods (if any) or, by default, a plain HTTPS POST.
+func (s *SignalingServer) exchange(path string, payload []byte) ([]byte, error) {
+	if len(s.methods) == 0 {
+		brokerPath := s.url.ResolveReference(&url.URL{Path: path})
+		return s.Post(brokerPath.String(), bytes.NewReader(payload))
+	}
+	var lastErr error
+	for _, m := range s.methods {
+		resp, err := m.Exchange(path, payload)
+		if err == nil {
+			return resp, nil
+		}
+		log.Printf("rendezvous method failed, trying next: %v", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
 // Post sends a POST request to the SignalingServer
 func (s *SignalingServer) Post(path string, payload io.Reader) ([]byte, error) {
 	req, err := http.NewRequest("POST", path, payload)
@@ -258,43 +539,90 @@ func (s *SignalingServer) Post(path string, payload io.Reader) ([]byte, error) {
 // pollOffer communicates the proxy's capabilities with broker
 // and retrieves a compatible SDP offer and relay URL.
 func (s *SignalingServer) pollOffer(sid string, proxyType string, acceptedRelayPattern string) (*webrtc.SessionDescription, string) {
-	brokerPath := s.url.ResolveReference(&url.URL{Path: "proxy"})
+	offer, relayURL, _ := s.pollOfferWithStatus(sid, proxyType, acceptedRelayPattern)
+	return offer, relayURL
+}
 
-	numClients := (tokens / 8) * 8 // Round down to 8
+// pollOfferWithStatus is pollOffer, additionally reporting whether the
+// broker itself was reached. Its error return is nil whenever the broker
+// answered -- including a legitimate "no client waiting" empty poll, or an
+// offer this proxy rejected -- and non-nil only on a transport or decode
+// failure, so a brokerPool can tell a down broker apart from one that simply
+// has nothing to offer right now.
+func (s *SignalingServer) pollOfferWithStatus(sid string, proxyType string, acceptedRelayPattern string) (*webrtc.SessionDescription, string, error) {
+	var numClients uint64
+	if s.tokens != nil {
+		numClients = (atomic.LoadUint64(s.tokens) / 8) * 8 // Round down to 8
+	}
 	currentNATTypeLoaded := getCurrentNATType()
-	body, err := messages.EncodeProxyPollRequestWithRelayPrefix(sid, proxyType, currentNATTypeLoaded, numClients, acceptedRelayPattern)
+	body, err := messages.EncodeProxyPollRequestWithRelayPrefix(sid, proxyType, currentNATTypeLoaded, numClients, uint64(s.capacity), acceptedRelayPattern)
 	if err != nil {
 		log.Printf("Error encoding poll message: %s", err.Error())
-		return nil, ""
+		if s.metrics != nil {
+			s.metrics.TrackBrokerPoll(s.url.String(), false)
+		}
+		return nil, "", err
 	}
 
-	resp, err := s.Post(brokerPath.String(), bytes.NewBuffer(body))
+	resp, err := s.exchange("proxy", body)
 	if err != nil {
 		log.Printf("error polling broker: %s", err.Error())
+		if s.metrics != nil {
+			s.metrics.TrackBrokerPoll(s.url.String(), false)
+		}
+		return nil, "", err
 	}
 
 	offer, _, relayURL, err := messages.DecodePollResponseWithRelayURL(resp)
 	if err != nil {
 		log.Printf("Error reading broker response: %s", err.Error())
 		log.Printf("body: %s", resp)
-		return nil, ""
+		if s.metrics != nil {
+			s.metrics.TrackBrokerPoll(s.url.String(), false)
+		}
+		return nil, "", err
+	}
+	if s.metrics != nil {
+		s.metrics.TrackBrokerPoll(s.url.String(), true)
 	}
 	if offer != "" {
-		offer, err := util.DeserializeSessionDescription(offer)
+		if s.metrics != nil {
+			s.metrics.TrackOfferReceived()
+		}
+		if err := validateOfferSDP(offer); err != nil {
+			log.Printf("Rejecting offer from broker: %s", err.Error())
+			return nil, "", nil
+		}
+		offerDesc, err := util.DeserializeSessionDescription(offer)
 		if err != nil {
 			log.Printf("Error processing session description: %s", err.Error())
-			return nil, ""
+			return nil, "", nil
 		}
-		return offer, relayURL
+		return offerDesc, relayURL, nil
 	}
-	return nil, ""
+	return nil, "", nil
 }
 
 // sendAnswer encodes an SDP answer, sends it to the broker
 // and wait for its response
 func (s *SignalingServer) sendAnswer(sid string, pc *webrtc.PeerConnection) error {
+	err := s.sendAnswerInner(sid, pc)
+	if s.metrics != nil {
+		s.metrics.TrackAnswerSent(err == nil)
+	}
+	return err
+}
+
+func (s *SignalingServer) sendAnswerInner(sid string, pc *webrtc.PeerConnection) error {
 	ld := pc.LocalDescription()
-	answer, err := util.SerializeSessionDescription(ld)
+	if err := validateAnswerSDP(ld); err != nil {
+		return fmt.Errorf("refusing to send answer: %w", err)
+	}
+	sdp := ld.SDP
+	if s.sdpMunge != nil {
+		sdp = s.sdpMunge(sdp)
+	}
+	answer, err := util.SerializeSessionDescription(&webrtc.SessionDescription{Type: ld.Type, SDP: sdp})
 	if err != nil {
 		return err
 	}
@@ -304,8 +632,7 @@ func (s *SignalingServer) sendAnswer(sid string, pc *webrtc.PeerConnection) erro
 		return err
 	}
 
-	brokerPath := s.url.ResolveReference(&url.URL{Path: "answer"})
-	resp, err := s.Post(brokerPath.String(), bytes.NewBuffer(body))
+	resp, err := s.exchange("answer", body)
 	if err != nil {
 		return fmt.Errorf("error sending answer to broker: %s", err.Error())
 	}
@@ -366,30 +693,170 @@ func copyLoop(c1 io.ReadWriteCloser, c2 io.ReadWriteCloser, shutdown chan struct
 // conn.RemoteAddr() inside this function, as a workaround for a hang that
 // otherwise occurs inside conn.pc.RemoteDescription() (called by RemoteAddr).
 // https://bugs.torproject.org/18628#comment:8
-func (sf *SnowflakeProxy) datachannelHandler(conn *webRTCConn, remoteAddr net.Addr, relayURL string) {
-	atomic.AddUint64(&tokens, 1)
-	defer atomic.AddUint64(&tokens, ^uint64(0))
+func (sf *SnowflakeProxy) datachannelHandler(conn *webRTCConn, remoteAddr net.Addr, relayURL string, clientID string) {
+	atomic.AddUint64(&sf.tokens, 1)
+	defer atomic.AddUint64(&sf.tokens, ^uint64(0))
 	defer conn.Close()
 
 	if relayURL == "" {
 		relayURL = sf.RelayURL
 	}
 
-	wsConn, err := connectToRelay(relayURL, remoteAddr)
+	var remoteAddrStr string
+	if remoteAddr != nil {
+		remoteAddrStr = remoteAddr.String()
+	}
+	atomic.AddUint64(&sf.sessionsStarted, 1)
+	sessionStart := time.Now()
+	sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxySessionStarted{RemoteAddr: remoteAddrStr})
+	var bytesIn, bytesOut int64
+	var sessionErr error
+
+	// The span below starts here, once the DataChannel this function was
+	// handed is already open, rather than back in runSession when the
+	// offer first arrived: runSession returns (or keeps polling) on its
+	// own schedule independent of whether a DataChannel ever opens, and
+	// this function is invoked as its OnOpen callback on a separate
+	// goroutine, so there's no runSession-owned context to extend here.
+	// It therefore covers "DataChannel open -> bytes relayed -> session
+	// close", not the earlier "offer received -> ICE gathered" milestones;
+	// those already have their own metrics (offersReceived,
+	// iceGatheringTime in proxy/lib/metrics.go).
+	_, span := sf.Tracer.Start(context.Background(), "snowflake.proxy.session")
+	span.SetAttributes(
+		attribute.String("snowflake.nat_type", getCurrentNATType()),
+		attribute.String("snowflake.relay_url", relayURL),
+	)
+	defer func() {
+		if sessionErr != nil {
+			atomic.AddUint64(&sf.sessionsFailed, 1)
+			span.SetStatus(codes.Error, sessionErr.Error())
+		} else {
+			atomic.AddUint64(&sf.sessionsCompleted, 1)
+		}
+		span.SetAttributes(
+			attribute.Int64("snowflake.bytes_in", atomic.LoadInt64(&bytesIn)),
+			attribute.Int64("snowflake.bytes_out", atomic.LoadInt64(&bytesOut)),
+		)
+		span.End()
+		sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxySessionEnded{
+			BytesIn:    atomic.LoadInt64(&bytesIn),
+			BytesOut:   atomic.LoadInt64(&bytesOut),
+			Duration:   time.Since(sessionStart),
+			RemoteAddr: remoteAddrStr,
+			Err:        sessionErr,
+		})
+	}()
+
+	session := sf.sessions.join(clientID)
+	if session != nil {
+		if sal, ok := sf.bytesLogger.(sessionAwareLogger); ok {
+			sal.SessionStarted(getCurrentNATType())
+		}
+	}
+	defer func() {
+		if session != nil {
+			if sal, ok := sf.bytesLogger.(sessionAwareLogger); ok {
+				sal.SessionEnded(session.bytesIn.Load(), session.bytesOut.Load(), time.Since(session.started), getCurrentNATType())
+			}
+		}
+		sf.sessions.leave(clientID)
+	}()
+
+	var (
+		wsConn        net.Conn
+		failureReason string
+		err           error
+	)
+	if sf.RelayPolicy != nil {
+		wsConn, _, err = sf.RelayPolicy.Dial(context.Background(), relayURL, remoteAddr)
+		if err != nil {
+			failureReason = "dial_failed"
+		}
+	} else if relayURL == "" && sf.relayFailover != nil {
+		wsConn, _, err = sf.relayFailover.dial(remoteAddr)
+		if err != nil {
+			failureReason = "dial_failed"
+		}
+	} else {
+		wsConn, failureReason, err = connectToRelay(relayURL, remoteAddr)
+	}
 	if err != nil {
 		log.Print(err)
+		if sf.Metrics != nil {
+			sf.Metrics.TrackRelayDialFailure(failureReason)
+		}
+		sessionErr = err
 		return
 	}
 	defer wsConn.Close()
 
-	copyLoop(conn, wsConn, sf.shutdown)
+	var relayConn io.ReadWriteCloser = wsConn
+	if session != nil {
+		relayConn = &sessionAccountingConn{Conn: wsConn, session: session}
+	}
+	relayConn = &proxyBytesAccountingConn{ReadWriteCloser: relayConn, bytesIn: &bytesIn, bytesOut: &bytesOut, proxyBytesIn: &sf.bytesRelayedIn, proxyBytesOut: &sf.bytesRelayedOut}
+	if sf.PerClientBytesPerSec > 0 {
+		relayConn = newRateLimitedConn(relayConn, sf.PerClientBytesPerSec, sf.PerClientBurst)
+		sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnClientThrottled{Reason: "bandwidth_capped"})
+	}
+	copyLoop(conn, relayConn, sf.shutdown)
 	log.Printf("datachannelHandler ends")
 }
 
-func connectToRelay(relayURL string, remoteAddr net.Addr) (net.Conn, error) {
+// sessionAccountingConn wraps a relay net.Conn so that every byte relayed
+// for a joined Turbo Tunnel session is reflected in that session's
+// SessionStats.
+type sessionAccountingConn struct {
+	net.Conn
+	session *clientSession
+}
+
+func (c *sessionAccountingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.session.bytesIn.Add(int64(n))
+	return n, err
+}
+
+func (c *sessionAccountingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.session.bytesOut.Add(int64(n))
+	return n, err
+}
+
+// proxyBytesAccountingConn wraps a relay connection so that every byte
+// relayed is reflected both in a per-call session summary (bytesIn/bytesOut,
+// for EventOnProxySessionEnded) and in the owning SnowflakeProxy's cumulative
+// totals (proxyBytesIn/proxyBytesOut, for Stats). Unlike sessionAccountingConn,
+// which only wraps relayConn for clients that joined a Turbo Tunnel session,
+// this wraps every session so Stats reflects all relayed traffic.
+type proxyBytesAccountingConn struct {
+	io.ReadWriteCloser
+	bytesIn, bytesOut           *int64
+	proxyBytesIn, proxyBytesOut *int64
+}
+
+func (c *proxyBytesAccountingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddInt64(c.bytesIn, int64(n))
+	atomic.AddInt64(c.proxyBytesIn, int64(n))
+	return n, err
+}
+
+func (c *proxyBytesAccountingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddInt64(c.bytesOut, int64(n))
+	atomic.AddInt64(c.proxyBytesOut, int64(n))
+	return n, err
+}
+
+// connectToRelay dials the relay websocket at relayURL. On failure, it also
+// returns a short machine-readable reason (e.g. for Metrics.TrackRelayDialFailure);
+// the reason is empty on success.
+func connectToRelay(relayURL string, remoteAddr net.Addr) (net.Conn, string, error) {
 	u, err := url.Parse(relayURL)
 	if err != nil {
-		return nil, fmt.Errorf("invalid relay url: %s", err)
+		return nil, "invalid_relay_url", fmt.Errorf("invalid relay url: %s", err)
 	}
 
 	if remoteAddr != nil {
@@ -404,27 +871,38 @@ func connectToRelay(relayURL string, remoteAddr net.Addr) (net.Conn, error) {
 
 	ws, _, err := websocket.Dial(context.Background(), u.String(), &websocket.DialOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error dialing relay: %s = %s", u.String(), err)
+		return nil, "dial_failed", fmt.Errorf("error dialing relay: %s = %s", u.String(), err)
 	}
 
 	wsConn := websocket.NetConn(context.Background(), ws, websocket.MessageBinary)
 	log.Printf("Connected to relay: %v", relayURL)
-	return wsConn, nil
+	return wsConn, "", nil
 }
 
 type dataChannelHandlerWithRelayURL struct {
 	RelayURL string
+	ClientID string
 	sf       *SnowflakeProxy
 }
 
 func (d dataChannelHandlerWithRelayURL) datachannelHandler(conn *webRTCConn, remoteAddr net.Addr) {
-	d.sf.datachannelHandler(conn, remoteAddr, d.RelayURL)
+	d.sf.datachannelHandler(conn, remoteAddr, d.RelayURL, d.ClientID)
 }
 
-func (sf *SnowflakeProxy) makeWebRTCAPI() *webrtc.API {
+func (sf *SnowflakeProxy) makeWebRTCAPI() (*webrtc.API, error) {
 	settingsEngine := webrtc.SettingEngine{}
 
-	if !sf.KeepLocalAddresses {
+	var nat1To1IPs []string
+	if sf.OutboundAddress != "" {
+		nat1To1IPs = append(nat1To1IPs, sf.OutboundAddress)
+	}
+	nat1To1IPs = append(nat1To1IPs, sf.NAT1To1Mappings...)
+
+	// A proxy behind a static NAT needs its gathered host candidates (which
+	// carry its private interface address) to survive the IP filter below
+	// so that SetNAT1To1IPs, further down, has a host candidate left to
+	// rewrite to the mapped external address.
+	if !sf.KeepLocalAddresses && len(nat1To1IPs) == 0 {
 		settingsEngine.SetIPFilter(func(ip net.IP) (keep bool) {
 			// `IsLoopback()` and `IsUnspecified` are likely not neded here,
 			// but let's keep them just in case.
@@ -442,24 +920,33 @@ func (sf *SnowflakeProxy) makeWebRTCAPI() *webrtc.API {
 	vnet, _ := stdnet.NewNet()
 	settingsEngine.SetNet(vnet)
 
-	if sf.EphemeralMinPort != 0 && sf.EphemeralMaxPort != 0 {
-		err := settingsEngine.SetEphemeralUDPPortRange(sf.EphemeralMinPort, sf.EphemeralMaxPort)
-		if err != nil {
-			log.Fatal("Invalid port range: min > max")
+	if sf.udpMux != nil {
+		// All concurrent client PeerConnections reuse this fixed set of UDP
+		// listeners instead of each allocating its own ephemeral port.
+		settingsEngine.SetICEUDPMux(sf.udpMux)
+	} else {
+		sf.mu.RLock()
+		minPort, maxPort := sf.EphemeralMinPort, sf.EphemeralMaxPort
+		sf.mu.RUnlock()
+		if minPort != 0 && maxPort != 0 {
+			err := settingsEngine.SetEphemeralUDPPortRange(minPort, maxPort)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ephemeral port range: %w", err)
+			}
 		}
 	}
 
-	if sf.OutboundAddress != "" {
-		// replace SDP host candidates with the given IP without validation
+	if len(nat1To1IPs) > 0 {
+		// replace SDP host candidates with the given IP(s) without validation
 		// still have server reflexive candidates to fall back on
-		settingsEngine.SetNAT1To1IPs([]string{sf.OutboundAddress}, webrtc.ICECandidateTypeHost)
+		settingsEngine.SetNAT1To1IPs(nat1To1IPs, webrtc.ICECandidateTypeHost)
 	}
 
 	settingsEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
 
 	settingsEngine.SetDTLSInsecureSkipHelloVerify(true)
 
-	return webrtc.NewAPI(webrtc.WithSettingEngine(settingsEngine))
+	return webrtc.NewAPI(webrtc.WithSettingEngine(settingsEngine)), nil
 }
 
 // Create a PeerConnection from an SDP offer. Blocks until the gathering of ICE
@@ -471,11 +958,18 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 	config webrtc.Configuration, dataChan chan struct{},
 	handler func(conn *webRTCConn, remoteAddr net.Addr),
 ) (*webrtc.PeerConnection, error) {
-	api := sf.makeWebRTCAPI()
+	api, err := sf.makeWebRTCAPI()
+	if err != nil {
+		return nil, fmt.Errorf("accept: %w", err)
+	}
+	pcCreated := time.Now()
 	pc, err := api.NewPeerConnection(config)
 	if err != nil {
 		return nil, fmt.Errorf("accept: NewPeerConnection: %s", err)
 	}
+	if sf.Metrics != nil {
+		sf.Metrics.TrackPeerConnectionOpened()
+	}
 
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
 		log.Printf("New Data Channel %s-%d\n", dc.Label(), dc.ID())
@@ -484,6 +978,9 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 		pr, pw := io.Pipe()
 		conn := newWebRTCConn(pc, dc, pr, sf.bytesLogger)
 
+		var dcOpened time.Time
+		var firstByte sync.Once
+
 		dc.SetBufferedAmountLowThreshold(bufferedAmountLowThreshold)
 
 		dc.OnBufferedAmountLow(func() {
@@ -495,6 +992,10 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 
 		dc.OnOpen(func() {
 			log.Printf("Data Channel %s-%d open\n", dc.Label(), dc.ID())
+			dcOpened = time.Now()
+			if sf.Metrics != nil {
+				sf.Metrics.TrackDataChannelOpenLatency(dcOpened.Sub(pcCreated))
+			}
 			sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyClientConnected{})
 
 			if sf.OutboundAddress != "" {
@@ -513,12 +1014,21 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 			conn.lock.Lock()
 			defer conn.lock.Unlock()
 			log.Printf("Data Channel %s-%d close\n", dc.Label(), dc.ID())
+			if sf.Metrics != nil {
+				sf.Metrics.TrackPeerConnectionClosed()
+			}
 			sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyConnectionOver{})
 			conn.dc = nil
 			dc.Close()
 			pw.Close()
 		})
 		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			if sf.Metrics != nil {
+				firstByte.Do(func() {
+					sf.Metrics.TrackTimeToFirstByte(time.Since(dcOpened), getCurrentNATType())
+				})
+			}
+
 			var n int
 			n, err = pw.Write(msg.Data)
 			if err != nil {
@@ -542,6 +1052,7 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 	// As of v3.0.0, pion-webrtc uses trickle ICE by default.
 	// We have to wait for candidate gathering to complete
 	// before we send the offer
+	gatherStart := time.Now()
 	done := webrtc.GatheringCompletePromise(pc)
 	err = pc.SetRemoteDescription(*sdp)
 	if err != nil {
@@ -580,6 +1091,9 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 		log.Print("ICE gathering is not yet complete, but let's send the answer" +
 			" before the client times out")
 	}
+	if sf.Metrics != nil {
+		sf.Metrics.TrackICEGatheringTime(time.Since(gatherStart), getCurrentNATType())
+	}
 
 	log.Printf("Answer: \n\t%s", strings.ReplaceAll(pc.LocalDescription().SDP, "\n", "\n\t"))
 
@@ -591,7 +1105,10 @@ func (sf *SnowflakeProxy) makePeerConnectionFromOffer(
 func (sf *SnowflakeProxy) makeNewPeerConnection(
 	config webrtc.Configuration, dataChan chan struct{},
 ) (*webrtc.PeerConnection, error) {
-	api := sf.makeWebRTCAPI()
+	api, err := sf.makeWebRTCAPI()
+	if err != nil {
+		return nil, fmt.Errorf("accept: %w", err)
+	}
 	pc, err := api.NewPeerConnection(config)
 	if err != nil {
 		return nil, fmt.Errorf("accept: NewPeerConnection: %s", err)
@@ -645,33 +1162,48 @@ func (sf *SnowflakeProxy) makeNewPeerConnection(
 }
 
 func (sf *SnowflakeProxy) runSession(sid string) {
-	offer, relayURL := broker.pollOffer(sid, sf.ProxyType, sf.RelayDomainNamePattern)
+	offer, relayURL := sf.pollBrokerOffer(sid, sf.ProxyType, sf.RelayDomainNamePattern)
 	if offer == nil {
 		return
 	}
 	log.Printf("Received Offer From Broker: \n\t%s", strings.ReplaceAll(offer.SDP, "\n", "\n\t"))
 
 	if relayURL != "" {
-		if err := checkIsRelayURLAcceptable(sf.RelayDomainNamePattern, sf.AllowProxyingToPrivateAddresses, sf.AllowNonTLSRelay, relayURL); err != nil {
+		var err error
+		if sf.RelayPolicy != nil {
+			err = sf.RelayPolicy.Evaluate(relayURL)
+		} else {
+			err = checkIsRelayURLAcceptable(sf.RelayDomainNamePattern, sf.AllowProxyingToPrivateAddresses, sf.AllowNonTLSRelay, relayURL)
+		}
+		if err != nil {
 			log.Printf("bad offer from broker: %v", err)
+			sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyNegotiationFailed{Reason: "bad_relay_url"})
 			return
 		}
 	}
 
+	if sf.admissionLimiter != nil && !sf.admissionLimiter.Allow() {
+		log.Printf("declining offer: MaxNewClientsPerMinute exceeded")
+		sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnClientThrottled{Reason: "max_new_clients_per_minute"})
+		return
+	}
+
 	dataChan := make(chan struct{})
-	dataChannelAdaptor := dataChannelHandlerWithRelayURL{RelayURL: relayURL, sf: sf}
-	pc, err := sf.makePeerConnectionFromOffer(offer, config, dataChan, dataChannelAdaptor.datachannelHandler)
+	dataChannelAdaptor := dataChannelHandlerWithRelayURL{RelayURL: relayURL, ClientID: sid, sf: sf}
+	pc, err := sf.makePeerConnectionFromOffer(offer, sf.currentConfig(), dataChan, dataChannelAdaptor.datachannelHandler)
 	if err != nil {
 		log.Printf("error making WebRTC connection: %s", err)
+		sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyNegotiationFailed{Reason: "peer_connection_failed"})
 		return
 	}
 
-	err = broker.sendAnswer(sid, pc)
+	err = sf.sendBrokerAnswer(sid, pc)
 	if err != nil {
 		log.Printf("error sending answer to client through broker: %s", err)
 		if inerr := pc.Close(); inerr != nil {
 			log.Printf("error calling pc.Close: %v", inerr)
 		}
+		sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyNegotiationFailed{Reason: "broker_answer_failed"})
 		return
 	}
 	// Set a timeout on peerconnection. If the connection state has not
@@ -685,6 +1217,10 @@ func (sf *SnowflakeProxy) runSession(sid string) {
 		if err := pc.Close(); err != nil {
 			log.Printf("error calling pc.Close: %v", err)
 		}
+		if sf.Metrics != nil {
+			sf.Metrics.TrackPeerConnectionClosed()
+		}
+		sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyNegotiationFailed{Reason: "datachannel_timeout"})
 	}
 }
 
@@ -728,13 +1264,134 @@ func checkIsRelayURLAcceptable(
 	return nil
 }
 
+// buildBrokers constructs the single SignalingServer described by
+// sf.BrokerURL/BrokerRendezvousMethod/BrokerFrontDomains/BrokerAMPCacheURL,
+// and, if sf.BrokerURLs is set, the brokerPool described by it, without
+// touching sf.broker/sf.brokerFailover -- callers (Start, Reconfigure)
+// install the results themselves, under sf.mu, once they're known to be
+// valid.
+func (sf *SnowflakeProxy) buildBrokers() (*SignalingServer, *brokerPool, error) {
+	brokerMethods, err := sf.brokerRendezvousMethods()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring broker rendezvous method: %s", err)
+	}
+	var newBroker *SignalingServer
+	if len(brokerMethods) != 0 {
+		newBroker, err = newSignalingServerWithRendezvousMethods(sf.BrokerURL, brokerMethods)
+	} else {
+		newBroker, err = newSignalingServer(sf.BrokerURL)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring broker: %s", err)
+	}
+	newBroker.metrics = sf.Metrics
+	newBroker.tokens = &sf.tokens
+	newBroker.capacity = sf.Capacity
+	if sf.SDPRestrictICEToUDP {
+		newBroker.sdpMunge = util.RestrictICEToUDP
+	}
+
+	var newBrokerFailover *brokerPool
+	if len(sf.BrokerURLs) != 0 {
+		servers := make([]*SignalingServer, 0, len(sf.BrokerURLs))
+		for _, rawURL := range sf.BrokerURLs {
+			s, err := newSignalingServer(rawURL)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error configuring broker %q: %s", rawURL, err)
+			}
+			if sf.SDPRestrictICEToUDP {
+				s.sdpMunge = util.RestrictICEToUDP
+			}
+			s.metrics = sf.Metrics
+			s.tokens = &sf.tokens
+			s.capacity = sf.Capacity
+			servers = append(servers, s)
+		}
+		newBrokerFailover = newBrokerPool(servers, sf.EventDispatcher)
+	}
+
+	return newBroker, newBrokerFailover, nil
+}
+
+// buildWebRTCConfig returns the webrtc.Configuration described by sf.STUNURL.
+func (sf *SnowflakeProxy) buildWebRTCConfig() webrtc.Configuration {
+	return webrtc.Configuration{
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: strings.Split(sf.STUNURL, ","),
+			},
+		},
+	}
+}
+
+// buildUDPMux opens one UDP listener per port in sf.UDPMuxPorts and
+// multiplexes every concurrent client PeerConnection's ICE traffic over
+// them, wrapping more than one into a single ice.UDPMux with
+// ice.NewMultiUDPMuxDefault. Returns nil, nil if UDPMuxPorts is empty.
+func (sf *SnowflakeProxy) buildUDPMux() (ice.UDPMux, error) {
+	if len(sf.UDPMuxPorts) == 0 {
+		return nil, nil
+	}
+
+	muxes := make([]ice.UDPMux, 0, len(sf.UDPMuxPorts))
+	for _, port := range sf.UDPMuxPorts {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			return nil, fmt.Errorf("error listening on UDP mux port %d: %s", port, err)
+		}
+		muxes = append(muxes, ice.NewUDPMuxDefault(ice.UDPMuxDefaultParams{UDPConn: conn}))
+	}
+	if len(muxes) == 1 {
+		return muxes[0], nil
+	}
+	return ice.NewMultiUDPMuxDefault(muxes...), nil
+}
+
+// currentConfig returns the webrtc.Configuration Reconfigure last installed,
+// for code (runSession, checkNATType) that needs it outside of Start itself.
+func (sf *SnowflakeProxy) currentConfig() webrtc.Configuration {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.config
+}
+
+// warnIfEphemeralPortRangeIsNarrow logs a warning if sf.EphemeralMinPort/
+// EphemeralMaxPort looks too narrow for sf.Capacity concurrent clients.
+func (sf *SnowflakeProxy) warnIfEphemeralPortRangeIsNarrow() {
+	if len(sf.UDPMuxPorts) != 0 || sf.EphemeralMaxPort == 0 {
+		return
+	}
+	rangeWidth := sf.EphemeralMaxPort - sf.EphemeralMinPort
+	expectedNumConcurrentClients := sf.Capacity
+	if sf.Capacity == 0 {
+		// Just a guess, since 0 means "unlimited".
+		expectedNumConcurrentClients = 10
+	}
+	// See https://forum.torproject.org/t/remote-returned-status-code-400/15026/9?u=wofwca
+	if uint(rangeWidth) < expectedNumConcurrentClients*2 {
+		log.Printf(
+			"Warning: ephemeral ports range seems narrow (%v-%v) "+
+				"for the client capacity (%v). "+
+				"Some client connections might fail. "+
+				"Please widen the port range, or limit the 'capacity'.",
+			sf.EphemeralMinPort,
+			sf.EphemeralMaxPort,
+			sf.Capacity,
+		)
+		// Instead of simply printing a warning, we could look into
+		// utilizing [SetICEUDPMux](https://pkg.go.dev/github.com/pion/webrtc/v4#SettingEngine.SetICEUDPMux)
+		// to multiplex multiple connections over one (or more?) ports.
+	}
+}
+
 // Start configures and starts a Snowflake, fully formed and special. Configuration
 // values that are unset will default to their corresponding default values.
 func (sf *SnowflakeProxy) Start() error {
 	var err error
 
-	sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyStarting{})
+	sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnProxyStarting{Version: version.GetVersion()})
 	sf.shutdown = make(chan struct{})
+	sf.mu = &sync.RWMutex{}
 
 	// blank configurations revert to default
 	if sf.PollInterval == 0 {
@@ -752,20 +1409,75 @@ func (sf *SnowflakeProxy) Start() error {
 	if sf.NATProbeURL == "" {
 		sf.NATProbeURL = DefaultNATProbeURL
 	}
+	proxyFunc, err := buildProxyFunc(sf.HTTPProxyURL)
+	if err != nil {
+		return fmt.Errorf("error parsing HTTP proxy url: %w", err)
+	}
+	customtransport.Proxy = proxyFunc
 	if sf.ProxyType == "" {
 		sf.ProxyType = DefaultProxyType
 	}
 	if sf.EventDispatcher == nil {
 		sf.EventDispatcher = event.NewSnowflakeEventDispatcher()
 	}
+	if sf.Sinks == nil {
+		sf.Sinks = event.NewMultiSink()
+	}
+	sf.EventDispatcher.AddSnowflakeEventListener(sf.Sinks)
+
+	if sf.Metrics == nil && sf.MetricsListenAddr != "" {
+		sf.Metrics = NewMetrics(nil)
+		if err := sf.Metrics.Start(sf.MetricsListenAddr); err != nil {
+			return fmt.Errorf("error starting metrics listener: %s", err)
+		}
+	}
+	if sf.Tracer == nil && sf.OTLPEndpoint != "" {
+		otlpCfg := otelconfig.Config{
+			Endpoint:    sf.OTLPEndpoint,
+			Headers:     sf.OTLPHeaders,
+			Protocol:    sf.OTLPProtocol,
+			Insecure:    sf.OTLPInsecure,
+			Compression: sf.OTLPCompression,
+		}
+		meterProvider, err := otelconfig.NewMeterProvider(context.Background(), otlpCfg)
+		if err != nil {
+			return fmt.Errorf("error building OTLP meter provider: %w", err)
+		}
+		otelReceiver, err := sinks.NewOTelReceiver(meterProvider)
+		if err != nil {
+			return fmt.Errorf("error building OTLP metrics receiver: %w", err)
+		}
+		sf.EventDispatcher.AddSnowflakeEventListener(otelReceiver)
 
-	sf.bytesLogger = newBytesSyncLogger()
-	sf.periodicProxyStats = newPeriodicProxyStats(sf.SummaryInterval, sf.EventDispatcher, sf.bytesLogger)
+		tracerProvider, err := otelconfig.NewTracerProvider(context.Background(), otlpCfg)
+		if err != nil {
+			return fmt.Errorf("error building OTLP tracer provider: %w", err)
+		}
+		sf.Tracer = tracerProvider.Tracer("tgragnato.it/snowflake/proxy")
+	}
+	if sf.Tracer == nil {
+		sf.Tracer = trace.NewNoopTracerProvider().Tracer("")
+	}
+	if sf.Metrics != nil {
+		sf.bytesLogger = newPromBytesLogger(sf.Metrics)
+	} else {
+		sf.bytesLogger = newBytesSyncLogger()
+	}
+	sf.sessions = newSessionManager()
+	sf.periodicProxyStats = newPeriodicProxyStats(sf.SummaryInterval, sf.EventDispatcher, sf.bytesLogger, sf.StatsFilename)
 	sf.EventDispatcher.AddSnowflakeEventListener(sf.periodicProxyStats)
 
-	broker, err = newSignalingServer(sf.BrokerURL)
+	if sf.PerClientBurst == 0 {
+		sf.PerClientBurst = int(sf.PerClientBytesPerSec)
+	}
+	sf.admissionLimiter = nil
+	if sf.MaxNewClientsPerMinute != 0 {
+		sf.admissionLimiter = rate.NewLimiter(rate.Limit(float64(sf.MaxNewClientsPerMinute)/60.0), sf.MaxNewClientsPerMinute)
+	}
+
+	newBroker, newBrokerFailover, err := sf.buildBrokers()
 	if err != nil {
-		return fmt.Errorf("error configuring broker: %s", err)
+		return err
 	}
 
 	_, err = url.Parse(sf.STUNURL)
@@ -781,51 +1493,45 @@ func (sf *SnowflakeProxy) Start() error {
 		return fmt.Errorf("invalid relay domain name pattern")
 	}
 
-	if sf.EphemeralMaxPort != 0 {
-		rangeWidth := sf.EphemeralMaxPort - sf.EphemeralMinPort
-		expectedNumConcurrentClients := sf.Capacity
-		if sf.Capacity == 0 {
-			// Just a guess, since 0 means "unlimited".
-			expectedNumConcurrentClients = 10
-		}
-		// See https://forum.torproject.org/t/remote-returned-status-code-400/15026/9?u=wofwca
-		if uint(rangeWidth) < expectedNumConcurrentClients*2 {
-			log.Printf(
-				"Warning: ephemeral ports range seems narrow (%v-%v) "+
-					"for the client capacity (%v). "+
-					"Some client connections might fail. "+
-					"Please widen the port range, or limit the 'capacity'.",
-				sf.EphemeralMinPort,
-				sf.EphemeralMaxPort,
-				sf.Capacity,
-			)
-			// Instead of simply printing a warning, we could look into
-			// utilizing [SetICEUDPMux](https://pkg.go.dev/github.com/pion/webrtc/v4#SettingEngine.SetICEUDPMux)
-			// to multiplex multiple connections over one (or more?) ports.
-		}
+	sf.warnIfEphemeralPortRangeIsNarrow()
+
+	sf.udpMux, err = sf.buildUDPMux()
+	if err != nil {
+		return fmt.Errorf("error configuring UDP mux: %s", err)
 	}
 
-	config = webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: strings.Split(sf.STUNURL, ","),
-			},
-		},
+	if len(sf.RelayURLs) != 0 {
+		sf.relayFailover = newRelayURLPool(sf.RelayURLs)
+	}
+	if len(sf.NATProbeURLs) != 0 {
+		sf.natProbes = newNATProbePool(sf.NATProbeURLs)
 	}
-	tokens = 0
 
-	err = sf.checkNATType(config, sf.NATProbeURL)
+	newConfig := sf.buildWebRTCConfig()
+
+	sf.mu.Lock()
+	sf.broker = newBroker
+	sf.brokerFailover = newBrokerFailover
+	sf.config = newConfig
+	sf.mu.Unlock()
+	atomic.StoreUint64(&sf.tokens, 0)
+
+	prevNATType := getCurrentNATType()
+	err = sf.checkNATType(sf.currentConfig())
 	if err != nil {
 		// non-fatal error. Log it and continue
 		log.Print(err.Error())
 		setCurrentNATType(NATUnknown)
 	}
+	if sf.Metrics != nil {
+		sf.Metrics.TrackCurrentNATType(getCurrentNATType(), prevNATType)
+	}
 	sf.EventDispatcher.OnNewSnowflakeEvent(event.EventOnCurrentNATTypeDetermined{CurNATType: getCurrentNATType()})
 
 	NatRetestTask := task.Periodic{
 		Interval: sf.NATTypeMeasurementInterval,
 		Execute: func() error {
-			return sf.checkNATType(config, sf.NATProbeURL)
+			return sf.checkNATType(sf.currentConfig())
 		},
 		// Not setting OnError would shut down the periodic task on error by default.
 		OnError: func(err error) {
@@ -858,10 +1564,109 @@ func (sf *SnowflakeProxy) Stop() {
 	close(sf.shutdown)
 }
 
-// checkNATType use probetest to determine NAT compatability by
-// attempting to connect with a known symmetric NAT. If success,
-// it is considered "unrestricted". If timeout it is considered "restricted"
-func (sf *SnowflakeProxy) checkNATType(config webrtc.Configuration, probeURL string) error {
+// Reconfigure atomically swaps the broker(s), STUN configuration, capacity,
+// relay allowlist pattern, and ephemeral port range of a running
+// SnowflakeProxy for those of newCfg, without interrupting any client
+// session already in datachannelHandler: those sessions keep relaying
+// through the PeerConnection (and the webrtc.SettingEngine baked into it at
+// makeWebRTCAPI time) they already have, and simply drain to completion on
+// their own. Only the next poll loop iteration, and any PeerConnection
+// created after that, sees the new configuration.
+//
+// Fields of newCfg not mentioned above (PollInterval, EventDispatcher,
+// Metrics, and so on) are ignored; Reconfigure cannot be used to change
+// them after Start.
+func (sf *SnowflakeProxy) Reconfigure(newCfg SnowflakeProxy) error {
+	if _, err := url.Parse(newCfg.STUNURL); err != nil {
+		return fmt.Errorf("invalid stun url: %s", err)
+	}
+	if !namematcher.IsValidRule(newCfg.RelayDomainNamePattern) {
+		return fmt.Errorf("invalid relay domain name pattern")
+	}
+
+	sf.BrokerURL = newCfg.BrokerURL
+	sf.BrokerURLs = newCfg.BrokerURLs
+	sf.BrokerRendezvousMethod = newCfg.BrokerRendezvousMethod
+	sf.BrokerFrontDomains = newCfg.BrokerFrontDomains
+	sf.BrokerAMPCacheURL = newCfg.BrokerAMPCacheURL
+	sf.SDPRestrictICEToUDP = newCfg.SDPRestrictICEToUDP
+
+	newBroker, newBrokerFailover, err := sf.buildBrokers()
+	if err != nil {
+		return err
+	}
+	newConfig := webrtc.Configuration{
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: strings.Split(newCfg.STUNURL, ","),
+			},
+		},
+	}
+
+	sf.mu.Lock()
+	sf.broker = newBroker
+	sf.brokerFailover = newBrokerFailover
+	sf.config = newConfig
+	sf.STUNURL = newCfg.STUNURL
+	sf.Capacity = newCfg.Capacity
+	sf.RelayDomainNamePattern = newCfg.RelayDomainNamePattern
+	sf.EphemeralMinPort = newCfg.EphemeralMinPort
+	sf.EphemeralMaxPort = newCfg.EphemeralMaxPort
+	sf.mu.Unlock()
+
+	sf.warnIfEphemeralPortRangeIsNarrow()
+
+	return nil
+}
+
+// Stats is a point-in-time snapshot of a running SnowflakeProxy, intended for
+// embedders (VPN clients, desktop apps, mobile bindings) that want to surface
+// proxy health in their own UI without having to scrape Prometheus.
+type Stats struct {
+	// ConnectingClients is the number of clients currently negotiating or
+	// relaying through this proxy.
+	ConnectingClients uint64
+	// CurrentNATType is the most recently measured NAT classification
+	// (NATUnknown, NATRestricted, or NATUnrestricted).
+	CurrentNATType string
+	// LastNATProbeAt is when CurrentNATType was last (re)measured, or the
+	// zero Time if no probe has completed yet.
+	LastNATProbeAt time.Time
+	// SessionsStarted, SessionsCompleted, and SessionsFailed count client
+	// sessions handled since Start: SessionsFailed is a session whose relay
+	// dial never succeeded; every other one counts as SessionsCompleted,
+	// however briefly it relayed traffic.
+	SessionsStarted, SessionsCompleted, SessionsFailed uint64
+	// BytesRelayedIn and BytesRelayedOut are the cumulative bytes relayed
+	// between clients and relays since Start (In from the relay to the
+	// client, Out from the client to the relay).
+	BytesRelayedIn, BytesRelayedOut int64
+}
+
+// Stats returns a snapshot of the proxy's current activity. It is safe to
+// call concurrently with Start and Stop.
+func (sf *SnowflakeProxy) Stats() Stats {
+	return Stats{
+		ConnectingClients: atomic.LoadUint64(&sf.tokens),
+		CurrentNATType:    getCurrentNATType(),
+		LastNATProbeAt:    getLastNATProbeAt(),
+		SessionsStarted:   atomic.LoadUint64(&sf.sessionsStarted),
+		SessionsCompleted: atomic.LoadUint64(&sf.sessionsCompleted),
+		SessionsFailed:    atomic.LoadUint64(&sf.sessionsFailed),
+		BytesRelayedIn:    atomic.LoadInt64(&sf.bytesRelayedIn),
+		BytesRelayedOut:   atomic.LoadInt64(&sf.bytesRelayedOut),
+	}
+}
+
+// checkNATType classifies this proxy's NAT type according to
+// sf.NATTypeDetectionMode: by default (NATTypeDetectionAuto, or an unset
+// mode) it tries checkNATTypeRemote first and falls back to
+// checkNATTypeLocal if the remote probe errors, instead of leaving the NAT
+// type at NATUnknown. NATTypeDetectionRemote disables that fallback.
+// NATTypeDetectionLocal skips the remote probe entirely. If sf.NATProbeURLs
+// is set, checkNATTypeRemote is tried against sf.natProbes' next healthy
+// probe URL rather than the single sf.NATProbeURL.
+func (sf *SnowflakeProxy) checkNATType(config webrtc.Configuration) error {
 	if sf.NATTypeForceUnrestricted {
 		currentNATTypeAccess.Lock()
 		currentNATType = NATUnrestricted
@@ -869,6 +1674,34 @@ func (sf *SnowflakeProxy) checkNATType(config webrtc.Configuration, probeURL str
 		return nil
 	}
 
+	if sf.NATTypeDetectionMode == NATTypeDetectionLocal {
+		return sf.checkNATTypeLocal()
+	}
+
+	probeURL, probeIdx := sf.NATProbeURL, -1
+	if sf.natProbes != nil {
+		probeIdx = sf.natProbes.pick()
+		probeURL = sf.natProbes.urls[probeIdx]
+	}
+	err := sf.checkNATTypeRemote(config, probeURL)
+	if sf.natProbes != nil {
+		sf.natProbes.recordResult(probeIdx, err)
+	}
+	if err == nil {
+		return nil
+	}
+	if sf.NATTypeDetectionMode == NATTypeDetectionRemote {
+		return err
+	}
+
+	log.Printf("remote NAT probe failed (%v); falling back to local RFC 5780 NAT detection", err)
+	return sf.checkNATTypeLocal()
+}
+
+// checkNATTypeRemote use probetest to determine NAT compatability by
+// attempting to connect with a known symmetric NAT. If success,
+// it is considered "unrestricted". If timeout it is considered "restricted"
+func (sf *SnowflakeProxy) checkNATTypeRemote(config webrtc.Configuration, probeURL string) error {
 	probe, err := newSignalingServer(probeURL)
 	if err != nil {
 		return fmt.Errorf("error parsing url: %w", err)
@@ -939,7 +1772,39 @@ func (sf *SnowflakeProxy) checkNATType(config webrtc.Configuration, probeURL str
 		setCurrentNATType(NATRestricted)
 	}
 
+	if sf.Metrics != nil {
+		sf.Metrics.TrackCurrentNATType(getCurrentNATType(), prevNATType)
+	}
 	log.Printf("NAT Type measurement: %v -> %v\n", prevNATType, getCurrentNATType())
 
 	return nil
 }
+
+// checkNATTypeLocal classifies this proxy's NAT type using RFC 5780
+// behavior discovery (see common/nat) against the STUN servers in
+// sf.STUNURL, for use when NATProbeURL can't be reached or
+// NATTypeDetectionMode asks for it unconditionally. It requires at least
+// one of those servers to advertise OTHER-ADDRESS; if none do, it returns
+// an error and leaves the NAT type exactly as checkNATTypeRemote left it
+// (typically NATUnknown).
+func (sf *SnowflakeProxy) checkNATTypeLocal() error {
+	prevNATType := getCurrentNATType()
+
+	behavior, _, err := nat.DiscoverNATBehaviorMulti(strings.Split(sf.STUNURL, ","), nil)
+	if err != nil {
+		return fmt.Errorf("error running local RFC 5780 NAT detection: %w", err)
+	}
+
+	if behavior.IsRestricted() {
+		setCurrentNATType(NATRestricted)
+	} else {
+		setCurrentNATType(NATUnrestricted)
+	}
+	log.Printf("Local RFC 5780 NAT detection: %v -> %v\n", prevNATType, getCurrentNATType())
+
+	if sf.Metrics != nil {
+		sf.Metrics.TrackCurrentNATType(getCurrentNATType(), prevNATType)
+	}
+
+	return nil
+}
@@ -1,44 +1,205 @@
 package snowflake_proxy
 
 import (
-	"sync/atomic"
+	"errors"
+	"sync"
+	"time"
+
+	"tgragnato.it/snowflake/common/event"
+)
+
+// ErrOverloaded is returned by tokens_t.tryGet when admission would push
+// utilization at or above tokensHighWaterFrac; unlike get, tryGet never
+// blocks waiting for capacity to free up.
+var ErrOverloaded = errors.New("snowflake proxy: admission controller overloaded")
+
+// tokensHighWaterFrac and tokensLowWaterFrac bound the utilization (the
+// larger of the concurrent-session fraction and the egress byte-rate
+// fraction) at which a tokens_t stops admitting new clients and resumes
+// ramping capacity back up, respectively. tokensRampInterval is the minimum
+// time a tokens_t waits between two ramp decisions.
+const (
+	tokensHighWaterFrac = 0.9
+	tokensLowWaterFrac  = 0.5
+	tokensRampInterval  = 10 * time.Second
 )
 
+// tokens_t is an adaptive admission controller bounding how many client
+// sessions a proxy relays concurrently. It keeps the counting-semaphore
+// shape (get/ret/count) snowflake_proxy has always used, but on top of the
+// capacity ceiling adds an egress byte-rate budget (maxBytesPerSec, fed by
+// recordBytes -- the same traffic EventMetrics.OnNewSnowflakeEvent already
+// sees via EventOnProxyStats) and AIMD ramping of capacity itself: an
+// additive increase of one slot per tokensRampInterval once a whole
+// interval stays under tokensLowWaterFrac utilization, and an immediate
+// halving the moment a whole interval stays at or above
+// tokensHighWaterFrac.
+//
+// Wiring tokens_t in as SnowflakeProxy's live admission path -- superseding
+// the plain atomic sf.tokens counter in snowflake.go, which is a separate,
+// already-shipped concern from PerClientBytesPerSec/MaxNewClientsPerMinute
+// -- is a natural follow-up, not done here.
 type tokens_t struct {
-	ch       chan struct{}
-	capacity uint
-	clients  atomic.Int64
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	capacity       int64
+	maxCapacity    int64
+	maxBytesPerSec float64
+	events         event.SnowflakeEventDispatcher
+
+	clients int64
+
+	intervalStart   time.Time
+	bytesInInterval int64
+	intervalMaxUtil float64
 }
 
-func newTokens(capacity uint) *tokens_t {
-	var ch chan struct{}
-	if capacity != 0 {
-		ch = make(chan struct{}, capacity)
+// newTokens builds a tokens_t admitting up to capacity concurrent sessions
+// (0 means unbounded, matching the original tokens_t) and, if
+// maxBytesPerSec is nonzero, gating admission on a sustained egress
+// byte-rate budget as well. events, if non-nil, receives
+// EventOnAdmissionCapacityChanged whenever the AIMD ramp changes capacity.
+func newTokens(capacity uint, maxBytesPerSec float64, events event.SnowflakeEventDispatcher) *tokens_t {
+	t := &tokens_t{
+		capacity:       int64(capacity),
+		maxCapacity:    int64(capacity),
+		maxBytesPerSec: maxBytesPerSec,
+		events:         events,
 	}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
 
-	return &tokens_t{
-		ch:       ch,
-		capacity: capacity,
-		clients:  atomic.Int64{},
+// get blocks until the controller is under its high-water mark, then admits
+// one more client.
+func (t *tokens_t) get() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tickLocked()
+	for t.admissionBlockedLocked() {
+		t.cond.Wait()
+		t.tickLocked()
 	}
+	t.clients++
 }
 
-func (t *tokens_t) get() {
-	t.clients.Add(1)
+// tryGet admits one more client without blocking, returning ErrOverloaded
+// instead if the controller is at or above its high-water mark.
+func (t *tokens_t) tryGet() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	if t.capacity != 0 {
-		t.ch <- struct{}{}
+	t.tickLocked()
+	if t.admissionBlockedLocked() {
+		return ErrOverloaded
 	}
+	t.clients++
+	return nil
 }
 
+// ret returns one client's slot to the controller, waking any get callers
+// blocked waiting for room.
 func (t *tokens_t) ret() {
-	t.clients.Add(-1)
+	t.mu.Lock()
+	t.clients--
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
 
-	if t.capacity != 0 {
-		<-t.ch
+// count returns the number of clients currently admitted.
+func (t *tokens_t) count() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.clients
+}
+
+// recordBytes folds n more relayed bytes into the controller's current
+// egress-rate sample, feeding the maxBytesPerSec admission gate and the
+// AIMD ramp alongside concurrent-session pressure. Intended to be called
+// from EventMetrics.OnNewSnowflakeEvent's EventOnProxyStats case with the
+// inbound and outbound byte counts it already receives.
+func (t *tokens_t) recordBytes(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tickLocked()
+	t.bytesInInterval += n
+}
+
+// admissionBlockedLocked reports whether the controller should refuse (or
+// have get block) one more client: the capacity ceiling is full, or
+// utilization is already at or above tokensHighWaterFrac. Caller must hold
+// t.mu.
+func (t *tokens_t) admissionBlockedLocked() bool {
+	if t.capacity > 0 && t.clients >= t.capacity {
+		return true
 	}
+	return t.utilizationLocked() >= tokensHighWaterFrac
 }
 
-func (t *tokens_t) count() int64 {
-	return t.clients.Load()
+// utilizationLocked returns the larger of the concurrent-session fraction
+// (clients/capacity) and the egress byte-rate fraction observed so far this
+// interval (bytesInInterval/(maxBytesPerSec*elapsed)). Either term is 0 if
+// its corresponding limit (capacity, maxBytesPerSec) is unset. Caller must
+// hold t.mu.
+func (t *tokens_t) utilizationLocked() float64 {
+	var util float64
+	if t.capacity > 0 {
+		util = float64(t.clients) / float64(t.capacity)
+	}
+	if t.maxBytesPerSec > 0 {
+		if elapsed := time.Since(t.intervalStart).Seconds(); elapsed > 0 {
+			if byteFrac := float64(t.bytesInInterval) / (t.maxBytesPerSec * elapsed); byteFrac > util {
+				util = byteFrac
+			}
+		}
+	}
+	return util
+}
+
+// tickLocked folds the current utilization into this interval's running
+// worst case and, once a full tokensRampInterval has elapsed, applies the
+// AIMD ramp and starts a fresh interval. A controller with neither a
+// capacity ceiling nor a byte-rate budget never blocks, so it has nothing
+// to ramp and tickLocked is a no-op. Caller must hold t.mu.
+func (t *tokens_t) tickLocked() {
+	if t.capacity == 0 && t.maxBytesPerSec == 0 {
+		return
+	}
+	if t.intervalStart.IsZero() {
+		t.intervalStart = time.Now()
+		return
+	}
+
+	if util := t.utilizationLocked(); util > t.intervalMaxUtil {
+		t.intervalMaxUtil = util
+	}
+	if time.Since(t.intervalStart) < tokensRampInterval {
+		return
+	}
+
+	prevCapacity := t.capacity
+	switch {
+	case t.capacity > 0 && t.intervalMaxUtil >= tokensHighWaterFrac:
+		t.capacity /= 2
+		if t.capacity < 1 {
+			t.capacity = 1
+		}
+	case t.capacity > 0 && t.capacity < t.maxCapacity && t.intervalMaxUtil < tokensLowWaterFrac:
+		t.capacity++
+	}
+	if t.capacity != prevCapacity {
+		t.cond.Broadcast()
+		if t.events != nil {
+			t.events.OnNewSnowflakeEvent(event.EventOnAdmissionCapacityChanged{
+				Capacity: t.capacity,
+				Clients:  t.clients,
+			})
+		}
+	}
+
+	t.intervalStart = time.Now()
+	t.bytesInInterval = 0
+	t.intervalMaxUtil = 0
 }
@@ -1,14 +1,17 @@
 package snowflake_proxy
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"tgragnato.it/snowflake/common/event"
 )
 
 func TestTokens(t *testing.T) {
 	Convey("Tokens counter test", t, func() {
-		tokens := newTokens()
+		tokens := newTokens(0, 0, nil)
 		So(tokens.count(), ShouldEqual, 0)
 		for i := 0; i < 20; i++ {
 			tokens.get()
@@ -18,3 +21,126 @@ func TestTokens(t *testing.T) {
 		So(tokens.count(), ShouldEqual, 19)
 	})
 }
+
+func TestTokensConcurrentGetRet(t *testing.T) {
+	Convey("Given a tokens_t capped at 8 concurrent clients", t, func() {
+		tokens := newTokens(8, 0, nil)
+
+		Convey("many goroutines racing get/ret never push count past capacity or below zero", func() {
+			const goroutines = 50
+			const iterations = 200
+
+			// So isn't safe to call concurrently from many goroutines, so
+			// each goroutine records its own out-of-bounds observations
+			// and every assertion runs back on the test goroutine once
+			// they're done.
+			overCapacity := make([]bool, goroutines)
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < iterations; j++ {
+						tokens.get()
+						if tokens.count() > 8 {
+							overCapacity[i] = true
+						}
+						tokens.ret()
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			for _, over := range overCapacity {
+				So(over, ShouldBeFalse)
+			}
+			So(tokens.count(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestTokensCapacity(t *testing.T) {
+	Convey("Given a tokens_t capped at 2 concurrent clients", t, func() {
+		tokens := newTokens(2, 0, nil)
+
+		Convey("tryGet admits up to capacity and then reports overload", func() {
+			So(tokens.tryGet(), ShouldBeNil)
+			So(tokens.tryGet(), ShouldBeNil)
+			So(tokens.tryGet(), ShouldEqual, ErrOverloaded)
+
+			tokens.ret()
+			So(tokens.tryGet(), ShouldBeNil)
+		})
+	})
+}
+
+// recordingDispatcher collects every event it's given, for asserting on an
+// AIMD trajectory without standing up a full event.Dispatcher.
+type recordingDispatcher struct {
+	events []event.SnowflakeEvent
+}
+
+func (d *recordingDispatcher) OnNewSnowflakeEvent(e event.SnowflakeEvent) {
+	d.events = append(d.events, e)
+}
+
+func (d *recordingDispatcher) AddSnowflakeEventListener(event.SnowflakeEventReceiver)    {}
+func (d *recordingDispatcher) RemoveSnowflakeEventListener(event.SnowflakeEventReceiver) {}
+
+func (d *recordingDispatcher) capacities() []int64 {
+	var got []int64
+	for _, e := range d.events {
+		if c, ok := e.(event.EventOnAdmissionCapacityChanged); ok {
+			got = append(got, c.Capacity)
+		}
+	}
+	return got
+}
+
+// tickAfter backdates tokens' current interval so the next tickLocked call
+// (from get/tryGet/ret/recordBytes) treats a full tokensRampInterval as
+// having elapsed, without the test itself sleeping.
+func tickAfter(tokens *tokens_t, ago time.Duration) {
+	tokens.mu.Lock()
+	tokens.intervalStart = time.Now().Add(-ago)
+	tokens.mu.Unlock()
+}
+
+func TestTokensAIMDRampDown(t *testing.T) {
+	Convey("Given a tokens_t at capacity 4 under sustained byte-rate overload", t, func() {
+		dispatcher := &recordingDispatcher{}
+		tokens := newTokens(4, 100, dispatcher)
+
+		tokens.recordBytes(0)    // starts the first interval
+		tokens.recordBytes(1000) // accumulates within the (still-open) interval
+
+		tickAfter(tokens, tokensRampInterval)
+		tokens.recordBytes(0) // ticks past the interval boundary, evaluating the ramp against the 1000 bytes above
+
+		Convey("capacity is halved", func() {
+			So(tokens.count(), ShouldEqual, 0)
+			caps := dispatcher.capacities()
+			So(len(caps), ShouldBeGreaterThan, 0)
+			So(caps[len(caps)-1], ShouldEqual, int64(2))
+		})
+	})
+}
+
+func TestTokensAIMDRampUp(t *testing.T) {
+	Convey("Given a tokens_t at capacity 2 with room to grow back to 4", t, func() {
+		dispatcher := &recordingDispatcher{}
+		tokens := newTokens(2, 0, dispatcher)
+		tokens.capacity = 2
+		tokens.maxCapacity = 4
+
+		tokens.recordBytes(0) // starts the first interval
+		tickAfter(tokens, tokensRampInterval)
+		tokens.recordBytes(0) // idle: well under tokensLowWaterFrac
+
+		Convey("capacity grows by one", func() {
+			caps := dispatcher.capacities()
+			So(len(caps), ShouldBeGreaterThan, 0)
+			So(caps[len(caps)-1], ShouldEqual, int64(3))
+		})
+	})
+}
@@ -12,6 +12,20 @@ type bytesLogger interface {
 	GetStat() (in int64, out int64)
 }
 
+// sessionAwareLogger is implemented by bytesLogger backends, such as
+// promBytesLogger, that also want to be notified of Turbo Tunnel session
+// lifecycle -- not every bytesLogger needs to track this, so
+// datachannelHandler only calls these methods when sf.bytesLogger
+// implements the interface.
+type sessionAwareLogger interface {
+	// SessionStarted is called once a Turbo Tunnel client session has been
+	// joined for the first time.
+	SessionStarted(natType string)
+	// SessionEnded is called once a Turbo Tunnel client session's last
+	// DataChannel has closed, with its final totals.
+	SessionEnded(bytesIn, bytesOut int64, duration time.Duration, natType string)
+}
+
 // bytesNullLogger Default bytesLogger does nothing.
 type bytesNullLogger struct{}
 
@@ -84,3 +98,47 @@ func (b *bytesSyncLogger) GetStat() (in int64, out int64) {
 }
 
 func formatTraffic(amount int64) (value int64, unit string) { return amount / 1000, "KB" }
+
+// promBytesLogger is a bytesLogger backed by a Metrics collector: it embeds
+// a bytesSyncLogger so that periodicProxyStats's polled GetStat/summary
+// logging keeps working unchanged, while also feeding every byte and every
+// Turbo Tunnel session straight into Prometheus counters, a gauge, and
+// histograms as they happen.
+type promBytesLogger struct {
+	*bytesSyncLogger
+	metrics *Metrics
+}
+
+// newPromBytesLogger returns a bytesLogger that reports to metrics, for use
+// in place of bytesSyncLogger when the standalone proxy's --metrics-addr
+// flag (or an embedder's SnowflakeProxy.Metrics field) is set.
+func newPromBytesLogger(metrics *Metrics) *promBytesLogger {
+	return &promBytesLogger{bytesSyncLogger: newBytesSyncLogger(), metrics: metrics}
+}
+
+// AddOutbound records amount with both the embedded bytesSyncLogger and the
+// Prometheus outbound traffic counter.
+func (b *promBytesLogger) AddOutbound(amount int64) {
+	b.bytesSyncLogger.AddOutbound(amount)
+	b.metrics.TrackOutBoundTraffic(amount)
+}
+
+// AddInbound records amount with both the embedded bytesSyncLogger and the
+// Prometheus inbound traffic counter.
+func (b *promBytesLogger) AddInbound(amount int64) {
+	b.bytesSyncLogger.AddInbound(amount)
+	b.metrics.TrackInBoundTraffic(amount)
+}
+
+// SessionStarted increments the active-sessions gauge for a newly joined
+// Turbo Tunnel client session.
+func (b *promBytesLogger) SessionStarted(natType string) {
+	b.metrics.TrackSessionStarted(natType)
+}
+
+// SessionEnded records a finished session's total byte counts and lifetime
+// in the per-session histograms, labeled by natType, and decrements the
+// active-sessions gauge.
+func (b *promBytesLogger) SessionEnded(bytesIn, bytesOut int64, duration time.Duration, natType string) {
+	b.metrics.TrackSessionEnded(bytesIn, bytesOut, duration, natType)
+}
@@ -11,8 +11,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/rs/zerolog"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/ptutil/safelog"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/event"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/otelconfig"
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/util"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/version"
 	sf "gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/proxy/lib"
 )
@@ -26,6 +29,7 @@ func main() {
 	stunURL := flag.String("stun", sf.DefaultSTUNURL, "Comma-separated STUN server `URL`s that this proxy will use will use to, among some other things, determine its public IP address")
 	logFilename := flag.String("log", "", "log `filename`. If not specified, logs will be output to stderr (console).")
 	rawBrokerURL := flag.String("broker", sf.DefaultBrokerURL, "The `URL` of the broker server that the proxy will be using to find clients")
+	httpProxyURL := flag.String("proxy", "", "The `URL` of an HTTP/HTTPS CONNECT proxy to use for broker rendezvous and NAT probe requests (e.g. \"http://proxy.example.com:3128\").\nIf unset, falls back to the HTTPS_PROXY/ALL_PROXY/NO_PROXY environment variables.\nDoes not apply to STUN/TURN traffic, which an HTTP CONNECT proxy cannot carry.")
 	unsafeLogging := flag.Bool("unsafe-logging", false, "keep IP addresses and other sensitive info in the logs")
 	logLocalTime := flag.Bool("log-local-time", false, "Use local time for logging (default: UTC)")
 	keepLocalAddresses := flag.Bool("keep-local-addresses", false, "keep local LAN address ICE candidates.\nThis is usually pointless because Snowflake clients don't usually reside on the same local network as the proxy.")
@@ -40,12 +44,23 @@ func main() {
 	summaryInterval := flag.Duration("summary-interval", time.Hour,
 		"the time interval between summary log outputs, 0s disables summaries. Valid time units are \"s\", \"m\", \"h\".")
 	disableStatsLogger := flag.Bool("disable-stats-logger", false, "disable the exposing mechanism for stats using logs")
+	statsFilename := flag.String("stats-file", "", "`filename` to periodically persist lifetime proxy totals and a rolling 24h window to, and reload them from at startup. If unset, lifetime stats are kept in memory only.")
 	enableMetrics := flag.Bool("metrics", false, "enable the exposing mechanism for stats using metrics")
 	metricsAddress := flag.String("metrics-address", "localhost", "set listen `address` for metrics service")
 	metricsPort := flag.Int("metrics-port", 9999, "set port for the metrics service")
+	metricsInstanceLabel := flag.String("metrics-instance-label", "", "if set, attach an \"instance\" label with this value to every exported metric, to distinguish this proxy from others when running a pool of them")
 	verboseLogging := flag.Bool("verbose", false, "increase log verbosity")
 	ephemeralPortsRangeFlag := flag.String("ephemeral-ports-range", "", "Set the `range` of ports used for client connections (format:\"<min>:<max>\").\nIf omitted, the ports will be chosen automatically.")
+	sdpRestrictICEToUDP := flag.Bool("sdp-restrict-ice-udp", false, "drop TCP ICE candidates from the answer SDP sent to the broker")
+	natMappingsCommas := flag.String("nat-mapping", "", "comma-separated list of 1:1 NAT IP mappings (\"external\" or \"internal=external\") to advertise as SDP host candidates, for proxies behind a static NAT")
 	versionFlag := flag.Bool("version", false, "display version info to stderr and quit")
+	logFormat := flag.String("log-format", "text", "structured log output format for this process's own startup/lifecycle logging: \"text\" or \"json\"")
+	eventLogFormat := flag.String("event-log-format", "text", "output format for the proxy event log (see \"log\"): \"text\" for human-readable lines, or \"json\" for one JSON object per event of every type, for piping into journald/Loki/Vector")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP collector `endpoint` (host:port) to export metrics and traces to.\nWhen set (and -metrics is not, since they're independent sinks for the same underlying counters), this proxy builds its own OTLP meter/tracer provider instead of exposing a scrape endpoint.")
+	otlpHeaders := flag.String("otlp-headers", "", "comma-separated key=value headers to send with every OTLP export request, e.g. for collector authentication")
+	otlpProtocol := flag.String("otlp-protocol", "http", "OTLP wire protocol: \"http\" or \"grpc\"")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "disable TLS on the OTLP exporter connection")
+	otlpCompression := flag.String("otlp-compression", "", "OTLP export compression: \"gzip\" or \"\" (none)")
 
 	var ephemeralPortsRange []uint16 = []uint16{0, 0}
 
@@ -60,11 +75,17 @@ func main() {
 		log.Fatalf("poll-interval must be >= %v", minPollInterval)
 	}
 
-	if *outboundAddress != "" && *keepLocalAddresses {
-		log.Fatal("Cannot keep local address candidates when outbound address is specified")
+	if (*outboundAddress != "" || *natMappingsCommas != "") && *keepLocalAddresses {
+		log.Fatal("Cannot keep local address candidates when outbound address or NAT mapping is specified")
 	}
 
 	eventLogger := event.NewSnowflakeEventDispatcher()
+	sinks := event.NewMultiSink()
+
+	parsedOTLPHeaders, err := otelconfig.ParseHeaders(*otlpHeaders)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	if *ephemeralPortsRangeFlag != "" {
 		ephemeralPortsRangeParts := strings.Split(*ephemeralPortsRangeFlag, ":")
@@ -97,21 +118,33 @@ func main() {
 		Capacity:           uint(*capacity),
 		STUNURL:            *stunURL,
 		BrokerURL:          *rawBrokerURL,
+		HTTPProxyURL:       *httpProxyURL,
 		KeepLocalAddresses: *keepLocalAddresses,
 		RelayURL:           *defaultRelayURL,
 		NATProbeURL:        *probeURL,
 		OutboundAddress:    *outboundAddress,
+		NAT1To1Mappings:    util.ParseNAT1To1Mappings(*natMappingsCommas),
 		EphemeralMinPort:   ephemeralPortsRange[0],
 		EphemeralMaxPort:   ephemeralPortsRange[1],
 
 		NATTypeMeasurementInterval: *NATTypeMeasurementInterval,
 		EventDispatcher:            eventLogger,
+		Sinks:                      sinks,
 
 		RelayDomainNamePattern:          *allowedRelayHostNamePattern,
 		AllowProxyingToPrivateAddresses: *allowProxyingToPrivateAddresses,
 		AllowNonTLSRelay:                *allowNonTLSRelay,
 
 		SummaryInterval: *summaryInterval,
+		StatsFilename:   *statsFilename,
+
+		SDPRestrictICEToUDP: *sdpRestrictICEToUDP,
+
+		OTLPEndpoint:    *otlpEndpoint,
+		OTLPHeaders:     parsedOTLPHeaders,
+		OTLPProtocol:    *otlpProtocol,
+		OTLPInsecure:    *otlpInsecure,
+		OTLPCompression: *otlpCompression,
 	}
 
 	var logOutput = io.Discard
@@ -147,24 +180,77 @@ func main() {
 		log.SetOutput(&safelog.LogScrubber{Output: logOutput})
 	}
 
-	proxyEventLogger := sf.NewProxyEventLogger(eventlogOutput, *disableStatsLogger)
-	eventLogger.AddSnowflakeEventListener(proxyEventLogger)
+	// structuredLogger only covers this file's own startup/lifecycle
+	// logging (below). The much larger set of log.Printf call sites
+	// throughout proxy/lib (datachannelHandler, runSession, and friends,
+	// across ~20 files) keeps using the standard log package configured
+	// above; threading a context-carried zerolog.Logger through every one
+	// of those call sites is a broader refactor than this flag covers.
+	var zerologOutput io.Writer = logOutput
+	if !*unsafeLogging {
+		zerologOutput = &safelog.LogScrubber{Output: logOutput}
+	}
+	switch *logFormat {
+	case "text":
+		zerologOutput = zerolog.ConsoleWriter{Out: zerologOutput, TimeFormat: time.RFC3339}
+	case "json":
+		// zerolog's default writer already emits line-delimited JSON.
+	default:
+		log.Fatalf("unknown log format %q (want \"text\" or \"json\")", *logFormat)
+	}
+	structuredLogger := zerolog.New(zerologOutput).With().Timestamp().Logger()
+
+	var eventLogJSON bool
+	switch *eventLogFormat {
+	case "text":
+	case "json":
+		eventLogJSON = true
+	default:
+		log.Fatalf("unknown event log format %q (want \"text\" or \"json\")", *eventLogFormat)
+	}
+	proxyEventLogger := sf.NewProxyEventLogger(eventlogOutput, eventLogJSON)
+	eventLoggerSink := event.SinkConfig{Receiver: proxyEventLogger, Mode: event.DeliverDropOldest}
+	if !eventLogJSON {
+		// The text format is a console aid, not a full event log: only
+		// print the handful of events operators have historically cared
+		// about watching live, the same set this logger used to hardcode
+		// into its own type switch.
+		// https://gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/-/issues/40310
+		// https://gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/-/issues/40413
+		eventLoggerSink.Allow = []string{
+			"EventOnProxyStarting",
+			"EventOnProxyStats",
+			"EventOnProxyLifetimeStats",
+			"EventOnCurrentNATTypeDetermined",
+		}
+	}
+	if *disableStatsLogger {
+		eventLoggerSink.Deny = []string{"EventOnProxyStats", "EventOnProxyLifetimeStats"}
+	}
+	sinks.AddSink(eventLoggerSink)
 
 	if *enableMetrics {
-		metrics := sf.NewMetrics()
+		var constLabels map[string]string
+		if *metricsInstanceLabel != "" {
+			constLabels = map[string]string{"instance": *metricsInstanceLabel}
+		}
+		metrics := sf.NewMetrics(constLabels)
 
 		err := metrics.Start(net.JoinHostPort(*metricsAddress, strconv.Itoa(*metricsPort)))
 		if err != nil {
 			log.Fatalf("could not enable metrics: %v", err)
 		}
 
-		eventLogger.AddSnowflakeEventListener(sf.NewEventMetrics(metrics))
+		sinks.AddSink(event.SinkConfig{Receiver: sf.NewEventMetrics(metrics), Mode: event.DeliverSync})
+		// Also feed per-byte and per-session metrics (active sessions,
+		// session byte/lifetime histograms) straight from the bytesLogger,
+		// instead of only the periodic summary EventOnProxyStats covers.
+		proxy.Metrics = metrics
 	}
 
-	log.Printf("snowflake-proxy %s\n", version.GetVersion())
+	structuredLogger.Info().Str("version", version.GetVersion()).Msg("starting snowflake-proxy")
 
-	err := proxy.Start()
-	if err != nil {
+	if err := proxy.Start(); err != nil {
 		log.Fatal(err)
 	}
 }
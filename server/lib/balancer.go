@@ -0,0 +1,228 @@
+package snowflake_server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/turbotunnel"
+)
+
+const pconnMetricNamespace = "snowflake_server"
+
+// Balancer assigns each ClientID to one of the pconns currently in use,
+// so httpHandler can spread KCP processing across them. Assign is
+// called from lookupPacketConn, once per turbotunnelMode invocation (so
+// once per WebSocket or WebTransport stream's first packet), and must
+// be safe for concurrent use. pconns is handler.pconns as it stood at
+// call time; implementations that inspect per-pconn load (QueueDepth,
+// SessionCount) see a live, if momentarily racy, picture.
+type Balancer interface {
+	Assign(clientID turbotunnel.ClientID, pconns []*turbotunnel.QueuePacketConn) int
+}
+
+// hmacBalancer is the original lookupPacketConn behavior: clientID is
+// HMACed under a secret key (so an adversary who can predict the
+// assignment can't use it to concentrate sessions on one pconn) and
+// reduced mod len(pconns). It spreads ClientIDs uniformly, but takes no
+// notice of how loaded any individual pconn actually is.
+type hmacBalancer struct {
+	key []byte
+}
+
+// newHMACBalancer returns the default Balancer, keyed by key (expected
+// to be httpHandler.clientIDLookupKey).
+func newHMACBalancer(key []byte) *hmacBalancer {
+	return &hmacBalancer{key: key}
+}
+
+func (b *hmacBalancer) Assign(clientID turbotunnel.ClientID, pconns []*turbotunnel.QueuePacketConn) int {
+	s := hmac.New(sha256.New, b.key).Sum(clientID[:])
+	return int(binary.LittleEndian.Uint64(s) % uint64(len(pconns)))
+}
+
+// virtualNodesPerPconn is how many positions each pconn occupies on a
+// consistentHashBalancer's ring. A higher count spreads the ring more
+// evenly across pconns at the cost of a larger ring to search.
+const virtualNodesPerPconn = 150
+
+// ringEntry is one virtual node on a consistentHashBalancer's ring.
+type ringEntry struct {
+	hash uint64
+	idx  int
+}
+
+// consistentHashBalancer assigns ClientIDs to pconns by hashing onto a
+// ring of virtual nodes (Karger et al.'s consistent hashing), so
+// resizing the pconns slice only reshuffles the fraction of ClientIDs
+// that land near the boundary being added or removed, unlike
+// hmacBalancer's mod-N, where every resize reshuffles nearly
+// everything. On top of the plain ring walk, it applies bounded-load
+// consistent hashing (Mirrokni, Thorup & Zadimoghaddam): if the first
+// ring position's pconn already carries more than (1+Epsilon) times
+// the average SessionCount across all pconns, it spills to the next
+// ring position instead, and the one after that, and so on, so a
+// skewed ClientID population can't pin a disproportionate share of
+// sessions onto one pconn the way a pure hash ring would.
+type consistentHashBalancer struct {
+	// Epsilon is the allowed slack over the average SessionCount
+	// before Assign spills to the next ring position. 0.25 permits a
+	// pconn to run 25% over the fleet average before being passed
+	// over.
+	Epsilon float64
+
+	lock     sync.Mutex
+	builtFor int // len(pconns) the current ring was built for, or -1
+	ring     []ringEntry
+}
+
+// newConsistentHashBalancer returns a Balancer that spills to the next
+// ring position once a candidate pconn's SessionCount exceeds (1+
+// epsilon) times the fleet average.
+func newConsistentHashBalancer(epsilon float64) *consistentHashBalancer {
+	return &consistentHashBalancer{Epsilon: epsilon, builtFor: -1}
+}
+
+// buildLocked rebuilds b.ring for n pconns. b.lock must be held.
+func (b *consistentHashBalancer) buildLocked(n int) {
+	ring := make([]ringEntry, 0, n*virtualNodesPerPconn)
+	for i := 0; i < n; i++ {
+		for v := 0; v < virtualNodesPerPconn; v++ {
+			var buf [8]byte
+			binary.LittleEndian.PutUint32(buf[0:4], uint32(i))
+			binary.LittleEndian.PutUint32(buf[4:8], uint32(v))
+			h := sha256.Sum256(buf[:])
+			ring = append(ring, ringEntry{hash: binary.LittleEndian.Uint64(h[:8]), idx: i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	b.ring = ring
+	b.builtFor = n
+}
+
+func (b *consistentHashBalancer) Assign(clientID turbotunnel.ClientID, pconns []*turbotunnel.QueuePacketConn) int {
+	n := len(pconns)
+	if n <= 1 {
+		return 0
+	}
+
+	b.lock.Lock()
+	if b.builtFor != n {
+		b.buildLocked(n)
+	}
+	ring := b.ring
+	b.lock.Unlock()
+
+	total := 0
+	for _, p := range pconns {
+		total += p.SessionCount()
+	}
+	limit := (1 + b.Epsilon) * float64(total) / float64(n)
+
+	h := sha256.Sum256(clientID[:])
+	target := binary.LittleEndian.Uint64(h[:8])
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= target })
+
+	for i := 0; i < len(ring); i++ {
+		entry := ring[(start+i)%len(ring)]
+		if i == len(ring)-1 || float64(pconns[entry.idx].SessionCount()) <= limit {
+			return entry.idx
+		}
+	}
+	return ring[start%len(ring)].idx
+}
+
+// PconnGauges returns Prometheus collectors reporting QueueDepth and
+// SessionCount for every pconn handler currently has, labeled by pconn
+// index, with constLabels attached the same way
+// sinks.NewPrometheusReceiver tags its own so an operator running a
+// pool of servers can tell instances apart. Call it again and
+// re-register after a Rescale, since indices (and which pconn they
+// point to) can change.
+func (handler *httpHandler) PconnGauges(constLabels prometheus.Labels) []prometheus.Collector {
+	handler.pconnsLock.RLock()
+	defer handler.pconnsLock.RUnlock()
+
+	collectors := make([]prometheus.Collector, 0, len(handler.pconns)*2)
+	for i, pconn := range handler.pconns {
+		pconn := pconn
+		labels := prometheus.Labels{"pconn": strconv.Itoa(i)}
+		for k, v := range constLabels {
+			labels[k] = v
+		}
+		collectors = append(collectors,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace:   pconnMetricNamespace,
+				Name:        "pconn_queue_depth",
+				Help:        "Packets currently queued in a pconn's incoming ring.",
+				ConstLabels: labels,
+			}, func() float64 { return float64(pconn.QueueDepth()) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace:   pconnMetricNamespace,
+				Name:        "pconn_session_count",
+				Help:        "Distinct ClientIDs currently carrying an open outgoing queue on a pconn, a proxy for its active session count.",
+				ConstLabels: labels,
+			}, func() float64 { return float64(pconn.SessionCount()) }),
+		)
+	}
+	return collectors
+}
+
+// Rescale grows or shrinks handler's pconns slice to n instances
+// without restarting. Growing starts new QueuePacketConns that are
+// immediately available to the Balancer. Shrinking removes the
+// trailing instances from the Balancer's view right away -- no new
+// ClientID is assigned to them past this call -- and closes each one
+// in the background once its SessionCount reaches zero or drainTimeout
+// elapses, whichever comes first.
+//
+// Rescale cannot migrate a live KCP session from a removed pconn to a
+// surviving one: kcp-go's UDPSession is bound to the net.PacketConn it
+// was accepted on, with no supported way to rebind it. A session still
+// open on a removed pconn when drainTimeout elapses is simply cut off,
+// the same as if that pconn's listener had crashed.
+func (handler *httpHandler) Rescale(n int, localAddr net.Addr, mtu int, drainTimeout time.Duration) {
+	if n <= 0 {
+		return
+	}
+
+	handler.pconnsLock.Lock()
+	current := handler.pconns
+	var removed []*turbotunnel.QueuePacketConn
+	switch {
+	case n > len(current):
+		grown := make([]*turbotunnel.QueuePacketConn, len(current), n)
+		copy(grown, current)
+		for i := len(current); i < n; i++ {
+			grown = append(grown, turbotunnel.NewQueuePacketConn(localAddr, clientMapTimeout, mtu))
+		}
+		handler.pconns = grown
+	case n < len(current):
+		removed = append(removed, current[n:]...)
+		handler.pconns = current[:n:n]
+	}
+	handler.pconnsLock.Unlock()
+
+	for _, pconn := range removed {
+		go drainAndClose(pconn, drainTimeout)
+	}
+}
+
+// drainAndClose polls pconn's SessionCount until it reaches zero or
+// drainTimeout elapses, then closes pconn.
+func drainAndClose(pconn *turbotunnel.QueuePacketConn, drainTimeout time.Duration) {
+	deadline := time.Now().Add(drainTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for pconn.SessionCount() > 0 && time.Now().Before(deadline) {
+		<-ticker.C
+	}
+	pconn.Close()
+}
@@ -0,0 +1,114 @@
+package snowflake_server
+
+import (
+	"container/list"
+	"net"
+	"sync"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/turbotunnel"
+)
+
+// clientIDMapEntry is the bookkeeping kept for a single ClientID: the
+// most recently reported address for it, and how many WebSocket or
+// WebTransport streams are currently attached to its session.
+type clientIDMapEntry struct {
+	clientID      turbotunnel.ClientID
+	addr          net.Addr
+	activeStreams int
+}
+
+// clientIDMap is a capacity-bounded, least-recently-set map from
+// ClientID to net.Addr, backing the package-level clientIDAddrMap. It
+// also tracks how many concurrent streams are open per ClientID, so
+// turbotunnelMode can cap that count with AcquireStream/ReleaseStream
+// and bound memory and KCP work during a flood of connections
+// presenting the same (stolen or brute-forced) ClientID.
+type clientIDMap struct {
+	lock     sync.Mutex
+	capacity int
+	entries  map[turbotunnel.ClientID]*list.Element // → *clientIDMapEntry
+	order    *list.List                             // front = most recently touched
+}
+
+// newClientIDMap creates a clientIDMap that holds at most capacity
+// entries, evicting the least recently touched entry once it's full. A
+// capacity of 0 means unbounded.
+func newClientIDMap(capacity int) *clientIDMap {
+	return &clientIDMap{
+		capacity: capacity,
+		entries:  make(map[turbotunnel.ClientID]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// entryLocked returns the entry for clientID, creating one (and
+// evicting the least recently touched entry, if the map is full) when
+// it doesn't already exist. m.lock must be held.
+func (m *clientIDMap) entryLocked(clientID turbotunnel.ClientID) *clientIDMapEntry {
+	if elem, ok := m.entries[clientID]; ok {
+		m.order.MoveToFront(elem)
+		return elem.Value.(*clientIDMapEntry)
+	}
+
+	if m.capacity > 0 && len(m.entries) >= m.capacity {
+		if oldest := m.order.Back(); oldest != nil {
+			m.order.Remove(oldest)
+			delete(m.entries, oldest.Value.(*clientIDMapEntry).clientID)
+		}
+	}
+
+	entry := &clientIDMapEntry{clientID: clientID}
+	m.entries[clientID] = m.order.PushFront(entry)
+	return entry
+}
+
+// Set records addr as the most recent address seen for clientID.
+func (m *clientIDMap) Set(clientID turbotunnel.ClientID, addr net.Addr) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.entryLocked(clientID).addr = addr
+}
+
+// Get returns the most recently Set address for clientID, if any.
+func (m *clientIDMap) Get(clientID turbotunnel.ClientID) (net.Addr, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	elem, ok := m.entries[clientID]
+	if !ok {
+		return nil, false
+	}
+	return elem.Value.(*clientIDMapEntry).addr, true
+}
+
+// AcquireStream admits one more concurrent stream for clientID unless
+// doing so would exceed maxStreamsPerClientID, in which case it admits
+// nothing and returns false. maxStreamsPerClientID <= 0 means
+// unlimited. Every call that returns true must be matched with a call
+// to ReleaseStream once that stream ends.
+func (m *clientIDMap) AcquireStream(clientID turbotunnel.ClientID, maxStreamsPerClientID int) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry := m.entryLocked(clientID)
+	if maxStreamsPerClientID > 0 && entry.activeStreams >= maxStreamsPerClientID {
+		return false
+	}
+	entry.activeStreams++
+	return true
+}
+
+// ReleaseStream returns one concurrent stream slot previously granted
+// by a successful AcquireStream call for clientID.
+func (m *clientIDMap) ReleaseStream(clientID turbotunnel.ClientID) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	elem, ok := m.entries[clientID]
+	if !ok {
+		return
+	}
+	if entry := elem.Value.(*clientIDMapEntry); entry.activeStreams > 0 {
+		entry.activeStreams--
+	}
+}
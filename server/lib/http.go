@@ -3,10 +3,8 @@ package snowflake_server
 import (
 	"bufio"
 	"bytes"
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/binary"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
@@ -16,6 +14,8 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/encapsulation"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/turbotunnel"
 	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/websocketconn"
@@ -52,24 +52,56 @@ var upgrader = websocket.Upgrader{
 // attached to the WebSocket connection and every session.
 var clientIDAddrMap = newClientIDMap(clientIDAddrMapCapacity)
 
+// httpHandler is a net/http (and, via ServeWebTransport, HTTP/3) handler
+// that exchanges encapsulated packets with proxies over whichever
+// stream-oriented transport they connect with: a classic WebSocket
+// upgrade through ServeHTTP, or a WebTransport session through
+// ServeWebTransport. Both adapters terminate in turbotunnelMode, which
+// is transport-agnostic -- it only needs a net.Conn -- so adding a new
+// transport means adding a new adapter method that produces one, not
+// touching the KCP layer underneath pconns.
 type httpHandler struct {
-	// pconns is the adapter layer between stream-oriented WebSocket
-	// connections and the packet-oriented KCP layer. There are multiple of
-	// these, corresponding to the multiple kcp.ServeConn in
-	// Transport.Listen. Clients are assigned to a particular instance by a
-	// hash of ClientID, indexed by a hash of the ClientID, in order to
-	// distribute KCP processing load across CPU cores.
-	pconns []*turbotunnel.QueuePacketConn
-
-	// clientIDLookupKey is a secret key used to tweak the hash-based
-	// assignement of ClientID to pconn, in order to avoid manipulation of
-	// hash assignments.
+	// pconns is the adapter layer between stream-oriented connections and
+	// the packet-oriented KCP layer. There are multiple of these,
+	// corresponding to the multiple kcp.ServeConn in Transport.Listen.
+	// Clients are assigned to a particular instance by balancer, in
+	// order to distribute KCP processing load across CPU cores.
+	// pconnsLock guards pconns, since Rescale can grow or shrink it
+	// while lookupPacketConn is reading it concurrently.
+	pconnsLock sync.RWMutex
+	pconns     []*turbotunnel.QueuePacketConn
+
+	// balancer assigns each ClientID to an index into pconns. Defaults
+	// to an hmacBalancer keyed by clientIDLookupKey.
+	balancer Balancer
+
+	// clientIDLookupKey is a secret key used by the default Balancer to
+	// tweak the hash-based assignment of ClientID to pconn, in order to
+	// avoid manipulation of hash assignments.
 	clientIDLookupKey []byte
+
+	// rateLimiter, when non-nil, is consulted by turbotunnelMode for
+	// every incoming encapsulated packet, keyed by ClientID and by
+	// source subnet. A nil rateLimiter disables rate limiting.
+	rateLimiter RateLimiter
+
+	// maxStreamsPerClientID bounds how many concurrent WebSocket or
+	// WebTransport streams turbotunnelMode will admit for a single
+	// ClientID, enforced through clientIDAddrMap's AcquireStream. A
+	// value <= 0 means unlimited.
+	maxStreamsPerClientID int
 }
 
-// newHTTPHandler creates a new http.Handler that exchanges encapsulated packets
-// over incoming WebSocket connections.
-func newHTTPHandler(localAddr net.Addr, numInstances int, mtu int) *httpHandler {
+// newHTTPHandler creates a new http.Handler that exchanges encapsulated
+// packets over incoming WebSocket or WebTransport connections.
+// rateLimiter may be nil to disable rate limiting; maxStreamsPerClientID
+// <= 0 means no cap on concurrent streams per ClientID. balancer may be
+// nil, in which case handler uses the original hmacBalancer behavior
+// (pass a *consistentHashBalancer for bounded-load consistent hashing
+// instead). All four are meant to be loaded from the embedder's own
+// server configuration and passed in here, the same way localAddr,
+// numInstances, and mtu already are.
+func newHTTPHandler(localAddr net.Addr, numInstances int, mtu int, rateLimiter RateLimiter, maxStreamsPerClientID int, balancer Balancer) *httpHandler {
 	pconns := make([]*turbotunnel.QueuePacketConn, 0, numInstances)
 	for i := 0; i < numInstances; i++ {
 		pconns = append(pconns, turbotunnel.NewQueuePacketConn(localAddr, clientMapTimeout, mtu))
@@ -81,17 +113,25 @@ func newHTTPHandler(localAddr net.Addr, numInstances int, mtu int) *httpHandler
 		panic(err)
 	}
 
+	if balancer == nil {
+		balancer = newHMACBalancer(clientIDLookupKey)
+	}
+
 	return &httpHandler{
-		pconns:            pconns,
-		clientIDLookupKey: clientIDLookupKey,
+		pconns:                pconns,
+		balancer:              balancer,
+		clientIDLookupKey:     clientIDLookupKey,
+		rateLimiter:           rateLimiter,
+		maxStreamsPerClientID: maxStreamsPerClientID,
 	}
 }
 
-// lookupPacketConn returns the element of pconns that corresponds to client ID,
-// according to the hash-based mapping.
+// lookupPacketConn returns the element of pconns that handler.balancer
+// assigns clientID to.
 func (handler *httpHandler) lookupPacketConn(clientID turbotunnel.ClientID) *turbotunnel.QueuePacketConn {
-	s := hmac.New(sha256.New, handler.clientIDLookupKey).Sum(clientID[:])
-	return handler.pconns[binary.LittleEndian.Uint64(s)%uint64(len(handler.pconns))]
+	handler.pconnsLock.RLock()
+	defer handler.pconnsLock.RUnlock()
+	return handler.pconns[handler.balancer.Assign(clientID, handler.pconns)]
 }
 
 func (handler *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -137,6 +177,117 @@ func (handler *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// newWebTransportServer builds a *webtransport.Server that serves
+// handler's turbotunnel streams over WebTransport-over-HTTP/3, sharing
+// tlsConfig -- the same certificate as the plain HTTPS/WebSocket
+// listener ServeHTTP is attached to -- with "h3" spliced into its
+// NextProtos for ALPN negotiation.
+func newWebTransportServer(addr string, tlsConfig *tls.Config, handler *httpHandler) *webtransport.Server {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = appendIfMissing(tlsConfig.NextProtos, http3.NextProtoH3)
+
+	server := &webtransport.Server{
+		H3: http3.Server{
+			Addr:      addr,
+			TLSConfig: tlsConfig,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeWebTransport(w, r, server)
+	})
+	server.H3.Handler = mux
+
+	return server
+}
+
+func appendIfMissing(protos []string, proto string) []string {
+	for _, p := range protos {
+		if p == proto {
+			return protos
+		}
+	}
+
+	return append(protos, proto)
+}
+
+// ServeWebTransport upgrades an incoming HTTP/3 CONNECT request with
+// :protocol=webtransport into a WebTransport session (via s.Upgrade) and
+// adapts each of its bidirectional streams into a net.Conn fed to
+// turbotunnelMode, the same stream-of-encapsulated-packets path
+// ServeHTTP uses for WebSocket connections. This lets a single tor
+// instance serve classic WebSocket and WebTransport-capable proxies
+// side by side, sharing pconns and clientIDAddrMap.
+func (handler *httpHandler) ServeWebTransport(w http.ResponseWriter, r *http.Request, s *webtransport.Server) {
+	session, err := s.Upgrade(w, r)
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	// Pass the address of client as the remote address of incoming connection,
+	// mirroring ServeHTTP's clientAddr handling.
+	clientIPParam := r.URL.Query().Get("client_ip")
+	addr := clientAddr(clientIPParam)
+
+	for {
+		stream, err := session.AcceptStream(r.Context())
+		if err != nil {
+			// The session is closed, or the client isn't opening any
+			// more streams on it.
+			return
+		}
+		go handler.handleWebTransportStream(stream, addr)
+	}
+}
+
+// handleWebTransportStream reads the same turbotunnel.Token + ClientID
+// prefix a WebSocket connection would, off a single WebTransport
+// bidirectional stream, then hands off to turbotunnelMode exactly as
+// ServeHTTP does.
+func (handler *httpHandler) handleWebTransportStream(stream webtransport.Stream, addr net.Addr) {
+	conn := &webTransportStreamConn{Stream: stream, remoteAddr: addr}
+	defer conn.Close()
+
+	var token [len(turbotunnel.Token)]byte
+	_, err := io.ReadFull(conn, token[:])
+	if err != nil {
+		if err != io.EOF {
+			log.Printf("reading token: %v", err)
+		}
+
+		return
+	}
+	if !bytes.Equal(token[:], turbotunnel.Token[:]) {
+		log.Println("Received unsupported oneshot connection")
+
+		return
+	}
+
+	if err := handler.turbotunnelMode(conn, addr); err != nil {
+		log.Println(err)
+	}
+}
+
+// webTransportStreamConn adapts a webtransport.Stream -- which already
+// has Read, Write, Close, and the three deadline methods -- into a full
+// net.Conn by supplying LocalAddr/RemoteAddr, neither of which a raw
+// WebTransport stream carries on its own.
+type webTransportStreamConn struct {
+	webtransport.Stream
+	remoteAddr net.Addr
+}
+
+func (c *webTransportStreamConn) LocalAddr() net.Addr {
+	return ClientMapAddr("")
+}
+
+func (c *webTransportStreamConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
 // turbotunnelMode handles clients that sent turbotunnel.Token at the start of
 // their stream. These clients expect to send and receive encapsulated packets,
 // with a long-lived session identified by ClientID.
@@ -160,6 +311,15 @@ func (handler *httpHandler) turbotunnelMode(conn net.Conn, addr net.Addr) error
 	// credited for the entire KCP session.
 	clientIDAddrMap.Set(clientID, addr)
 
+	// Cap how many concurrent streams (WebSocket connections or
+	// WebTransport substreams) a single ClientID may have open, so a
+	// flood of connections all presenting one stolen or brute-forced
+	// ClientID can't grow KCP work and memory without bound.
+	if !clientIDAddrMap.AcquireStream(clientID, handler.maxStreamsPerClientID) {
+		return fmt.Errorf("too many concurrent streams for ClientID %v", clientID)
+	}
+	defer clientIDAddrMap.ReleaseStream(clientID)
+
 	pconn := handler.lookupPacketConn(clientID)
 
 	var wg sync.WaitGroup
@@ -178,6 +338,19 @@ func (handler *httpHandler) turbotunnelMode(conn net.Conn, addr net.Addr) error
 			if err != nil {
 				return
 			}
+			if handler.rateLimiter != nil && !handler.rateLimiter.Allow(clientID, addr, len(p)) {
+				// Short-circuit: stop servicing this stream rather
+				// than keep queuing packets for an over-budget
+				// ClientID or subnet. Returning closes done, which
+				// makes the write loop below return and close conn.
+				// conn is a transport-agnostic net.Conn here (see
+				// webTransportStreamConn and ServeHTTP's
+				// websocketconn.New), so there's no WebSocket-specific
+				// close code available to send from this layer --
+				// closing conn is the transport-agnostic equivalent of
+				// a policy-violation close.
+				return
+			}
 			pconn.QueueIncoming(p, clientID)
 		}
 	}()
@@ -195,12 +368,12 @@ func (handler *httpHandler) turbotunnelMode(conn net.Conn, addr net.Addr) error
 			select {
 			case <-done:
 				return
-			case p, ok := <-pconn.OutgoingQueue(clientID):
+			case bufp, ok := <-pconn.OutgoingQueue(clientID):
 				if !ok {
 					return
 				}
-				_, err := encapsulation.WriteData(bw, p)
-				pconn.Restore(p)
+				_, err := encapsulation.WriteData(bw, *bufp)
+				pconn.Restore(bufp)
 				if err == nil {
 					err = bw.Flush()
 				}
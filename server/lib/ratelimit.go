@@ -0,0 +1,207 @@
+package snowflake_server
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	"gitlab.torproject.org/tpo/anti-censorship/pluggable-transports/snowflake/v2/common/turbotunnel"
+)
+
+const rateLimiterMetricNamespace = "snowflake_server"
+
+// RateLimiterConfig holds the token-bucket parameters for a
+// tokenBucketRateLimiter, independently for the packet-count and
+// byte-count dimensions. Both dimensions are enforced twice over, once
+// per ClientID and once per source subnet (see tokenBucketRateLimiter),
+// so neither key alone has to carry the whole policy.
+type RateLimiterConfig struct {
+	// PacketsPerSecond and PacketBurst bound how many encapsulated
+	// packets a bucket may admit.
+	PacketsPerSecond float64
+	PacketBurst      int
+
+	// BytesPerSecond and ByteBurst bound how many bytes of
+	// encapsulated packet payload a bucket may admit.
+	BytesPerSecond float64
+	ByteBurst      int
+}
+
+// DefaultRateLimiterConfig is a conservative starting point: generous
+// enough not to bother a single well-behaved client, tight enough to
+// blunt a flood concentrated on one ClientID or one /24 or /48.
+var DefaultRateLimiterConfig = RateLimiterConfig{
+	PacketsPerSecond: 2000,
+	PacketBurst:      4000,
+	BytesPerSecond:   4_000_000,
+	ByteBurst:        8_000_000,
+}
+
+// RateLimiter decides whether an incoming encapsulated packet from
+// clientID, sourced from addr, may be admitted to pconn.QueueIncoming.
+// Allow is called once per incoming packet from turbotunnelMode's read
+// loop and must be safe for concurrent use, since every open WebSocket
+// or WebTransport stream runs its own read loop.
+type RateLimiter interface {
+	Allow(clientID turbotunnel.ClientID, addr net.Addr, packetLen int) bool
+}
+
+// subnetKey reduces addr to its /24 (IPv4) or /48 (IPv6) prefix, so
+// that many ClientIDs presented from behind the same subnet share one
+// bucket regardless of which address within it any single stream used.
+// An address that can't be parsed (including the empty ClientMapAddr
+// clientAddr returns when the proxy reported no client_ip) collapses to
+// the empty key, and so shares a single bucket across all such streams.
+func subnetKey(addr net.Addr) string {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// tokenBucket pairs a packet-count and a byte-count rate.Limiter, the
+// two dimensions tracked per ClientID and per subnet.
+type tokenBucket struct {
+	packets *rate.Limiter
+	bytes   *rate.Limiter
+}
+
+func newTokenBucket(cfg RateLimiterConfig) *tokenBucket {
+	return &tokenBucket{
+		packets: rate.NewLimiter(rate.Limit(cfg.PacketsPerSecond), cfg.PacketBurst),
+		bytes:   rate.NewLimiter(rate.Limit(cfg.BytesPerSecond), cfg.ByteBurst),
+	}
+}
+
+// bucketSetEntry is the list.Element payload for a boundedBucketSet.
+type bucketSetEntry struct {
+	key    string
+	bucket *tokenBucket
+}
+
+// boundedBucketSet is a capacity-bounded, least-recently-used cache of
+// tokenBuckets keyed by an arbitrary string (a ClientID's String() form,
+// or a subnetKey). It exists so the rate limiter's own bookkeeping can't
+// itself be used to exhaust memory by presenting unboundedly many
+// ClientIDs or source subnets, mirroring clientIDMap's capacity bound
+// for the same reason.
+type boundedBucketSet struct {
+	lock     sync.Mutex
+	capacity int
+	cfg      RateLimiterConfig
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+func newBoundedBucketSet(capacity int, cfg RateLimiterConfig) *boundedBucketSet {
+	return &boundedBucketSet{
+		capacity: capacity,
+		cfg:      cfg,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the bucket for key, creating one (and evicting the least
+// recently used bucket, if the set is full) when it doesn't already
+// exist.
+func (s *boundedBucketSet) get(key string) *tokenBucket {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.order.MoveToFront(elem)
+		return elem.Value.(*bucketSetEntry).bucket
+	}
+
+	if s.capacity > 0 && len(s.entries) >= s.capacity {
+		if oldest := s.order.Back(); oldest != nil {
+			s.order.Remove(oldest)
+			delete(s.entries, oldest.Value.(*bucketSetEntry).key)
+		}
+	}
+
+	bucket := newTokenBucket(s.cfg)
+	s.entries[key] = s.order.PushFront(&bucketSetEntry{key: key, bucket: bucket})
+	return bucket
+}
+
+// tokenBucketRateLimiter is the default RateLimiter. It keeps two sets
+// of token buckets, one keyed by ClientID and one keyed by subnetKey,
+// and admits a packet only if both its ClientID bucket and its subnet
+// bucket have room in both dimensions. Keying by ClientID closes the
+// gap a source-IP-only limiter would leave open: a client that rotates
+// across many WebSocket proxies presents many source IPs but reuses the
+// same ClientID, so the ClientID bucket still catches it. Keying by
+// subnet in addition catches the opposite case, many ClientIDs minted
+// from behind one subnet.
+type tokenBucketRateLimiter struct {
+	byClientID *boundedBucketSet
+	bySubnet   *boundedBucketSet
+	drops      *prometheus.CounterVec
+}
+
+// NewTokenBucketRateLimiter builds a RateLimiter enforcing cfg, with
+// constLabels attached to its Prometheus collector the same way
+// sinks.NewPrometheusReceiver tags its own, so an operator running a
+// pool of servers can tell which instance a drop series came from.
+// Register the returned limiter's Collectors with a
+// prometheus.Registerer before passing it to newHTTPHandler.
+func NewTokenBucketRateLimiter(cfg RateLimiterConfig, constLabels prometheus.Labels) *tokenBucketRateLimiter {
+	return &tokenBucketRateLimiter{
+		byClientID: newBoundedBucketSet(clientIDAddrMapCapacity, cfg),
+		bySubnet:   newBoundedBucketSet(clientIDAddrMapCapacity, cfg),
+		drops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   rateLimiterMetricNamespace,
+			Name:        "rate_limit_drops_total",
+			Help:        "Encapsulated packets dropped by the turbotunnelMode rate limiter, labeled by the dimension and key kind that triggered the drop.",
+			ConstLabels: constLabels,
+		}, []string{"dimension", "key"}),
+	}
+}
+
+// Collectors returns the Prometheus collectors backing l, for
+// registration with a prometheus.Registerer.
+func (l *tokenBucketRateLimiter) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{l.drops}
+}
+
+// Allow implements RateLimiter.
+func (l *tokenBucketRateLimiter) Allow(clientID turbotunnel.ClientID, addr net.Addr, packetLen int) bool {
+	now := time.Now()
+
+	client := l.byClientID.get(clientID.String())
+	if !client.packets.AllowN(now, 1) {
+		l.drops.WithLabelValues("packets", "clientid").Inc()
+		return false
+	}
+	if !client.bytes.AllowN(now, packetLen) {
+		l.drops.WithLabelValues("bytes", "clientid").Inc()
+		return false
+	}
+
+	subnet := l.bySubnet.get(subnetKey(addr))
+	if !subnet.packets.AllowN(now, 1) {
+		l.drops.WithLabelValues("packets", "subnet").Inc()
+		return false
+	}
+	if !subnet.bytes.AllowN(now, packetLen) {
+		l.drops.WithLabelValues("bytes", "subnet").Inc()
+		return false
+	}
+
+	return true
+}